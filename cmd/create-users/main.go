@@ -92,6 +92,11 @@ func createNewUsers(db *gorm.DB) error {
 		},
 	}
 
+	organizacao, err := database.OrganizacaoPadrao(db)
+	if err != nil {
+		return err
+	}
+
 	for _, userData := range users {
 		// Hash da senha
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userData.Password), bcrypt.DefaultCost)
@@ -108,6 +113,8 @@ func createNewUsers(db *gorm.DB) error {
 			Tipo:     userData.Tipo,
 			Ativo:    true,
 			Telefone: &telefone,
+
+			OrganizacaoID: organizacao.ID,
 		}
 
 		if err := db.Create(&user).Error; err != nil {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"tappyone/internal/config"
+	"tappyone/internal/database"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// Ferramenta do operador para o armazenamento de mídia:
+//
+//	go run ./cmd/midias consumidores [-limite 20]
+//	go run ./cmd/midias cota <organizacaoId> <MB|padrao>
+func main() {
+	if len(os.Args) < 2 {
+		uso()
+	}
+
+	cfg := config.Load()
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal("Falha ao conectar com o banco de dados:", err)
+	}
+
+	armazenamento, err := services.NewMediaStorage(cfg)
+	if err != nil {
+		log.Fatal("Falha ao configurar armazenamento de mídia:", err)
+	}
+	midias := services.NewMidiaService(db, armazenamento, cfg)
+
+	switch os.Args[1] {
+	case "consumidores":
+		flags := flag.NewFlagSet("consumidores", flag.ExitOnError)
+		limite := flags.Int("limite", 20, "quantidade de organizações")
+		flags.Parse(os.Args[2:])
+
+		consumidores, err := midias.MaioresOrganizacoes(*limite)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("%-36s  %-30s  %8s  %12s  %12s\n", "ORGANIZAÇÃO", "NOME", "MÍDIAS", "USO (MB)", "COTA (MB)")
+		for _, consumidor := range consumidores {
+			cota := "ilimitada"
+			if consumidor.CotaBytes != nil && *consumidor.CotaBytes > 0 {
+				cota = fmt.Sprintf("%.1f", megabytes(*consumidor.CotaBytes))
+			}
+			fmt.Printf("%-36s  %-30.30s  %8d  %12.1f  %12s\n",
+				consumidor.ID, consumidor.Nome, consumidor.Midias, megabytes(consumidor.Bytes), cota)
+		}
+
+	case "cota":
+		if len(os.Args) != 4 {
+			uso()
+		}
+		organizacaoID := os.Args[2]
+
+		// "padrao" volta a usar MEDIA_QUOTA_MB
+		var cota *int64
+		if os.Args[3] != "padrao" {
+			mb, err := strconv.ParseInt(os.Args[3], 10, 64)
+			if err != nil || mb < 0 {
+				log.Fatalf("Cota inválida: %s", os.Args[3])
+			}
+			bytes := mb << 20
+			cota = &bytes
+		}
+
+		resultado := db.Model(&models.Organizacao{}).Where("id = ?", organizacaoID).Update("cota_midia_bytes", cota)
+		if resultado.Error != nil {
+			log.Fatal(resultado.Error)
+		}
+		if resultado.RowsAffected == 0 {
+			log.Fatalf("Organização %s não encontrada", organizacaoID)
+		}
+		fmt.Printf("Cota de mídia da organização %s atualizada\n", organizacaoID)
+
+	default:
+		uso()
+	}
+}
+
+func megabytes(bytes int64) float64 {
+	return float64(bytes) / (1 << 20)
+}
+
+func uso() {
+	fmt.Fprintln(os.Stderr, "uso: midias consumidores [-limite N] | midias cota <organizacaoId> <MB|padrao>")
+	os.Exit(2)
+}
@@ -68,6 +68,11 @@ func createTestUsers(db *gorm.DB) error {
 		},
 	}
 
+	organizacao, err := database.OrganizacaoPadrao(db)
+	if err != nil {
+		return err
+	}
+
 	for _, userData := range users {
 		// Verificar se usuário já existe
 		var existingUser models.Usuario
@@ -92,6 +97,8 @@ func createTestUsers(db *gorm.DB) error {
 			Tipo:     userData.Tipo,
 			Ativo:    true,
 			Telefone: &telefone,
+
+			OrganizacaoID: organizacao.ID,
 		}
 
 		if err := db.Create(&user).Error; err != nil {
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"tappyone/internal/config"
 	"tappyone/internal/database"
@@ -43,6 +44,30 @@ func main() {
 	// Inicializar serviços
 	serviceContainer := services.NewContainer(db, redisClient, cfg)
 
+	// Iniciar avaliador de SLA em background
+	serviceContainer.SLAService.Iniciar(time.Minute)
+
+	// Iniciar fila de entrega dos webhooks de saída
+	serviceContainer.WebhookService.Iniciar(15 * time.Second)
+
+	// Iniciar workers dos webhooks recebidos do WAHA
+	serviceContainer.IngestaoWebhookService.Iniciar()
+
+	// Iniciar supervisor das sessões do WhatsApp
+	serviceContainer.SupervisorSessoes.Iniciar(time.Minute)
+
+	// Iniciar fila de processamento de mídia (miniaturas, conversão de áudio e metadados)
+	serviceContainer.ProcessamentoMidia.Iniciar(time.Minute)
+
+	// Iniciar limpeza agendada das mídias pelas políticas de retenção
+	serviceContainer.RetencaoMidia.Iniciar(config.ParseDuration(cfg.MediaRetentionInterval, 24*time.Hour))
+
+	// Iniciar fila de transcrição das mensagens de voz (quando há provedor configurado)
+	serviceContainer.Transcricao.Iniciar(30 * time.Second)
+
+	// Iniciar campanhas agendadas e retomar os disparos interrompidos
+	serviceContainer.Campanhas.Iniciar(time.Minute)
+
 	// Configurar modo do Gin
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -53,6 +78,10 @@ func main() {
 	r := router.Setup(serviceContainer)
 	log.Println("Rotas configuradas com sucesso")
 
+	// Retomar importações de histórico interrompidas (após as rotas, que
+	// registram o processador de mídia)
+	serviceContainer.ImportacaoHistorico.RetomarInterrompidas()
+
 	// Iniciar servidors
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -15,14 +16,30 @@ type Config struct {
 	RedisURL string
 
 	// JWT
-	JWTSecret    string
-	JWTExpiresIn string
+	JWTSecret           string
+	JWTExpiresIn        string // validade do access token (ex: 15m)
+	JWTRefreshExpiresIn string // validade do refresh token (ex: 30d)
+
+	// Chave para cifrar os segredos TOTP; quando vazia é derivada do JWTSecret
+	TwoFactorEncryptionKey string
+
+	// Proteção do login contra força bruta
+	LoginMaxFailures      int    // falhas por email até bloquear a conta
+	LoginMaxFailuresPerIP int    // falhas por IP até bloquear o IP
+	LoginLockoutDuration  string // duração do bloqueio (ex: 15m)
 
 	// WhatsApp API
 	WhatsAppAPIURL   string
 	WhatsAppAPIToken string
 	WebhookURL       string
 
+	// Webhooks recebidos do WAHA
+	WAHAWebhookSecret    string // segredo compartilhado (header X-Webhook-Secret ou ?token=)
+	WAHAWebhookHMACKey   string // chave HMAC configurada no WAHA (header X-Webhook-Hmac); tem precedência sobre o segredo
+	WAHAWebhookWorkers   int    // workers que processam a fila de eventos
+	WAHAWebhookQueueSize int    // capacidade da fila; cheia, o webhook responde 503
+	WAHAWebhookDedupeTTL string // tempo de retenção dos ids para deduplicação (ex: 24h)
+
 	// Email SMTP
 	SMTPHost string
 	SMTPPort int
@@ -34,9 +51,61 @@ type Config struct {
 	DeepSeekAPIKey string
 	DeepSeekAPIURL string
 
+	// WebSocket
+	WSAllowedOrigins        []string
+	WSMaxConnectionsPerUser int
+	WSMaxMessageSize        int64
+
+	// Organizações
+	OrgSignupEnabled bool // permite criar organizações pelo endpoint público
+
+	// Armazenamento de mídia
+	MediaStorage        string // local ou s3
+	MediaLocalDir       string // diretório do armazenamento local
+	MediaSigningKey     string // chave HMAC das URLs assinadas; quando vazia é derivada do JWTSecret
+	MediaURLExpiresIn   string // validade das URLs assinadas (ex: 1h)
+	MediaMaxUploadBytes int64  // tamanho máximo aceito no upload
+	PublicBaseURL       string // endereço público da API usado nas URLs assinadas (precisa ser acessível pelo WAHA)
+	FFmpegPath          string // usado na conversão de áudio e nas miniaturas de vídeo; opcional
+	FFprobePath         string
+	MediaQuotaBytes     int64 // cota padrão por organização (0 = ilimitada)
+
+	// Retenção de mídia
+	MediaRetentionInterval string // intervalo entre as limpezas agendadas (ex: 24h)
+	MediaRetentionDryRun   bool   // limpeza agendada apenas registra o que seria removido
+
+	// Transcrição de áudio
+	TranscriptionProvider   string // whisper-http (API compatível com OpenAI), whisper-cpp ou vazio (desativada)
+	TranscriptionMaxSeconds int    // áudios mais longos não são transcritos
+	WhisperAPIURL           string
+	WhisperAPIKey           string
+	WhisperModel            string
+	WhisperCppPath          string // binário do whisper.cpp (whisper-cli)
+	WhisperCppModel         string // arquivo do modelo ggml
+
+	// Campanhas (disparo em massa)
+	CampaignMaxPerMinute   int      // teto de mensagens por minuto de cada sessão
+	CampaignOptOutKeywords []string // respostas que descadastram o contato (ex: SAIR, STOP)
+	CampaignOptOutReply    string   // confirmação enviada ao descadastrar; vazia não responde
+
+	// Fila de envio por sessão (anti-banimento), compartilhada por todos os envios
+	OutboundMaxPerMinute       int // mensagens por minuto de cada sessão (0 desativa o limite)
+	OutboundMaxPerHour         int // mensagens por hora de cada sessão (0 desativa o limite)
+	OutboundNewContactsPerHour int // primeiras mensagens para chats sem conversa, por hora
+	OutboundMaxWaitSeconds     int // espera máxima de um envio do atendente antes de recusar
+
+	// S3 compatível (AWS, MinIO)
+	S3Endpoint     string // ex: https://s3.amazonaws.com ou http://minio:9000
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UsePathStyle bool // endpoint/bucket/chave em vez de bucket.endpoint/chave (MinIO)
+
 	// Server
 	Port        string
 	Environment string
+	FrontendURL string
 }
 
 // loadEnvFile carrega variáveis de um arquivo .env
@@ -72,6 +141,20 @@ func Load() *Config {
 	loadEnvFile(".env")
 
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	wsMaxConnections, _ := strconv.Atoi(getEnv("WS_MAX_CONNECTIONS_PER_USER", "5"))
+	wsMaxMessageSize, _ := strconv.ParseInt(getEnv("WS_MAX_MESSAGE_SIZE", "65536"), 10, 64)
+	loginMaxFailures, _ := strconv.Atoi(getEnv("LOGIN_MAX_FAILURES", "10"))
+	loginMaxFailuresPerIP, _ := strconv.Atoi(getEnv("LOGIN_MAX_FAILURES_PER_IP", "50"))
+	wahaWebhookWorkers, _ := strconv.Atoi(getEnv("WAHA_WEBHOOK_WORKERS", "4"))
+	wahaWebhookQueueSize, _ := strconv.Atoi(getEnv("WAHA_WEBHOOK_QUEUE_SIZE", "1000"))
+	mediaMaxUploadMB, _ := strconv.ParseInt(getEnv("MEDIA_MAX_UPLOAD_MB", "64"), 10, 64)
+	mediaQuotaMB, _ := strconv.ParseInt(getEnv("MEDIA_QUOTA_MB", "0"), 10, 64)
+	transcriptionMaxSeconds, _ := strconv.Atoi(getEnv("TRANSCRIPTION_MAX_SECONDS", "600"))
+	campaignMaxPerMinute, _ := strconv.Atoi(getEnv("CAMPAIGN_MAX_PER_MINUTE", "20"))
+	outboundMaxPerMinute, _ := strconv.Atoi(getEnv("OUTBOUND_MAX_PER_MINUTE", "30"))
+	outboundMaxPerHour, _ := strconv.Atoi(getEnv("OUTBOUND_MAX_PER_HOUR", "600"))
+	outboundNewContactsPerHour, _ := strconv.Atoi(getEnv("OUTBOUND_NEW_CONTACTS_PER_HOUR", "40"))
+	outboundMaxWaitSeconds, _ := strconv.Atoi(getEnv("OUTBOUND_MAX_WAIT_SECONDS", "30"))
 
 	return &Config{
 		// Database
@@ -81,14 +164,27 @@ func Load() *Config {
 		RedisURL: getEnv("REDIS_URL", "redis://localhost:6379"),
 
 		// JWT
-		JWTSecret:    getEnv("JWT_SECRET", "sua-chave-secreta-jwt-aqui"),
-		JWTExpiresIn: getEnv("JWT_EXPIRES_IN", "7d"),
+		JWTSecret:           getEnv("JWT_SECRET", "sua-chave-secreta-jwt-aqui"),
+		JWTExpiresIn:        getEnv("JWT_EXPIRES_IN", "15m"),
+		JWTRefreshExpiresIn: getEnv("JWT_REFRESH_EXPIRES_IN", "30d"),
+
+		TwoFactorEncryptionKey: getEnv("TWO_FACTOR_ENCRYPTION_KEY", ""),
+
+		LoginMaxFailures:      loginMaxFailures,
+		LoginMaxFailuresPerIP: loginMaxFailuresPerIP,
+		LoginLockoutDuration:  getEnv("LOGIN_LOCKOUT_DURATION", "15m"),
 
 		// WhatsApp API
 		WhatsAppAPIURL:   getEnv("WAHA_API_URL", "http://159.65.34.199:3001/api"),
 		WhatsAppAPIToken: getEnv("WHATSAPP_API_TOKEN", "tappyone-waha-2024-secretkey"),
 		WebhookURL:       getEnv("WEBHOOK_URL", "http://159.65.34.199:3001/webhooks/whatsapp"),
 
+		WAHAWebhookSecret:    getEnv("WAHA_WEBHOOK_SECRET", ""),
+		WAHAWebhookHMACKey:   getEnv("WAHA_WEBHOOK_HMAC_KEY", ""),
+		WAHAWebhookWorkers:   wahaWebhookWorkers,
+		WAHAWebhookQueueSize: wahaWebhookQueueSize,
+		WAHAWebhookDedupeTTL: getEnv("WAHA_WEBHOOK_DEDUPE_TTL", "24h"),
+
 		// Email SMTP
 		SMTPHost: getEnv("SMTP_HOST", "smtp.hostinger.com"),
 		SMTPPort: smtpPort,
@@ -100,9 +196,56 @@ func Load() *Config {
 		DeepSeekAPIKey: getEnv("DEEPSEEK_API_KEY", ""),
 		DeepSeekAPIURL: getEnv("DEEPSEEK_API_URL", "https://api.deepseek.com"),
 
+		// WebSocket
+		WSAllowedOrigins:        splitList(getEnv("WS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:3001,https://crm.tappy.id")),
+		WSMaxConnectionsPerUser: wsMaxConnections,
+		WSMaxMessageSize:        wsMaxMessageSize,
+
+		// Organizações
+		OrgSignupEnabled: getEnv("ORG_SIGNUP_ENABLED", "false") == "true",
+
+		// Armazenamento de mídia
+		MediaStorage:        getEnv("MEDIA_STORAGE", "local"),
+		MediaLocalDir:       getEnv("MEDIA_LOCAL_DIR", "./uploads"),
+		MediaSigningKey:     getEnv("MEDIA_SIGNING_KEY", ""),
+		MediaURLExpiresIn:   getEnv("MEDIA_URL_EXPIRES_IN", "1h"),
+		MediaMaxUploadBytes: mediaMaxUploadMB << 20,
+		PublicBaseURL:       strings.TrimRight(getEnv("BASE_URL", "http://host.docker.internal:8080"), "/"),
+		FFmpegPath:          getEnv("FFMPEG_PATH", "ffmpeg"),
+		FFprobePath:         getEnv("FFPROBE_PATH", "ffprobe"),
+		MediaQuotaBytes:     mediaQuotaMB << 20,
+
+		MediaRetentionInterval: getEnv("MEDIA_RETENTION_INTERVAL", "24h"),
+		MediaRetentionDryRun:   getEnv("MEDIA_RETENTION_DRY_RUN", "false") == "true",
+
+		TranscriptionProvider:   getEnv("TRANSCRIPTION_PROVIDER", ""),
+		TranscriptionMaxSeconds: transcriptionMaxSeconds,
+		WhisperAPIURL:           strings.TrimRight(getEnv("WHISPER_API_URL", "https://api.openai.com/v1"), "/"),
+		WhisperAPIKey:           getEnv("WHISPER_API_KEY", ""),
+		WhisperModel:            getEnv("WHISPER_MODEL", "whisper-1"),
+		WhisperCppPath:          getEnv("WHISPER_CPP_PATH", "whisper-cli"),
+		WhisperCppModel:         getEnv("WHISPER_CPP_MODEL", ""),
+
+		CampaignMaxPerMinute:   campaignMaxPerMinute,
+		CampaignOptOutKeywords: splitList(getEnv("CAMPAIGN_OPT_OUT_KEYWORDS", "SAIR,STOP")),
+		CampaignOptOutReply:    getEnv("CAMPAIGN_OPT_OUT_REPLY", ""),
+
+		OutboundMaxPerMinute:       outboundMaxPerMinute,
+		OutboundMaxPerHour:         outboundMaxPerHour,
+		OutboundNewContactsPerHour: outboundNewContactsPerHour,
+		OutboundMaxWaitSeconds:     outboundMaxWaitSeconds,
+
+		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		S3Region:       getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:       getEnv("S3_BUCKET", ""),
+		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+		S3UsePathStyle: getEnv("S3_USE_PATH_STYLE", "true") == "true",
+
 		// Server
 		Port:        getEnv("PORT", "8080"),
 		Environment: getEnv("NODE_ENV", "development"),
+		FrontendURL: getEnv("FRONTEND_URL", "https://crm.tappy.id"),
 	}
 }
 
@@ -112,3 +255,30 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// splitList separa uma lista de valores delimitada por vírgulas
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseDuration interpreta durações no formato do Go, aceitando também dias (ex: "7d").
+// Retorna fallback quando o valor é inválido.
+func ParseDuration(value string, fallback time.Duration) time.Duration {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "d") {
+		if dias, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && dias > 0 {
+			return time.Duration(dias) * 24 * time.Hour
+		}
+		return fallback
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
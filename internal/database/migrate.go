@@ -2,6 +2,7 @@ package database
 
 import (
 	"log"
+	"strings"
 	"tappyone/internal/models"
 
 	"gorm.io/gorm"
@@ -18,16 +19,42 @@ func Migrate(db *gorm.DB) error {
 		return err
 	}
 	
+	// Índices únicos globais passaram a ser por organização
+	db.Exec("DROP INDEX IF EXISTS idx_tags_nome")
+	db.Exec("DROP INDEX IF EXISTS idx_papeis_nome")
+	
 	log.Printf("[MIGRATION] Running AutoMigrate...")
 	err := db.AutoMigrate(
+		// Organizações
+		&models.Organizacao{},
+		&models.ConviteOrganizacao{},
+		
 		// Usuários e autenticação
+		&models.Papel{},
 		&models.Usuario{},
+		&models.RefreshToken{},
+		&models.TokenRedefinicaoSenha{},
+		&models.DesafioDoisFatores{},
+		&models.CodigoRecuperacao{},
+		&models.ChaveAPI{},
+		&models.RegistroAuditoria{},
+		&models.HistoricoLogin{},
+		&models.Webhook{},
+		&models.EntregaWebhook{},
+		&models.EventoWebhookFalho{},
 		
 		// WhatsApp
 		&models.SessaoWhatsApp{},
+		&models.SessaoWhatsAppUsuario{},
+		&models.EventoSessaoWhatsApp{},
+		&models.ImportacaoHistorico{},
 		&models.Contato{},
 		&models.Conversa{},
 		&models.Mensagem{},
+		&models.Midia{},
+		&models.VinculoMidia{},
+		&models.PoliticaRetencaoMidia{},
+		&models.ExecucaoRetencaoMidia{},
 		
 		// Tags
 		&models.Tag{},
@@ -42,6 +69,11 @@ func Migrate(db *gorm.DB) error {
 		// Respostas rápidas
 		&models.RespostaRapida{},
 		// &models.CardRespostaRapida{}, // DESABILITADO TEMPORARIAMENTE
+
+		// Campanhas
+		&models.Campanha{},
+		&models.DestinatarioCampanha{},
+		&models.Descadastro{},
 		
 		// IA
 		&models.AgenteIa{},
@@ -49,6 +81,8 @@ func Migrate(db *gorm.DB) error {
 		// Atendimento
 		&models.Atendimento{},
 		&models.Agendamento{},
+		&models.PoliticaSLA{},
+		&models.EventoSLA{},
 		
 		// Chat interno
 		&models.MensagemInterna{},
@@ -80,10 +114,177 @@ func Migrate(db *gorm.DB) error {
 		return err
 	}
 	
+	log.Printf("[MIGRATION] Executing backfillOrganizacaoPadrao...")
+	if err := backfillOrganizacaoPadrao(db); err != nil {
+		log.Printf("[MIGRATION] Error in backfillOrganizacaoPadrao: %v", err)
+		return err
+	}
+	
+	log.Printf("[MIGRATION] Executing migrarConexoesWhatsApp...")
+	if err := migrarConexoesWhatsApp(db); err != nil {
+		log.Printf("[MIGRATION] Error in migrarConexoesWhatsApp: %v", err)
+		return err
+	}
+	
+	log.Printf("[MIGRATION] Executing indexarBuscaMensagens...")
+	if err := indexarBuscaMensagens(db); err != nil {
+		log.Printf("[MIGRATION] Error in indexarBuscaMensagens: %v", err)
+		return err
+	}
+	
+	log.Printf("[MIGRATION] Executing protegerAuditoria...")
+	if err := protegerAuditoria(db); err != nil {
+		log.Printf("[MIGRATION] Error in protegerAuditoria: %v", err)
+		return err
+	}
+	
+	log.Printf("[MIGRATION] Executing indexarEventosSLA...")
+	if err := indexarEventosSLA(db); err != nil {
+		log.Printf("[MIGRATION] Error in indexarEventosSLA: %v", err)
+		return err
+	}
+	
 	log.Printf("[MIGRATION] Migration completed successfully")
 	return nil
 }
 
+// indexarBuscaMensagens cria a coluna de busca textual das mensagens (gerada
+// pelo Postgres com stemming em português, sobre conteúdo, legenda e
+// transcrição do áudio), o índice GIN e o índice da paginação por cursor do
+// histórico. Espelha as migrações 013 e 018.
+func indexarBuscaMensagens(db *gorm.DB) error {
+	// A expressão de uma coluna gerada não pode ser alterada: a versão
+	// anterior, sem a transcrição, é removida junto com o índice e recriada
+	var expressao string
+	if err := db.Raw(`
+		SELECT pg_get_expr(d.adbin, d.adrelid) FROM pg_attribute a
+		JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = 'mensagens'::regclass AND a.attname = 'busca' AND NOT a.attisdropped
+	`).Scan(&expressao).Error; err != nil {
+		return err
+	}
+	if expressao != "" && !strings.Contains(expressao, "transcricao") {
+		log.Printf("[MIGRATION] Recriando coluna de busca das mensagens com a transcrição")
+		if err := db.Exec("ALTER TABLE mensagens DROP COLUMN busca").Error; err != nil {
+			return err
+		}
+	}
+
+	if err := db.Exec(`
+		ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS busca tsvector
+			GENERATED ALWAYS AS (to_tsvector('portuguese',
+				coalesce(conteudo, '') || ' ' || coalesce(legenda, '') || ' ' || coalesce(transcricao, ''))) STORED
+	`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_mensagens_busca ON mensagens USING GIN (busca)").Error; err != nil {
+		return err
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_mensagens_conversa_timestamp ON mensagens (conversa_id, timestamp DESC, id DESC)").Error
+}
+
+// indexarEventosSLA garante um único evento de SLA por atendimento, prazo e
+// estado, removendo duplicados antigos. Espelha a migração 021.
+func indexarEventosSLA(db *gorm.DB) error {
+	if err := db.Exec(`
+		DELETE FROM eventos_sla e USING eventos_sla o
+		WHERE e.atendimento_id = o.atendimento_id AND e.tipo_prazo = o.tipo_prazo AND e.estado = o.estado
+		  AND (e.detectado_em, e.id) > (o.detectado_em, o.id)
+	`).Error; err != nil {
+		return err
+	}
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_eventos_sla_atendimento_prazo_estado ON eventos_sla(atendimento_id, tipo_prazo, estado)").Error
+}
+
+// protegerAuditoria cria o trigger que impede UPDATE e DELETE no log de auditoria
+func protegerAuditoria(db *gorm.DB) error {
+	if err := db.Exec(`
+		CREATE OR REPLACE FUNCTION impedir_alteracao_auditoria() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'registros de auditoria são imutáveis';
+		END;
+		$$ LANGUAGE plpgsql
+	`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("DROP TRIGGER IF EXISTS registros_auditoria_imutavel ON registros_auditoria").Error; err != nil {
+		return err
+	}
+	return db.Exec(`
+		CREATE TRIGGER registros_auditoria_imutavel
+			BEFORE UPDATE OR DELETE ON registros_auditoria
+			FOR EACH ROW EXECUTE FUNCTION impedir_alteracao_auditoria()
+	`).Error
+}
+
+// migrarConexoesWhatsApp torna sessoes_whatsapp a única fonte do estado das
+// sessões: renomeia as sessões default_ criadas automaticamente para o nome
+// usado no WAHA (user_{uuid}), copia o estado das conexões do WhatsApp de
+// user_connections e remove essas conexões. Espelha a migração 011.
+func migrarConexoesWhatsApp(db *gorm.DB) error {
+	// Apenas uma sessão padrão por organização
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_sessoes_whatsapp_padrao ON sessoes_whatsapp(organizacao_id) WHERE padrao").Error; err != nil {
+		return err
+	}
+	
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			UPDATE sessoes_whatsapp s SET nome_sessao = 'user_' || s.usuario_id
+			WHERE s.nome_sessao = 'default_' || replace(s.usuario_id::text, '-', '')
+			  AND NOT EXISTS (SELECT 1 FROM sessoes_whatsapp o WHERE o.nome_sessao = 'user_' || s.usuario_id)
+		`).Error; err != nil {
+			return err
+		}
+		if !tx.Migrator().HasTable("user_connections") {
+			return nil
+		}
+		
+		if err := tx.Exec(`
+			INSERT INTO sessoes_whatsapp (id, nome_sessao, status, ativo, usuario_id, organizacao_id, criado_em, atualizado_em)
+			SELECT gen_random_uuid(), COALESCE(NULLIF(uc.session_name, ''), 'user_' || uc.user_id), 'DESCONECTADO', true,
+			       uc.user_id, u.organizacao_id, uc.created_at, NOW()
+			FROM user_connections uc
+			JOIN usuarios u ON u.id = uc.user_id
+			WHERE uc.platform = 'whatsapp' AND u.organizacao_id IS NOT NULL
+			  AND NOT EXISTS (
+			      SELECT 1 FROM sessoes_whatsapp s
+			      WHERE s.nome_sessao = COALESCE(NULLIF(uc.session_name, ''), 'user_' || uc.user_id)
+			  )
+			ON CONFLICT DO NOTHING
+		`).Error; err != nil {
+			return err
+		}
+		
+		if err := tx.Exec(`
+			UPDATE sessoes_whatsapp s SET
+			    status = CASE uc.status
+			        WHEN 'connected' THEN 'CONECTADO'
+			        WHEN 'connecting' THEN 'CONECTANDO'
+			        WHEN 'error' THEN 'FALHOU'
+			        ELSE 'DESCONECTADO'
+			    END,
+			    status_waha = uc.session_data->>'waha_status',
+			    conectado_em = uc.connected_at,
+			    desconectado_em = uc.disconnected_at,
+			    ultima_sincronizacao = uc.last_sync_at
+			FROM user_connections uc
+			WHERE uc.platform = 'whatsapp'
+			  AND s.nome_sessao = COALESCE(NULLIF(uc.session_name, ''), 'user_' || uc.user_id)
+		`).Error; err != nil {
+			return err
+		}
+		
+		result := tx.Exec("DELETE FROM user_connections WHERE platform = 'whatsapp'")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("[MIGRATION] %d conexões do WhatsApp migradas para sessoes_whatsapp", result.RowsAffected)
+		}
+		return nil
+	})
+}
+
 // fixConversaIdColumnType corrige o tipo da coluna conversa_id na tabela cards
 func fixConversaIdColumnType(db *gorm.DB) error {
 	log.Printf("[MIGRATION] Starting fixConversaIdColumnType...")
@@ -162,3 +363,68 @@ func createCardsTableManually(db *gorm.DB) error {
 	log.Printf("[MIGRATION] Cards table created successfully with VARCHAR conversa_id")
 	return nil
 }
+
+// OrganizacaoPadrao busca ou cria a organização que recebe os dados anteriores
+// à multi-organização e os usuários criados pelos comandos de seed
+func OrganizacaoPadrao(db *gorm.DB) (*models.Organizacao, error) {
+	var organizacao models.Organizacao
+	err := db.Where(models.Organizacao{Slug: "padrao"}).
+		Attrs(models.Organizacao{Nome: "Organização padrão", Ativo: true}).
+		FirstOrCreate(&organizacao).Error
+	if err != nil {
+		return nil, err
+	}
+	return &organizacao, nil
+}
+
+// tabelasOrganizacao tabelas cujos registros pertencem a uma organização
+var tabelasOrganizacao = []string{
+	"usuarios", "papeis", "sessoes_whatsapp", "contatos", "tags", "filas", "quadros", "fluxos",
+	"politicas_sla", "eventos_sla",
+}
+
+// backfillOrganizacaoPadrao garante a coluna organizacao_id nas tabelas criadas
+// por SQL e atribui os registros anteriores à multi-organização a uma
+// organização padrão
+func backfillOrganizacaoPadrao(db *gorm.DB) error {
+	// filas é criada pela migração 007 e não passa pelo AutoMigrate
+	if db.Migrator().HasTable("filas") {
+		db.Exec("ALTER TABLE filas ADD COLUMN IF NOT EXISTS organizacao_id UUID")
+		db.Exec("CREATE INDEX IF NOT EXISTS idx_filas_organizacao_id ON filas(organizacao_id)")
+	}
+	
+	pendentes := false
+	for _, tabela := range tabelasOrganizacao {
+		if !db.Migrator().HasTable(tabela) {
+			continue
+		}
+		var total int64
+		db.Table(tabela).Where("organizacao_id IS NULL").Count(&total)
+		if total > 0 {
+			pendentes = true
+			break
+		}
+	}
+	if !pendentes {
+		return nil
+	}
+	
+	organizacao, err := OrganizacaoPadrao(db)
+	if err != nil {
+		return err
+	}
+	
+	for _, tabela := range tabelasOrganizacao {
+		if !db.Migrator().HasTable(tabela) {
+			continue
+		}
+		result := db.Exec("UPDATE "+tabela+" SET organizacao_id = ? WHERE organizacao_id IS NULL", organizacao.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("[MIGRATION] %d registros de %s atribuídos à organização padrão", result.RowsAffected, tabela)
+		}
+	}
+	return nil
+}
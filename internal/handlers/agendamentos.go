@@ -8,16 +8,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 	"gorm.io/gorm"
 )
 
 // AgendamentosHandler gerencia os agendamentos
 type AgendamentosHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	organizacoes *repositories.OrganizacaoRepository
 }
 
 func NewAgendamentosHandler(db *gorm.DB) *AgendamentosHandler {
-	return &AgendamentosHandler{db: db}
+	return &AgendamentosHandler{
+		db:           db,
+		organizacoes: repositories.NewOrganizacaoRepository(db),
+	}
 }
 
 // ListAgendamentos lista todos os agendamentos do usuário
@@ -39,8 +44,7 @@ func (h *AgendamentosHandler) ListAgendamentos(c *gin.Context) {
 		numeroTelefone := strings.Replace(contatoJID, "@c.us", "", 1)
 		
 		// Buscar contato pelo número de telefone
-		var contato models.Contato
-		if err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error; err == nil {
+		if contato, err := h.organizacoes.BuscarContatoPorTelefone(c.GetString("organizacao_id"), numeroTelefone); err == nil {
 			// Se contato encontrado, filtrar por UUID do contato
 			query = query.Where("contato_id = ?", contato.ID)
 		} else {
@@ -129,24 +133,16 @@ func (h *AgendamentosHandler) CreateAgendamento(c *gin.Context) {
 	// Extrair número de telefone do JID (remove @c.us)
 	numeroTelefone := strings.Replace(req.ContatoID, "@c.us", "", 1)
 	
-	// Buscar ou criar contato baseado no número de telefone
+	// Buscar ou criar contato da organização baseado no número de telefone
+	organizacaoID := c.GetString("organizacao_id")
 	var contato models.Contato
-	err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error
+	existente, err := h.organizacoes.BuscarContatoPorTelefone(organizacaoID, numeroTelefone)
 	if err != nil {
-		// Buscar ou criar uma sessão WhatsApp padrão
-		var sessaoWhatsapp models.SessaoWhatsApp
-		err := h.db.Where("nome_sessao = ?", "default").First(&sessaoWhatsapp).Error
+		// Sessão WhatsApp padrão do usuário na organização
+		sessaoWhatsapp, err := h.organizacoes.SessaoPadrao(organizacaoID, userID)
 		if err != nil {
-			// Criar sessão padrão se não existir
-			sessaoWhatsapp = models.SessaoWhatsApp{
-				NomeSessao: "default",
-				Status:     "ATIVO",
-				UsuarioID:  userID,
-			}
-			if err := h.db.Create(&sessaoWhatsapp).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão padrão"})
-				return
-			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão padrão"})
+			return
 		}
 		
 		// Se contato não existe, criar um novo com todos os dados
@@ -165,12 +161,15 @@ func (h *AgendamentosHandler) CreateAgendamento(c *gin.Context) {
 			Estado:           req.Contato.Estado,
 			Pais:             req.Contato.Pais,
 			SessaoWhatsappID: sessaoWhatsapp.ID,
+			OrganizacaoID:    organizacaoID,
 		}
 		if err := h.db.Create(&contato).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
 			return
 		}
 	} else {
+		contato = *existente
+
 		// Se contato existe, atualizar com novos dados
 		updates := map[string]interface{}{}
 		
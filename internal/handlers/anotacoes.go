@@ -9,15 +9,20 @@ import (
 	"gorm.io/gorm"
 
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 )
 
 // AnotacoesHandler gerencia as anotações
 type AnotacoesHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	organizacoes *repositories.OrganizacaoRepository
 }
 
 func NewAnotacoesHandler(db *gorm.DB) *AnotacoesHandler {
-	return &AnotacoesHandler{db: db}
+	return &AnotacoesHandler{
+		db:           db,
+		organizacoes: repositories.NewOrganizacaoRepository(db),
+	}
 }
 
 // ListAnotacoes lista todas as anotações do usuário
@@ -39,8 +44,7 @@ func (h *AnotacoesHandler) ListAnotacoes(c *gin.Context) {
 		numeroTelefone := strings.Replace(contatoJID, "@c.us", "", 1)
 		
 		// Buscar contato pelo número de telefone
-		var contato models.Contato
-		if err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error; err == nil {
+		if contato, err := h.organizacoes.BuscarContatoPorTelefone(c.GetString("organizacao_id"), numeroTelefone); err == nil {
 			// Se contato encontrado, filtrar por UUID do contato
 			query = query.Where("contato_id = ?", contato.ID)
 		} else {
@@ -91,36 +95,11 @@ func (h *AnotacoesHandler) CreateAnotacao(c *gin.Context) {
 	// Extrair número de telefone do JID (remove @c.us)
 	numeroTelefone := strings.Replace(req.ContatoID, "@c.us", "", 1)
 	
-	// Buscar ou criar contato baseado no número de telefone
-	var contato models.Contato
-	err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error
+	// Buscar ou criar contato da organização baseado no número de telefone
+	contato, err := h.organizacoes.BuscarOuCriarContato(c.GetString("organizacao_id"), userID, numeroTelefone)
 	if err != nil {
-		// Buscar ou criar uma sessão WhatsApp padrão
-		var sessaoWhatsapp models.SessaoWhatsApp
-		err := h.db.Where("nome_sessao = ?", "default").First(&sessaoWhatsapp).Error
-		if err != nil {
-			// Criar sessão padrão se não existir
-			sessaoWhatsapp = models.SessaoWhatsApp{
-				NomeSessao: "default",
-				Status:     "ATIVO",
-				UsuarioID:  userID,
-			}
-			if err := h.db.Create(&sessaoWhatsapp).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão padrão"})
-				return
-			}
-		}
-		
-		// Se contato não existe, criar um novo
-		contato = models.Contato{
-			NumeroTelefone:   numeroTelefone,
-			Nome:             &numeroTelefone, // Usar número como nome temporário
-			SessaoWhatsappID: sessaoWhatsapp.ID, // Usar sessão padrão
-		}
-		if err := h.db.Create(&contato).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
-			return
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
+		return
 	}
 
 	anotacao := models.Anotacao{
@@ -7,16 +7,24 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
 	"gorm.io/gorm"
 )
 
 // AssinaturasHandler gerencia as assinaturas
 type AssinaturasHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	organizacoes *repositories.OrganizacaoRepository
+	auditoria    *services.AuditoriaService
 }
 
-func NewAssinaturasHandler(db *gorm.DB) *AssinaturasHandler {
-	return &AssinaturasHandler{db: db}
+func NewAssinaturasHandler(db *gorm.DB, auditoria *services.AuditoriaService) *AssinaturasHandler {
+	return &AssinaturasHandler{
+		db:           db,
+		organizacoes: repositories.NewOrganizacaoRepository(db),
+		auditoria:    auditoria,
+	}
 }
 
 // ListAssinaturas lista todas as assinaturas do usuário
@@ -39,8 +47,7 @@ func (h *AssinaturasHandler) ListAssinaturas(c *gin.Context) {
 		numeroTelefone := strings.Replace(contatoJID, "@c.us", "", 1)
 		
 		// Buscar contato pelo número de telefone
-		var contato models.Contato
-		if err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error; err == nil {
+		if contato, err := h.organizacoes.BuscarContatoPorTelefone(c.GetString("organizacao_id"), numeroTelefone); err == nil {
 			// Se contato encontrado, filtrar por UUID do contato
 			query = query.Where("contato_id = ?", contato.ID)
 		} else {
@@ -100,36 +107,11 @@ func (h *AssinaturasHandler) CreateAssinatura(c *gin.Context) {
 	// Extrair número de telefone do JID (remove @c.us)
 	numeroTelefone := strings.Replace(req.ContatoID, "@c.us", "", 1)
 	
-	// Buscar ou criar contato baseado no número de telefone
-	var contato models.Contato
-	err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error
+	// Buscar ou criar contato da organização baseado no número de telefone
+	contato, err := h.organizacoes.BuscarOuCriarContato(c.GetString("organizacao_id"), userID, numeroTelefone)
 	if err != nil {
-		// Buscar ou criar uma sessão WhatsApp padrão
-		var sessaoWhatsapp models.SessaoWhatsApp
-		err := h.db.Where("nome_sessao = ?", "default").First(&sessaoWhatsapp).Error
-		if err != nil {
-			// Criar sessão padrão se não existir
-			sessaoWhatsapp = models.SessaoWhatsApp{
-				NomeSessao: "default",
-				Status:     "ATIVO",
-				UsuarioID:  userID,
-			}
-			if err := h.db.Create(&sessaoWhatsapp).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão padrão"})
-				return
-			}
-		}
-		
-		// Se contato não existe, criar um novo
-		contato = models.Contato{
-			NumeroTelefone:   numeroTelefone,
-			Nome:             &numeroTelefone, // Usar número como nome temporário
-			SessaoWhatsappID: sessaoWhatsapp.ID, // Usar sessão padrão
-		}
-		if err := h.db.Create(&contato).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
-			return
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
+		return
 	}
 
 	// Definir data de início (usar data atual se não fornecida)
@@ -177,6 +159,8 @@ func (h *AssinaturasHandler) CreateAssinatura(c *gin.Context) {
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "assinatura", assinatura.ID, nil, assinatura)
+
 	c.JSON(http.StatusCreated, assinatura)
 }
 
@@ -207,6 +191,8 @@ func (h *AssinaturasHandler) UpdateAssinatura(c *gin.Context) {
 		return
 	}
 
+	antes := assinatura
+
 	// Atualizar campos fornecidos
 	updates := make(map[string]interface{})
 	if req.Nome != nil {
@@ -246,6 +232,8 @@ func (h *AssinaturasHandler) UpdateAssinatura(c *gin.Context) {
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "assinatura", assinatura.ID, antes, assinatura)
+
 	c.JSON(http.StatusOK, assinatura)
 }
 
@@ -265,6 +253,8 @@ func (h *AssinaturasHandler) DeleteAssinatura(c *gin.Context) {
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "assinatura", assinatura.ID, assinatura, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Assinatura excluída com sucesso"})
 }
 
@@ -310,6 +300,9 @@ func (h *AssinaturasHandler) UpdateAssinaturaStatus(c *gin.Context) {
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "assinatura", assinatura.ID,
+		map[string]interface{}{"status": assinatura.Status}, map[string]interface{}{"status": req.Status})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Status atualizado com sucesso"})
 }
 
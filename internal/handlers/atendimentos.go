@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// AtendimentosHandler gerencia o ciclo de vida dos atendimentos
+type AtendimentosHandler struct {
+	db        *gorm.DB
+	auditoria *services.AuditoriaService
+	webhooks  *services.WebhookService
+}
+
+// NewAtendimentosHandler cria um novo handler de atendimentos
+func NewAtendimentosHandler(db *gorm.DB, auditoria *services.AuditoriaService, webhooks *services.WebhookService) *AtendimentosHandler {
+	return &AtendimentosHandler{
+		db:        db,
+		auditoria: auditoria,
+		webhooks:  webhooks,
+	}
+}
+
+// FinalizarAtendimento - POST /api/atendimentos/:id/finalizar
+// Marca o atendimento como resolvido e publica o evento atendimento.resolvido
+func (h *AtendimentosHandler) FinalizarAtendimento(c *gin.Context) {
+	organizacaoID := c.GetString("organizacao_id")
+
+	// O atendimento pertence à organização do contato
+	contatosDaOrganizacao := h.db.Model(&models.Contato{}).Select("id").Where("organizacao_id = ?", organizacaoID)
+
+	var atendimento models.Atendimento
+	if err := h.db.Where("id = ? AND contato_id IN (?)", c.Param("id"), contatosDaOrganizacao).First(&atendimento).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Atendimento não encontrado",
+		})
+		return
+	}
+	if atendimento.Status == models.StatusAtendimentoFinalizado || atendimento.Status == models.StatusAtendimentoCancelado {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Atendimento já encerrado",
+		})
+		return
+	}
+
+	antes := atendimento
+	agora := time.Now()
+	if err := h.db.Model(&atendimento).Updates(map[string]interface{}{
+		"status":        models.StatusAtendimentoFinalizado,
+		"finalizado_em": agora,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao finalizar atendimento",
+			"details": err.Error(),
+		})
+		return
+	}
+	atendimento.Status = models.StatusAtendimentoFinalizado
+	atendimento.FinalizadoEm = &agora
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "atendimento", atendimento.ID, antes, atendimento)
+	h.webhooks.Publicar(organizacaoID, models.EventoAtendimentoResolvido, atendimento)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    atendimento,
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// AuditoriaHandler consulta e exporta o log de auditoria da organização
+type AuditoriaHandler struct {
+	auditoriaService *services.AuditoriaService
+}
+
+// NewAuditoriaHandler cria um novo handler de auditoria
+func NewAuditoriaHandler(auditoriaService *services.AuditoriaService) *AuditoriaHandler {
+	return &AuditoriaHandler{
+		auditoriaService: auditoriaService,
+	}
+}
+
+// atorAuditoria identifica quem faz a requisição: o usuário ou a chave de API
+func atorAuditoria(c *gin.Context) services.AtorAuditoria {
+	ator := services.AtorAuditoria{
+		Tipo:          models.AtorAuditoriaUsuario,
+		ID:            c.GetString("user_id"),
+		UsuarioID:     c.GetString("user_id"),
+		OrganizacaoID: c.GetString("organizacao_id"),
+		IP:            c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+	}
+	if chaveID := c.GetString("api_key_id"); chaveID != "" {
+		ator.Tipo = models.AtorAuditoriaChaveAPI
+		ator.ID = chaveID
+	}
+	return ator
+}
+
+func filtroAuditoria(c *gin.Context) services.FiltroAuditoria {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	return services.FiltroAuditoria{
+		TipoAtor:   c.Query("tipoAtor"),
+		AtorID:     c.Query("atorId"),
+		UsuarioID:  c.Query("usuarioId"),
+		Acao:       c.Query("acao"),
+		Entidade:   c.Query("entidade"),
+		EntidadeID: c.Query("entidadeId"),
+		Desde:      parseDataQuery(c, "desde"),
+		Ate:        parseDataQuery(c, "ate"),
+		Page:       page,
+		Limit:      limit,
+	}
+}
+
+// ListarRegistros - GET /api/auditoria
+func (h *AuditoriaHandler) ListarRegistros(c *gin.Context) {
+	filtro := filtroAuditoria(c)
+
+	registros, total, err := h.auditoriaService.Listar(c.GetString("organizacao_id"), filtro)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar registros de auditoria",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    registros,
+		"total":   total,
+		"page":    filtro.Page,
+		"limit":   filtro.Limit,
+	})
+}
+
+// ExportarRegistros - GET /api/auditoria/export (CSV com os mesmos filtros, sem paginação)
+func (h *AuditoriaHandler) ExportarRegistros(c *gin.Context) {
+	filtro := filtroAuditoria(c)
+
+	nome := fmt.Sprintf("auditoria_%s.csv", time.Now().Format("20060102_150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", nome))
+	c.Status(http.StatusOK)
+
+	if err := h.auditoriaService.ExportarCSV(c.GetString("organizacao_id"), filtro, c.Writer); err != nil {
+		// Cabeçalhos já enviados: apenas registra a falha
+		log.Printf("[AUDITORIA] Erro ao exportar CSV: %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CampanhaHandler campanhas de disparo em massa e lista de descadastro
+type CampanhaHandler struct {
+	campanhas *services.CampanhaService
+	auditoria *services.AuditoriaService
+}
+
+func NewCampanhaHandler(campanhas *services.CampanhaService, auditoria *services.AuditoriaService) *CampanhaHandler {
+	return &CampanhaHandler{campanhas: campanhas, auditoria: auditoria}
+}
+
+// erroCampanha responde os erros de validação e de estado da campanha
+func erroCampanha(c *gin.Context, err error, mensagem string) {
+	switch {
+	case errors.Is(err, services.ErrCampanhaNaoEncontrada):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCampanhaSemConteudo),
+		errors.Is(err, services.ErrCampanhaSessaoInvalida),
+		errors.Is(err, services.ErrCampanhaRespostaRapida),
+		errors.Is(err, services.ErrCampanhaSegmentoVazio),
+		errors.Is(err, services.ErrSessaoNaoConectada):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCampanhaNaoEditavel),
+		errors.Is(err, services.ErrCampanhaNaoPausavel),
+		errors.Is(err, services.ErrCampanhaNaoRetomavel),
+		errors.Is(err, services.ErrCampanhaFinalizada),
+		errors.Is(err, services.ErrCampanhaEmExecucao):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("[CAMPANHA] %s: %v", mensagem, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": mensagem})
+	}
+}
+
+func (h *CampanhaHandler) buscarCampanha(c *gin.Context) (*models.Campanha, bool) {
+	campanha, err := h.campanhas.Buscar(c.GetString("organizacao_id"), c.Param("id"))
+	if err != nil {
+		erroCampanha(c, err, "Erro ao buscar campanha")
+		return nil, false
+	}
+	return campanha, true
+}
+
+// ListarCampanhas - GET /api/campanhas
+func (h *CampanhaHandler) ListarCampanhas(c *gin.Context) {
+	campanhas, err := h.campanhas.Listar(c.GetString("organizacao_id"), models.StatusCampanha(c.Query("status")))
+	if err != nil {
+		erroCampanha(c, err, "Erro ao listar campanhas")
+		return
+	}
+
+	c.JSON(http.StatusOK, campanhas)
+}
+
+// CriarCampanha - POST /api/campanhas
+func (h *CampanhaHandler) CriarCampanha(c *gin.Context) {
+	var dados services.DadosCampanha
+	if err := c.ShouldBindJSON(&dados); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	campanha, err := h.campanhas.Criar(c.GetString("organizacao_id"), c.GetString("user_id"), dados)
+	if err != nil {
+		erroCampanha(c, err, "Erro ao criar campanha")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "campanha", campanha.ID, nil, campanha)
+
+	c.JSON(http.StatusCreated, campanha)
+}
+
+// ObterCampanha - GET /api/campanhas/:id
+// Campanha com as estatísticas de envio, entrega, leitura e resposta
+func (h *CampanhaHandler) ObterCampanha(c *gin.Context) {
+	campanha, ok := h.buscarCampanha(c)
+	if !ok {
+		return
+	}
+
+	estatisticas, err := h.campanhas.Estatisticas(campanha.ID)
+	if err != nil {
+		erroCampanha(c, err, "Erro ao calcular estatísticas da campanha")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campanha": campanha, "estatisticas": estatisticas})
+}
+
+// AtualizarCampanha - PUT /api/campanhas/:id
+func (h *CampanhaHandler) AtualizarCampanha(c *gin.Context) {
+	campanha, ok := h.buscarCampanha(c)
+	if !ok {
+		return
+	}
+
+	var dados services.DadosCampanha
+	if err := c.ShouldBindJSON(&dados); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	antes := *campanha
+	if err := h.campanhas.Atualizar(campanha, dados); err != nil {
+		erroCampanha(c, err, "Erro ao atualizar campanha")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "campanha", campanha.ID, antes, campanha)
+
+	c.JSON(http.StatusOK, campanha)
+}
+
+// ExcluirCampanha - DELETE /api/campanhas/:id
+func (h *CampanhaHandler) ExcluirCampanha(c *gin.Context) {
+	campanha, ok := h.buscarCampanha(c)
+	if !ok {
+		return
+	}
+
+	if err := h.campanhas.Excluir(campanha); err != nil {
+		erroCampanha(c, err, "Erro ao excluir campanha")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "campanha", campanha.ID, campanha, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campanha excluída"})
+}
+
+// PreviaSegmento - POST /api/campanhas/segmento/previa
+// Quantidade de contatos do segmento (sem bloqueados e descadastrados) e amostra
+func (h *CampanhaHandler) PreviaSegmento(c *gin.Context) {
+	var segmento models.SegmentoCampanha
+	if err := c.ShouldBindJSON(&segmento); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	total, amostra, err := h.campanhas.PreviaSegmento(c.GetString("organizacao_id"), segmento)
+	if err != nil {
+		erroCampanha(c, err, "Erro ao calcular segmento")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "amostra": amostra})
+}
+
+// DispararCampanha - POST /api/campanhas/:id/disparar
+// Começa o envio agora ou no horário de agendadaPara
+func (h *CampanhaHandler) DispararCampanha(c *gin.Context) {
+	campanha, ok := h.buscarCampanha(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		AgendadaPara *time.Time `json:"agendadaPara"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	antes := *campanha
+	if err := h.campanhas.Disparar(campanha, req.AgendadaPara); err != nil {
+		erroCampanha(c, err, "Erro ao disparar campanha")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "campanha", campanha.ID, antes, campanha)
+
+	c.JSON(http.StatusAccepted, campanha)
+}
+
+// PausarCampanha - POST /api/campanhas/:id/pausar
+func (h *CampanhaHandler) PausarCampanha(c *gin.Context) {
+	h.alterarEstado(c, h.campanhas.Pausar, "Erro ao pausar campanha")
+}
+
+// RetomarCampanha - POST /api/campanhas/:id/retomar
+func (h *CampanhaHandler) RetomarCampanha(c *gin.Context) {
+	h.alterarEstado(c, h.campanhas.Retomar, "Erro ao retomar campanha")
+}
+
+// CancelarCampanha - POST /api/campanhas/:id/cancelar
+func (h *CampanhaHandler) CancelarCampanha(c *gin.Context) {
+	h.alterarEstado(c, h.campanhas.Cancelar, "Erro ao cancelar campanha")
+}
+
+func (h *CampanhaHandler) alterarEstado(c *gin.Context, alterar func(*models.Campanha) error, mensagem string) {
+	campanha, ok := h.buscarCampanha(c)
+	if !ok {
+		return
+	}
+
+	antes := *campanha
+	if err := alterar(campanha); err != nil {
+		erroCampanha(c, err, mensagem)
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "campanha", campanha.ID, antes, campanha)
+
+	c.JSON(http.StatusOK, campanha)
+}
+
+// ListarDestinatarios - GET /api/campanhas/:id/destinatarios
+func (h *CampanhaHandler) ListarDestinatarios(c *gin.Context) {
+	campanha, ok := h.buscarCampanha(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	status := models.StatusDestinatarioCampanha(c.Query("status"))
+	destinatarios, total, err := h.campanhas.ListarDestinatarios(campanha.ID, status, limit, (page-1)*limit)
+	if err != nil {
+		erroCampanha(c, err, "Erro ao listar destinatários")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  destinatarios,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// ListarDescadastros - GET /api/campanhas/descadastros
+func (h *CampanhaHandler) ListarDescadastros(c *gin.Context) {
+	descadastros, err := h.campanhas.ListarDescadastros(c.GetString("organizacao_id"), c.Query("busca"))
+	if err != nil {
+		erroCampanha(c, err, "Erro ao listar descadastros")
+		return
+	}
+
+	c.JSON(http.StatusOK, descadastros)
+}
+
+// CriarDescadastro - POST /api/campanhas/descadastros
+func (h *CampanhaHandler) CriarDescadastro(c *gin.Context) {
+	var req struct {
+		NumeroTelefone string `json:"numeroTelefone" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	descadastro, err := h.campanhas.Descadastrar(c.GetString("organizacao_id"), c.GetString("user_id"), req.NumeroTelefone)
+	if err != nil {
+		if errors.Is(err, services.ErrDescadastroInvalido) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		erroCampanha(c, err, "Erro ao registrar descadastro")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "descadastro", descadastro.ID, nil, descadastro)
+
+	c.JSON(http.StatusCreated, descadastro)
+}
+
+// ExcluirDescadastro - DELETE /api/campanhas/descadastros/:id
+// O número volta a receber as próximas campanhas
+func (h *CampanhaHandler) ExcluirDescadastro(c *gin.Context) {
+	descadastro, err := h.campanhas.RemoverDescadastro(c.GetString("organizacao_id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrDescadastroNaoEncontrado) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		erroCampanha(c, err, "Erro ao remover descadastro")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "descadastro", descadastro.ID, descadastro, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Descadastro removido"})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// ChaveAPIHandler gerencia as chaves de API da organização
+type ChaveAPIHandler struct {
+	chaveAPIService   *services.ChaveAPIService
+	permissionService *services.PermissionService
+	auditoria         *services.AuditoriaService
+}
+
+// NewChaveAPIHandler cria um novo handler de chaves de API
+func NewChaveAPIHandler(chaveAPIService *services.ChaveAPIService, permissionService *services.PermissionService, auditoria *services.AuditoriaService) *ChaveAPIHandler {
+	return &ChaveAPIHandler{
+		chaveAPIService:   chaveAPIService,
+		permissionService: permissionService,
+		auditoria:         auditoria,
+	}
+}
+
+// ListarChaves - GET /api/chaves-api
+func (h *ChaveAPIHandler) ListarChaves(c *gin.Context) {
+	chaves, err := h.chaveAPIService.Listar(c.GetString("organizacao_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar chaves de API",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    chaves,
+	})
+}
+
+// CriarChave - POST /api/chaves-api
+// O valor completo da chave é retornado apenas nesta resposta
+func (h *ChaveAPIHandler) CriarChave(c *gin.Context) {
+	var req services.NovaChaveAPIRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+
+	// A chave não pode ter escopos além das permissões de quem a cria
+	if err := podeConceder(h.permissionService, userID, req.Escopos); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	chave, valor, err := h.chaveAPIService.Criar(c.GetString("organizacao_id"), userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "chave_api", chave.ID, nil, chave)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"chave":    valor,
+			"chaveApi": chave,
+		},
+		"message": "Chave criada. Copie o valor agora: ele não será exibido novamente.",
+	})
+}
+
+// RevogarChave - DELETE /api/chaves-api/:id
+func (h *ChaveAPIHandler) RevogarChave(c *gin.Context) {
+	err := h.chaveAPIService.Revogar(c.GetString("organizacao_id"), c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Chave não encontrada ou já revogada",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao revogar chave de API",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaRevogar, "chave_api", c.Param("id"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Chave revogada com sucesso",
+	})
+}
@@ -1,18 +1,26 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
 )
 
 // CobrancaHandler gerencia cobranças
 type CobrancaHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	auditoria *services.AuditoriaService
+	webhooks  *services.WebhookService
 }
 
-func NewCobrancaHandler(db *gorm.DB) *CobrancaHandler {
-	return &CobrancaHandler{db: db}
+func NewCobrancaHandler(db *gorm.DB, auditoria *services.AuditoriaService, webhooks *services.WebhookService) *CobrancaHandler {
+	return &CobrancaHandler{db: db, auditoria: auditoria, webhooks: webhooks}
 }
 
 func (h *CobrancaHandler) GetCobrancas(c *gin.Context) {
@@ -34,3 +42,53 @@ func (h *CobrancaHandler) UpdateCobranca(c *gin.Context) {
 func (h *CobrancaHandler) DeleteCobranca(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Cobrança excluída"})
 }
+
+// RegistrarPagamento - POST /api/cobrancas/:id/pagamento
+// Marca a cobrança como paga e publica o evento cobranca.paga
+func (h *CobrancaHandler) RegistrarPagamento(c *gin.Context) {
+	var req struct {
+		PagoEm *time.Time `json:"pagoEm"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	// Cobranças não têm organização própria: pertencem à do usuário
+	organizacaoID := c.GetString("organizacao_id")
+	usuariosDaOrganizacao := h.db.Model(&models.Usuario{}).Select("id").Where("organizacao_id = ?", organizacaoID)
+
+	var cobranca models.Cobranca
+	if err := h.db.Where("id = ? AND usuario_id IN (?)", c.Param("id"), usuariosDaOrganizacao).First(&cobranca).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Cobrança não encontrada"})
+		return
+	}
+	if cobranca.Status == models.StatusCobrancaPago {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Cobrança já está paga"})
+		return
+	}
+	if cobranca.Status == models.StatusCobrancaCancelado {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Cobrança cancelada"})
+		return
+	}
+
+	antes := cobranca
+	pagoEm := time.Now()
+	if req.PagoEm != nil {
+		pagoEm = *req.PagoEm
+	}
+	if err := h.db.Model(&cobranca).Updates(map[string]interface{}{
+		"status":  models.StatusCobrancaPago,
+		"pago_em": pagoEm,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Erro ao registrar pagamento", "details": err.Error()})
+		return
+	}
+	cobranca.Status = models.StatusCobrancaPago
+	cobranca.PagoEm = &pagoEm
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "cobranca", cobranca.ID, antes, cobranca)
+	h.webhooks.Publicar(organizacaoID, models.EventoCobrancaPaga, cobranca)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": cobranca})
+}
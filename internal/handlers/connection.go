@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,11 +13,13 @@ import (
 
 type ConnectionHandler struct {
 	connectionService *services.ConnectionService
+	auditoria         *services.AuditoriaService
 }
 
-func NewConnectionHandler(connectionService *services.ConnectionService) *ConnectionHandler {
+func NewConnectionHandler(connectionService *services.ConnectionService, auditoria *services.AuditoriaService) *ConnectionHandler {
 	return &ConnectionHandler{
 		connectionService: connectionService,
+		auditoria:         auditoria,
 	}
 }
 
@@ -154,6 +157,12 @@ func (h *ConnectionHandler) CreateOrUpdateConnection(c *gin.Context) {
 		return
 	}
 
+	acao := models.AcaoAuditoriaAtualizar
+	if req.Status == models.ConnectionStatusConnected {
+		acao = models.AcaoAuditoriaConectar
+	}
+	h.auditoria.Registrar(atorAuditoria(c), acao, "conexao", connection.ID.String(), nil, connection)
+
 	c.JSON(http.StatusOK, connection)
 }
 
@@ -250,11 +259,17 @@ func (h *ConnectionHandler) DisconnectWhatsApp(c *gin.Context) {
 	}
 
 	err = h.connectionService.DisconnectWhatsApp(userID, sessionName)
+	if errors.Is(err, services.ErrSessaoNaoPermitida) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect WhatsApp"})
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaDesconectar, "conexao", sessionName, nil, gin.H{"sessionName": sessionName})
+
 	c.JSON(http.StatusOK, gin.H{"message": "WhatsApp disconnected successfully"})
 }
 
@@ -13,14 +13,36 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
 )
 
 type ContatosHandler struct {
-	db *gorm.DB
+	db                *gorm.DB
+	permissionService *services.PermissionService
+	auditoria         *services.AuditoriaService
+	webhooks          *services.WebhookService
 }
 
-func NewContatosHandler(db *gorm.DB) *ContatosHandler {
-	return &ContatosHandler{db: db}
+func NewContatosHandler(db *gorm.DB, permissionService *services.PermissionService, auditoria *services.AuditoriaService, webhooks *services.WebhookService) *ContatosHandler {
+	return &ContatosHandler{
+		db:                db,
+		permissionService: permissionService,
+		auditoria:         auditoria,
+		webhooks:          webhooks,
+	}
+}
+
+// escopoContatos retorna o filtro de visibilidade sobre a tabela "c" para o usuário
+// autenticado: contatos das próprias sessões ou, para atendentes, das suas filas
+func (h *ContatosHandler) escopoContatos(c *gin.Context) (string, []interface{}, bool) {
+	escopo, err := h.permissionService.EscopoAtendimento(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load access scope"})
+		return "", nil, false
+	}
+	condicao, args := escopo.CondicaoContatos("c")
+	return condicao, args, true
 }
 
 // Use models do pacote models em vez de duplicar
@@ -63,13 +85,18 @@ type UpdateContatoRequest struct {
 // ListContatos lista todos os contatos do usuário
 func (h *ContatosHandler) ListContatos(c *gin.Context) {
 	// Obter userID do contexto (middleware de auth)
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Buscar contatos associados às sessões WhatsApp do usuário
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
+	// Buscar contatos visíveis ao usuário (sessões próprias ou filas do atendente)
 	var contatos []models.Contato
 	query := `
 		SELECT c.id, c.numero_telefone, c.nome, c.foto_perfil, c.sobre, c.bloqueado,
@@ -77,11 +104,11 @@ func (h *ContatosHandler) ListContatos(c *gin.Context) {
 		       c.numero, c.bairro, c.cidade, c.estado, c.pais, c.criado_em, c.atualizado_em
 		FROM contatos c
 		INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-		WHERE sw.usuario_id = ?
+		WHERE ` + condicao + `
 		ORDER BY c.atualizado_em DESC
 	`
 
-	err := h.db.Raw(query, userID).Scan(&contatos).Error
+	err := h.db.Raw(query, args...).Scan(&contatos).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
 		return
@@ -102,7 +129,7 @@ func (h *ContatosHandler) ListContatos(c *gin.Context) {
 
 // GetContato busca um contato específico
 func (h *ContatosHandler) GetContato(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -111,16 +138,21 @@ func (h *ContatosHandler) GetContato(c *gin.Context) {
 	id := c.Param("id")
 	var contato models.Contato
 
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
 	query := `
 		SELECT c.id, c.numero_telefone, c.nome, c.foto_perfil, c.sobre, c.bloqueado,
 		       c.sessao_whatsapp_id, c.email, c.empresa, c.cpf, c.cnpj, c.cep, c.rua,
 		       c.numero, c.bairro, c.cidade, c.estado, c.pais, c.criado_em, c.atualizado_em
 		FROM contatos c
 		INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-		WHERE c.id = ? AND sw.usuario_id = ?
+		WHERE c.id = ? AND ` + condicao + `
 	`
 
-	err := h.db.Raw(query, id, userID).Scan(&contato).Error
+	err := h.db.Raw(query, append([]interface{}{id}, args...)...).Scan(&contato).Error
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
@@ -163,10 +195,11 @@ func (h *ContatosHandler) CreateContato(c *gin.Context) {
 	log.Printf("[CONTATOS] Parsed request: NumeroTelefone=%s, Nome=%v, SessaoWhatsappID=%s", 
 		req.NumeroTelefone, req.Nome, req.SessaoWhatsappID)
 
-	// Verificar se a sessão WhatsApp pertence ao usuário
+	// Verificar se a sessão WhatsApp é da organização e liberada ao usuário
 	var sessaoCount int64
 	err := h.db.Table("sessoes_whatsapp").
-		Where("id = ? AND usuario_id = ?", req.SessaoWhatsappID, userID).
+		Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id")), repositories.SessoesPermitidas(fmt.Sprint(userID))).
+		Where("id = ?", req.SessaoWhatsappID).
 		Count(&sessaoCount).Error
 
 	if err != nil || sessaoCount == 0 {
@@ -190,6 +223,7 @@ func (h *ContatosHandler) CreateContato(c *gin.Context) {
 		Estado:           req.Estado,
 		Pais:             req.Pais,
 		SessaoWhatsappID: req.SessaoWhatsappID,
+		OrganizacaoID:    c.GetString("organizacao_id"),
 		Bloqueado:        false,
 	}
 
@@ -198,12 +232,15 @@ func (h *ContatosHandler) CreateContato(c *gin.Context) {
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "contato", contato.ID, nil, contato)
+	h.webhooks.Publicar(contato.OrganizacaoID, models.EventoContatoCriado, contato)
+
 	c.JSON(http.StatusCreated, contato)
 }
 
 // GetContatosStats retorna estatísticas dos contatos
 func (h *ContatosHandler) GetContatosStats(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -218,10 +255,14 @@ func (h *ContatosHandler) GetContatosStats(c *gin.Context) {
 
 	var stats StatsResult
 
-	// Total de contatos do usuário
-	err := h.db.Table("contatos").
-		Joins("INNER JOIN sessoes_whatsapp sw ON contatos.sessao_whatsapp_id = sw.id").
-		Where("sw.usuario_id = ?", userID).
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
+	// Total de contatos visíveis ao usuário
+	err := h.db.Table("contatos c").
+		Where(condicao, args...).
 		Count(&stats.TotalContatos).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get total contacts"})
@@ -229,9 +270,9 @@ func (h *ContatosHandler) GetContatosStats(c *gin.Context) {
 	}
 
 	// Favoritos
-	err = h.db.Table("contatos").
-		Joins("INNER JOIN sessoes_whatsapp sw ON contatos.sessao_whatsapp_id = sw.id").
-		Where("sw.usuario_id = ? AND contatos.favorito = ?", userID, true).
+	err = h.db.Table("contatos c").
+		Where(condicao, args...).
+		Where("c.favorito = ?", true).
 		Count(&stats.Favoritos).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get favorites count"})
@@ -248,7 +289,7 @@ func (h *ContatosHandler) GetContatosStats(c *gin.Context) {
 
 // ExportContatos exporta contatos do usuário para CSV ou JSON
 func (h *ContatosHandler) ExportContatos(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -260,12 +301,16 @@ func (h *ContatosHandler) ExportContatos(c *gin.Context) {
 		return
 	}
 
-	// Buscar contatos do usuário
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
+	// Buscar contatos visíveis ao usuário
 	var contatos []models.Contato
 	err := h.db.Table("contatos c").
 		Select("c.*").
-		Joins("INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id").
-		Where("sw.usuario_id = ?", userID).
+		Where(condicao, args...).
 		Find(&contatos).Error
 
 	if err != nil {
@@ -287,19 +332,19 @@ func (h *ContatosHandler) ExportContatos(c *gin.Context) {
 		
 		for _, contato := range contatos {
 			csvData += fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%t\n",
-				contato.Nome,
+				derefString(contato.Nome),
 				contato.NumeroTelefone,
-				contato.Email,
-				contato.Empresa,
-				contato.CPF,
-				contato.CNPJ,
-				contato.CEP,
-				contato.Rua,
-				contato.Numero,
-				contato.Bairro,
-				contato.Cidade,
-				contato.Estado,
-				contato.Pais,
+				derefString(contato.Email),
+				derefString(contato.Empresa),
+				derefString(contato.CPF),
+				derefString(contato.CNPJ),
+				derefString(contato.CEP),
+				derefString(contato.Rua),
+				derefString(contato.Numero),
+				derefString(contato.Bairro),
+				derefString(contato.Cidade),
+				derefString(contato.Estado),
+				derefString(contato.Pais),
 				contato.Favorito,
 			)
 		}
@@ -323,13 +368,8 @@ func (h *ContatosHandler) ImportContatos(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Verificar se o usuário tem uma sessão WhatsApp ativa
-	var sessaoWhatsappID string
-	err = h.db.Table("sessoes_whatsapp").
-		Select("id").
-		Where("usuario_id = ? AND ativo = ?", userID, true).
-		First(&sessaoWhatsappID).Error
-
+	// Contatos importados ficam na sessão padrão do usuário
+	sessao, err := repositories.NewSessaoWhatsAppRepository(h.db).PadraoDoUsuario(c.GetString("organizacao_id"), fmt.Sprint(userID))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active WhatsApp session found"})
 		return
@@ -372,7 +412,8 @@ func (h *ContatosHandler) ImportContatos(c *gin.Context) {
 				Estado:           getStringPtrFromMap(item, "estado"),
 				Pais:             getStringPtrFromMap(item, "pais"),
 				Favorito:         getBoolFromMap(item, "favorito"),
-				SessaoWhatsappID: sessaoWhatsappID,
+				SessaoWhatsappID: sessao.ID,
+				OrganizacaoID:    c.GetString("organizacao_id"),
 			}
 			importedContacts = append(importedContacts, contato)
 		}
@@ -408,7 +449,8 @@ func (h *ContatosHandler) ImportContatos(c *gin.Context) {
 					Estado:           stringPtr(record[11]),
 					Pais:             stringPtr(record[12]),
 					Favorito:         favorito,
-					SessaoWhatsappID: sessaoWhatsappID,
+					SessaoWhatsappID: sessao.ID,
+					OrganizacaoID:    c.GetString("organizacao_id"),
 				}
 				importedContacts = append(importedContacts, contato)
 			}
@@ -433,9 +475,10 @@ func (h *ContatosHandler) ImportContatos(c *gin.Context) {
 		err = h.db.Create(&contato).Error
 		if err != nil {
 			errorCount++
-			errors = append(errors, fmt.Sprintf("Erro ao criar contato %s: %v", contato.Nome, err))
+			errors = append(errors, fmt.Sprintf("Erro ao criar contato %s: %v", derefString(contato.Nome), err))
 		} else {
 			successCount++
+			h.webhooks.Publicar(contato.OrganizacaoID, models.EventoContatoCriado, contato)
 		}
 	}
 
@@ -466,6 +509,13 @@ func getStringPtrFromMap(m map[string]interface{}, key string) *string {
 	return nil
 }
 
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 func stringPtr(s string) *string {
 	if s == "" {
 		return nil
@@ -484,7 +534,7 @@ func getBoolFromMap(m map[string]interface{}, key string) bool {
 
 // UpdateContato atualiza um contato existente
 func (h *ContatosHandler) UpdateContato(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -497,7 +547,12 @@ func (h *ContatosHandler) UpdateContato(c *gin.Context) {
 		return
 	}
 
-	// Verificar se o contato existe e pertence ao usuário
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
+	// Verificar se o contato existe e está no escopo do usuário
 	var contato models.Contato
 	query := `
 		SELECT c.id, c.numero_telefone, c.nome, c.foto_perfil, c.sobre, c.bloqueado,
@@ -505,10 +560,10 @@ func (h *ContatosHandler) UpdateContato(c *gin.Context) {
 		       c.numero, c.bairro, c.cidade, c.estado, c.pais, c.criado_em, c.atualizado_em
 		FROM contatos c
 		INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-		WHERE c.id = ? AND sw.usuario_id = ?
+		WHERE c.id = ? AND ` + condicao + `
 	`
 
-	err := h.db.Raw(query, id, userID).Scan(&contato).Error
+	err := h.db.Raw(query, append([]interface{}{id}, args...)...).Scan(&contato).Error
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
@@ -518,6 +573,8 @@ func (h *ContatosHandler) UpdateContato(c *gin.Context) {
 		return
 	}
 
+	antes := contato
+
 	// Atualizar campos não nulos
 	updateData := make(map[string]interface{})
 	if req.Nome != nil {
@@ -568,18 +625,22 @@ func (h *ContatosHandler) UpdateContato(c *gin.Context) {
 	}
 
 	// Buscar contato atualizado
-	err = h.db.Raw(query, id, userID).Scan(&contato).Error
+	err = h.db.Raw(query, append([]interface{}{id}, args...)...).Scan(&contato).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated contact"})
 		return
 	}
 
+	if len(updateData) > 0 {
+		h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "contato", id, antes, contato)
+	}
+
 	c.JSON(http.StatusOK, contato)
 }
 
 // DeleteContato deleta um contato
 func (h *ContatosHandler) DeleteContato(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -587,27 +648,36 @@ func (h *ContatosHandler) DeleteContato(c *gin.Context) {
 
 	id := c.Param("id")
 
-	// Verificar se o contato existe e pertence ao usuário
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
+	// Verificar se o contato existe e está no escopo do usuário
 	var count int64
 	query := `
 		SELECT COUNT(*)
 		FROM contatos c
-		INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-		WHERE c.id = ? AND sw.usuario_id = ?
+		WHERE c.id = ? AND ` + condicao + `
 	`
 
-	err := h.db.Raw(query, id, userID).Scan(&count).Error
+	err := h.db.Raw(query, append([]interface{}{id}, args...)...).Scan(&count).Error
 	if err != nil || count == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
 		return
 	}
 
+	var antes models.Contato
+	h.db.Where("id = ?", id).First(&antes)
+
 	// Deletar contato (cascade deletes will handle related records)
 	if err := h.db.Table("contatos").Where("id = ?", id).Delete(nil).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete contact"})
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "contato", id, antes, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Contact deleted successfully"})
 }
 
@@ -629,14 +699,19 @@ func (h *ContatosHandler) SyncContatos(c *gin.Context) {
 
 // GetContatoDadosCompletos busca dados completos do contato pelo chatId do WAHA
 func (h *ContatosHandler) GetContatoDadosCompletos(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
 	chatId := c.Param("chatId")
-	
+
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
 	// Buscar contato pelo contactid (que vem do WAHA)
 	var contato models.Contato
 	query := `
@@ -646,10 +721,10 @@ func (h *ContatosHandler) GetContatoDadosCompletos(c *gin.Context) {
 		       c.contactid, c.status_kanban
 		FROM contatos c
 		INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-		WHERE c.contactid = ? AND sw.usuario_id = ?
+		WHERE c.contactid = ? AND ` + condicao + `
 	`
 
-	err := h.db.Raw(query, chatId, userID).Scan(&contato).Error
+	err := h.db.Raw(query, append([]interface{}{chatId}, args...)...).Scan(&contato).Error
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
@@ -727,7 +802,7 @@ func (h *ContatosHandler) GetContatoDadosCompletos(c *gin.Context) {
 
 // AssociarTagsContato - POST /api/contatos/:id/tags
 func (h *ContatosHandler) AssociarTagsContato(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -744,6 +819,11 @@ func (h *ContatosHandler) AssociarTagsContato(c *gin.Context) {
 		return
 	}
 
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
 	// Buscar contato pelo ID interno ou chatId (contactid)
 	var contato models.Contato
 	var query string
@@ -753,7 +833,7 @@ func (h *ContatosHandler) AssociarTagsContato(c *gin.Context) {
 			SELECT c.id, c.numero_telefone, c.nome, c.contactid
 			FROM contatos c
 			INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-			WHERE c.contactid = ? AND sw.usuario_id = ?
+			WHERE c.contactid = ? AND ` + condicao + `
 		`
 	} else {
 		// É um ID interno
@@ -761,11 +841,11 @@ func (h *ContatosHandler) AssociarTagsContato(c *gin.Context) {
 			SELECT c.id, c.numero_telefone, c.nome, c.contactid
 			FROM contatos c
 			INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-			WHERE c.id = ? AND sw.usuario_id = ?
+			WHERE c.id = ? AND ` + condicao + `
 		`
 	}
 	
-	err := h.db.Raw(query, contatoParam, userID).Scan(&contato).Error
+	err := h.db.Raw(query, append([]interface{}{contatoParam}, args...)...).Scan(&contato).Error
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Contato não encontrado"})
 		return
@@ -778,7 +858,7 @@ func (h *ContatosHandler) AssociarTagsContato(c *gin.Context) {
 	for _, tagId := range req.TagIds {
 		// Verificar se a tag existe
 		var tag models.Tag
-		if err := h.db.First(&tag, "id = ?", tagId).Error; err != nil {
+		if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).First(&tag, "id = ?", tagId).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Tag não encontrada: " + tagId})
 			return
 		}
@@ -829,7 +909,7 @@ func (h *ContatosHandler) AssociarTagsContato(c *gin.Context) {
 
 // ListarTagsContato - GET /api/contatos/:id/tags
 func (h *ContatosHandler) ListarTagsContato(c *gin.Context) {
-	userID, exists := c.Get("userID")
+	_, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
@@ -837,6 +917,11 @@ func (h *ContatosHandler) ListarTagsContato(c *gin.Context) {
 
 	contatoParam := c.Param("id")
 
+	condicao, args, ok := h.escopoContatos(c)
+	if !ok {
+		return
+	}
+
 	// Buscar contato pelo ID interno ou chatId (contactid)
 	var contato models.Contato
 	var query string
@@ -846,7 +931,7 @@ func (h *ContatosHandler) ListarTagsContato(c *gin.Context) {
 			SELECT c.id, c.numero_telefone, c.nome, c.contactid
 			FROM contatos c
 			INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-			WHERE c.contactid = ? AND sw.usuario_id = ?
+			WHERE c.contactid = ? AND ` + condicao + `
 		`
 	} else {
 		// É um ID interno
@@ -854,11 +939,11 @@ func (h *ContatosHandler) ListarTagsContato(c *gin.Context) {
 			SELECT c.id, c.numero_telefone, c.nome, c.contactid
 			FROM contatos c
 			INNER JOIN sessoes_whatsapp sw ON c.sessao_whatsapp_id = sw.id
-			WHERE c.id = ? AND sw.usuario_id = ?
+			WHERE c.id = ? AND ` + condicao + `
 		`
 	}
 	
-	err := h.db.Raw(query, contatoParam, userID).Scan(&contato).Error
+	err := h.db.Raw(query, append([]interface{}{contatoParam}, args...)...).Scan(&contato).Error
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Contato não encontrado"})
 		return
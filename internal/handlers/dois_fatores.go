@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"tappyone/internal/services"
+)
+
+// VerificarDoisFatores - POST /api/auth/2fa/verificar (público)
+// Conclui o login com o desafio recebido e o código do autenticador ou de recuperação
+func (h *AuthHandler) VerificarDoisFatores(c *gin.Context) {
+	var req struct {
+		Desafio string `json:"desafio" binding:"required"`
+		Codigo  string `json:"codigo" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Desafio e código são obrigatórios"})
+		return
+	}
+
+	if !h.permitirDoisFatores(c, "2fa:ip:"+c.ClientIP()) {
+		return
+	}
+
+	response, err := h.authService.VerificarDesafioDoisFatores(req.Desafio, req.Codigo, clientInfo(c))
+	if err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// IniciarCadastroDoisFatoresLogin - POST /api/auth/2fa/cadastro (público)
+// Gera o QR code para o administrador que precisa configurar dois fatores para entrar
+func (h *AuthHandler) IniciarCadastroDoisFatoresLogin(c *gin.Context) {
+	var req struct {
+		Desafio string `json:"desafio" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Desafio é obrigatório"})
+		return
+	}
+
+	if !h.permitirDoisFatores(c, "2fa:ip:"+c.ClientIP()) {
+		return
+	}
+
+	configuracao, err := h.authService.IniciarCadastroPorDesafio(req.Desafio)
+	if err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, configuracao)
+}
+
+// ConcluirCadastroDoisFatoresLogin - POST /api/auth/2fa/cadastro/confirmar (público)
+// Ativa dois fatores com o primeiro código e conclui o login
+func (h *AuthHandler) ConcluirCadastroDoisFatoresLogin(c *gin.Context) {
+	var req struct {
+		Desafio string `json:"desafio" binding:"required"`
+		Codigo  string `json:"codigo" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Desafio e código são obrigatórios"})
+		return
+	}
+
+	if !h.permitirDoisFatores(c, "2fa:ip:"+c.ClientIP()) {
+		return
+	}
+
+	response, err := h.authService.ConcluirCadastroPorDesafio(req.Desafio, req.Codigo, clientInfo(c))
+	if err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// StatusDoisFatores - GET /api/auth/2fa
+func (h *AuthHandler) StatusDoisFatores(c *gin.Context) {
+	status, err := h.authService.StatusDoisFatoresUsuario(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// ConfigurarDoisFatores - POST /api/auth/2fa/configurar
+// Gera um novo segredo pendente e a URI otpauth:// para o QR code
+func (h *AuthHandler) ConfigurarDoisFatores(c *gin.Context) {
+	configuracao, err := h.authService.IniciarCadastroDoisFatores(c.GetString("user_id"))
+	if err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, configuracao)
+}
+
+// AtivarDoisFatores - POST /api/auth/2fa/ativar
+// Confirma o segredo com um código e devolve os códigos de recuperação
+func (h *AuthHandler) AtivarDoisFatores(c *gin.Context) {
+	var req struct {
+		Codigo string `json:"codigo" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código é obrigatório"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if !h.permitirDoisFatores(c, "2fa:usuario:"+userID) {
+		return
+	}
+
+	codigos, err := h.authService.AtivarDoisFatores(userID, req.Codigo)
+	if err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Autenticação em dois fatores ativada",
+		"codigosRecuperacao": codigos,
+	})
+}
+
+// DesativarDoisFatores - POST /api/auth/2fa/desativar
+func (h *AuthHandler) DesativarDoisFatores(c *gin.Context) {
+	var req struct {
+		Senha  string `json:"senha" binding:"required"`
+		Codigo string `json:"codigo" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Senha e código são obrigatórios"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if !h.permitirDoisFatores(c, "2fa:usuario:"+userID) {
+		return
+	}
+
+	if err := h.authService.DesativarDoisFatores(userID, req.Senha, req.Codigo); err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Autenticação em dois fatores desativada"})
+}
+
+// GerarCodigosRecuperacao - POST /api/auth/2fa/codigos-recuperacao
+func (h *AuthHandler) GerarCodigosRecuperacao(c *gin.Context) {
+	var req struct {
+		Codigo string `json:"codigo" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código é obrigatório"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if !h.permitirDoisFatores(c, "2fa:usuario:"+userID) {
+		return
+	}
+
+	codigos, err := h.authService.GerarNovosCodigosRecuperacao(userID, req.Codigo)
+	if err != nil {
+		respostaErroDoisFatores(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"codigosRecuperacao": codigos})
+}
+
+// permitirDoisFatores limita tentativas de código por IP ou por usuário
+func (h *AuthHandler) permitirDoisFatores(c *gin.Context, chave string) bool {
+	if ok, espera := h.rateLimiter.Permitir(chave, 20, 15*time.Minute); !ok {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(espera.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas tentativas. Tente novamente mais tarde."})
+		return false
+	}
+	return true
+}
+
+// respostaErroDoisFatores converte os erros do serviço em status HTTP
+func respostaErroDoisFatores(c *gin.Context, err error) {
+	var tentativas *services.ErroTentativasLogin
+	switch {
+	case errors.As(err, &tentativas):
+		status := http.StatusTooManyRequests
+		if tentativas.Bloqueado {
+			status = http.StatusLocked
+		}
+		c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(tentativas.Espera.Seconds()))))
+		c.JSON(status, gin.H{"error": err.Error(), "bloqueado": tentativas.Bloqueado})
+	case errors.Is(err, services.ErrDesafioDoisFatoresInvalido),
+		errors.Is(err, services.ErrCodigoDoisFatoresInvalido),
+		errors.Is(err, services.ErrSenhaIncorreta):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDoisFatoresJaAtivo):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDoisFatoresObrigatorio):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDoisFatoresNaoAtivo),
+		errors.Is(err, services.ErrDoisFatoresNaoIniciado):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("[AUTH] Erro na autenticação em dois fatores: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar autenticação em dois fatores"})
+	}
+}
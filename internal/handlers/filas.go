@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 	"gorm.io/gorm"
 )
 
@@ -21,10 +22,11 @@ func NewFilasHandler(db *gorm.DB) *FilasHandler {
 
 // ListarFilas - GET /api/filas
 func (h *FilasHandler) ListarFilas(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	var filas []models.Fila
 
 	// Buscar filas com atendentes
-	result := h.db.Preload("Atendentes.Usuario").Order("ordenacao ASC").Find(&filas)
+	result := h.db.Scopes(organizacao).Preload("Atendentes.Usuario").Order("ordenacao ASC").Find(&filas)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Erro ao buscar filas",
@@ -52,10 +54,11 @@ func (h *FilasHandler) ListarFilas(c *gin.Context) {
 
 // ObterFila - GET /api/filas/:id
 func (h *FilasHandler) ObterFila(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	id := c.Param("id")
 	
 	var fila models.Fila
-	result := h.db.Preload("Atendentes.Usuario").First(&fila, "id = ?", id)
+	result := h.db.Scopes(organizacao).Preload("Atendentes.Usuario").First(&fila, "id = ?", id)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -85,6 +88,7 @@ func (h *FilasHandler) ObterFila(c *gin.Context) {
 
 // CriarFila - POST /api/filas
 func (h *FilasHandler) CriarFila(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	var req models.FilaRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -94,12 +98,16 @@ func (h *FilasHandler) CriarFila(c *gin.Context) {
 		return
 	}
 
+	if !h.atendentesDaOrganizacao(c, req.AtendentesIDs) {
+		return
+	}
+
 	// Verificar se a ordenação já existe
 	var existingFila models.Fila
-	result := h.db.Where("ordenacao = ?", req.Ordenacao).First(&existingFila)
+	result := h.db.Scopes(organizacao).Where("ordenacao = ?", req.Ordenacao).First(&existingFila)
 	if result.Error == nil {
 		// Ajustar ordenação das outras filas
-		h.db.Model(&models.Fila{}).Where("ordenacao >= ?", req.Ordenacao).Update("ordenacao", gorm.Expr("ordenacao + 1"))
+		h.db.Model(&models.Fila{}).Scopes(organizacao).Where("ordenacao >= ?", req.Ordenacao).Update("ordenacao", gorm.Expr("ordenacao + 1"))
 	}
 
 	// Criar nova fila
@@ -113,6 +121,7 @@ func (h *FilasHandler) CriarFila(c *gin.Context) {
 		ChatBot:       req.ChatBot,
 		Kanban:        req.Kanban,
 		WhatsappChats: req.WhatsappChats,
+		OrganizacaoID: c.GetString("organizacao_id"),
 	}
 
 	tx := h.db.Begin()
@@ -155,6 +164,7 @@ func (h *FilasHandler) CriarFila(c *gin.Context) {
 
 // AtualizarFila - PUT /api/filas/:id
 func (h *FilasHandler) AtualizarFila(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	id := c.Param("id")
 	
 	var req models.FilaRequest
@@ -166,8 +176,12 @@ func (h *FilasHandler) AtualizarFila(c *gin.Context) {
 		return
 	}
 
+	if !h.atendentesDaOrganizacao(c, req.AtendentesIDs) {
+		return
+	}
+
 	var fila models.Fila
-	result := h.db.First(&fila, "id = ?", id)
+	result := h.db.Scopes(organizacao).First(&fila, "id = ?", id)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -186,9 +200,9 @@ func (h *FilasHandler) AtualizarFila(c *gin.Context) {
 	if req.Ordenacao != fila.Ordenacao {
 		// Ajustar ordenação das outras filas
 		if req.Ordenacao < fila.Ordenacao {
-			h.db.Model(&models.Fila{}).Where("ordenacao >= ? AND ordenacao < ? AND id != ?", req.Ordenacao, fila.Ordenacao, id).Update("ordenacao", gorm.Expr("ordenacao + 1"))
+			h.db.Model(&models.Fila{}).Scopes(organizacao).Where("ordenacao >= ? AND ordenacao < ? AND id != ?", req.Ordenacao, fila.Ordenacao, id).Update("ordenacao", gorm.Expr("ordenacao + 1"))
 		} else {
-			h.db.Model(&models.Fila{}).Where("ordenacao > ? AND ordenacao <= ? AND id != ?", fila.Ordenacao, req.Ordenacao, id).Update("ordenacao", gorm.Expr("ordenacao - 1"))
+			h.db.Model(&models.Fila{}).Scopes(organizacao).Where("ordenacao > ? AND ordenacao <= ? AND id != ?", fila.Ordenacao, req.Ordenacao, id).Update("ordenacao", gorm.Expr("ordenacao - 1"))
 		}
 	}
 
@@ -254,10 +268,11 @@ func (h *FilasHandler) AtualizarFila(c *gin.Context) {
 
 // DeletarFila - DELETE /api/filas/:id
 func (h *FilasHandler) DeletarFila(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	id := c.Param("id")
 	
 	var fila models.Fila
-	result := h.db.First(&fila, "id = ?", id)
+	result := h.db.Scopes(organizacao).First(&fila, "id = ?", id)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -295,7 +310,7 @@ func (h *FilasHandler) DeletarFila(c *gin.Context) {
 	}
 
 	// Ajustar ordenação das filas restantes
-	tx.Model(&models.Fila{}).Where("ordenacao > ?", fila.Ordenacao).Update("ordenacao", gorm.Expr("ordenacao - 1"))
+	tx.Model(&models.Fila{}).Scopes(organizacao).Where("ordenacao > ?", fila.Ordenacao).Update("ordenacao", gorm.Expr("ordenacao - 1"))
 
 	tx.Commit()
 
@@ -307,10 +322,11 @@ func (h *FilasHandler) DeletarFila(c *gin.Context) {
 
 // ToggleFilaStatus - PATCH /api/filas/:id/toggle
 func (h *FilasHandler) ToggleFilaStatus(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	id := c.Param("id")
 	
 	var fila models.Fila
-	result := h.db.First(&fila, "id = ?", id)
+	result := h.db.Scopes(organizacao).First(&fila, "id = ?", id)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -344,6 +360,7 @@ func (h *FilasHandler) ToggleFilaStatus(c *gin.Context) {
 
 // ReordenarFilas - POST /api/filas/reordenar
 func (h *FilasHandler) ReordenarFilas(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	var req struct {
 		FilasOrdem []struct {
 			ID        string `json:"id"`
@@ -362,7 +379,7 @@ func (h *FilasHandler) ReordenarFilas(c *gin.Context) {
 	tx := h.db.Begin()
 
 	for _, item := range req.FilasOrdem {
-		if err := tx.Model(&models.Fila{}).Where("id = ?", item.ID).Update("ordenacao", item.Ordenacao).Error; err != nil {
+		if err := tx.Model(&models.Fila{}).Scopes(organizacao).Where("id = ?", item.ID).Update("ordenacao", item.Ordenacao).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Erro ao reordenar filas",
@@ -380,6 +397,26 @@ func (h *FilasHandler) ReordenarFilas(c *gin.Context) {
 	})
 }
 
+// atendentesDaOrganizacao garante que todos os atendentes pertencem à organização do usuário
+func (h *FilasHandler) atendentesDaOrganizacao(c *gin.Context, atendentesIDs []string) bool {
+	if len(atendentesIDs) == 0 {
+		return true
+	}
+
+	var total int64
+	h.db.Model(&models.Usuario{}).
+		Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Where("id IN ?", atendentesIDs).
+		Count(&total)
+	if total != int64(len(atendentesIDs)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Atendente não pertence à organização",
+		})
+		return false
+	}
+	return true
+}
+
 // calcularEstatisticasFila calcula as estatísticas de uma fila
 func (h *FilasHandler) calcularEstatisticasFila(filaID string) models.FilaEstatisticas {
 	stats := models.FilaEstatisticas{}
@@ -396,10 +433,11 @@ func (h *FilasHandler) calcularEstatisticasFila(filaID string) models.FilaEstati
 
 // DuplicarFila - POST /api/filas/:id/duplicar
 func (h *FilasHandler) DuplicarFila(c *gin.Context) {
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	id := c.Param("id")
 	
 	var filaOriginal models.Fila
-	result := h.db.Preload("Atendentes").First(&filaOriginal, "id = ?", id)
+	result := h.db.Scopes(organizacao).Preload("Atendentes").First(&filaOriginal, "id = ?", id)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -416,7 +454,7 @@ func (h *FilasHandler) DuplicarFila(c *gin.Context) {
 
 	// Buscar maior ordenação atual
 	var maxOrdenacao int
-	h.db.Model(&models.Fila{}).Select("COALESCE(MAX(ordenacao), 0)").Scan(&maxOrdenacao)
+	h.db.Model(&models.Fila{}).Scopes(organizacao).Select("COALESCE(MAX(ordenacao), 0)").Scan(&maxOrdenacao)
 
 	// Criar nova fila
 	novaFila := models.Fila{
@@ -429,6 +467,7 @@ func (h *FilasHandler) DuplicarFila(c *gin.Context) {
 		ChatBot:       filaOriginal.ChatBot,
 		Kanban:        filaOriginal.Kanban,
 		WhatsappChats: filaOriginal.WhatsappChats,
+		OrganizacaoID: filaOriginal.OrganizacaoID,
 	}
 
 	tx := h.db.Begin()
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 	"tappyone/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -51,6 +52,7 @@ func (h *FluxosHandler) ListFluxos(c *gin.Context) {
 
 	// Buscar fluxos onde o usuário é dono do quadro
 	if err := query.Joins("JOIN quadros ON fluxos.quadro_id = quadros.id").
+		Scopes(repositories.PorOrganizacaoAlias("fluxos", c.GetString("organizacao_id"))).
 		Where("quadros.usuario_id = ?", userID).
 		Find(&fluxos).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar fluxos"})
@@ -124,9 +126,10 @@ func (h *FluxosHandler) CreateFluxo(c *gin.Context) {
 
 	// Criar fluxo
 	fluxo := models.Fluxo{
-		Nome:     req.Nome,
-		QuadroID: req.QuadroID,
-		Ativo:    true,
+		Nome:          req.Nome,
+		QuadroID:      req.QuadroID,
+		OrganizacaoID: quadro.OrganizacaoID,
+		Ativo:         true,
 	}
 
 	if req.Descricao != "" {
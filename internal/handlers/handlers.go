@@ -1,19 +1,22 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"math"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 	"tappyone/internal/services"
+	"tappyone/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -22,10 +25,14 @@ import (
 // AuthHandler gerencia autenticação
 type AuthHandler struct {
 	authService *services.AuthService
+	rateLimiter *services.RateLimiter
 }
 
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *services.AuthService, rateLimiter *services.RateLimiter) *AuthHandler {
+	return &AuthHandler{
+		authService: authService,
+		rateLimiter: rateLimiter,
+	}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -35,8 +42,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(req)
+	response, err := h.authService.Login(req, clientInfo(c))
 	if err != nil {
+		var tentativas *services.ErroTentativasLogin
+		if errors.As(err, &tentativas) {
+			status := http.StatusTooManyRequests
+			if tentativas.Bloqueado {
+				status = http.StatusLocked
+			}
+			c.Header("Retry-After", fmt.Sprintf("%d", int(math.Ceil(tentativas.Espera.Seconds()))))
+			c.JSON(status, gin.H{"error": err.Error(), "bloqueado": tentativas.Bloqueado})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
@@ -44,25 +61,161 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// ResetPassword atualiza a senha do usuário
-func (h *AuthHandler) ResetPassword(c *gin.Context) {
+// Refresh troca o refresh token por um novo par de tokens
+func (h *AuthHandler) Refresh(c *gin.Context) {
 	var req struct {
-		Email string `json:"email" binding:"required,email"`
-		Senha string `json:"senha" binding:"required"`
+		RefreshToken string `json:"refreshToken" binding:"required"`
 	}
-
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.authService.ResetPassword(req.Email, req.Senha)
+	response, err := h.authService.Refresh(req.RefreshToken, clientInfo(c))
 	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout encerra a sessão do refresh token informado (ou do access token atual)
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	c.ShouldBindJSON(&req)
+
+	if req.RefreshToken != "" {
+		if err := h.authService.Logout(req.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Sem refresh token, usa a sessão do access token enviado no header
+	if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+		if claims, err := h.authService.ValidateToken(token); err == nil {
+			if err := h.authService.LogoutSessao(claims.UserID, claims.SessionID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout realizado com sucesso"})
+}
+
+// LogoutAll encerra todas as sessões do usuário autenticado
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if err := h.authService.LogoutTodasSessoes(userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Senha atualizada com sucesso"})
+	c.JSON(http.StatusOK, gin.H{"message": "Todas as sessões foram encerradas"})
+}
+
+// HistoricoLogin - GET /api/auth/historico-login
+// Lista os logins bem-sucedidos do usuário com IP e dispositivo
+func (h *AuthHandler) HistoricoLogin(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	registros, total, err := h.authService.HistoricoLogins(c.GetString("user_id"), services.HistoricoLoginFiltro{
+		Page:  page,
+		Limit: limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar histórico de login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  registros,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// clientInfo extrai IP e user agent da requisição
+func clientInfo(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// Mensagem única para não revelar se o email está cadastrado
+const mensagemRedefinicaoSolicitada = "Se o email estiver cadastrado, você receberá um link para redefinir a senha"
+
+// ForgotPassword inicia a redefinição de senha enviando um link por email
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email inválido"})
+		return
+	}
+
+	if ok, espera := h.rateLimiter.Permitir("forgot-password:ip:"+c.ClientIP(), 10, time.Hour); !ok {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(espera.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas tentativas. Tente novamente mais tarde."})
+		return
+	}
+
+	// Limite por email é silencioso para manter a resposta uniforme
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if ok, _ := h.rateLimiter.Permitir("forgot-password:email:"+email, 3, time.Hour); ok {
+		info := clientInfo(c)
+		// Envio em background para que o tempo de resposta não revele se o email existe
+		go func() {
+			if err := h.authService.SolicitarRedefinicaoSenha(email, info); err != nil {
+				log.Printf("[AUTH] Erro ao solicitar redefinição de senha: %v", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": mensagemRedefinicaoSolicitada})
+}
+
+// ResetPassword conclui a redefinição de senha com o token recebido por email
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+		Senha string `json:"senha" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token e nova senha são obrigatórios"})
+		return
+	}
+
+	if ok, espera := h.rateLimiter.Permitir("reset-password:ip:"+c.ClientIP(), 10, 15*time.Minute); !ok {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(espera.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas tentativas. Tente novamente mais tarde."})
+		return
+	}
+
+	if err := services.ValidarPoliticaSenha(req.Senha); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.ConfirmarRedefinicaoSenha(req.Token, req.Senha); err != nil {
+		if errors.Is(err, services.ErrTokenRedefinicaoInvalido) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[AUTH] Erro ao redefinir senha: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao redefinir senha"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Senha redefinida com sucesso. Faça login novamente."})
 }
 
 func (h *AuthHandler) Me(c *gin.Context) {
@@ -80,11 +233,49 @@ func (h *AuthHandler) Me(c *gin.Context) {
 
 // UserHandler gerencia usuários
 type UserHandler struct {
-	userService *services.UserService
+	userService       *services.UserService
+	permissionService *services.PermissionService
+	auditoria         *services.AuditoriaService
 }
 
-func NewUserHandler(userService *services.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *services.UserService, permissionService *services.PermissionService, auditoria *services.AuditoriaService) *UserHandler {
+	return &UserHandler{
+		userService:       userService,
+		permissionService: permissionService,
+		auditoria:         auditoria,
+	}
+}
+
+// permissoesAlvo retorna as permissões que o tipo/papel concederia ao usuário
+func (h *UserHandler) permissoesAlvo(organizacaoID string, tipo models.TipoUsuario, papelID *string) (models.ListaPermissoes, error) {
+	if papelID != nil && *papelID != "" {
+		papel, err := h.userService.GetPapelByID(organizacaoID, *papelID)
+		if err != nil {
+			return nil, errors.New("Papel não encontrado")
+		}
+		return papel.Permissoes, nil
+	}
+	return services.PermissoesPadrao[tipo], nil
+}
+
+// verificarConcessao impede que o usuário crie ou altere contas com mais privilégios que os seus
+func (h *UserHandler) verificarConcessao(c *gin.Context, tipo models.TipoUsuario, papelID *string) bool {
+	if !services.TipoUsuarioValido(tipo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tipo de usuário inválido"})
+		return false
+	}
+
+	permissoes, err := h.permissoesAlvo(c.GetString("organizacao_id"), tipo, papelID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if err := podeConceder(h.permissionService, c.GetString("user_id"), permissoes); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
 }
 
 func (h *UserHandler) GetMe(c *gin.Context) {
@@ -115,7 +306,7 @@ func (h *UserHandler) List(c *gin.Context) {
 	status := c.Query("status")
 	search := c.Query("search")
 
-	users, err := h.userService.ListUsers(userID, tipo, status, search)
+	users, err := h.userService.ListUsers(c.GetString("organizacao_id"), userID, tipo, status, search)
 	if err != nil {
 		log.Printf("Erro ao listar usuários: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar usuários"})
@@ -136,6 +327,7 @@ func (h *UserHandler) Create(c *gin.Context) {
 		Email    string             `json:"email" binding:"required,email"`
 		Telefone *string            `json:"telefone"`
 		Tipo     models.TipoUsuario `json:"tipo" binding:"required"`
+		PapelID  *string            `json:"papelId"`
 		Senha    string             `json:"senha" binding:"required,min=6"`
 	}
 
@@ -144,6 +336,10 @@ func (h *UserHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if !h.verificarConcessao(c, req.Tipo, req.PapelID) {
+		return
+	}
+
 	// Verificar se email já existe
 	existingUser, _ := h.userService.GetByEmail(req.Email)
 	if existingUser != nil {
@@ -160,12 +356,14 @@ func (h *UserHandler) Create(c *gin.Context) {
 	}
 
 	usuario := &models.Usuario{
-		Nome:     req.Nome,
-		Email:    req.Email,
-		Telefone: req.Telefone,
-		Tipo:     req.Tipo,
-		Senha:    string(hashedPassword),
-		Ativo:    true,
+		Nome:          req.Nome,
+		Email:         req.Email,
+		Telefone:      req.Telefone,
+		Tipo:          req.Tipo,
+		PapelID:       req.PapelID,
+		OrganizacaoID: c.GetString("organizacao_id"),
+		Senha:         string(hashedPassword),
+		Ativo:         true,
 	}
 
 	if err := h.userService.CreateUserWithDefaults(usuario); err != nil {
@@ -173,6 +371,7 @@ func (h *UserHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar usuário"})
 		return
 	}
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "usuario", usuario.ID, nil, usuario)
 
 	// Limpar senha antes de retornar
 	usuario.Senha = ""
@@ -186,7 +385,7 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	usuario, err := h.userService.GetByID(userID)
+	usuario, err := h.userService.GetByIDNaOrganizacao(c.GetString("organizacao_id"), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
 		return
@@ -216,6 +415,7 @@ func (h *UserHandler) Update(c *gin.Context) {
 		Email    *string             `json:"email"`
 		Telefone *string             `json:"telefone"`
 		Tipo     *models.TipoUsuario `json:"tipo"`
+		PapelID  *string             `json:"papelId"`
 		Ativo    *bool               `json:"ativo"`
 	}
 
@@ -225,12 +425,32 @@ func (h *UserHandler) Update(c *gin.Context) {
 	}
 
 	// Buscar usuário existente
-	usuario, err := h.userService.GetByID(userID)
+	usuario, err := h.userService.GetByIDNaOrganizacao(c.GetString("organizacao_id"), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
 		return
 	}
 
+	// Só é possível editar contas cujos privilégios (atuais e novos) o editor possui
+	if !h.verificarConcessao(c, usuario.Tipo, usuario.PapelID) {
+		return
+	}
+	if req.Tipo != nil || req.PapelID != nil {
+		novoTipo := usuario.Tipo
+		if req.Tipo != nil {
+			novoTipo = *req.Tipo
+		}
+		novoPapel := usuario.PapelID
+		if req.PapelID != nil {
+			novoPapel = req.PapelID
+		}
+		if !h.verificarConcessao(c, novoTipo, novoPapel) {
+			return
+		}
+	}
+
+	antes := *usuario
+
 	// Atualizar campos se fornecidos
 	if req.Nome != nil {
 		usuario.Nome = *req.Nome
@@ -250,6 +470,15 @@ func (h *UserHandler) Update(c *gin.Context) {
 	if req.Tipo != nil {
 		usuario.Tipo = *req.Tipo
 	}
+	if req.PapelID != nil {
+		// String vazia remove o papel e volta às permissões padrão do tipo
+		if *req.PapelID == "" {
+			usuario.PapelID = nil
+		} else {
+			usuario.PapelID = req.PapelID
+		}
+		usuario.Papel = nil
+	}
 	if req.Ativo != nil {
 		usuario.Ativo = *req.Ativo
 	}
@@ -259,6 +488,8 @@ func (h *UserHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar usuário"})
 		return
 	}
+	h.permissionService.InvalidarUsuario(usuario.ID)
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "usuario", usuario.ID, antes, usuario)
 
 	// Limpar senha antes de retornar
 	usuario.Senha = ""
@@ -272,19 +503,29 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	if userID == c.GetString("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Não é possível remover o próprio usuário"})
+		return
+	}
+
 	// Verificar se usuário existe
-	_, err := h.userService.GetByID(userID)
+	usuario, err := h.userService.GetByIDNaOrganizacao(c.GetString("organizacao_id"), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
 		return
 	}
 
+	if !h.verificarConcessao(c, usuario.Tipo, usuario.PapelID) {
+		return
+	}
+
 	// Soft delete - apenas desativar usuário
 	if err := h.userService.DeleteUser(userID); err != nil {
 		log.Printf("Erro ao desativar usuário: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao desativar usuário"})
 		return
 	}
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "usuario", usuario.ID, usuario, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Usuário desativado com sucesso"})
 }
@@ -292,10 +533,14 @@ func (h *UserHandler) Delete(c *gin.Context) {
 // WhatsAppHandler gerencia WhatsApp
 type WhatsAppHandler struct {
 	whatsappService *services.WhatsAppService
+	auditoria       *services.AuditoriaService
+	midias          *services.MidiaService
+	processamento   *services.ProcessamentoMidiaService
+	transcricao     *services.TranscricaoService
 }
 
-func NewWhatsAppHandler(whatsappService *services.WhatsAppService) *WhatsAppHandler {
-	return &WhatsAppHandler{whatsappService: whatsappService}
+func NewWhatsAppHandler(whatsappService *services.WhatsAppService, auditoria *services.AuditoriaService, midias *services.MidiaService, processamento *services.ProcessamentoMidiaService, transcricao *services.TranscricaoService) *WhatsAppHandler {
+	return &WhatsAppHandler{whatsappService: whatsappService, auditoria: auditoria, midias: midias, processamento: processamento, transcricao: transcricao}
 }
 
 func (h *WhatsAppHandler) CreateSession(c *gin.Context) {
@@ -315,14 +560,21 @@ func (h *WhatsAppHandler) CreateSession(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[WHATSAPP] Creating session %s for user %s", req.NomeSessao, userID)
+	nomeSessao, err := repositories.NomeSessaoOrganizacao(c.GetString("organizacao_id"), req.NomeSessao)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[WHATSAPP] Creating session %s for user %s", nomeSessao, userID)
 
 	// Criar sessão no banco
 	session := &models.SessaoWhatsApp{
-		NomeSessao: req.NomeSessao,
-		Status:     models.StatusSessaoDesconectado,
-		Ativo:      true,
-		UsuarioID:  userID.(string),
+		NomeSessao:    nomeSessao,
+		Status:        models.StatusSessaoDesconectado,
+		Ativo:         true,
+		UsuarioID:     userID.(string),
+		OrganizacaoID: c.GetString("organizacao_id"),
 	}
 
 	if err := h.whatsappService.CreateSession(session); err != nil {
@@ -332,6 +584,7 @@ func (h *WhatsAppHandler) CreateSession(c *gin.Context) {
 	}
 
 	log.Printf("[WHATSAPP] Session created successfully with ID: %s", session.ID)
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "sessao_whatsapp", session.ID, nil, session)
 	c.JSON(http.StatusCreated, session)
 }
 
@@ -342,9 +595,8 @@ func (h *WhatsAppHandler) ListSessions(c *gin.Context) {
 		return
 	}
 
-	var sessoes []models.SessaoWhatsApp
-
-	err := h.whatsappService.GetDB().Where("usuario_id = ? AND ativo = ?", userID, true).Find(&sessoes).Error
+	// Sessões da organização liberadas ao usuário, para escolher a sessão de envio
+	sessoes, err := h.whatsappService.SessoesPermitidas(c.GetString("organizacao_id"), userID.(string))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessões"})
 		return
@@ -443,155 +695,47 @@ func (h *WhatsAppHandler) GetQRCode(c *gin.Context) {
 	})
 }
 
-func (h *WhatsAppHandler) WebhookHandler(c *gin.Context) {
-	var webhookData map[string]interface{}
-	if err := c.ShouldBindJSON(&webhookData); err != nil {
-		log.Printf("Erro ao fazer bind do webhook: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
-		return
-	}
-
-	log.Printf("Webhook recebido: %+v", webhookData)
-
-	// Processar evento de mudança de status da sessão
-	if event, ok := webhookData["event"].(string); ok && event == "session.status" {
-		go h.processSessionStatusChange(webhookData)
-	}
-
-	// Verificar se é uma mensagem de mídia
-	if event, ok := webhookData["event"].(string); ok && event == "message" {
-		if data, ok := webhookData["data"].(map[string]interface{}); ok {
-			if msgType, ok := data["type"].(string); ok {
-				// Processar mensagens de mídia
-				if msgType == "image" || msgType == "video" || msgType == "audio" || msgType == "voice" || msgType == "document" {
-					go h.processMediaMessage(data)
-				}
-			}
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Webhook processado com sucesso"})
-}
-
-func (h *WhatsAppHandler) processSessionStatusChange(webhookData map[string]interface{}) {
-	// Extrair dados do webhook
-	sessionName, ok := webhookData["session"].(string)
-	if !ok {
-		log.Printf("Erro: nome da sessão não encontrado no webhook")
-		return
+// ProcessarMidiaRecebida consumidor de mensagens do despachante WAHA: baixa a
+// mídia da URL temporária do WAHA, guarda no armazenamento de mídia e vincula
+// à mensagem. Mensagens de voz recebidas seguem para a transcrição.
+// Recebidas chegam por message e enviadas pelo celular por message.any.
+func (h *WhatsAppHandler) ProcessarMidiaRecebida(evento *services.EventoWAHA) error {
+	mensagem := evento.Mensagem
+	if mensagem == nil || !mensagem.HasMedia || mensagem.Media == nil || mensagem.Media.URL == "" {
+		return nil
 	}
-
-	data, ok := webhookData["data"].(map[string]interface{})
-	if !ok {
-		log.Printf("Erro: dados inválidos no webhook session.status")
-		return
+	if evento.Tipo == services.EventoWAHAMensagemQualquer && !mensagem.FromMe {
+		return nil
 	}
 
-	newStatus, ok := data["status"].(string)
-	if !ok {
-		log.Printf("Erro: status não encontrado nos dados do webhook")
-		return
-	}
-
-	log.Printf("Mudança de status detectada - Sessão: %s, Novo Status: %s", sessionName, newStatus)
-
-	// Extrair user_id do nome da sessão (formato: user_{uuid})
-	if !strings.HasPrefix(sessionName, "user_") {
-		log.Printf("Erro: formato de sessão inválido: %s", sessionName)
-		return
-	}
-
-	userID := strings.TrimPrefix(sessionName, "user_")
-	log.Printf("Extraído user_id: %s", userID)
-
-	// Buscar conexão no banco
-	db := h.whatsappService.GetDB()
-	var connection models.UserConnection
-	result := db.Where("user_id = ? AND platform = ?", userID, "whatsapp").First(&connection)
+	log.Printf("Processando mídia: chatID=%s, messageID=%s, type=%s", mensagem.ChatID(), mensagem.ID, mensagem.TipoMidia())
+	log.Printf("Baixando mídia de: %s", mensagem.Media.URL)
 
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			log.Printf("Conexão WhatsApp não encontrada para user_id: %s", userID)
-			return
-		}
-		log.Printf("Erro ao buscar conexão: %v", result.Error)
-		return
-	}
-
-	// Mapear status WAHA para nosso formato
-	var ourStatus models.ConnectionStatus
-	switch newStatus {
-	case "WORKING":
-		ourStatus = models.ConnectionStatusConnected
-	case "SCAN_QR_CODE":
-		ourStatus = models.ConnectionStatusConnecting
-	case "FAILED":
-		ourStatus = models.ConnectionStatusError
-	case "STOPPED":
-		ourStatus = models.ConnectionStatusDisconnected
-	default:
-		ourStatus = models.ConnectionStatusConnecting
+	mediaData, err := h.downloadMediaFromURL(mensagem.Media.URL)
+	if err != nil {
+		return fmt.Errorf("erro ao fazer download da mídia %s: %w", mensagem.Media.URL, err)
 	}
 
-	// Atualizar status se mudou
-	if connection.Status != ourStatus {
-		log.Printf("Atualizando status da conexão de '%s' para '%s'", connection.Status, ourStatus)
-
-		connection.Status = ourStatus
-		if err := db.Save(&connection).Error; err != nil {
-			log.Printf("Erro ao atualizar status da conexão: %v", err)
-			return
-		}
-
-		log.Printf("Status da conexão WhatsApp atualizado com sucesso para: %s", ourStatus)
-	} else {
-		log.Printf("Status já está atualizado: %s", ourStatus)
+	midia, err := h.midias.Armazenar(evento.OrganizacaoID, "", mensagem.Media.Filename, mediaData, models.OrigemMidiaWhatsApp)
+	if err != nil {
+		return fmt.Errorf("erro ao armazenar mídia: %w", err)
 	}
-}
-
-func (h *WhatsAppHandler) processMediaMessage(data map[string]interface{}) {
-	// Extrair informações da mensagem
-	chatID, _ := data["from"].(string)
-	messageID, _ := data["id"].(string)
-	msgType, _ := data["type"].(string)
-
-	log.Printf("Processando mídia: chatID=%s, messageID=%s, type=%s", chatID, messageID, msgType)
 
-	// Verificar se há mídia com hasMedia e media.url
-	hasMedia, _ := data["hasMedia"].(bool)
-	var mediaURL string
-	var filename string
+	log.Printf("Mídia recebida - Chat: %s, MessageID: %s, Mídia: %s, Tipo: %s", mensagem.ChatID(), mensagem.ID, midia.ID, midia.TipoMime)
 
-	if hasMedia {
-		if media, ok := data["media"].(map[string]interface{}); ok {
-			if url, ok := media["url"].(string); ok {
-				mediaURL = url
-			}
-			if fname, ok := media["filename"].(string); ok {
-				filename = fname
-			}
-		}
+	err = h.whatsappService.GetDB().Model(&models.Mensagem{}).
+		Where("id_mensagem = ?", mensagem.ID).
+		Updates(map[string]interface{}{"midia_id": midia.ID, "url_midia": services.CaminhoMidia(midia.ID)}).Error
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar mídia da mensagem %s: %w", mensagem.ID, err)
 	}
 
-	if mediaURL != "" {
-		log.Printf("Baixando mídia de: %s", mediaURL)
-
-		mediaData, err := h.downloadMediaFromURL(mediaURL)
-		if err != nil {
-			log.Printf("Erro ao fazer download da mídia %s: %v", mediaURL, err)
-			return
+	if !mensagem.FromMe {
+		if err := h.transcricao.EnfileirarRecebida(evento.OrganizacaoID, mensagem.ID); err != nil {
+			log.Printf("[TRANSCRICAO] %v", err)
 		}
-
-		// Salvar mídia no droplet
-		savedURL, err := saveMediaToDroplet(mediaData, filename)
-		if err != nil {
-			log.Printf("Erro ao salvar mídia no droplet: %v", err)
-			return
-		}
-
-		log.Printf("Mídia salva no droplet: %s", savedURL)
-		log.Printf("Mídia recebida - Chat: %s, MessageID: %s, URL: %s, Tipo: %s", chatID, messageID, savedURL, msgType)
 	}
+	return nil
 }
 
 func (h *WhatsAppHandler) downloadMediaFromURL(mediaURL string) ([]byte, error) {
@@ -615,66 +759,13 @@ func (h *WhatsAppHandler) downloadMediaFromURL(mediaURL string) ([]byte, error)
 	return data, nil
 }
 
-func (h *WhatsAppHandler) saveMediaToDroplet(data []byte, filename, msgType string) (string, error) {
-	// Criar diretório uploads se não existir
-	uploadsDir := "./uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		return "", fmt.Errorf("erro ao criar diretório uploads: %v", err)
-	}
-
-	// Gerar nome único para o arquivo
-	timestamp := time.Now().Unix()
-	randomId := fmt.Sprintf("%d", rand.Int63())
-
-	// Determinar extensão baseada no tipo
-	var ext string
-	switch msgType {
-	case "image":
-		ext = ".jpg"
-		if strings.Contains(filename, ".png") {
-			ext = ".png"
-		} else if strings.Contains(filename, ".gif") {
-			ext = ".gif"
-		} else if strings.Contains(filename, ".webp") {
-			ext = ".webp"
-		}
-	case "audio", "voice":
-		ext = ".oga"
-		if strings.Contains(filename, ".mp3") {
-			ext = ".mp3"
-		} else if strings.Contains(filename, ".wav") {
-			ext = ".wav"
-		}
-	case "video":
-		ext = ".mp4"
-		if strings.Contains(filename, ".webm") {
-			ext = ".webm"
-		}
-	case "document":
-		// Manter extensão original
-		if idx := strings.LastIndex(filename, "."); idx != -1 {
-			ext = filename[idx:]
-		} else {
-			ext = ".bin"
-		}
-	default:
-		ext = ".bin"
-	}
-
-	// Nome final do arquivo
-	finalFilename := fmt.Sprintf("%s_%d_%s%s", msgType, timestamp, randomId, ext)
-	filePath := filepath.Join(uploadsDir, finalFilename)
-
-	// Salvar arquivo
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return "", fmt.Errorf("erro ao salvar arquivo: %v", err)
+// armazenarMidia guarda a mídia enviada pelo painel e retorna uma URL assinada
+func (h *WhatsAppHandler) armazenarMidia(c *gin.Context, data []byte, filename string) (*models.Midia, string, error) {
+	midia, err := h.midias.Armazenar(c.GetString("organizacao_id"), c.GetString("user_id"), filename, data, models.OrigemMidiaUpload)
+	if err != nil {
+		return nil, "", err
 	}
-
-	// Retornar URL pública
-	publicURL := fmt.Sprintf("http://159.65.34.199:3001/api/files/%s", finalFilename)
-	log.Printf("Mídia salva no droplet: %s", publicURL)
-
-	return publicURL, nil
+	return midia, h.midias.URLAssinada(midia.ID, 0), nil
 }
 
 // SendImageMessage handler para envio de imagens
@@ -685,7 +776,6 @@ func (h *WhatsAppHandler) SendImageMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	chatID := c.Param("chatId")
 
 	// Parse multipart form
@@ -710,10 +800,13 @@ func (h *WhatsAppHandler) SendImageMessage(c *gin.Context) {
 		return
 	}
 
-	// Save to droplet
-	mediaURL, err := h.saveMediaToDroplet(fileData, header.Filename, "image")
+	// Salvar no armazenamento de mídia
+	_, mediaURL, err := h.armazenarMidia(c, fileData, header.Filename)
 	if err != nil {
-		log.Printf("Erro ao salvar imagem no droplet: %v", err)
+		if cotaMidiaExcedida(c, err) {
+			return
+		}
+		log.Printf("Erro ao salvar imagem no armazenamento: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar imagem"})
 		return
 	}
@@ -722,8 +815,16 @@ func (h *WhatsAppHandler) SendImageMessage(c *gin.Context) {
 	caption := c.Request.FormValue("caption")
 
 	// Send via WAHA API
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	err = h.whatsappService.SendImageMessage(sessionName, chatID, fileData, header.Filename, caption)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("Erro ao enviar imagem via WAHA: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enviar imagem"})
 		return
@@ -744,7 +845,6 @@ func (h *WhatsAppHandler) SendVoiceMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	chatID := c.Param("chatId")
 
 	// Parse multipart form
@@ -769,17 +869,36 @@ func (h *WhatsAppHandler) SendVoiceMessage(c *gin.Context) {
 		return
 	}
 
-	// Save to droplet
-	mediaURL, err := saveMediaToDroplet(fileData, header.Filename)
+	// Salvar no armazenamento de mídia
+	midia, mediaURL, err := h.armazenarMidia(c, fileData, header.Filename)
 	if err != nil {
-		log.Printf("Erro ao salvar áudio no droplet: %v", err)
+		if cotaMidiaExcedida(c, err) {
+			return
+		}
+		log.Printf("Erro ao salvar áudio no armazenamento: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar áudio"})
 		return
 	}
 
+	// Áudio gravado no navegador (webm) vai convertido para Opus/OGG; sem
+	// ffmpeg segue o original e o WAHA tenta converter
+	if audio, err := h.processamento.AudioPTT(midia); err == nil {
+		fileData = audio
+	} else {
+		log.Printf("Áudio %s enviado sem conversão: %v", midia.ID, err)
+	}
+
 	// Send via WAHA API with convert=true for compatibility
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	err = h.whatsappService.SendVoiceMessage(sessionName, chatID, fileData, header.Filename)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("Erro ao enviar áudio via WAHA: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enviar áudio"})
 		return
@@ -800,7 +919,6 @@ func (h *WhatsAppHandler) SendFileMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	chatID := c.Param("chatId")
 
 	// Parse multipart form
@@ -825,10 +943,13 @@ func (h *WhatsAppHandler) SendFileMessage(c *gin.Context) {
 		return
 	}
 
-	// Save to droplet
-	mediaURL, err := saveMediaToDroplet(fileData, header.Filename)
+	// Salvar no armazenamento de mídia
+	_, mediaURL, err := h.armazenarMidia(c, fileData, header.Filename)
 	if err != nil {
-		log.Printf("Erro ao salvar arquivo no droplet: %v", err)
+		if cotaMidiaExcedida(c, err) {
+			return
+		}
+		log.Printf("Erro ao salvar arquivo no armazenamento: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
 		return
 	}
@@ -837,8 +958,16 @@ func (h *WhatsAppHandler) SendFileMessage(c *gin.Context) {
 	caption := c.PostForm("caption")
 
 	// Send via WAHA API
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	err = h.whatsappService.SendFileMessage(sessionName, chatID, fileData, header.Filename, caption)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("Erro ao enviar arquivo via WAHA: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enviar arquivo"})
 		return
@@ -859,7 +988,6 @@ func (h *WhatsAppHandler) DownloadMedia(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	mediaID := c.Param("mediaId")
 
 	if mediaID == "" {
@@ -868,6 +996,11 @@ func (h *WhatsAppHandler) DownloadMedia(c *gin.Context) {
 	}
 
 	// Download via WAHA API
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, "")
+	if !ok {
+		return
+	}
+
 	mediaData, filename, err := h.whatsappService.DownloadMedia(sessionName, mediaID)
 	if err != nil {
 		log.Printf("[WHATSAPP] DownloadMedia - Error: %v", err)
@@ -880,32 +1013,6 @@ func (h *WhatsAppHandler) DownloadMedia(c *gin.Context) {
 	c.Data(http.StatusOK, "application/octet-stream", mediaData)
 }
 
-// saveMediaToDroplet salva mídia no droplet e retorna URL pública
-func saveMediaToDroplet(data []byte, filename string) (string, error) {
-	// Criar diretório se não existir
-	uploadDir := "./uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", err
-	}
-
-	// Gerar nome único para o arquivo
-	ext := filepath.Ext(filename)
-	uniqueFilename := fmt.Sprintf("%s-%d%s",
-		strings.TrimSuffix(filename, ext),
-		time.Now().Unix()+rand.Int63n(1000),
-		ext)
-
-	filePath := filepath.Join(uploadDir, uniqueFilename)
-
-	// Salvar arquivo
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return "", err
-	}
-
-	// Retornar URL pública para acessar o arquivo
-	return fmt.Sprintf("http://159.65.34.199:3001/api/files/%s", uniqueFilename), nil
-}
-
 // AtendimentoStatsHandler gerencia estatísticas de atendimento
 type AtendimentoStatsHandler struct {
 	whatsappService *services.WhatsAppService
@@ -960,13 +1067,14 @@ func (h *AtendimentoStatsHandler) GetStats(c *gin.Context) {
 		}
 	}
 
-	// Contar atendentes online (usuários ativos do sistema)
+	// Contar atendentes online (usuários ativos da organização)
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
 	var atendentesOnline int64
-	h.db.Model(&models.Usuario{}).Where("ativo = ? AND tipo LIKE ?", true, "ATENDENTE%").Count(&atendentesOnline)
+	h.db.Model(&models.Usuario{}).Scopes(organizacao).Where("ativo = ? AND tipo LIKE ?", true, "ATENDENTE%").Count(&atendentesOnline)
 	
 	// Incluir admins também
 	var adminsOnline int64
-	h.db.Model(&models.Usuario{}).Where("ativo = ? AND tipo = ?", true, "ADMIN").Count(&adminsOnline)
+	h.db.Model(&models.Usuario{}).Scopes(organizacao).Where("ativo = ? AND tipo = ?", true, "ADMIN").Count(&adminsOnline)
 	
 	totalAtendentes := int(atendentesOnline + adminsOnline)
 
@@ -989,10 +1097,11 @@ func (h *AtendimentoStatsHandler) GetStats(c *gin.Context) {
 // KanbanHandler gerencia Kanban
 type KanbanHandler struct {
 	kanbanService *services.KanbanService
+	webhooks      *services.WebhookService
 }
 
-func NewKanbanHandler(kanbanService *services.KanbanService) *KanbanHandler {
-	return &KanbanHandler{kanbanService: kanbanService}
+func NewKanbanHandler(kanbanService *services.KanbanService, webhooks *services.WebhookService) *KanbanHandler {
+	return &KanbanHandler{kanbanService: kanbanService, webhooks: webhooks}
 }
 
 func (h *KanbanHandler) ListQuadros(c *gin.Context) {
@@ -1028,6 +1137,8 @@ func (h *KanbanHandler) CreateQuadro(c *gin.Context) {
 		Posicao:   req.Posicao,
 		UsuarioID: userID,
 		Ativo:     true,
+
+		OrganizacaoID: c.GetString("organizacao_id"),
 	}
 
 	if err := h.kanbanService.CreateQuadro(quadro); err != nil {
@@ -1194,6 +1305,18 @@ func (h *KanbanHandler) MoveCard(c *gin.Context) {
 		return
 	}
 
+	// Reordenação dentro da mesma coluna não gera evento
+	if req.SourceColumnID != req.TargetColumnID {
+		h.webhooks.Publicar(c.GetString("organizacao_id"), models.EventoCardMovido, gin.H{
+			"quadroId":        req.QuadroID,
+			"cardId":          req.CardID,
+			"colunaOrigemId":  req.SourceColumnID,
+			"colunaDestinoId": req.TargetColumnID,
+			"posicao":         req.Posicao,
+			"usuarioId":       userID,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Card movido com sucesso"})
 }
 
@@ -1264,11 +1387,32 @@ func (h *KanbanHandler) ReorderColumns(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Colunas reordenadas com sucesso"})
 }
 
-// ProxyToWAHA faz proxy das requisições do frontend para o WAHA interno
+// ProxyToWAHA faz proxy das requisições do frontend para o WAHA interno.
+// Só repassa sessões da organização liberadas ao usuário autenticado.
 func (h *WhatsAppHandler) ProxyToWAHA(c *gin.Context) {
+	solicitada := c.Param("session")
+	sessao, err := h.whatsappService.SessaoParaChat(c.GetString("user_id"), "", solicitada)
+	if errors.Is(err, services.ErrSessaoNaoPermitida) || (err == nil && sessao.NomeSessao != solicitada && sessao.ID != solicitada) {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrSessaoNaoPermitida.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("[PROXY] Erro ao resolver sessão %s: %v", solicitada, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao resolver sessão do WhatsApp"})
+		return
+	}
+
+	// A sessão pode ter sido informada pelo id; o WAHA conhece apenas o nome
+	segmentos := strings.Split(c.Request.URL.Path, "/")
+	for i, segmento := range segmentos {
+		if segmento == solicitada {
+			segmentos[i] = sessao.NomeSessao
+		}
+	}
+
 	// Construir URL do WAHA
 	wahaURL := h.whatsappService.GetWAHAURL()
-	targetURL := wahaURL + c.Request.URL.Path
+	targetURL := wahaURL + strings.Join(segmentos, "/")
 
 	// Preservar query parameters
 	if c.Request.URL.RawQuery != "" {
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
+)
+
+type ImportacaoHistoricoHandler struct {
+	db         *gorm.DB
+	importacao *services.ImportacaoHistoricoService
+	auditoria  *services.AuditoriaService
+}
+
+func NewImportacaoHistoricoHandler(db *gorm.DB, importacao *services.ImportacaoHistoricoService, auditoria *services.AuditoriaService) *ImportacaoHistoricoHandler {
+	return &ImportacaoHistoricoHandler{db: db, importacao: importacao, auditoria: auditoria}
+}
+
+// IniciarImportacao importa o histórico de conversas da sessão a partir do WAHA
+func (h *ImportacaoHistoricoHandler) IniciarImportacao(c *gin.Context) {
+	var opcoes services.OpcoesImportacao
+	if err := c.ShouldBindJSON(&opcoes); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessao models.SessaoWhatsApp
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Where("id = ?", c.Param("id")).
+		First(&sessao).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sessão WhatsApp não encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão WhatsApp"})
+		return
+	}
+
+	importacao, err := h.importacao.Iniciar(&sessao, c.GetString("user_id"), opcoes)
+	if errors.Is(err, services.ErrImportacaoEmAndamento) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrSessaoNaoConectada) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao iniciar importação"})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "importacao_historico", importacao.ID, nil, importacao)
+
+	c.JSON(http.StatusAccepted, importacao)
+}
+
+// ListarImportacoes importações da sessão, da mais recente para a mais antiga
+func (h *ImportacaoHistoricoHandler) ListarImportacoes(c *gin.Context) {
+	var importacoes []models.ImportacaoHistorico
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Where("sessao_whatsapp_id = ?", c.Param("id")).
+		Order("criado_em DESC").
+		Find(&importacoes).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar importações"})
+		return
+	}
+
+	c.JSON(http.StatusOK, importacoes)
+}
+
+// ObterImportacao progresso e cursor de uma importação
+func (h *ImportacaoHistoricoHandler) ObterImportacao(c *gin.Context) {
+	importacao, ok := h.buscarImportacao(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, importacao)
+}
+
+// PausarImportacao interrompe a importação mantendo o cursor
+func (h *ImportacaoHistoricoHandler) PausarImportacao(c *gin.Context) {
+	importacao, ok := h.buscarImportacao(c)
+	if !ok {
+		return
+	}
+
+	if err := h.importacao.Pausar(importacao); err != nil {
+		if errors.Is(err, services.ErrImportacaoNaoPausavel) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao pausar importação"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Importação pausada"})
+}
+
+// RetomarImportacao continua a importação a partir do cursor gravado
+func (h *ImportacaoHistoricoHandler) RetomarImportacao(c *gin.Context) {
+	importacao, ok := h.buscarImportacao(c)
+	if !ok {
+		return
+	}
+
+	if err := h.importacao.Retomar(importacao); err != nil {
+		if errors.Is(err, services.ErrImportacaoNaoRetomavel) || errors.Is(err, services.ErrImportacaoEmAndamento) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao retomar importação"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Importação retomada"})
+}
+
+// buscarImportacao carrega a importação de :importacaoId na sessão :id da organização
+func (h *ImportacaoHistoricoHandler) buscarImportacao(c *gin.Context) (*models.ImportacaoHistorico, bool) {
+	var importacao models.ImportacaoHistorico
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Where("id = ? AND sessao_whatsapp_id = ?", c.Param("importacaoId"), c.Param("id")).
+		First(&importacao).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Importação não encontrada"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar importação"})
+		return nil, false
+	}
+	return &importacao, true
+}
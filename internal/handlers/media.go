@@ -1,25 +1,284 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+
 	"github.com/gin-gonic/gin"
 )
 
 // MediaHandler gerencia mídia
-type MediaHandler struct{}
+type MediaHandler struct {
+	midias        *services.MidiaService
+	processamento *services.ProcessamentoMidiaService
+	retencao      *services.RetencaoMidiaService
+	auditoria     *services.AuditoriaService
+	tamanhoMaximo int64
+}
 
-func NewMediaHandler() *MediaHandler {
-	return &MediaHandler{}
+func NewMediaHandler(midias *services.MidiaService, processamento *services.ProcessamentoMidiaService, retencao *services.RetencaoMidiaService, auditoria *services.AuditoriaService, cfg *config.Config) *MediaHandler {
+	return &MediaHandler{midias: midias, processamento: processamento, retencao: retencao, auditoria: auditoria, tamanhoMaximo: cfg.MediaMaxUploadBytes}
 }
 
+// UploadMedia recebe o arquivo no campo "file" e devolve a mídia com uma URL assinada
 func (h *MediaHandler) UploadMedia(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Upload de mídia"})
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.tamanhoMaximo+(1<<20))
+
+	arquivo, cabecalho, err := c.Request.FormFile("file")
+	if err != nil {
+		var excedeu *http.MaxBytesError
+		if errors.As(err, &excedeu) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Arquivo excede o tamanho máximo permitido"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo não encontrado"})
+		return
+	}
+	defer arquivo.Close()
+
+	if cabecalho.Size > h.tamanhoMaximo {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Arquivo excede o tamanho máximo permitido"})
+		return
+	}
+
+	dados, err := io.ReadAll(arquivo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo"})
+		return
+	}
+
+	midia, err := h.midias.Armazenar(c.GetString("organizacao_id"), c.GetString("user_id"), cabecalho.Filename, dados, models.OrigemMidiaUpload)
+	if err != nil {
+		if cotaMidiaExcedida(c, err) {
+			return
+		}
+		log.Printf("[MIDIA] Erro ao armazenar upload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "midia", midia.ID, nil, midia)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"midia": midia,
+		"url":   h.midias.URLAssinada(midia.ID, 0),
+	})
 }
 
+// GetMedia dados da mídia e URLs assinadas novas para o original e as
+// variantes já processadas (miniatura, áudio Opus/OGG)
 func (h *MediaHandler) GetMedia(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Buscar mídia"})
+	midia, ok := h.buscarMidia(c)
+	if !ok {
+		return
+	}
+	h.midias.AssinarMidia(midia)
+
+	c.JSON(http.StatusOK, gin.H{
+		"midia": midia,
+		"url":   h.midias.URLAssinada(midia.ID, 0),
+	})
 }
 
+// DeleteMedia remove a mídia da organização e a desvincula das mensagens
 func (h *MediaHandler) DeleteMedia(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Excluir mídia"})
+	midia, ok := h.buscarMidia(c)
+	if !ok {
+		return
+	}
+
+	if err := h.midias.Remover(midia); err != nil {
+		log.Printf("[MIDIA] Erro ao remover mídia %s: %v", midia.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover mídia"})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "midia", midia.ID, midia, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mídia removida com sucesso"})
+}
+
+// ReprocessarMedia devolve a mídia para a fila de processamento (ex: após
+// instalar o ffmpeg no servidor)
+func (h *MediaHandler) ReprocessarMedia(c *gin.Context) {
+	midia, ok := h.buscarMidia(c)
+	if !ok {
+		return
+	}
+
+	if err := h.processamento.Reprocessar(midia); err != nil {
+		log.Printf("[MIDIA] Erro ao reprocessar mídia %s: %v", midia.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao reprocessar mídia"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Mídia enviada para processamento"})
+}
+
+// ListarVinculosMedia orçamentos e contratos que protegem a mídia da retenção
+func (h *MediaHandler) ListarVinculosMedia(c *gin.Context) {
+	midia, ok := h.buscarMidia(c)
+	if !ok {
+		return
+	}
+
+	vinculos, err := h.retencao.ListarVinculos(midia.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar vínculos da mídia"})
+		return
+	}
+
+	c.JSON(http.StatusOK, vinculos)
+}
+
+// VincularMedia liga a mídia a um orçamento ou contrato da organização
+func (h *MediaHandler) VincularMedia(c *gin.Context) {
+	var req struct {
+		Entidade   string `json:"entidade" binding:"required"`
+		EntidadeID string `json:"entidadeId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	midia, ok := h.buscarMidia(c)
+	if !ok {
+		return
+	}
+
+	vinculo, err := h.retencao.Vincular(midia, req.Entidade, req.EntidadeID, c.GetString("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEntidadeVinculoInvalida):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrEntidadeVinculoInexistente):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			log.Printf("[MIDIA] Erro ao vincular mídia %s: %v", midia.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao vincular mídia"})
+		}
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "vinculo_midia", vinculo.ID, nil, vinculo)
+
+	c.JSON(http.StatusCreated, vinculo)
+}
+
+// DesvincularMedia remove o vínculo; a mídia volta a seguir a retenção
+func (h *MediaHandler) DesvincularMedia(c *gin.Context) {
+	midia, ok := h.buscarMidia(c)
+	if !ok {
+		return
+	}
+
+	vinculo, err := h.retencao.Desvincular(midia.ID, c.Param("vinculoId"))
+	if err != nil {
+		if errors.Is(err, services.ErrVinculoMidiaNaoEncontrado) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vínculo não encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover vínculo"})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "vinculo_midia", vinculo.ID, vinculo, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vínculo removido com sucesso"})
+}
+
+// ServirMidia entrega o conteúdo pela URL assinada (?expira=&assinatura=, e
+// ?variante= para miniatura ou áudio convertido). A rota é pública para que
+// navegador e WAHA acessem a mídia sem o token.
+func (h *MediaHandler) ServirMidia(c *gin.Context) {
+	id := c.Param("id")
+	variante := c.Query("variante")
+	if err := h.midias.ValidarAssinatura(id, variante, c.Query("expira"), c.Query("assinatura")); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, services.ErrURLMidiaExpirada) {
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	midia, err := h.midias.Buscar("", id)
+	if err != nil {
+		if errors.Is(err, services.ErrMidiaNaoEncontrada) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mídia não encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar mídia"})
+		return
+	}
+
+	leitor, tipoMime, nome, err := h.midias.AbrirVariante(midia, variante)
+	if err != nil {
+		if errors.Is(err, services.ErrMidiaNaoEncontrada) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Arquivo da mídia não encontrado"})
+			return
+		}
+		log.Printf("[MIDIA] Erro ao abrir mídia %s: %v", midia.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao abrir mídia"})
+		return
+	}
+	defer leitor.Close()
+
+	// Tipos que o navegador executaria (html, svg...) são sempre baixados
+	disposicao := "attachment"
+	if exibivelInline(tipoMime) {
+		disposicao = "inline"
+	}
+	c.Header("Content-Type", tipoMime)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposicao, map[string]string{"filename": nome}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=3600")
+
+	// No disco local o arquivo aceita Range (necessário para avançar áudio e vídeo)
+	if arquivo, ok := leitor.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, nome, midia.CriadoEm, arquivo)
+		return
+	}
+	c.DataFromReader(http.StatusOK, -1, tipoMime, leitor, nil)
+}
+
+// buscarMidia carrega a mídia :id da organização
+func (h *MediaHandler) buscarMidia(c *gin.Context) (*models.Midia, bool) {
+	midia, err := h.midias.Buscar(c.GetString("organizacao_id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrMidiaNaoEncontrada) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mídia não encontrada"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar mídia"})
+		return nil, false
+	}
+	return midia, true
+}
+
+// cotaMidiaExcedida responde 507 quando o upload passaria da cota da organização
+func cotaMidiaExcedida(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrCotaMidiaExcedida) {
+		return false
+	}
+	c.JSON(http.StatusInsufficientStorage, gin.H{"error": "Cota de armazenamento de mídia da organização excedida"})
+	return true
+}
+
+func exibivelInline(tipoMime string) bool {
+	tipo := strings.SplitN(tipoMime, ";", 2)[0]
+	if tipo == "image/svg+xml" {
+		return false
+	}
+	return strings.HasPrefix(tipo, "image/") || strings.HasPrefix(tipo, "audio/") ||
+		strings.HasPrefix(tipo, "video/") || tipo == "application/pdf"
 }
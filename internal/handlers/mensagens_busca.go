@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"tappyone/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BuscaMensagensHandler struct {
+	messageService    *services.MessageService
+	permissionService *services.PermissionService
+}
+
+func NewBuscaMensagensHandler(messageService *services.MessageService, permissionService *services.PermissionService) *BuscaMensagensHandler {
+	return &BuscaMensagensHandler{
+		messageService:    messageService,
+		permissionService: permissionService,
+	}
+}
+
+// BuscarMensagens busca textual nas mensagens gravadas. Em /chats/:chatId a
+// busca fica restrita ao chat; filtros: desde, ate, remetente ("eu" ou o
+// número), tipo, tagId e sessao (id ou nome)
+func (h *BuscaMensagensHandler) BuscarMensagens(c *gin.Context) {
+	termo := c.Query("q")
+	if termo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	escopo, err := h.permissionService.EscopoAtendimento(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply access scope"})
+		return
+	}
+
+	filtro := services.FiltroBuscaMensagens{
+		Termo:     termo,
+		ChatID:    c.Param("chatId"),
+		Sessao:    c.Query("sessao"),
+		Remetente: c.Query("remetente"),
+		Tipo:      c.Query("tipo"),
+		TagID:     c.Query("tagId"),
+		Desde:     parseDataQuery(c, "desde"),
+		Ate:       parseDataQuery(c, "ate"),
+		Limit:     limit,
+		Offset:    offset,
+	}
+
+	resultados, total, err := h.messageService.BuscarMensagens(escopo, filtro)
+	if err != nil {
+		log.Printf("[WHATSAPP] Erro na busca de mensagens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar mensagens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resultados": resultados,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -13,11 +15,17 @@ import (
 
 // OrcamentosHandler gerencia os orçamentos
 type OrcamentosHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	organizacoes *repositories.OrganizacaoRepository
+	webhooks     *services.WebhookService
 }
 
-func NewOrcamentosHandler(db *gorm.DB) *OrcamentosHandler {
-	return &OrcamentosHandler{db: db}
+func NewOrcamentosHandler(db *gorm.DB, webhooks *services.WebhookService) *OrcamentosHandler {
+	return &OrcamentosHandler{
+		db:           db,
+		organizacoes: repositories.NewOrganizacaoRepository(db),
+		webhooks:     webhooks,
+	}
 }
 
 // ListOrcamentos lista todos os orçamentos do usuário
@@ -34,8 +42,7 @@ func (h *OrcamentosHandler) ListOrcamentos(c *gin.Context) {
 		numeroTelefone := strings.Replace(contatoJID, "@c.us", "", 1)
 
 		// Buscar contato pelo número de telefone
-		var contato models.Contato
-		if err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error; err == nil {
+		if contato, err := h.organizacoes.BuscarContatoPorTelefone(c.GetString("organizacao_id"), numeroTelefone); err == nil {
 			// Se contato encontrado, filtrar por UUID do contato
 			query = query.Where("contato_id = ?", contato.ID)
 		} else {
@@ -93,36 +100,11 @@ func (h *OrcamentosHandler) CreateOrcamento(c *gin.Context) {
 	// Extrair número de telefone do JID (remove @c.us)
 	numeroTelefone := strings.Replace(req.ContatoID, "@c.us", "", 1)
 
-	// Buscar ou criar contato baseado no número de telefone
-	var contato models.Contato
-	err := h.db.Where("numero_telefone = ?", numeroTelefone).First(&contato).Error
+	// Buscar ou criar contato da organização baseado no número de telefone
+	contato, err := h.organizacoes.BuscarOuCriarContato(c.GetString("organizacao_id"), userID, numeroTelefone)
 	if err != nil {
-		// Buscar ou criar uma sessão WhatsApp padrão
-		var sessaoWhatsapp models.SessaoWhatsApp
-		err := h.db.Where("nome_sessao = ?", "default").First(&sessaoWhatsapp).Error
-		if err != nil {
-			// Criar sessão padrão se não existir
-			sessaoWhatsapp = models.SessaoWhatsApp{
-				NomeSessao: "default",
-				Status:     "ATIVO",
-				UsuarioID:  userID,
-			}
-			if err := h.db.Create(&sessaoWhatsapp).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão padrão"})
-				return
-			}
-		}
-
-		// Se contato não existe, criar um novo
-		contato = models.Contato{
-			NumeroTelefone:   numeroTelefone,
-			Nome:             &numeroTelefone,   // Usar número como nome temporário
-			SessaoWhatsappID: sessaoWhatsapp.ID, // Usar sessão padrão
-		}
-		if err := h.db.Create(&contato).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
-			return
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar contato"})
+		return
 	}
 
 	// Calcular valor total
@@ -176,6 +158,7 @@ func (h *OrcamentosHandler) UpdateOrcamento(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Orçamento não encontrado"})
 		return
 	}
+	statusAnterior := orcamento.Status
 
 	// Atualizar campos fornecidos
 	updates := make(map[string]interface{})
@@ -228,6 +211,10 @@ func (h *OrcamentosHandler) UpdateOrcamento(c *gin.Context) {
 		return
 	}
 
+	if statusAnterior != models.StatusOrcamentoAprovado && orcamento.Status == models.StatusOrcamentoAprovado {
+		h.webhooks.Publicar(c.GetString("organizacao_id"), models.EventoOrcamentoAprovado, orcamento)
+	}
+
 	c.JSON(http.StatusOK, orcamento)
 }
 
@@ -300,5 +287,10 @@ func (h *OrcamentosHandler) UpdateOrcamentoStatus(c *gin.Context) {
 		return
 	}
 
+	if orcamento.Status != models.StatusOrcamentoAprovado && models.StatusOrcamento(req.Status) == models.StatusOrcamentoAprovado {
+		orcamento.Status = models.StatusOrcamentoAprovado
+		h.webhooks.Publicar(c.GetString("organizacao_id"), models.EventoOrcamentoAprovado, orcamento)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Status atualizado com sucesso"})
 }
@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// OrganizacaoHandler gerencia a organização do usuário e os convites de entrada
+type OrganizacaoHandler struct {
+	organizacaoService *services.OrganizacaoService
+	permissionService  *services.PermissionService
+	userService        *services.UserService
+	rateLimiter        *services.RateLimiter
+	auditoria          *services.AuditoriaService
+	config             *config.Config
+}
+
+// NewOrganizacaoHandler cria um novo handler de organizações
+func NewOrganizacaoHandler(organizacaoService *services.OrganizacaoService, permissionService *services.PermissionService, userService *services.UserService, rateLimiter *services.RateLimiter, auditoria *services.AuditoriaService, cfg *config.Config) *OrganizacaoHandler {
+	return &OrganizacaoHandler{
+		organizacaoService: organizacaoService,
+		permissionService:  permissionService,
+		userService:        userService,
+		rateLimiter:        rateLimiter,
+		auditoria:          auditoria,
+		config:             cfg,
+	}
+}
+
+// ObterOrganizacao - GET /api/organizacao
+func (h *OrganizacaoHandler) ObterOrganizacao(c *gin.Context) {
+	organizacao, err := h.organizacaoService.Obter(c.GetString("organizacao_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Organização não encontrada",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    organizacao,
+	})
+}
+
+// AtualizarOrganizacao - PUT /api/organizacao
+func (h *OrganizacaoHandler) AtualizarOrganizacao(c *gin.Context) {
+	var req struct {
+		Nome string `json:"nome" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	antes, _ := h.organizacaoService.Obter(c.GetString("organizacao_id"))
+
+	organizacao, err := h.organizacaoService.Atualizar(c.GetString("organizacao_id"), req.Nome)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao atualizar organização",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "organizacao", organizacao.ID, antes, organizacao)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    organizacao,
+		"message": "Organização atualizada com sucesso",
+	})
+}
+
+// DefinirDoisFatores - PUT /api/organizacao/dois-fatores
+// Liga ou desliga a exigência de dois fatores para as contas ADMIN
+func (h *OrganizacaoHandler) DefinirDoisFatores(c *gin.Context) {
+	var req struct {
+		ExigirDoisFatoresAdmin *bool `json:"exigirDoisFatoresAdmin" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	antes, _ := h.organizacaoService.Obter(c.GetString("organizacao_id"))
+
+	organizacao, err := h.organizacaoService.DefinirExigenciaDoisFatores(c.GetString("organizacao_id"), c.GetString("user_id"), *req.ExigirDoisFatoresAdmin)
+	if err != nil {
+		if errors.Is(err, services.ErrDoisFatoresNaoAtivo) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Ative a autenticação em dois fatores na sua conta antes de exigi-la dos administradores",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao atualizar organização",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "organizacao", organizacao.ID, antes, organizacao)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    organizacao,
+		"message": "Configuração de dois fatores atualizada",
+	})
+}
+
+// RedefinirDoisFatoresUsuario - DELETE /api/organizacao/usuarios/:id/dois-fatores
+// Remove o segundo fator de um usuário que perdeu o autenticador e os códigos de recuperação
+func (h *OrganizacaoHandler) RedefinirDoisFatoresUsuario(c *gin.Context) {
+	organizacaoID := c.GetString("organizacao_id")
+	alvo, err := h.userService.GetByIDNaOrganizacao(organizacaoID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuário não encontrado",
+		})
+		return
+	}
+
+	// Só redefine quem tem ao menos as mesmas permissões do usuário alvo
+	permissoes := services.PermissoesPadrao[alvo.Tipo]
+	if alvo.PapelID != nil && *alvo.PapelID != "" {
+		if papel, err := h.userService.GetPapelByID(organizacaoID, *alvo.PapelID); err == nil {
+			permissoes = papel.Permissoes
+		}
+	}
+	if err := podeConceder(h.permissionService, c.GetString("user_id"), permissoes); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.organizacaoService.RedefinirDoisFatoresUsuario(alvo.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao redefinir autenticação em dois fatores",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "usuario", alvo.ID,
+		map[string]interface{}{"doisFatoresAtivo": alvo.DoisFatoresAtivo}, map[string]interface{}{"doisFatoresAtivo": false})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Autenticação em dois fatores redefinida. O usuário deverá configurá-la novamente.",
+	})
+}
+
+// DesbloquearLoginUsuario - DELETE /api/organizacao/usuarios/:id/bloqueio
+// Remove o bloqueio aplicado após falhas consecutivas de login
+func (h *OrganizacaoHandler) DesbloquearLoginUsuario(c *gin.Context) {
+	organizacaoID := c.GetString("organizacao_id")
+	alvo, err := h.userService.GetByIDNaOrganizacao(organizacaoID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Usuário não encontrado",
+		})
+		return
+	}
+
+	if err := h.organizacaoService.DesbloquearLoginUsuario(alvo.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao desbloquear usuário",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "usuario", alvo.ID,
+		map[string]interface{}{"loginBloqueadoAte": alvo.LoginBloqueadoAte}, map[string]interface{}{"loginBloqueadoAte": nil})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Usuário desbloqueado. As tentativas de login foram liberadas.",
+	})
+}
+
+// ListarConvites - GET /api/organizacao/convites
+func (h *OrganizacaoHandler) ListarConvites(c *gin.Context) {
+	convites, err := h.organizacaoService.ListarConvites(c.GetString("organizacao_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar convites",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    convites,
+	})
+}
+
+// CriarConvite - POST /api/organizacao/convites
+func (h *OrganizacaoHandler) CriarConvite(c *gin.Context) {
+	var req struct {
+		Email   string             `json:"email" binding:"required,email"`
+		Tipo    models.TipoUsuario `json:"tipo" binding:"required"`
+		PapelID *string            `json:"papelId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !services.TipoUsuarioValido(req.Tipo) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Tipo de usuário inválido",
+		})
+		return
+	}
+
+	organizacaoID := c.GetString("organizacao_id")
+	userID := c.GetString("user_id")
+
+	// O convidado não pode receber mais privilégios do que quem convida
+	permissoes := services.PermissoesPadrao[req.Tipo]
+	if req.PapelID != nil && *req.PapelID != "" {
+		papel, err := h.userService.GetPapelByID(organizacaoID, *req.PapelID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Papel não encontrado",
+			})
+			return
+		}
+		permissoes = papel.Permissoes
+	}
+	if err := podeConceder(h.permissionService, userID, permissoes); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	convite, err := h.organizacaoService.CriarConvite(organizacaoID, userID, req.Email, req.Tipo, req.PapelID)
+	if convite != nil {
+		h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "convite", convite.ID, nil, convite)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrEmailEmUso) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Email já está em uso",
+			})
+			return
+		}
+		if convite == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Erro ao criar convite",
+				"details": err.Error(),
+			})
+			return
+		}
+		// Convite criado, mas o email falhou: pode ser reenviado criando outro
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"data":    convite,
+			"message": "Convite criado, mas não foi possível enviar o email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    convite,
+		"message": "Convite enviado com sucesso",
+	})
+}
+
+// RevogarConvite - DELETE /api/organizacao/convites/:id
+func (h *OrganizacaoHandler) RevogarConvite(c *gin.Context) {
+	err := h.organizacaoService.RevogarConvite(c.GetString("organizacao_id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrConviteInvalido) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Convite não encontrado ou já utilizado",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao revogar convite",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaRevogar, "convite", c.Param("id"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Convite revogado com sucesso",
+	})
+}
+
+// ObterConvite - GET /api/convites/:token (público)
+func (h *OrganizacaoHandler) ObterConvite(c *gin.Context) {
+	if !h.permitir(c, "convites:ip:", 30, 15*time.Minute) {
+		return
+	}
+
+	convite, err := h.organizacaoService.ObterConvitePorToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Apenas o necessário para a tela de aceite
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"email":       convite.Email,
+			"tipo":        convite.Tipo,
+			"organizacao": convite.Organizacao.Nome,
+			"expiraEm":    convite.ExpiraEm,
+		},
+	})
+}
+
+// AceitarConvite - POST /api/convites/aceitar (público)
+func (h *OrganizacaoHandler) AceitarConvite(c *gin.Context) {
+	var req services.AceitarConviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !h.permitir(c, "convites:ip:", 30, 15*time.Minute) {
+		return
+	}
+
+	response, err := h.organizacaoService.AceitarConvite(req, clientInfo(c))
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, services.ErrEmailEmUso):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrConviteInvalido):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// CriarOrganizacao - POST /api/organizacoes (público, habilitado por ORG_SIGNUP_ENABLED)
+func (h *OrganizacaoHandler) CriarOrganizacao(c *gin.Context) {
+	if !h.config.OrgSignupEnabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cadastro de organizações desabilitado"})
+		return
+	}
+
+	if !h.permitir(c, "organizacoes:ip:", 5, time.Hour) {
+		return
+	}
+
+	var req services.NovaOrganizacaoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	response, err := h.organizacaoService.Criar(req, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, services.ErrEmailEmUso) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   "Email já está em uso",
+			})
+			return
+		}
+		log.Printf("[ORGANIZACAO] Erro ao criar organização: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// permitir aplica o limite por IP dos endpoints públicos
+func (h *OrganizacaoHandler) permitir(c *gin.Context, prefixo string, limite int, janela time.Duration) bool {
+	if ok, espera := h.rateLimiter.Permitir(prefixo+c.ClientIP(), limite, janela); !ok {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(espera.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas tentativas. Tente novamente mais tarde."})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
+)
+
+// PapeisHandler gerencia papéis personalizados e consulta de permissões
+type PapeisHandler struct {
+	db                *gorm.DB
+	permissionService *services.PermissionService
+	auditoria         *services.AuditoriaService
+}
+
+// NewPapeisHandler cria um novo handler de papéis
+func NewPapeisHandler(db *gorm.DB, permissionService *services.PermissionService, auditoria *services.AuditoriaService) *PapeisHandler {
+	return &PapeisHandler{
+		db:                db,
+		permissionService: permissionService,
+		auditoria:         auditoria,
+	}
+}
+
+type papelRequest struct {
+	Nome       string                 `json:"nome" binding:"required"`
+	Descricao  string                 `json:"descricao"`
+	Permissoes models.ListaPermissoes `json:"permissoes" binding:"required"`
+}
+
+// ListarPermissoes - GET /api/papeis/permissoes
+func (h *PapeisHandler) ListarPermissoes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"catalogo": services.CatalogoPermissoes,
+			"padrao":   services.PermissoesPadrao,
+		},
+	})
+}
+
+// MinhasPermissoes - GET /api/auth/permissions
+func (h *PapeisHandler) MinhasPermissoes(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	permissoes, err := h.permissionService.PermissoesUsuario(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao carregar permissões",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	escopo, err := h.permissionService.EscopoAtendimento(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao carregar escopo de atendimento",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"permissoes": permissoes,
+			"irrestrito": escopo.Irrestrito,
+			"filaIds":    escopo.FilaIDs,
+		},
+	})
+}
+
+// ListarPapeis - GET /api/papeis
+func (h *PapeisHandler) ListarPapeis(c *gin.Context) {
+	var papeis []models.Papel
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).Order("nome ASC").Find(&papeis).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar papéis",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    papeis,
+	})
+}
+
+// ObterPapel - GET /api/papeis/:id
+func (h *PapeisHandler) ObterPapel(c *gin.Context) {
+	var papel models.Papel
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).Preload("Usuarios").First(&papel, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Papel não encontrado",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    papel,
+	})
+}
+
+// CriarPapel - POST /api/papeis
+func (h *PapeisHandler) CriarPapel(c *gin.Context) {
+	var req papelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if !h.validarPermissoes(c, req.Permissoes) {
+		return
+	}
+
+	papel := models.Papel{
+		Nome:          req.Nome,
+		OrganizacaoID: c.GetString("organizacao_id"),
+		Descricao:     req.Descricao,
+		Permissoes:    req.Permissoes,
+	}
+	if userID := c.GetString("user_id"); userID != "" {
+		papel.CriadoPor = &userID
+	}
+
+	if err := h.db.Create(&papel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao criar papel",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "papel", papel.ID, nil, papel)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    papel,
+		"message": "Papel criado com sucesso",
+	})
+}
+
+// AtualizarPapel - PUT /api/papeis/:id
+func (h *PapeisHandler) AtualizarPapel(c *gin.Context) {
+	var papel models.Papel
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).First(&papel, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Papel não encontrado",
+		})
+		return
+	}
+
+	var req papelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Quem edita precisa cobrir tanto as permissões atuais quanto as novas
+	if !h.validarPermissoes(c, papel.Permissoes) || !h.validarPermissoes(c, req.Permissoes) {
+		return
+	}
+
+	antes := papel
+	papel.Nome = req.Nome
+	papel.Descricao = req.Descricao
+	papel.Permissoes = req.Permissoes
+
+	if err := h.db.Save(&papel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao atualizar papel",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.permissionService.InvalidarPapel(papel.ID)
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "papel", papel.ID, antes, papel)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    papel,
+		"message": "Papel atualizado com sucesso",
+	})
+}
+
+// DeletarPapel - DELETE /api/papeis/:id
+func (h *PapeisHandler) DeletarPapel(c *gin.Context) {
+	id := c.Param("id")
+	organizacao := repositories.PorOrganizacao(c.GetString("organizacao_id"))
+
+	var usuarios int64
+	h.db.Model(&models.Usuario{}).Scopes(organizacao).Where("papel_id = ?", id).Count(&usuarios)
+	if usuarios > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Papel atribuído a usuários. Remova as atribuições antes de excluir.",
+		})
+		return
+	}
+
+	var antes models.Papel
+	h.db.Scopes(organizacao).First(&antes, "id = ?", id)
+
+	result := h.db.Scopes(organizacao).Delete(&models.Papel{}, "id = ?", id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao deletar papel",
+			"details": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Papel não encontrado",
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "papel", id, antes, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Papel deletado com sucesso",
+	})
+}
+
+// validarPermissoes verifica o catálogo e impede conceder mais do que o próprio usuário possui
+func (h *PapeisHandler) validarPermissoes(c *gin.Context, permissoes models.ListaPermissoes) bool {
+	if err := services.ValidarPermissoes(permissoes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return false
+	}
+
+	if err := podeConceder(h.permissionService, c.GetString("user_id"), permissoes); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// podeConceder garante que o usuário só atribua permissões que ele mesmo possui
+func podeConceder(permissionService *services.PermissionService, userID string, permissoes models.ListaPermissoes) error {
+	proprias, err := permissionService.PermissoesUsuario(userID)
+	if err != nil {
+		return err
+	}
+	for _, p := range permissoes {
+		if !proprias.Concede(p) {
+			return errors.New("Não é permitido conceder a permissão " + string(p))
+		}
+	}
+	return nil
+}
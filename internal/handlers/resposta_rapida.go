@@ -670,62 +670,6 @@ func (h *RespostaRapidaHandler) PausarAgendamento(c *gin.Context) {
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "funcionalidade não implementada ainda"})
 }
 
-// ===== WEBHOOK PARA MENSAGENS =====
-
-// ProcessarMensagemWebhook processa mensagens recebidas via webhook
-func (h *RespostaRapidaHandler) ProcessarMensagemWebhook(c *gin.Context) {
-	var req struct {
-		Event   string `json:"event"`
-		Session string `json:"session"`
-		Payload struct {
-			ID   string `json:"id"`
-			From string `json:"from"`
-			Body string `json:"body"`
-			Type string `json:"type"`
-		} `json:"payload"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Verificar se é uma mensagem recebida
-	if req.Event != "message" || req.Payload.Type != "text" {
-		c.JSON(http.StatusOK, gin.H{"message": "evento ignorado"})
-		return
-	}
-
-	// Extrair user_id da session (assumindo formato "user_{id}")
-	sessionParts := strings.Split(req.Session, "_")
-	if len(sessionParts) != 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "formato de sessão inválido"})
-		return
-	}
-
-	usuarioID, err := uuid.Parse(sessionParts[1])
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de usuário inválido na sessão"})
-		return
-	}
-
-	// Processar mensagem
-	err = h.service.ProcessarMensagemRecebida(
-		usuarioID,
-		req.Payload.From,
-		req.Payload.Body,
-		"", // TODO: Extrair nome do contato
-		req.Payload.From,
-	)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "mensagem processada com sucesso"})
-}
-
 // ===== COMANDOS SLASH =====
 
 // ProcessarComandoSlash processa comandos slash no chat
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetencaoMidiaHandler uso do armazenamento de mídia e políticas de retenção da organização
+type RetencaoMidiaHandler struct {
+	midias    *services.MidiaService
+	retencao  *services.RetencaoMidiaService
+	auditoria *services.AuditoriaService
+}
+
+func NewRetencaoMidiaHandler(midias *services.MidiaService, retencao *services.RetencaoMidiaService, auditoria *services.AuditoriaService) *RetencaoMidiaHandler {
+	return &RetencaoMidiaHandler{midias: midias, retencao: retencao, auditoria: auditoria}
+}
+
+// ObterUso - GET /api/organizacao/midias/uso
+// Espaço ocupado, cota e maiores consumidores (conversas, usuários e arquivos)
+func (h *RetencaoMidiaHandler) ObterUso(c *gin.Context) {
+	limite, _ := strconv.Atoi(c.DefaultQuery("limite", "10"))
+
+	uso, err := h.midias.UsoOrganizacao(c.GetString("organizacao_id"), limite)
+	if err != nil {
+		log.Printf("[RETENCAO_MIDIA] Erro ao calcular uso de mídia: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao calcular uso de mídia"})
+		return
+	}
+
+	h.midias.AssinarMidias(uso.MaioresArquivos)
+	c.JSON(http.StatusOK, uso)
+}
+
+// ListarPoliticas - GET /api/organizacao/midias/retencao
+func (h *RetencaoMidiaHandler) ListarPoliticas(c *gin.Context) {
+	politicas, err := h.retencao.ListarPoliticas(c.GetString("organizacao_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar políticas de retenção"})
+		return
+	}
+
+	c.JSON(http.StatusOK, politicas)
+}
+
+// DefinirPoliticas - PUT /api/organizacao/midias/retencao
+// Substitui as políticas; categorias ausentes deixam de expirar
+func (h *RetencaoMidiaHandler) DefinirPoliticas(c *gin.Context) {
+	var req struct {
+		Politicas []services.PoliticaRetencaoMidiaRequest `json:"politicas" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+
+	organizacaoID := c.GetString("organizacao_id")
+	antes, _ := h.retencao.ListarPoliticas(organizacaoID)
+
+	politicas, err := h.retencao.DefinirPoliticas(organizacaoID, req.Politicas)
+	if err != nil {
+		if errors.Is(err, services.ErrCategoriaMidiaInvalida) || errors.Is(err, services.ErrRetencaoMidiaInvalida) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[RETENCAO_MIDIA] Erro ao salvar políticas: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar políticas de retenção"})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "politica_retencao_midia", organizacaoID, antes, politicas)
+
+	c.JSON(http.StatusOK, politicas)
+}
+
+// Executar - POST /api/organizacao/midias/retencao/executar?simulacao=true
+// Aplica as políticas agora; em simulação apenas informa o que seria removido
+func (h *RetencaoMidiaHandler) Executar(c *gin.Context) {
+	simulacao := c.DefaultQuery("simulacao", "true") != "false"
+
+	execucao, err := h.retencao.Executar(c.GetString("organizacao_id"), simulacao, false)
+	if err != nil {
+		log.Printf("[RETENCAO_MIDIA] Erro ao executar retenção: %v", err)
+		if execucao != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao aplicar retenção", "execucao": execucao})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao aplicar retenção"})
+		return
+	}
+
+	if !simulacao {
+		h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "execucao_retencao_midia", execucao.ID, nil, execucao)
+	}
+
+	c.JSON(http.StatusOK, execucao)
+}
+
+// ListarExecucoes - GET /api/organizacao/midias/retencao/execucoes
+func (h *RetencaoMidiaHandler) ListarExecucoes(c *gin.Context) {
+	limite, _ := strconv.Atoi(c.DefaultQuery("limite", "20"))
+
+	execucoes, err := h.retencao.ListarExecucoes(c.GetString("organizacao_id"), limite)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar execuções de retenção"})
+		return
+	}
+
+	c.JSON(http.StatusOK, execucoes)
+}
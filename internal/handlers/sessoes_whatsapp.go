@@ -1,27 +1,41 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
 )
 
+// errSessaoInvalida fila padrão ou usuários permitidos fora da organização
+var errSessaoInvalida = errors.New("fila padrão ou usuários permitidos não pertencem à organização")
+
 type SessoesWhatsAppHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	auditoria  *services.AuditoriaService
+	supervisor *services.SupervisorSessoesService
+	agendador  *services.AgendadorEnvios
 }
 
-func NewSessoesWhatsAppHandler(db *gorm.DB) *SessoesWhatsAppHandler {
-	return &SessoesWhatsAppHandler{db: db}
+func NewSessoesWhatsAppHandler(db *gorm.DB, auditoria *services.AuditoriaService, supervisor *services.SupervisorSessoesService, agendador *services.AgendadorEnvios) *SessoesWhatsAppHandler {
+	return &SessoesWhatsAppHandler{db: db, auditoria: auditoria, supervisor: supervisor, agendador: agendador}
 }
 
-// ListSessoesWhatsApp lista todas as sessões WhatsApp do usuário
+// ListSessoesWhatsApp lista todas as sessões WhatsApp da organização
 func (h *SessoesWhatsAppHandler) ListSessoesWhatsApp(c *gin.Context) {
-	userID := c.GetString("user_id")
-
 	var sessoes []models.SessaoWhatsApp
-	if err := h.db.Where("usuario_id = ?", userID).Find(&sessoes).Error; err != nil {
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Preload("UsuariosPermitidos").
+		Preload("FilaPadrao").
+		Order("padrao DESC, criado_em ASC").
+		Find(&sessoes).Error
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessões WhatsApp"})
 		return
 	}
@@ -31,93 +45,101 @@ func (h *SessoesWhatsAppHandler) ListSessoesWhatsApp(c *gin.Context) {
 
 // GetSessaoWhatsApp obtém uma sessão WhatsApp específica
 func (h *SessoesWhatsAppHandler) GetSessaoWhatsApp(c *gin.Context) {
-	userID := c.GetString("user_id")
-	sessaoID := c.Param("id")
-
-	var sessao models.SessaoWhatsApp
-	if err := h.db.Where("id = ? AND usuario_id = ?", sessaoID, userID).First(&sessao).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Sessão WhatsApp não encontrada"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão WhatsApp"})
+	sessao, ok := h.buscarSessao(c)
+	if !ok {
 		return
 	}
 
 	c.JSON(http.StatusOK, sessao)
 }
 
-// CreateSessaoWhatsApp cria uma nova sessão WhatsApp
-func (h *SessoesWhatsAppHandler) CreateSessaoWhatsApp(c *gin.Context) {
-	userID := c.GetString("user_id")
-
-	var req struct {
-		NomeSessao string `json:"nomeSessao" binding:"required"`
-		Status     string `json:"status"`
-		Ativo      bool   `json:"ativo"`
-	}
+// sessaoWhatsAppRequest campos editáveis de uma sessão
+type sessaoWhatsAppRequest struct {
+	NomeSessao         *string   `json:"nomeSessao"`
+	Status             *string   `json:"status"`
+	Ativo              *bool     `json:"ativo"`
+	Rotulo             *string   `json:"rotulo"`
+	Cor                *string   `json:"cor"`
+	FilaPadraoID       *string   `json:"filaPadraoId"`
+	Padrao             *bool     `json:"padrao"`
+	UsuariosPermitidos *[]string `json:"usuariosPermitidos"` // vazio libera a sessão para toda a organização
+}
 
+// CreateSessaoWhatsApp cria uma nova sessão WhatsApp na organização
+func (h *SessoesWhatsAppHandler) CreateSessaoWhatsApp(c *gin.Context) {
+	var req sessaoWhatsAppRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Se esta sessão vai ser ativa, desativar outras
-	if req.Ativo {
-		h.db.Model(&models.SessaoWhatsApp{}).Where("usuario_id = ?", userID).Update("ativo", false)
+	if req.NomeSessao == nil || *req.NomeSessao == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nomeSessao é obrigatório"})
+		return
+	}
+	nomeSessao, err := repositories.NomeSessaoOrganizacao(c.GetString("organizacao_id"), *req.NomeSessao)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	sessao := models.SessaoWhatsApp{
-		UsuarioID:  userID,
-		NomeSessao: req.NomeSessao,
-		Status:     models.StatusSessao(req.Status),
-		Ativo:      req.Ativo,
+		UsuarioID:     c.GetString("user_id"),
+		OrganizacaoID: c.GetString("organizacao_id"),
+		NomeSessao:    nomeSessao,
+		Status:        models.StatusSessaoDesconectado,
+		Ativo:         true,
+	}
+	if req.Status != nil && *req.Status != "" {
+		sessao.Status = models.StatusSessao(*req.Status)
+	}
+	if req.Ativo != nil {
+		sessao.Ativo = *req.Ativo
 	}
 
-	if err := h.db.Create(&sessao).Error; err != nil {
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sessao).Error; err != nil {
+			return err
+		}
+		return h.aplicarConfiguracao(tx, &sessao, &req)
+	})
+	if errors.Is(err, errSessaoInvalida) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar sessão WhatsApp"})
 		return
 	}
 
+	h.db.Preload("UsuariosPermitidos").First(&sessao, "id = ?", sessao.ID)
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "sessao_whatsapp", sessao.ID, nil, sessao)
+
 	c.JSON(http.StatusCreated, sessao)
 }
 
 // UpdateSessaoWhatsApp atualiza uma sessão WhatsApp
 func (h *SessoesWhatsAppHandler) UpdateSessaoWhatsApp(c *gin.Context) {
-	userID := c.GetString("user_id")
-	sessaoID := c.Param("id")
-
-	var req struct {
-		NomeSessao *string `json:"nomeSessao"`
-		Status     *string `json:"status"`
-		Ativo      *bool   `json:"ativo"`
-	}
-
+	var req sessaoWhatsAppRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Verificar se a sessão existe e pertence ao usuário
-	var sessao models.SessaoWhatsApp
-	if err := h.db.Where("id = ? AND usuario_id = ?", sessaoID, userID).First(&sessao).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Sessão WhatsApp não encontrada"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão WhatsApp"})
+	sessao, ok := h.buscarSessao(c)
+	if !ok {
 		return
 	}
-
-	// Se esta sessão vai ser ativa, desativar outras
-	if req.Ativo != nil && *req.Ativo {
-		h.db.Model(&models.SessaoWhatsApp{}).Where("usuario_id = ? AND id != ?", userID, sessaoID).Update("ativo", false)
-	}
+	antes := *sessao
 
 	// Preparar dados para atualização
 	updates := make(map[string]interface{})
-	if req.NomeSessao != nil {
-		updates["nome_sessao"] = *req.NomeSessao
+	if req.NomeSessao != nil && *req.NomeSessao != sessao.NomeSessao {
+		nomeSessao, err := repositories.NomeSessaoOrganizacao(sessao.OrganizacaoID, *req.NomeSessao)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["nome_sessao"] = nomeSessao
 	}
 	if req.Status != nil {
 		updates["status"] = *req.Status
@@ -126,39 +148,53 @@ func (h *SessoesWhatsAppHandler) UpdateSessaoWhatsApp(c *gin.Context) {
 		updates["ativo"] = *req.Ativo
 	}
 
-	if err := h.db.Model(&sessao).Updates(updates).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(sessao).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return h.aplicarConfiguracao(tx, sessao, &req)
+	})
+	if errors.Is(err, errSessaoInvalida) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar sessão WhatsApp"})
 		return
 	}
 
 	// Buscar sessão atualizada
-	if err := h.db.Where("id = ?", sessaoID).First(&sessao).Error; err != nil {
+	if err := h.db.Preload("UsuariosPermitidos").Where("id = ?", sessao.ID).First(sessao).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão atualizada"})
 		return
 	}
 
+	acao := models.AcaoAuditoriaAtualizar
+	if antes.Status != sessao.Status {
+		switch sessao.Status {
+		case models.StatusSessaoConectado:
+			acao = models.AcaoAuditoriaConectar
+		case models.StatusSessaoDesconectado:
+			acao = models.AcaoAuditoriaDesconectar
+		}
+	}
+	h.auditoria.Registrar(atorAuditoria(c), acao, "sessao_whatsapp", sessao.ID, antes, sessao)
+
 	c.JSON(http.StatusOK, sessao)
 }
 
 // DeleteSessaoWhatsApp remove uma sessão WhatsApp
 func (h *SessoesWhatsAppHandler) DeleteSessaoWhatsApp(c *gin.Context) {
-	userID := c.GetString("user_id")
-	sessaoID := c.Param("id")
-
-	// Verificar se a sessão existe e pertence ao usuário
-	var sessao models.SessaoWhatsApp
-	if err := h.db.Where("id = ? AND usuario_id = ?", sessaoID, userID).First(&sessao).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Sessão WhatsApp não encontrada"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão WhatsApp"})
+	sessao, ok := h.buscarSessao(c)
+	if !ok {
 		return
 	}
 
 	// Verificar se existem contatos usando esta sessão
 	var contatosCount int64
-	if err := h.db.Model(&models.Contato{}).Where("sessao_whatsapp_id = ?", sessaoID).Count(&contatosCount).Error; err != nil {
+	if err := h.db.Model(&models.Contato{}).Where("sessao_whatsapp_id = ?", sessao.ID).Count(&contatosCount).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar contatos"})
 		return
 	}
@@ -168,10 +204,178 @@ func (h *SessoesWhatsAppHandler) DeleteSessaoWhatsApp(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Delete(&sessao).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sessao_whatsapp_id = ?", sessao.ID).Delete(&models.SessaoWhatsAppUsuario{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sessao_whatsapp_id = ?", sessao.ID).Delete(&models.EventoSessaoWhatsApp{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(sessao).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao deletar sessão WhatsApp"})
 		return
 	}
 
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "sessao_whatsapp", sessao.ID, sessao, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Sessão WhatsApp deletada com sucesso"})
 }
+
+// ListarSaudeSessoes uptime, quedas e flaps de todas as sessões da organização
+// nas últimas ?horas= (padrão 24, máximo 720)
+func (h *SessoesWhatsAppHandler) ListarSaudeSessoes(c *gin.Context) {
+	desde, ok := periodoSaude(c)
+	if !ok {
+		return
+	}
+
+	var sessoes []models.SessaoWhatsApp
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Order("padrao DESC, criado_em ASC").
+		Find(&sessoes).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessões WhatsApp"})
+		return
+	}
+
+	saudes := make([]*services.SaudeSessao, 0, len(sessoes))
+	for i := range sessoes {
+		saude, err := h.supervisor.Saude(&sessoes[i], desde, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao calcular saúde das sessões"})
+			return
+		}
+		saudes = append(saudes, saude)
+	}
+
+	c.JSON(http.StatusOK, saudes)
+}
+
+// ObterSaudeSessao uptime, quedas, flaps e histórico de eventos de uma sessão
+func (h *SessoesWhatsAppHandler) ObterSaudeSessao(c *gin.Context) {
+	desde, ok := periodoSaude(c)
+	if !ok {
+		return
+	}
+	sessao, ok := h.buscarSessao(c)
+	if !ok {
+		return
+	}
+
+	saude, err := h.supervisor.Saude(sessao, desde, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao calcular saúde da sessão"})
+		return
+	}
+
+	c.JSON(http.StatusOK, saude)
+}
+
+// ObterFilaEnvio - GET /api/sessoes-whatsapp/:id/fila-envio
+// Mensagens aguardando na fila de envio da sessão, por prioridade, e limites
+func (h *SessoesWhatsAppHandler) ObterFilaEnvio(c *gin.Context) {
+	sessao, ok := h.buscarSessao(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.agendador.Situacao(sessao.NomeSessao))
+}
+
+// periodoSaude início do período de ?horas= atrás
+func periodoSaude(c *gin.Context) (time.Time, bool) {
+	horas := 24
+	if valor := c.Query("horas"); valor != "" {
+		n, err := strconv.Atoi(valor)
+		if err != nil || n < 1 || n > 720 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "horas deve estar entre 1 e 720"})
+			return time.Time{}, false
+		}
+		horas = n
+	}
+	return time.Now().Add(-time.Duration(horas) * time.Hour), true
+}
+
+// buscarSessao carrega a sessão do parâmetro :id dentro da organização
+func (h *SessoesWhatsAppHandler) buscarSessao(c *gin.Context) (*models.SessaoWhatsApp, bool) {
+	var sessao models.SessaoWhatsApp
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Preload("UsuariosPermitidos").
+		Preload("FilaPadrao").
+		Where("id = ?", c.Param("id")).
+		First(&sessao).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sessão WhatsApp não encontrada"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar sessão WhatsApp"})
+		return nil, false
+	}
+	return &sessao, true
+}
+
+// aplicarConfiguracao grava rótulo, cor, fila padrão, sessão padrão e
+// usuários permitidos. Apenas uma sessão da organização pode ser a padrão.
+func (h *SessoesWhatsAppHandler) aplicarConfiguracao(tx *gorm.DB, sessao *models.SessaoWhatsApp, req *sessaoWhatsAppRequest) error {
+	updates := make(map[string]interface{})
+	if req.Rotulo != nil {
+		updates["rotulo"] = *req.Rotulo
+	}
+	if req.Cor != nil {
+		updates["cor"] = *req.Cor
+	}
+	if req.FilaPadraoID != nil {
+		if *req.FilaPadraoID == "" {
+			updates["fila_padrao_id"] = nil
+		} else {
+			var total int64
+			tx.Model(&models.Fila{}).Scopes(repositories.PorOrganizacao(sessao.OrganizacaoID)).Where("id = ?", *req.FilaPadraoID).Count(&total)
+			if total == 0 {
+				return errSessaoInvalida
+			}
+			updates["fila_padrao_id"] = *req.FilaPadraoID
+		}
+	}
+	if req.Padrao != nil {
+		if *req.Padrao {
+			err := tx.Model(&models.SessaoWhatsApp{}).
+				Scopes(repositories.PorOrganizacao(sessao.OrganizacaoID)).
+				Where("id <> ? AND padrao = ?", sessao.ID, true).
+				Update("padrao", false).Error
+			if err != nil {
+				return err
+			}
+		}
+		updates["padrao"] = *req.Padrao
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(sessao).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if req.UsuariosPermitidos == nil {
+		return nil
+	}
+	usuarios := *req.UsuariosPermitidos
+	if len(usuarios) > 0 {
+		var total int64
+		tx.Model(&models.Usuario{}).Where("id IN ? AND organizacao_id = ?", usuarios, sessao.OrganizacaoID).Count(&total)
+		if int(total) != len(usuarios) {
+			return errSessaoInvalida
+		}
+	}
+	if err := tx.Where("sessao_whatsapp_id = ?", sessao.ID).Delete(&models.SessaoWhatsAppUsuario{}).Error; err != nil {
+		return err
+	}
+	for _, usuarioID := range usuarios {
+		permitido := models.SessaoWhatsAppUsuario{SessaoWhatsAppID: sessao.ID, UsuarioID: usuarioID}
+		if err := tx.Create(&permitido).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+	"tappyone/internal/services"
+)
+
+// SLAHandler gerencia políticas de SLA e o histórico de violações
+type SLAHandler struct {
+	db         *gorm.DB
+	slaService *services.SLAService
+}
+
+// NewSLAHandler cria um novo handler de SLA
+func NewSLAHandler(db *gorm.DB, slaService *services.SLAService) *SLAHandler {
+	return &SLAHandler{
+		db:         db,
+		slaService: slaService,
+	}
+}
+
+// ListarPoliticas - GET /api/sla/politicas
+func (h *SLAHandler) ListarPoliticas(c *gin.Context) {
+	var politicas []models.PoliticaSLA
+
+	query := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Preload("Tag").Order("prioridade DESC, nome ASC")
+	if filaID := c.Query("filaId"); filaID != "" {
+		query = query.Where("fila_id = ?", filaID)
+	}
+	if tagID := c.Query("tagId"); tagID != "" {
+		query = query.Where("tag_id = ?", tagID)
+	}
+
+	if err := query.Find(&politicas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar políticas de SLA",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    politicas,
+	})
+}
+
+// ObterPolitica - GET /api/sla/politicas/:id
+func (h *SLAHandler) ObterPolitica(c *gin.Context) {
+	var politica models.PoliticaSLA
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).
+		Preload("Tag").First(&politica, "id = ?", c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Política de SLA não encontrada",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    politica,
+	})
+}
+
+// CriarPolitica - POST /api/sla/politicas
+func (h *SLAHandler) CriarPolitica(c *gin.Context) {
+	var politica models.PoliticaSLA
+	if err := c.ShouldBindJSON(&politica); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	politica.OrganizacaoID = c.GetString("organizacao_id")
+	if msg := h.validarPoliticaSLA(&politica); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   msg,
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if userID != "" {
+		politica.CriadoPor = &userID
+	}
+
+	if err := h.db.Create(&politica).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao criar política de SLA",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    politica,
+		"message": "Política de SLA criada com sucesso",
+	})
+}
+
+// AtualizarPolitica - PUT /api/sla/politicas/:id
+func (h *SLAHandler) AtualizarPolitica(c *gin.Context) {
+	id := c.Param("id")
+
+	var politica models.PoliticaSLA
+	err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).First(&politica, "id = ?", id).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Política de SLA não encontrada",
+		})
+		return
+	}
+
+	var dados models.PoliticaSLA
+	if err := c.ShouldBindJSON(&dados); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	dados.BaseModel = politica.BaseModel
+	dados.CriadoPor = politica.CriadoPor
+	dados.OrganizacaoID = politica.OrganizacaoID
+	if msg := h.validarPoliticaSLA(&dados); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   msg,
+		})
+		return
+	}
+
+	if err := h.db.Model(&politica).Select("*").Omit("id", "organizacao_id", "criado_em", "criado_por").Updates(&dados).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao atualizar política de SLA",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dados,
+		"message": "Política de SLA atualizada com sucesso",
+	})
+}
+
+// DeletarPolitica - DELETE /api/sla/politicas/:id
+func (h *SLAHandler) DeletarPolitica(c *gin.Context) {
+	id := c.Param("id")
+	escopo := repositories.PorOrganizacao(c.GetString("organizacao_id"))
+
+	// Política com histórico é apenas desativada para preservar os eventos
+	var eventos int64
+	h.db.Model(&models.EventoSLA{}).Scopes(escopo).Where("politica_sla_id = ?", id).Count(&eventos)
+
+	var result *gorm.DB
+	if eventos > 0 {
+		result = h.db.Model(&models.PoliticaSLA{}).Scopes(escopo).Where("id = ?", id).Update("ativo", false)
+	} else {
+		result = h.db.Scopes(escopo).Delete(&models.PoliticaSLA{}, "id = ?", id)
+	}
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao deletar política de SLA",
+			"details": result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Política de SLA não encontrada",
+		})
+		return
+	}
+
+	message := "Política de SLA deletada com sucesso"
+	if eventos > 0 {
+		message = "Política de SLA desativada (possui histórico de eventos)"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+	})
+}
+
+// ListarEventos - GET /api/sla/eventos
+func (h *SLAHandler) ListarEventos(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	filtro := services.FiltroEventosSLA{
+		OrganizacaoID: c.GetString("organizacao_id"),
+		Estado:        c.Query("estado"),
+		TipoPrazo:     c.Query("tipoPrazo"),
+		PoliticaSLAID: c.Query("politicaId"),
+		AgenteID:      c.Query("agenteId"),
+		FilaID:        c.Query("filaId"),
+		AtendimentoID: c.Query("atendimentoId"),
+		Desde:         parseDataQuery(c, "desde"),
+		Ate:           parseDataQuery(c, "ate"),
+		Page:          page,
+		Limit:         limit,
+	}
+
+	eventos, total, err := h.slaService.ListarEventos(filtro)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar histórico de SLA",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    eventos,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// ObterResumo - GET /api/sla/resumo
+func (h *SLAHandler) ObterResumo(c *gin.Context) {
+	resumo, err := h.slaService.ObterResumo(c.GetString("organizacao_id"), parseDataQuery(c, "desde"), parseDataQuery(c, "ate"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao calcular resumo de SLA",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    resumo,
+	})
+}
+
+// AvaliarAgora - POST /api/sla/avaliar
+func (h *SLAHandler) AvaliarAgora(c *gin.Context) {
+	if err := h.slaService.AvaliarAtendimentos(c.GetString("organizacao_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao avaliar SLA",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Avaliação de SLA executada",
+	})
+}
+
+func (h *SLAHandler) validarPoliticaSLA(politica *models.PoliticaSLA) string {
+	if politica.Nome == "" {
+		return "Nome da política é obrigatório"
+	}
+	if (politica.FilaID == nil || *politica.FilaID == "") && (politica.TagID == nil || *politica.TagID == "") {
+		return "Informe uma fila ou uma tag para a política"
+	}
+	if politica.PrimeiraRespostaMinutos <= 0 || politica.ResolucaoMinutos <= 0 {
+		return "Prazos de primeira resposta e resolução devem ser maiores que zero"
+	}
+	if politica.AvisoPercentual <= 0 || politica.AvisoPercentual >= 100 {
+		politica.AvisoPercentual = 80
+	}
+	if politica.EscalonarReatribuir && politica.ReatribuirParaID == nil {
+		return "Informe o usuário para reatribuição"
+	}
+	if politica.EscalonarNotificar && politica.SupervisorID == nil {
+		return "Informe o supervisor a ser notificado"
+	}
+
+	// Fila, tag e usuários referenciados precisam ser da mesma organização
+	referencias := []struct {
+		modelo interface{}
+		id     *string
+		erro   string
+	}{
+		{&models.Fila{}, politica.FilaID, "Fila não encontrada"},
+		{&models.Tag{}, politica.TagID, "Tag não encontrada"},
+		{&models.Usuario{}, politica.ReatribuirParaID, "Usuário para reatribuição não encontrado"},
+		{&models.Usuario{}, politica.SupervisorID, "Supervisor não encontrado"},
+	}
+	for _, ref := range referencias {
+		if ref.id == nil || *ref.id == "" {
+			continue
+		}
+		var total int64
+		h.db.Model(ref.modelo).Scopes(repositories.PorOrganizacao(politica.OrganizacaoID)).Where("id = ?", *ref.id).Count(&total)
+		if total == 0 {
+			return ref.erro
+		}
+	}
+	return ""
+}
+
+// parseDataQuery aceita datas no formato RFC3339 ou YYYY-MM-DD
+func parseDataQuery(c *gin.Context, chave string) *time.Time {
+	valor := c.Query(chave)
+	if valor == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, valor); err == nil {
+		return &t
+	}
+	if t, err := time.Parse("2006-01-02", valor); err == nil {
+		return &t
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 	"tappyone/internal/services"
 )
 
@@ -26,8 +27,8 @@ func NewTagsHandler(db *gorm.DB, authSvc *services.AuthService) *TagsHandler {
 func (h *TagsHandler) ListarTags(c *gin.Context) {
 	var tags []models.Tag
 
-	// Buscar todas as tags ordenadas por nome
-	if err := h.db.Order("nome ASC").Find(&tags).Error; err != nil {
+	// Buscar todas as tags da organização ordenadas por nome
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).Order("nome ASC").Find(&tags).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Erro ao buscar tags",
@@ -64,9 +65,15 @@ func (h *TagsHandler) CriarTag(c *gin.Context) {
 		return
 	}
 
+	// O nome é único dentro da organização
+	tag.OrganizacaoID = c.GetString("organizacao_id")
+	if tag.CriadoPor == "" {
+		tag.CriadoPor = c.GetString("user_id")
+	}
+
 	// Verificar se tag já existe
 	var existeTag models.Tag
-	if err := h.db.Where("nome = ?", tag.Nome).First(&existeTag).Error; err == nil {
+	if err := h.db.Scopes(repositories.PorOrganizacao(tag.OrganizacaoID)).Where("nome = ?", tag.Nome).First(&existeTag).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"success": false,
 			"error":   "Tag com este nome já existe",
@@ -97,7 +104,7 @@ func (h *TagsHandler) AtualizarTag(c *gin.Context) {
 	var tag models.Tag
 
 	// Buscar tag existente
-	if err := h.db.First(&tag, "id = ?", id).Error; err != nil {
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).First(&tag, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error":   "Tag não encontrada",
@@ -118,7 +125,7 @@ func (h *TagsHandler) AtualizarTag(c *gin.Context) {
 	// Verificar se novo nome já existe (apenas se nome foi alterado)
 	if dadosAtualizacao.Nome != "" && dadosAtualizacao.Nome != tag.Nome {
 		var existeTag models.Tag
-		if err := h.db.Where("nome = ? AND id != ?", dadosAtualizacao.Nome, id).First(&existeTag).Error; err == nil {
+		if err := h.db.Scopes(repositories.PorOrganizacao(tag.OrganizacaoID)).Where("nome = ? AND id != ?", dadosAtualizacao.Nome, id).First(&existeTag).Error; err == nil {
 			c.JSON(http.StatusConflict, gin.H{
 				"success": false,
 				"error":   "Tag com este nome já existe",
@@ -161,7 +168,7 @@ func (h *TagsHandler) DeletarTag(c *gin.Context) {
 	var tag models.Tag
 
 	// Buscar tag existente
-	if err := h.db.First(&tag, "id = ?", id).Error; err != nil {
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).First(&tag, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error":   "Tag não encontrada",
@@ -206,7 +213,7 @@ func (h *TagsHandler) ObterTag(c *gin.Context) {
 	id := c.Param("id")
 	var tag models.Tag
 
-	if err := h.db.First(&tag, "id = ?", id).Error; err != nil {
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).First(&tag, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error":   "Tag não encontrada",
@@ -224,7 +231,7 @@ func (h *TagsHandler) ObterTag(c *gin.Context) {
 func (h *TagsHandler) ListarTagsFavoritas(c *gin.Context) {
 	var tags []models.Tag
 
-	if err := h.db.Where("favorito = ?", true).Order("nome ASC").Find(&tags).Error; err != nil {
+	if err := h.db.Scopes(repositories.PorOrganizacao(c.GetString("organizacao_id"))).Where("favorito = ?", true).Order("nome ASC").Find(&tags).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Erro ao buscar tags favoritas",
@@ -269,9 +276,10 @@ func (h *TagsHandler) ListarTagsPopulares(c *gin.Context) {
 			FROM quadro_tags 
 			GROUP BY tag_id
 		) qt ON t.id = qt.tag_id
+		WHERE `+repositories.CondicaoOrganizacao("t")+`
 		ORDER BY total_usos DESC, t.nome ASC
 		LIMIT ?
-	`, limit).Scan(&tagsComUso).Error; err != nil {
+	`, c.GetString("organizacao_id"), limit).Scan(&tagsComUso).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Erro ao buscar tags populares",
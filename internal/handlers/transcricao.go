@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+	"tappyone/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TranscricaoHandler configuração da transcrição de áudio da organização e
+// pedidos manuais de transcrição
+type TranscricaoHandler struct {
+	transcricao  *services.TranscricaoService
+	organizacoes *services.OrganizacaoService
+	whatsapp     *services.WhatsAppService
+	auditoria    *services.AuditoriaService
+}
+
+func NewTranscricaoHandler(transcricao *services.TranscricaoService, organizacoes *services.OrganizacaoService, whatsapp *services.WhatsAppService, auditoria *services.AuditoriaService) *TranscricaoHandler {
+	return &TranscricaoHandler{transcricao: transcricao, organizacoes: organizacoes, whatsapp: whatsapp, auditoria: auditoria}
+}
+
+// ObterConfiguracao - GET /api/organizacao/transcricao
+func (h *TranscricaoHandler) ObterConfiguracao(c *gin.Context) {
+	organizacao, err := h.organizacoes.Obter(c.GetString("organizacao_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organização não encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ativa":       organizacao.TranscricaoAudioAtiva,
+		"idioma":      organizacao.IdiomaTranscricao,
+		"provedor":    h.transcricao.Provedor(),
+		"configurado": h.transcricao.Configurado(),
+	})
+}
+
+// DefinirConfiguracao - PUT /api/organizacao/transcricao
+// Liga a transcrição automática das mensagens de voz; idioma vazio detecta
+func (h *TranscricaoHandler) DefinirConfiguracao(c *gin.Context) {
+	var req struct {
+		Ativa  *bool  `json:"ativa" binding:"required"`
+		Idioma string `json:"idioma"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos", "details": err.Error()})
+		return
+	}
+	if len(req.Idioma) > 8 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idioma inválido; use o código ISO 639-1 (ex: pt)"})
+		return
+	}
+
+	organizacaoID := c.GetString("organizacao_id")
+	antes, _ := h.organizacoes.Obter(organizacaoID)
+
+	organizacao, err := h.transcricao.DefinirOrganizacao(organizacaoID, *req.Ativa, req.Idioma)
+	if err != nil {
+		if errors.Is(err, services.ErrTranscricaoDesativada) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[TRANSCRICAO] Erro ao salvar configuração: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar configuração de transcrição"})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "organizacao", organizacaoID, antes, organizacao)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ativa":       organizacao.TranscricaoAudioAtiva,
+		"idioma":      organizacao.IdiomaTranscricao,
+		"provedor":    h.transcricao.Provedor(),
+		"configurado": h.transcricao.Configurado(),
+	})
+}
+
+// TranscreverMensagem - POST /api/whatsapp/chats/:chatId/messages/:messageId/transcricao
+// Envia o áudio para a fila mesmo com a transcrição automática desligada (ou
+// para refazer uma transcrição)
+func (h *TranscricaoHandler) TranscreverMensagem(c *gin.Context) {
+	chatID := c.Param("chatId")
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsapp, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
+	mensagem, err := h.transcricao.BuscarMensagem(sessionName, chatID, c.Param("messageId"))
+	if err != nil {
+		if errors.Is(err, services.ErrMensagemNaoEncontrada) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mensagem não encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar mensagem"})
+		return
+	}
+
+	if err := h.transcricao.Transcrever(mensagem); err != nil {
+		switch {
+		case errors.Is(err, services.ErrTranscricaoDesativada):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMensagemSemAudio):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("[TRANSCRICAO] Erro ao enfileirar mensagem %s: %v", mensagem.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enfileirar transcrição"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Áudio enviado para transcrição"})
+}
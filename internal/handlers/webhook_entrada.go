@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// WebhookEntradaHandler recebe os webhooks do WAHA e expõe os eventos com falha
+type WebhookEntradaHandler struct {
+	ingestao  *services.IngestaoWebhookService
+	auditoria *services.AuditoriaService
+}
+
+// NewWebhookEntradaHandler cria um novo handler de webhooks recebidos
+func NewWebhookEntradaHandler(ingestao *services.IngestaoWebhookService, auditoria *services.AuditoriaService) *WebhookEntradaHandler {
+	return &WebhookEntradaHandler{
+		ingestao:  ingestao,
+		auditoria: auditoria,
+	}
+}
+
+// Receber enfileira o evento da origem e responde imediatamente. Eventos
+// duplicados também recebem 200 para que o WAHA não os reenvie.
+func (h *WebhookEntradaHandler) Receber(origem string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		corpo, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var excedido *http.MaxBytesError
+			if errors.As(err, &excedido) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payload excede o tamanho máximo"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payload inválido"})
+			return
+		}
+
+		err = h.ingestao.Receber(origem, corpo)
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, gin.H{"message": "Evento recebido"})
+		case errors.Is(err, services.ErrEventoWebhookDuplicado):
+			c.JSON(http.StatusOK, gin.H{"message": "Evento duplicado ignorado"})
+		case errors.Is(err, services.ErrFilaWebhookCheia):
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// ListarFalhas - GET /api/webhooks/entrada/falhas
+func (h *WebhookEntradaHandler) ListarFalhas(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	falhas, total, err := h.ingestao.ListarFalhas(c.GetString("organizacao_id"), services.FiltroFalhasWebhook{
+		Origem: c.Query("origem"),
+		Status: c.DefaultQuery("status", models.StatusFalhaWebhookPendente),
+		Evento: c.Query("evento"),
+		Page:   page,
+		Limit:  limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar eventos com falha",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    falhas,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// ReprocessarFalha - POST /api/webhooks/entrada/falhas/:id/reprocessar
+func (h *WebhookEntradaHandler) ReprocessarFalha(c *gin.Context) {
+	falha, err := h.ingestao.Reprocessar(c.GetString("organizacao_id"), c.Param("id"), c.GetString("user_id"))
+	if falha == nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Evento não encontrado ou já reprocessado",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao reprocessar evento",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "evento_webhook_falho", falha.ID, nil, gin.H{"status": falha.Status})
+
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"error":   "O evento falhou novamente",
+			"details": err.Error(),
+			"data":    falha,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    falha,
+		"message": "Evento reprocessado com sucesso",
+	})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+)
+
+// WebhooksHandler gerencia os webhooks de saída da organização
+type WebhooksHandler struct {
+	webhookService *services.WebhookService
+	auditoria      *services.AuditoriaService
+}
+
+// NewWebhooksHandler cria um novo handler de webhooks de saída
+func NewWebhooksHandler(webhookService *services.WebhookService, auditoria *services.AuditoriaService) *WebhooksHandler {
+	return &WebhooksHandler{
+		webhookService: webhookService,
+		auditoria:      auditoria,
+	}
+}
+
+// ListarEventos - GET /api/webhooks/eventos
+func (h *WebhooksHandler) ListarEventos(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    models.EventosWebhook,
+	})
+}
+
+// ListarWebhooks - GET /api/webhooks
+func (h *WebhooksHandler) ListarWebhooks(c *gin.Context) {
+	webhooks, err := h.webhookService.Listar(c.GetString("organizacao_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar webhooks",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    webhooks,
+	})
+}
+
+// CriarWebhook - POST /api/webhooks
+// O segredo de assinatura é retornado apenas nesta resposta
+func (h *WebhooksHandler) CriarWebhook(c *gin.Context) {
+	var req services.NovoWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	webhook, segredo, err := h.webhookService.Criar(c.GetString("organizacao_id"), c.GetString("user_id"), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaCriar, "webhook", webhook.ID, nil, webhook)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"segredo": segredo,
+			"webhook": webhook,
+		},
+		"message": "Webhook criado. Copie o segredo agora: ele não será exibido novamente.",
+	})
+}
+
+// AtualizarWebhook - PUT /api/webhooks/:id
+func (h *WebhooksHandler) AtualizarWebhook(c *gin.Context) {
+	var req services.AtualizarWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Dados inválidos",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	organizacaoID := c.GetString("organizacao_id")
+	antes, err := h.webhookService.Buscar(organizacaoID, c.Param("id"))
+	if err != nil {
+		respostaErroWebhook(c, err, "Erro ao buscar webhook")
+		return
+	}
+
+	webhook, err := h.webhookService.Atualizar(organizacaoID, c.Param("id"), req)
+	if err != nil {
+		respostaErroWebhook(c, err, "Erro ao atualizar webhook")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "webhook", webhook.ID, antes, webhook)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    webhook,
+	})
+}
+
+// ExcluirWebhook - DELETE /api/webhooks/:id
+func (h *WebhooksHandler) ExcluirWebhook(c *gin.Context) {
+	organizacaoID := c.GetString("organizacao_id")
+	antes, err := h.webhookService.Buscar(organizacaoID, c.Param("id"))
+	if err != nil {
+		respostaErroWebhook(c, err, "Erro ao buscar webhook")
+		return
+	}
+
+	if err := h.webhookService.Excluir(organizacaoID, c.Param("id")); err != nil {
+		respostaErroWebhook(c, err, "Erro ao excluir webhook")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaExcluir, "webhook", antes.ID, antes, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook excluído com sucesso",
+	})
+}
+
+// RotacionarSegredo - POST /api/webhooks/:id/segredo
+func (h *WebhooksHandler) RotacionarSegredo(c *gin.Context) {
+	segredo, err := h.webhookService.RotacionarSegredo(c.GetString("organizacao_id"), c.Param("id"))
+	if err != nil {
+		respostaErroWebhook(c, err, "Erro ao gerar novo segredo")
+		return
+	}
+
+	h.auditoria.Registrar(atorAuditoria(c), models.AcaoAuditoriaAtualizar, "webhook", c.Param("id"), nil, gin.H{"segredo": "rotacionado"})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"segredo": segredo},
+		"message": "Novo segredo gerado. O anterior deixa de valer imediatamente.",
+	})
+}
+
+// TestarWebhook - POST /api/webhooks/:id/teste
+func (h *WebhooksHandler) TestarWebhook(c *gin.Context) {
+	entrega, err := h.webhookService.Testar(c.GetString("organizacao_id"), c.Param("id"))
+	if err != nil {
+		respostaErroWebhook(c, err, "Erro ao testar webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": entrega.Status == models.StatusEntregaEntregue,
+		"data":    entrega,
+	})
+}
+
+// ListarEntregas - GET /api/webhooks/entregas
+func (h *WebhooksHandler) ListarEntregas(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	filtro := services.FiltroEntregasWebhook{
+		WebhookID: c.Query("webhookId"),
+		Status:    c.Query("status"),
+		Evento:    c.Query("evento"),
+		Page:      page,
+		Limit:     limit,
+	}
+	if id := c.Param("id"); id != "" {
+		filtro.WebhookID = id
+	}
+
+	entregas, total, err := h.webhookService.ListarEntregas(c.GetString("organizacao_id"), filtro)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Erro ao buscar entregas",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entregas,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// ReenviarEntrega - POST /api/webhooks/entregas/:entregaId/reenviar
+func (h *WebhooksHandler) ReenviarEntrega(c *gin.Context) {
+	entrega, err := h.webhookService.Reenviar(c.GetString("organizacao_id"), c.Param("entregaId"))
+	if err != nil {
+		respostaErroWebhook(c, err, "Erro ao reenviar entrega")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    entrega,
+		"message": "Entrega colocada na fila",
+	})
+}
+
+func respostaErroWebhook(c *gin.Context, err error, mensagem string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Webhook não encontrado",
+		})
+	case errors.Is(err, services.ErrWebhookURLInvalida),
+		errors.Is(err, services.ErrWebhookDestinoInterno),
+		errors.Is(err, services.ErrWebhookEventoInvalido),
+		errors.Is(err, services.ErrWebhookInativo):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   mensagem,
+			"details": err.Error(),
+		})
+	}
+}
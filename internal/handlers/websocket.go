@@ -1,28 +1,75 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
 	"tappyone/internal/utils"
 )
 
+// WebSocket event protocol
+//
+// Every frame is a JSON envelope: {"type", "data", "seq", "topic", "user_id", "timestamp"}.
+// Events published by the server carry a monotonically increasing "seq" shared by
+// all replicas; direct replies (pong, acks, errors) have no seq.
+//
+// Client -> server:
+//   ping                                   -> pong
+//   subscribe   {"topic": "chat:<id>"}     -> subscribed   {"topic"}
+//   unsubscribe {"topic": "board:<id>"}    -> unsubscribed {"topic"}
+//   typing      {"chatId", "typing": bool} -> relayed to WAHA StartTyping/StopTyping
+//                                             and to subscribers of chat:<chatId>
+//   resume      {"since": <seq>}           -> missed events for the user, the subscribed
+//                                             topics and broadcasts, then resumed {"lastSeq"};
+//                                             resync_required when history is incomplete
+//   reauth      {"token": "<jwt>"}         -> reauthenticated {"expiresAt"}; extends the
+//                                             connection past the current token expiry
+//
+// Authentication (in order of preference):
+//   1. ?ticket=<ticket> obtained from POST /api/ws/ticket (single use, 30s)
+//   2. Sec-WebSocket-Protocol: bearer, <jwt>  (server answers with "bearer")
+//   3. ?token=<jwt> (deprecated)
+// The connection is closed with code 4001 when the token expires without reauth.
+//
+// Topics: chat:<chatId>, board:<quadroId>, queue:<filaId>. Subscribe to topics
+// before sending resume so their history is included.
+//
+// Server -> client events: connection, new_message, message_status, typing,
+// presence, error, plus any event published through services.RealtimeService.
+
 // WebSocket upgrader
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from any origin in development
-		// In production, you should check the origin
-		return true
+		return wsHub != nil && wsHub.originAllowed(r.Header.Get("Origin"))
 	},
+	Subprotocols:    []string{wsBearerProtocol},
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 }
 
+const (
+	// Subprotocol used to carry the JWT: Sec-WebSocket-Protocol: bearer, <jwt>
+	wsBearerProtocol = "bearer"
+
+	// Close code sent when the token expires
+	wsCloseTokenExpired = 4001
+
+	// How often writePump checks the token expiry
+	wsExpiryCheckInterval = 5 * time.Second
+)
+
 // Client represents a WebSocket client
 type Client struct {
 	ID     string
@@ -30,9 +77,32 @@ type Client struct {
 	Conn   *websocket.Conn
 	Send   chan []byte
 	Hub    *Hub
+
+	// Topics this client is subscribed to (chat, board, queue)
+	Topics map[string]bool
+
+	// Token expiry as unix nanoseconds, updated by reauth
+	expiresAt int64
+
+	// sendMu guards Send against writes after the hub closed it: replies from
+	// the readPump goroutine (resume, errors) race with unregister
+	sendMu     sync.Mutex
+	sendClosed bool
+}
+
+// closeSend closes Send once; later sendToClient calls are dropped
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.Send)
+	}
 }
 
-// Hub maintains the set of active clients and broadcasts messages to the clients
+// Hub maintains the set of active clients and broadcasts messages to the clients.
+// Events are published through the RealtimeService (Redis pub/sub) so every
+// replica delivers them to its own local clients.
 type Hub struct {
 	// Registered clients
 	Clients map[*Client]bool
@@ -49,17 +119,35 @@ type Hub struct {
 	// User-specific channels
 	UserChannels map[string]map[*Client]bool
 
+	// Topic subscriptions
+	Topics map[string]map[*Client]bool
+
+	// Cross-node fan-out
+	realtime *services.RealtimeService
+
+	// Typing relay to WAHA
+	whatsappService *services.WhatsAppService
+
+	// Token validation for reauth
+	authService *services.AuthService
+
+	// Topic authorization (chat/queue scope)
+	permissionService *services.PermissionService
+
+	// Limits
+	allowedOrigins  []string
+	maxConnsPerUser int
+	maxMessageSize  int64
+
+	// Metrics
+	metrics wsMetrics
+
 	// Mutex for thread safety
 	mutex sync.RWMutex
 }
 
-// Message types for WebSocket communication
-type WSMessage struct {
-	Type      string      `json:"type"`
-	Data      interface{} `json:"data"`
-	UserID    string      `json:"user_id,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
-}
+// WSMessage is the envelope sent to websocket clients
+type WSMessage = services.RealtimeMessage
 
 // Message types
 const (
@@ -71,20 +159,83 @@ const (
 	MessageTypeError         = "error"
 	MessageTypePing          = "ping"
 	MessageTypePong          = "pong"
+
+	MessageTypeSubscribe       = "subscribe"
+	MessageTypeUnsubscribe     = "unsubscribe"
+	MessageTypeSubscribed      = "subscribed"
+	MessageTypeUnsubscribed    = "unsubscribed"
+	MessageTypeResume          = "resume"
+	MessageTypeResumed         = "resumed"
+	MessageTypeResyncRequired  = "resync_required"
+	MessageTypeReauth          = "reauth"
+	MessageTypeReauthenticated = "reauthenticated"
 )
 
+// wsClientMessage is a frame received from the client; data is decoded per type
+type wsClientMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type wsTopicRequest struct {
+	Topic string `json:"topic"`
+}
+
+type wsTypingRequest struct {
+	ChatID string `json:"chatId"`
+	Typing bool   `json:"typing"`
+	Sessao string `json:"sessao,omitempty"` // opcional; padrão é a sessão da conversa
+}
+
+type wsResumeRequest struct {
+	Since int64 `json:"since"`
+}
+
+// Topic prefixes accepted from clients
+var wsTopicPrefixes = []string{
+	services.TopicChat(""),
+	services.TopicQuadro(""),
+	services.TopicFila(""),
+}
+
+// wsMetrics counts connection and traffic events since startup
+type wsMetrics struct {
+	connectionsTotal  int64
+	rejectedOrigin    int64
+	rejectedAuth      int64
+	rejectedLimit     int64
+	closedExpired     int64
+	droppedSlow       int64
+	messagesReceived  int64
+	messagesDelivered int64
+}
+
 // Global hub instance
 var wsHub *Hub
 
 // Initialize WebSocket hub
-func InitWebSocketHub() {
+func InitWebSocketHub(realtime *services.RealtimeService, whatsappService *services.WhatsAppService, permissionService *services.PermissionService, cfg *config.Config) {
 	wsHub = &Hub{
 		Clients:      make(map[*Client]bool),
 		Broadcast:    make(chan []byte),
 		Register:     make(chan *Client),
 		Unregister:   make(chan *Client),
 		UserChannels: make(map[string]map[*Client]bool),
+		Topics:       make(map[string]map[*Client]bool),
+		realtime:     realtime,
+
+		whatsappService:   whatsappService,
+		permissionService: permissionService,
+		allowedOrigins:    cfg.WSAllowedOrigins,
+		maxConnsPerUser: cfg.WSMaxConnectionsPerUser,
+		maxMessageSize:  cfg.WSMaxMessageSize,
+	}
+
+	if realtime != nil {
+		realtime.SetLocalDelivery(wsHub.deliver)
+		go realtime.Subscribe(context.Background())
 	}
+
 	go wsHub.Run()
 }
 
@@ -113,12 +264,7 @@ func (h *Hub) Run() {
 				Timestamp: time.Now(),
 			}
 			if data, err := json.Marshal(message); err == nil {
-				select {
-				case client.Send <- data:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
+				h.sendToClient(client, data)
 			}
 
 		case client := <-h.Unregister:
@@ -133,8 +279,16 @@ func (h *Hub) Run() {
 						delete(h.UserChannels, client.UserID)
 					}
 				}
+
+				// Remove from topics
+				for topic := range client.Topics {
+					h.removeFromTopic(client, topic)
+				}
 				
-				close(client.Send)
+				client.closeSend()
+				if h.realtime != nil {
+					h.realtime.RemoverConexao(client.UserID, client.ID)
+				}
 				log.Printf("Client %s disconnected for user %s", client.ID, client.UserID)
 			}
 			h.mutex.Unlock()
@@ -142,77 +296,240 @@ func (h *Hub) Run() {
 		case message := <-h.Broadcast:
 			h.mutex.RLock()
 			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
+				h.sendToClient(client, message)
 			}
 			h.mutex.RUnlock()
 		}
 	}
 }
 
-// BroadcastToUser sends a message to all connections of a specific user
-func (h *Hub) BroadcastToUser(userID string, message WSMessage) {
+// sendToClient queues data without blocking; slow clients are disconnected
+func (h *Hub) sendToClient(client *Client, data []byte) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+	if client.sendClosed {
+		return
+	}
+
+	select {
+	case client.Send <- data:
+	default:
+		atomic.AddInt64(&h.metrics.droppedSlow, 1)
+		log.Printf("[WEBSOCKET] Client %s send buffer full, disconnecting", client.ID)
+		go func() { h.Unregister <- client }()
+	}
+}
+
+// deliver sends a payload received from the realtime channel to local clients
+func (h *Hub) deliver(channel string, payload []byte) {
+	kind, target := services.ParseRealtimeChannel(channel)
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var clients map[*Client]bool
+	switch kind {
+	case "user":
+		clients = h.UserChannels[target]
+	case "topic":
+		clients = h.Topics[target]
+	case "broadcast":
+		clients = h.Clients
+	default:
+		return
+	}
+
+	for client := range clients {
+		h.sendToClient(client, payload)
+	}
+}
+
+// publish sends the message through the realtime service, or locally when unavailable
+func (h *Hub) publish(channel string, message WSMessage) {
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+
+	if h.realtime != nil {
+		if err := h.realtime.PublishMessage(channel, message); err != nil {
+			log.Printf("[WEBSOCKET] Error publishing message: %v", err)
+		}
+		return
+	}
+
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
+	h.deliver(channel, data)
+}
 
-	h.mutex.RLock()
-	userClients, exists := h.UserChannels[userID]
-	h.mutex.RUnlock()
+// BroadcastToUser sends a message to all connections of a specific user (on every node)
+func (h *Hub) BroadcastToUser(userID string, message WSMessage) {
+	message.UserID = userID
+	h.publish(services.RealtimeUserChannel(userID), message)
+}
 
-	if !exists {
+// BroadcastToTopic sends a message to all clients subscribed to a topic (on every node)
+func (h *Hub) BroadcastToTopic(topic string, message WSMessage) {
+	message.Topic = topic
+	h.publish(services.RealtimeTopicChannel(topic), message)
+}
+
+// BroadcastToAll sends a message to every connected client (on every node)
+func (h *Hub) BroadcastToAll(message WSMessage) {
+	h.publish(services.RealtimeBroadcastChannel, message)
+}
+
+// Subscribe adds the client to a topic
+func (h *Hub) Subscribe(client *Client, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.Clients[client]; !ok {
 		return
 	}
+	if h.Topics[topic] == nil {
+		h.Topics[topic] = make(map[*Client]bool)
+	}
+	h.Topics[topic][client] = true
+	client.Topics[topic] = true
+}
 
-	for client := range userClients {
-		select {
-		case client.Send <- data:
-		default:
-			close(client.Send)
-			h.mutex.Lock()
-			delete(h.Clients, client)
-			delete(userClients, client)
-			h.mutex.Unlock()
+// Unsubscribe removes the client from a topic
+func (h *Hub) Unsubscribe(client *Client, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.removeFromTopic(client, topic)
+}
+
+// removeFromTopic must be called with the mutex held
+func (h *Hub) removeFromTopic(client *Client, topic string) {
+	delete(client.Topics, topic)
+	if topicClients, exists := h.Topics[topic]; exists {
+		delete(topicClients, client)
+		if len(topicClients) == 0 {
+			delete(h.Topics, topic)
+		}
+	}
+}
+
+// originAllowed checks the Origin header against the configured allowlist.
+// Requests without Origin come from non-browser clients and are accepted.
+func (h *Hub) originAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// userConnectionCount returns the user's open connections across replicas when
+// Redis is available, otherwise on this node only
+func (h *Hub) userConnectionCount(userID string) int {
+	if h.realtime != nil {
+		if total, ok := h.realtime.ContarConexoes(userID); ok {
+			return int(total)
 		}
 	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.UserChannels[userID])
 }
 
-// NewWebSocketHandler creates a WebSocket handler with JWT auth via query param
-func NewWebSocketHandler(authService interface{}, jwtSecret string) gin.HandlerFunc {
+// wsTokenFromRequest extracts the JWT from the subprotocol header or the deprecated query param
+func wsTokenFromRequest(c *gin.Context) string {
+	protocols := websocket.Subprotocols(c.Request)
+	for i, protocol := range protocols {
+		if protocol == wsBearerProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	if token := c.Query("token"); token != "" {
+		log.Printf("[WEBSOCKET] Deprecated token query parameter used from %s", c.ClientIP())
+		return token
+	}
+	return ""
+}
+
+// NewWebSocketHandler creates a WebSocket handler authenticated by ticket or JWT
+func NewWebSocketHandler(authService *services.AuthService) gin.HandlerFunc {
+	if wsHub != nil {
+		wsHub.authService = authService
+	}
+
 	return func(c *gin.Context) {
-		log.Printf("[WEBSOCKET] New connection attempt")
-		
-		// Get token from query parameter
-		token := c.Query("token")
-		log.Printf("[WEBSOCKET] Token received: %s", token[:50]+"...")
-		
-		if token == "" {
-			log.Printf("[WEBSOCKET] No token provided")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
+		if wsHub == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket unavailable"})
 			return
 		}
 
-		log.Printf("[WEBSOCKET] JWT Secret length: %d", len(jwtSecret))
-		log.Printf("[WEBSOCKET] JWT Secret preview: %s", jwtSecret[:10]+"...")
-		
-		// Validate token and get user ID
-		userID, err := utils.ValidateJWTTokenWithSecret(token, jwtSecret)
-		if err != nil {
-			log.Printf("[WEBSOCKET] Token validation failed: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+		if !wsHub.originAllowed(c.GetHeader("Origin")) {
+			atomic.AddInt64(&wsHub.metrics.rejectedOrigin, 1)
+			log.Printf("[WEBSOCKET] Origin not allowed: %s", c.GetHeader("Origin"))
+			c.JSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
 			return
 		}
 
-		log.Printf("[WEBSOCKET] Token validated successfully for user: %s", userID)
-		
+		var userID string
+		var expiresAt time.Time
+
+		if ticket := c.Query("ticket"); ticket != "" && wsHub.realtime != nil {
+			dados, err := wsHub.realtime.ConsumirTicket(ticket)
+			if err != nil {
+				atomic.AddInt64(&wsHub.metrics.rejectedAuth, 1)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ticket"})
+				return
+			}
+			userID = dados.UserID
+			expiresAt = dados.TokenExpiraEm
+		} else {
+			token := wsTokenFromRequest(c)
+			if token == "" {
+				atomic.AddInt64(&wsHub.metrics.rejectedAuth, 1)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
+				return
+			}
+
+			claims, err := authService.ValidateAccessToken(token)
+			if err != nil {
+				atomic.AddInt64(&wsHub.metrics.rejectedAuth, 1)
+				log.Printf("[WEBSOCKET] Token validation failed: %v", err)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+			userID = claims.UserID
+			if claims.ExpiresAt != nil {
+				expiresAt = claims.ExpiresAt.Time
+			}
+		}
+
+		// Deactivated users cannot connect
+		if _, err := authService.GetUserByID(userID); err != nil {
+			atomic.AddInt64(&wsHub.metrics.rejectedAuth, 1)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found or inactive"})
+			return
+		}
+
+		if wsHub.maxConnsPerUser > 0 && wsHub.userConnectionCount(userID) >= wsHub.maxConnsPerUser {
+			atomic.AddInt64(&wsHub.metrics.rejectedLimit, 1)
+			log.Printf("[WEBSOCKET] Connection limit reached for user %s", userID)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many connections"})
+			return
+		}
+
+		log.Printf("[WEBSOCKET] Authenticated connection for user: %s", userID)
+
 		// Store user ID in context for HandleWebSocket
 		c.Set("userID", userID)
+		c.Set("tokenExpiresAt", expiresAt)
 		HandleWebSocket(c)
 	}
 }
@@ -232,17 +549,12 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[WEBSOCKET] Attempting to upgrade connection for user: %s", userID)
-	
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("[WEBSOCKET] Upgrade error: %v", err)
-		log.Printf("[WEBSOCKET] Request headers: %+v", c.Request.Header)
+		log.Printf("[WEBSOCKET] Upgrade error for user %s: %v", userID, err)
 		return
 	}
-	
-	log.Printf("[WEBSOCKET] Connection upgraded successfully for user: %s", userID)
 
 	// Create client
 	client := &Client{
@@ -251,19 +563,99 @@ func HandleWebSocket(c *gin.Context) {
 		Conn:   conn,
 		Send:   make(chan []byte, 256),
 		Hub:    wsHub,
+		Topics: make(map[string]bool),
+	}
+	if expiresAt, ok := c.Get("tokenExpiresAt"); ok {
+		if t, ok := expiresAt.(time.Time); ok && !t.IsZero() {
+			client.setExpiresAt(t)
+		}
+	}
+	if wsHub.maxMessageSize > 0 {
+		conn.SetReadLimit(wsHub.maxMessageSize)
+	}
+
+	atomic.AddInt64(&wsHub.metrics.connectionsTotal, 1)
+	if wsHub.realtime != nil {
+		wsHub.realtime.RegistrarConexao(userID, client.ID)
 	}
 
-	log.Printf("[WEBSOCKET] Registering client %s for user %s", client.ID, client.UserID)
-	
 	// Register client
 	client.Hub.Register <- client
 
 	// Start goroutines for reading and writing
-	log.Printf("[WEBSOCKET] Starting read/write pumps for client %s", client.ID)
 	go client.writePump()
 	go client.readPump()
 }
 
+func (c *Client) setExpiresAt(t time.Time) {
+	atomic.StoreInt64(&c.expiresAt, t.UnixNano())
+}
+
+// tokenExpired reports whether the token used by this connection has expired
+func (c *Client) tokenExpired() bool {
+	expiresAt := atomic.LoadInt64(&c.expiresAt)
+	return expiresAt > 0 && time.Now().UnixNano() >= expiresAt
+}
+
+// handleReauth extends the connection with a fresh token for the same user
+func (c *Client) handleReauth(wsMsg wsClientMessage, authService *services.AuthService) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(wsMsg.Data, &req); err != nil || req.Token == "" || authService == nil {
+		c.sendError("token is required")
+		return
+	}
+
+	claims, err := authService.ValidateAccessToken(req.Token)
+	if err != nil || claims.UserID != c.UserID {
+		c.sendError("invalid token")
+		return
+	}
+
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+		c.setExpiresAt(expiresAt)
+	} else {
+		atomic.StoreInt64(&c.expiresAt, 0)
+	}
+	c.sendDirect(MessageTypeReauthenticated, map[string]interface{}{"expiresAt": expiresAt})
+}
+
+// Metrics returns connection counters for this node
+func (h *Hub) Metrics() map[string]interface{} {
+	h.mutex.RLock()
+	connectedClients := len(h.Clients)
+	connectedUsers := len(h.UserChannels)
+	topics := len(h.Topics)
+	h.mutex.RUnlock()
+
+	return map[string]interface{}{
+		"connectedClients":  connectedClients,
+		"connectedUsers":    connectedUsers,
+		"topics":            topics,
+		"connectionsTotal":  atomic.LoadInt64(&h.metrics.connectionsTotal),
+		"rejectedOrigin":    atomic.LoadInt64(&h.metrics.rejectedOrigin),
+		"rejectedAuth":      atomic.LoadInt64(&h.metrics.rejectedAuth),
+		"rejectedLimit":     atomic.LoadInt64(&h.metrics.rejectedLimit),
+		"closedExpired":     atomic.LoadInt64(&h.metrics.closedExpired),
+		"droppedSlow":       atomic.LoadInt64(&h.metrics.droppedSlow),
+		"messagesReceived":  atomic.LoadInt64(&h.metrics.messagesReceived),
+		"messagesDelivered": atomic.LoadInt64(&h.metrics.messagesDelivered),
+		"distributed":       h.realtime != nil && h.realtime.Distribuido(),
+	}
+}
+
+// closeTokenExpired sends the 4001 close frame so the client knows it must reauthenticate
+func (c *Client) closeTokenExpired() {
+	atomic.AddInt64(&c.Hub.metrics.closedExpired, 1)
+	log.Printf("[WEBSOCKET] Token expired, closing client %s", c.ID)
+	c.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(wsCloseTokenExpired, "token expired"),
+		time.Now().Add(10*time.Second))
+}
+
 // Read messages from WebSocket
 func (c *Client) readPump() {
 	defer func() {
@@ -286,43 +678,213 @@ func (c *Client) readPump() {
 			}
 			break
 		}
+		atomic.AddInt64(&c.Hub.metrics.messagesReceived, 1)
+
+		if c.tokenExpired() {
+			c.closeTokenExpired()
+			return
+		}
 
 		// Handle incoming messages
-		var wsMsg WSMessage
+		var wsMsg wsClientMessage
 		if err := json.Unmarshal(message, &wsMsg); err != nil {
 			log.Printf("Error unmarshaling message: %v", err)
+			c.sendError("invalid message format")
 			continue
 		}
 
 		// Handle different message types
 		switch wsMsg.Type {
 		case MessageTypePing:
-			// Respond with pong
-			pongMsg := WSMessage{
-				Type:      MessageTypePong,
-				Data:      map[string]string{"status": "pong"},
-				Timestamp: time.Now(),
+			c.sendDirect(MessageTypePong, map[string]string{"status": "pong"})
+		case MessageTypeSubscribe, MessageTypeUnsubscribe:
+			c.handleTopic(wsMsg)
+		case MessageTypeTyping:
+			c.handleTyping(wsMsg)
+		case MessageTypeResume:
+			c.handleResume(wsMsg)
+		case MessageTypeReauth:
+			c.handleReauth(wsMsg, c.Hub.authService)
+		default:
+			c.sendError("unknown message type: " + wsMsg.Type)
+		}
+	}
+}
+
+// sendDirect queues an unsequenced reply to this client only
+func (c *Client) sendDirect(messageType string, data interface{}) {
+	message := WSMessage{
+		Type:      messageType,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	if payload, err := json.Marshal(message); err == nil {
+		c.Hub.sendToClient(c, payload)
+	}
+}
+
+func (c *Client) sendError(errMsg string) {
+	c.sendDirect(MessageTypeError, map[string]string{"error": errMsg})
+}
+
+// topicAllowed applies the user's permissions and queue scope to a topic
+func (h *Hub) topicAllowed(userID, topic string) bool {
+	if h.permissionService == nil {
+		return true
+	}
+
+	switch {
+	case strings.HasPrefix(topic, services.TopicQuadro("")):
+		ok, err := h.permissionService.Possui(userID, models.NovaPermissao(models.RecursoKanban, models.AcaoLer))
+		quadroID := strings.TrimPrefix(topic, services.TopicQuadro(""))
+		return err == nil && ok && h.permissionService.PertenceAOrganizacao(userID, &models.Quadro{}, quadroID)
+	case strings.HasPrefix(topic, services.TopicChat("")), strings.HasPrefix(topic, services.TopicFila("")):
+		escopo, err := h.permissionService.EscopoAtendimento(userID)
+		if err != nil {
+			return false
+		}
+		if chatID := strings.TrimPrefix(topic, services.TopicChat("")); chatID != topic {
+			ok, err := h.permissionService.PodeAcessarChat(escopo, chatID)
+			return err == nil && ok
+		}
+		filaID := strings.TrimPrefix(topic, services.TopicFila(""))
+		if escopo.Irrestrito {
+			return h.permissionService.PertenceAOrganizacao(userID, &models.Fila{}, filaID)
+		}
+		for _, id := range escopo.FilaIDs {
+			if id == filaID {
+				return true
 			}
-			if data, err := json.Marshal(pongMsg); err == nil {
-				select {
-				case c.Send <- data:
-				default:
-					return
-				}
+		}
+		return false
+	}
+	return false
+}
+
+// handleTopic subscribes or unsubscribes the client to a chat, board or queue topic
+func (c *Client) handleTopic(wsMsg wsClientMessage) {
+	var req wsTopicRequest
+	if err := json.Unmarshal(wsMsg.Data, &req); err != nil || !validTopic(req.Topic) {
+		c.sendError("invalid topic")
+		return
+	}
+
+	if wsMsg.Type == MessageTypeSubscribe {
+		if !c.Hub.topicAllowed(c.UserID, req.Topic) {
+			c.sendError("topic not allowed")
+			return
+		}
+		c.Hub.Subscribe(c, req.Topic)
+		c.sendDirect(MessageTypeSubscribed, map[string]string{"topic": req.Topic})
+		return
+	}
+
+	c.Hub.Unsubscribe(c, req.Topic)
+	c.sendDirect(MessageTypeUnsubscribed, map[string]string{"topic": req.Topic})
+}
+
+// handleTyping relays the typing state to WAHA and to other viewers of the chat
+func (c *Client) handleTyping(wsMsg wsClientMessage) {
+	var req wsTypingRequest
+	if err := json.Unmarshal(wsMsg.Data, &req); err != nil || req.ChatID == "" {
+		c.sendError("chatId is required")
+		return
+	}
+	if !c.Hub.topicAllowed(c.UserID, services.TopicChat(req.ChatID)) {
+		c.sendError("chat not allowed")
+		return
+	}
+
+	if c.Hub.whatsappService != nil {
+		go func() {
+			sessionName, err := c.Hub.whatsappService.NomeSessaoParaChat(c.UserID, req.ChatID, req.Sessao)
+			if err != nil {
+				log.Printf("[WEBSOCKET] Typing relay failed for user %s: %v", c.UserID, err)
+				return
 			}
-		case MessageTypeTyping:
-			// Broadcast typing status to other users
-			// This would be implemented based on your business logic
-			log.Printf("User %s is typing", c.UserID)
+			if req.Typing {
+				_, err = c.Hub.whatsappService.StartTyping(sessionName, req.ChatID)
+			} else {
+				_, err = c.Hub.whatsappService.StopTyping(sessionName, req.ChatID)
+			}
+			if err != nil {
+				log.Printf("[WEBSOCKET] Typing relay failed for user %s: %v", c.UserID, err)
+			}
+		}()
+	}
+
+	c.Hub.BroadcastToTopic(services.TopicChat(req.ChatID), WSMessage{
+		Type: MessageTypeTyping,
+		Data: map[string]interface{}{
+			"chatId": req.ChatID,
+			"userId": c.UserID,
+			"typing": req.Typing,
+		},
+	})
+}
+
+// handleResume replays events missed since the given sequence id
+func (c *Client) handleResume(wsMsg wsClientMessage) {
+	var req wsResumeRequest
+	if err := json.Unmarshal(wsMsg.Data, &req); err != nil || req.Since < 0 {
+		c.sendError("invalid resume request")
+		return
+	}
+
+	if c.Hub.realtime == nil {
+		c.sendDirect(MessageTypeResyncRequired, map[string]interface{}{"since": req.Since})
+		return
+	}
+
+	channels := []string{
+		services.RealtimeUserChannel(c.UserID),
+		services.RealtimeBroadcastChannel,
+	}
+	c.Hub.mutex.RLock()
+	for topic := range c.Topics {
+		channels = append(channels, services.RealtimeTopicChannel(topic))
+	}
+	c.Hub.mutex.RUnlock()
+
+	payloads, completo, err := c.Hub.realtime.Replay(channels, req.Since)
+	if err != nil {
+		log.Printf("[WEBSOCKET] Resume failed for client %s: %v", c.ID, err)
+	}
+	// More than the send buffer can hold: the client should reload instead
+	if err != nil || !completo || len(payloads) > cap(c.Send)/2 {
+		c.sendDirect(MessageTypeResyncRequired, map[string]interface{}{
+			"since":   req.Since,
+			"lastSeq": c.Hub.realtime.UltimaSequencia(),
+		})
+		return
+	}
+
+	for _, payload := range payloads {
+		c.Hub.sendToClient(c, payload)
+	}
+	c.sendDirect(MessageTypeResumed, map[string]interface{}{
+		"since":    req.Since,
+		"replayed": len(payloads),
+		"lastSeq":  c.Hub.realtime.UltimaSequencia(),
+	})
+}
+
+func validTopic(topic string) bool {
+	for _, prefix := range wsTopicPrefixes {
+		if strings.HasPrefix(topic, prefix) && len(topic) > len(prefix) {
+			return true
 		}
 	}
+	return false
 }
 
 // Write messages to WebSocket
 func (c *Client) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
+	expiryTicker := time.NewTicker(wsExpiryCheckInterval)
 	defer func() {
 		ticker.Stop()
+		expiryTicker.Stop()
 		c.Conn.Close()
 	}()
 
@@ -347,6 +909,7 @@ func (c *Client) writePump() {
 				w.Write([]byte{'\n'})
 				w.Write(<-c.Send)
 			}
+			atomic.AddInt64(&c.Hub.metrics.messagesDelivered, int64(n+1))
 
 			if err := w.Close(); err != nil {
 				return
@@ -357,6 +920,16 @@ func (c *Client) writePump() {
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			// Heartbeat for the cross-replica connection registry
+			if c.Hub.realtime != nil {
+				c.Hub.realtime.RegistrarConexao(c.UserID, c.ID)
+			}
+
+		case <-expiryTicker.C:
+			if c.tokenExpired() {
+				c.closeTokenExpired()
+				return
+			}
 		}
 	}
 }
@@ -388,3 +961,52 @@ func BroadcastNewMessage(userID string, message interface{}) {
 	log.Printf("[WEBSOCKET] Broadcasting new message to user %s", userID)
 	wsHub.BroadcastToUser(userID, wsMessage)
 }
+
+// NewWebSocketTicketHandler issues a short-lived, single-use ticket for the
+// authenticated user so the browser does not need to put the JWT in the URL
+func NewWebSocketTicketHandler(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if wsHub == nil || wsHub.realtime == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket unavailable"})
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		claims, err := authService.ValidateAccessToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		var expiresAt time.Time
+		if claims.ExpiresAt != nil {
+			expiresAt = claims.ExpiresAt.Time
+		}
+
+		ticket, err := wsHub.realtime.CriarTicket(claims.UserID, expiresAt)
+		if err != nil {
+			log.Printf("[WEBSOCKET] Error creating ticket for user %s: %v", claims.UserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao gerar ticket"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"ticket":    ticket,
+			"expiresIn": int(services.RealtimeTicketTTL.Seconds()),
+		})
+	}
+}
+
+// WebSocketMetrics returns connection metrics for this node
+func WebSocketMetrics(c *gin.Context) {
+	if wsHub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket unavailable"})
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	c.JSON(http.StatusOK, gin.H{
+		"node":    hostname,
+		"metrics": wsHub.Metrics(),
+	})
+}
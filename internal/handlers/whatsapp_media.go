@@ -1,37 +1,42 @@
 package handlers
 
 import (
-	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"tappyone/internal/models"
 	"tappyone/internal/services"
 	"tappyone/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 // WhatsAppMediaHandler gerencia envio de mídia no WhatsApp
 type WhatsAppMediaHandler struct {
 	whatsappService *services.WhatsAppService
 	authService     *services.AuthService
+	midias          *services.MidiaService
+	processamento   *services.ProcessamentoMidiaService
 }
 
-func NewWhatsAppMediaHandler(whatsappService *services.WhatsAppService, authService *services.AuthService) *WhatsAppMediaHandler {
+func NewWhatsAppMediaHandler(whatsappService *services.WhatsAppService, authService *services.AuthService, midias *services.MidiaService, processamento *services.ProcessamentoMidiaService) *WhatsAppMediaHandler {
 	return &WhatsAppMediaHandler{
 		whatsappService: whatsappService,
 		authService:     authService,
+		midias:          midias,
+		processamento:   processamento,
 	}
 }
 
 // GetChats obtém lista de chats
 func (h *WhatsAppMediaHandler) GetChats(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), "")
+	if !ok {
+		return
+	}
 	
 	chats, err := h.whatsappService.GetChats(sessionName)
 	if err != nil {
@@ -45,7 +50,10 @@ func (h *WhatsAppMediaHandler) GetChats(c *gin.Context) {
 
 // GetContacts obtém lista de contatos
 func (h *WhatsAppMediaHandler) GetContacts(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), "")
+	if !ok {
+		return
+	}
 	
 	contacts, err := h.whatsappService.GetContacts(sessionName)
 	if err != nil {
@@ -59,7 +67,6 @@ func (h *WhatsAppMediaHandler) GetContacts(c *gin.Context) {
 
 // GetChatMessages obtém mensagens de um chat
 func (h *WhatsAppMediaHandler) GetChatMessages(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
 	// Parse pagination parameters
@@ -76,6 +83,11 @@ func (h *WhatsAppMediaHandler) GetChatMessages(c *gin.Context) {
 		offset = 0
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	messages, err := h.whatsappService.GetChatMessages(sessionName, chatID, limit, offset)
 	if err != nil {
 		log.Printf("[HANDLER] GetChatMessages error: %v", err)
@@ -88,7 +100,6 @@ func (h *WhatsAppMediaHandler) GetChatMessages(c *gin.Context) {
 
 // SendMessage envia mensagem de texto
 func (h *WhatsAppMediaHandler) SendMessage(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
 	var req struct {
@@ -100,8 +111,16 @@ func (h *WhatsAppMediaHandler) SendMessage(c *gin.Context) {
 		return
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendMessage(sessionName, chatID, req.Text)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendMessage error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -119,50 +138,36 @@ func (h *WhatsAppMediaHandler) UploadFile(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Criar diretório de uploads se não existir
-	uploadDir := "uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar diretório"})
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo"})
 		return
 	}
 
-	// Gerar nome único para o arquivo
-	filename := uuid.New().String() + filepath.Ext(header.Filename)
-	filePath := filepath.Join(uploadDir, filename)
-
-	// Salvar arquivo
-	dst, err := os.Create(filePath)
+	midia, err := h.midias.Armazenar(c.GetString("organizacao_id"), c.GetString("user_id"), header.Filename, data, models.OrigemMidiaUpload)
 	if err != nil {
+		if cotaMidiaExcedida(c, err) {
+			return
+		}
+		log.Printf("[HANDLER] UploadFile error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao copiar arquivo"})
-		return
-	}
+	// URL assinada: o WAHA baixa o arquivo sem o token do usuário
+	fileURL := h.midias.URLAssinada(midia.ID, 0)
 
-	// Retornar URL do arquivo
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		// Para Docker, usar host.docker.internal para acessar o host
-		baseURL = "http://host.docker.internal:8080"
-	}
-	
-	fileURL := baseURL + "/uploads/" + filename
-	
 	c.JSON(http.StatusOK, gin.H{
 		"url":      fileURL,
+		"midiaId":  midia.ID,
 		"filename": header.Filename,
-		"size":     header.Size,
-		"type":     header.Header.Get("Content-Type"),
+		"size":     midia.Tamanho,
+		"type":     midia.TipoMime,
 	})
 }
 
 // SendImage envia imagem
 func (h *WhatsAppMediaHandler) SendImage(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
 	var req struct {
@@ -175,8 +180,16 @@ func (h *WhatsAppMediaHandler) SendImage(c *gin.Context) {
 		return
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendImage(sessionName, chatID, req.ImageURL, req.Caption)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendImage error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -187,7 +200,6 @@ func (h *WhatsAppMediaHandler) SendImage(c *gin.Context) {
 
 // SendFile envia arquivo
 func (h *WhatsAppMediaHandler) SendFile(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
 	var req struct {
@@ -201,8 +213,16 @@ func (h *WhatsAppMediaHandler) SendFile(c *gin.Context) {
 		return
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendFile(sessionName, chatID, req.FileURL, req.Filename, req.Caption)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendFile error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -220,7 +240,6 @@ func (h *WhatsAppMediaHandler) SendVoice(c *gin.Context) {
 		return
 	}
 	
-	sessionName := "user_" + userID
 	chatID := c.Param("chatId")
 	
 	var req struct {
@@ -232,8 +251,16 @@ func (h *WhatsAppMediaHandler) SendVoice(c *gin.Context) {
 		return
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendVoice(sessionName, chatID, req.AudioURL)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendVoice error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -244,7 +271,6 @@ func (h *WhatsAppMediaHandler) SendVoice(c *gin.Context) {
 
 // SendVideo envia vídeo
 func (h *WhatsAppMediaHandler) SendVideo(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
 	var req struct {
@@ -257,8 +283,16 @@ func (h *WhatsAppMediaHandler) SendVideo(c *gin.Context) {
 		return
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendVideo(sessionName, chatID, req.VideoURL, req.Caption)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendVideo error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -269,7 +303,10 @@ func (h *WhatsAppMediaHandler) SendVideo(c *gin.Context) {
 
 // GetPresence obtém status de presença
 func (h *WhatsAppMediaHandler) GetPresence(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), "")
+	if !ok {
+		return
+	}
 	
 	presence, err := h.whatsappService.GetPresence(sessionName)
 	if err != nil {
@@ -283,9 +320,13 @@ func (h *WhatsAppMediaHandler) GetPresence(c *gin.Context) {
 
 // MarkAsRead marca mensagens como lidas
 func (h *WhatsAppMediaHandler) MarkAsRead(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.MarkAsRead(sessionName, chatID)
 	if err != nil {
 		log.Printf("[HANDLER] MarkAsRead error: %v", err)
@@ -298,7 +339,6 @@ func (h *WhatsAppMediaHandler) MarkAsRead(c *gin.Context) {
 
 // SetTyping define status de digitação
 func (h *WhatsAppMediaHandler) SetTyping(c *gin.Context) {
-	sessionName := "user_" + c.GetString("user_id")
 	chatID := c.Param("chatId")
 	
 	var req struct {
@@ -310,6 +350,11 @@ func (h *WhatsAppMediaHandler) SetTyping(c *gin.Context) {
 		return
 	}
 	
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, c.GetString("user_id"), chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SetTyping(sessionName, chatID, req.Presence)
 	if err != nil {
 		log.Printf("[HANDLER] SetTyping error: %v", err)
@@ -330,8 +375,12 @@ func (h *WhatsAppMediaHandler) UploadAndSendMedia(c *gin.Context) {
 		return
 	}
 	
-	sessionName := "user_" + userID
 	chatID := c.Param("chatId")
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	mediaType := c.PostForm("type") // "image", "file", "voice", "video"
 	caption := c.PostForm("caption")
 	
@@ -343,37 +392,24 @@ func (h *WhatsAppMediaHandler) UploadAndSendMedia(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Criar diretório de uploads se não existir
-	uploadDir := "uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar diretório"})
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo"})
 		return
 	}
 
-	// Gerar nome único para o arquivo
-	filename := uuid.New().String() + filepath.Ext(header.Filename)
-	filePath := filepath.Join(uploadDir, filename)
-
-	// Salvar arquivo
-	dst, err := os.Create(filePath)
+	midia, err := h.midias.Armazenar(c.GetString("organizacao_id"), userID, header.Filename, data, models.OrigemMidiaUpload)
 	if err != nil {
+		if cotaMidiaExcedida(c, err) {
+			return
+		}
+		log.Printf("[HANDLER] UploadAndSendMedia error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao salvar arquivo"})
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao copiar arquivo"})
-		return
-	}
-
-	// Gerar URL do arquivo
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		// Para Docker, usar host.docker.internal para acessar o host
-		baseURL = "http://host.docker.internal:8080"
-	}
-	fileURL := baseURL + "/uploads/" + filename
+	// URL assinada: o WAHA baixa o arquivo sem o token do usuário
+	fileURL := h.midias.URLAssinada(midia.ID, 0)
 
 	// Enviar mídia baseado no tipo
 	switch mediaType {
@@ -382,7 +418,10 @@ func (h *WhatsAppMediaHandler) UploadAndSendMedia(c *gin.Context) {
 	case "file":
 		_, err = h.whatsappService.SendFile(sessionName, chatID, fileURL, header.Filename, caption)
 	case "voice":
-		// Para áudio, usar URL como os outros tipos
+		// Áudio gravado no navegador vai pela versão Opus/OGG quando há ffmpeg
+		if _, errConversao := h.processamento.AudioPTT(midia); errConversao == nil && midia.ChaveAudioPTT != nil {
+			fileURL = h.midias.URLAssinadaVariante(midia.ID, models.VarianteMidiaAudioPTT, 0)
+		}
 		_, err = h.whatsappService.SendVoice(sessionName, chatID, fileURL)
 	case "video":
 		_, err = h.whatsappService.SendVideo(sessionName, chatID, fileURL, caption)
@@ -392,9 +431,10 @@ func (h *WhatsAppMediaHandler) UploadAndSendMedia(c *gin.Context) {
 	}
 
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] UploadAndSendMedia error: %v", err)
-		// Remover arquivo se falhou o envio
-		os.Remove(filePath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -402,8 +442,9 @@ func (h *WhatsAppMediaHandler) UploadAndSendMedia(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "File sent successfully",
 		"fileUrl":  fileURL,
+		"midiaId":  midia.ID,
 		"filename": header.Filename,
-		"size":     header.Size,
+		"size":     midia.Tamanho,
 		"type":     mediaType,
 	})
 }
@@ -417,7 +458,6 @@ func (h *WhatsAppMediaHandler) SendVideoMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := "user_" + userID
 	chatID := c.Param("chatId")
 
 	var req struct {
@@ -434,8 +474,16 @@ func (h *WhatsAppMediaHandler) SendVideoMessage(c *gin.Context) {
 	log.Printf("[HANDLER] SendVideoMessage - Sending video URL: %s to chat: %s", req.VideoURL, chatID)
 
 	// Usar o método SendVideo que trabalha com URLs
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendVideo(sessionName, chatID, req.VideoURL, req.Caption)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendVideoMessage error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -509,12 +557,19 @@ func (h *WhatsAppMediaHandler) ForwardMessage(c *gin.Context) {
 	}
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, services.ChatDaMensagem(req.MessageID))
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] ForwardMessage - userID: %s, sessionName: %s, toChatID: %s, messageID: %s", userID, sessionName, req.ToChatID, req.MessageID)
 
 	// Encaminhar mensagem via WhatsApp Service
 	result, err := h.whatsappService.ForwardMessage(sessionName, req.ToChatID, req.MessageID)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] ForwardMessage - WhatsApp service error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao encaminhar mensagem"})
 		return
@@ -549,7 +604,11 @@ func (h *WhatsAppMediaHandler) EditMessage(c *gin.Context) {
 	}
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] EditMessage - userID: %s, sessionName: %s, chatID: %s, messageID: %s", userID, sessionName, chatID, messageID)
 
 	// Editar mensagem via WhatsApp Service
@@ -580,7 +639,11 @@ func (h *WhatsAppMediaHandler) DeleteMessage(c *gin.Context) {
 	messageID := c.Param("messageId")
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] DeleteMessage - userID: %s, sessionName: %s, chatID: %s, messageID: %s", userID, sessionName, chatID, messageID)
 
 	// Deletar mensagem via WhatsApp Service
@@ -618,7 +681,11 @@ func (h *WhatsAppMediaHandler) StarMessage(c *gin.Context) {
 	}
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, services.ChatDaMensagem(req.MessageID))
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] StarMessage - userID: %s, sessionName: %s, messageID: %s, star: %t", userID, sessionName, req.MessageID, req.Star)
 
 	// Favoritar mensagem via WhatsApp Service
@@ -645,7 +712,6 @@ func (h *WhatsAppMediaHandler) SendContact(c *gin.Context) {
 		return
 	}
 
-	sessionName := "user_" + userID
 	chatID := c.Param("chatId")
 
 	var req struct {
@@ -659,8 +725,16 @@ func (h *WhatsAppMediaHandler) SendContact(c *gin.Context) {
 	}
 
 	// Usar o serviço WhatsApp para enviar contato
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	result, err := h.whatsappService.SendContact(sessionName, chatID, req.ContactId, req.ContactName)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -692,12 +766,19 @@ func (h *WhatsAppMediaHandler) SendContactVcard(c *gin.Context) {
 	}
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, req.ChatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] SendContactVcard - userID: %s, sessionName: %s, chatID: %s", userID, sessionName, req.ChatID)
 
 	// Enviar contato via WhatsApp Service
 	result, err := h.whatsappService.SendContactVcard(sessionName, req.ChatID, req.ContactID, req.Name)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendContactVcard - WhatsApp service error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enviar contato"})
 		return
@@ -733,12 +814,19 @@ func (h *WhatsAppMediaHandler) SendLocation(c *gin.Context) {
 	}
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, req.ChatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] SendLocation - userID: %s, sessionName: %s, chatID: %s", userID, sessionName, req.ChatID)
 
 	// Enviar localização via WhatsApp Service
 	result, err := h.whatsappService.SendLocation(sessionName, req.ChatID, req.Latitude, req.Longitude, req.Title, req.Address)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendLocation - WhatsApp service error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enviar localização"})
 		return
@@ -773,12 +861,19 @@ func (h *WhatsAppMediaHandler) SendPoll(c *gin.Context) {
 	}
 
 	// Get session name from user
-	sessionName := fmt.Sprintf("user_%s", userID)
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, req.ChatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[HANDLER] SendPoll - userID: %s, sessionName: %s, chatID: %s", userID, sessionName, req.ChatID)
 
 	// Enviar enquete via WhatsApp Service
 	result, err := h.whatsappService.SendPoll(sessionName, req.ChatID, req.Name, req.Options, req.MultipleAnswers)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[HANDLER] SendPoll - WhatsApp service error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao enviar enquete"})
 		return
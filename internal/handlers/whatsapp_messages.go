@@ -7,6 +7,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"tappyone/internal/services"
+	"tappyone/internal/utils"
 )
 
 // WhatsAppMessageHandler gerencia ações de mensagens do WhatsApp
@@ -26,7 +27,6 @@ func (h *WhatsAppMessageHandler) ReplyMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	chatID := c.Param("chatId")
 
 	var req struct {
@@ -39,10 +39,18 @@ func (h *WhatsAppMessageHandler) ReplyMessage(c *gin.Context) {
 		return
 	}
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] ReplyMessage - SessionName: %s, ChatID: %s, MessageID: %s", sessionName, chatID, req.MessageID)
 
 	_, err := h.whatsappService.SendReplyMessage(sessionName, chatID, req.Text, req.MessageID)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[WHATSAPP] ReplyMessage - Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao responder mensagem"})
 		return
@@ -59,8 +67,6 @@ func (h *WhatsAppMessageHandler) ForwardMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
-
 	var req struct {
 		MessageID string `json:"messageId" binding:"required"`
 		ToChatID  string `json:"toChatId" binding:"required"`
@@ -71,10 +77,18 @@ func (h *WhatsAppMessageHandler) ForwardMessage(c *gin.Context) {
 		return
 	}
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, services.ChatDaMensagem(req.MessageID))
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] ForwardMessage - SessionName: %s, MessageID: %s, ToChatID: %s", sessionName, req.MessageID, req.ToChatID)
 
 	_, err := h.whatsappService.ForwardMessage(sessionName, req.ToChatID, req.MessageID)
 	if err != nil {
+		if utils.FilaEnvioCheia(c, err) {
+			return
+		}
 		log.Printf("[WHATSAPP] ForwardMessage - Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao encaminhar mensagem"})
 		return
@@ -91,7 +105,6 @@ func (h *WhatsAppMessageHandler) EditMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	chatID := c.Param("chatId")
 	messageID := c.Param("messageId")
 
@@ -104,6 +117,11 @@ func (h *WhatsAppMessageHandler) EditMessage(c *gin.Context) {
 		return
 	}
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] EditMessage - SessionName: %s, ChatID: %s, MessageID: %s", sessionName, chatID, messageID)
 
 	_, err := h.whatsappService.EditMessage(sessionName, chatID, messageID, req.Text)
@@ -124,10 +142,14 @@ func (h *WhatsAppMessageHandler) DeleteMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
 	chatID := c.Param("chatId")
 	messageID := c.Param("messageId")
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, chatID)
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] DeleteMessage - SessionName: %s, ChatID: %s, MessageID: %s", sessionName, chatID, messageID)
 
 	_, err := h.whatsappService.DeleteMessage(sessionName, chatID, messageID)
@@ -148,8 +170,6 @@ func (h *WhatsAppMessageHandler) StarMessage(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
-
 	var req struct {
 		MessageID string `json:"messageId" binding:"required"`
 		Star      bool   `json:"star"`
@@ -160,6 +180,11 @@ func (h *WhatsAppMessageHandler) StarMessage(c *gin.Context) {
 		return
 	}
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, services.ChatDaMensagem(req.MessageID))
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] StarMessage - SessionName: %s, MessageID: %s, Star: %v", sessionName, req.MessageID, req.Star)
 
 	_, err := h.whatsappService.StarMessage(sessionName, req.MessageID, req.Star)
@@ -185,8 +210,6 @@ func (h *WhatsAppMessageHandler) AddReaction(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
-
 	var req struct {
 		MessageID string `json:"messageId" binding:"required"`
 		Reaction  string `json:"reaction" binding:"required"`
@@ -197,6 +220,11 @@ func (h *WhatsAppMessageHandler) AddReaction(c *gin.Context) {
 		return
 	}
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, services.ChatDaMensagem(req.MessageID))
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] AddReaction - SessionName: %s, MessageID: %s, Reaction: %s", sessionName, req.MessageID, req.Reaction)
 
 	err := h.whatsappService.AddReaction(sessionName, req.MessageID, req.Reaction)
@@ -217,8 +245,6 @@ func (h *WhatsAppMessageHandler) RemoveReaction(c *gin.Context) {
 		return
 	}
 
-	sessionName := fmt.Sprintf("user_%s", userID)
-
 	var req struct {
 		MessageID string `json:"messageId" binding:"required"`
 	}
@@ -228,6 +254,11 @@ func (h *WhatsAppMessageHandler) RemoveReaction(c *gin.Context) {
 		return
 	}
 
+	sessionName, ok := utils.SessaoWhatsAppDoChat(c, h.whatsappService, userID, services.ChatDaMensagem(req.MessageID))
+	if !ok {
+		return
+	}
+
 	log.Printf("[WHATSAPP] RemoveReaction - SessionName: %s, MessageID: %s", sessionName, req.MessageID)
 
 	err := h.whatsappService.RemoveReaction(sessionName, req.MessageID)
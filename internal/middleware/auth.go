@@ -1,20 +1,27 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"tappyone/internal/models"
 	"tappyone/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware verifica se o usuário está autenticado
-func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+// AuthMiddleware verifica se o usuário está autenticado, por access token
+// (Authorization: Bearer) ou por chave de API (X-Api-Key)
+func AuthMiddleware(authService *services.AuthService, chaveAPIService *services.ChaveAPIService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obter token do header Authorization
 		authHeader := c.GetHeader("Authorization")
-		log.Printf("[AUTH] Path: %s, AuthHeader: %s", c.Request.URL.Path, authHeader)
+		if authHeader == "" && c.GetHeader("X-Api-Key") != "" {
+			autenticarChaveAPI(c, chaveAPIService)
+			return
+		}
 		if authHeader == "" {
 			log.Printf("[AUTH] ERRO: Token não fornecido para %s", c.Request.URL.Path)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token de autorização necessário"})
@@ -25,7 +32,7 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		// Verificar formato do token
 		tokenParts := strings.Split(authHeader, " ")
 		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			log.Printf("[AUTH] ERRO: Formato de token inválido para %s: %v", c.Request.URL.Path, tokenParts)
+			log.Printf("[AUTH] ERRO: Formato de token inválido para %s", c.Request.URL.Path)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Formato de token inválido"})
 			c.Abort()
 			return
@@ -33,8 +40,8 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 
 		token := tokenParts[1]
 
-		// Validar token
-		claims, err := authService.ValidateToken(token)
+		// Validar token, usuário ativo e sessão não revogada
+		claims, err := authService.ValidateAccessToken(token)
 		if err != nil {
 			log.Printf("[AUTH] ERRO: Token inválido para %s: %v", c.Request.URL.Path, err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
@@ -47,28 +54,65 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		c.Set("userID", claims.UserID)  // Para compatibilidade
 		c.Set("user_email", claims.Email)
 		c.Set("user_role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		c.Set("organizacao_id", claims.OrganizacaoID)
 
 		log.Printf("[AUTH] SUCESSO: %s autenticado para %s (UserID: %s)", claims.Email, c.Request.URL.Path, claims.UserID)
 		c.Next()
 	}
 }
 
-// AdminMiddleware verifica se o usuário é admin
-func AdminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userRole, exists := c.Get("user_role")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+// autenticarChaveAPI autentica a requisição pela chave de API. O contexto
+// recebe o usuário dono da chave e os escopos, conferidos pelo RequirePermission.
+func autenticarChaveAPI(c *gin.Context, chaveAPIService *services.ChaveAPIService) {
+	chave, espera, err := chaveAPIService.Autenticar(c.GetHeader("X-Api-Key"), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrChaveAPILimite) {
+			c.Header("Retry-After", fmt.Sprintf("%d", int(espera.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
+		log.Printf("[AUTH] ERRO: Chave de API inválida para %s", c.Request.URL.Path)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Chave de API inválida"})
+		c.Abort()
+		return
+	}
 
-		if userRole != "ADMIN" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado. Apenas administradores."})
+	c.Set("user_id", chave.UsuarioID)
+	c.Set("userID", chave.UsuarioID)
+	c.Set("user_email", chave.Usuario.Email)
+	c.Set("user_role", string(chave.Usuario.Tipo))
+	c.Set("organizacao_id", chave.OrganizacaoID)
+	c.Set("api_key_id", chave.ID)
+	c.Set("api_key_escopos", chave.Escopos)
+
+	log.Printf("[AUTH] SUCESSO: chave %s autenticada para %s (UserID: %s)", chave.Prefixo, c.Request.URL.Path, chave.UsuarioID)
+	c.Next()
+}
+
+// RequireUserSession bloqueia rotas que exigem um usuário autenticado por
+// senha (gestão de chaves, dois fatores, sessões) quando o acesso é por chave de API
+func RequireUserSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("api_key_id") != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Operação não permitida com chave de API"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
+// RequireAdmin restringe a rota a usuários ADMIN (ex.: métricas do nó, que
+// não são separadas por organização)
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_role") != string(models.TipoUsuarioAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso restrito a administradores"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
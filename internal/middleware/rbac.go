@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"tappyone/internal/models"
+	"tappyone/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission exige que o usuário autenticado tenha todas as permissões informadas.
+// Deve ser usado depois do AuthMiddleware.
+func RequirePermission(permissionService *services.PermissionService, permissoes ...models.Permissao) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
+			c.Abort()
+			return
+		}
+
+		efetivas, err := permissionService.PermissoesUsuario(userID)
+		if err != nil {
+			log.Printf("[RBAC] Erro ao carregar permissões de %s: %v", userID, err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado"})
+			c.Abort()
+			return
+		}
+
+		// Com chave de API, a permissão precisa estar também nos escopos da chave
+		escoposChave, porChave := c.Get("api_key_escopos")
+
+		for _, permissao := range permissoes {
+			if porChave {
+				if escopos, ok := escoposChave.(models.ListaPermissoes); !ok || !escopos.Concede(permissao) {
+					log.Printf("[RBAC] Negado: chave %s sem escopo %s para %s %s", c.GetString("api_key_id"), permissao, c.Request.Method, c.Request.URL.Path)
+					c.JSON(http.StatusForbidden, gin.H{
+						"error":     "Escopo da chave de API insuficiente",
+						"permissao": permissao,
+					})
+					c.Abort()
+					return
+				}
+			}
+			if !efetivas.Concede(permissao) {
+				log.Printf("[RBAC] Negado: %s sem %s para %s %s", userID, permissao, c.Request.Method, c.Request.URL.Path)
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":     "Acesso negado",
+					"permissao": permissao,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("permissoes", efetivas)
+		c.Next()
+	}
+}
+
+// RequireResourcePermission aplica a um grupo de rotas a permissão do recurso
+// correspondente ao método HTTP: GET/HEAD exigem read, DELETE exige delete e os
+// demais exigem write (ou send, para recursos sem write, como mensagens).
+func RequireResourcePermission(permissionService *services.PermissionService, recurso models.Recurso) gin.HandlerFunc {
+	escrita := models.AcaoEscrever
+	if !services.RecursoPossuiAcao(recurso, models.AcaoEscrever) && services.RecursoPossuiAcao(recurso, models.AcaoEnviar) {
+		escrita = models.AcaoEnviar
+	}
+
+	porMetodo := map[string]gin.HandlerFunc{
+		http.MethodGet:    RequirePermission(permissionService, models.NovaPermissao(recurso, models.AcaoLer)),
+		http.MethodDelete: RequirePermission(permissionService, models.NovaPermissao(recurso, models.AcaoExcluir)),
+	}
+	porMetodo[http.MethodHead] = porMetodo[http.MethodGet]
+	exigirEscrita := RequirePermission(permissionService, models.NovaPermissao(recurso, escrita))
+
+	return func(c *gin.Context) {
+		if handler, ok := porMetodo[c.Request.Method]; ok {
+			handler(c)
+			return
+		}
+		exigirEscrita(c)
+	}
+}
+
+// RequireChatScope restringe rotas com :chatId aos chats das filas do atendente
+func RequireChatScope(permissionService *services.PermissionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chatID := c.Param("chatId")
+		if chatID == "" {
+			c.Next()
+			return
+		}
+
+		escopo, err := permissionService.EscopoAtendimento(c.GetString("user_id"))
+		if err != nil {
+			log.Printf("[RBAC] Erro ao carregar escopo: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso negado"})
+			c.Abort()
+			return
+		}
+
+		permitido, err := permissionService.PodeAcessarChat(escopo, chatID)
+		if err != nil || !permitido {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat não encontrado"})
+			c.Abort()
+			return
+		}
+
+		c.Set("escopo_atendimento", escopo)
+		c.Next()
+	}
+}
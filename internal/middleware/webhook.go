@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tamanho máximo aceito para o corpo de um webhook do WAHA
+const tamanhoMaximoWebhook = 16 << 20
+
+// WebhookWAHAMiddleware autentica os webhooks recebidos do WAHA. Com chave HMAC
+// configurada valida o header X-Webhook-Hmac (sha512, ou o algoritmo informado
+// em X-Webhook-Hmac-Algorithm); senão compara o segredo compartilhado enviado
+// em X-Webhook-Secret ou no parâmetro token. Sem nenhum dos dois, recusa todos
+// os webhooks: o nome da sessão no evento decide a organização que o recebe.
+func WebhookWAHAMiddleware(segredo, chaveHMAC string) gin.HandlerFunc {
+	if segredo == "" && chaveHMAC == "" {
+		log.Printf("[WEBHOOK_WAHA] AVISO: WAHA_WEBHOOK_SECRET e WAHA_WEBHOOK_HMAC_KEY não configurados, webhooks do WAHA serão recusados")
+	}
+
+	return func(c *gin.Context) {
+		if segredo == "" && chaveHMAC == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Autenticação de webhooks não configurada"})
+			return
+		}
+
+		// O limite vale nos dois modos: o handler lê o corpo do mesmo reader
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, tamanhoMaximoWebhook)
+
+		if chaveHMAC != "" {
+			corpo, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				var excedido *http.MaxBytesError
+				if errors.As(err, &excedido) {
+					c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payload excede o tamanho máximo"})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Payload inválido"})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(corpo))
+
+			if !assinaturaWAHAValida(chaveHMAC, c.GetHeader("X-Webhook-Hmac-Algorithm"), c.GetHeader("X-Webhook-Hmac"), corpo) {
+				log.Printf("[WEBHOOK_WAHA] Assinatura HMAC inválida de %s", c.ClientIP())
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Assinatura inválida"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		recebido := c.GetHeader("X-Webhook-Secret")
+		if recebido == "" {
+			recebido = c.Query("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(recebido), []byte(segredo)) != 1 {
+			log.Printf("[WEBHOOK_WAHA] Segredo inválido de %s", c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Segredo inválido"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func assinaturaWAHAValida(chave, algoritmo, assinatura string, corpo []byte) bool {
+	esperada, err := hex.DecodeString(strings.TrimSpace(assinatura))
+	if err != nil || len(esperada) == 0 {
+		return false
+	}
+
+	var novoHash func() hash.Hash
+	switch strings.ToLower(algoritmo) {
+	case "", "sha512":
+		novoHash = sha512.New
+	case "sha256":
+		novoHash = sha256.New
+	default:
+		return false
+	}
+
+	mac := hmac.New(novoHash, []byte(chave))
+	mac.Write(corpo)
+	return hmac.Equal(mac.Sum(nil), esperada)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrAuditoriaImutavel registros de auditoria não podem ser alterados nem excluídos
+var ErrAuditoriaImutavel = errors.New("registros de auditoria são imutáveis")
+
+// Tipos de ator do registro de auditoria
+const (
+	AtorAuditoriaUsuario        = "usuario"
+	AtorAuditoriaChaveAPI       = "chave_api"
+	AtorAuditoriaFluxo          = "fluxo"
+	AtorAuditoriaRespostaRapida = "resposta_rapida"
+	AtorAuditoriaSistema        = "sistema"
+)
+
+// Ações registradas na auditoria
+const (
+	AcaoAuditoriaCriar          = "criar"
+	AcaoAuditoriaAtualizar      = "atualizar"
+	AcaoAuditoriaExcluir        = "excluir"
+	AcaoAuditoriaConectar       = "conectar"
+	AcaoAuditoriaDesconectar    = "desconectar"
+	AcaoAuditoriaRevogar        = "revogar"
+	AcaoAuditoriaEnviarMensagem = "enviar_mensagem"
+)
+
+// RegistroAuditoria entrada do log de auditoria (somente inserção). Não usa
+// BaseModel porque não há atualização; UPDATE e DELETE são bloqueados também
+// por trigger no banco.
+type RegistroAuditoria struct {
+	ID            string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CriadoEm      time.Time `gorm:"autoCreateTime;index" json:"criadoEm"`
+	OrganizacaoID *string   `gorm:"type:uuid;index" json:"organizacaoId"` // nil em ações do sistema sem organização
+
+	// Quem executou: usuário, chave de API ou automação (fluxo, resposta rápida)
+	TipoAtor  string  `gorm:"not null;index" json:"tipoAtor"`
+	AtorID    string  `gorm:"not null;index" json:"atorId"`
+	UsuarioID *string `gorm:"index" json:"usuarioId"` // usuário responsável (dono da chave ou da automação)
+
+	Acao       string `gorm:"not null;index" json:"acao"`
+	Entidade   string `gorm:"not null;index:idx_auditoria_entidade" json:"entidade"`
+	EntidadeID string `gorm:"index:idx_auditoria_entidade" json:"entidadeId"`
+
+	Antes      JSONB `gorm:"type:jsonb" json:"antes,omitempty"`
+	Depois     JSONB `gorm:"type:jsonb" json:"depois,omitempty"`
+	Diferencas JSONB `gorm:"type:jsonb" json:"diferencas,omitempty"` // campo -> {antes, depois}
+
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+}
+
+func (RegistroAuditoria) TableName() string {
+	return "registros_auditoria"
+}
+
+func (r *RegistroAuditoria) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+func (r *RegistroAuditoria) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditoriaImutavel
+}
+
+func (r *RegistroAuditoria) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditoriaImutavel
+}
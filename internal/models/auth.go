@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// RefreshToken representa um refresh token emitido no login. Os tokens de uma
+// mesma sessão compartilham a FamiliaID; cada uso gera um novo token na família
+// (rotação) e reutilizar um token já trocado revoga a família inteira.
+type RefreshToken struct {
+	BaseModel
+	UsuarioID        string     `gorm:"not null;index" json:"usuarioId"`
+	FamiliaID        string     `gorm:"not null;index" json:"familiaId"`
+	TokenHash        string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiraEm         time.Time  `gorm:"not null" json:"expiraEm"`
+	UsadoEm          *time.Time `json:"usadoEm"`
+	RevogadoEm       *time.Time `json:"revogadoEm"`
+	MotivoRevogacao  *string    `json:"motivoRevogacao"`
+	SubstituidoPorID *string    `json:"substituidoPorId"`
+	IP               string     `json:"ip"`
+	UserAgent        string     `json:"userAgent"`
+
+	// Relacionamentos
+	Usuario *Usuario `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// TokenRedefinicaoSenha token de uso único enviado por email para redefinir a senha
+type TokenRedefinicaoSenha struct {
+	BaseModel
+	UsuarioID string     `gorm:"not null;index" json:"usuarioId"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiraEm  time.Time  `gorm:"not null" json:"expiraEm"`
+	UsadoEm   *time.Time `json:"usadoEm"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"userAgent"`
+
+	// Relacionamentos
+	Usuario *Usuario `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
+}
+
+func (TokenRedefinicaoSenha) TableName() string {
+	return "tokens_redefinicao_senha"
+}
+
+// Tipos de desafio de segundo fator emitidos no login
+const (
+	DesafioDoisFatoresVerificacao = "verificacao" // informar o código do autenticador
+	DesafioDoisFatoresCadastro    = "cadastro"    // configurar o autenticador exigido pela organização
+)
+
+// DesafioDoisFatores etapa intermediária do login: a senha já foi conferida e
+// os tokens só são emitidos após o código do segundo fator
+type DesafioDoisFatores struct {
+	BaseModel
+	UsuarioID   string     `gorm:"not null;index" json:"usuarioId"`
+	TokenHash   string     `gorm:"not null;uniqueIndex" json:"-"`
+	Tipo        string     `gorm:"not null" json:"tipo"`
+	ExpiraEm    time.Time  `gorm:"not null" json:"expiraEm"`
+	Tentativas  int        `gorm:"default:0" json:"tentativas"`
+	ConcluidoEm *time.Time `json:"concluidoEm"`
+	IP          string     `json:"ip"`
+	UserAgent   string     `json:"userAgent"`
+}
+
+func (DesafioDoisFatores) TableName() string {
+	return "desafios_dois_fatores"
+}
+
+// CodigoRecuperacao código de uso único para entrar sem o aplicativo autenticador
+type CodigoRecuperacao struct {
+	BaseModel
+	UsuarioID  string     `gorm:"not null;index" json:"usuarioId"`
+	CodigoHash string     `gorm:"not null;index" json:"-"`
+	UsadoEm    *time.Time `json:"usadoEm"`
+}
+
+func (CodigoRecuperacao) TableName() string {
+	return "codigos_recuperacao"
+}
+
+// HistoricoLogin registro de um login bem-sucedido, visível ao próprio usuário
+type HistoricoLogin struct {
+	BaseModel
+	UsuarioID   string `gorm:"not null;index" json:"usuarioId"`
+	FamiliaID   string `gorm:"index" json:"familiaId"` // sessão de refresh tokens aberta pelo login
+	IP          string `json:"ip"`
+	UserAgent   string `json:"userAgent"`
+	Dispositivo string `json:"dispositivo"` // navegador e sistema extraídos do user agent
+}
+
+func (HistoricoLogin) TableName() string {
+	return "historico_logins"
+}
@@ -16,6 +16,15 @@ type Atendimento struct {
 	ConversaID   string            `gorm:"not null" json:"conversaId"`
 	IniciadoEm   *time.Time        `json:"iniciadoEm"`
 	FinalizadoEm *time.Time        `json:"finalizadoEm"`
+	FilaID       *string           `gorm:"index" json:"filaId"`
+
+	// SLA
+	PoliticaSLAID         *string    `gorm:"index" json:"politicaSlaId"`
+	PrimeiraRespostaEm    *time.Time `json:"primeiraRespostaEm"`
+	PrazoPrimeiraResposta *time.Time `json:"prazoPrimeiraResposta"`
+	PrazoResolucao        *time.Time `json:"prazoResolucao"`
+	EstadoSLA             EstadoSLA  `gorm:"default:NO_PRAZO;index" json:"estadoSla"`
+	SLAEscalonadoEm       *time.Time `json:"slaEscalonadoEm"`
 
 	// Relacionamentos
 	Agente   *Usuario  `gorm:"foreignKey:AgenteID" json:"agente,omitempty"`
@@ -159,6 +168,7 @@ type Fluxo struct {
 	Ativo      bool    `gorm:"default:true" json:"ativo"`
 	QuadroID   string  `gorm:"not null" json:"quadroId"`
 	AgenteIaID *string `json:"agenteIaId"`
+	OrganizacaoID string `gorm:"type:uuid;index" json:"organizacaoId"`
 
 	// Relacionamentos
 	Quadro   Quadro    `gorm:"foreignKey:QuadroID" json:"quadro,omitempty"`
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type StatusCampanha string
+
+const (
+	StatusCampanhaRascunho    StatusCampanha = "RASCUNHO"
+	StatusCampanhaAgendada    StatusCampanha = "AGENDADA"
+	StatusCampanhaEmAndamento StatusCampanha = "EM_ANDAMENTO"
+	StatusCampanhaPausada     StatusCampanha = "PAUSADA"
+	StatusCampanhaConcluida   StatusCampanha = "CONCLUIDA"
+	StatusCampanhaCancelada   StatusCampanha = "CANCELADA"
+)
+
+// Editavel indica se a campanha ainda não começou a enviar
+func (s StatusCampanha) Editavel() bool {
+	return s == StatusCampanhaRascunho || s == StatusCampanhaAgendada
+}
+
+// Finalizada indica se a campanha não envia mais mensagens
+func (s StatusCampanha) Finalizada() bool {
+	return s == StatusCampanhaConcluida || s == StatusCampanhaCancelada
+}
+
+// SegmentoCampanha filtros dos contatos da organização que recebem a
+// campanha. Os critérios informados são combinados (E); dentro de uma lista
+// basta um item (tags: qualquer uma das tags).
+type SegmentoCampanha struct {
+	TagIDs         []string   `json:"tagIds,omitempty"`
+	FilaIDs        []string   `json:"filaIds,omitempty"`
+	ColunaIDs      []string   `json:"colunaIds,omitempty"` // colunas do Kanban
+	Cidades        []string   `json:"cidades,omitempty"`
+	Estados        []string   `json:"estados,omitempty"`
+	Empresa        string     `json:"empresa,omitempty"`
+	Busca          string     `json:"busca,omitempty"` // nome, telefone ou e-mail
+	InteracaoDesde *time.Time `json:"interacaoDesde,omitempty"`
+	InteracaoAte   *time.Time `json:"interacaoAte,omitempty"`
+	Favoritos      bool       `json:"favoritos,omitempty"`
+	ContatoIDs     []string   `json:"contatoIds,omitempty"`
+}
+
+func (s SegmentoCampanha) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *SegmentoCampanha) Scan(value interface{}) error {
+	if value == nil {
+		*s = SegmentoCampanha{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, s)
+}
+
+// Campanha disparo em massa de uma mensagem ou de uma sequência de resposta
+// rápida para um segmento de contatos, por uma sessão do WhatsApp. Os
+// destinatários são fixados quando a campanha começa.
+type Campanha struct {
+	BaseModel
+	OrganizacaoID    string         `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	UsuarioID        string         `gorm:"type:uuid;not null" json:"usuarioId"` // quem criou; recebe o progresso pelo websocket
+	SessaoWhatsAppID string         `gorm:"column:sessao_whatsapp_id;type:uuid;not null;index" json:"sessaoWhatsappId"`
+	Nome             string         `gorm:"not null" json:"nome"`
+	Status           StatusCampanha `gorm:"not null;default:RASCUNHO;index" json:"status"`
+
+	// Conteúdo: texto com variáveis ({nome}, {primeiro_nome}...) ou a
+	// sequência de ações de uma resposta rápida
+	Mensagem         *string          `gorm:"type:text" json:"mensagem"`
+	RespostaRapidaID *string          `gorm:"type:uuid" json:"respostaRapidaId"`
+	Segmento         SegmentoCampanha `gorm:"type:jsonb;not null;default:'{}'" json:"segmento"`
+
+	// Ritmo: nunca acima de MensagensPorMinuto, com um intervalo aleatório
+	// entre os contatos para parecer envio humano
+	AgendadaPara            *time.Time `json:"agendadaPara"`
+	MensagensPorMinuto      int        `gorm:"default:10" json:"mensagensPorMinuto"`
+	IntervaloMinimoSegundos int        `gorm:"default:8" json:"intervaloMinimoSegundos"`
+	IntervaloMaximoSegundos int        `gorm:"default:20" json:"intervaloMaximoSegundos"`
+
+	TotalDestinatarios int        `gorm:"default:0" json:"totalDestinatarios"`
+	Erro               *string    `gorm:"type:text" json:"erro"`
+	IniciadaEm         *time.Time `json:"iniciadaEm"`
+	FinalizadaEm       *time.Time `json:"finalizadaEm"`
+
+	// Relacionamentos
+	SessaoWhatsApp *SessaoWhatsApp `gorm:"foreignKey:SessaoWhatsAppID" json:"sessaoWhatsapp,omitempty"`
+}
+
+func (Campanha) TableName() string {
+	return "campanhas"
+}
+
+type StatusDestinatarioCampanha string
+
+const (
+	StatusDestinatarioPendente   StatusDestinatarioCampanha = "PENDENTE"
+	StatusDestinatarioEnviando   StatusDestinatarioCampanha = "ENVIANDO"
+	StatusDestinatarioEnviado    StatusDestinatarioCampanha = "ENVIADO"
+	StatusDestinatarioEntregue   StatusDestinatarioCampanha = "ENTREGUE"
+	StatusDestinatarioLido       StatusDestinatarioCampanha = "LIDO"
+	StatusDestinatarioRespondido StatusDestinatarioCampanha = "RESPONDIDO"
+	StatusDestinatarioFalhou     StatusDestinatarioCampanha = "FALHOU"
+	StatusDestinatarioSuprimido  StatusDestinatarioCampanha = "SUPRIMIDO" // descadastrado antes do envio
+	StatusDestinatarioCancelado  StatusDestinatarioCampanha = "CANCELADO"
+)
+
+// DestinatarioCampanha contato que recebe a campanha. Os horários de entrega,
+// leitura e resposta vêm dos acks e das mensagens recebidas do chat.
+type DestinatarioCampanha struct {
+	BaseModel
+	CampanhaID string                     `gorm:"type:uuid;not null;uniqueIndex:idx_destinatarios_campanha_chat" json:"campanhaId"`
+	ContatoID  *string                    `gorm:"type:uuid" json:"contatoId"`
+	ChatID     string                     `gorm:"not null;uniqueIndex:idx_destinatarios_campanha_chat;index" json:"chatId"`
+	Nome       *string                    `json:"nome"`
+	Status     StatusDestinatarioCampanha `gorm:"not null;default:PENDENTE;index" json:"status"`
+	IDMensagem *string                    `gorm:"index" json:"idMensagem"` // última mensagem enviada, acompanhada pelos acks
+	Erro       *string                    `gorm:"type:text" json:"erro"`
+
+	EnviadoEm    *time.Time `json:"enviadoEm"`
+	EntregueEm   *time.Time `json:"entregueEm"`
+	LidoEm       *time.Time `json:"lidoEm"`
+	RespondidoEm *time.Time `json:"respondidoEm"`
+}
+
+func (DestinatarioCampanha) TableName() string {
+	return "destinatarios_campanha"
+}
+
+// Descadastro número que pediu para não receber campanhas da organização
+// (resposta SAIR/STOP ou inclusão manual)
+type Descadastro struct {
+	BaseModel
+	OrganizacaoID  string  `gorm:"type:uuid;not null;uniqueIndex:idx_descadastros_organizacao_numero" json:"organizacaoId"`
+	NumeroTelefone string  `gorm:"not null;uniqueIndex:idx_descadastros_organizacao_numero" json:"numeroTelefone"`
+	Origem         string  `gorm:"not null" json:"origem"` // palavra_chave ou manual
+	Palavra        *string `json:"palavra"`
+	CampanhaID     *string `gorm:"type:uuid" json:"campanhaId"` // campanha respondida, quando houver
+	UsuarioID      *string `gorm:"type:uuid" json:"usuarioId"`  // quem incluiu manualmente
+}
+
+func (Descadastro) TableName() string {
+	return "descadastros"
+}
+
+const (
+	OrigemDescadastroPalavraChave = "palavra_chave"
+	OrigemDescadastroManual       = "manual"
+)
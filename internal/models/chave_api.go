@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// ChaveAPI credencial para integrações servidor a servidor (ERP, landing pages).
+// A chave age em nome do usuário que a criou: o acesso efetivo é a interseção
+// dos Escopos com as permissões atuais desse usuário, e a visibilidade de
+// contatos segue as filas dele. Apenas o hash é armazenado.
+type ChaveAPI struct {
+	BaseModel
+	OrganizacaoID   string          `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	UsuarioID       string          `gorm:"not null;index" json:"usuarioId"`
+	Nome            string          `gorm:"not null" json:"nome"`
+	Prefixo         string          `gorm:"not null;index" json:"prefixo"` // parte pública exibida na listagem
+	ChaveHash       string          `gorm:"not null;uniqueIndex" json:"-"`
+	Escopos         ListaPermissoes `gorm:"type:jsonb;not null;default:'[]'" json:"escopos"`
+	LimitePorMinuto int             `gorm:"not null;default:60" json:"limitePorMinuto"`
+	ExpiraEm        *time.Time      `json:"expiraEm"`
+	UltimoUsoEm     *time.Time      `json:"ultimoUsoEm"`
+	UltimoUsoIP     string          `json:"ultimoUsoIp"`
+	RevogadoEm      *time.Time      `json:"revogadoEm"`
+	RevogadoPor     *string         `json:"revogadoPor"`
+
+	// Relacionamentos
+	Usuario *Usuario `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
+}
+
+func (ChaveAPI) TableName() string {
+	return "chaves_api"
+}
+
+// Valida indica se a chave não foi revogada nem expirou
+func (c ChaveAPI) Valida() bool {
+	return c.RevogadoEm == nil && (c.ExpiraEm == nil || time.Now().Before(*c.ExpiraEm))
+}
@@ -23,6 +23,7 @@ type Fila struct {
 	ChatBot       bool           `gorm:"default:false" json:"chatBot"`
 	Kanban        bool           `gorm:"default:false" json:"kanban"`
 	WhatsappChats bool           `gorm:"default:true" json:"whatsappChats"`
+	OrganizacaoID string         `gorm:"type:uuid;index" json:"organizacaoId"`
 
 	// Relacionamentos
 	Atendentes []FilaAtendente `gorm:"foreignKey:FilaID" json:"atendentes,omitempty"`
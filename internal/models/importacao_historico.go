@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+type StatusImportacao string
+
+const (
+	StatusImportacaoPendente    StatusImportacao = "PENDENTE"
+	StatusImportacaoEmAndamento StatusImportacao = "EM_ANDAMENTO"
+	StatusImportacaoPausada     StatusImportacao = "PAUSADA"
+	StatusImportacaoConcluida   StatusImportacao = "CONCLUIDA"
+	StatusImportacaoFalhou      StatusImportacao = "FALHOU"
+)
+
+// ImportacaoHistorico importação das conversas antigas de uma sessão a partir
+// do WAHA. Os chats são percorridos em ordem de id; ChatAtual e
+// OffsetMensagens formam o cursor usado para retomar após uma interrupção.
+type ImportacaoHistorico struct {
+	BaseModel
+	SessaoWhatsAppID string           `gorm:"column:sessao_whatsapp_id;type:uuid;not null;index" json:"sessaoWhatsappId"`
+	OrganizacaoID    string           `gorm:"type:uuid;index" json:"organizacaoId"`
+	UsuarioID        string           `gorm:"type:uuid;not null" json:"usuarioId"` // quem iniciou; recebe o progresso pelo websocket
+	Status           StatusImportacao `gorm:"not null;default:PENDENTE;index" json:"status"`
+
+	// Opções
+	BaixarMidia          bool       `gorm:"default:false" json:"baixarMidia"`
+	Desde                *time.Time `json:"desde"`                                  // ignora mensagens anteriores
+	LimitePorChat        int        `gorm:"default:0" json:"limitePorChat"`         // 0 importa todo o histórico do chat
+	RequisicoesPorMinuto int        `gorm:"default:20" json:"requisicoesPorMinuto"` // ritmo das chamadas ao WAHA
+
+	// Cursor
+	ChatAtual       *string `json:"chatAtual"`
+	OffsetMensagens int     `gorm:"default:0" json:"offsetMensagens"`
+
+	// Progresso
+	TotalChats          int `gorm:"default:0" json:"totalChats"`
+	ChatsConcluidos     int `gorm:"default:0" json:"chatsConcluidos"`
+	MensagensImportadas int `gorm:"default:0" json:"mensagensImportadas"`
+	ContatosCriados     int `gorm:"default:0" json:"contatosCriados"`
+	MidiasBaixadas      int `gorm:"default:0" json:"midiasBaixadas"`
+
+	Erro         *string    `gorm:"type:text" json:"erro"`
+	IniciadaEm   *time.Time `json:"iniciadaEm"`
+	FinalizadaEm *time.Time `json:"finalizadaEm"`
+}
+
+func (ImportacaoHistorico) TableName() string {
+	return "importacoes_historico"
+}
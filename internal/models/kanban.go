@@ -29,7 +29,8 @@ func (j *JSONB) Scan(value interface{}) error {
 
 type Tag struct {
 	BaseModel
-	Nome       string `gorm:"uniqueIndex;not null" json:"nome"`
+	Nome       string `gorm:"uniqueIndex:idx_tags_organizacao_nome;not null" json:"nome"`
+	OrganizacaoID string `gorm:"type:uuid;uniqueIndex:idx_tags_organizacao_nome;index" json:"organizacaoId"`
 	Descricao  string `gorm:"type:text" json:"descricao,omitempty"`
 	Cor        string `gorm:"not null;default:'#3b82f6'" json:"cor"`
 	Categoria  string `gorm:"not null;default:'geral'" json:"categoria"`
@@ -69,6 +70,7 @@ type Quadro struct {
 	Posicao   int     `gorm:"not null" json:"posicao"`
 	Ativo     bool    `gorm:"default:true" json:"ativo"`
 	UsuarioID string  `gorm:"column:usuario_id;not null" json:"usuarioId"`
+	OrganizacaoID string `gorm:"type:uuid;index" json:"organizacaoId"`
 
 	// Relacionamentos
 	Usuario Usuario     `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+type OrigemMidia string
+
+const (
+	OrigemMidiaUpload   OrigemMidia = "UPLOAD"   // enviada pelo painel ou API
+	OrigemMidiaWhatsApp OrigemMidia = "WHATSAPP" // baixada do WAHA
+)
+
+type StatusProcessamentoMidia string
+
+const (
+	StatusProcessamentoPendente  StatusProcessamentoMidia = "PENDENTE"
+	StatusProcessamentoConcluido StatusProcessamentoMidia = "CONCLUIDO"
+	StatusProcessamentoFalhou    StatusProcessamentoMidia = "FALHOU"
+)
+
+// Variantes geradas pelo processamento, servidas pela mesma URL assinada
+const (
+	VarianteMidiaMiniatura = "miniatura" // JPEG reduzido de imagens e vídeos
+	VarianteMidiaAudioPTT  = "ptt"       // áudio convertido para Opus/OGG
+)
+
+// Midia arquivo guardado no MediaStorage. O conteúdo é endereçado pelo
+// SHA-256: o mesmo arquivo enviado duas vezes na organização reaproveita o
+// registro, e o objeto só sai do armazenamento quando nenhuma organização
+// ainda o referencia.
+type Midia struct {
+	BaseModel
+	OrganizacaoID string      `gorm:"type:uuid;not null;uniqueIndex:idx_midias_organizacao_sha256" json:"organizacaoId"`
+	SHA256        string      `gorm:"column:sha256;size:64;not null;uniqueIndex:idx_midias_organizacao_sha256;index:idx_midias_sha256" json:"sha256"`
+	Chave         string      `gorm:"not null" json:"-"`             // chave do objeto no armazenamento
+	Armazenamento string      `gorm:"not null" json:"armazenamento"` // local ou s3
+	TipoMime      string      `gorm:"not null" json:"tipoMime"`      // detectado pelo conteúdo
+	Tamanho       int64       `gorm:"not null" json:"tamanho"`
+	NomeOriginal  string      `json:"nomeOriginal"`
+	Origem        OrigemMidia `gorm:"not null;default:UPLOAD" json:"origem"`
+	UsuarioID     *string     `gorm:"type:uuid" json:"usuarioId"` // quem enviou; nulo para mídias do WhatsApp
+
+	// Renovado a cada reaproveitamento do conteúdo; a retenção conta a partir dele
+	UltimoUsoEm time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;index" json:"ultimoUsoEm"`
+
+	// Processamento em background (miniatura, conversão e metadados)
+	StatusProcessamento     StatusProcessamentoMidia `gorm:"not null;default:PENDENTE;index" json:"statusProcessamento"`
+	TentativasProcessamento int                      `gorm:"default:0" json:"-"`
+	ProximoProcessamentoEm  *time.Time               `gorm:"index" json:"-"`
+	ErroProcessamento       *string                  `gorm:"type:text" json:"erroProcessamento,omitempty"`
+	ProcessadaEm            *time.Time               `json:"processadaEm"`
+
+	// Metadados extraídos
+	Largura         *int     `json:"largura"`
+	Altura          *int     `json:"altura"`
+	DuracaoSegundos *float64 `json:"duracaoSegundos"`
+	Paginas         *int     `json:"paginas"`
+	Blurhash        *string  `json:"blurhash"`
+
+	// Objetos derivados no armazenamento
+	ChaveMiniatura *string `json:"-"`
+	ChaveAudioPTT  *string `gorm:"column:chave_audio_ptt" json:"-"`
+
+	// URLs assinadas preenchidas na leitura
+	URLMiniatura string `gorm:"-" json:"urlMiniatura,omitempty"`
+	URLAudioPTT  string `gorm:"-" json:"urlAudioPtt,omitempty"`
+}
+
+func (Midia) TableName() string {
+	return "midias"
+}
@@ -117,6 +117,26 @@ type Usuario struct {
 	Ativo     bool        `gorm:"default:true" json:"ativo"`
 	Senha     string      `gorm:"not null" json:"-"` // Não retornar na API
 
+	// Tokens emitidos antes desta data são rejeitados (logout de todas as sessões)
+	TokensRevogadosEm *time.Time `json:"-"`
+
+	// Autenticação em dois fatores (TOTP). O segredo fica cifrado e só vale
+	// quando DoisFatoresAtivo; DoisFatoresUltimoPasso impede reutilizar um código
+	DoisFatoresAtivo       bool       `gorm:"default:false" json:"doisFatoresAtivo"`
+	DoisFatoresSegredo     *string    `json:"-"`
+	DoisFatoresAtivadoEm   *time.Time `json:"doisFatoresAtivadoEm,omitempty"`
+	DoisFatoresUltimoPasso int64      `gorm:"default:0" json:"-"`
+
+	// Bloqueio temporário após falhas consecutivas de login
+	LoginBloqueadoAte *time.Time `json:"loginBloqueadoAte,omitempty"`
+
+	// Papel personalizado; quando nulo valem as permissões padrão do Tipo
+	PapelID *string `json:"papelId"`
+	Papel   *Papel  `gorm:"foreignKey:PapelID" json:"papel,omitempty"`
+
+	OrganizacaoID string       `gorm:"type:uuid;index" json:"organizacaoId"`
+	Organizacao   *Organizacao `gorm:"foreignKey:OrganizacaoID" json:"organizacao,omitempty"`
+
 	// Relacionamentos
 	Sessoes             []SessaoWhatsApp  `gorm:"foreignKey:UsuarioID" json:"sessoes,omitempty"`
 	AtendimentosAgente  []Atendimento     `gorm:"foreignKey:AgenteID" json:"atendimentosAgente,omitempty"`
@@ -145,12 +165,32 @@ type SessaoWhatsApp struct {
 	CodigoQr        *string      `json:"codigoQr"`
 	UrlWebhook      *string      `json:"urlWebhook"`
 	Ativo           bool         `gorm:"default:true" json:"ativo"`
-	UsuarioID       string       `gorm:"not null" json:"usuarioId"`
+	UsuarioID       string       `gorm:"not null" json:"usuarioId"` // quem criou a sessão
+	OrganizacaoID   string       `gorm:"type:uuid;index" json:"organizacaoId"`
+
+	// Identificação e roteamento entre as sessões da organização
+	Rotulo       *string `json:"rotulo"`
+	Cor          *string `json:"cor"`
+	FilaPadraoID *string `gorm:"type:uuid" json:"filaPadraoId"` // fila dos contatos de conversas novas
+	Padrao       bool    `gorm:"default:false" json:"padrao"`   // usada quando o chat ainda não tem conversa
+
+	// Estado da conexão com o WAHA (antes em user_connections)
+	StatusWAHA          *string    `gorm:"column:status_waha" json:"statusWaha"`
+	ConectadoEm         *time.Time `json:"conectadoEm"`
+	DesconectadoEm      *time.Time `json:"desconectadoEm"`
+	UltimaSincronizacao *time.Time `json:"ultimaSincronizacao"`
+
+	// Supervisor de sessões: reinícios com backoff e alerta de reautenticação
+	TentativasReinicio       int        `gorm:"default:0" json:"tentativasReinicio"`
+	ProximoReinicioEm        *time.Time `json:"proximoReinicioEm"`
+	ReautenticacaoAlertadaEm *time.Time `json:"reautenticacaoAlertadaEm"`
 
 	// Relacionamentos
-	Usuario   Usuario    `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
-	Contatos  []Contato  `gorm:"foreignKey:SessaoWhatsappID" json:"contatos,omitempty"`
-	Conversas []Conversa `gorm:"foreignKey:SessaoWhatsappID" json:"conversas,omitempty"`
+	Usuario            Usuario                 `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
+	FilaPadrao         *Fila                   `gorm:"foreignKey:FilaPadraoID" json:"filaPadrao,omitempty"`
+	UsuariosPermitidos []SessaoWhatsAppUsuario `gorm:"foreignKey:SessaoWhatsAppID" json:"usuariosPermitidos,omitempty"`
+	Contatos           []Contato               `gorm:"foreignKey:SessaoWhatsappID" json:"contatos,omitempty"`
+	Conversas          []Conversa              `gorm:"foreignKey:SessaoWhatsappID" json:"conversas,omitempty"`
 }
 
 func (SessaoWhatsApp) TableName() string {
@@ -165,6 +205,7 @@ type Contato struct {
 	Sobre            *string `json:"sobre"`
 	Bloqueado        bool    `gorm:"default:false" json:"bloqueado"`
 	SessaoWhatsappID string  `gorm:"not null" json:"sessaoWhatsappId"`
+	OrganizacaoID    string  `gorm:"type:uuid;index" json:"organizacaoId"`
 	ContactID        *string `gorm:"column:contactid;index" json:"contactid"` // ID do contato no WAHA
 	
 	// Campos adicionais do contato
@@ -269,9 +310,11 @@ type Mensagem struct {
 	IDMensagem     string         `gorm:"not null" json:"idMensagem"`
 	ConversaID     string         `gorm:"not null" json:"conversaId"`
 	DeMim          bool           `json:"deMim"`
+	Remetente      *string        `gorm:"index" json:"remetente"` // quem enviou; nos grupos, o participante
 	Tipo           TipoMensagem   `json:"tipo"`
 	Conteudo       *string        `json:"conteudo"`
 	UrlMidia       *string        `json:"urlMidia"`
+	MidiaID        *string        `gorm:"type:uuid;index" json:"midiaId"` // arquivo no armazenamento; urlMidia é assinada na leitura
 	Legenda        *string        `json:"legenda"`
 	Status         StatusMensagem `gorm:"default:PENDENTE" json:"status"`
 	Timestamp      time.Time      `json:"timestamp"`
@@ -279,9 +322,22 @@ type Mensagem struct {
 	Encaminhada    bool           `gorm:"default:false" json:"encaminhada"`
 	Favorita       bool           `gorm:"default:false" json:"favorita"`
 
+	// Preenchido quando a limpeza por retenção apagou a mídia da mensagem
+	MidiaExpiradaEm *time.Time `json:"midiaExpiradaEm"`
+
+	// Transcrição do áudio, feita em background e incluída na busca textual
+	Transcricao           *string            `gorm:"type:text" json:"transcricao"`
+	IdiomaTranscricao     *string            `json:"idiomaTranscricao"` // detectado pelo provedor (ex: pt)
+	StatusTranscricao     *StatusTranscricao `gorm:"index" json:"statusTranscricao"`
+	TentativasTranscricao int                `gorm:"default:0" json:"-"`
+	ProximaTranscricaoEm  *time.Time         `json:"-"`
+	ErroTranscricao       *string            `gorm:"type:text" json:"erroTranscricao,omitempty"`
+	TranscritaEm          *time.Time         `json:"transcritaEm"`
+
 	// Relacionamentos
 	Conversa     Conversa   `gorm:"foreignKey:ConversaID" json:"conversa,omitempty"`
 	RespostaPara *Mensagem  `gorm:"foreignKey:RespostaParaID" json:"respostaPara,omitempty"`
+	Midia        *Midia     `gorm:"foreignKey:MidiaID" json:"midia,omitempty"`
 	Respostas    []Mensagem `gorm:"foreignKey:RespostaParaID" json:"respostas,omitempty"`
 }
 
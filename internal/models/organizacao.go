@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Organizacao é a empresa cliente do CRM. Usuários, sessões do WhatsApp,
+// contatos, tags, filas, quadros e fluxos pertencem a uma organização.
+type Organizacao struct {
+	BaseModel
+	Nome  string `gorm:"not null" json:"nome"`
+	Slug  string `gorm:"uniqueIndex;not null" json:"slug"`
+	Ativo bool   `gorm:"default:true" json:"ativo"`
+
+	// Contas ADMIN só entram com autenticação em dois fatores
+	ExigirDoisFatoresAdmin bool `gorm:"default:false" json:"exigirDoisFatoresAdmin"`
+
+	// Cota de armazenamento de mídia em bytes, definida pelo operador. Nula
+	// usa MEDIA_QUOTA_MB; zero é ilimitada.
+	CotaMidiaBytes *int64 `json:"cotaMidiaBytes"`
+
+	// Transcrição automática das mensagens de voz recebidas. Sem idioma, o
+	// provedor detecta o idioma de cada áudio.
+	TranscricaoAudioAtiva bool    `gorm:"default:false" json:"transcricaoAudioAtiva"`
+	IdiomaTranscricao     *string `json:"idiomaTranscricao"`
+
+	// Relacionamentos
+	Usuarios []Usuario `gorm:"foreignKey:OrganizacaoID" json:"usuarios,omitempty"`
+}
+
+func (Organizacao) TableName() string {
+	return "organizacoes"
+}
+
+// ConviteOrganizacao convite de uso único enviado por email para entrar na organização
+type ConviteOrganizacao struct {
+	BaseModel
+	OrganizacaoID string      `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	Email         string      `gorm:"not null;index" json:"email"`
+	Tipo          TipoUsuario `gorm:"not null" json:"tipo"`
+	PapelID       *string     `json:"papelId"`
+	TokenHash     string      `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiraEm      time.Time   `gorm:"not null" json:"expiraEm"`
+	AceitoEm      *time.Time  `json:"aceitoEm"`
+	AceitoPorID   *string     `json:"aceitoPorId"`
+	RevogadoEm    *time.Time  `json:"revogadoEm"`
+	CriadoPor     string      `gorm:"not null" json:"criadoPor"`
+
+	// Relacionamentos
+	Organizacao *Organizacao `gorm:"foreignKey:OrganizacaoID" json:"organizacao,omitempty"`
+	Papel       *Papel       `gorm:"foreignKey:PapelID" json:"papel,omitempty"`
+}
+
+func (ConviteOrganizacao) TableName() string {
+	return "convites_organizacao"
+}
+
+// Pendente indica se o convite ainda pode ser aceito
+func (c ConviteOrganizacao) Pendente() bool {
+	return c.AceitoEm == nil && c.RevogadoEm == nil && time.Now().Before(c.ExpiraEm)
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Recurso protegido por permissão
+type Recurso string
+
+const (
+	RecursoOrganizacao      Recurso = "organizacao"
+	RecursoUsuarios         Recurso = "usuarios"
+	RecursoPapeis           Recurso = "papeis"
+	RecursoContatos         Recurso = "contatos"
+	RecursoMensagens        Recurso = "mensagens"
+	RecursoSessoes          Recurso = "sessoes"
+	RecursoKanban           Recurso = "kanban"
+	RecursoAgendamentos     Recurso = "agendamentos"
+	RecursoOrcamentos       Recurso = "orcamentos"
+	RecursoAssinaturas      Recurso = "assinaturas"
+	RecursoAnotacoes        Recurso = "anotacoes"
+	RecursoFilas            Recurso = "filas"
+	RecursoTags             Recurso = "tags"
+	RecursoAlertas          Recurso = "alertas"
+	RecursoSLA              Recurso = "sla"
+	RecursoRespostasRapidas Recurso = "respostas_rapidas"
+	RecursoFluxos           Recurso = "fluxos"
+	RecursoAgentes          Recurso = "agentes"
+	RecursoAtendimentos     Recurso = "atendimentos"
+	RecursoChavesAPI        Recurso = "chaves_api"
+	RecursoAuditoria        Recurso = "auditoria"
+	RecursoWebhooks         Recurso = "webhooks"
+	RecursoCampanhas        Recurso = "campanhas"
+)
+
+// Acao executada sobre um recurso
+type Acao string
+
+const (
+	AcaoLer      Acao = "read"
+	AcaoEscrever Acao = "write"
+	AcaoExcluir  Acao = "delete"
+	AcaoEnviar   Acao = "send"
+	// AcaoLerTodos libera contatos e conversas fora das filas do atendente
+	AcaoLerTodos Acao = "read_all"
+)
+
+// CuringaPermissao casa com qualquer recurso ou ação
+const CuringaPermissao = "*"
+
+// Permissao no formato "recurso:acao" (ex: contatos:write, mensagens:send)
+type Permissao string
+
+// NovaPermissao monta a permissão de um recurso e ação
+func NovaPermissao(recurso Recurso, acao Acao) Permissao {
+	return Permissao(string(recurso) + ":" + string(acao))
+}
+
+// Partes separa recurso e ação; retorna false para formato inválido
+func (p Permissao) Partes() (string, string, bool) {
+	recurso, acao, ok := strings.Cut(string(p), ":")
+	if !ok || recurso == "" || acao == "" {
+		return "", "", false
+	}
+	return recurso, acao, true
+}
+
+// Concede indica se esta permissão (possivelmente com curinga) cobre a solicitada
+func (p Permissao) Concede(solicitada Permissao) bool {
+	recurso, acao, ok := p.Partes()
+	if !ok {
+		return false
+	}
+	recursoSolicitado, acaoSolicitada, ok := solicitada.Partes()
+	if !ok {
+		return false
+	}
+	return (recurso == CuringaPermissao || recurso == recursoSolicitado) &&
+		(acao == CuringaPermissao || acao == acaoSolicitada)
+}
+
+// ListaPermissoes armazenada como jsonb
+type ListaPermissoes []Permissao
+
+// Concede indica se alguma permissão da lista cobre a solicitada
+func (l ListaPermissoes) Concede(solicitada Permissao) bool {
+	for _, p := range l {
+		if p.Concede(solicitada) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l ListaPermissoes) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *ListaPermissoes) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, l)
+}
+
+// Papel personalizado criado pelo administrador. Usuários com papel
+// atribuído recebem exatamente estas permissões no lugar do padrão do TipoUsuario.
+type Papel struct {
+	BaseModel
+	Nome          string          `gorm:"uniqueIndex:idx_papeis_organizacao_nome;not null" json:"nome"`
+	OrganizacaoID string          `gorm:"type:uuid;uniqueIndex:idx_papeis_organizacao_nome;index" json:"organizacaoId"`
+	Descricao     string          `json:"descricao"`
+	Permissoes    ListaPermissoes `gorm:"type:jsonb;not null;default:'[]'" json:"permissoes"`
+	CriadoPor     *string         `json:"criadoPor"`
+
+	// Relacionamentos
+	Usuarios []Usuario `gorm:"foreignKey:PapelID" json:"usuarios,omitempty"`
+}
+
+func (Papel) TableName() string {
+	return "papeis"
+}
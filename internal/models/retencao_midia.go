@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CategoriaMidia agrupa os tipos MIME para retenção e relatórios de uso
+type CategoriaMidia string
+
+const (
+	CategoriaMidiaImagem    CategoriaMidia = "IMAGEM"
+	CategoriaMidiaVideo     CategoriaMidia = "VIDEO"
+	CategoriaMidiaAudio     CategoriaMidia = "AUDIO" // inclui mensagens de voz
+	CategoriaMidiaDocumento CategoriaMidia = "DOCUMENTO"
+)
+
+// CategoriasMidia todas as categorias válidas
+var CategoriasMidia = []CategoriaMidia{CategoriaMidiaImagem, CategoriaMidiaVideo, CategoriaMidiaAudio, CategoriaMidiaDocumento}
+
+// PoliticaRetencaoMidia por quantos dias as mídias de uma categoria são
+// mantidas após o último uso. Mídias de mensagens favoritas e vinculadas a
+// orçamentos ou contratos nunca expiram.
+type PoliticaRetencaoMidia struct {
+	BaseModel
+	OrganizacaoID string         `gorm:"type:uuid;not null;uniqueIndex:idx_politicas_retencao_midia_organizacao_categoria" json:"organizacaoId"`
+	Categoria     CategoriaMidia `gorm:"not null;uniqueIndex:idx_politicas_retencao_midia_organizacao_categoria" json:"categoria"`
+	DiasRetencao  int            `gorm:"not null" json:"diasRetencao"`
+	Ativa         bool           `gorm:"default:true" json:"ativa"`
+}
+
+func (PoliticaRetencaoMidia) TableName() string {
+	return "politicas_retencao_midia"
+}
+
+// Entidades às quais uma mídia pode ser vinculada
+const (
+	EntidadeVinculoOrcamento = "orcamento"
+	EntidadeVinculoContrato  = "contrato"
+)
+
+// VinculoMidia liga a mídia a um orçamento ou contrato, o que a protege da
+// limpeza por retenção
+type VinculoMidia struct {
+	BaseModel
+	MidiaID       string  `gorm:"type:uuid;not null;uniqueIndex:idx_vinculos_midia_entidade" json:"midiaId"`
+	OrganizacaoID string  `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	Entidade      string  `gorm:"not null;uniqueIndex:idx_vinculos_midia_entidade" json:"entidade"`
+	EntidadeID    string  `gorm:"type:uuid;not null;uniqueIndex:idx_vinculos_midia_entidade;index" json:"entidadeId"`
+	UsuarioID     *string `gorm:"type:uuid" json:"usuarioId"`
+}
+
+func (VinculoMidia) TableName() string {
+	return "vinculos_midia"
+}
+
+// ExecucaoRetencaoMidia resultado de uma limpeza por retenção. Em simulação
+// nada é removido: os totais mostram o que seria apagado.
+type ExecucaoRetencaoMidia struct {
+	BaseModel
+	OrganizacaoID  string          `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	Simulacao      bool            `gorm:"not null" json:"simulacao"`
+	Agendada       bool            `gorm:"not null;default:false" json:"agendada"` // disparada pelo job e não pelo painel
+	Midias         int64           `gorm:"not null;default:0" json:"midias"`
+	BytesLiberados int64           `gorm:"not null;default:0" json:"bytesLiberados"`
+	Detalhes       json.RawMessage `gorm:"type:jsonb" json:"detalhes"` // totais por categoria
+	Erro           *string         `gorm:"type:text" json:"erro,omitempty"`
+	FinalizadaEm   *time.Time      `json:"finalizadaEm"`
+}
+
+func (ExecucaoRetencaoMidia) TableName() string {
+	return "execucoes_retencao_midia"
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessaoWhatsAppUsuario usuário autorizado a usar uma sessão do WhatsApp.
+// Sessões sem nenhum usuário vinculado podem ser usadas por toda a organização.
+type SessaoWhatsAppUsuario struct {
+	ID               string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SessaoWhatsAppID string    `gorm:"column:sessao_whatsapp_id;type:uuid;not null;uniqueIndex:idx_sessao_whatsapp_usuario" json:"sessaoWhatsappId"`
+	UsuarioID        string    `gorm:"type:uuid;not null;uniqueIndex:idx_sessao_whatsapp_usuario" json:"usuarioId"`
+	CriadoEm         time.Time `gorm:"autoCreateTime" json:"criadoEm"`
+
+	// Relacionamentos
+	Usuario Usuario `gorm:"foreignKey:UsuarioID" json:"usuario,omitempty"`
+}
+
+func (SessaoWhatsAppUsuario) TableName() string {
+	return "sessao_whatsapp_usuarios"
+}
+
+// StatusSessaoDoWAHA converte o status da sessão no WAHA no status local
+func StatusSessaoDoWAHA(status string) StatusSessao {
+	switch status {
+	case "WORKING":
+		return StatusSessaoConectado
+	case "FAILED":
+		return StatusSessaoFalhou
+	case "STOPPED":
+		return StatusSessaoDesconectado
+	default: // STARTING, SCAN_QR_CODE
+		return StatusSessaoConectando
+	}
+}
+
+// StatusConexao status equivalente usado pela API de conexões (/api/connections)
+func (s StatusSessao) StatusConexao() ConnectionStatus {
+	switch s {
+	case StatusSessaoConectado, StatusSessaoAutenticado:
+		return ConnectionStatusConnected
+	case StatusSessaoConectando:
+		return ConnectionStatusConnecting
+	case StatusSessaoFalhou:
+		return ConnectionStatusError
+	default:
+		return ConnectionStatusDisconnected
+	}
+}
+
+// StatusSessaoDaConexao converte o status da API de conexões no status da sessão
+func StatusSessaoDaConexao(status ConnectionStatus) StatusSessao {
+	switch status {
+	case ConnectionStatusConnected:
+		return StatusSessaoConectado
+	case ConnectionStatusConnecting:
+		return StatusSessaoConectando
+	case ConnectionStatusError:
+		return StatusSessaoFalhou
+	default:
+		return StatusSessaoDesconectado
+	}
+}
+
+// Conexao representa a sessão no formato da API de conexões, que antes era
+// gravado em user_connections
+func (s *SessaoWhatsApp) Conexao(usuarioID string) UserConnection {
+	conexao := UserConnection{
+		Platform:       PlatformWhatsApp,
+		Status:         s.Status.StatusConexao(),
+		SessionName:    &s.NomeSessao,
+		ConnectedAt:    s.ConectadoEm,
+		DisconnectedAt: s.DesconectadoEm,
+		LastSyncAt:     s.AtualizadoEm,
+		CreatedAt:      s.CriadoEm,
+		UpdatedAt:      s.AtualizadoEm,
+		SessionData: SessionData{
+			"sessao_id": s.ID,
+			"padrao":    s.Padrao,
+		},
+	}
+	conexao.ID, _ = uuid.Parse(s.ID)
+	conexao.UserID, _ = uuid.Parse(usuarioID)
+	if s.UltimaSincronizacao != nil {
+		conexao.LastSyncAt = *s.UltimaSincronizacao
+	}
+	if s.StatusWAHA != nil {
+		conexao.SessionData["waha_status"] = *s.StatusWAHA
+	}
+	if s.Rotulo != nil {
+		conexao.SessionData["rotulo"] = *s.Rotulo
+	}
+	if s.NumeroTelefone != nil {
+		conexao.SessionData["numero_telefone"] = *s.NumeroTelefone
+	}
+	return conexao
+}
+
+// Conectada indica se o status representa a sessão em funcionamento
+func (s StatusSessao) Conectada() bool {
+	return s == StatusSessaoConectado || s == StatusSessaoAutenticado
+}
+
+type TipoEventoSessao string
+
+const (
+	TipoEventoSessaoStatus         TipoEventoSessao = "STATUS"         // mudança de status
+	TipoEventoSessaoReinicio       TipoEventoSessao = "REINICIO"       // reinício automático pelo supervisor
+	TipoEventoSessaoReautenticacao TipoEventoSessao = "REAUTENTICACAO" // sessão aguardando leitura do QR
+)
+
+// OrigemEventoSessao quem detectou ou provocou o evento
+type OrigemEventoSessao string
+
+const (
+	OrigemEventoSessaoSupervisor OrigemEventoSessao = "SUPERVISOR" // verificação periódica no WAHA
+	OrigemEventoSessaoWebhook    OrigemEventoSessao = "WEBHOOK"    // evento session.status do WAHA
+	OrigemEventoSessaoAPI        OrigemEventoSessao = "API"        // ação de usuário pela API de conexões
+)
+
+// EventoSessaoWhatsApp histórico de disponibilidade de uma sessão, usado no
+// cálculo de uptime e quedas
+type EventoSessaoWhatsApp struct {
+	BaseModel
+	SessaoWhatsAppID string             `gorm:"column:sessao_whatsapp_id;type:uuid;not null;index:idx_eventos_sessao_whatsapp_horario" json:"sessaoWhatsappId"`
+	OrganizacaoID    string             `gorm:"type:uuid;index" json:"organizacaoId"`
+	Tipo             TipoEventoSessao   `gorm:"not null" json:"tipo"`
+	Origem           OrigemEventoSessao `gorm:"not null" json:"origem"`
+	StatusAnterior   StatusSessao       `json:"statusAnterior"`
+	StatusNovo       StatusSessao       `json:"statusNovo"`
+	StatusWAHA       *string            `gorm:"column:status_waha" json:"statusWaha"`
+	Detalhe          *string            `gorm:"type:text" json:"detalhe"`
+	Horario          time.Time          `gorm:"not null;index:idx_eventos_sessao_whatsapp_horario" json:"horario"`
+}
+
+func (EventoSessaoWhatsApp) TableName() string {
+	return "eventos_sessao_whatsapp"
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// PoliticaSLA define prazos de primeira resposta e resolução para atendimentos
+// vinculados a uma fila ou a contatos com uma tag específica
+type PoliticaSLA struct {
+	BaseModel
+	OrganizacaoID               string  `gorm:"type:uuid;index" json:"organizacaoId"`
+	Nome                        string  `gorm:"not null" json:"nome"`
+	Descricao                   *string `json:"descricao"`
+	FilaID                      *string `gorm:"index" json:"filaId"`
+	TagID                       *string `gorm:"index" json:"tagId"`
+	PrimeiraRespostaMinutos     int     `gorm:"not null;default:15" json:"primeiraRespostaMinutos"`
+	ResolucaoMinutos            int     `gorm:"not null;default:1440" json:"resolucaoMinutos"`
+	AvisoPercentual             int     `gorm:"not null;default:80" json:"avisoPercentual"` // % do prazo consumido para disparar aviso
+	Prioridade                  int     `gorm:"default:0" json:"prioridade"`                // maior prioridade vence em caso de conflito
+	EscalonarReatribuir         bool    `gorm:"default:false" json:"escalonarReatribuir"`
+	EscalonarAumentarPrioridade bool    `gorm:"default:false" json:"escalonarAumentarPrioridade"`
+	EscalonarNotificar          bool    `gorm:"default:false" json:"escalonarNotificar"`
+	ReatribuirParaID            *string `json:"reatribuirParaId"`
+	SupervisorID                *string `json:"supervisorId"`
+	Ativo                       bool    `gorm:"default:true" json:"ativo"`
+	CriadoPor                   *string `json:"criadoPor"`
+
+	// Relacionamentos
+	Tag            *Tag     `gorm:"foreignKey:TagID" json:"tag,omitempty"`
+	ReatribuirPara *Usuario `gorm:"foreignKey:ReatribuirParaID" json:"reatribuirPara,omitempty"`
+	Supervisor     *Usuario `gorm:"foreignKey:SupervisorID" json:"supervisor,omitempty"`
+}
+
+func (PoliticaSLA) TableName() string {
+	return "politicas_sla"
+}
+
+type TipoPrazoSLA string
+
+const (
+	TipoPrazoPrimeiraResposta TipoPrazoSLA = "PRIMEIRA_RESPOSTA"
+	TipoPrazoResolucao        TipoPrazoSLA = "RESOLUCAO"
+)
+
+type EstadoSLA string
+
+const (
+	EstadoSLANoPrazo  EstadoSLA = "NO_PRAZO"
+	EstadoSLAEmRisco  EstadoSLA = "EM_RISCO"
+	EstadoSLAViolado  EstadoSLA = "VIOLADO"
+	EstadoSLACumprido EstadoSLA = "CUMPRIDO"
+)
+
+// EventoSLA registra avisos e violações de SLA de um atendimento (histórico consultável)
+type EventoSLA struct {
+	BaseModel
+	OrganizacaoID   string       `gorm:"type:uuid;index" json:"organizacaoId"`
+	AtendimentoID   string       `gorm:"not null;index" json:"atendimentoId"`
+	PoliticaSLAID   string       `gorm:"not null;index" json:"politicaSlaId"`
+	TipoPrazo       TipoPrazoSLA `gorm:"not null" json:"tipoPrazo"`
+	Estado          EstadoSLA    `gorm:"not null;index" json:"estado"`
+	PrazoEm         time.Time    `gorm:"not null" json:"prazoEm"`
+	DetectadoEm     time.Time    `gorm:"not null;index" json:"detectadoEm"`
+	AgenteID        *string      `gorm:"index" json:"agenteId"`
+	FilaID          *string      `gorm:"index" json:"filaId"`
+	AcoesExecutadas *string      `gorm:"type:text" json:"acoesExecutadas"`
+
+	// Relacionamentos
+	Atendimento *Atendimento `gorm:"foreignKey:AtendimentoID" json:"atendimento,omitempty"`
+	PoliticaSLA *PoliticaSLA `gorm:"foreignKey:PoliticaSLAID" json:"politicaSla,omitempty"`
+}
+
+func (EventoSLA) TableName() string {
+	return "eventos_sla"
+}
@@ -0,0 +1,12 @@
+package models
+
+// StatusTranscricao situação da transcrição do áudio da mensagem. Nulo
+// quando a mensagem não foi enviada para transcrição.
+type StatusTranscricao string
+
+const (
+	StatusTranscricaoPendente  StatusTranscricao = "PENDENTE"
+	StatusTranscricaoConcluida StatusTranscricao = "CONCLUIDA"
+	StatusTranscricaoFalhou    StatusTranscricao = "FALHOU"
+	StatusTranscricaoIgnorada  StatusTranscricao = "IGNORADA" // áudio longo demais ou sem fala
+)
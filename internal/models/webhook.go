@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Eventos do CRM enviados aos webhooks de saída
+const (
+	EventoMensagemRecebida     = "mensagem.recebida"
+	EventoContatoCriado        = "contato.criado"
+	EventoCardMovido           = "card.movido"
+	EventoOrcamentoAprovado    = "orcamento.aprovado"
+	EventoCobrancaPaga         = "cobranca.paga"
+	EventoAtendimentoResolvido = "atendimento.resolvido"
+
+	// Enviado apenas pelo teste manual do webhook
+	EventoWebhookTeste = "webhook.teste"
+
+	// Assina todos os eventos
+	EventoWebhookTodos = "*"
+)
+
+// EventosWebhook catálogo de eventos que podem ser assinados
+var EventosWebhook = []string{
+	EventoMensagemRecebida,
+	EventoContatoCriado,
+	EventoCardMovido,
+	EventoOrcamentoAprovado,
+	EventoCobrancaPaga,
+	EventoAtendimentoResolvido,
+}
+
+// ListaEventosWebhook eventos assinados, armazenados como jsonb
+type ListaEventosWebhook []string
+
+// Inclui indica se a lista assina o evento
+func (l ListaEventosWebhook) Inclui(evento string) bool {
+	for _, e := range l {
+		if e == EventoWebhookTodos || e == evento {
+			return true
+		}
+	}
+	return false
+}
+
+func (l ListaEventosWebhook) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *ListaEventosWebhook) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, l)
+}
+
+// Webhook assinatura de eventos da organização entregue por HTTP POST.
+// Os payloads são assinados com HMAC-SHA256 usando o Segredo.
+type Webhook struct {
+	BaseModel
+	OrganizacaoID string              `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	Nome          string              `gorm:"not null" json:"nome"`
+	URL           string              `gorm:"not null" json:"url"`
+	Segredo       string              `gorm:"not null" json:"-"`
+	Eventos       ListaEventosWebhook `gorm:"type:jsonb;not null" json:"eventos"`
+	Ativo         bool                `gorm:"default:true" json:"ativo"`
+	CriadoPor     *string             `json:"criadoPor"`
+
+	// Tentativas com erro seguidas; ao atingir o limite o webhook é desativado
+	FalhasConsecutivas int        `gorm:"default:0" json:"falhasConsecutivas"`
+	DesativadoEm       *time.Time `json:"desativadoEm"`
+	MotivoDesativacao  *string    `json:"motivoDesativacao"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// Situação de uma entrega de webhook
+const (
+	StatusEntregaPendente  = "pendente"  // aguardando a primeira tentativa ou um novo retry
+	StatusEntregaEntregue  = "entregue"  // destino respondeu 2xx
+	StatusEntregaFalhou    = "falhou"    // tentativas esgotadas
+	StatusEntregaCancelada = "cancelada" // webhook excluído antes da entrega
+)
+
+// EntregaWebhook uma tentativa de entrega de evento; a tabela também serve de
+// fila persistente para os retries
+type EntregaWebhook struct {
+	BaseModel
+	WebhookID     string          `gorm:"type:uuid;not null;index" json:"webhookId"`
+	OrganizacaoID string          `gorm:"type:uuid;not null;index" json:"organizacaoId"`
+	EventoID      string          `gorm:"not null;index" json:"eventoId"` // igual em reenvios do mesmo evento
+	Evento        string          `gorm:"not null;index" json:"evento"`
+	Payload       json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+
+	Status             string     `gorm:"not null;default:pendente;index" json:"status"`
+	Tentativas         int        `gorm:"default:0" json:"tentativas"`
+	ProximaTentativaEm *time.Time `gorm:"index" json:"proximaTentativaEm"`
+	UltimaTentativaEm  *time.Time `json:"ultimaTentativaEm"`
+	EntregueEm         *time.Time `json:"entregueEm"`
+	StatusHTTP         *int       `json:"statusHttp"`
+	Resposta           *string    `gorm:"type:text" json:"resposta"`
+	Erro               *string    `gorm:"type:text" json:"erro"`
+	DuracaoMs          int64      `gorm:"default:0" json:"duracaoMs"`
+
+	// Entrega original quando criada por reenvio manual
+	ReenvioDeID *string `json:"reenvioDeId"`
+}
+
+func (EntregaWebhook) TableName() string {
+	return "entregas_webhook"
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Situação de um evento recebido que falhou no processamento
+const (
+	StatusFalhaWebhookPendente     = "pendente"     // aguardando reprocessamento
+	StatusFalhaWebhookReprocessado = "reprocessado" // reprocessado com sucesso
+)
+
+// EventoWebhookFalho evento recebido do WAHA cujo processamento falhou
+// (dead-letter). Guarda o corpo original para reprocessamento manual.
+type EventoWebhookFalho struct {
+	BaseModel
+	Origem        string                `gorm:"not null;index" json:"origem"` // rota que recebeu o evento
+	EventoID      *string               `gorm:"index" json:"eventoId"`
+	Evento        string                `gorm:"index" json:"evento"`
+	Sessao        string                `gorm:"index" json:"sessao"`
+	OrganizacaoID *string               `gorm:"type:uuid;index" json:"organizacaoId"`
+	Payload       json.RawMessage       `gorm:"type:jsonb;not null" json:"payload"`
+	Erro          string                `gorm:"type:text" json:"erro"`
+	Consumidores  ListaConsumidoresWAHA `gorm:"type:jsonb" json:"consumidores"` // consumidores que falharam; vazio reprocessa todos
+	Tentativas    int                   `gorm:"default:1" json:"tentativas"`
+	Status        string                `gorm:"not null;default:pendente;index" json:"status"`
+
+	ReprocessadoEm  *time.Time `json:"reprocessadoEm"`
+	ReprocessadoPor *string    `json:"reprocessadoPor"`
+}
+
+func (EventoWebhookFalho) TableName() string {
+	return "eventos_webhook_falhos"
+}
+
+// ListaConsumidoresWAHA nomes dos consumidores do despachante, armazenados como jsonb
+type ListaConsumidoresWAHA []string
+
+func (l ListaConsumidoresWAHA) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *ListaConsumidoresWAHA) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, l)
+}
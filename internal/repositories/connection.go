@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +20,18 @@ func NewConnectionRepository(db *gorm.DB) *ConnectionRepository {
 
 // GetUserConnection retrieves a user's connection for a specific platform
 func (r *ConnectionRepository) GetUserConnection(userID uuid.UUID, platform models.Platform) (*models.UserConnection, error) {
+	if platform == models.PlatformWhatsApp {
+		sessao, err := r.sessaoWhatsApp(userID, nil)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		connection := sessao.Conexao(userID.String())
+		return &connection, nil
+	}
+
 	var connection models.UserConnection
 	
 	err := r.db.Where("user_id = ? AND platform = ?", userID, platform).First(&connection).Error
@@ -36,16 +49,43 @@ func (r *ConnectionRepository) GetUserConnection(userID uuid.UUID, platform mode
 func (r *ConnectionRepository) GetUserConnections(userID uuid.UUID) ([]models.UserConnection, error) {
 	var connections []models.UserConnection
 	
-	err := r.db.Where("user_id = ?", userID).Order("platform").Find(&connections).Error
+	err := r.db.Where("user_id = ? AND platform <> ?", userID, models.PlatformWhatsApp).Order("platform").Find(&connections).Error
 	if err != nil {
 		return nil, err
 	}
+
+	// WhatsApp: uma conexão por sessão que o usuário pode usar
+	var usuario models.Usuario
+	if err := r.db.Select("id", "organizacao_id").Where("id = ?", userID).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+	if usuario.OrganizacaoID == "" {
+		return connections, nil
+	}
+	sessoes, err := NewSessaoWhatsAppRepository(r.db).ListarPermitidas(usuario.OrganizacaoID, usuario.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessoes {
+		connections = append(connections, sessoes[i].Conexao(usuario.ID))
+	}
 	
 	return connections, nil
 }
 
 // CreateOrUpdateUserConnection creates or updates a user's connection
 func (r *ConnectionRepository) CreateOrUpdateUserConnection(userID uuid.UUID, req *models.CreateUserConnectionRequest) (*models.UserConnection, error) {
+	if req.Platform == models.PlatformWhatsApp {
+		sessao, err := r.sessaoWhatsApp(userID, req.SessionName)
+		if errors.Is(err, gorm.ErrRecordNotFound) && (req.SessionName == nil || *req.SessionName == NomeSessaoLegada(userID.String())) {
+			sessao, err = r.sessaoLegada(userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r.atualizarSessaoWhatsApp(userID, sessao, &req.Status, req.SessionData)
+	}
+
 	now := time.Now()
 	
 	connection := models.UserConnection{
@@ -85,6 +125,14 @@ func (r *ConnectionRepository) CreateOrUpdateUserConnection(userID uuid.UUID, re
 
 // UpdateUserConnection updates an existing user connection
 func (r *ConnectionRepository) UpdateUserConnection(userID uuid.UUID, platform models.Platform, req *models.UpdateUserConnectionRequest) (*models.UserConnection, error) {
+	if platform == models.PlatformWhatsApp {
+		sessao, err := r.sessaoWhatsApp(userID, req.SessionName)
+		if err != nil {
+			return nil, err
+		}
+		return r.atualizarSessaoWhatsApp(userID, sessao, req.Status, req.SessionData)
+	}
+
 	var connection models.UserConnection
 	
 	// Find existing connection
@@ -133,6 +181,16 @@ func (r *ConnectionRepository) UpdateUserConnection(userID uuid.UUID, platform m
 
 // DeleteUserConnection deletes a user's connection
 func (r *ConnectionRepository) DeleteUserConnection(userID uuid.UUID, platform models.Platform) error {
+	if platform == models.PlatformWhatsApp {
+		sessao, err := r.sessaoWhatsApp(userID, nil)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return NewSessaoWhatsAppRepository(r.db).AtualizarStatus(sessao, models.StatusSessaoDesconectado, "", models.OrigemEventoSessaoAPI)
+	}
 	return r.db.Where("user_id = ? AND platform = ?", userID, platform).Delete(&models.UserConnection{}).Error
 }
 
@@ -140,10 +198,75 @@ func (r *ConnectionRepository) DeleteUserConnection(userID uuid.UUID, platform m
 func (r *ConnectionRepository) GetConnectionsByStatus(status models.ConnectionStatus) ([]models.UserConnection, error) {
 	var connections []models.UserConnection
 	
-	err := r.db.Where("status = ?", status).Order("updated_at DESC").Find(&connections).Error
+	err := r.db.Where("status = ? AND platform <> ?", status, models.PlatformWhatsApp).Order("updated_at DESC").Find(&connections).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var sessoes []models.SessaoWhatsApp
+	err = r.db.Where("status IN ?", statusSessaoDaConexao(status)).Order("atualizado_em DESC").Find(&sessoes).Error
 	if err != nil {
 		return nil, err
 	}
+	for i := range sessoes {
+		connections = append(connections, sessoes[i].Conexao(sessoes[i].UsuarioID))
+	}
 	
 	return connections, nil
 }
+
+// sessaoWhatsApp sessão que representa a conexão do WhatsApp do usuário: a de
+// nome informado ou a padrão dele. O estado das conexões do WhatsApp fica nas
+// sessões (sessoes_whatsapp); user_connections guarda apenas as demais plataformas.
+func (r *ConnectionRepository) sessaoWhatsApp(userID uuid.UUID, sessionName *string) (*models.SessaoWhatsApp, error) {
+	var usuario models.Usuario
+	if err := r.db.Select("id", "organizacao_id").Where("id = ?", userID).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+	sessoes := NewSessaoWhatsAppRepository(r.db)
+	if sessionName != nil && *sessionName != "" {
+		return sessoes.BuscarPermitida(usuario.OrganizacaoID, usuario.ID, *sessionName)
+	}
+	return sessoes.PadraoDoUsuario(usuario.OrganizacaoID, usuario.ID)
+}
+
+// BuscarSessaoWhatsApp sessão de nome (ou id) informado, desde que seja da
+// organização do usuário e liberada a ele
+func (r *ConnectionRepository) BuscarSessaoWhatsApp(userID uuid.UUID, sessionName string) (*models.SessaoWhatsApp, error) {
+	return r.sessaoWhatsApp(userID, &sessionName)
+}
+
+func (r *ConnectionRepository) sessaoLegada(userID uuid.UUID) (*models.SessaoWhatsApp, error) {
+	var usuario models.Usuario
+	if err := r.db.Select("id", "organizacao_id").Where("id = ?", userID).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+	return NewSessaoWhatsAppRepository(r.db).SessaoLegada(usuario.OrganizacaoID, usuario.ID)
+}
+
+func (r *ConnectionRepository) atualizarSessaoWhatsApp(userID uuid.UUID, sessao *models.SessaoWhatsApp, status *models.ConnectionStatus, dados models.SessionData) (*models.UserConnection, error) {
+	novo := sessao.Status
+	if status != nil {
+		novo = models.StatusSessaoDaConexao(*status)
+	}
+	statusWAHA, _ := dados["waha_status"].(string)
+
+	sessoes := NewSessaoWhatsAppRepository(r.db)
+	if err := sessoes.AtualizarStatus(sessao, novo, statusWAHA, models.OrigemEventoSessaoAPI); err != nil {
+		return nil, err
+	}
+	atualizada, err := sessoes.BuscarPorNomeNaOrganizacao(sessao.OrganizacaoID, sessao.NomeSessao)
+	if err != nil {
+		return nil, err
+	}
+	connection := atualizada.Conexao(userID.String())
+	return &connection, nil
+}
+
+// statusSessaoDaConexao status de sessão equivalentes ao status de conexão
+func statusSessaoDaConexao(status models.ConnectionStatus) []models.StatusSessao {
+	if status == models.ConnectionStatusConnected {
+		return []models.StatusSessao{models.StatusSessaoConectado, models.StatusSessaoAutenticado}
+	}
+	return []models.StatusSessao{models.StatusSessaoDaConexao(status)}
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"tappyone/internal/models"
+)
+
+// ErrOrganizacaoNaoInformada consulta escopada sem organização no contexto
+var ErrOrganizacaoNaoInformada = errors.New("organização não informada")
+
+// PorOrganizacao restringe a consulta aos registros da organização na tabela
+// principal. Uso: db.Scopes(repositories.PorOrganizacao(orgID)).Find(&tags)
+func PorOrganizacao(organizacaoID string) func(*gorm.DB) *gorm.DB {
+	return PorOrganizacaoAlias(clause.CurrentTable, organizacaoID)
+}
+
+// PorOrganizacaoAlias igual a PorOrganizacao, para consultas com alias ou joins
+func PorOrganizacaoAlias(alias, organizacaoID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if organizacaoID == "" {
+			db.AddError(ErrOrganizacaoNaoInformada)
+			return db
+		}
+		return db.Where(clause.Eq{
+			Column: clause.Column{Table: alias, Name: "organizacao_id"},
+			Value:  organizacaoID,
+		})
+	}
+}
+
+// CondicaoOrganizacao versão em SQL cru para consultas montadas com Raw/Where string
+func CondicaoOrganizacao(alias string) string {
+	if alias == "" {
+		return "organizacao_id = ?"
+	}
+	return alias + ".organizacao_id = ?"
+}
+
+type OrganizacaoRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizacaoRepository(db *gorm.DB) *OrganizacaoRepository {
+	return &OrganizacaoRepository{db: db}
+}
+
+// GetByID busca a organização
+func (r *OrganizacaoRepository) GetByID(id string) (*models.Organizacao, error) {
+	var organizacao models.Organizacao
+	if err := r.db.First(&organizacao, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &organizacao, nil
+}
+
+// BuscarContatoPorTelefone busca o contato pelo número dentro da organização
+func (r *OrganizacaoRepository) BuscarContatoPorTelefone(organizacaoID, telefone string) (*models.Contato, error) {
+	var contato models.Contato
+	err := r.db.Scopes(PorOrganizacao(organizacaoID)).
+		Where("numero_telefone = ?", telefone).
+		First(&contato).Error
+	if err != nil {
+		return nil, err
+	}
+	return &contato, nil
+}
+
+// BuscarOuCriarContato busca o contato pelo número na organização ou cria um
+// novo vinculado à sessão padrão da organização
+func (r *OrganizacaoRepository) BuscarOuCriarContato(organizacaoID, usuarioID, telefone string) (*models.Contato, error) {
+	contato, err := r.BuscarContatoPorTelefone(organizacaoID, telefone)
+	if err == nil {
+		return contato, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	sessao, err := r.SessaoPadrao(organizacaoID, usuarioID)
+	if err != nil {
+		return nil, err
+	}
+
+	novo := models.Contato{
+		NumeroTelefone:   telefone,
+		Nome:             &telefone, // número como nome temporário
+		SessaoWhatsappID: sessao.ID,
+		OrganizacaoID:    organizacaoID,
+	}
+	if err := r.db.Create(&novo).Error; err != nil {
+		return nil, err
+	}
+	return &novo, nil
+}
+
+// SessaoPadrao retorna a sessão padrão do usuário na organização, criando a
+// sessão user_{uuid} quando ele ainda não tem acesso a nenhuma
+func (r *OrganizacaoRepository) SessaoPadrao(organizacaoID, usuarioID string) (*models.SessaoWhatsApp, error) {
+	sessoes := NewSessaoWhatsAppRepository(r.db)
+	sessao, err := sessoes.PadraoDoUsuario(organizacaoID, usuarioID)
+	if err == nil {
+		return sessao, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return sessoes.SessaoLegada(organizacaoID, usuarioID)
+}
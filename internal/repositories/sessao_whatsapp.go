@@ -0,0 +1,297 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"tappyone/internal/models"
+)
+
+// SessoesPermitidas restringe a consulta às sessões que o usuário pode usar:
+// as criadas por ele, as sem lista de usuários e as em que ele está na lista
+func SessoesPermitidas(usuarioID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`sessoes_whatsapp.usuario_id = ?
+			OR NOT EXISTS (SELECT 1 FROM sessao_whatsapp_usuarios su WHERE su.sessao_whatsapp_id = sessoes_whatsapp.id)
+			OR EXISTS (SELECT 1 FROM sessao_whatsapp_usuarios su WHERE su.sessao_whatsapp_id = sessoes_whatsapp.id AND su.usuario_id = ?)`,
+			usuarioID, usuarioID)
+	}
+}
+
+type SessaoWhatsAppRepository struct {
+	db *gorm.DB
+}
+
+func NewSessaoWhatsAppRepository(db *gorm.DB) *SessaoWhatsAppRepository {
+	return &SessaoWhatsAppRepository{db: db}
+}
+
+// ListarPermitidas sessões da organização que o usuário pode usar, a padrão primeiro
+func (r *SessaoWhatsAppRepository) ListarPermitidas(organizacaoID, usuarioID string) ([]models.SessaoWhatsApp, error) {
+	var sessoes []models.SessaoWhatsApp
+	err := r.db.Scopes(PorOrganizacao(organizacaoID), SessoesPermitidas(usuarioID)).
+		Preload("UsuariosPermitidos").
+		Order("padrao DESC, criado_em ASC").
+		Find(&sessoes).Error
+	return sessoes, err
+}
+
+// BuscarPermitida busca pelo id ou pelo nome uma sessão que o usuário pode usar
+func (r *SessaoWhatsAppRepository) BuscarPermitida(organizacaoID, usuarioID, idOuNome string) (*models.SessaoWhatsApp, error) {
+	var sessao models.SessaoWhatsApp
+	query := r.db.Scopes(PorOrganizacao(organizacaoID), SessoesPermitidas(usuarioID))
+	if _, err := uuid.Parse(idOuNome); err == nil {
+		query = query.Where("id = ? OR nome_sessao = ?", idOuNome, idOuNome)
+	} else {
+		query = query.Where("nome_sessao = ?", idOuNome)
+	}
+	if err := query.First(&sessao).Error; err != nil {
+		return nil, err
+	}
+	return &sessao, nil
+}
+
+// DaConversa sessão ativa, permitida ao usuário, com a conversa mais recente no chat
+func (r *SessaoWhatsAppRepository) DaConversa(organizacaoID, usuarioID, chatID string) (*models.SessaoWhatsApp, error) {
+	var sessao models.SessaoWhatsApp
+	err := r.db.Scopes(PorOrganizacao(organizacaoID), SessoesPermitidas(usuarioID)).
+		Joins("JOIN conversas ON conversas.sessao_whatsapp_id = sessoes_whatsapp.id").
+		Where("conversas.id_conversa = ? AND sessoes_whatsapp.ativo = ?", chatID, true).
+		Order("conversas.horario_ultima_mensagem DESC NULLS LAST").
+		First(&sessao).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sessao, nil
+}
+
+// PadraoDoUsuario sessão ativa usada pelo usuário quando o chat ainda não tem
+// conversa: a marcada como padrão da organização, senão a mais antiga permitida
+func (r *SessaoWhatsAppRepository) PadraoDoUsuario(organizacaoID, usuarioID string) (*models.SessaoWhatsApp, error) {
+	var sessao models.SessaoWhatsApp
+	err := r.db.Scopes(PorOrganizacao(organizacaoID), SessoesPermitidas(usuarioID)).
+		Where("ativo = ?", true).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "padrao DESC, (usuario_id = ?) DESC, criado_em ASC",
+			Vars:               []interface{}{usuarioID},
+			WithoutParentheses: true,
+		}}).
+		First(&sessao).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sessao, nil
+}
+
+// BuscarPorNomeNaOrganizacao busca a sessão da organização pelo nome usado no WAHA
+func (r *SessaoWhatsAppRepository) BuscarPorNomeNaOrganizacao(organizacaoID, nome string) (*models.SessaoWhatsApp, error) {
+	var sessao models.SessaoWhatsApp
+	if err := r.db.Scopes(PorOrganizacao(organizacaoID)).Where("nome_sessao = ?", nome).First(&sessao).Error; err != nil {
+		return nil, err
+	}
+	return &sessao, nil
+}
+
+// BuscarPorNome busca a sessão pelo nome usado no WAHA, em qualquer organização.
+// Usado apenas onde não há organização no contexto (webhooks do WAHA).
+func (r *SessaoWhatsAppRepository) BuscarPorNome(nome string) (*models.SessaoWhatsApp, error) {
+	var sessao models.SessaoWhatsApp
+	if err := r.db.Where("nome_sessao = ?", nome).First(&sessao).Error; err != nil {
+		return nil, err
+	}
+	return &sessao, nil
+}
+
+// SessaoLegada busca ou cria a sessão no formato antigo user_{uuid}, usada
+// pelos usuários que ainda não cadastraram sessões nomeadas
+func (r *SessaoWhatsAppRepository) SessaoLegada(organizacaoID, usuarioID string) (*models.SessaoWhatsApp, error) {
+	if organizacaoID == "" {
+		return nil, ErrOrganizacaoNaoInformada
+	}
+	nome := NomeSessaoLegada(usuarioID)
+	sessao, err := r.BuscarPorNomeNaOrganizacao(organizacaoID, nome)
+	if err == nil {
+		return sessao, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	nova := models.SessaoWhatsApp{
+		NomeSessao:    nome,
+		UsuarioID:     usuarioID,
+		OrganizacaoID: organizacaoID,
+		Status:        models.StatusSessaoDesconectado,
+		Ativo:         true,
+	}
+	if err := r.db.Create(&nova).Error; err != nil {
+		return nil, err
+	}
+	return &nova, nil
+}
+
+// AtualizarStatus grava o status da sessão e os horários de conexão. Cada
+// mudança de status fica no histórico da sessão com a origem informada.
+func (r *SessaoWhatsAppRepository) AtualizarStatus(sessao *models.SessaoWhatsApp, status models.StatusSessao, statusWAHA string, origem models.OrigemEventoSessao) error {
+	agora := time.Now()
+	updates := map[string]interface{}{
+		"status":               status,
+		"ultima_sincronizacao": agora,
+	}
+	if statusWAHA != "" {
+		updates["status_waha"] = statusWAHA
+	}
+	if status.Conectada() {
+		// Sessão de volta: encerra o ciclo de reinícios e de alerta de QR
+		updates["tentativas_reinicio"] = 0
+		updates["proximo_reinicio_em"] = nil
+		updates["reautenticacao_alertada_em"] = nil
+	}
+	if status == sessao.Status {
+		return r.db.Model(sessao).Updates(updates).Error
+	}
+
+	switch status {
+	case models.StatusSessaoConectado:
+		updates["conectado_em"] = agora
+		updates["desconectado_em"] = nil
+	case models.StatusSessaoDesconectado, models.StatusSessaoFalhou:
+		updates["desconectado_em"] = agora
+	}
+
+	evento := &models.EventoSessaoWhatsApp{
+		SessaoWhatsAppID: sessao.ID,
+		OrganizacaoID:    sessao.OrganizacaoID,
+		Tipo:             models.TipoEventoSessaoStatus,
+		Origem:           origem,
+		StatusAnterior:   sessao.Status,
+		StatusNovo:       status,
+		Horario:          agora,
+	}
+	if statusWAHA != "" {
+		evento.StatusWAHA = &statusWAHA
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(sessao).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(evento).Error
+	})
+}
+
+// RegistrarEvento grava um evento avulso (reinício, reautenticação) no histórico
+func (r *SessaoWhatsAppRepository) RegistrarEvento(sessao *models.SessaoWhatsApp, tipo models.TipoEventoSessao, origem models.OrigemEventoSessao, statusWAHA, detalhe string) error {
+	evento := &models.EventoSessaoWhatsApp{
+		SessaoWhatsAppID: sessao.ID,
+		OrganizacaoID:    sessao.OrganizacaoID,
+		Tipo:             tipo,
+		Origem:           origem,
+		StatusAnterior:   sessao.Status,
+		StatusNovo:       sessao.Status,
+		Horario:          time.Now(),
+	}
+	if statusWAHA != "" {
+		evento.StatusWAHA = &statusWAHA
+	}
+	if detalhe != "" {
+		evento.Detalhe = &detalhe
+	}
+	return r.db.Create(evento).Error
+}
+
+// UltimaMudancaDeStatus último evento de mudança de status da sessão
+func (r *SessaoWhatsAppRepository) UltimaMudancaDeStatus(sessaoID string) (*models.EventoSessaoWhatsApp, error) {
+	var evento models.EventoSessaoWhatsApp
+	err := r.db.Where("sessao_whatsapp_id = ? AND tipo = ?", sessaoID, models.TipoEventoSessaoStatus).
+		Order("horario DESC").
+		First(&evento).Error
+	if err != nil {
+		return nil, err
+	}
+	return &evento, nil
+}
+
+// EventosDesde histórico da sessão a partir do horário informado, em ordem cronológica
+func (r *SessaoWhatsAppRepository) EventosDesde(sessaoID string, desde time.Time) ([]models.EventoSessaoWhatsApp, error) {
+	var eventos []models.EventoSessaoWhatsApp
+	err := r.db.Where("sessao_whatsapp_id = ? AND horario >= ?", sessaoID, desde).
+		Order("horario ASC").
+		Find(&eventos).Error
+	return eventos, err
+}
+
+// StatusEm status da sessão no horário informado segundo o histórico. Retorna
+// vazio quando não há mudança registrada antes desse horário.
+func (r *SessaoWhatsAppRepository) StatusEm(sessaoID string, horario time.Time) (models.StatusSessao, error) {
+	var evento models.EventoSessaoWhatsApp
+	err := r.db.Where("sessao_whatsapp_id = ? AND tipo = ? AND horario < ?", sessaoID, models.TipoEventoSessaoStatus, horario).
+		Order("horario DESC").
+		First(&evento).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return evento.StatusNovo, nil
+}
+
+// AgendarReinicio grava a tentativa de reinício e o horário da próxima
+func (r *SessaoWhatsAppRepository) AgendarReinicio(sessao *models.SessaoWhatsApp, tentativas int, proximo time.Time) error {
+	return r.db.Model(sessao).Updates(map[string]interface{}{
+		"tentativas_reinicio": tentativas,
+		"proximo_reinicio_em": proximo,
+	}).Error
+}
+
+// MarcarReautenticacaoAlertada evita repetir o alerta de QR na mesma queda.
+// Retorna false quando a queda já havia sido marcada (por outra réplica ou evento).
+func (r *SessaoWhatsAppRepository) MarcarReautenticacaoAlertada(sessao *models.SessaoWhatsApp) (bool, error) {
+	agora := time.Now()
+	result := r.db.Model(&models.SessaoWhatsApp{}).
+		Where("id = ? AND reautenticacao_alertada_em IS NULL", sessao.ID).
+		Update("reautenticacao_alertada_em", agora)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return false, nil
+	}
+	sessao.ReautenticacaoAlertadaEm = &agora
+	return true, nil
+}
+
+// NomeSessaoLegada nome da sessão única por usuário usado antes das sessões nomeadas
+func NomeSessaoLegada(usuarioID string) string {
+	return fmt.Sprintf("user_%s", usuarioID)
+}
+
+// ErrNomeSessaoInvalido nome de sessão com caracteres inválidos ou reservado
+var ErrNomeSessaoInvalido = errors.New("nome da sessão inválido: use até 40 letras, números, _ ou -, sem o prefixo user_")
+
+var nomeSessaoValido = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,40}$`)
+
+// NomeSessaoOrganizacao nome da sessão no WAHA. O nome é global no WAHA e
+// identifica a organização dos webhooks recebidos, por isso é prefixado pela
+// organização: uma organização não consegue reservar o nome de outra. O
+// prefixo user_ fica reservado às sessões legadas.
+func NomeSessaoOrganizacao(organizacaoID, nome string) (string, error) {
+	id, err := uuid.Parse(organizacaoID)
+	if err != nil {
+		return "", ErrOrganizacaoNaoInformada
+	}
+	prefixo := "org" + strings.ReplaceAll(id.String(), "-", "")[:12] + "_"
+
+	// Nome já prefixado pela própria organização (ex.: reenviado pelo frontend)
+	nome = strings.TrimPrefix(nome, prefixo)
+	if !nomeSessaoValido.MatchString(nome) || strings.HasPrefix(nome, "user_") {
+		return "", ErrNomeSessaoInvalido
+	}
+	return prefixo + nome, nil
+}
@@ -1,11 +1,12 @@
 package router
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"strconv"
 	"tappyone/internal/handlers"
 	"tappyone/internal/middleware"
+	"tappyone/internal/models"
 	"tappyone/internal/services"
 	"tappyone/internal/utils"
 
@@ -18,7 +19,7 @@ func Setup(container *services.Container) *gin.Engine {
 	r := gin.Default()
 
 	// Inicializar WebSocket Hub
-	handlers.InitWebSocketHub()
+	handlers.InitWebSocketHub(container.RealtimeService, container.WhatsAppService, container.PermissionService, container.Config)
 
 	// CORS - habilitado sempre para desenvolvimento
 	config := cors.DefaultConfig()
@@ -38,37 +39,60 @@ func Setup(container *services.Container) *gin.Engine {
 
 	// Inicializar handlers
 	log.Printf("[ROUTER] Inicializando handlers...")
-	authHandler := handlers.NewAuthHandler(container.AuthService)
-	userHandler := handlers.NewUserHandler(container.UserService)
-	contatoHandler := handlers.NewContatosHandler(container.DB)
-	kanbanHandler := handlers.NewKanbanHandler(container.KanbanService)
+	authHandler := handlers.NewAuthHandler(container.AuthService, container.RateLimiter)
+	userHandler := handlers.NewUserHandler(container.UserService, container.PermissionService, container.AuditoriaService)
+	contatoHandler := handlers.NewContatosHandler(container.DB, container.PermissionService, container.AuditoriaService, container.WebhookService)
+	kanbanHandler := handlers.NewKanbanHandler(container.KanbanService, container.WebhookService)
 	agendamentoHandler := handlers.NewAgendamentosHandler(container.DB)
 	log.Printf("[ROUTER] AgendamentosHandler criado: %v", agendamentoHandler != nil)
-	orcamentoHandler := handlers.NewOrcamentosHandler(container.DB)
-	whatsAppHandler := handlers.NewWhatsAppHandler(container.WhatsAppService)
+	orcamentoHandler := handlers.NewOrcamentosHandler(container.DB, container.WebhookService)
+	whatsAppHandler := handlers.NewWhatsAppHandler(container.WhatsAppService, container.AuditoriaService, container.MidiaService, container.ProcessamentoMidia, container.Transcricao)
 	fluxosHandler := handlers.NewFluxosHandler(container.DB, container.FluxoExecutionService)
 	respostaRapidaHandler := handlers.NewRespostaRapidaHandler(container.RespostaRapidaService)
-	connectionHandler := handlers.NewConnectionHandler(container.ConnectionService)
+	connectionHandler := handlers.NewConnectionHandler(container.ConnectionService, container.AuditoriaService)
 	anotacoesHandler := handlers.NewAnotacoesHandler(container.DB)
 	log.Printf("[ROUTER] AnotacoesHandler criado: %v", anotacoesHandler != nil)
-	assinaturasHandler := handlers.NewAssinaturasHandler(container.DB)
+	assinaturasHandler := handlers.NewAssinaturasHandler(container.DB, container.AuditoriaService)
 	log.Printf("[ROUTER] AssinaturasHandler criado: %v", assinaturasHandler != nil)
-	whatsappMediaHandler := handlers.NewWhatsAppMediaHandler(container.WhatsAppService, container.AuthService)
+	whatsappMediaHandler := handlers.NewWhatsAppMediaHandler(container.WhatsAppService, container.AuthService, container.MidiaService, container.ProcessamentoMidia)
+	buscaMensagensHandler := handlers.NewBuscaMensagensHandler(container.MessageService, container.PermissionService)
 	filasHandler := handlers.NewFilasHandler(container.DB)
 	tagsHandler := handlers.NewTagsHandler(container.DB, container.AuthService)
 	alertasHandler := handlers.NewAlertasHandler(container.DB, container.AuthService)
 	atendimentoStatsHandler := handlers.NewAtendimentoStatsHandler(container.WhatsAppService, container.DB)
-	sessoesWhatsAppHandler := handlers.NewSessoesWhatsAppHandler(container.DB)
+	sessoesWhatsAppHandler := handlers.NewSessoesWhatsAppHandler(container.DB, container.AuditoriaService, container.SupervisorSessoes, container.AgendadorEnvios)
+	importacaoHistoricoHandler := handlers.NewImportacaoHistoricoHandler(container.DB, container.ImportacaoHistorico, container.AuditoriaService)
+	slaHandler := handlers.NewSLAHandler(container.DB, container.SLAService)
+	papeisHandler := handlers.NewPapeisHandler(container.DB, container.PermissionService, container.AuditoriaService)
+	organizacaoHandler := handlers.NewOrganizacaoHandler(container.OrganizacaoService, container.PermissionService, container.UserService, container.RateLimiter, container.AuditoriaService, container.Config)
+	chaveAPIHandler := handlers.NewChaveAPIHandler(container.ChaveAPIService, container.PermissionService, container.AuditoriaService)
+	auditoriaHandler := handlers.NewAuditoriaHandler(container.AuditoriaService)
+	webhooksHandler := handlers.NewWebhooksHandler(container.WebhookService, container.AuditoriaService)
+	campanhaHandler := handlers.NewCampanhaHandler(container.Campanhas, container.AuditoriaService)
+	webhookEntradaHandler := handlers.NewWebhookEntradaHandler(container.IngestaoWebhookService, container.AuditoriaService)
+	atendimentosHandler := handlers.NewAtendimentosHandler(container.DB, container.AuditoriaService, container.WebhookService)
+	cobrancaHandler := handlers.NewCobrancaHandler(container.DB, container.AuditoriaService, container.WebhookService)
+	mediaHandler := handlers.NewMediaHandler(container.MidiaService, container.ProcessamentoMidia, container.RetencaoMidia, container.AuditoriaService, container.Config)
+	retencaoMidiaHandler := handlers.NewRetencaoMidiaHandler(container.MidiaService, container.RetencaoMidia, container.AuditoriaService)
+	transcricaoHandler := handlers.NewTranscricaoHandler(container.Transcricao, container.OrganizacaoService, container.WhatsAppService, container.AuditoriaService)
 	log.Printf("[ROUTER] Todos os handlers criados com sucesso")
 
-	// Servir arquivos estáticos (uploads)
-	r.Static("/uploads", "./uploads")
-
 	// Rotas públicas
 	public := r.Group("/api")
 	{
 		public.POST("/auth/login", authHandler.Login)
-		public.POST("/usuarios/reset-password", authHandler.ResetPassword)
+		public.POST("/auth/refresh", authHandler.Refresh)
+		public.POST("/auth/logout", authHandler.Logout)
+		public.POST("/auth/forgot-password", authHandler.ForgotPassword)
+		public.POST("/auth/reset-password", authHandler.ResetPassword)
+		public.POST("/auth/2fa/verificar", authHandler.VerificarDoisFatores)
+		public.POST("/auth/2fa/cadastro", authHandler.IniciarCadastroDoisFatoresLogin)
+		public.POST("/auth/2fa/cadastro/confirmar", authHandler.ConcluirCadastroDoisFatoresLogin)
+		public.POST("/organizacoes", organizacaoHandler.CriarOrganizacao)
+		public.GET("/convites/:token", organizacaoHandler.ObterConvite)
+		// Mídia servida apenas por URL assinada e com validade
+		public.GET("/media/:id/conteudo", mediaHandler.ServirMidia)
+		public.POST("/convites/aceitar", organizacaoHandler.AceitarConvite)
 		public.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok", "message": "TappyOne CRM API"})
 		})
@@ -83,33 +107,163 @@ func Setup(container *services.Container) *gin.Engine {
 		c.JSON(200, gin.H{"message": "Backend is working!", "timestamp": "2025-01-20"})
 	})
 
-	// WebSocket route (with JWT auth via query param)
-	r.GET("/ws", handlers.NewWebSocketHandler(container.AuthService, container.Config.JWTSecret))
+	// WebSocket route (auth via ticket or Sec-WebSocket-Protocol)
+	r.GET("/ws", handlers.NewWebSocketHandler(container.AuthService))
 
-	// Webhook específico para respostas rápidas
-	r.POST("/webhooks/resposta-rapida", respostaRapidaHandler.ProcessarMensagemWebhook)
+	// Permissões (recurso × ação): grupos usam a ação derivada do método HTTP
+	// e rotas específicas exigem permissões adicionais
+	porRecurso := func(recurso models.Recurso) gin.HandlerFunc {
+		return middleware.RequireResourcePermission(container.PermissionService, recurso)
+	}
+	requer := func(recurso models.Recurso, acao models.Acao) gin.HandlerFunc {
+		return middleware.RequirePermission(container.PermissionService, models.NovaPermissao(recurso, acao))
+	}
+	escopoChat := middleware.RequireChatScope(container.PermissionService)
+	// Rotas de conta e segurança não aceitam chave de API
+	somenteUsuario := middleware.RequireUserSession()
+
+	// chatNoEscopo valida chats recebidos no corpo da requisição (rotas sem :chatId)
+	chatNoEscopo := func(c *gin.Context, chatID string) bool {
+		escopo, err := container.PermissionService.EscopoAtendimento(c.GetString("user_id"))
+		if err == nil {
+			if permitido, err := container.PermissionService.PodeAcessarChat(escopo, chatID); err == nil && permitido {
+				return true
+			}
+		}
+		c.JSON(404, gin.H{"error": "Chat não encontrado"})
+		return false
+	}
 
 	// Rotas protegidas
 	protected := r.Group("/api")
-	protected.Use(middleware.AuthMiddleware(container.AuthService))
+	protected.Use(middleware.AuthMiddleware(container.AuthService, container.ChaveAPIService))
 	{
 		// Auth
 		protected.GET("/auth/me", authHandler.Me)
+		protected.GET("/auth/permissions", papeisHandler.MinhasPermissoes)
+		protected.POST("/auth/logout-all", somenteUsuario, authHandler.LogoutAll)
+		protected.GET("/auth/historico-login", somenteUsuario, authHandler.HistoricoLogin)
+
+		// Autenticação em dois fatores
+		protected.GET("/auth/2fa", somenteUsuario, authHandler.StatusDoisFatores)
+		protected.POST("/auth/2fa/configurar", somenteUsuario, authHandler.ConfigurarDoisFatores)
+		protected.POST("/auth/2fa/ativar", somenteUsuario, authHandler.AtivarDoisFatores)
+		protected.POST("/auth/2fa/desativar", somenteUsuario, authHandler.DesativarDoisFatores)
+		protected.POST("/auth/2fa/codigos-recuperacao", somenteUsuario, authHandler.GerarCodigosRecuperacao)
+
+		// Chaves de API da organização
+		chavesAPI := protected.Group("/chaves-api")
+		chavesAPI.Use(somenteUsuario, porRecurso(models.RecursoChavesAPI))
+		{
+			chavesAPI.GET("", chaveAPIHandler.ListarChaves)
+			chavesAPI.POST("", chaveAPIHandler.CriarChave)
+			chavesAPI.DELETE("/:id", chaveAPIHandler.RevogarChave)
+		}
+
+		// Log de auditoria (somente leitura)
+		auditoria := protected.Group("/auditoria")
+		auditoria.Use(porRecurso(models.RecursoAuditoria))
+		{
+			auditoria.GET("", auditoriaHandler.ListarRegistros)
+			auditoria.GET("/export", auditoriaHandler.ExportarRegistros)
+		}
+
+		// Webhooks de saída da organização
+		webhooks := protected.Group("/webhooks")
+		webhooks.Use(porRecurso(models.RecursoWebhooks))
+		{
+			webhooks.GET("/eventos", webhooksHandler.ListarEventos)
+			webhooks.GET("", webhooksHandler.ListarWebhooks)
+			webhooks.POST("", webhooksHandler.CriarWebhook)
+			webhooks.PUT("/:id", webhooksHandler.AtualizarWebhook)
+			webhooks.DELETE("/:id", webhooksHandler.ExcluirWebhook)
+			webhooks.POST("/:id/segredo", webhooksHandler.RotacionarSegredo)
+			webhooks.POST("/:id/teste", webhooksHandler.TestarWebhook)
+			webhooks.GET("/:id/entregas", webhooksHandler.ListarEntregas)
+			webhooks.GET("/entregas", webhooksHandler.ListarEntregas)
+			webhooks.POST("/entregas/:entregaId/reenviar", webhooksHandler.ReenviarEntrega)
+
+			// Eventos recebidos do WAHA que falharam no processamento
+			webhooks.GET("/entrada/falhas", webhookEntradaHandler.ListarFalhas)
+			webhooks.POST("/entrada/falhas/:id/reprocessar", webhookEntradaHandler.ReprocessarFalha)
+		}
+
+		// Campanhas de disparo em massa
+		campanhas := protected.Group("/campanhas")
+		campanhas.Use(porRecurso(models.RecursoCampanhas))
+		{
+			enviarCampanha := requer(models.RecursoCampanhas, models.AcaoEnviar)
+
+			campanhas.GET("", campanhaHandler.ListarCampanhas)
+			campanhas.POST("", campanhaHandler.CriarCampanha)
+			campanhas.POST("/segmento/previa", campanhaHandler.PreviaSegmento)
+
+			// Números que pediram para não receber campanhas
+			campanhas.GET("/descadastros", campanhaHandler.ListarDescadastros)
+			campanhas.POST("/descadastros", campanhaHandler.CriarDescadastro)
+			campanhas.DELETE("/descadastros/:id", campanhaHandler.ExcluirDescadastro)
+
+			campanhas.GET("/:id", campanhaHandler.ObterCampanha)
+			campanhas.PUT("/:id", campanhaHandler.AtualizarCampanha)
+			campanhas.DELETE("/:id", campanhaHandler.ExcluirCampanha)
+			campanhas.GET("/:id/destinatarios", campanhaHandler.ListarDestinatarios)
+			campanhas.POST("/:id/disparar", enviarCampanha, campanhaHandler.DispararCampanha)
+			campanhas.POST("/:id/pausar", campanhaHandler.PausarCampanha)
+			campanhas.POST("/:id/retomar", enviarCampanha, campanhaHandler.RetomarCampanha)
+			campanhas.POST("/:id/cancelar", campanhaHandler.CancelarCampanha)
+		}
 
 		// Usuários
 		users := protected.Group("/users")
 		{
 			users.GET("/me", userHandler.GetMe)
-			users.PUT("/me", userHandler.UpdateMe)
-			users.GET("/", userHandler.List)
-			users.POST("/", userHandler.Create)
-			users.GET("/:id", userHandler.GetByID)
-			users.PUT("/:id", userHandler.Update)
-			users.DELETE("/:id", userHandler.Delete)
+			users.PUT("/me", somenteUsuario, userHandler.UpdateMe)
+			users.GET("/", requer(models.RecursoUsuarios, models.AcaoLer), userHandler.List)
+			users.POST("/", requer(models.RecursoUsuarios, models.AcaoEscrever), userHandler.Create)
+			users.GET("/:id", requer(models.RecursoUsuarios, models.AcaoLer), userHandler.GetByID)
+			users.PUT("/:id", requer(models.RecursoUsuarios, models.AcaoEscrever), userHandler.Update)
+			users.DELETE("/:id", requer(models.RecursoUsuarios, models.AcaoExcluir), userHandler.Delete)
+		}
+
+		// Organização do usuário e convites
+		organizacao := protected.Group("/organizacao")
+		{
+			organizacao.GET("", requer(models.RecursoOrganizacao, models.AcaoLer), organizacaoHandler.ObterOrganizacao)
+			organizacao.PUT("", requer(models.RecursoOrganizacao, models.AcaoEscrever), organizacaoHandler.AtualizarOrganizacao)
+			organizacao.PUT("/dois-fatores", somenteUsuario, requer(models.RecursoOrganizacao, models.AcaoEscrever), organizacaoHandler.DefinirDoisFatores)
+			organizacao.DELETE("/usuarios/:id/dois-fatores", somenteUsuario, requer(models.RecursoUsuarios, models.AcaoEscrever), organizacaoHandler.RedefinirDoisFatoresUsuario)
+			organizacao.DELETE("/usuarios/:id/bloqueio", somenteUsuario, requer(models.RecursoUsuarios, models.AcaoEscrever), organizacaoHandler.DesbloquearLoginUsuario)
+			organizacao.GET("/convites", requer(models.RecursoUsuarios, models.AcaoLer), organizacaoHandler.ListarConvites)
+			organizacao.POST("/convites", requer(models.RecursoUsuarios, models.AcaoEscrever), organizacaoHandler.CriarConvite)
+			organizacao.DELETE("/convites/:id", requer(models.RecursoUsuarios, models.AcaoEscrever), organizacaoHandler.RevogarConvite)
+
+			// Uso do armazenamento de mídia e retenção
+			organizacao.GET("/midias/uso", requer(models.RecursoOrganizacao, models.AcaoLer), retencaoMidiaHandler.ObterUso)
+			organizacao.GET("/midias/retencao", requer(models.RecursoOrganizacao, models.AcaoLer), retencaoMidiaHandler.ListarPoliticas)
+			organizacao.PUT("/midias/retencao", requer(models.RecursoOrganizacao, models.AcaoEscrever), retencaoMidiaHandler.DefinirPoliticas)
+			organizacao.POST("/midias/retencao/executar", requer(models.RecursoOrganizacao, models.AcaoEscrever), retencaoMidiaHandler.Executar)
+			organizacao.GET("/midias/retencao/execucoes", requer(models.RecursoOrganizacao, models.AcaoLer), retencaoMidiaHandler.ListarExecucoes)
+
+			// Transcrição das mensagens de voz
+			organizacao.GET("/transcricao", requer(models.RecursoOrganizacao, models.AcaoLer), transcricaoHandler.ObterConfiguracao)
+			organizacao.PUT("/transcricao", requer(models.RecursoOrganizacao, models.AcaoEscrever), transcricaoHandler.DefinirConfiguracao)
+		}
+
+		// Papéis personalizados
+		papeis := protected.Group("/papeis")
+		papeis.Use(porRecurso(models.RecursoPapeis))
+		{
+			papeis.GET("/permissoes", papeisHandler.ListarPermissoes)
+			papeis.GET("", papeisHandler.ListarPapeis)
+			papeis.POST("", papeisHandler.CriarPapel)
+			papeis.GET("/:id", papeisHandler.ObterPapel)
+			papeis.PUT("/:id", papeisHandler.AtualizarPapel)
+			papeis.DELETE("/:id", papeisHandler.DeletarPapel)
 		}
 
 		// WhatsApp
 		whatsapp := protected.Group("/whatsapp")
+		whatsapp.Use(porRecurso(models.RecursoSessoes))
 		{
 			whatsapp.POST("/sessions", whatsAppHandler.CreateSession)
 			whatsapp.GET("/sessions", whatsAppHandler.ListSessions)
@@ -121,6 +275,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Kanban
 		kanban := protected.Group("/kanban")
+		kanban.Use(porRecurso(models.RecursoKanban))
 		{
 			kanban.GET("/quadros", kanbanHandler.ListQuadros)
 			kanban.POST("/quadros", kanbanHandler.CreateQuadro)
@@ -131,7 +286,7 @@ func Setup(container *services.Container) *gin.Engine {
 			// Colunas
 			kanban.POST("/column-create", kanbanHandler.CreateColumn)
 			kanban.POST("/column-edit", kanbanHandler.EditColumn)
-			kanban.POST("/column-delete", kanbanHandler.DeleteColumn)
+			kanban.POST("/column-delete", requer(models.RecursoKanban, models.AcaoExcluir), kanbanHandler.DeleteColumn)
 			kanban.PUT("/coluna/:colunaId/color", kanbanHandler.UpdateColumnColor)
 			kanban.PUT("/coluna/reorder", kanbanHandler.ReorderColumns)
 			kanban.POST("/card-movement", kanbanHandler.MoveCard)
@@ -140,6 +295,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Connections
 		connections := protected.Group("/connections")
+		connections.Use(porRecurso(models.RecursoSessoes))
 		{
 			connections.GET("/", func(c *gin.Context) {
 				c.JSON(200, gin.H{"message": "Connections"})
@@ -154,38 +310,44 @@ func Setup(container *services.Container) *gin.Engine {
 		respostasRapidas := protected.Group("/respostas-rapidas")
 		{
 			// Categorias
-			respostasRapidas.GET("/categorias", respostaRapidaHandler.GetCategorias)
-			respostasRapidas.POST("/categorias", respostaRapidaHandler.CreateCategoria)
-			respostasRapidas.PUT("/categorias/:id", respostaRapidaHandler.UpdateCategoria)
-			respostasRapidas.DELETE("/categorias/:id", respostaRapidaHandler.DeleteCategoria)
+			lerRR := requer(models.RecursoRespostasRapidas, models.AcaoLer)
+			escreverRR := requer(models.RecursoRespostasRapidas, models.AcaoEscrever)
+			excluirRR := requer(models.RecursoRespostasRapidas, models.AcaoExcluir)
+			usarRR := []gin.HandlerFunc{lerRR, requer(models.RecursoMensagens, models.AcaoEnviar)}
+
+			respostasRapidas.GET("/categorias", lerRR, respostaRapidaHandler.GetCategorias)
+			respostasRapidas.POST("/categorias", escreverRR, respostaRapidaHandler.CreateCategoria)
+			respostasRapidas.PUT("/categorias/:id", escreverRR, respostaRapidaHandler.UpdateCategoria)
+			respostasRapidas.DELETE("/categorias/:id", excluirRR, respostaRapidaHandler.DeleteCategoria)
 
 			// Execuções e Estatísticas (antes das rotas com :id)
-			respostasRapidas.GET("/execucoes", respostaRapidaHandler.GetExecucoes)
-			respostasRapidas.GET("/estatisticas", respostaRapidaHandler.GetEstatisticas)
+			respostasRapidas.GET("/execucoes", lerRR, respostaRapidaHandler.GetExecucoes)
+			respostasRapidas.GET("/estatisticas", lerRR, respostaRapidaHandler.GetEstatisticas)
 
 			// Agendamentos (antes das rotas com :id)
-			respostasRapidas.GET("/agendamentos", respostaRapidaHandler.GetAgendamentos)
-			respostasRapidas.PUT("/agendamentos/:id/pausar", respostaRapidaHandler.PausarAgendamento)
+			respostasRapidas.GET("/agendamentos", lerRR, respostaRapidaHandler.GetAgendamentos)
+			respostasRapidas.PUT("/agendamentos/:id/pausar", escreverRR, respostaRapidaHandler.PausarAgendamento)
 
 			// Comandos Slash (antes das rotas com :id)
-			respostasRapidas.POST("/comando-slash", respostaRapidaHandler.ProcessarComandoSlash)
+			respostasRapidas.POST("/comando-slash", append(usarRR, respostaRapidaHandler.ProcessarComandoSlash)...)
 
 			// Respostas Rápidas
-			respostasRapidas.GET("/", respostaRapidaHandler.GetRespostasRapidas)
-			respostasRapidas.POST("/", respostaRapidaHandler.CreateRespostaRapida)
-			respostasRapidas.GET("/:id", respostaRapidaHandler.GetRespostaRapida)
-			respostasRapidas.PUT("/:id", respostaRapidaHandler.UpdateRespostaRapida)
-			respostasRapidas.DELETE("/:id", respostaRapidaHandler.DeleteRespostaRapida)
-			respostasRapidas.PUT("/:id/pausar", respostaRapidaHandler.TogglePausarRespostaRapida)
-			respostasRapidas.POST("/:id/executar", respostaRapidaHandler.ExecutarRespostaRapida)
-			respostasRapidas.GET("/:id/acoes", respostaRapidaHandler.GetAcoes)
-			respostasRapidas.POST("/:id/acoes", respostaRapidaHandler.CreateAcao)
-			respostasRapidas.PUT("/:id/acoes/reorder", respostaRapidaHandler.ReorderAcoes)
+			respostasRapidas.GET("/", lerRR, respostaRapidaHandler.GetRespostasRapidas)
+			respostasRapidas.POST("/", escreverRR, respostaRapidaHandler.CreateRespostaRapida)
+			respostasRapidas.GET("/:id", lerRR, respostaRapidaHandler.GetRespostaRapida)
+			respostasRapidas.PUT("/:id", escreverRR, respostaRapidaHandler.UpdateRespostaRapida)
+			respostasRapidas.DELETE("/:id", excluirRR, respostaRapidaHandler.DeleteRespostaRapida)
+			respostasRapidas.PUT("/:id/pausar", escreverRR, respostaRapidaHandler.TogglePausarRespostaRapida)
+			respostasRapidas.POST("/:id/executar", append(usarRR, respostaRapidaHandler.ExecutarRespostaRapida)...)
+			respostasRapidas.GET("/:id/acoes", lerRR, respostaRapidaHandler.GetAcoes)
+			respostasRapidas.POST("/:id/acoes", escreverRR, respostaRapidaHandler.CreateAcao)
+			respostasRapidas.PUT("/:id/acoes/reorder", escreverRR, respostaRapidaHandler.ReorderAcoes)
 		}
 
 		// Anotações
 		log.Printf("[ROUTER] Registrando rotas de anotações...")
 		anotacoes := protected.Group("/anotacoes")
+		anotacoes.Use(porRecurso(models.RecursoAnotacoes))
 		{
 			anotacoes.GET("", anotacoesHandler.ListAnotacoes)
 			anotacoes.GET("/:id", anotacoesHandler.GetAnotacao)
@@ -199,6 +361,7 @@ func Setup(container *services.Container) *gin.Engine {
 		// Agendamentos
 		log.Printf("[ROUTER] Registrando rotas de agendamentos...")
 		agendamentos := protected.Group("/agendamentos")
+		agendamentos.Use(porRecurso(models.RecursoAgendamentos))
 		{
 			agendamentos.GET("", agendamentoHandler.ListAgendamentos)
 			agendamentos.GET("/:id", agendamentoHandler.GetAgendamento)
@@ -211,17 +374,20 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Orçamentos
 		orcamentos := protected.Group("/orcamentos")
+		orcamentos.Use(porRecurso(models.RecursoOrcamentos))
 		{
 			orcamentos.GET("", orcamentoHandler.ListOrcamentos)
 			orcamentos.GET("/:id", orcamentoHandler.GetOrcamento)
 			orcamentos.POST("", orcamentoHandler.CreateOrcamento)
 			orcamentos.PUT("/:id", orcamentoHandler.UpdateOrcamento)
+			orcamentos.PATCH("/:id/status", orcamentoHandler.UpdateOrcamentoStatus)
 			orcamentos.DELETE("/:id", orcamentoHandler.DeleteOrcamento)
 		}
 
 		// Assinaturas
 		log.Printf("[ROUTER] Registrando rotas de assinaturas...")
 		assinaturas := protected.Group("/assinaturas")
+		assinaturas.Use(porRecurso(models.RecursoAssinaturas))
 		{
 			assinaturas.GET("/", assinaturasHandler.ListAssinaturas)
 			assinaturas.POST("/", assinaturasHandler.CreateAssinatura)
@@ -233,6 +399,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Filas
 		filas := protected.Group("/filas")
+		filas.Use(porRecurso(models.RecursoFilas))
 		{
 			filas.GET("/", filasHandler.ListarFilas)
 			filas.POST("/", filasHandler.CriarFila)
@@ -246,6 +413,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Tags
 		tags := protected.Group("/tags")
+		tags.Use(porRecurso(models.RecursoTags))
 		{
 			tags.GET("/", tagsHandler.ListarTags)
 			tags.POST("/", tagsHandler.CriarTag)
@@ -258,6 +426,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Alertas
 		alertas := protected.Group("/alertas")
+		alertas.Use(porRecurso(models.RecursoAlertas))
 		{
 			alertas.GET("", alertasHandler.ListarAlertas)
 			alertas.GET("/:id", alertasHandler.ObterAlerta)
@@ -266,14 +435,46 @@ func Setup(container *services.Container) *gin.Engine {
 			alertas.DELETE("/:id", alertasHandler.DeletarAlerta)
 		}
 
+		// WebSocket
+		ws := protected.Group("/ws")
+		ws.Use(somenteUsuario)
+		{
+			ws.POST("/ticket", handlers.NewWebSocketTicketHandler(container.AuthService))
+			ws.GET("/metrics", middleware.RequireAdmin(), handlers.WebSocketMetrics)
+		}
+
 		// Estatísticas de Atendimento
 		atendimentos := protected.Group("/atendimentos")
+		atendimentos.Use(porRecurso(models.RecursoAtendimentos))
 		{
 			atendimentos.GET("/stats", atendimentoStatsHandler.GetStats)
+			atendimentos.POST("/:id/finalizar", atendimentosHandler.FinalizarAtendimento)
+		}
+
+		// Cobranças
+		cobrancas := protected.Group("/cobrancas")
+		cobrancas.Use(porRecurso(models.RecursoAssinaturas))
+		{
+			cobrancas.POST("/:id/pagamento", cobrancaHandler.RegistrarPagamento)
+		}
+
+		// SLA
+		sla := protected.Group("/sla")
+		sla.Use(porRecurso(models.RecursoSLA))
+		{
+			sla.GET("/politicas", slaHandler.ListarPoliticas)
+			sla.POST("/politicas", slaHandler.CriarPolitica)
+			sla.GET("/politicas/:id", slaHandler.ObterPolitica)
+			sla.PUT("/politicas/:id", slaHandler.AtualizarPolitica)
+			sla.DELETE("/politicas/:id", slaHandler.DeletarPolitica)
+			sla.GET("/eventos", slaHandler.ListarEventos)
+			sla.GET("/resumo", slaHandler.ObterResumo)
+			sla.POST("/avaliar", slaHandler.AvaliarAgora)
 		}
 
 		// Contatos
 		contatos := protected.Group("/contatos")
+		contatos.Use(porRecurso(models.RecursoContatos))
 		{
 			contatos.GET("", contatoHandler.ListContatos)
 			contatos.GET("/stats", contatoHandler.GetContatosStats)
@@ -293,17 +494,29 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Sessões WhatsApp
 		sessoesWhatsApp := protected.Group("/sessoes-whatsapp")
+		sessoesWhatsApp.Use(porRecurso(models.RecursoSessoes))
 		{
 			sessoesWhatsApp.GET("", sessoesWhatsAppHandler.ListSessoesWhatsApp)
+			sessoesWhatsApp.GET("/saude", sessoesWhatsAppHandler.ListarSaudeSessoes)
 			sessoesWhatsApp.GET("/:id", sessoesWhatsAppHandler.GetSessaoWhatsApp)
+			sessoesWhatsApp.GET("/:id/saude", sessoesWhatsAppHandler.ObterSaudeSessao)
+			sessoesWhatsApp.GET("/:id/fila-envio", sessoesWhatsAppHandler.ObterFilaEnvio)
 			sessoesWhatsApp.POST("", sessoesWhatsAppHandler.CreateSessaoWhatsApp)
 			sessoesWhatsApp.PUT("/:id", sessoesWhatsAppHandler.UpdateSessaoWhatsApp)
 			sessoesWhatsApp.DELETE("/:id", sessoesWhatsAppHandler.DeleteSessaoWhatsApp)
+
+			// Importação do histórico de conversas do WAHA
+			sessoesWhatsApp.GET("/:id/importacoes", importacaoHistoricoHandler.ListarImportacoes)
+			sessoesWhatsApp.POST("/:id/importacoes", importacaoHistoricoHandler.IniciarImportacao)
+			sessoesWhatsApp.GET("/:id/importacoes/:importacaoId", importacaoHistoricoHandler.ObterImportacao)
+			sessoesWhatsApp.POST("/:id/importacoes/:importacaoId/pausar", importacaoHistoricoHandler.PausarImportacao)
+			sessoesWhatsApp.POST("/:id/importacoes/:importacaoId/retomar", importacaoHistoricoHandler.RetomarImportacao)
 		}
 
 		// Agentes IA
 		agentesHandler := handlers.NewAgentesHandler(container.DB)
 		agentes := protected.Group("/agentes")
+		agentes.Use(porRecurso(models.RecursoAgentes))
 		{
 			agentes.GET("", agentesHandler.GetAgentes)
 			agentes.POST("", agentesHandler.CreateAgente)
@@ -316,6 +529,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Chat Agentes
 		chatAgentes := protected.Group("/chat-agentes")
+		chatAgentes.Use(porRecurso(models.RecursoMensagens), escopoChat)
 		{
 			chatAgentes.GET("/:chatId", agentesHandler.GetChatAgente)
 			chatAgentes.POST("/:chatId/activate", agentesHandler.ActivateAgentForChat)
@@ -324,6 +538,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// Fluxos (Automation Workflows)
 		fluxos := protected.Group("/fluxos")
+		fluxos.Use(porRecurso(models.RecursoFluxos))
 		{
 			fluxos.GET("", fluxosHandler.ListFluxos)
 			fluxos.POST("", fluxosHandler.CreateFluxo)
@@ -344,8 +559,22 @@ func Setup(container *services.Container) *gin.Engine {
 			fluxos.DELETE("/:id/connections/:connectionId", fluxosHandler.DeleteFluxoConexao)
 		}
 
+		// Mídia (upload, consulta com URL assinada e exclusão)
+		media := protected.Group("/media")
+		media.Use(porRecurso(models.RecursoMensagens))
+		{
+			media.POST("", mediaHandler.UploadMedia)
+			media.GET("/:id", mediaHandler.GetMedia)
+			media.DELETE("/:id", mediaHandler.DeleteMedia)
+			media.POST("/:id/reprocessar", mediaHandler.ReprocessarMedia)
+			media.GET("/:id/vinculos", mediaHandler.ListarVinculosMedia)
+			media.POST("/:id/vinculos", mediaHandler.VincularMedia)
+			media.DELETE("/:id/vinculos/:vinculoId", mediaHandler.DesvincularMedia)
+		}
+
 		// WhatsApp API (com middleware JWT)
 		whatsappAPI := protected.Group("/whatsapp")
+		whatsappAPI.Use(porRecurso(models.RecursoMensagens), escopoChat)
 		{
 			whatsappAPI.GET("/chats", func(c *gin.Context) {
 				log.Printf("[WHATSAPP] GET /chats - Starting request")
@@ -356,8 +585,12 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
-				log.Printf("[WHATSAPP] GET /chats - UserID: %s, SessionName: user_%s", userID, userID)
-				sessionName := fmt.Sprintf("user_%s", userID)
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, "")
+				if !ok {
+					return
+				}
+
+				log.Printf("[WHATSAPP] GET /chats - UserID: %s, SessionName: %s", userID, sessionName)
 
 				chats, err := container.WhatsAppService.GetChats(sessionName)
 				if err != nil {
@@ -366,6 +599,17 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
+				// Atendentes veem apenas os chats das suas filas
+				escopo, err := container.PermissionService.EscopoAtendimento(c.GetString("user_id"))
+				if err == nil {
+					chats, err = container.PermissionService.FiltrarChats(escopo, chats)
+				}
+				if err != nil {
+					log.Printf("[WHATSAPP] GET /chats - Error filtering scope: %v", err)
+					c.JSON(500, gin.H{"error": "Failed to apply access scope"})
+					return
+				}
+
 				c.JSON(200, chats)
 			})
 
@@ -375,7 +619,10 @@ func Setup(container *services.Container) *gin.Engine {
 					c.JSON(401, gin.H{"error": "User not authenticated"})
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, "")
+				if !ok {
+					return
+				}
 
 				var contacts interface{}
 				contacts, err := container.WhatsAppService.GetContacts(sessionName)
@@ -394,7 +641,11 @@ func Setup(container *services.Container) *gin.Engine {
 					c.JSON(401, gin.H{"error": "User not authenticated"})
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, "")
+				if !ok {
+					return
+				}
+
 				log.Printf("[WHATSAPP] GET /groups - UserID: %s, SessionName: %s", userID, sessionName)
 
 				var groups interface{}
@@ -407,47 +658,39 @@ func Setup(container *services.Container) *gin.Engine {
 			})
 
 			whatsappAPI.GET("/chats/:chatId/messages", func(c *gin.Context) {
-				// Autenticação via header Authorization
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token", "details": err.Error()})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
 
-				var messages interface{}
-				// Parse query parameters for pagination
-				limitStr := c.DefaultQuery("limit", "50")
-				offsetStr := c.DefaultQuery("offset", "0")
-
-				limit, err := strconv.Atoi(limitStr)
+				// Histórico gravado no banco, paginado por cursor (?cursor= da página anterior)
+				limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
 				if err != nil {
 					limit = 50
 				}
 
-				offset, err := strconv.Atoi(offsetStr)
-				if err != nil {
-					offset = 0
+				pagina, err := container.MessageService.ListarMensagensChat(sessionName, chatID, c.Query("cursor"), limit)
+				if errors.Is(err, services.ErrCursorInvalido) {
+					c.JSON(400, gin.H{"error": err.Error()})
+					return
 				}
-
-				messages, err = container.WhatsAppService.GetChatMessages(sessionName, chatID, limit, offset)
 				if err != nil {
 					c.JSON(500, gin.H{"error": err.Error()})
 					return
 				}
-				c.JSON(200, messages)
+				container.MidiaService.AssinarMensagens(pagina.Mensagens)
+				c.JSON(200, pagina)
 			})
 
 			whatsappAPI.POST("/chats/:chatId/messages", func(c *gin.Context) {
-				// Autenticação via header Authorization
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token", "details": err.Error()})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
 
 				var req struct {
 					Text     string   `json:"text" binding:"required"`
@@ -460,6 +703,7 @@ func Setup(container *services.Container) *gin.Engine {
 				}
 
 				var result interface{}
+				var err error
 				if req.ReplyTo != "" {
 					result, err = container.WhatsAppService.SendReplyMessage(sessionName, chatID, req.Text, req.ReplyTo)
 				} else if len(req.Mentions) > 0 {
@@ -469,6 +713,9 @@ func Setup(container *services.Container) *gin.Engine {
 				}
 
 				if err != nil {
+					if utils.FilaEnvioCheia(c, err) {
+						return
+					}
 					c.JSON(500, gin.H{"error": err.Error()})
 					return
 				}
@@ -483,8 +730,11 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
-				sessionName := fmt.Sprintf("user_%s", userID)
 				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
+					return
+				}
 
 				result, err := container.WhatsAppService.MarkAsRead(sessionName, chatID)
 				if err != nil {
@@ -503,8 +753,11 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
-				sessionName := fmt.Sprintf("user_%s", userID)
 				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
+					return
+				}
 
 				result, err := container.WhatsAppService.SendSeenAntiBlock(sessionName, chatID)
 				if err != nil {
@@ -522,8 +775,11 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
-				sessionName := fmt.Sprintf("user_%s", userID)
 				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
+					return
+				}
 
 				result, err := container.WhatsAppService.StartTyping(sessionName, chatID)
 				if err != nil {
@@ -541,8 +797,11 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
-				sessionName := fmt.Sprintf("user_%s", userID)
 				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
+					return
+				}
 
 				result, err := container.WhatsAppService.StopTyping(sessionName, chatID)
 				if err != nil {
@@ -565,13 +824,12 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Reações
 			whatsappAPI.PUT("/messages/:messageId/reaction", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				messageID := c.Param("messageId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, services.ChatDaMensagem(messageID))
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				messageID := c.Param("messageId")
 
 				var req struct {
 					Reaction string `json:"reaction"`
@@ -581,6 +839,7 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
+				var err error
 				if req.Reaction == "" {
 					err = container.WhatsAppService.RemoveReaction(sessionName, messageID)
 				} else {
@@ -596,13 +855,12 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Encaminhar mensagens
 			whatsappAPI.POST("/messages/:messageId/forward", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				messageID := c.Param("messageId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, services.ChatDaMensagem(messageID))
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				messageID := c.Param("messageId")
 
 				var req struct {
 					ToChatID string `json:"toChatId" binding:"required"`
@@ -611,9 +869,15 @@ func Setup(container *services.Container) *gin.Engine {
 					c.JSON(400, gin.H{"error": "Invalid request"})
 					return
 				}
+				if !chatNoEscopo(c, req.ToChatID) {
+					return
+				}
 
 				result, err := container.WhatsAppService.ForwardMessage(sessionName, req.ToChatID, messageID)
 				if err != nil {
+					if utils.FilaEnvioCheia(c, err) {
+						return
+					}
 					c.JSON(500, gin.H{"error": err.Error()})
 					return
 				}
@@ -622,13 +886,13 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Editar mensagens
 			whatsappAPI.PUT("/chats/:chatId/messages/:messageId", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
+
 				messageID := c.Param("messageId")
 
 				var req struct {
@@ -649,13 +913,13 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Deletar mensagens
 			whatsappAPI.DELETE("/chats/:chatId/messages/:messageId", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
+
 				messageID := c.Param("messageId")
 
 				result, err := container.WhatsAppService.DeleteMessage(sessionName, chatID, messageID)
@@ -668,13 +932,12 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Arquivar chat
 			whatsappAPI.POST("/chats/:chatId/archive", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
 
 				result, err := container.WhatsAppService.ArchiveChat(sessionName, chatID)
 				if err != nil {
@@ -686,13 +949,12 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Desarquivar chat
 			whatsappAPI.POST("/chats/:chatId/unarchive", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
 
 				result, err := container.WhatsAppService.UnarchiveChat(sessionName, chatID)
 				if err != nil {
@@ -704,13 +966,12 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Deletar chat completo
 			whatsappAPI.DELETE("/chats/:chatId", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				userID := c.GetString("user_id")
+				chatID := c.Param("chatId")
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, chatID)
+				if !ok {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
 
 				result, err := container.WhatsAppService.DeleteChat(sessionName, chatID)
 				if err != nil {
@@ -722,12 +983,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Favoritar mensagens
 			whatsappAPI.PUT("/star", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
-					return
-				}
-				sessionName := fmt.Sprintf("user_%s", userID)
+				userID := c.GetString("user_id")
 
 				var req struct {
 					MessageID string `json:"messageId" binding:"required"`
@@ -738,6 +994,11 @@ func Setup(container *services.Container) *gin.Engine {
 					return
 				}
 
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, services.ChatDaMensagem(req.MessageID))
+				if !ok {
+					return
+				}
+
 				result, err := container.WhatsAppService.StarMessage(sessionName, req.MessageID, req.Star)
 				if err != nil {
 					c.JSON(500, gin.H{"error": err.Error()})
@@ -748,12 +1009,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Enviar contato
 			whatsappAPI.POST("/sendContactVcard", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
-					return
-				}
-				sessionName := fmt.Sprintf("user_%s", userID)
+				userID := c.GetString("user_id")
 
 				var req struct {
 					ChatID    string `json:"chatId" binding:"required"`
@@ -764,9 +1020,19 @@ func Setup(container *services.Container) *gin.Engine {
 					c.JSON(400, gin.H{"error": "Invalid request"})
 					return
 				}
+				if !chatNoEscopo(c, req.ChatID) {
+					return
+				}
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, req.ChatID)
+				if !ok {
+					return
+				}
 
 				result, err := container.WhatsAppService.SendContactVcard(sessionName, req.ChatID, req.ContactID, req.Name)
 				if err != nil {
+					if utils.FilaEnvioCheia(c, err) {
+						return
+					}
 					c.JSON(500, gin.H{"error": err.Error()})
 					return
 				}
@@ -775,12 +1041,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Enviar localização
 			whatsappAPI.POST("/sendLocation", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
-					return
-				}
-				sessionName := fmt.Sprintf("user_%s", userID)
+				userID := c.GetString("user_id")
 
 				var req struct {
 					ChatID    string  `json:"chatId" binding:"required"`
@@ -793,9 +1054,19 @@ func Setup(container *services.Container) *gin.Engine {
 					c.JSON(400, gin.H{"error": "Invalid request"})
 					return
 				}
+				if !chatNoEscopo(c, req.ChatID) {
+					return
+				}
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, req.ChatID)
+				if !ok {
+					return
+				}
 
 				result, err := container.WhatsAppService.SendLocation(sessionName, req.ChatID, req.Latitude, req.Longitude, req.Title, req.Address)
 				if err != nil {
+					if utils.FilaEnvioCheia(c, err) {
+						return
+					}
 					c.JSON(500, gin.H{"error": err.Error()})
 					return
 				}
@@ -804,12 +1075,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 			// Enviar enquete
 			whatsappAPI.POST("/sendPoll", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
-					return
-				}
-				sessionName := fmt.Sprintf("user_%s", userID)
+				userID := c.GetString("user_id")
 
 				var req struct {
 					ChatID          string   `json:"chatId" binding:"required"`
@@ -821,63 +1087,37 @@ func Setup(container *services.Container) *gin.Engine {
 					c.JSON(400, gin.H{"error": "Invalid request"})
 					return
 				}
-
-				result, err := container.WhatsAppService.SendPoll(sessionName, req.ChatID, req.Name, req.Options, req.MultipleAnswers)
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-				c.JSON(200, result)
-			})
-
-			// Buscar mensagens
-			whatsappAPI.GET("/chats/:chatId/messages/search", func(c *gin.Context) {
-				userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-				if err != nil {
-					c.JSON(401, gin.H{"error": "Invalid token"})
+				if !chatNoEscopo(c, req.ChatID) {
 					return
 				}
-				sessionName := fmt.Sprintf("user_%s", userID)
-				chatID := c.Param("chatId")
-				query := c.Query("q")
-
-				if query == "" {
-					c.JSON(400, gin.H{"error": "Query parameter 'q' is required"})
+				sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, req.ChatID)
+				if !ok {
 					return
 				}
 
-				// Parse pagination parameters
-				limitStr := c.DefaultQuery("limit", "50")
-				offsetStr := c.DefaultQuery("offset", "0")
-
-				limit, err := strconv.Atoi(limitStr)
-				if err != nil {
-					limit = 50
-				}
-
-				offset, err := strconv.Atoi(offsetStr)
-				if err != nil {
-					offset = 0
-				}
-
-				result, err := container.WhatsAppService.SearchMessages(sessionName, chatID, query, limit, offset)
+				result, err := container.WhatsAppService.SendPoll(sessionName, req.ChatID, req.Name, req.Options, req.MultipleAnswers)
 				if err != nil {
+					if utils.FilaEnvioCheia(c, err) {
+						return
+					}
 					c.JSON(500, gin.H{"error": err.Error()})
 					return
 				}
 				c.JSON(200, result)
 			})
 
+			// Buscar mensagens (busca textual no histórico gravado)
+			whatsappAPI.GET("/chats/:chatId/messages/search", buscaMensagensHandler.BuscarMensagens)
+			whatsappAPI.GET("/messages/search", buscaMensagensHandler.BuscarMensagens)
+
+			// Transcrever áudio sob demanda
+			whatsappAPI.POST("/chats/:chatId/messages/:messageId/transcricao", transcricaoHandler.TranscreverMensagem)
+
 		}
 
 		// Reply endpoint
 		whatsappAPI.POST("/reply", func(c *gin.Context) {
-			userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-			if err != nil {
-				c.JSON(401, gin.H{"error": "Invalid token"})
-				return
-			}
-			sessionName := fmt.Sprintf("user_%s", userID)
+			userID := c.GetString("user_id")
 
 			var req struct {
 				ChatID  string `json:"chatId" binding:"required"`
@@ -888,9 +1128,19 @@ func Setup(container *services.Container) *gin.Engine {
 				c.JSON(400, gin.H{"error": "Invalid request"})
 				return
 			}
+			if !chatNoEscopo(c, req.ChatID) {
+				return
+			}
+			sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, req.ChatID)
+			if !ok {
+				return
+			}
 
 			result, err := container.WhatsAppService.SendReplyMessage(sessionName, req.ChatID, req.Text, req.ReplyTo)
 			if err != nil {
+				if utils.FilaEnvioCheia(c, err) {
+					return
+				}
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
@@ -899,12 +1149,7 @@ func Setup(container *services.Container) *gin.Engine {
 
 		// SendSeen endpoint
 		whatsappAPI.POST("/sendSeen", func(c *gin.Context) {
-			userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-			if err != nil {
-				c.JSON(401, gin.H{"error": "Invalid token"})
-				return
-			}
-			sessionName := fmt.Sprintf("user_%s", userID)
+			userID := c.GetString("user_id")
 
 			var req struct {
 				ChatID     string   `json:"chatId" binding:"required"`
@@ -914,9 +1159,15 @@ func Setup(container *services.Container) *gin.Engine {
 				c.JSON(400, gin.H{"error": "Invalid request"})
 				return
 			}
+			if !chatNoEscopo(c, req.ChatID) {
+				return
+			}
+			sessionName, ok := utils.SessaoWhatsAppDoChat(c, container.WhatsAppService, userID, req.ChatID)
+			if !ok {
+				return
+			}
 
-			err = container.WhatsAppService.SendSeen(sessionName, req.ChatID, req.MessageIDs)
-			if err != nil {
+			if err := container.WhatsAppService.SendSeen(sessionName, req.ChatID, req.MessageIDs); err != nil {
 				c.JSON(500, gin.H{"error": err.Error()})
 				return
 			}
@@ -926,14 +1177,11 @@ func Setup(container *services.Container) *gin.Engine {
 
 	// Send endpoints
 	send := protected.Group("/send")
+	send.Use(porRecurso(models.RecursoMensagens))
 	{
 		// Link preview endpoint
 		send.POST("/link-custom-preview", func(c *gin.Context) {
-			userID, err := utils.ValidateJWTFromHeader(c, container.AuthService)
-			if err != nil {
-				c.JSON(401, gin.H{"error": "Invalid token"})
-				return
-			}
+			userID := c.GetString("user_id")
 
 			var req struct {
 				URL string `json:"url" binding:"required"`
@@ -959,8 +1207,9 @@ func Setup(container *services.Container) *gin.Engine {
 		})
 	}
 
-	// WAHA API Proxy routes
-	wahaProxy := r.Group("/api")
+	// WAHA API Proxy routes (a sessão é validada no handler)
+	wahaProxy := protected.Group("")
+	wahaProxy.Use(porRecurso(models.RecursoSessoes))
 	{
 		// QR Code routes
 		wahaProxy.GET("/:session/auth/qr", whatsAppHandler.ProxyToWAHA)
@@ -972,10 +1221,17 @@ func Setup(container *services.Container) *gin.Engine {
 		wahaProxy.POST("/sessions/:session/restart", whatsAppHandler.ProxyToWAHA)
 	}
 
-	// Webhooks
+	// Webhooks do WAHA: autenticados por segredo/HMAC, deduplicados e
+	// processados em background pela fila de ingestão. As duas rotas entregam
+	// ao mesmo despachante; /resposta-rapida é mantida para instalações antigas.
+	container.DespachanteWAHA.Assinar("midia", whatsAppHandler.ProcessarMidiaRecebida, services.EventoWAHAMensagem, services.EventoWAHAMensagemQualquer)
+	container.ImportacaoHistorico.DefinirProcessadorMidia(whatsAppHandler.ProcessarMidiaRecebida)
+
 	webhooks := r.Group("/webhooks")
+	webhooks.Use(middleware.WebhookWAHAMiddleware(container.Config.WAHAWebhookSecret, container.Config.WAHAWebhookHMACKey))
 	{
-		webhooks.POST("/whatsapp", whatsAppHandler.WebhookHandler)
+		webhooks.POST("/whatsapp", webhookEntradaHandler.Receber(services.OrigemWebhookWAHA))
+		webhooks.POST("/resposta-rapida", webhookEntradaHandler.Receber(services.OrigemWebhookWAHA))
 	}
 
 	log.Printf("[ROUTER] ✅ Todas as rotas configuradas com sucesso!")
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tappyone/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Quantidade de mensagens anteriores enviadas como contexto ao agente
+	historicoAgenteIA = 10
+	// Áudios transcritos depois disso não recebem resposta automática
+	janelaRespostaTranscricaoAgenteIA = 15 * time.Minute
+)
+
+// AgenteIAService responde automaticamente os chats que têm um agente de IA
+// ativado (chat_agentes)
+type AgenteIAService struct {
+	db       *gorm.DB
+	ai       *AIService
+	whatsapp *WhatsAppService
+}
+
+func NewAgenteIAService(db *gorm.DB, ai *AIService, whatsapp *WhatsAppService) *AgenteIAService {
+	return &AgenteIAService{
+		db:       db,
+		ai:       ai,
+		whatsapp: whatsapp,
+	}
+}
+
+// ResponderEventoWAHA consumidor que gera e envia a resposta do agente ativo
+// no chat para cada mensagem de texto recebida
+func (s *AgenteIAService) ResponderEventoWAHA(evento *EventoWAHA) error {
+	mensagem := evento.Mensagem
+	if mensagem == nil || mensagem.FromMe || evento.UsuarioID == "" || !s.ai.Configurado() {
+		return nil
+	}
+	if mensagem.TipoMensagem() != models.TipoMensagemTexto || strings.TrimSpace(mensagem.Body) == "" {
+		return nil
+	}
+
+	sessaoWhatsAppID := ""
+	if evento.SessaoWhatsApp != nil {
+		sessaoWhatsAppID = evento.SessaoWhatsApp.ID
+	}
+	return s.responder(evento.Sessao, sessaoWhatsAppID, evento.UsuarioID, mensagem.ChatID(), mensagem.ID, mensagem.Body)
+}
+
+// ResponderTranscricao responde a mensagem de voz recém-transcrita como se o
+// cliente tivesse escrito o texto. Transcrições de áudios antigos (pedido
+// manual, importação) não geram resposta.
+func (s *AgenteIAService) ResponderTranscricao(mensagem *models.Mensagem) {
+	if mensagem.DeMim || mensagem.Transcricao == nil || !s.ai.Configurado() {
+		return
+	}
+	if time.Since(mensagem.Timestamp) > janelaRespostaTranscricaoAgenteIA {
+		return
+	}
+
+	var destino struct {
+		ChatID     string
+		SessaoID   string
+		NomeSessao string
+		UsuarioID  string
+	}
+	err := s.db.Table("conversas").
+		Select("conversas.id_conversa AS chat_id, sessoes_whatsapp.id AS sessao_id, sessoes_whatsapp.nome_sessao, sessoes_whatsapp.usuario_id").
+		Joins("JOIN sessoes_whatsapp ON sessoes_whatsapp.id = conversas.sessao_whatsapp_id").
+		Where("conversas.id = ?", mensagem.ConversaID).
+		Scan(&destino).Error
+	if err != nil || destino.ChatID == "" {
+		return
+	}
+
+	if err := s.responder(destino.NomeSessao, destino.SessaoID, destino.UsuarioID, destino.ChatID, mensagem.IDMensagem, *mensagem.Transcricao); err != nil {
+		log.Printf("[AGENTE_IA] Erro ao responder áudio transcrito %s: %v", mensagem.ID, err)
+	}
+}
+
+// responder gera e envia a resposta do agente ativo no chat, se houver
+func (s *AgenteIAService) responder(sessao, sessaoWhatsAppID, usuarioID, chatID, idMensagem, texto string) error {
+	var chatAgente models.ChatAgente
+	err := s.db.Preload("Agente").
+		Where("chat_id = ? AND usuario_id = ? AND ativo = ?", chatID, usuarioID, true).
+		First(&chatAgente).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao buscar agente do chat: %w", err)
+	}
+	if !chatAgente.Agente.Ativo {
+		return nil
+	}
+
+	resposta, err := s.ai.GenerateResponse(chatAgente.Agente.Prompt, s.contexto(sessaoWhatsAppID, chatID, idMensagem, texto))
+	if err != nil {
+		return fmt.Errorf("erro ao gerar resposta do agente %s: %w", chatAgente.AgenteID, err)
+	}
+	if resposta == "" {
+		return nil
+	}
+
+	// A resposta espera a vez na fila de envio da sessão, por isso não bloqueia
+	// o worker. A espera é limitada (envioEsperaMaximaAutomacao) e, com a fila
+	// cheia, a resposta é descartada na hora.
+	go func() {
+		if _, err := s.whatsapp.SendMessage(sessao, chatID, resposta); err != nil {
+			var filaCheia *ErroFilaEnvio
+			if errors.As(err, &filaCheia) {
+				log.Printf("[AGENTE_IA] Resposta do agente %s para %s descartada pela fila de envio: %v", chatAgente.AgenteID, chatID, err)
+				return
+			}
+			log.Printf("[AGENTE_IA] Erro ao enviar resposta do agente %s: %v", chatAgente.AgenteID, err)
+			return
+		}
+		log.Printf("[AGENTE_IA] Agente %s respondeu o chat %s", chatAgente.AgenteID, chatID)
+	}()
+	return nil
+}
+
+// contexto monta o histórico recente da conversa, do mais antigo para o mais
+// novo, terminando na mensagem recebida. Áudios entram pela transcrição.
+func (s *AgenteIAService) contexto(sessaoWhatsAppID, chatID, idMensagem, texto string) string {
+	var historico []models.Mensagem
+	if sessaoWhatsAppID != "" {
+		s.db.Joins("JOIN conversas ON conversas.id = mensagens.conversa_id").
+			Where("conversas.id_conversa = ? AND conversas.sessao_whatsapp_id = ?", chatID, sessaoWhatsAppID).
+			Where("mensagens.id_mensagem <> ?", idMensagem).
+			Where("mensagens.conteudo IS NOT NULL OR mensagens.transcricao IS NOT NULL").
+			Order("mensagens.timestamp DESC").
+			Limit(historicoAgenteIA).
+			Find(&historico)
+	}
+
+	var contexto strings.Builder
+	for i := len(historico) - 1; i >= 0; i-- {
+		autor := "Cliente"
+		if historico[i].DeMim {
+			autor = "Atendente"
+		}
+		fmt.Fprintf(&contexto, "%s: %s\n", autor, textoContextoAgenteIA(&historico[i]))
+	}
+	fmt.Fprintf(&contexto, "Cliente: %s", texto)
+	return contexto.String()
+}
+
+// textoContextoAgenteIA conteúdo da mensagem para o agente; áudios transcritos
+// são marcados para o modelo saber que o cliente falou
+func textoContextoAgenteIA(mensagem *models.Mensagem) string {
+	if mensagem.Transcricao != nil && *mensagem.Transcricao != "" {
+		return "[áudio] " + *mensagem.Transcricao
+	}
+	if mensagem.Conteudo != nil {
+		return *mensagem.Conteudo
+	}
+	return ""
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"tappyone/internal/config"
+)
+
+// ErrObjetoNaoEncontrado objeto inexistente no armazenamento de mídia
+var ErrObjetoNaoEncontrado = errors.New("objeto não encontrado no armazenamento")
+
+// MediaStorage backend onde ficam os arquivos de mídia. As chaves são geradas
+// pelo MidiaService a partir do SHA-256 do conteúdo, então um objeto nunca é
+// sobrescrito com conteúdo diferente.
+type MediaStorage interface {
+	// Nome identifica o backend gravado em cada mídia (local, s3)
+	Nome() string
+	Salvar(ctx context.Context, chave string, dados []byte, tipoMime string) error
+	// Abrir devolve o conteúdo; no disco local o leitor também implementa
+	// io.ReadSeeker, o que permite responder requisições com Range
+	Abrir(ctx context.Context, chave string) (io.ReadCloser, error)
+	Existe(ctx context.Context, chave string) (bool, error)
+	Remover(ctx context.Context, chave string) error
+}
+
+// NewMediaStorage cria o backend configurado em MEDIA_STORAGE
+func NewMediaStorage(cfg *config.Config) (MediaStorage, error) {
+	switch strings.ToLower(cfg.MediaStorage) {
+	case "", "local":
+		return NewLocalMediaStorage(cfg.MediaLocalDir), nil
+	case "s3", "minio":
+		return NewS3MediaStorage(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3UsePathStyle)
+	default:
+		return nil, fmt.Errorf("MEDIA_STORAGE inválido: %s", cfg.MediaStorage)
+	}
+}
+
+// LocalMediaStorage guarda as mídias em um diretório do servidor
+type LocalMediaStorage struct {
+	diretorio string
+}
+
+func NewLocalMediaStorage(diretorio string) *LocalMediaStorage {
+	return &LocalMediaStorage{diretorio: diretorio}
+}
+
+func (s *LocalMediaStorage) Nome() string {
+	return "local"
+}
+
+func (s *LocalMediaStorage) Salvar(ctx context.Context, chave string, dados []byte, tipoMime string) error {
+	caminho, err := s.caminho(chave)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(caminho), 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório de mídia: %w", err)
+	}
+
+	// Grava em arquivo temporário e renomeia para nunca expor um arquivo pela metade
+	temporario, err := os.CreateTemp(filepath.Dir(caminho), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("erro ao criar arquivo de mídia: %w", err)
+	}
+	defer os.Remove(temporario.Name())
+
+	if _, err := temporario.Write(dados); err != nil {
+		temporario.Close()
+		return fmt.Errorf("erro ao gravar arquivo de mídia: %w", err)
+	}
+	if err := temporario.Close(); err != nil {
+		return fmt.Errorf("erro ao gravar arquivo de mídia: %w", err)
+	}
+	if err := os.Chmod(temporario.Name(), 0644); err != nil {
+		return fmt.Errorf("erro ao gravar arquivo de mídia: %w", err)
+	}
+	return os.Rename(temporario.Name(), caminho)
+}
+
+func (s *LocalMediaStorage) Abrir(ctx context.Context, chave string) (io.ReadCloser, error) {
+	caminho, err := s.caminho(chave)
+	if err != nil {
+		return nil, err
+	}
+	arquivo, err := os.Open(caminho)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjetoNaoEncontrado
+	}
+	return arquivo, err
+}
+
+func (s *LocalMediaStorage) Existe(ctx context.Context, chave string) (bool, error) {
+	caminho, err := s.caminho(chave)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(caminho)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *LocalMediaStorage) Remover(ctx context.Context, chave string) error {
+	caminho, err := s.caminho(chave)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(caminho); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// caminho resolve a chave dentro do diretório, recusando chaves que escapem dele
+func (s *LocalMediaStorage) caminho(chave string) (string, error) {
+	limpa := filepath.Clean("/" + chave)
+	if chave == "" || limpa == "/" {
+		return "", fmt.Errorf("chave de mídia inválida: %q", chave)
+	}
+	return filepath.Join(s.diretorio, filepath.FromSlash(limpa)), nil
+}
+
+// S3MediaStorage guarda as mídias em um bucket S3 compatível (AWS, MinIO),
+// com requisições assinadas por AWS Signature V4
+type S3MediaStorage struct {
+	endpoint   *url.URL
+	regiao     string
+	bucket     string
+	accessKey  string
+	secretKey  string
+	pathStyle  bool
+	httpClient *http.Client
+}
+
+func NewS3MediaStorage(endpoint, regiao, bucket, accessKey, secretKey string, pathStyle bool) (*S3MediaStorage, error) {
+	if endpoint == "" || bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY e S3_SECRET_KEY são obrigatórios")
+	}
+	base, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT inválido: %s", endpoint)
+	}
+	if regiao == "" {
+		regiao = "us-east-1"
+	}
+	return &S3MediaStorage{
+		endpoint:   base,
+		regiao:     regiao,
+		bucket:     bucket,
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		pathStyle:  pathStyle,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *S3MediaStorage) Nome() string {
+	return "s3"
+}
+
+func (s *S3MediaStorage) Salvar(ctx context.Context, chave string, dados []byte, tipoMime string) error {
+	resp, err := s.requisicao(ctx, http.MethodPut, chave, dados, tipoMime)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.erroResposta(resp, "gravar")
+	}
+	return nil
+}
+
+func (s *S3MediaStorage) Abrir(ctx context.Context, chave string) (io.ReadCloser, error) {
+	resp, err := s.requisicao(ctx, http.MethodGet, chave, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrObjetoNaoEncontrado
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s.erroResposta(resp, "ler")
+	}
+	return resp.Body, nil
+}
+
+func (s *S3MediaStorage) Existe(ctx context.Context, chave string) (bool, error) {
+	resp, err := s.requisicao(ctx, http.MethodHead, chave, nil, "")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s.erroResposta(resp, "consultar")
+	}
+}
+
+func (s *S3MediaStorage) Remover(ctx context.Context, chave string) error {
+	resp, err := s.requisicao(ctx, http.MethodDelete, chave, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.erroResposta(resp, "remover")
+	}
+	return nil
+}
+
+func (s *S3MediaStorage) erroResposta(resp *http.Response, operacao string) error {
+	corpo, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("erro ao %s objeto no S3 (status %d): %s", operacao, resp.StatusCode, strings.TrimSpace(string(corpo)))
+}
+
+// urlObjeto endereço do objeto no estilo de path (MinIO) ou virtual-host (AWS)
+func (s *S3MediaStorage) urlObjeto(chave string) *url.URL {
+	u := *s.endpoint
+	segmentos := strings.Split(strings.TrimLeft(chave, "/"), "/")
+	for i, segmento := range segmentos {
+		segmentos[i] = url.PathEscape(segmento)
+	}
+	caminho := strings.Join(segmentos, "/")
+
+	if s.pathStyle {
+		u.RawPath = strings.TrimRight(s.endpoint.EscapedPath(), "/") + "/" + url.PathEscape(s.bucket) + "/" + caminho
+	} else {
+		u.Host = s.bucket + "." + s.endpoint.Host
+		u.RawPath = strings.TrimRight(s.endpoint.EscapedPath(), "/") + "/" + caminho
+	}
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	return &u
+}
+
+func (s *S3MediaStorage) requisicao(ctx context.Context, metodo, chave string, corpo []byte, tipoMime string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, metodo, s.urlObjeto(chave).String(), bytes.NewReader(corpo))
+	if err != nil {
+		return nil, err
+	}
+	if tipoMime != "" {
+		req.Header.Set("Content-Type", tipoMime)
+	}
+	if corpo == nil {
+		req.ContentLength = 0
+		req.Body = http.NoBody
+	}
+	s.assinar(req, corpo, time.Now().UTC())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro na requisição ao S3: %w", err)
+	}
+	return resp, nil
+}
+
+// assinar adiciona o header Authorization no formato AWS Signature V4
+func (s *S3MediaStorage) assinar(req *http.Request, corpo []byte, agora time.Time) {
+	dataHora := agora.Format("20060102T150405Z")
+	data := agora.Format("20060102")
+	hashCorpo := hexSHA256(corpo)
+
+	req.Header.Set("X-Amz-Date", dataHora)
+	req.Header.Set("X-Amz-Content-Sha256", hashCorpo)
+
+	cabecalhos := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": hashCorpo,
+		"x-amz-date":           dataHora,
+	}
+	if tipo := req.Header.Get("Content-Type"); tipo != "" {
+		cabecalhos["content-type"] = tipo
+	}
+	nomes := make([]string, 0, len(cabecalhos))
+	for nome := range cabecalhos {
+		nomes = append(nomes, nome)
+	}
+	sort.Strings(nomes)
+
+	var canonicos strings.Builder
+	for _, nome := range nomes {
+		canonicos.WriteString(nome + ":" + strings.TrimSpace(cabecalhos[nome]) + "\n")
+	}
+	assinados := strings.Join(nomes, ";")
+
+	requisicaoCanonica := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicos.String(),
+		assinados,
+		hashCorpo,
+	}, "\n")
+
+	escopo := data + "/" + s.regiao + "/s3/aws4_request"
+	textoAssinado := "AWS4-HMAC-SHA256\n" + dataHora + "\n" + escopo + "\n" + hexSHA256([]byte(requisicaoCanonica))
+
+	chave := hmacSHA256([]byte("AWS4"+s.secretKey), data)
+	chave = hmacSHA256(chave, s.regiao)
+	chave = hmacSHA256(chave, "s3")
+	chave = hmacSHA256(chave, "aws4_request")
+	assinatura := hex.EncodeToString(hmacSHA256(chave, textoAssinado))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, escopo, assinados, assinatura))
+}
+
+func hexSHA256(dados []byte) string {
+	soma := sha256.Sum256(dados)
+	return hex.EncodeToString(soma[:])
+}
+
+func hmacSHA256(chave []byte, dados string) []byte {
+	mac := hmac.New(sha256.New, chave)
+	mac.Write([]byte(dados))
+	return mac.Sum(nil)
+}
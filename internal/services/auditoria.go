@@ -0,0 +1,259 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+// Campos que não entram no diff (mudam a cada gravação)
+var camposIgnoradosAuditoria = map[string]bool{
+	"atualizadoEm": true,
+	"criadoEm":     true,
+}
+
+// AtorAuditoria quem executou a ação auditada
+type AtorAuditoria struct {
+	Tipo          string // usuario, chave_api, fluxo, resposta_rapida, sistema
+	ID            string
+	UsuarioID     string // usuário responsável: o próprio, o dono da chave ou da automação
+	OrganizacaoID string
+	IP            string
+	UserAgent     string
+}
+
+// AtorAutomacao ator para ações executadas por fluxos e respostas rápidas
+func AtorAutomacao(tipo, id, usuarioID, organizacaoID string) AtorAuditoria {
+	return AtorAuditoria{
+		Tipo:          tipo,
+		ID:            id,
+		UsuarioID:     usuarioID,
+		OrganizacaoID: organizacaoID,
+	}
+}
+
+// FiltroAuditoria filtros da consulta e da exportação
+type FiltroAuditoria struct {
+	TipoAtor   string
+	AtorID     string
+	UsuarioID  string
+	Acao       string
+	Entidade   string
+	EntidadeID string
+	Desde      *time.Time
+	Ate        *time.Time
+	Page       int
+	Limit      int
+}
+
+// AuditoriaService grava e consulta o log de auditoria
+type AuditoriaService struct {
+	db *gorm.DB
+}
+
+func NewAuditoriaService(db *gorm.DB) *AuditoriaService {
+	return &AuditoriaService{db: db}
+}
+
+// Registrar grava uma entrada na auditoria. antes/depois são snapshots da
+// entidade (structs ou mapas); nil quando a entidade não existia ou deixou de
+// existir. Falhas são apenas logadas para não interromper a operação auditada.
+func (s *AuditoriaService) Registrar(ator AtorAuditoria, acao, entidade, entidadeID string, antes, depois interface{}) {
+	if ator.ID == "" {
+		ator.Tipo = models.AtorAuditoriaSistema
+		ator.ID = models.AtorAuditoriaSistema
+	}
+
+	// Automações não conhecem a organização: herda a do usuário responsável
+	if ator.OrganizacaoID == "" && ator.UsuarioID != "" {
+		var usuario models.Usuario
+		if err := s.db.Select("organizacao_id").Where("id = ?", ator.UsuarioID).First(&usuario).Error; err == nil {
+			ator.OrganizacaoID = usuario.OrganizacaoID
+		}
+	}
+
+	registro := models.RegistroAuditoria{
+		TipoAtor:   ator.Tipo,
+		AtorID:     ator.ID,
+		Acao:       acao,
+		Entidade:   entidade,
+		EntidadeID: entidadeID,
+		Antes:      snapshotAuditoria(antes),
+		Depois:     snapshotAuditoria(depois),
+		IP:         ator.IP,
+		UserAgent:  ator.UserAgent,
+	}
+	if ator.OrganizacaoID != "" {
+		registro.OrganizacaoID = &ator.OrganizacaoID
+	}
+	if ator.UsuarioID != "" {
+		registro.UsuarioID = &ator.UsuarioID
+	}
+	if registro.Antes != nil && registro.Depois != nil {
+		registro.Diferencas = diferencasAuditoria(registro.Antes, registro.Depois)
+	}
+
+	if err := s.db.Create(&registro).Error; err != nil {
+		log.Printf("[AUDITORIA] Erro ao registrar %s %s/%s por %s %s: %v", acao, entidade, entidadeID, ator.Tipo, ator.ID, err)
+	}
+}
+
+// Listar retorna os registros da organização com filtros e paginação
+func (s *AuditoriaService) Listar(organizacaoID string, filtro FiltroAuditoria) ([]models.RegistroAuditoria, int64, error) {
+	var total int64
+	if err := s.consulta(organizacaoID, filtro).Model(&models.RegistroAuditoria{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("erro ao contar registros de auditoria: %w", err)
+	}
+
+	if filtro.Page < 1 {
+		filtro.Page = 1
+	}
+	if filtro.Limit < 1 || filtro.Limit > 100 {
+		filtro.Limit = 20
+	}
+
+	var registros []models.RegistroAuditoria
+	err := s.consulta(organizacaoID, filtro).Order("criado_em DESC").
+		Offset((filtro.Page - 1) * filtro.Limit).
+		Limit(filtro.Limit).
+		Find(&registros).Error
+	return registros, total, err
+}
+
+// ExportarCSV escreve os registros filtrados em CSV, do mais recente ao mais antigo
+func (s *AuditoriaService) ExportarCSV(organizacaoID string, filtro FiltroAuditoria, w io.Writer) error {
+	rows, err := s.consulta(organizacaoID, filtro).
+		Model(&models.RegistroAuditoria{}).
+		Order("criado_em DESC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"data", "tipo_ator", "ator_id", "usuario_id", "acao", "entidade", "entidade_id", "diferencas", "ip", "user_agent"})
+
+	for rows.Next() {
+		var registro models.RegistroAuditoria
+		if err := s.db.ScanRows(rows, &registro); err != nil {
+			return err
+		}
+
+		usuarioID := ""
+		if registro.UsuarioID != nil {
+			usuarioID = *registro.UsuarioID
+		}
+		diferencas := ""
+		if len(registro.Diferencas) > 0 {
+			if payload, err := json.Marshal(registro.Diferencas); err == nil {
+				diferencas = string(payload)
+			}
+		}
+
+		if err := writer.Write([]string{
+			registro.CriadoEm.Format(time.RFC3339),
+			registro.TipoAtor,
+			registro.AtorID,
+			usuarioID,
+			registro.Acao,
+			registro.Entidade,
+			registro.EntidadeID,
+			diferencas,
+			registro.IP,
+			registro.UserAgent,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *AuditoriaService) consulta(organizacaoID string, filtro FiltroAuditoria) *gorm.DB {
+	query := s.db.Scopes(repositories.PorOrganizacaoAlias("registros_auditoria", organizacaoID))
+
+	if filtro.TipoAtor != "" {
+		query = query.Where("tipo_ator = ?", filtro.TipoAtor)
+	}
+	if filtro.AtorID != "" {
+		query = query.Where("ator_id = ?", filtro.AtorID)
+	}
+	if filtro.UsuarioID != "" {
+		query = query.Where("usuario_id = ?", filtro.UsuarioID)
+	}
+	if filtro.Acao != "" {
+		query = query.Where("acao = ?", filtro.Acao)
+	}
+	if filtro.Entidade != "" {
+		query = query.Where("entidade = ?", filtro.Entidade)
+	}
+	if filtro.EntidadeID != "" {
+		query = query.Where("entidade_id = ?", filtro.EntidadeID)
+	}
+	if filtro.Desde != nil {
+		query = query.Where("criado_em >= ?", *filtro.Desde)
+	}
+	if filtro.Ate != nil {
+		query = query.Where("criado_em <= ?", *filtro.Ate)
+	}
+	return query
+}
+
+// snapshotAuditoria converte a entidade para mapa usando as tags JSON, o que já
+// exclui campos sensíveis (json:"-") como senhas e hashes
+func snapshotAuditoria(valor interface{}) models.JSONB {
+	if valor == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(valor); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	payload, err := json.Marshal(valor)
+	if err != nil {
+		return models.JSONB{"erro": fmt.Sprintf("snapshot indisponível: %v", err)}
+	}
+
+	var mapa models.JSONB
+	if err := json.Unmarshal(payload, &mapa); err != nil {
+		return nil
+	}
+	return mapa
+}
+
+// diferencasAuditoria lista os campos alterados entre os snapshots
+func diferencasAuditoria(antes, depois models.JSONB) models.JSONB {
+	diferencas := models.JSONB{}
+	for campo, valorDepois := range depois {
+		if camposIgnoradosAuditoria[campo] {
+			continue
+		}
+		valorAntes, existia := antes[campo]
+		if !existia || !reflect.DeepEqual(valorAntes, valorDepois) {
+			diferencas[campo] = map[string]interface{}{"antes": valorAntes, "depois": valorDepois}
+		}
+	}
+	for campo, valorAntes := range antes {
+		if camposIgnoradosAuditoria[campo] {
+			continue
+		}
+		if _, existe := depois[campo]; !existe {
+			diferencas[campo] = map[string]interface{}{"antes": valorAntes, "depois": nil}
+		}
+	}
+	if len(diferencas) == 0 {
+		return nil
+	}
+	return diferencas
+}
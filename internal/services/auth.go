@@ -13,15 +13,19 @@ import (
 )
 
 type AuthService struct {
-	db     *gorm.DB
-	redis  *redis.Client
-	config *config.Config
+	db           *gorm.DB
+	redis        *redis.Client
+	config       *config.Config
+	emailService *EmailService
+	falhasLogin  *contadorFalhasLogin
 }
 
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID        string `json:"user_id"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	SessionID     string `json:"sid,omitempty"` // família do refresh token que originou o access token
+	OrganizacaoID string `json:"org,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -31,58 +35,80 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token   string         `json:"token"`
-	Usuario models.Usuario `json:"usuario"`
+	Token        string          `json:"token,omitempty"`
+	RefreshToken string          `json:"refreshToken,omitempty"`
+	ExpiresIn    int             `json:"expiresIn,omitempty"` // segundos até o access token expirar
+	Usuario      *models.Usuario `json:"usuario,omitempty"`
+
+	// Senha conferida, mas os tokens dependem do segundo fator
+	DoisFatores *DesafioDoisFatoresResponse `json:"doisFatores,omitempty"`
+	// Exibidos uma única vez ao concluir o cadastro de dois fatores no login
+	CodigosRecuperacao []string `json:"codigosRecuperacao,omitempty"`
 }
 
-func NewAuthService(db *gorm.DB, redis *redis.Client, config *config.Config) *AuthService {
+// ClientInfo identifica a origem da requisição de autenticação
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func NewAuthService(db *gorm.DB, redis *redis.Client, config *config.Config, emailService *EmailService) *AuthService {
 	return &AuthService{
-		db:     db,
-		redis:  redis,
-		config: config,
+		db:           db,
+		redis:        redis,
+		config:       config,
+		emailService: emailService,
+		falhasLogin:  novoContadorFalhasLogin(redis),
 	}
 }
 
-// Login autentica um usuário e retorna um JWT token
-func (s *AuthService) Login(req LoginRequest) (*LoginResponse, error) {
+// Login autentica um usuário e retorna um access token e um refresh token.
+// Com dois fatores ativo (ou exigido pela organização) retorna apenas o desafio.
+// Falhas consecutivas por email e por IP impõem espera crescente e bloqueio temporário.
+func (s *AuthService) Login(req LoginRequest, info ClientInfo) (*LoginResponse, error) {
+	email := normalizarEmailLogin(req.Email)
+	if err := s.verificarTentativasLogin(email, info.IP); err != nil {
+		return nil, err
+	}
+
 	var usuario models.Usuario
 	
-	// Buscar usuário pelo email
-	if err := s.db.Where("email = ? AND ativo = ?", req.Email, true).First(&usuario).Error; err != nil {
+	// Buscar usuário pelo email normalizado, a mesma chave do controle de tentativas
+	if err := s.db.Where("LOWER(email) = ? AND ativo = ?", email, true).First(&usuario).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("credenciais inválidas")
+			return nil, s.registrarFalhaLogin(email, nil, info)
 		}
 		return nil, err
 	}
 
+	if usuario.LoginBloqueadoAte != nil && usuario.LoginBloqueadoAte.After(time.Now()) {
+		return nil, &ErroTentativasLogin{Espera: time.Until(*usuario.LoginBloqueadoAte), Bloqueado: true}
+	}
+
 	// Verificar senha
 	if err := bcrypt.CompareHashAndPassword([]byte(usuario.Senha), []byte(req.Senha)); err != nil {
-		return nil, errors.New("credenciais inválidas")
+		return nil, s.registrarFalhaLogin(email, &usuario, info)
 	}
 
-	// Gerar token JWT
-	token, err := s.generateJWT(usuario)
-	if err != nil {
-		return nil, err
+	// Com dois fatores o contador só é zerado depois do segundo fator, para que
+	// códigos errados continuem acumulando falhas entre novos logins
+	resposta, err := s.autenticar(usuario, info)
+	if err == nil && resposta.DoisFatores == nil {
+		s.limparFalhasLogin(email)
 	}
-
-	// Limpar senha antes de retornar
-	usuario.Senha = ""
-
-	return &LoginResponse{
-		Token:   token,
-		Usuario: usuario,
-	}, nil
+	return resposta, err
 }
 
-// generateJWT gera um token JWT para o usuário
-func (s *AuthService) generateJWT(usuario models.Usuario) (string, error) {
+// generateJWT gera um access token de curta duração para o usuário
+func (s *AuthService) generateJWT(usuario models.Usuario, sessionID string) (string, error) {
 	claims := JWTClaims{
-		UserID: usuario.ID,
-		Email:  usuario.Email,
-		Role:   string(usuario.Tipo),
+		UserID:        usuario.ID,
+		Email:         usuario.Email,
+		Role:          string(usuario.Tipo),
+		SessionID:     sessionID,
+		OrganizacaoID: usuario.OrganizacaoID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour * 7)), // 7 dias
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "tappyone-crm",
@@ -98,7 +124,7 @@ func (s *AuthService) generateJWT(usuario models.Usuario) (string, error) {
 func (s *AuthService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.config.JWTSecret), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -125,24 +151,3 @@ func (s *AuthService) GetUserByID(userID string) (*models.Usuario, error) {
 	}
 	return &usuario, nil
 }
-
-// ResetPassword atualiza a senha do usuário
-func (s *AuthService) ResetPassword(email, hashedPassword string) error {
-	var usuario models.Usuario
-	
-	// Buscar usuário pelo email
-	if err := s.db.Where("email = ? AND ativo = ?", email, true).First(&usuario).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("usuário não encontrado")
-		}
-		return err
-	}
-
-	// Atualizar senha
-	usuario.Senha = hashedPassword
-	if err := s.db.Save(&usuario).Error; err != nil {
-		return err
-	}
-
-	return nil
-}
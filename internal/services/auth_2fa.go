@@ -0,0 +1,555 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tappyone/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrDesafioDoisFatoresInvalido = errors.New("desafio de autenticação inválido ou expirado")
+	ErrCodigoDoisFatoresInvalido  = errors.New("código de verificação inválido")
+	ErrDoisFatoresJaAtivo         = errors.New("autenticação em dois fatores já está ativa")
+	ErrDoisFatoresNaoAtivo        = errors.New("autenticação em dois fatores não está ativa")
+	ErrDoisFatoresNaoIniciado     = errors.New("configure o aplicativo autenticador antes de ativar")
+	ErrDoisFatoresObrigatorio     = errors.New("a organização exige autenticação em dois fatores para administradores")
+	ErrSenhaIncorreta             = errors.New("senha incorreta")
+)
+
+const (
+	desafioDoisFatoresTTL         = 5 * time.Minute
+	desafioCadastroDoisFatoresTTL = 15 * time.Minute
+	desafioDoisFatoresTentativas  = 5
+
+	codigosRecuperacaoQuantidade = 10
+	codigoRecuperacaoTamanho     = 10
+	codigoRecuperacaoAlfabeto    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // sem 0/O e 1/I
+)
+
+// DesafioDoisFatoresResponse devolvido pelo login quando falta o segundo fator
+type DesafioDoisFatoresResponse struct {
+	Desafio  string    `json:"desafio"`
+	Tipo     string    `json:"tipo"` // verificacao ou cadastro
+	ExpiraEm time.Time `json:"expiraEm"`
+}
+
+// ConfiguracaoDoisFatores dados para cadastrar o aplicativo autenticador
+type ConfiguracaoDoisFatores struct {
+	Segredo string `json:"segredo"`
+	URI     string `json:"uri"` // otpauth:// para gerar o QR code
+}
+
+// StatusDoisFatores situação da autenticação em dois fatores do usuário
+type StatusDoisFatores struct {
+	Ativo            bool       `json:"ativo"`
+	AtivadoEm        *time.Time `json:"ativadoEm"`
+	CodigosRestantes int64      `json:"codigosRestantes"`
+	Obrigatorio      bool       `json:"obrigatorio"`
+}
+
+// autenticar conclui o login após a senha: emite os tokens ou, quando o usuário
+// usa (ou precisa usar) dois fatores, devolve um desafio
+func (s *AuthService) autenticar(usuario models.Usuario, info ClientInfo) (*LoginResponse, error) {
+	tipo := ""
+	switch {
+	case usuario.DoisFatoresAtivo:
+		tipo = models.DesafioDoisFatoresVerificacao
+	case s.doisFatoresObrigatorio(usuario):
+		tipo = models.DesafioDoisFatoresCadastro
+	default:
+		return s.iniciarSessao(usuario, info)
+	}
+
+	desafio, err := s.criarDesafioDoisFatores(usuario.ID, tipo, info)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResponse{DoisFatores: desafio}, nil
+}
+
+// doisFatoresObrigatorio indica se a organização do usuário exige dois fatores para ele
+func (s *AuthService) doisFatoresObrigatorio(usuario models.Usuario) bool {
+	if usuario.Tipo != models.TipoUsuarioAdmin || usuario.OrganizacaoID == "" {
+		return false
+	}
+
+	var organizacao models.Organizacao
+	if err := s.db.Select("id", "exigir_dois_fatores_admin").First(&organizacao, "id = ?", usuario.OrganizacaoID).Error; err != nil {
+		return false
+	}
+	return organizacao.ExigirDoisFatoresAdmin
+}
+
+func (s *AuthService) criarDesafioDoisFatores(usuarioID, tipo string, info ClientInfo) (*DesafioDoisFatoresResponse, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, fmt.Errorf("erro ao gerar desafio: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	ttl := desafioDoisFatoresTTL
+	if tipo == models.DesafioDoisFatoresCadastro {
+		ttl = desafioCadastroDoisFatoresTTL
+	}
+
+	registro := models.DesafioDoisFatores{
+		UsuarioID: usuarioID,
+		TokenHash: hashToken(token),
+		Tipo:      tipo,
+		ExpiraEm:  time.Now().Add(ttl),
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+	}
+	if err := s.db.Create(&registro).Error; err != nil {
+		return nil, fmt.Errorf("erro ao salvar desafio: %w", err)
+	}
+
+	return &DesafioDoisFatoresResponse{
+		Desafio:  token,
+		Tipo:     tipo,
+		ExpiraEm: registro.ExpiraEm,
+	}, nil
+}
+
+// consumirTentativaDesafio valida o desafio e contabiliza uma tentativa. Após o
+// limite de tentativas o desafio deixa de valer e o login precisa ser refeito.
+func (s *AuthService) consumirTentativaDesafio(token, tipo string) (*models.DesafioDoisFatores, *models.Usuario, error) {
+	var desafio models.DesafioDoisFatores
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND tipo = ? AND concluido_em IS NULL AND expira_em > ?", hashToken(token), tipo, time.Now()).
+			First(&desafio).Error
+		if err != nil || desafio.Tentativas >= desafioDoisFatoresTentativas {
+			return ErrDesafioDoisFatoresInvalido
+		}
+
+		desafio.Tentativas++
+		return tx.Model(&desafio).Update("tentativas", desafio.Tentativas).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var usuario models.Usuario
+	if err := s.db.Where("id = ? AND ativo = ?", desafio.UsuarioID, true).First(&usuario).Error; err != nil {
+		return nil, nil, ErrDesafioDoisFatoresInvalido
+	}
+	return &desafio, &usuario, nil
+}
+
+// concluirDesafio marca o desafio como usado; falha se outra requisição já o concluiu
+func (s *AuthService) concluirDesafio(desafio *models.DesafioDoisFatores) error {
+	result := s.db.Model(&models.DesafioDoisFatores{}).
+		Where("id = ? AND concluido_em IS NULL", desafio.ID).
+		Update("concluido_em", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDesafioDoisFatoresInvalido
+	}
+	return nil
+}
+
+// VerificarDesafioDoisFatores conclui o login com o código do autenticador ou um
+// código de recuperação
+func (s *AuthService) VerificarDesafioDoisFatores(token, codigo string, info ClientInfo) (*LoginResponse, error) {
+	desafio, usuario, err := s.consumirTentativaDesafio(token, models.DesafioDoisFatoresVerificacao)
+	if err != nil {
+		return nil, err
+	}
+
+	// Códigos errados contam como falhas de login do email: sem isso, um novo
+	// desafio a cada poucas tentativas permitiria adivinhar o código
+	email := normalizarEmailLogin(usuario.Email)
+	if err := s.verificarTentativasLogin(email, info.IP); err != nil {
+		return nil, err
+	}
+
+	if err := s.verificarSegundoFator(usuario, codigo); err != nil {
+		if errors.Is(err, ErrCodigoDoisFatoresInvalido) {
+			var tentativas *ErroTentativasLogin
+			if falha := s.registrarFalhaLogin(email, usuario, info); errors.As(falha, &tentativas) {
+				return nil, falha
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.concluirDesafio(desafio); err != nil {
+		return nil, err
+	}
+	s.limparFalhasLogin(email)
+	return s.iniciarSessao(*usuario, info)
+}
+
+// IniciarCadastroPorDesafio gera o segredo para o administrador que precisa
+// configurar dois fatores antes de entrar
+func (s *AuthService) IniciarCadastroPorDesafio(token string) (*ConfiguracaoDoisFatores, error) {
+	desafio, _, err := s.consumirTentativaDesafio(token, models.DesafioDoisFatoresCadastro)
+	if err != nil {
+		return nil, err
+	}
+	return s.IniciarCadastroDoisFatores(desafio.UsuarioID)
+}
+
+// ConcluirCadastroPorDesafio ativa dois fatores com o primeiro código e emite os
+// tokens junto com os códigos de recuperação
+func (s *AuthService) ConcluirCadastroPorDesafio(token, codigo string, info ClientInfo) (*LoginResponse, error) {
+	desafio, usuario, err := s.consumirTentativaDesafio(token, models.DesafioDoisFatoresCadastro)
+	if err != nil {
+		return nil, err
+	}
+
+	codigos, err := s.AtivarDoisFatores(usuario.ID, codigo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.concluirDesafio(desafio); err != nil {
+		return nil, err
+	}
+
+	resposta, err := s.iniciarSessao(*usuario, info)
+	if err != nil {
+		return nil, err
+	}
+	resposta.Usuario.DoisFatoresAtivo = true
+	resposta.CodigosRecuperacao = codigos
+	return resposta, nil
+}
+
+// IniciarCadastroDoisFatores gera um novo segredo pendente. Ele só passa a valer
+// depois de confirmado em AtivarDoisFatores.
+func (s *AuthService) IniciarCadastroDoisFatores(userID string) (*ConfiguracaoDoisFatores, error) {
+	var usuario models.Usuario
+	if err := s.db.Where("id = ? AND ativo = ?", userID, true).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+	if usuario.DoisFatoresAtivo {
+		return nil, ErrDoisFatoresJaAtivo
+	}
+
+	segredo, err := gerarSegredoTOTP()
+	if err != nil {
+		return nil, err
+	}
+	cifrado, err := s.cifrarSegredo(segredo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&usuario).Updates(map[string]interface{}{
+		"dois_fatores_segredo":      cifrado,
+		"dois_fatores_ultimo_passo": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &ConfiguracaoDoisFatores{
+		Segredo: segredo,
+		URI:     uriProvisionamentoTOTP(segredo, usuario.Email),
+	}, nil
+}
+
+// AtivarDoisFatores confirma o segredo pendente com um código do autenticador e
+// retorna os códigos de recuperação (exibidos uma única vez)
+func (s *AuthService) AtivarDoisFatores(userID, codigo string) ([]string, error) {
+	var usuario models.Usuario
+	if err := s.db.Where("id = ? AND ativo = ?", userID, true).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+	if usuario.DoisFatoresAtivo {
+		return nil, ErrDoisFatoresJaAtivo
+	}
+	if usuario.DoisFatoresSegredo == nil {
+		return nil, ErrDoisFatoresNaoIniciado
+	}
+
+	if err := s.verificarTOTP(&usuario, codigo); err != nil {
+		return nil, err
+	}
+
+	var codigos []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&usuario).Updates(map[string]interface{}{
+			"dois_fatores_ativo":      true,
+			"dois_fatores_ativado_em": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codigos, err = s.substituirCodigosRecuperacao(tx, usuario.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[AUTH] Autenticação em dois fatores ativada para usuário %s", usuario.ID)
+	return codigos, nil
+}
+
+// DesativarDoisFatores remove o segundo fator após conferir senha e código
+func (s *AuthService) DesativarDoisFatores(userID, senha, codigo string) error {
+	var usuario models.Usuario
+	if err := s.db.Where("id = ? AND ativo = ?", userID, true).First(&usuario).Error; err != nil {
+		return err
+	}
+	if !usuario.DoisFatoresAtivo {
+		return ErrDoisFatoresNaoAtivo
+	}
+	if s.doisFatoresObrigatorio(usuario) {
+		return ErrDoisFatoresObrigatorio
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(usuario.Senha), []byte(senha)); err != nil {
+		return ErrSenhaIncorreta
+	}
+	if err := s.verificarSegundoFator(&usuario, codigo); err != nil {
+		return err
+	}
+
+	if err := s.removerDoisFatores(usuario.ID); err != nil {
+		return err
+	}
+
+	log.Printf("[AUTH] Autenticação em dois fatores desativada pelo usuário %s", usuario.ID)
+	return nil
+}
+
+// RedefinirDoisFatores remove o segundo fator de um usuário que perdeu o
+// autenticador e os códigos de recuperação (ação administrativa)
+func (s *AuthService) RedefinirDoisFatores(userID string) error {
+	if err := s.removerDoisFatores(userID); err != nil {
+		return err
+	}
+
+	log.Printf("[AUTH] Autenticação em dois fatores redefinida para usuário %s", userID)
+	return nil
+}
+
+func (s *AuthService) removerDoisFatores(userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Usuario{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"dois_fatores_ativo":        false,
+			"dois_fatores_segredo":      nil,
+			"dois_fatores_ativado_em":   nil,
+			"dois_fatores_ultimo_passo": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("usuario_id = ?", userID).Delete(&models.CodigoRecuperacao{}).Error
+	})
+}
+
+// GerarNovosCodigosRecuperacao invalida os códigos anteriores e gera outros 10
+func (s *AuthService) GerarNovosCodigosRecuperacao(userID, codigo string) ([]string, error) {
+	var usuario models.Usuario
+	if err := s.db.Where("id = ? AND ativo = ?", userID, true).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+	if !usuario.DoisFatoresAtivo {
+		return nil, ErrDoisFatoresNaoAtivo
+	}
+
+	// Apenas o autenticador: um código de recuperação não gera novos códigos
+	if err := s.verificarTOTP(&usuario, codigo); err != nil {
+		return nil, err
+	}
+
+	var codigos []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codigos, err = s.substituirCodigosRecuperacao(tx, usuario.ID)
+		return err
+	})
+	return codigos, err
+}
+
+// StatusDoisFatoresUsuario retorna a situação do segundo fator do usuário
+func (s *AuthService) StatusDoisFatoresUsuario(userID string) (*StatusDoisFatores, error) {
+	var usuario models.Usuario
+	if err := s.db.Where("id = ? AND ativo = ?", userID, true).First(&usuario).Error; err != nil {
+		return nil, err
+	}
+
+	status := &StatusDoisFatores{
+		Ativo:       usuario.DoisFatoresAtivo,
+		AtivadoEm:   usuario.DoisFatoresAtivadoEm,
+		Obrigatorio: s.doisFatoresObrigatorio(usuario),
+	}
+	if usuario.DoisFatoresAtivo {
+		s.db.Model(&models.CodigoRecuperacao{}).
+			Where("usuario_id = ? AND usado_em IS NULL", usuario.ID).
+			Count(&status.CodigosRestantes)
+	}
+	return status, nil
+}
+
+// verificarSegundoFator aceita o código de 6 dígitos do autenticador ou um
+// código de recuperação ainda não usado
+func (s *AuthService) verificarSegundoFator(usuario *models.Usuario, codigo string) error {
+	codigo = strings.TrimSpace(codigo)
+	if len(codigo) == totpDigitos {
+		return s.verificarTOTP(usuario, codigo)
+	}
+
+	normalizado := normalizarCodigoRecuperacao(codigo)
+	if len(normalizado) != codigoRecuperacaoTamanho {
+		return ErrCodigoDoisFatoresInvalido
+	}
+
+	result := s.db.Model(&models.CodigoRecuperacao{}).
+		Where("usuario_id = ? AND codigo_hash = ? AND usado_em IS NULL", usuario.ID, hashToken(normalizado)).
+		Update("usado_em", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCodigoDoisFatoresInvalido
+	}
+
+	log.Printf("[AUTH] Código de recuperação utilizado pelo usuário %s", usuario.ID)
+	return nil
+}
+
+// verificarTOTP confere o código e registra o passo usado para que o mesmo
+// código não seja aceito duas vezes
+func (s *AuthService) verificarTOTP(usuario *models.Usuario, codigo string) error {
+	if usuario.DoisFatoresSegredo == nil {
+		return ErrDoisFatoresNaoAtivo
+	}
+	segredo, err := s.decifrarSegredo(*usuario.DoisFatoresSegredo)
+	if err != nil {
+		return err
+	}
+
+	passo, ok := validarCodigoTOTP(segredo, codigo, time.Now(), usuario.DoisFatoresUltimoPasso)
+	if !ok {
+		return ErrCodigoDoisFatoresInvalido
+	}
+
+	result := s.db.Model(&models.Usuario{}).
+		Where("id = ? AND dois_fatores_ultimo_passo < ?", usuario.ID, passo).
+		Update("dois_fatores_ultimo_passo", passo)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCodigoDoisFatoresInvalido
+	}
+	usuario.DoisFatoresUltimoPasso = passo
+	return nil
+}
+
+// substituirCodigosRecuperacao apaga os códigos atuais e grava novos (apenas o hash)
+func (s *AuthService) substituirCodigosRecuperacao(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("usuario_id = ?", userID).Delete(&models.CodigoRecuperacao{}).Error; err != nil {
+		return nil, err
+	}
+
+	codigos := make([]string, 0, codigosRecuperacaoQuantidade)
+	registros := make([]models.CodigoRecuperacao, 0, codigosRecuperacaoQuantidade)
+	for i := 0; i < codigosRecuperacaoQuantidade; i++ {
+		codigo, err := gerarCodigoRecuperacao()
+		if err != nil {
+			return nil, err
+		}
+		codigos = append(codigos, codigo[:5]+"-"+codigo[5:])
+		registros = append(registros, models.CodigoRecuperacao{
+			UsuarioID:  userID,
+			CodigoHash: hashToken(codigo),
+		})
+	}
+
+	if err := tx.Create(&registros).Error; err != nil {
+		return nil, fmt.Errorf("erro ao salvar códigos de recuperação: %w", err)
+	}
+	return codigos, nil
+}
+
+func gerarCodigoRecuperacao() (string, error) {
+	bytes := make([]byte, codigoRecuperacaoTamanho)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("erro ao gerar código de recuperação: %w", err)
+	}
+	// 256 é múltiplo de 32: o módulo não introduz viés
+	for i, b := range bytes {
+		bytes[i] = codigoRecuperacaoAlfabeto[int(b)%len(codigoRecuperacaoAlfabeto)]
+	}
+	return string(bytes), nil
+}
+
+func normalizarCodigoRecuperacao(codigo string) string {
+	codigo = strings.ToUpper(codigo)
+	codigo = strings.ReplaceAll(codigo, "-", "")
+	return strings.ReplaceAll(codigo, " ", "")
+}
+
+// chaveSegredo deriva a chave AES-256 usada para cifrar os segredos TOTP
+func (s *AuthService) chaveSegredo() []byte {
+	base := s.config.TwoFactorEncryptionKey
+	if base == "" {
+		base = "totp:" + s.config.JWTSecret
+	}
+	chave := sha256.Sum256([]byte(base))
+	return chave[:]
+}
+
+func (s *AuthService) cifrarSegredo(segredo string) (string, error) {
+	bloco, err := aes.NewCipher(s.chaveSegredo())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(bloco)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	cifrado := gcm.Seal(nonce, nonce, []byte(segredo), nil)
+	return base64.StdEncoding.EncodeToString(cifrado), nil
+}
+
+func (s *AuthService) decifrarSegredo(valor string) (string, error) {
+	dados, err := base64.StdEncoding.DecodeString(valor)
+	if err != nil {
+		return "", fmt.Errorf("segredo TOTP corrompido: %w", err)
+	}
+
+	bloco, err := aes.NewCipher(s.chaveSegredo())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(bloco)
+	if err != nil {
+		return "", err
+	}
+	if len(dados) < gcm.NonceSize() {
+		return "", errors.New("segredo TOTP corrompido")
+	}
+
+	segredo, err := gcm.Open(nil, dados[:gcm.NonceSize()], dados[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("não foi possível decifrar o segredo TOTP: %w", err)
+	}
+	return string(segredo), nil
+}
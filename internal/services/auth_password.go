@@ -0,0 +1,159 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"tappyone/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTokenRedefinicaoInvalido = errors.New("link de redefinição inválido ou expirado")
+
+const (
+	tokenRedefinicaoTTL = 30 * time.Minute
+
+	senhaTamanhoMinimo = 8
+	senhaTamanhoMaximo = 72 // limite do bcrypt
+)
+
+// ValidarPoliticaSenha verifica os requisitos mínimos de senha
+func ValidarPoliticaSenha(senha string) error {
+	if len(senha) < senhaTamanhoMinimo {
+		return fmt.Errorf("a senha deve ter pelo menos %d caracteres", senhaTamanhoMinimo)
+	}
+	if len(senha) > senhaTamanhoMaximo {
+		return fmt.Errorf("a senha deve ter no máximo %d bytes", senhaTamanhoMaximo)
+	}
+
+	var temLetra, temNumero bool
+	for _, r := range senha {
+		switch {
+		case unicode.IsLetter(r):
+			temLetra = true
+		case unicode.IsDigit(r):
+			temNumero = true
+		}
+	}
+	if !temLetra || !temNumero {
+		return errors.New("a senha deve conter letras e números")
+	}
+	return nil
+}
+
+// SolicitarRedefinicaoSenha gera um token de redefinição e envia o link por
+// email. Não informa se o email existe: usuários inexistentes ou inativos são
+// ignorados silenciosamente.
+func (s *AuthService) SolicitarRedefinicaoSenha(email string, info ClientInfo) error {
+	var usuario models.Usuario
+	err := s.db.Where("LOWER(email) = LOWER(?) AND ativo = ?", strings.TrimSpace(email), true).First(&usuario).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Errorf("erro ao gerar token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Apenas o link mais recente permanece válido
+		if err := tx.Model(&models.TokenRedefinicaoSenha{}).
+			Where("usuario_id = ? AND usado_em IS NULL", usuario.ID).
+			Update("usado_em", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.TokenRedefinicaoSenha{
+			UsuarioID: usuario.ID,
+			TokenHash: hashToken(token),
+			ExpiraEm:  time.Now().Add(tokenRedefinicaoTTL),
+			IP:        info.IP,
+			UserAgent: info.UserAgent,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao salvar token de redefinição: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/redefinir-senha?token=%s", strings.TrimRight(s.config.FrontendURL, "/"), url.QueryEscape(token))
+	corpo := fmt.Sprintf(`<p>Olá, %s.</p>
+<p>Recebemos uma solicitação para redefinir a senha da sua conta TappyOne.</p>
+<p><a href="%s">Clique aqui para criar uma nova senha</a>. O link expira em %d minutos e só pode ser usado uma vez.</p>
+<p>Se você não fez essa solicitação, ignore este email; sua senha continua a mesma.</p>`,
+		html.EscapeString(usuario.Nome), html.EscapeString(link), int(tokenRedefinicaoTTL.Minutes()))
+
+	if err := s.emailService.SendHTMLEmail(usuario.Email, "Redefinição de senha - TappyOne", corpo); err != nil {
+		log.Printf("[AUTH] Erro ao enviar email de redefinição para usuário %s: %v", usuario.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// ConfirmarRedefinicaoSenha valida o token, grava a nova senha e encerra todas
+// as sessões do usuário
+func (s *AuthService) ConfirmarRedefinicaoSenha(token, novaSenha string) error {
+	if err := ValidarPoliticaSenha(novaSenha); err != nil {
+		return err
+	}
+
+	var usuarioID string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var registro models.TokenRedefinicaoSenha
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND usado_em IS NULL AND expira_em > ?", hashToken(token), time.Now()).
+			First(&registro).Error
+		if err != nil {
+			return ErrTokenRedefinicaoInvalido
+		}
+
+		var usuario models.Usuario
+		if err := tx.Where("id = ? AND ativo = ?", registro.UsuarioID, true).First(&usuario).Error; err != nil {
+			return ErrTokenRedefinicaoInvalido
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(novaSenha), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("erro ao gerar hash da senha: %w", err)
+		}
+
+		if err := tx.Model(&usuario).Update("senha", string(hash)).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.TokenRedefinicaoSenha{}).
+			Where("usuario_id = ? AND usado_em IS NULL", usuario.ID).
+			Update("usado_em", time.Now()).Error; err != nil {
+			return err
+		}
+
+		usuarioID = usuario.ID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.LogoutTodasSessoes(usuarioID); err != nil {
+		log.Printf("[AUTH] Erro ao revogar sessões após redefinição de senha do usuário %s: %v", usuarioID, err)
+	}
+
+	log.Printf("[AUTH] Senha redefinida para usuário %s", usuarioID)
+	return nil
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrCredenciaisInvalidas = errors.New("credenciais inválidas")
+
+const (
+	loginFalhasPrefixo   = "login:falhas:"
+	loginBloqueioPrefixo = "login:bloqueio:"
+
+	// Sem novas falhas durante a janela o contador é descartado
+	loginJanelaFalhas = time.Hour
+
+	// A espera entre tentativas começa após estas falhas e dobra a cada nova falha
+	loginBackoffInicioEmail = 3
+	loginBackoffInicioIP    = 10
+	loginBackoffBase        = time.Second
+	loginBackoffMaximo      = 5 * time.Minute
+
+	loginMaxFalhasPadrao   = 10
+	loginMaxFalhasIPPadrao = 50
+	loginBloqueioPadrao    = 15 * time.Minute
+)
+
+// ErroTentativasLogin login recusado antes de conferir a senha: a conta (ou o
+// IP) está bloqueada ou ainda não passou o intervalo desde a última falha
+type ErroTentativasLogin struct {
+	Espera    time.Duration
+	Bloqueado bool
+}
+
+func (e *ErroTentativasLogin) Error() string {
+	if e.Bloqueado {
+		return fmt.Sprintf("conta temporariamente bloqueada por excesso de tentativas. Tente novamente em %s", descreverEspera(e.Espera))
+	}
+	return fmt.Sprintf("muitas tentativas de login. Aguarde %s para tentar novamente", descreverEspera(e.Espera))
+}
+
+// HistoricoLoginFiltro paginação do histórico de logins
+type HistoricoLoginFiltro struct {
+	Page  int
+	Limit int
+}
+
+// verificarTentativasLogin recusa o login enquanto o email ou o IP estiverem
+// bloqueados ou dentro do intervalo de espera exponencial
+func (s *AuthService) verificarTentativasLogin(email, ip string) error {
+	if espera := s.falhasLogin.bloqueio("email:" + email); espera > 0 {
+		return &ErroTentativasLogin{Espera: espera, Bloqueado: true}
+	}
+	if espera := s.falhasLogin.bloqueio("ip:" + ip); espera > 0 {
+		return &ErroTentativasLogin{Espera: espera}
+	}
+
+	if espera := s.falhasLogin.obter("email:" + email).espera(loginBackoffInicioEmail); espera > 0 {
+		return &ErroTentativasLogin{Espera: espera}
+	}
+	if espera := s.falhasLogin.obter("ip:" + ip).espera(loginBackoffInicioIP); espera > 0 {
+		return &ErroTentativasLogin{Espera: espera}
+	}
+	return nil
+}
+
+// registrarFalhaLogin conta a falha para o email e o IP e bloqueia ao atingir o
+// limite. usuario é nil quando o email não pertence a nenhuma conta ativa; o
+// comportamento é o mesmo para não revelar quais emails estão cadastrados.
+func (s *AuthService) registrarFalhaLogin(email string, usuario *models.Usuario, info ClientInfo) error {
+	duracao := config.ParseDuration(s.config.LoginLockoutDuration, loginBloqueioPadrao)
+
+	if info.IP != "" {
+		falhasIP := s.falhasLogin.registrar("ip:" + info.IP)
+		if falhasIP.total >= limiteConfigurado(s.config.LoginMaxFailuresPerIP, loginMaxFalhasIPPadrao) {
+			s.falhasLogin.bloquear("ip:"+info.IP, duracao)
+			s.falhasLogin.limpar("ip:" + info.IP)
+			log.Printf("[AUTH] IP %s bloqueado por %s após %d falhas de login", info.IP, duracao, falhasIP.total)
+		}
+	}
+
+	falhas := s.falhasLogin.registrar("email:" + email)
+	if falhas.total < limiteConfigurado(s.config.LoginMaxFailures, loginMaxFalhasPadrao) {
+		return ErrCredenciaisInvalidas
+	}
+
+	s.falhasLogin.bloquear("email:"+email, duracao)
+	s.falhasLogin.limpar("email:" + email)
+
+	if usuario != nil {
+		ate := time.Now().Add(duracao)
+		if err := s.db.Model(&models.Usuario{}).Where("id = ?", usuario.ID).Update("login_bloqueado_ate", ate).Error; err != nil {
+			log.Printf("[AUTH] Erro ao gravar bloqueio do usuário %s: %v", usuario.ID, err)
+		}
+		log.Printf("[AUTH] Usuário %s bloqueado até %s após %d falhas de login (último IP %s)", usuario.ID, ate.Format(time.RFC3339), falhas.total, info.IP)
+		go s.notificarBloqueioLogin(*usuario, falhas.total, ate, info)
+	}
+
+	return &ErroTentativasLogin{Espera: duracao, Bloqueado: true}
+}
+
+// limparFalhasLogin zera o contador do email após um login com senha correta
+func (s *AuthService) limparFalhasLogin(email string) {
+	s.falhasLogin.limpar("email:" + email)
+}
+
+// DesbloquearLogin remove o bloqueio e as falhas acumuladas da conta
+func (s *AuthService) DesbloquearLogin(userID string) error {
+	var usuario models.Usuario
+	if err := s.db.Select("id", "email").First(&usuario, "id = ?", userID).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Model(&models.Usuario{}).Where("id = ?", userID).Update("login_bloqueado_ate", nil).Error; err != nil {
+		return fmt.Errorf("erro ao remover bloqueio: %w", err)
+	}
+
+	email := normalizarEmailLogin(usuario.Email)
+	s.falhasLogin.limpar("email:" + email)
+	s.falhasLogin.desbloquear("email:" + email)
+
+	log.Printf("[AUTH] Bloqueio de login removido do usuário %s", userID)
+	return nil
+}
+
+// notificarBloqueioLogin registra o evento de segurança como alerta e avisa o usuário por email
+func (s *AuthService) notificarBloqueioLogin(usuario models.Usuario, falhas int, ate time.Time, info ClientInfo) {
+	titulo := "Conta bloqueada por tentativas de login"
+	descricao := fmt.Sprintf("Foram registradas %d tentativas de login com senha incorreta. O acesso foi bloqueado até %s. Último IP: %s.",
+		falhas, ate.Format("02/01/2006 15:04"), info.IP)
+
+	alerta := models.Alerta{
+		Titulo:     titulo,
+		Descricao:  descricao,
+		Tipo:       models.TipoAlertaSeguranca,
+		Prioridade: models.PrioridadeAlertaAlta,
+		Status:     models.StatusAlertaAtivo,
+		Cor:        "#ef4444",
+		Icone:      "shield-alert",
+		Configuracoes: models.ConfiguracaoAlerta{
+			EmailNotificacao:     true,
+			DashboardNotificacao: true,
+			Frequencia:           models.FrequenciaAlertaImediata,
+		},
+		UserID: usuario.ID,
+	}
+	if err := s.db.Create(&alerta).Error; err != nil {
+		log.Printf("[AUTH] Erro ao criar alerta de bloqueio para usuário %s: %v", usuario.ID, err)
+	}
+
+	if s.emailService == nil {
+		return
+	}
+	corpo := fmt.Sprintf(`<p>Olá, %s.</p>
+<p>Detectamos %d tentativas de login com senha incorreta na sua conta TappyOne e bloqueamos o acesso temporariamente, até %s.</p>
+<p>Origem da última tentativa: IP %s (%s).</p>
+<p>Se não foi você, recomendamos redefinir sua senha e ativar a autenticação em dois fatores. Um administrador da sua organização também pode remover o bloqueio.</p>`,
+		html.EscapeString(usuario.Nome), falhas, ate.Format("02/01/2006 15:04"),
+		html.EscapeString(info.IP), html.EscapeString(DescreverDispositivo(info.UserAgent)))
+
+	if err := s.emailService.SendHTMLEmail(usuario.Email, "Alerta de segurança - TappyOne", corpo); err != nil {
+		log.Printf("[AUTH] Erro ao enviar email de bloqueio para usuário %s: %v", usuario.ID, err)
+	}
+}
+
+// registrarHistoricoLogin grava o login bem-sucedido que abriu a sessão familiaID
+func (s *AuthService) registrarHistoricoLogin(usuarioID, familiaID string, info ClientInfo) {
+	registro := models.HistoricoLogin{
+		UsuarioID:   usuarioID,
+		FamiliaID:   familiaID,
+		IP:          info.IP,
+		UserAgent:   info.UserAgent,
+		Dispositivo: DescreverDispositivo(info.UserAgent),
+	}
+	if err := s.db.Create(&registro).Error; err != nil {
+		log.Printf("[AUTH] Erro ao registrar histórico de login do usuário %s: %v", usuarioID, err)
+	}
+}
+
+// HistoricoLogins retorna os logins do usuário, do mais recente ao mais antigo
+func (s *AuthService) HistoricoLogins(userID string, filtro HistoricoLoginFiltro) ([]models.HistoricoLogin, int64, error) {
+	if filtro.Page < 1 {
+		filtro.Page = 1
+	}
+	if filtro.Limit < 1 || filtro.Limit > 100 {
+		filtro.Limit = 20
+	}
+
+	var total int64
+	if err := s.db.Model(&models.HistoricoLogin{}).Where("usuario_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var registros []models.HistoricoLogin
+	err := s.db.Where("usuario_id = ?", userID).
+		Order("criado_em DESC").
+		Offset((filtro.Page - 1) * filtro.Limit).
+		Limit(filtro.Limit).
+		Find(&registros).Error
+	return registros, total, err
+}
+
+// DescreverDispositivo resume o user agent como "Navegador em Sistema"
+func DescreverDispositivo(userAgent string) string {
+	if userAgent == "" {
+		return "Desconhecido"
+	}
+	ua := strings.ToLower(userAgent)
+
+	navegador := "Navegador desconhecido"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		navegador = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		navegador = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		navegador = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		navegador = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		navegador = "Safari"
+	case strings.Contains(ua, "okhttp") || strings.Contains(ua, "dart"):
+		navegador = "Aplicativo"
+	case strings.Contains(ua, "curl") || strings.Contains(ua, "postman") || strings.Contains(ua, "go-http-client"):
+		navegador = "Cliente HTTP"
+	}
+
+	sistema := ""
+	switch {
+	case strings.Contains(ua, "android"):
+		sistema = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		sistema = "iOS"
+	case strings.Contains(ua, "windows"):
+		sistema = "Windows"
+	case strings.Contains(ua, "mac os"):
+		sistema = "macOS"
+	case strings.Contains(ua, "linux"):
+		sistema = "Linux"
+	}
+
+	if sistema == "" {
+		return navegador
+	}
+	return navegador + " em " + sistema
+}
+
+func normalizarEmailLogin(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func limiteConfigurado(valor, padrao int) int {
+	if valor <= 0 {
+		return padrao
+	}
+	return valor
+}
+
+// descreverEspera formata a espera arredondando para cima
+func descreverEspera(espera time.Duration) string {
+	if espera < time.Minute {
+		segundos := int((espera + time.Second - 1) / time.Second)
+		if segundos <= 1 {
+			return "1 segundo"
+		}
+		return fmt.Sprintf("%d segundos", segundos)
+	}
+	minutos := int((espera + time.Minute - 1) / time.Minute)
+	if minutos == 1 {
+		return "1 minuto"
+	}
+	return fmt.Sprintf("%d minutos", minutos)
+}
+
+// falhasLogin estado do contador de falhas de uma chave (email ou IP)
+type falhasLogin struct {
+	total  int
+	ultima time.Time
+}
+
+// espera intervalo restante até a próxima tentativa: dobra a cada falha a
+// partir de inicio, limitado a loginBackoffMaximo
+func (f falhasLogin) espera(inicio int) time.Duration {
+	if f.total < inicio {
+		return 0
+	}
+	intervalo := loginBackoffMaximo
+	if expoente := f.total - inicio; expoente < 16 {
+		if calculado := loginBackoffBase << uint(expoente); calculado < loginBackoffMaximo {
+			intervalo = calculado
+		}
+	}
+	return time.Until(f.ultima.Add(intervalo))
+}
+
+// contadorFalhasLogin guarda falhas e bloqueios de login. Usa Redis para valer
+// entre réplicas e cai para memória local quando o Redis não está disponível.
+type contadorFalhasLogin struct {
+	redis *redis.Client
+	mutex sync.Mutex
+	local map[string]*falhasLoginLocal
+}
+
+type falhasLoginLocal struct {
+	falhasLogin
+	bloqueadoAte time.Time
+}
+
+func novoContadorFalhasLogin(redis *redis.Client) *contadorFalhasLogin {
+	return &contadorFalhasLogin{
+		redis: redis,
+		local: make(map[string]*falhasLoginLocal),
+	}
+}
+
+func (c *contadorFalhasLogin) obter(chave string) falhasLogin {
+	if c.redis != nil {
+		valores, err := c.redis.HMGet(context.Background(), loginFalhasPrefixo+chave, "total", "ultima").Result()
+		if err == nil {
+			var estado falhasLogin
+			if texto, ok := valores[0].(string); ok {
+				estado.total, _ = strconv.Atoi(texto)
+			}
+			if texto, ok := valores[1].(string); ok {
+				if ms, err := strconv.ParseInt(texto, 10, 64); err == nil {
+					estado.ultima = time.UnixMilli(ms)
+				}
+			}
+			return estado
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if atual, ok := c.local[chave]; ok && time.Since(atual.ultima) < loginJanelaFalhas {
+		return atual.falhasLogin
+	}
+	return falhasLogin{}
+}
+
+func (c *contadorFalhasLogin) registrar(chave string) falhasLogin {
+	agora := time.Now()
+
+	if c.redis != nil {
+		ctx := context.Background()
+		chaveRedis := loginFalhasPrefixo + chave
+
+		var total *redis.IntCmd
+		_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			total = pipe.HIncrBy(ctx, chaveRedis, "total", 1)
+			pipe.HSet(ctx, chaveRedis, "ultima", agora.UnixMilli())
+			pipe.Expire(ctx, chaveRedis, loginJanelaFalhas)
+			return nil
+		})
+		if err == nil {
+			return falhasLogin{total: int(total.Val()), ultima: agora}
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.limparExpirados(agora)
+	atual, ok := c.local[chave]
+	if !ok {
+		atual = &falhasLoginLocal{}
+		c.local[chave] = atual
+	}
+	atual.total++
+	atual.ultima = agora
+	return atual.falhasLogin
+}
+
+func (c *contadorFalhasLogin) limpar(chave string) {
+	if c.redis != nil {
+		c.redis.Del(context.Background(), loginFalhasPrefixo+chave)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if atual, ok := c.local[chave]; ok {
+		atual.falhasLogin = falhasLogin{}
+	}
+}
+
+func (c *contadorFalhasLogin) bloquear(chave string, duracao time.Duration) {
+	if c.redis != nil {
+		if err := c.redis.Set(context.Background(), loginBloqueioPrefixo+chave, "1", duracao).Err(); err == nil {
+			return
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	atual, ok := c.local[chave]
+	if !ok {
+		atual = &falhasLoginLocal{}
+		c.local[chave] = atual
+	}
+	atual.bloqueadoAte = time.Now().Add(duracao)
+}
+
+func (c *contadorFalhasLogin) desbloquear(chave string) {
+	if c.redis != nil {
+		c.redis.Del(context.Background(), loginBloqueioPrefixo+chave)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if atual, ok := c.local[chave]; ok {
+		atual.bloqueadoAte = time.Time{}
+	}
+}
+
+// bloqueio retorna quanto falta para o bloqueio da chave expirar (0 quando livre)
+func (c *contadorFalhasLogin) bloqueio(chave string) time.Duration {
+	if c.redis != nil {
+		ttl, err := c.redis.PTTL(context.Background(), loginBloqueioPrefixo+chave).Result()
+		if err == nil {
+			if ttl > 0 {
+				return ttl
+			}
+			return 0
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if atual, ok := c.local[chave]; ok {
+		if restante := time.Until(atual.bloqueadoAte); restante > 0 {
+			return restante
+		}
+	}
+	return 0
+}
+
+// limparExpirados deve ser chamado com o mutex adquirido
+func (c *contadorFalhasLogin) limparExpirados(agora time.Time) {
+	for chave, atual := range c.local {
+		if agora.Sub(atual.ultima) > loginJanelaFalhas && agora.After(atual.bloqueadoAte) {
+			delete(c.local, chave)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalido    = errors.New("refresh token inválido ou expirado")
+	ErrRefreshTokenReutilizado = errors.New("refresh token reutilizado, sessão revogada")
+	ErrSessaoRevogada          = errors.New("sessão revogada")
+	ErrUsuarioInativo          = errors.New("usuário inativo")
+)
+
+const (
+	// Cache do estado do usuário consultado a cada requisição autenticada
+	authUsuarioCachePrefix = "auth:usuario:"
+	authUsuarioCacheTTL    = 30 * time.Second
+
+	// Famílias revogadas, mantidas enquanto seus access tokens ainda são válidos
+	authSessaoRevogadaPrefix = "auth:sessao_revogada:"
+
+	MotivoRevogacaoLogout    = "logout"
+	MotivoRevogacaoLogoutAll = "logout_todas_sessoes"
+	MotivoRevogacaoReuso     = "reuso_detectado"
+	MotivoRevogacaoRotacao   = "rotacao"
+)
+
+// estadoUsuarioAuth dados mínimos do usuário para validar tokens
+type estadoUsuarioAuth struct {
+	Ativo             bool       `json:"ativo"`
+	TokensRevogadosEm *time.Time `json:"tokensRevogadosEm"`
+	OrganizacaoID     string     `json:"organizacaoId"`
+}
+
+func (s *AuthService) accessTokenTTL() time.Duration {
+	return config.ParseDuration(s.config.JWTExpiresIn, 15*time.Minute)
+}
+
+func (s *AuthService) refreshTokenTTL() time.Duration {
+	return config.ParseDuration(s.config.JWTRefreshExpiresIn, 30*24*time.Hour)
+}
+
+// iniciarSessao cria uma nova família de refresh tokens e emite o par de tokens
+func (s *AuthService) iniciarSessao(usuario models.Usuario, info ClientInfo) (*LoginResponse, error) {
+	familiaID := uuid.New().String()
+	resposta, _, err := s.emitirTokens(s.db, usuario, familiaID, info)
+	if err != nil {
+		return nil, err
+	}
+
+	s.registrarHistoricoLogin(usuario.ID, familiaID, info)
+	return resposta, nil
+}
+
+// emitirTokens gera access token e refresh token para a família informada
+func (s *AuthService) emitirTokens(tx *gorm.DB, usuario models.Usuario, familiaID string, info ClientInfo) (*LoginResponse, *models.RefreshToken, error) {
+	accessToken, err := s.generateJWT(usuario, familiaID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, registro, err := s.criarRefreshToken(tx, usuario.ID, familiaID, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Limpar senha antes de retornar
+	usuario.Senha = ""
+
+	return &LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.accessTokenTTL().Seconds()),
+		Usuario:      &usuario,
+	}, registro, nil
+}
+
+func (s *AuthService) criarRefreshToken(tx *gorm.DB, usuarioID, familiaID string, info ClientInfo) (string, *models.RefreshToken, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", nil, fmt.Errorf("erro ao gerar refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	registro := &models.RefreshToken{
+		UsuarioID: usuarioID,
+		FamiliaID: familiaID,
+		TokenHash: hashToken(token),
+		ExpiraEm:  time.Now().Add(s.refreshTokenTTL()),
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+	}
+	if err := tx.Create(registro).Error; err != nil {
+		return "", nil, fmt.Errorf("erro ao salvar refresh token: %w", err)
+	}
+
+	return token, registro, nil
+}
+
+// Refresh troca um refresh token válido por um novo par de tokens (rotação).
+// Apresentar um refresh token já trocado revoga a sessão inteira.
+func (s *AuthService) Refresh(refreshToken string, info ClientInfo) (*LoginResponse, error) {
+	var resposta *LoginResponse
+	var familiaReutilizada string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var registro models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).
+			First(&registro).Error
+		if err != nil {
+			return ErrRefreshTokenInvalido
+		}
+
+		if registro.RevogadoEm != nil {
+			return ErrRefreshTokenInvalido
+		}
+		if registro.UsadoEm != nil {
+			familiaReutilizada = registro.FamiliaID
+			return ErrRefreshTokenReutilizado
+		}
+		if time.Now().After(registro.ExpiraEm) {
+			return ErrRefreshTokenInvalido
+		}
+
+		var usuario models.Usuario
+		if err := tx.Where("id = ? AND ativo = ?", registro.UsuarioID, true).First(&usuario).Error; err != nil {
+			return ErrUsuarioInativo
+		}
+
+		// Exigência ativada depois do login: o administrador precisa entrar de novo
+		// e cadastrar o segundo fator
+		if !usuario.DoisFatoresAtivo && s.doisFatoresObrigatorio(usuario) {
+			return ErrDoisFatoresObrigatorio
+		}
+
+		novo, novoRegistro, err := s.emitirTokens(tx, usuario, registro.FamiliaID, info)
+		if err != nil {
+			return err
+		}
+
+		agora := time.Now()
+		if err := tx.Model(&registro).Updates(map[string]interface{}{
+			"usado_em":           agora,
+			"substituido_por_id": novoRegistro.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		resposta = novo
+		return nil
+	})
+
+	if errors.Is(err, ErrRefreshTokenReutilizado) {
+		log.Printf("[AUTH] Reuso de refresh token detectado na sessão %s, revogando", familiaReutilizada)
+		if errRevogar := s.revogarFamilia(familiaReutilizada, MotivoRevogacaoReuso); errRevogar != nil {
+			log.Printf("[AUTH] Erro ao revogar sessão %s: %v", familiaReutilizada, errRevogar)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resposta, nil
+}
+
+// Logout revoga a sessão do refresh token informado
+func (s *AuthService) Logout(refreshToken string) error {
+	var registro models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(refreshToken)).First(&registro).Error; err != nil {
+		// Resposta idempotente: token desconhecido já não dá acesso
+		return nil
+	}
+
+	return s.revogarFamilia(registro.FamiliaID, MotivoRevogacaoLogout)
+}
+
+// LogoutSessao revoga a sessão indicada pelo access token (claim sid)
+func (s *AuthService) LogoutSessao(userID, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+
+	var total int64
+	s.db.Model(&models.RefreshToken{}).Where("familia_id = ? AND usuario_id = ?", sessionID, userID).Count(&total)
+	if total == 0 {
+		return nil
+	}
+
+	return s.revogarFamilia(sessionID, MotivoRevogacaoLogout)
+}
+
+// LogoutTodasSessoes revoga todos os refresh tokens do usuário e invalida
+// imediatamente os access tokens já emitidos
+func (s *AuthService) LogoutTodasSessoes(userID string) error {
+	agora := time.Now()
+	motivo := MotivoRevogacaoLogoutAll
+
+	var familias []string
+	s.db.Model(&models.RefreshToken{}).
+		Where("usuario_id = ? AND revogado_em IS NULL", userID).
+		Distinct().Pluck("familia_id", &familias)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("usuario_id = ? AND revogado_em IS NULL", userID).
+			Updates(map[string]interface{}{"revogado_em": agora, "motivo_revogacao": motivo}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Usuario{}).Where("id = ?", userID).Update("tokens_revogados_em", agora).Error
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao revogar sessões: %w", err)
+	}
+
+	if s.redis != nil {
+		for _, familiaID := range familias {
+			s.redis.Set(context.Background(), authSessaoRevogadaPrefix+familiaID, motivo, s.accessTokenTTL())
+		}
+	}
+
+	s.InvalidarCacheUsuario(userID)
+	return nil
+}
+
+func (s *AuthService) revogarFamilia(familiaID, motivo string) error {
+	err := s.db.Model(&models.RefreshToken{}).
+		Where("familia_id = ? AND revogado_em IS NULL", familiaID).
+		Updates(map[string]interface{}{"revogado_em": time.Now(), "motivo_revogacao": motivo}).Error
+	if err != nil {
+		return fmt.Errorf("erro ao revogar sessão: %w", err)
+	}
+
+	if s.redis != nil {
+		s.redis.Set(context.Background(), authSessaoRevogadaPrefix+familiaID, motivo, s.accessTokenTTL())
+	}
+	return nil
+}
+
+// ValidateAccessToken valida assinatura e expiração do token e também se o
+// usuário continua ativo e a sessão não foi revogada
+func (s *AuthService) ValidateAccessToken(tokenString string) (*JWTClaims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	estado, err := s.estadoUsuario(claims.UserID)
+	if err != nil || !estado.Ativo {
+		return nil, ErrUsuarioInativo
+	}
+
+	// iat tem precisão de segundos; tokens do mesmo segundo com sid são
+	// cobertos pela revogação da família
+	if estado.TokensRevogadosEm != nil && claims.IssuedAt != nil &&
+		claims.IssuedAt.Time.Before(estado.TokensRevogadosEm.Truncate(time.Second)) {
+		return nil, ErrSessaoRevogada
+	}
+
+	if claims.SessionID != "" && s.sessaoRevogada(claims.SessionID) {
+		return nil, ErrSessaoRevogada
+	}
+
+	// A organização vem sempre do banco, nunca apenas do token
+	claims.OrganizacaoID = estado.OrganizacaoID
+
+	return claims, nil
+}
+
+// estadoUsuario consulta ativo/revogação do usuário, com cache curto no Redis
+func (s *AuthService) estadoUsuario(userID string) (*estadoUsuarioAuth, error) {
+	ctx := context.Background()
+	chave := authUsuarioCachePrefix + userID
+
+	if s.redis != nil {
+		if payload, err := s.redis.Get(ctx, chave).Bytes(); err == nil {
+			var estado estadoUsuarioAuth
+			if json.Unmarshal(payload, &estado) == nil {
+				return &estado, nil
+			}
+		}
+	}
+
+	var usuario models.Usuario
+	if err := s.db.Select("id", "ativo", "tokens_revogados_em", "organizacao_id").First(&usuario, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	estado := &estadoUsuarioAuth{
+		Ativo:             usuario.Ativo,
+		TokensRevogadosEm: usuario.TokensRevogadosEm,
+		OrganizacaoID:     usuario.OrganizacaoID,
+	}
+
+	// Organização desativada bloqueia todos os seus usuários
+	if estado.Ativo && usuario.OrganizacaoID != "" {
+		var organizacao models.Organizacao
+		if err := s.db.Select("id", "ativo").First(&organizacao, "id = ?", usuario.OrganizacaoID).Error; err != nil || !organizacao.Ativo {
+			estado.Ativo = false
+		}
+	}
+
+	if s.redis != nil {
+		if payload, err := json.Marshal(estado); err == nil {
+			s.redis.Set(ctx, chave, payload, authUsuarioCacheTTL)
+		}
+	}
+	return estado, nil
+}
+
+// InvalidarCacheUsuario força nova leitura do estado do usuário (ex: após desativação)
+func (s *AuthService) InvalidarCacheUsuario(userID string) {
+	if s.redis != nil {
+		s.redis.Del(context.Background(), authUsuarioCachePrefix+userID)
+	}
+}
+
+func (s *AuthService) sessaoRevogada(familiaID string) bool {
+	if s.redis != nil {
+		existe, err := s.redis.Exists(context.Background(), authSessaoRevogadaPrefix+familiaID).Result()
+		if err == nil {
+			return existe > 0
+		}
+	}
+
+	var ativos int64
+	s.db.Model(&models.RefreshToken{}).
+		Where("familia_id = ? AND revogado_em IS NULL", familiaID).
+		Count(&ativos)
+	return ativos == 0
+}
+
+// hashToken gera o hash SHA-256 usado para armazenar tokens opacos
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+const caracteresBase83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// reduzirImagem reduz a imagem pela média dos pixels (box filter) para caber
+// em ladoMaximo, compondo a transparência sobre fundo branco
+func reduzirImagem(imagem image.Image, ladoMaximo int) *image.RGBA {
+	limites := imagem.Bounds()
+	largura, altura := limites.Dx(), limites.Dy()
+
+	novaLargura, novaAltura := largura, altura
+	if largura > ladoMaximo || altura > ladoMaximo {
+		if largura >= altura {
+			novaLargura = ladoMaximo
+			novaAltura = int(math.Max(1, math.Round(float64(altura)*float64(ladoMaximo)/float64(largura))))
+		} else {
+			novaAltura = ladoMaximo
+			novaLargura = int(math.Max(1, math.Round(float64(largura)*float64(ladoMaximo)/float64(altura))))
+		}
+	}
+
+	destino := image.NewRGBA(image.Rect(0, 0, novaLargura, novaAltura))
+	for y := 0; y < novaAltura; y++ {
+		y0 := y * altura / novaAltura
+		y1 := (y + 1) * altura / novaAltura
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < novaLargura; x++ {
+			x0 := x * largura / novaLargura
+			x1 := (x + 1) * largura / novaLargura
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, n uint64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					cr, cg, cb, ca := imagem.At(limites.Min.X+px, limites.Min.Y+py).RGBA()
+					// Cores pré-multiplicadas: somar o que falta de alfa equivale a fundo branco
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			destino.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return destino
+}
+
+// codificarBlurhash gera o blurhash (https://blurha.sh) da imagem com os
+// componentes informados (1 a 9 em cada eixo). Use uma imagem já reduzida:
+// o custo é proporcional ao número de pixels.
+func codificarBlurhash(imagem image.Image, componentesX, componentesY int) string {
+	limites := imagem.Bounds()
+	largura, altura := limites.Dx(), limites.Dy()
+
+	fatores := make([][3]float64, 0, componentesX*componentesY)
+	for j := 0; j < componentesY; j++ {
+		for i := 0; i < componentesX; i++ {
+			normalizacao := 2.0
+			if i == 0 && j == 0 {
+				normalizacao = 1.0
+			}
+
+			var fator [3]float64
+			for y := 0; y < altura; y++ {
+				for x := 0; x < largura; x++ {
+					base := normalizacao *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(largura)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(altura))
+					r, g, b, _ := imagem.At(limites.Min.X+x, limites.Min.Y+y).RGBA()
+					fator[0] += base * srgbParaLinear(r>>8)
+					fator[1] += base * srgbParaLinear(g>>8)
+					fator[2] += base * srgbParaLinear(b>>8)
+				}
+			}
+			escala := 1.0 / float64(largura*altura)
+			fator[0] *= escala
+			fator[1] *= escala
+			fator[2] *= escala
+			fatores = append(fatores, fator)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(base83((componentesX-1)+(componentesY-1)*9, 1))
+
+	dc, ac := fatores[0], fatores[1:]
+	maximo := 1.0
+	if len(ac) > 0 {
+		maiorAC := 0.0
+		for _, fator := range ac {
+			for _, valor := range fator {
+				maiorAC = math.Max(maiorAC, math.Abs(valor))
+			}
+		}
+		quantizado := int(math.Max(0, math.Min(82, math.Floor(maiorAC*166-0.5))))
+		maximo = float64(quantizado+1) / 166
+		hash.WriteString(base83(quantizado, 1))
+	} else {
+		hash.WriteString(base83(0, 1))
+	}
+
+	hash.WriteString(base83(linearParaSRGB(dc[0])<<16+linearParaSRGB(dc[1])<<8+linearParaSRGB(dc[2]), 4))
+	for _, fator := range ac {
+		quantizar := func(valor float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(potenciaComSinal(valor/maximo, 0.5)*9+9.5))))
+		}
+		hash.WriteString(base83(quantizar(fator[0])*19*19+quantizar(fator[1])*19+quantizar(fator[2]), 2))
+	}
+	return hash.String()
+}
+
+func srgbParaLinear(valor uint32) float64 {
+	v := float64(valor) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearParaSRGB(valor float64) int {
+	v := math.Max(0, math.Min(1, valor))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func potenciaComSinal(valor, expoente float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(valor), expoente), valor)
+}
+
+func base83(valor, tamanho int) string {
+	resultado := make([]byte, tamanho)
+	for i := 1; i <= tamanho; i++ {
+		digito := (valor / int(math.Pow(83, float64(tamanho-i)))) % 83
+		resultado[i-1] = caracteresBase83[digito]
+	}
+	return string(resultado)
+}
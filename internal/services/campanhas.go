@@ -0,0 +1,1242 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	mensagensPorMinutoCampanha = 10
+	intervaloMinimoCampanha    = 8  // segundos
+	intervaloMaximoCampanha    = 20 // segundos
+
+	// Falhas de envio seguidas que pausam a campanha (sessão banida, WAHA fora)
+	falhasSeguidasCampanha = 5
+
+	// Mensagens recebidas até este prazo após o envio contam como resposta
+	janelaRespostaCampanha = 7 * 24 * time.Hour
+
+	loteDestinatariosCampanha = 500
+	amostraSegmentoCampanha   = 20
+)
+
+var (
+	ErrCampanhaNaoEncontrada    = errors.New("campanha não encontrada")
+	ErrCampanhaNaoEditavel      = errors.New("apenas campanhas em rascunho ou agendadas podem ser alteradas")
+	ErrCampanhaNaoPausavel      = errors.New("apenas campanhas em andamento podem ser pausadas")
+	ErrCampanhaNaoRetomavel     = errors.New("apenas campanhas pausadas podem ser retomadas")
+	ErrCampanhaFinalizada       = errors.New("a campanha já foi concluída ou cancelada")
+	ErrCampanhaEmExecucao       = errors.New("pause ou cancele a campanha antes de excluí-la")
+	ErrCampanhaSemConteudo      = errors.New("informe a mensagem ou a resposta rápida da campanha")
+	ErrCampanhaSegmentoVazio    = errors.New("nenhum contato no segmento da campanha")
+	ErrCampanhaSessaoInvalida   = errors.New("sessão WhatsApp não encontrada na organização")
+	ErrCampanhaRespostaRapida   = errors.New("resposta rápida não encontrada na organização")
+	ErrDescadastroInvalido      = errors.New("número de telefone inválido")
+	ErrDescadastroNaoEncontrado = errors.New("descadastro não encontrado")
+)
+
+// Variáveis de personalização: {nome}, {primeiro_nome|cliente}...
+var variavelCampanha = regexp.MustCompile(`\{([a-z_]+)(?:\|([^{}]*))?\}`)
+
+var naoDigitos = regexp.MustCompile(`\D`)
+
+// DadosCampanha campos informados ao criar ou alterar uma campanha
+type DadosCampanha struct {
+	Nome                    string                  `json:"nome" binding:"required"`
+	SessaoWhatsAppID        string                  `json:"sessaoWhatsappId" binding:"required"`
+	Mensagem                *string                 `json:"mensagem"`
+	RespostaRapidaID        *string                 `json:"respostaRapidaId"`
+	Segmento                models.SegmentoCampanha `json:"segmento"`
+	MensagensPorMinuto      int                     `json:"mensagensPorMinuto"`
+	IntervaloMinimoSegundos int                     `json:"intervaloMinimoSegundos"`
+	IntervaloMaximoSegundos int                     `json:"intervaloMaximoSegundos"`
+}
+
+// EstatisticasCampanha resultado dos envios. Entregues, lidos e respondidos
+// são cumulativos (uma mensagem lida também conta como entregue).
+type EstatisticasCampanha struct {
+	Total       int64 `json:"total"`
+	Pendentes   int64 `json:"pendentes"`
+	Enviados    int64 `json:"enviados"`
+	Entregues   int64 `json:"entregues"`
+	Lidos       int64 `json:"lidos"`
+	Respondidos int64 `json:"respondidos"`
+	Falhas      int64 `json:"falhas"`
+	Suprimidos  int64 `json:"suprimidos"`
+	Cancelados  int64 `json:"cancelados"`
+}
+
+// ContatoSegmento contato da prévia de um segmento
+type ContatoSegmento struct {
+	ID             string  `json:"id"`
+	Nome           *string `json:"nome"`
+	NumeroTelefone string  `json:"numeroTelefone"`
+}
+
+// CampanhaService disparo em massa. Cada sessão tem um único worker que envia
+// para os destinatários das suas campanhas em andamento, uma de cada vez e na
+// ordem em que começaram, respeitando o ritmo de cada campanha e o teto da
+// sessão (CAMPAIGN_MAX_PER_MINUTE).
+type CampanhaService struct {
+	db                  *gorm.DB
+	whatsapp            *WhatsAppService
+	respostas           *RespostaRapidaService
+	realtime            *RealtimeService
+	limitePorMinuto     int
+	palavrasDescadastro map[string]bool
+	respostaDescadastro string
+	mutex               sync.Mutex
+	workers             map[string]chan struct{}
+	stop                chan struct{}
+}
+
+func NewCampanhaService(db *gorm.DB, whatsapp *WhatsAppService, respostas *RespostaRapidaService, realtime *RealtimeService, cfg *config.Config) *CampanhaService {
+	palavras := make(map[string]bool, len(cfg.CampaignOptOutKeywords))
+	for _, palavra := range cfg.CampaignOptOutKeywords {
+		palavras[normalizarPalavraDescadastro(palavra)] = true
+	}
+
+	limite := cfg.CampaignMaxPerMinute
+	if limite <= 0 {
+		limite = mensagensPorMinutoCampanha
+	}
+
+	// As ações da resposta rápida saem pela fila de envio com a mesma
+	// prioridade das mensagens da campanha
+	respostas = respostas.comWhatsApp(whatsapp)
+
+	return &CampanhaService{
+		db:                  db,
+		whatsapp:            whatsapp,
+		respostas:           respostas,
+		realtime:            realtime,
+		limitePorMinuto:     limite,
+		palavrasDescadastro: palavras,
+		respostaDescadastro: cfg.CampaignOptOutReply,
+		workers:             make(map[string]chan struct{}),
+	}
+}
+
+// Iniciar retoma os envios interrompidos pelo reinício do servidor e inicia
+// as campanhas agendadas quando chega o horário
+func (s *CampanhaService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.retomarInterrompidas()
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[CAMPANHA] Agendador de campanhas iniciado (intervalo: %s, teto por sessão: %d/min)", intervalo, s.limitePorMinuto)
+		for {
+			select {
+			case <-ticker.C:
+				s.iniciarAgendadas()
+			case <-s.stop:
+				log.Printf("[CAMPANHA] Agendador de campanhas finalizado")
+				return
+			}
+		}
+	}()
+}
+
+// Parar interrompe o agendador e os workers das sessões
+func (s *CampanhaService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sessaoID, stop := range s.workers {
+		close(stop)
+		delete(s.workers, sessaoID)
+	}
+}
+
+// ===== CADASTRO =====
+
+// Listar campanhas da organização, das mais recentes para as mais antigas
+func (s *CampanhaService) Listar(organizacaoID string, status models.StatusCampanha) ([]models.Campanha, error) {
+	query := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).Order("criado_em DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var campanhas []models.Campanha
+	if err := query.Find(&campanhas).Error; err != nil {
+		return nil, fmt.Errorf("erro ao listar campanhas: %w", err)
+	}
+	return campanhas, nil
+}
+
+// Buscar campanha da organização
+func (s *CampanhaService) Buscar(organizacaoID, id string) (*models.Campanha, error) {
+	var campanha models.Campanha
+	err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).Where("id = ?", id).First(&campanha).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCampanhaNaoEncontrada
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar campanha: %w", err)
+	}
+	return &campanha, nil
+}
+
+// Criar cadastra a campanha como rascunho
+func (s *CampanhaService) Criar(organizacaoID, usuarioID string, dados DadosCampanha) (*models.Campanha, error) {
+	campanha := &models.Campanha{
+		OrganizacaoID: organizacaoID,
+		UsuarioID:     usuarioID,
+		Status:        models.StatusCampanhaRascunho,
+	}
+	if err := s.aplicarDados(campanha, dados); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(campanha).Error; err != nil {
+		return nil, fmt.Errorf("erro ao criar campanha: %w", err)
+	}
+	return campanha, nil
+}
+
+// Atualizar altera uma campanha que ainda não começou
+func (s *CampanhaService) Atualizar(campanha *models.Campanha, dados DadosCampanha) error {
+	if !campanha.Status.Editavel() {
+		return ErrCampanhaNaoEditavel
+	}
+	if err := s.aplicarDados(campanha, dados); err != nil {
+		return err
+	}
+	if err := s.db.Save(campanha).Error; err != nil {
+		return fmt.Errorf("erro ao atualizar campanha: %w", err)
+	}
+	return nil
+}
+
+// Excluir remove a campanha e seus destinatários
+func (s *CampanhaService) Excluir(campanha *models.Campanha) error {
+	if campanha.Status == models.StatusCampanhaEmAndamento || campanha.Status == models.StatusCampanhaPausada {
+		return ErrCampanhaEmExecucao
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("campanha_id = ?", campanha.ID).Delete(&models.DestinatarioCampanha{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(campanha).Error
+	})
+}
+
+// aplicarDados valida a sessão, o conteúdo e o ritmo informados
+func (s *CampanhaService) aplicarDados(campanha *models.Campanha, dados DadosCampanha) error {
+	if dados.Mensagem != nil && strings.TrimSpace(*dados.Mensagem) == "" {
+		dados.Mensagem = nil
+	}
+	if dados.RespostaRapidaID != nil && *dados.RespostaRapidaID == "" {
+		dados.RespostaRapidaID = nil
+	}
+	if dados.Mensagem == nil && dados.RespostaRapidaID == nil {
+		return ErrCampanhaSemConteudo
+	}
+
+	var sessoes int64
+	s.db.Model(&models.SessaoWhatsApp{}).
+		Scopes(repositories.PorOrganizacao(campanha.OrganizacaoID)).
+		Where("id = ?", dados.SessaoWhatsAppID).
+		Count(&sessoes)
+	if sessoes == 0 {
+		return ErrCampanhaSessaoInvalida
+	}
+
+	if dados.RespostaRapidaID != nil {
+		if _, err := uuid.Parse(*dados.RespostaRapidaID); err != nil {
+			return ErrCampanhaRespostaRapida
+		}
+		var respostas int64
+		s.db.Model(&models.RespostaRapida{}).
+			Where("id = ? AND usuario_id IN (?)", *dados.RespostaRapidaID,
+				s.db.Model(&models.Usuario{}).Select("id").Where("organizacao_id = ?", campanha.OrganizacaoID)).
+			Count(&respostas)
+		if respostas == 0 {
+			return ErrCampanhaRespostaRapida
+		}
+	}
+
+	if dados.MensagensPorMinuto <= 0 {
+		dados.MensagensPorMinuto = mensagensPorMinutoCampanha
+	}
+	if dados.MensagensPorMinuto > s.limitePorMinuto {
+		dados.MensagensPorMinuto = s.limitePorMinuto
+	}
+	if dados.IntervaloMinimoSegundos <= 0 {
+		dados.IntervaloMinimoSegundos = intervaloMinimoCampanha
+	}
+	if dados.IntervaloMaximoSegundos < dados.IntervaloMinimoSegundos {
+		dados.IntervaloMaximoSegundos = dados.IntervaloMinimoSegundos + (intervaloMaximoCampanha - intervaloMinimoCampanha)
+	}
+
+	campanha.Nome = strings.TrimSpace(dados.Nome)
+	campanha.SessaoWhatsAppID = dados.SessaoWhatsAppID
+	campanha.Mensagem = dados.Mensagem
+	campanha.RespostaRapidaID = dados.RespostaRapidaID
+	campanha.Segmento = dados.Segmento
+	campanha.MensagensPorMinuto = dados.MensagensPorMinuto
+	campanha.IntervaloMinimoSegundos = dados.IntervaloMinimoSegundos
+	campanha.IntervaloMaximoSegundos = dados.IntervaloMaximoSegundos
+	return nil
+}
+
+// ===== SEGMENTO =====
+
+// consultaSegmento contatos da organização que atendem ao segmento, sem os
+// bloqueados e os descadastrados
+func (s *CampanhaService) consultaSegmento(organizacaoID string, segmento models.SegmentoCampanha) *gorm.DB {
+	query := s.db.Model(&models.Contato{}).
+		Where("contatos.organizacao_id = ? AND contatos.bloqueado = ?", organizacaoID, false).
+		Where("NOT EXISTS (SELECT 1 FROM descadastros WHERE descadastros.organizacao_id = contatos.organizacao_id" +
+			" AND descadastros.numero_telefone IN (contatos.numero_telefone, split_part(contatos.contactid, '@', 1)))")
+
+	if len(segmento.ContatoIDs) > 0 {
+		query = query.Where("contatos.id IN ?", segmento.ContatoIDs)
+	}
+	if len(segmento.TagIDs) > 0 {
+		query = query.Where("contatos.id IN (SELECT contato_id FROM contato_tags WHERE tag_id IN ?)", segmento.TagIDs)
+	}
+	if len(segmento.FilaIDs) > 0 {
+		query = query.Where("contatos.id IN (SELECT contato_id FROM fila_contatos WHERE ativo = true AND fila_id IN ?)", segmento.FilaIDs)
+	}
+	if len(segmento.ColunaIDs) > 0 {
+		// Os cards guardam o chat do WhatsApp, não o contato
+		query = query.Where("EXISTS (SELECT 1 FROM cards WHERE cards.ativo = true AND cards.coluna_id IN ?"+
+			" AND (cards.conversa_id = contatos.contactid OR split_part(cards.conversa_id, '@', 1) = contatos.numero_telefone))", segmento.ColunaIDs)
+	}
+	if len(segmento.Cidades) > 0 {
+		query = query.Where("contatos.cidade IN ?", segmento.Cidades)
+	}
+	if len(segmento.Estados) > 0 {
+		query = query.Where("contatos.estado IN ?", segmento.Estados)
+	}
+	if segmento.Empresa != "" {
+		query = query.Where("contatos.empresa ILIKE ?", "%"+segmento.Empresa+"%")
+	}
+	if segmento.Busca != "" {
+		busca := "%" + segmento.Busca + "%"
+		query = query.Where("(contatos.nome ILIKE ? OR contatos.numero_telefone LIKE ? OR contatos.email ILIKE ?)", busca, busca, busca)
+	}
+	if segmento.InteracaoDesde != nil {
+		query = query.Where("contatos.ultima_interacao >= ?", *segmento.InteracaoDesde)
+	}
+	if segmento.InteracaoAte != nil {
+		query = query.Where("contatos.ultima_interacao <= ?", *segmento.InteracaoAte)
+	}
+	if segmento.Favoritos {
+		query = query.Where("contatos.favorito = ?", true)
+	}
+	return query
+}
+
+// PreviaSegmento quantidade de contatos do segmento e uma amostra
+func (s *CampanhaService) PreviaSegmento(organizacaoID string, segmento models.SegmentoCampanha) (int64, []ContatoSegmento, error) {
+	var total int64
+	if err := s.consultaSegmento(organizacaoID, segmento).Count(&total).Error; err != nil {
+		return 0, nil, fmt.Errorf("erro ao contar contatos do segmento: %w", err)
+	}
+
+	amostra := []ContatoSegmento{}
+	err := s.consultaSegmento(organizacaoID, segmento).
+		Select("contatos.id", "contatos.nome", "contatos.numero_telefone").
+		Order("contatos.nome").
+		Limit(amostraSegmentoCampanha).
+		Scan(&amostra).Error
+	if err != nil {
+		return 0, nil, fmt.Errorf("erro ao buscar contatos do segmento: %w", err)
+	}
+	return total, amostra, nil
+}
+
+// chatDoContato chat individual do contato no WhatsApp
+func chatDoContato(contato *models.Contato) string {
+	if contato.ContactID != nil && strings.HasSuffix(*contato.ContactID, "@c.us") {
+		return *contato.ContactID
+	}
+	numero := naoDigitos.ReplaceAllString(contato.NumeroTelefone, "")
+	if numero == "" {
+		return ""
+	}
+	return numero + "@c.us"
+}
+
+// fixarDestinatarios grava os contatos do segmento como destinatários, um por
+// chat, e retorna o total
+func (s *CampanhaService) fixarDestinatarios(campanha *models.Campanha) (int, error) {
+	var contatos []models.Contato
+	total := 0
+	err := s.consultaSegmento(campanha.OrganizacaoID, campanha.Segmento).
+		Select("contatos.id", "contatos.nome", "contatos.numero_telefone", "contatos.contactid").
+		FindInBatches(&contatos, loteDestinatariosCampanha, func(tx *gorm.DB, lote int) error {
+			destinatarios := make([]models.DestinatarioCampanha, 0, len(contatos))
+			for i := range contatos {
+				chatID := chatDoContato(&contatos[i])
+				if chatID == "" {
+					continue
+				}
+				contatoID := contatos[i].ID
+				destinatarios = append(destinatarios, models.DestinatarioCampanha{
+					CampanhaID: campanha.ID,
+					ContatoID:  &contatoID,
+					ChatID:     chatID,
+					Nome:       contatos[i].Nome,
+					Status:     models.StatusDestinatarioPendente,
+				})
+			}
+			if len(destinatarios) == 0 {
+				return nil
+			}
+			resultado := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&destinatarios)
+			total += int(resultado.RowsAffected)
+			return resultado.Error
+		}).Error
+	if err != nil {
+		return 0, fmt.Errorf("erro ao gravar destinatários: %w", err)
+	}
+	return total, nil
+}
+
+// ===== CICLO DE VIDA =====
+
+// Disparar começa a enviar a campanha agora ou, com agendadaPara no futuro,
+// agenda o início. Os destinatários são fixados no início do envio.
+func (s *CampanhaService) Disparar(campanha *models.Campanha, agendadaPara *time.Time) error {
+	if !campanha.Status.Editavel() {
+		return ErrCampanhaNaoEditavel
+	}
+
+	if agendadaPara != nil && agendadaPara.After(time.Now()) {
+		var total int64
+		s.consultaSegmento(campanha.OrganizacaoID, campanha.Segmento).Count(&total)
+		if total == 0 {
+			return ErrCampanhaSegmentoVazio
+		}
+
+		campanha.Status = models.StatusCampanhaAgendada
+		campanha.AgendadaPara = agendadaPara
+		return s.db.Model(campanha).Updates(map[string]interface{}{
+			"status":        campanha.Status,
+			"agendada_para": agendadaPara,
+			"erro":          nil,
+		}).Error
+	}
+
+	return s.comecar(campanha)
+}
+
+// comecar fixa os destinatários e entrega a campanha ao worker da sessão
+func (s *CampanhaService) comecar(campanha *models.Campanha) error {
+	var sessao models.SessaoWhatsApp
+	if err := s.db.Select("id", "status").Where("id = ?", campanha.SessaoWhatsAppID).First(&sessao).Error; err != nil {
+		return ErrCampanhaSessaoInvalida
+	}
+	if !sessao.Status.Conectada() {
+		return ErrSessaoNaoConectada
+	}
+
+	total, err := s.fixarDestinatarios(campanha)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return ErrCampanhaSegmentoVazio
+	}
+
+	agora := time.Now()
+	campanha.Status = models.StatusCampanhaEmAndamento
+	campanha.TotalDestinatarios = total
+	campanha.IniciadaEm = &agora
+	campanha.Erro = nil
+	err = s.db.Model(campanha).Updates(map[string]interface{}{
+		"status":              campanha.Status,
+		"total_destinatarios": total,
+		"iniciada_em":         agora,
+		"erro":                nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar campanha: %w", err)
+	}
+
+	log.Printf("[CAMPANHA] Campanha %s iniciada para %d destinatários", campanha.ID, total)
+	s.publicarProgresso(campanha)
+	s.executarSessao(campanha.SessaoWhatsAppID)
+	return nil
+}
+
+// Pausar interrompe os envios; o destinatário em envio é concluído
+func (s *CampanhaService) Pausar(campanha *models.Campanha) error {
+	if campanha.Status != models.StatusCampanhaEmAndamento {
+		return ErrCampanhaNaoPausavel
+	}
+	campanha.Status = models.StatusCampanhaPausada
+	if err := s.db.Model(campanha).Update("status", campanha.Status).Error; err != nil {
+		return err
+	}
+	s.publicarProgresso(campanha)
+	return nil
+}
+
+// Retomar continua uma campanha pausada (manualmente ou pelo worker)
+func (s *CampanhaService) Retomar(campanha *models.Campanha) error {
+	if campanha.Status != models.StatusCampanhaPausada {
+		return ErrCampanhaNaoRetomavel
+	}
+
+	var sessao models.SessaoWhatsApp
+	if err := s.db.Select("id", "status").Where("id = ?", campanha.SessaoWhatsAppID).First(&sessao).Error; err != nil {
+		return ErrCampanhaSessaoInvalida
+	}
+	if !sessao.Status.Conectada() {
+		return ErrSessaoNaoConectada
+	}
+
+	campanha.Status = models.StatusCampanhaEmAndamento
+	campanha.Erro = nil
+	err := s.db.Model(campanha).Updates(map[string]interface{}{"status": campanha.Status, "erro": nil}).Error
+	if err != nil {
+		return err
+	}
+	s.publicarProgresso(campanha)
+	s.executarSessao(campanha.SessaoWhatsAppID)
+	return nil
+}
+
+// Cancelar encerra a campanha; os destinatários ainda não enviados ficam
+// como cancelados
+func (s *CampanhaService) Cancelar(campanha *models.Campanha) error {
+	if campanha.Status.Finalizada() {
+		return ErrCampanhaFinalizada
+	}
+
+	agora := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.DestinatarioCampanha{}).
+			Where("campanha_id = ? AND status = ?", campanha.ID, models.StatusDestinatarioPendente).
+			Update("status", models.StatusDestinatarioCancelado).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(campanha).Updates(map[string]interface{}{
+			"status":        models.StatusCampanhaCancelada,
+			"finalizada_em": agora,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao cancelar campanha: %w", err)
+	}
+
+	campanha.Status = models.StatusCampanhaCancelada
+	campanha.FinalizadaEm = &agora
+	s.publicarProgresso(campanha)
+	return nil
+}
+
+// iniciarAgendadas começa as campanhas cujo horário chegou. Sem contatos ou
+// com a sessão desconectada, a campanha fica pausada com o motivo.
+func (s *CampanhaService) iniciarAgendadas() {
+	var campanhas []models.Campanha
+	err := s.db.Where("status = ? AND agendada_para <= ?", models.StatusCampanhaAgendada, time.Now()).
+		Order("agendada_para").
+		Find(&campanhas).Error
+	if err != nil {
+		log.Printf("[CAMPANHA] Erro ao buscar campanhas agendadas: %v", err)
+		return
+	}
+
+	for i := range campanhas {
+		campanha := &campanhas[i]
+		if err := s.comecar(campanha); err != nil {
+			log.Printf("[CAMPANHA] Campanha agendada %s não iniciada: %v", campanha.ID, err)
+			s.pausarComErro(campanha, err.Error())
+		}
+	}
+}
+
+// retomarInterrompidas devolve para a fila os destinatários que estavam em
+// envio quando o servidor parou e reinicia os workers das sessões. Um
+// destinatário interrompido no meio da sequência pode receber a mensagem de
+// novo.
+func (s *CampanhaService) retomarInterrompidas() {
+	err := s.db.Model(&models.DestinatarioCampanha{}).
+		Where("status = ?", models.StatusDestinatarioEnviando).
+		Update("status", models.StatusDestinatarioPendente).Error
+	if err != nil {
+		log.Printf("[CAMPANHA] Erro ao liberar destinatários interrompidos: %v", err)
+	}
+
+	var sessoes []string
+	err = s.db.Model(&models.Campanha{}).
+		Where("status = ?", models.StatusCampanhaEmAndamento).
+		Distinct().
+		Pluck("sessao_whatsapp_id", &sessoes).Error
+	if err != nil {
+		log.Printf("[CAMPANHA] Erro ao buscar campanhas em andamento: %v", err)
+		return
+	}
+	for _, sessaoID := range sessoes {
+		log.Printf("[CAMPANHA] Retomando campanhas da sessão %s", sessaoID)
+		s.executarSessao(sessaoID)
+	}
+}
+
+func (s *CampanhaService) pausarComErro(campanha *models.Campanha, motivo string) {
+	campanha.Status = models.StatusCampanhaPausada
+	campanha.Erro = &motivo
+	err := s.db.Model(campanha).Updates(map[string]interface{}{"status": campanha.Status, "erro": motivo}).Error
+	if err != nil {
+		log.Printf("[CAMPANHA] Erro ao pausar campanha %s: %v", campanha.ID, err)
+	}
+	s.publicarProgresso(campanha)
+}
+
+// ===== ENVIO =====
+
+func (s *CampanhaService) executarSessao(sessaoID string) {
+	s.mutex.Lock()
+	if _, executando := s.workers[sessaoID]; executando {
+		s.mutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.workers[sessaoID] = stop
+	s.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			s.mutex.Lock()
+			if atual, ok := s.workers[sessaoID]; ok && atual == stop {
+				delete(s.workers, sessaoID)
+			}
+			s.mutex.Unlock()
+		}()
+		s.processarSessao(sessaoID, stop)
+	}()
+}
+
+// processarSessao envia para um destinatário por vez até não haver mais
+// campanhas em andamento na sessão
+func (s *CampanhaService) processarSessao(sessaoID string, stop chan struct{}) {
+	respostas := make(map[string]*models.RespostaRapida)
+	falhas := 0
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		campanha, destinatario, err := s.reservarDestinatario(sessaoID)
+		if err != nil {
+			log.Printf("[CAMPANHA] Erro ao buscar próximo destinatário da sessão %s: %v", sessaoID, err)
+			return
+		}
+		if destinatario == nil {
+			s.concluirCampanhas(sessaoID)
+			return
+		}
+
+		var sessao models.SessaoWhatsApp
+		if err := s.db.Where("id = ?", sessaoID).First(&sessao).Error; err != nil || !sessao.Status.Conectada() {
+			s.liberar(destinatario)
+			s.pausarSessao(sessaoID, "sessão WhatsApp desconectada")
+			return
+		}
+
+		if s.descadastrado(campanha.OrganizacaoID, destinatario.ChatID) {
+			s.atualizarDestinatario(destinatario, map[string]interface{}{"status": models.StatusDestinatarioSuprimido})
+			continue
+		}
+
+		idMensagem, err := s.enviar(campanha, destinatario, &sessao, respostas)
+		agora := time.Now()
+		var filaCheia *ErroFilaEnvio
+		if errors.As(err, &filaCheia) {
+			// A fila de envio da sessão não liberou a mensagem a tempo: o
+			// destinatário volta a ficar pendente e não conta como falha
+			log.Printf("[CAMPANHA] Fila de envio da sessão %s não liberou a campanha %s para %s: %v", sessaoID, campanha.ID, destinatario.ChatID, err)
+			s.liberar(destinatario)
+
+			espera := filaCheia.Espera
+			if espera > envioEsperaMaximaCampanha {
+				espera = envioEsperaMaximaCampanha
+			}
+			if intervalo := s.intervalo(campanha); espera < intervalo {
+				espera = intervalo
+			}
+			select {
+			case <-time.After(espera):
+			case <-stop:
+				return
+			}
+			continue
+		}
+		if err != nil {
+			falhas++
+			log.Printf("[CAMPANHA] Erro ao enviar campanha %s para %s: %v", campanha.ID, destinatario.ChatID, err)
+			s.atualizarDestinatario(destinatario, map[string]interface{}{
+				"status": models.StatusDestinatarioFalhou,
+				"erro":   err.Error(),
+			})
+			if falhas >= falhasSeguidasCampanha {
+				s.pausarComErro(campanha, fmt.Sprintf("%d falhas de envio seguidas; último erro: %v", falhas, err))
+				falhas = 0
+			}
+		} else {
+			falhas = 0
+			updates := map[string]interface{}{
+				"status":     models.StatusDestinatarioEnviado,
+				"enviado_em": agora,
+			}
+			if idMensagem != "" {
+				updates["id_mensagem"] = idMensagem
+			}
+			s.atualizarDestinatario(destinatario, updates)
+		}
+		s.publicarProgresso(campanha)
+
+		select {
+		case <-time.After(s.intervalo(campanha)):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reservarDestinatario trava o próximo destinatário pendente das campanhas em
+// andamento da sessão e o marca como em envio
+func (s *CampanhaService) reservarDestinatario(sessaoID string) (*models.Campanha, *models.DestinatarioCampanha, error) {
+	var destinatario models.DestinatarioCampanha
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Joins("JOIN campanhas ON campanhas.id = destinatarios_campanha.campanha_id").
+			Where("campanhas.sessao_whatsapp_id = ? AND campanhas.status = ?", sessaoID, models.StatusCampanhaEmAndamento).
+			Where("destinatarios_campanha.status = ?", models.StatusDestinatarioPendente).
+			Order("campanhas.iniciada_em, destinatarios_campanha.criado_em").
+			Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "destinatarios_campanha"}, Options: "SKIP LOCKED"}).
+			First(&destinatario).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&destinatario).Update("status", models.StatusDestinatarioEnviando).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var campanha models.Campanha
+	if err := s.db.Where("id = ?", destinatario.CampanhaID).First(&campanha).Error; err != nil {
+		return nil, nil, err
+	}
+	return &campanha, &destinatario, nil
+}
+
+// enviar manda a mensagem ou a sequência da resposta rápida personalizada
+// para o destinatário, com o mesmo fluxo de digitação das respostas rápidas,
+// e retorna o id da última mensagem enviada
+func (s *CampanhaService) enviar(campanha *models.Campanha, destinatario *models.DestinatarioCampanha, sessao *models.SessaoWhatsApp, respostas map[string]*models.RespostaRapida) (string, error) {
+	usuarioID, err := uuid.Parse(campanha.UsuarioID)
+	if err != nil {
+		return "", fmt.Errorf("usuário da campanha inválido: %w", err)
+	}
+	variaveis := s.variaveis(destinatario)
+
+	var acoes []models.AcaoResposta
+	if campanha.RespostaRapidaID != nil {
+		resposta, ok := respostas[*campanha.RespostaRapidaID]
+		if !ok {
+			resposta, err = s.respostas.repo.GetRespostaRapidaByID(uuid.MustParse(*campanha.RespostaRapidaID))
+			if err != nil {
+				return "", fmt.Errorf("resposta rápida da campanha não encontrada: %w", err)
+			}
+			respostas[*campanha.RespostaRapidaID] = resposta
+		}
+		acoes = resposta.Acoes
+	} else {
+		acao := models.AcaoResposta{Tipo: models.AcaoTexto, Ativo: true, Obrigatorio: true}
+		acao.SetConteudo(models.ConteudoAcao{"mensagem": *campanha.Mensagem})
+		acoes = []models.AcaoResposta{acao}
+	}
+
+	idMensagem := ""
+	enviadas := 0
+	var ultimoErro error
+	for _, acao := range acoes {
+		if !acao.Ativo {
+			continue
+		}
+		if acao.DelaySegundos > 0 {
+			time.Sleep(time.Duration(acao.DelaySegundos) * time.Second)
+		}
+		if err := personalizarAcao(&acao, variaveis); err != nil {
+			return "", err
+		}
+
+		resultado, err := s.respostas.executarAcao(&acao, destinatario.ChatID, usuarioID, sessao.NomeSessao)
+		if err != nil {
+			if acao.Obrigatorio {
+				// Com parte das ações já enviada, reenviar duplicaria mensagens:
+				// o erro deixa de ser de fila e conta como falha
+				if enviadas > 0 {
+					return idMensagem, fmt.Errorf("envio parcial (%d ações enviadas): %v", enviadas, err)
+				}
+				return idMensagem, err
+			}
+			ultimoErro = err
+			continue
+		}
+		enviadas++
+		if dados, ok := resultado.(map[string]interface{}); ok {
+			if id := chatIDWAHA(dados["id"]); id != "" {
+				idMensagem = id
+			}
+		}
+	}
+
+	// Ações opcionais que falharam não contam como falha se outra foi enviada
+	if enviadas == 0 && ultimoErro != nil {
+		return "", ultimoErro
+	}
+	return idMensagem, nil
+}
+
+// intervalo espera aleatória entre o mínimo e o máximo da campanha, nunca
+// menor que o ritmo permitido por minuto
+func (s *CampanhaService) intervalo(campanha *models.Campanha) time.Duration {
+	minimo := campanha.IntervaloMinimoSegundos
+	maximo := campanha.IntervaloMaximoSegundos
+	if maximo < minimo {
+		maximo = minimo
+	}
+	espera := time.Duration(minimo)*time.Second + time.Duration(rand.Int63n(int64(maximo-minimo)*int64(time.Second)+1))
+
+	porMinuto := campanha.MensagensPorMinuto
+	if porMinuto <= 0 || porMinuto > s.limitePorMinuto {
+		porMinuto = s.limitePorMinuto
+	}
+	if piso := time.Minute / time.Duration(porMinuto); espera < piso {
+		espera = piso
+	}
+	return espera
+}
+
+func (s *CampanhaService) atualizarDestinatario(destinatario *models.DestinatarioCampanha, updates map[string]interface{}) {
+	if err := s.db.Model(destinatario).Updates(updates).Error; err != nil {
+		log.Printf("[CAMPANHA] Erro ao atualizar destinatário %s: %v", destinatario.ID, err)
+	}
+}
+
+func (s *CampanhaService) liberar(destinatario *models.DestinatarioCampanha) {
+	s.atualizarDestinatario(destinatario, map[string]interface{}{"status": models.StatusDestinatarioPendente})
+}
+
+// pausarSessao pausa as campanhas em andamento da sessão com o motivo
+func (s *CampanhaService) pausarSessao(sessaoID, motivo string) {
+	var campanhas []models.Campanha
+	s.db.Where("sessao_whatsapp_id = ? AND status = ?", sessaoID, models.StatusCampanhaEmAndamento).Find(&campanhas)
+	for i := range campanhas {
+		log.Printf("[CAMPANHA] Campanha %s pausada: %s", campanhas[i].ID, motivo)
+		s.pausarComErro(&campanhas[i], motivo)
+	}
+}
+
+// concluirCampanhas finaliza as campanhas em andamento da sessão que não têm
+// mais destinatários para enviar
+func (s *CampanhaService) concluirCampanhas(sessaoID string) {
+	var campanhas []models.Campanha
+	err := s.db.Where("sessao_whatsapp_id = ? AND status = ?", sessaoID, models.StatusCampanhaEmAndamento).
+		Where("NOT EXISTS (SELECT 1 FROM destinatarios_campanha WHERE destinatarios_campanha.campanha_id = campanhas.id AND destinatarios_campanha.status IN ?)",
+			[]models.StatusDestinatarioCampanha{models.StatusDestinatarioPendente, models.StatusDestinatarioEnviando}).
+		Find(&campanhas).Error
+	if err != nil {
+		log.Printf("[CAMPANHA] Erro ao buscar campanhas concluídas da sessão %s: %v", sessaoID, err)
+		return
+	}
+
+	agora := time.Now()
+	for i := range campanhas {
+		campanha := &campanhas[i]
+		err := s.db.Model(campanha).Updates(map[string]interface{}{
+			"status":        models.StatusCampanhaConcluida,
+			"finalizada_em": agora,
+		}).Error
+		if err != nil {
+			log.Printf("[CAMPANHA] Erro ao concluir campanha %s: %v", campanha.ID, err)
+			continue
+		}
+		campanha.Status = models.StatusCampanhaConcluida
+		campanha.FinalizadaEm = &agora
+		log.Printf("[CAMPANHA] Campanha %s concluída", campanha.ID)
+		s.publicarProgresso(campanha)
+	}
+}
+
+// ===== PERSONALIZAÇÃO =====
+
+// variaveis valores disponíveis para personalizar a mensagem do destinatário
+func (s *CampanhaService) variaveis(destinatario *models.DestinatarioCampanha) map[string]string {
+	agora := time.Now()
+	variaveis := map[string]string{
+		"telefone":      strings.SplitN(destinatario.ChatID, "@", 2)[0],
+		"data_atual":    agora.Format("02/01/2006"),
+		"horario_atual": agora.Format("15:04"),
+	}
+	if destinatario.Nome != nil {
+		variaveis["nome"] = strings.TrimSpace(*destinatario.Nome)
+	}
+
+	if destinatario.ContatoID != nil {
+		var contato models.Contato
+		if s.db.Where("id = ?", *destinatario.ContatoID).First(&contato).Error == nil {
+			for chave, valor := range map[string]*string{
+				"nome":    contato.Nome,
+				"email":   contato.Email,
+				"empresa": contato.Empresa,
+				"cidade":  contato.Cidade,
+				"estado":  contato.Estado,
+			} {
+				if valor != nil && strings.TrimSpace(*valor) != "" {
+					variaveis[chave] = strings.TrimSpace(*valor)
+				}
+			}
+		}
+	}
+	if nome := variaveis["nome"]; nome != "" {
+		variaveis["primeiro_nome"] = strings.Fields(nome)[0]
+	}
+	return variaveis
+}
+
+// personalizar troca as variáveis do texto. Variáveis sem valor usam o padrão
+// após "|" ({primeiro_nome|cliente}) ou ficam vazias; desconhecidas são mantidas.
+func personalizar(texto string, variaveis map[string]string) string {
+	return variavelCampanha.ReplaceAllStringFunc(texto, func(trecho string) string {
+		partes := variavelCampanha.FindStringSubmatch(trecho)
+		if valor, ok := variaveis[partes[1]]; ok && valor != "" {
+			return valor
+		}
+		if strings.Contains(trecho, "|") {
+			return partes[2]
+		}
+		if variavelConhecida(partes[1]) {
+			return ""
+		}
+		return trecho
+	})
+}
+
+func variavelConhecida(nome string) bool {
+	switch nome {
+	case "nome", "primeiro_nome", "telefone", "email", "empresa", "cidade", "estado", "data_atual", "horario_atual":
+		return true
+	}
+	return false
+}
+
+// personalizarAcao aplica as variáveis aos textos e legendas da ação
+func personalizarAcao(acao *models.AcaoResposta, variaveis map[string]string) error {
+	conteudo, err := acao.GetConteudo()
+	if err != nil {
+		return fmt.Errorf("erro ao deserializar conteúdo da ação: %w", err)
+	}
+	for _, campo := range []string{"mensagem", "texto", "caption", "legenda"} {
+		if texto, ok := conteudo[campo].(string); ok {
+			conteudo[campo] = personalizar(texto, variaveis)
+		}
+	}
+	return acao.SetConteudo(conteudo)
+}
+
+// ===== ACOMPANHAMENTO =====
+
+// AcompanharEventoWAHA consumidor de acks e mensagens recebidas: registra
+// entrega, leitura e resposta dos destinatários e descadastra quem responde
+// com uma das palavras de descadastro
+func (s *CampanhaService) AcompanharEventoWAHA(evento *EventoWAHA) error {
+	switch {
+	case evento.Ack != nil:
+		return s.registrarAck(evento.Ack)
+	case evento.Mensagem != nil:
+		mensagem := evento.Mensagem
+		chatID := mensagem.ChatID()
+		if mensagem.FromMe || evento.SessaoWhatsApp == nil || !strings.HasSuffix(chatID, "@c.us") {
+			return nil
+		}
+		if err := s.registrarResposta(evento.SessaoWhatsApp.ID, chatID); err != nil {
+			return err
+		}
+		if palavra := normalizarPalavraDescadastro(mensagem.Body); s.palavrasDescadastro[palavra] {
+			return s.descadastrarPorResposta(evento.SessaoWhatsApp, chatID, palavra)
+		}
+	}
+	return nil
+}
+
+// registrarAck avança o status do destinatário cuja última mensagem recebeu o ack
+func (s *CampanhaService) registrarAck(ack *AckWAHA) error {
+	if ack.ID == "" || !ack.FromMe {
+		return nil
+	}
+
+	agora := time.Now()
+	query := s.db.Model(&models.DestinatarioCampanha{}).Where("id_mensagem = ?", ack.ID)
+	switch StatusMensagemDoAck(ack.Ack) {
+	case models.StatusMensagemEntregue:
+		return query.Where("status = ?", models.StatusDestinatarioEnviado).Updates(map[string]interface{}{
+			"status":      models.StatusDestinatarioEntregue,
+			"entregue_em": gorm.Expr("COALESCE(entregue_em, ?)", agora),
+		}).Error
+	case models.StatusMensagemLido:
+		return query.Where("status IN ?", []models.StatusDestinatarioCampanha{models.StatusDestinatarioEnviado, models.StatusDestinatarioEntregue}).
+			Updates(map[string]interface{}{
+				"status":      models.StatusDestinatarioLido,
+				"entregue_em": gorm.Expr("COALESCE(entregue_em, ?)", agora),
+				"lido_em":     gorm.Expr("COALESCE(lido_em, ?)", agora),
+			}).Error
+	case models.StatusMensagemFalhou:
+		return query.Where("status = ?", models.StatusDestinatarioEnviado).Updates(map[string]interface{}{
+			"status": models.StatusDestinatarioFalhou,
+			"erro":   "falha na entrega informada pelo WhatsApp",
+		}).Error
+	}
+	return nil
+}
+
+// registrarResposta marca como respondidos os envios recentes da sessão para o chat
+func (s *CampanhaService) registrarResposta(sessaoID, chatID string) error {
+	agora := time.Now()
+	return s.db.Model(&models.DestinatarioCampanha{}).
+		Where("chat_id = ? AND respondido_em IS NULL AND enviado_em >= ?", chatID, agora.Add(-janelaRespostaCampanha)).
+		Where("status IN ?", []models.StatusDestinatarioCampanha{models.StatusDestinatarioEnviado, models.StatusDestinatarioEntregue, models.StatusDestinatarioLido}).
+		Where("campanha_id IN (?)", s.db.Model(&models.Campanha{}).Select("id").Where("sessao_whatsapp_id = ?", sessaoID)).
+		Updates(map[string]interface{}{
+			"status":        models.StatusDestinatarioRespondido,
+			"entregue_em":   gorm.Expr("COALESCE(entregue_em, ?)", agora),
+			"lido_em":       gorm.Expr("COALESCE(lido_em, ?)", agora),
+			"respondido_em": agora,
+		}).Error
+}
+
+// normalizarPalavraDescadastro compara "Sair.", " stop!" e "SAIR" como iguais
+func normalizarPalavraDescadastro(texto string) string {
+	return strings.ToUpper(strings.Trim(strings.TrimSpace(texto), ".!;,* "))
+}
+
+func (s *CampanhaService) descadastrarPorResposta(sessao *models.SessaoWhatsApp, chatID, palavra string) error {
+	if sessao.OrganizacaoID == "" {
+		return nil
+	}
+	numero := strings.SplitN(chatID, "@", 2)[0]
+
+	// Campanha mais recente enviada ao chat, para o relatório
+	var campanhaID *string
+	var destinatario models.DestinatarioCampanha
+	err := s.db.Joins("JOIN campanhas ON campanhas.id = destinatarios_campanha.campanha_id").
+		Where("campanhas.sessao_whatsapp_id = ? AND destinatarios_campanha.chat_id = ? AND destinatarios_campanha.enviado_em IS NOT NULL", sessao.ID, chatID).
+		Order("destinatarios_campanha.enviado_em DESC").
+		First(&destinatario).Error
+	if err == nil {
+		campanhaID = &destinatario.CampanhaID
+	}
+
+	descadastro := &models.Descadastro{
+		OrganizacaoID:  sessao.OrganizacaoID,
+		NumeroTelefone: numero,
+		Origem:         models.OrigemDescadastroPalavraChave,
+		Palavra:        &palavra,
+		CampanhaID:     campanhaID,
+	}
+	criado, err := s.registrarDescadastro(descadastro)
+	if err != nil {
+		return err
+	}
+	if !criado {
+		return nil
+	}
+
+	log.Printf("[CAMPANHA] Contato %s descadastrado das campanhas (resposta %q)", numero, palavra)
+	if s.respostaDescadastro != "" {
+		// A confirmação responde o contato: sai com prioridade de automação, à
+		// frente das campanhas, e espera a vez na fila fora do worker do WAHA
+		go func() {
+			whatsapp := s.whatsapp.ComPrioridade(PrioridadeEnvioAutomacao)
+			if _, err := whatsapp.SendMessage(sessao.NomeSessao, chatID, s.respostaDescadastro); err != nil {
+				log.Printf("[CAMPANHA] Erro ao confirmar descadastro de %s: %v", numero, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// registrarDescadastro grava o número e suprime os envios pendentes para ele
+// nas campanhas da organização. Retorna false se o número já estava descadastrado.
+func (s *CampanhaService) registrarDescadastro(descadastro *models.Descadastro) (bool, error) {
+	criado := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		resultado := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(descadastro)
+		if resultado.Error != nil {
+			return resultado.Error
+		}
+		criado = resultado.RowsAffected > 0
+
+		return tx.Model(&models.DestinatarioCampanha{}).
+			Where("status = ? AND split_part(chat_id, '@', 1) = ?", models.StatusDestinatarioPendente, descadastro.NumeroTelefone).
+			Where("campanha_id IN (?)", tx.Model(&models.Campanha{}).Select("id").Where("organizacao_id = ?", descadastro.OrganizacaoID)).
+			Update("status", models.StatusDestinatarioSuprimido).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("erro ao registrar descadastro: %w", err)
+	}
+	return criado, nil
+}
+
+func (s *CampanhaService) descadastrado(organizacaoID, chatID string) bool {
+	var total int64
+	s.db.Model(&models.Descadastro{}).
+		Where("organizacao_id = ? AND numero_telefone = ?", organizacaoID, strings.SplitN(chatID, "@", 2)[0]).
+		Count(&total)
+	return total > 0
+}
+
+// ===== DESCADASTROS =====
+
+// ListarDescadastros números descadastrados da organização
+func (s *CampanhaService) ListarDescadastros(organizacaoID, busca string) ([]models.Descadastro, error) {
+	query := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).Order("criado_em DESC")
+	if busca != "" {
+		query = query.Where("numero_telefone LIKE ?", "%"+naoDigitos.ReplaceAllString(busca, "")+"%")
+	}
+
+	var descadastros []models.Descadastro
+	if err := query.Find(&descadastros).Error; err != nil {
+		return nil, fmt.Errorf("erro ao listar descadastros: %w", err)
+	}
+	return descadastros, nil
+}
+
+// Descadastrar inclui manualmente um número na lista de descadastro
+func (s *CampanhaService) Descadastrar(organizacaoID, usuarioID, numero string) (*models.Descadastro, error) {
+	numero = naoDigitos.ReplaceAllString(numero, "")
+	if len(numero) < 8 {
+		return nil, ErrDescadastroInvalido
+	}
+
+	descadastro := &models.Descadastro{
+		OrganizacaoID:  organizacaoID,
+		NumeroTelefone: numero,
+		Origem:         models.OrigemDescadastroManual,
+		UsuarioID:      &usuarioID,
+	}
+	if _, err := s.registrarDescadastro(descadastro); err != nil {
+		return nil, err
+	}
+
+	var salvo models.Descadastro
+	err := s.db.Where("organizacao_id = ? AND numero_telefone = ?", organizacaoID, numero).First(&salvo).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar descadastro: %w", err)
+	}
+	return &salvo, nil
+}
+
+// RemoverDescadastro volta a incluir o número nas próximas campanhas
+func (s *CampanhaService) RemoverDescadastro(organizacaoID, id string) (*models.Descadastro, error) {
+	var descadastro models.Descadastro
+	err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).Where("id = ?", id).First(&descadastro).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDescadastroNaoEncontrado
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar descadastro: %w", err)
+	}
+	if err := s.db.Delete(&descadastro).Error; err != nil {
+		return nil, fmt.Errorf("erro ao remover descadastro: %w", err)
+	}
+	return &descadastro, nil
+}
+
+// ===== RESULTADOS =====
+
+// Estatisticas totais dos destinatários da campanha
+func (s *CampanhaService) Estatisticas(campanhaID string) (*EstatisticasCampanha, error) {
+	var estatisticas EstatisticasCampanha
+	err := s.db.Model(&models.DestinatarioCampanha{}).
+		Select(`COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE status IN ('PENDENTE', 'ENVIANDO')) AS pendentes,
+			COUNT(enviado_em) AS enviados,
+			COUNT(entregue_em) AS entregues,
+			COUNT(lido_em) AS lidos,
+			COUNT(respondido_em) AS respondidos,
+			COUNT(*) FILTER (WHERE status = 'FALHOU') AS falhas,
+			COUNT(*) FILTER (WHERE status = 'SUPRIMIDO') AS suprimidos,
+			COUNT(*) FILTER (WHERE status = 'CANCELADO') AS cancelados`).
+		Where("campanha_id = ?", campanhaID).
+		Scan(&estatisticas).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao calcular estatísticas da campanha: %w", err)
+	}
+	return &estatisticas, nil
+}
+
+// ListarDestinatarios destinatários da campanha, opcionalmente por status
+func (s *CampanhaService) ListarDestinatarios(campanhaID string, status models.StatusDestinatarioCampanha, limite, offset int) ([]models.DestinatarioCampanha, int64, error) {
+	query := s.db.Model(&models.DestinatarioCampanha{}).Where("campanha_id = ?", campanhaID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("erro ao contar destinatários: %w", err)
+	}
+
+	var destinatarios []models.DestinatarioCampanha
+	err := query.Order("criado_em").Limit(limite).Offset(offset).Find(&destinatarios).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("erro ao listar destinatários: %w", err)
+	}
+	return destinatarios, total, nil
+}
+
+// publicarProgresso envia o status e as estatísticas para quem criou a campanha
+func (s *CampanhaService) publicarProgresso(campanha *models.Campanha) {
+	if s.realtime == nil {
+		return
+	}
+	estatisticas, err := s.Estatisticas(campanha.ID)
+	if err != nil {
+		return
+	}
+
+	s.realtime.PublishToUser(campanha.UsuarioID, "campaign_progress", map[string]interface{}{
+		"campanhaId":   campanha.ID,
+		"status":       campanha.Status,
+		"erro":         campanha.Erro,
+		"estatisticas": estatisticas,
+	})
+}
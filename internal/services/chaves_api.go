@@ -0,0 +1,181 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrChaveAPIInvalida = errors.New("chave de API inválida, expirada ou revogada")
+	ErrChaveAPILimite   = errors.New("limite de requisições da chave de API excedido")
+)
+
+const (
+	chaveAPIPrefixo = "tpk_"
+
+	chaveAPILimitePadrao = 60
+	chaveAPILimiteMaximo = 6000
+
+	// Intervalo mínimo entre gravações de último uso da mesma chave
+	chaveAPIIntervaloUltimoUso = time.Minute
+)
+
+// NovaChaveAPIRequest dados para criar uma chave de API
+type NovaChaveAPIRequest struct {
+	Nome            string                 `json:"nome" binding:"required"`
+	Escopos         models.ListaPermissoes `json:"escopos" binding:"required"`
+	LimitePorMinuto int                    `json:"limitePorMinuto"`
+	ExpiraEm        *time.Time             `json:"expiraEm"`
+}
+
+// ChaveAPIService gerencia e autentica as chaves de API das organizações
+type ChaveAPIService struct {
+	db          *gorm.DB
+	authService *AuthService
+	rateLimiter *RateLimiter
+}
+
+func NewChaveAPIService(db *gorm.DB, authService *AuthService, rateLimiter *RateLimiter) *ChaveAPIService {
+	return &ChaveAPIService{
+		db:          db,
+		authService: authService,
+		rateLimiter: rateLimiter,
+	}
+}
+
+// Criar gera a chave e retorna o valor completo, exibido uma única vez. Cabe a
+// quem chama garantir que o usuário possui os escopos concedidos.
+func (s *ChaveAPIService) Criar(organizacaoID, usuarioID string, req NovaChaveAPIRequest) (*models.ChaveAPI, string, error) {
+	if len(req.Escopos) == 0 {
+		return nil, "", errors.New("informe ao menos um escopo")
+	}
+	if err := ValidarPermissoes(req.Escopos); err != nil {
+		return nil, "", err
+	}
+
+	limite := req.LimitePorMinuto
+	if limite <= 0 {
+		limite = chaveAPILimitePadrao
+	}
+	if limite > chaveAPILimiteMaximo {
+		return nil, "", fmt.Errorf("o limite máximo é de %d requisições por minuto", chaveAPILimiteMaximo)
+	}
+	if req.ExpiraEm != nil && !req.ExpiraEm.After(time.Now()) {
+		return nil, "", errors.New("a data de expiração deve estar no futuro")
+	}
+
+	identificador := make([]byte, 4)
+	segredo := make([]byte, 32)
+	if _, err := rand.Read(identificador); err != nil {
+		return nil, "", fmt.Errorf("erro ao gerar chave: %w", err)
+	}
+	if _, err := rand.Read(segredo); err != nil {
+		return nil, "", fmt.Errorf("erro ao gerar chave: %w", err)
+	}
+
+	prefixo := chaveAPIPrefixo + hex.EncodeToString(identificador)
+	valor := prefixo + "_" + base64.RawURLEncoding.EncodeToString(segredo)
+
+	chave := &models.ChaveAPI{
+		OrganizacaoID:   organizacaoID,
+		UsuarioID:       usuarioID,
+		Nome:            strings.TrimSpace(req.Nome),
+		Prefixo:         prefixo,
+		ChaveHash:       hashToken(valor),
+		Escopos:         req.Escopos,
+		LimitePorMinuto: limite,
+		ExpiraEm:        req.ExpiraEm,
+	}
+	if err := s.db.Create(chave).Error; err != nil {
+		return nil, "", fmt.Errorf("erro ao salvar chave de API: %w", err)
+	}
+
+	log.Printf("[API_KEY] Chave %s criada por %s na organização %s", chave.Prefixo, usuarioID, organizacaoID)
+	return chave, valor, nil
+}
+
+// Listar retorna as chaves da organização (sem o valor)
+func (s *ChaveAPIService) Listar(organizacaoID string) ([]models.ChaveAPI, error) {
+	var chaves []models.ChaveAPI
+	err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Preload("Usuario", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "nome", "email")
+		}).
+		Order("criado_em DESC").
+		Find(&chaves).Error
+	return chaves, err
+}
+
+// Revogar desativa a chave imediatamente
+func (s *ChaveAPIService) Revogar(organizacaoID, id, revogadoPor string) error {
+	result := s.db.Model(&models.ChaveAPI{}).
+		Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("id = ? AND revogado_em IS NULL", id).
+		Updates(map[string]interface{}{
+			"revogado_em":  time.Now(),
+			"revogado_por": revogadoPor,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	log.Printf("[API_KEY] Chave %s revogada por %s", id, revogadoPor)
+	return nil
+}
+
+// Autenticar valida a chave recebida no header X-Api-Key, aplica o limite por
+// minuto e registra o uso. Quando o limite é excedido retorna o tempo de espera.
+func (s *ChaveAPIService) Autenticar(valor, ip string) (*models.ChaveAPI, time.Duration, error) {
+	valor = strings.TrimSpace(valor)
+	if !strings.HasPrefix(valor, chaveAPIPrefixo) {
+		return nil, 0, ErrChaveAPIInvalida
+	}
+
+	var chave models.ChaveAPI
+	if err := s.db.Preload("Usuario").Where("chave_hash = ?", hashToken(valor)).First(&chave).Error; err != nil {
+		return nil, 0, ErrChaveAPIInvalida
+	}
+	if !chave.Valida() || chave.Usuario == nil {
+		return nil, 0, ErrChaveAPIInvalida
+	}
+
+	// O dono da chave precisa continuar ativo e na mesma organização
+	estado, err := s.authService.estadoUsuario(chave.UsuarioID)
+	if err != nil || !estado.Ativo || estado.OrganizacaoID != chave.OrganizacaoID {
+		return nil, 0, ErrChaveAPIInvalida
+	}
+
+	if ok, espera := s.rateLimiter.Permitir("apikey:"+chave.ID, chave.LimitePorMinuto, time.Minute); !ok {
+		return &chave, espera, ErrChaveAPILimite
+	}
+
+	if chave.UltimoUsoEm == nil || time.Since(*chave.UltimoUsoEm) > chaveAPIIntervaloUltimoUso {
+		go s.registrarUso(chave.ID, ip)
+	}
+
+	return &chave, 0, nil
+}
+
+func (s *ChaveAPIService) registrarUso(id, ip string) {
+	err := s.db.Model(&models.ChaveAPI{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ultimo_uso_em": time.Now(),
+		"ultimo_uso_ip": ip,
+	}).Error
+	if err != nil {
+		log.Printf("[API_KEY] Erro ao registrar uso da chave %s: %v", id, err)
+	}
+}
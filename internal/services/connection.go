@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,6 +11,8 @@ import (
 
 	"tappyone/internal/models"
 	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
 )
 
 type ConnectionService struct {
@@ -145,8 +148,48 @@ func (s *ConnectionService) checkWAHASessionStatus(sessionName string) (string,
 	return result.Status, nil
 }
 
+// restartWAHASession starts a stopped session or restarts a failed one in WAHA API
+func (s *ConnectionService) restartWAHASession(sessionName, wahaStatus string) error {
+	action := "restart"
+	if wahaStatus == "STOPPED" {
+		action = "start"
+	}
+	url := fmt.Sprintf("%s/sessions/%s/%s", s.wahaAPIURL, sessionName, action)
+
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", action, err)
+	}
+
+	req.Header.Set("X-Api-Key", s.wahaAPIKey)
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to %s WAHA session: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("WAHA API returned status %d on %s", resp.StatusCode, action)
+	}
+
+	return nil
+}
+
 // DisconnectWhatsApp disconnects WhatsApp session both in WAHA and database
 func (s *ConnectionService) DisconnectWhatsApp(userID uuid.UUID, sessionName string) error {
+	// A sessão precisa ser da organização e liberada ao usuário antes de tocar no WAHA
+	sessao, err := s.connectionRepo.BuscarSessaoWhatsApp(userID, sessionName)
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, repositories.ErrOrganizacaoNaoInformada) {
+		return ErrSessaoNaoPermitida
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find session: %w", err)
+	}
+	sessionName = sessao.NomeSessao
+
 	// Delete session in WAHA API
 	url := fmt.Sprintf("%s/sessions/%s", s.wahaAPIURL, sessionName)
 	
@@ -170,6 +213,7 @@ func (s *ConnectionService) DisconnectWhatsApp(userID uuid.UUID, sessionName str
 			status := models.ConnectionStatusDisconnected
 			return &status
 		}(),
+		SessionName: &sessionName,
 		SessionData: models.SessionData{
 			"disconnected_at": time.Now().Format(time.RFC3339),
 			"waha_deleted":    resp.StatusCode == 200,
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"log"
+
 	"tappyone/internal/config"
 	"tappyone/internal/repositories"
 
@@ -15,16 +17,35 @@ type Container struct {
 	Config *config.Config
 
 	// Serviços
-	AuthService           *AuthService
-	UserService           *UserService
-	WhatsAppService       *WhatsAppService
-	KanbanService         *KanbanService
-	MessageService        *MessageService
-	AIService             *AIService
-	EmailService          *EmailService
-	ConnectionService     *ConnectionService
-	RespostaRapidaService *RespostaRapidaService
-	FluxoExecutionService *FluxoExecutionService
+	AuthService            *AuthService
+	UserService            *UserService
+	WhatsAppService        *WhatsAppService
+	AgendadorEnvios        *AgendadorEnvios
+	KanbanService          *KanbanService
+	MessageService         *MessageService
+	AIService              *AIService
+	AgenteIAService        *AgenteIAService
+	EmailService           *EmailService
+	ConnectionService      *ConnectionService
+	RespostaRapidaService  *RespostaRapidaService
+	FluxoExecutionService  *FluxoExecutionService
+	SLAService             *SLAService
+	RealtimeService        *RealtimeService
+	RateLimiter            *RateLimiter
+	PermissionService      *PermissionService
+	OrganizacaoService     *OrganizacaoService
+	ChaveAPIService        *ChaveAPIService
+	AuditoriaService       *AuditoriaService
+	WebhookService         *WebhookService
+	IngestaoWebhookService *IngestaoWebhookService
+	DespachanteWAHA        *DespachanteWAHA
+	SupervisorSessoes      *SupervisorSessoesService
+	ImportacaoHistorico    *ImportacaoHistoricoService
+	MidiaService           *MidiaService
+	ProcessamentoMidia     *ProcessamentoMidiaService
+	RetencaoMidia          *RetencaoMidiaService
+	Transcricao            *TranscricaoService
+	Campanhas              *CampanhaService
 }
 
 // NewContainer cria uma nova instância do container de serviços
@@ -36,24 +57,98 @@ func NewContainer(db *gorm.DB, redis *redis.Client, cfg *config.Config) *Contain
 	}
 
 	// Inicializar serviços
-	container.AuthService = NewAuthService(db, redis, cfg)
+	container.EmailService = NewEmailService(cfg)
+	container.RateLimiter = NewRateLimiter(redis)
+	container.AuthService = NewAuthService(db, redis, cfg, container.EmailService)
 	container.UserService = NewUserService(db)
+	container.PermissionService = NewPermissionService(db, redis)
+	container.AuditoriaService = NewAuditoriaService(db)
+	container.WebhookService = NewWebhookService(db)
+	container.IngestaoWebhookService = NewIngestaoWebhookService(db, redis, cfg)
+	container.OrganizacaoService = NewOrganizacaoService(db, cfg, container.EmailService, container.AuthService)
+	container.ChaveAPIService = NewChaveAPIService(db, container.AuthService, container.RateLimiter)
 	container.WhatsAppService = NewWhatsAppService(db, cfg)
+
+	// Fila de envio por sessão (anti-banimento) usada por todos os envios. O
+	// WhatsAppService do container envia como atendente; as automações recebem
+	// cópias com prioridade menor.
+	container.AgendadorEnvios = NewAgendadorEnvios(db, redis, cfg)
+	container.WhatsAppService.DefinirAgendador(container.AgendadorEnvios)
+	whatsappAutomacao := container.WhatsAppService.ComPrioridade(PrioridadeEnvioAutomacao)
+
 	container.KanbanService = NewKanbanService(db)
 	container.MessageService = NewMessageService(db, redis)
 	container.AIService = NewAIService(cfg)
-	container.EmailService = NewEmailService(cfg)
+	container.RealtimeService = NewRealtimeService(redis)
+
+	// Armazenamento de mídia (disco local ou S3 compatível)
+	armazenamentoMidia, err := NewMediaStorage(cfg)
+	if err != nil {
+		log.Fatal("Falha ao configurar armazenamento de mídia:", err)
+	}
+	container.MidiaService = NewMidiaService(db, armazenamentoMidia, cfg)
+	container.ProcessamentoMidia = NewProcessamentoMidiaService(db, container.MidiaService, cfg)
+	container.MidiaService.DefinirProcessamento(container.ProcessamentoMidia)
+	container.RetencaoMidia = NewRetencaoMidiaService(db, container.MidiaService, cfg)
+
+	// Transcrição das mensagens de voz (opcional)
+	transcritor, err := NewTranscriber(cfg, container.ProcessamentoMidia)
+	if err != nil {
+		log.Printf("[TRANSCRICAO] Transcrição de áudio desativada: %v", err)
+	}
+	container.Transcricao = NewTranscricaoService(db, container.MidiaService, transcritor, container.RealtimeService, cfg)
 
 	// Inicializar repositórios e serviços de conexão
 	connectionRepo := repositories.NewConnectionRepository(db)
-	container.ConnectionService = NewConnectionService(connectionRepo, "http://159.65.34.199:3001/api", "tappyone-waha-2024-secretkey")
+	container.ConnectionService = NewConnectionService(connectionRepo, cfg.WhatsAppAPIURL, cfg.WhatsAppAPIToken)
 
 	// Inicializar serviço de respostas rápidas
 	respostaRapidaRepo := repositories.NewRespostaRapidaRepository(db)
-	container.RespostaRapidaService = NewRespostaRapidaService(respostaRapidaRepo, container.WhatsAppService)
+	container.RespostaRapidaService = NewRespostaRapidaService(respostaRapidaRepo, whatsappAutomacao, container.AuditoriaService)
+
+	// Campanhas de disparo em massa (usam as ações das respostas rápidas)
+	container.Campanhas = NewCampanhaService(db, container.WhatsAppService.ComPrioridade(PrioridadeEnvioCampanha), container.RespostaRapidaService, container.RealtimeService, cfg)
 
 	// Inicializar serviço de execução de fluxos
-	container.FluxoExecutionService = NewFluxoExecutionService(db, container.WhatsAppService, container.KanbanService)
+	container.FluxoExecutionService = NewFluxoExecutionService(db, whatsappAutomacao, container.KanbanService)
+
+	// Inicializar serviço de SLA
+	container.SLAService = NewSLAService(db, container.EmailService)
+
+	// Inicializar supervisor das sessões do WhatsApp
+	container.SupervisorSessoes = NewSupervisorSessoesService(db, container.ConnectionService, container.EmailService, container.RealtimeService)
+
+	container.AgenteIAService = NewAgenteIAService(db, container.AIService, whatsappAutomacao)
+	container.Transcricao.AoTranscrever(container.AgenteIAService.ResponderTranscricao)
+	container.ImportacaoHistorico = NewImportacaoHistoricoService(db, container.WhatsAppService, container.MessageService, container.RealtimeService)
+	container.registrarConsumidoresWAHA()
 
 	return container
 }
+
+// registrarConsumidoresWAHA liga a fila de ingestão ao despachante e assina os
+// consumidores de eventos do WAHA. A ordem importa: a mensagem é gravada antes
+// das automações, que podem consultar o histórico da conversa.
+func (c *Container) registrarConsumidoresWAHA() {
+	c.DespachanteWAHA = NewDespachanteWAHA(c.DB)
+
+	// As origens antigas continuam registradas para reprocessar falhas já gravadas
+	for _, origem := range []string{OrigemWebhookWAHA, OrigemWebhookWhatsApp, OrigemWebhookRespostaRapida} {
+		c.IngestaoWebhookService.RegistrarProcessador(origem, c.DespachanteWAHA.Processar)
+	}
+
+	d := c.DespachanteWAHA
+	d.Assinar("status-sessao", c.WhatsAppService.SincronizarStatusSessao, EventoWAHAStatusSessao)
+	d.Assinar("mensagens", c.MessageService.PersistirEventoWAHA, EventoWAHAMensagem, EventoWAHAMensagemQualquer, EventoWAHAAck)
+	d.Assinar("tempo-real", c.RealtimeService.RepassarEventoWAHA,
+		EventoWAHAMensagem, EventoWAHAAck, EventoWAHAReacao, EventoWAHARevogada, EventoWAHAPresenca, EventoWAHAStatusSessao)
+
+	// Automações reagem apenas a message: message.any repete as recebidas
+	d.Assinar("respostas-rapidas", c.RespostaRapidaService.ProcessarEventoWAHA, EventoWAHAMensagem)
+	d.Assinar("fluxos", c.FluxoExecutionService.DispararPorMensagem, EventoWAHAMensagem)
+	d.Assinar("agentes-ia", c.AgenteIAService.ResponderEventoWAHA, EventoWAHAMensagem)
+	d.Assinar("webhooks", c.WebhookService.PublicarEventoWAHA, EventoWAHAMensagem)
+
+	// Entrega, leitura, resposta e descadastro (SAIR/STOP) dos destinatários de campanhas
+	d.Assinar("campanhas", c.Campanhas.AcompanharEventoWAHA, EventoWAHAMensagem, EventoWAHAAck)
+}
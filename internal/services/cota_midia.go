@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"tappyone/internal/models"
+)
+
+var ErrCotaMidiaExcedida = errors.New("cota de armazenamento de mídia da organização excedida")
+
+// sqlCategoriaMidia classifica midias.tipo_mime nas categorias de retenção
+const sqlCategoriaMidia = `CASE
+	WHEN midias.tipo_mime LIKE 'image/%' THEN 'IMAGEM'
+	WHEN midias.tipo_mime LIKE 'video/%' THEN 'VIDEO'
+	WHEN midias.tipo_mime LIKE 'audio/%' THEN 'AUDIO'
+	ELSE 'DOCUMENTO' END`
+
+// UsoCategoriaMidia total armazenado de uma categoria
+type UsoCategoriaMidia struct {
+	Categoria models.CategoriaMidia `json:"categoria"`
+	Midias    int64                 `json:"midias"`
+	Bytes     int64                 `json:"bytes"`
+}
+
+// ConsumidorMidia organização, conversa ou usuário com o espaço que ocupa
+type ConsumidorMidia struct {
+	ID        string `json:"id"`
+	Nome      string `json:"nome"`
+	Midias    int64  `json:"midias"`
+	Bytes     int64  `json:"bytes"`
+	CotaBytes *int64 `json:"cotaBytes,omitempty"` // apenas no relatório de organizações
+}
+
+// UsoMidiaOrganizacao espaço ocupado pela organização e seus maiores consumidores
+type UsoMidiaOrganizacao struct {
+	OrganizacaoID    string              `json:"organizacaoId"`
+	Midias           int64               `json:"midias"`
+	Bytes            int64               `json:"bytes"`
+	CotaBytes        int64               `json:"cotaBytes"` // 0 = ilimitada
+	PercentualUsado  *float64            `json:"percentualUsado"`
+	PorCategoria     []UsoCategoriaMidia `json:"porCategoria"`
+	MaioresConversas []ConsumidorMidia   `json:"maioresConversas"`
+	MaioresUsuarios  []ConsumidorMidia   `json:"maioresUsuarios"`
+	MaioresArquivos  []models.Midia      `json:"maioresArquivos"`
+}
+
+// CotaOrganizacao cota de mídia da organização em bytes; 0 é ilimitada
+func (s *MidiaService) CotaOrganizacao(organizacaoID string) (int64, error) {
+	var organizacao models.Organizacao
+	if err := s.db.Select("id", "cota_midia_bytes").Where("id = ?", organizacaoID).First(&organizacao).Error; err != nil {
+		return 0, fmt.Errorf("erro ao buscar cota da organização: %w", err)
+	}
+	if organizacao.CotaMidiaBytes != nil {
+		return *organizacao.CotaMidiaBytes, nil
+	}
+	return s.cotaPadrao, nil
+}
+
+// BytesArmazenados espaço ocupado pelas mídias da organização. O conteúdo
+// repetido entre organizações conta para cada uma delas.
+func (s *MidiaService) BytesArmazenados(organizacaoID string) (int64, error) {
+	var total int64
+	err := s.db.Model(&models.Midia{}).
+		Select("COALESCE(SUM(tamanho), 0)").
+		Where("organizacao_id = ?", organizacaoID).
+		Scan(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("erro ao somar mídias da organização: %w", err)
+	}
+	return total, nil
+}
+
+// verificarCota recusa o arquivo novo que faria a organização passar da cota
+func (s *MidiaService) verificarCota(organizacaoID string, tamanho int64) error {
+	cota, err := s.CotaOrganizacao(organizacaoID)
+	if err != nil || cota <= 0 {
+		return err
+	}
+	usado, err := s.BytesArmazenados(organizacaoID)
+	if err != nil {
+		return err
+	}
+	if usado+tamanho > cota {
+		return ErrCotaMidiaExcedida
+	}
+	return nil
+}
+
+// UsoOrganizacao totais da organização por categoria e os maiores consumidores
+func (s *MidiaService) UsoOrganizacao(organizacaoID string, limite int) (*UsoMidiaOrganizacao, error) {
+	if limite <= 0 || limite > 100 {
+		limite = 10
+	}
+
+	uso := &UsoMidiaOrganizacao{OrganizacaoID: organizacaoID}
+	cota, err := s.CotaOrganizacao(organizacaoID)
+	if err != nil {
+		return nil, err
+	}
+	uso.CotaBytes = cota
+
+	err = s.db.Model(&models.Midia{}).
+		Select("COUNT(*), COALESCE(SUM(tamanho), 0)").
+		Where("organizacao_id = ?", organizacaoID).
+		Row().Scan(&uso.Midias, &uso.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao somar mídias da organização: %w", err)
+	}
+	if cota > 0 {
+		percentual := float64(uso.Bytes) * 100 / float64(cota)
+		uso.PercentualUsado = &percentual
+	}
+
+	uso.PorCategoria = []UsoCategoriaMidia{}
+	err = s.db.Model(&models.Midia{}).
+		Select(sqlCategoriaMidia+" AS categoria, COUNT(*) AS midias, COALESCE(SUM(tamanho), 0) AS bytes").
+		Where("organizacao_id = ?", organizacaoID).
+		Group("categoria").
+		Order("bytes DESC").
+		Scan(&uso.PorCategoria).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao agrupar mídias por categoria: %w", err)
+	}
+
+	// Cada mídia conta uma vez por conversa, mesmo reenviada em várias mensagens
+	porConversa := s.db.Table("mensagens").
+		Select("DISTINCT mensagens.conversa_id, midias.id, midias.tamanho").
+		Joins("JOIN midias ON midias.id = mensagens.midia_id").
+		Where("midias.organizacao_id = ?", organizacaoID)
+	uso.MaioresConversas = []ConsumidorMidia{}
+	err = s.db.Table("(?) AS uso", porConversa).
+		Select("conversas.id, COALESCE(conversas.nome, conversas.id_conversa) AS nome, COUNT(*) AS midias, SUM(uso.tamanho) AS bytes").
+		Joins("JOIN conversas ON conversas.id = uso.conversa_id").
+		Group("conversas.id, conversas.nome, conversas.id_conversa").
+		Order("bytes DESC").
+		Limit(limite).
+		Scan(&uso.MaioresConversas).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao agrupar mídias por conversa: %w", err)
+	}
+
+	uso.MaioresUsuarios = []ConsumidorMidia{}
+	err = s.db.Model(&models.Midia{}).
+		Select("usuarios.id, usuarios.nome, COUNT(*) AS midias, SUM(midias.tamanho) AS bytes").
+		Joins("JOIN usuarios ON usuarios.id = midias.usuario_id").
+		Where("midias.organizacao_id = ?", organizacaoID).
+		Group("usuarios.id, usuarios.nome").
+		Order("bytes DESC").
+		Limit(limite).
+		Scan(&uso.MaioresUsuarios).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao agrupar mídias por usuário: %w", err)
+	}
+
+	uso.MaioresArquivos = []models.Midia{}
+	err = s.db.Where("organizacao_id = ?", organizacaoID).
+		Order("tamanho DESC").
+		Limit(limite).
+		Find(&uso.MaioresArquivos).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar maiores mídias: %w", err)
+	}
+
+	return uso, nil
+}
+
+// MaioresOrganizacoes relatório do operador: organizações que mais ocupam
+// o armazenamento de mídia
+func (s *MidiaService) MaioresOrganizacoes(limite int) ([]ConsumidorMidia, error) {
+	if limite <= 0 {
+		limite = 20
+	}
+
+	consumidores := []ConsumidorMidia{}
+	err := s.db.Model(&models.Midia{}).
+		Select("organizacoes.id, organizacoes.nome, organizacoes.cota_midia_bytes AS cota_bytes, COUNT(*) AS midias, SUM(midias.tamanho) AS bytes").
+		Joins("JOIN organizacoes ON organizacoes.id = midias.organizacao_id").
+		Group("organizacoes.id, organizacoes.nome, organizacoes.cota_midia_bytes").
+		Order("bytes DESC").
+		Limit(limite).
+		Scan(&consumidores).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao agrupar mídias por organização: %w", err)
+	}
+	for i := range consumidores {
+		if consumidores[i].CotaBytes == nil && s.cotaPadrao > 0 {
+			cota := s.cotaPadrao
+			consumidores[i].CotaBytes = &cota
+		}
+	}
+	return consumidores, nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"tappyone/internal/config"
+)
+
+var ErrEmailNaoConfigurado = errors.New("SMTP não configurado")
+
+// EmailService envia emails via SMTP. Porta 465 usa TLS implícito; as demais
+// usam STARTTLS quando o servidor oferece.
+type EmailService struct {
+	config *config.Config
+}
+
+func NewEmailService(config *config.Config) *EmailService {
+	return &EmailService{config: config}
+}
+
+// Configurado indica se há servidor SMTP e remetente definidos
+func (s *EmailService) Configurado() bool {
+	return s.config.SMTPHost != "" && s.remetente() != ""
+}
+
+func (s *EmailService) remetente() string {
+	if s.config.SMTPFrom != "" {
+		return s.config.SMTPFrom
+	}
+	return s.config.SMTPUser
+}
+
+// SendEmail envia um email em texto simples
+func (s *EmailService) SendEmail(to, subject, body string) error {
+	return s.enviar(to, subject, body, "text/plain")
+}
+
+// SendHTMLEmail envia um email em HTML
+func (s *EmailService) SendHTMLEmail(to, subject, html string) error {
+	return s.enviar(to, subject, html, "text/html")
+}
+
+func (s *EmailService) enviar(to, subject, body, contentType string) error {
+	if !s.Configurado() {
+		log.Printf("[EMAIL] SMTP não configurado, email para %s não enviado: %s", to, subject)
+		return ErrEmailNaoConfigurado
+	}
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("destinatário inválido")
+	}
+
+	from := s.remetente()
+	mensagem := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: " + contentType + "; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := s.enviarSMTP(from, to, []byte(mensagem)); err != nil {
+		log.Printf("[EMAIL] Erro ao enviar email para %s: %v", to, err)
+		return fmt.Errorf("erro ao enviar email: %w", err)
+	}
+
+	log.Printf("[EMAIL] Email enviado para %s: %s", to, subject)
+	return nil
+}
+
+func (s *EmailService) enviarSMTP(from, to string, mensagem []byte) error {
+	endereco := net.JoinHostPort(s.config.SMTPHost, fmt.Sprintf("%d", s.config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: s.config.SMTPHost}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	if s.config.SMTPPort == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", endereco, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", endereco)
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, s.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.config.SMTPPort != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.config.SMTPUser != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			auth := smtp.PlainAuth("", s.config.SMTPUser, s.config.SMTPPass, s.config.SMTPHost)
+			if err := client.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	envelopeFrom := from
+	if endereco, err := mail.ParseAddress(from); err == nil {
+		envelopeFrom = endereco.Address
+	}
+	if err := client.Mail(envelopeFrom); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mensagem); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
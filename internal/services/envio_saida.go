@@ -0,0 +1,589 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"tappyone/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// PrioridadeEnvio ordem de saída das mensagens na fila da sessão: enquanto
+// houver mensagem de atendente esperando, nenhuma automação sai antes dela
+type PrioridadeEnvio int
+
+const (
+	PrioridadeEnvioAtendente PrioridadeEnvio = iota // digitada no atendimento (padrão)
+	PrioridadeEnvioAutomacao                        // respostas rápidas, fluxos e agentes de IA
+	PrioridadeEnvioCampanha                         // disparos em massa
+	totalPrioridadesEnvio
+)
+
+func (p PrioridadeEnvio) String() string {
+	switch p {
+	case PrioridadeEnvioAtendente:
+		return "atendente"
+	case PrioridadeEnvioAutomacao:
+		return "automacao"
+	case PrioridadeEnvioCampanha:
+		return "campanha"
+	}
+	return fmt.Sprintf("prioridade_%d", int(p))
+}
+
+const (
+	envioBaldePrefixo   = "envio:balde:"
+	envioContatoPrefixo = "envio:contato:"
+
+	// Chat que já recebeu mensagem não conta de novo no limite de contatos novos
+	envioContatoConhecidoTTL = 24 * time.Hour
+
+	// Marcar como visto uma vez por conversa dentro deste intervalo
+	envioIntervaloVisto = time.Minute
+
+	// O despachante reavalia a fila pelo menos nesse intervalo para que uma
+	// mensagem de atendente que chegou durante a espera passe na frente
+	envioReavaliacaoMaxima = time.Second
+
+	// Espera máxima das automações (a resposta perde o sentido depois disso)
+	// e das campanhas (o destinatário volta a ficar pendente)
+	envioEsperaMaximaAutomacao = 5 * time.Minute
+	envioEsperaMaximaCampanha  = 15 * time.Minute
+
+	// Automações da sessão na fila além disso são descartadas na hora
+	envioFilaMaximaAutomacao = 200
+)
+
+// Tempo de "digitando..." antes de cada envio das automações (os mesmos das
+// respostas rápidas): texto 50ms por caractere entre 1s e 5s
+const (
+	digitacaoImagem  = 2 * time.Second
+	digitacaoAudio   = 3 * time.Second
+	digitacaoVideo   = 4 * time.Second
+	digitacaoArquivo = 2 * time.Second
+	digitacaoOutros  = time.Second // contato, localização, enquete, encaminhamento
+)
+
+func digitacaoTexto(texto string) time.Duration {
+	return time.Duration(max(min(len(texto)*50, 5000), 1000)) * time.Millisecond
+}
+
+// ErroFilaEnvio envio recusado porque a fila da sessão não libera a mensagem
+// dentro da espera máxima da prioridade (limite por minuto, hora ou contatos
+// novos) ou já tem automações demais esperando
+type ErroFilaEnvio struct {
+	Posicao int
+	Espera  time.Duration
+}
+
+func (e *ErroFilaEnvio) Error() string {
+	return fmt.Sprintf("limite de envio da sessão atingido: mensagem na posição %d da fila. Tente novamente em %s", e.Posicao, descreverEspera(e.Espera))
+}
+
+// limiteEnvio balde de fichas: capacidade mensagens a cada janela, repostas
+// continuamente (permite rajadas curtas sem passar da média)
+type limiteEnvio struct {
+	nome       string
+	capacidade int
+	janela     time.Duration
+}
+
+// intervalo tempo médio entre duas fichas do balde
+func (l limiteEnvio) intervalo() time.Duration {
+	return l.janela / time.Duration(l.capacidade)
+}
+
+// scriptBaldesEnvio confere e consome uma ficha de cada balde de forma
+// atômica: ou todos têm ficha e consomem, ou nenhum consome e o retorno é a
+// espera (ms) até o balde mais atrasado ter uma ficha.
+// KEYS: baldes; ARGV: agora (ms), consumir (0/1), pares capacidade e janela (ms)
+var scriptBaldesEnvio = redis.NewScript(`
+local agora = tonumber(ARGV[1])
+local consumir = ARGV[2] == '1'
+local espera = 0
+local fichas = {}
+for i, chave in ipairs(KEYS) do
+	local capacidade = tonumber(ARGV[i * 2 + 1])
+	local janela = tonumber(ARGV[i * 2 + 2])
+	local taxa = capacidade / janela
+	local estado = redis.call('HMGET', chave, 'fichas', 'ts')
+	local atual = tonumber(estado[1]) or capacidade
+	local ts = tonumber(estado[2]) or agora
+	atual = math.min(capacidade, atual + math.max(0, agora - ts) * taxa)
+	fichas[i] = atual
+	if atual < 1 then
+		espera = math.max(espera, math.ceil((1 - atual) / taxa))
+	end
+end
+if espera > 0 or not consumir then
+	return espera
+end
+for i, chave in ipairs(KEYS) do
+	redis.call('HSET', chave, 'fichas', tostring(fichas[i] - 1), 'ts', agora)
+	redis.call('PEXPIRE', chave, tonumber(ARGV[i * 2 + 2]))
+end
+return 0
+`)
+
+// baldeLocal estado de um balde quando o Redis não está disponível
+type baldeLocal struct {
+	fichas float64
+	ts     time.Time
+}
+
+// pedidoEnvio mensagem aguardando a vez na fila da sessão
+type pedidoEnvio struct {
+	chatID      string
+	prioridade  PrioridadeEnvio
+	contatoNovo bool
+	liberado    chan struct{}
+}
+
+// filaEnvioSessao mensagens da sessão por prioridade, em ordem de chegada
+type filaEnvioSessao struct {
+	pedidos     [totalPrioridadesEnvio][]*pedidoEnvio
+	despachando bool
+	liberadas   int64
+	descartadas [totalPrioridadesEnvio]int64
+}
+
+// posicao lugar do pedido na fila (1 = próximo a sair); 0 quando já saiu
+func (f *filaEnvioSessao) posicao(pedido *pedidoEnvio) int {
+	posicao := 0
+	for prioridade := PrioridadeEnvio(0); prioridade <= pedido.prioridade; prioridade++ {
+		for _, p := range f.pedidos[prioridade] {
+			posicao++
+			if p == pedido {
+				return posicao
+			}
+		}
+	}
+	return 0
+}
+
+func (f *filaEnvioSessao) remover(pedido *pedidoEnvio) bool {
+	pedidos := f.pedidos[pedido.prioridade]
+	for i, p := range pedidos {
+		if p == pedido {
+			f.pedidos[pedido.prioridade] = append(pedidos[:i], pedidos[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *filaEnvioSessao) total() int {
+	total := 0
+	for _, pedidos := range f.pedidos {
+		total += len(pedidos)
+	}
+	return total
+}
+
+// candidatos primeiro pedido da fila e, se ele depender do limite de contatos
+// novos, o primeiro que não depende: um contato novo barrado não segura as
+// respostas para as conversas em andamento
+func (f *filaEnvioSessao) candidatos() []*pedidoEnvio {
+	var candidatos []*pedidoEnvio
+	novo, conhecido := false, false
+	for _, pedidos := range f.pedidos {
+		for _, p := range pedidos {
+			if p.contatoNovo && !novo {
+				novo = true
+				candidatos = append(candidatos, p)
+			} else if !p.contatoNovo && !conhecido {
+				conhecido = true
+				candidatos = append(candidatos, p)
+			}
+			if conhecido {
+				return candidatos
+			}
+		}
+	}
+	return candidatos
+}
+
+// SituacaoFilaEnvio estado da fila de envio de uma sessão
+type SituacaoFilaEnvio struct {
+	Sessao         string           `json:"sessao"`
+	NaFila         map[string]int   `json:"naFila"` // por prioridade
+	Total          int              `json:"total"`
+	Liberadas      int64            `json:"liberadas"`   // desde que o servidor iniciou
+	Descartadas    map[string]int64 `json:"descartadas"` // por prioridade, desde que o servidor iniciou
+	EsperaSegundos float64          `json:"esperaSegundos"`
+	Limites        map[string]int   `json:"limites"`
+}
+
+// AgendadorEnvios fila de saída por sessão do WhatsApp compartilhada por todos
+// os envios (atendimento, respostas rápidas, fluxos, agentes de IA e
+// campanhas). Os baldes ficam no Redis para valer entre réplicas; a ordem de
+// prioridade é da fila local de cada réplica. Sem Redis, os baldes ficam em
+// memória.
+type AgendadorEnvios struct {
+	db                  *gorm.DB
+	redis               *redis.Client
+	limites             []limiteEnvio
+	limiteContatosNovos limiteEnvio
+	esperaMaxima        time.Duration
+
+	mutex   sync.Mutex
+	filas   map[string]*filaEnvioSessao
+	baldes  map[string]*baldeLocal
+	vistos  map[string]time.Time
+	contato map[string]time.Time // chats conhecidos quando não há Redis
+}
+
+func NewAgendadorEnvios(db *gorm.DB, redis *redis.Client, cfg *config.Config) *AgendadorEnvios {
+	a := &AgendadorEnvios{
+		db:           db,
+		redis:        redis,
+		esperaMaxima: time.Duration(cfg.OutboundMaxWaitSeconds) * time.Second,
+		filas:        make(map[string]*filaEnvioSessao),
+		baldes:       make(map[string]*baldeLocal),
+		vistos:       make(map[string]time.Time),
+		contato:      make(map[string]time.Time),
+	}
+	if cfg.OutboundMaxPerMinute > 0 {
+		a.limites = append(a.limites, limiteEnvio{nome: "minuto", capacidade: cfg.OutboundMaxPerMinute, janela: time.Minute})
+	}
+	if cfg.OutboundMaxPerHour > 0 {
+		a.limites = append(a.limites, limiteEnvio{nome: "hora", capacidade: cfg.OutboundMaxPerHour, janela: time.Hour})
+	}
+	if cfg.OutboundNewContactsPerHour > 0 {
+		a.limiteContatosNovos = limiteEnvio{nome: "contatos_novos", capacidade: cfg.OutboundNewContactsPerHour, janela: time.Hour}
+	}
+	if a.esperaMaxima <= 0 {
+		a.esperaMaxima = 30 * time.Second
+	}
+	return a
+}
+
+// Aguardar bloqueia até a mensagem poder sair pela sessão. Cada prioridade
+// espera no máximo o tempo de esperaPrioridade e, se a fila não andar, recebe
+// um ErroFilaEnvio com a posição. Automações além de envioFilaMaximaAutomacao
+// na fila da sessão são recusadas sem esperar.
+func (a *AgendadorEnvios) Aguardar(sessao, chatID string, prioridade PrioridadeEnvio) error {
+	if len(a.limites) == 0 && a.limiteContatosNovos.capacidade == 0 {
+		return nil
+	}
+
+	pedido := &pedidoEnvio{
+		chatID:      chatID,
+		prioridade:  prioridade,
+		contatoNovo: a.contatoNovo(sessao, chatID),
+		liberado:    make(chan struct{}),
+	}
+
+	a.mutex.Lock()
+	fila, ok := a.filas[sessao]
+	if !ok {
+		fila = &filaEnvioSessao{}
+		a.filas[sessao] = fila
+	}
+	if prioridade == PrioridadeEnvioAutomacao && len(fila.pedidos[prioridade]) >= envioFilaMaximaAutomacao {
+		posicao := fila.total() + 1
+		fila.descartadas[prioridade]++
+		a.mutex.Unlock()
+		log.Printf("[ENVIO] Sessão %s: mensagem (%s) para %s descartada, fila com %d automações", sessao, prioridade, chatID, envioFilaMaximaAutomacao)
+		return &ErroFilaEnvio{Posicao: posicao, Espera: a.estimarEspera(sessao, pedido, posicao)}
+	}
+	fila.pedidos[prioridade] = append(fila.pedidos[prioridade], pedido)
+	posicao := fila.posicao(pedido)
+	if !fila.despachando {
+		fila.despachando = true
+		go a.despachar(sessao, fila)
+	}
+	a.mutex.Unlock()
+
+	if posicao > 1 {
+		log.Printf("[ENVIO] Sessão %s: mensagem (%s) para %s na posição %d da fila", sessao, prioridade, chatID, posicao)
+	}
+
+	esperaMaxima := a.esperaPrioridade(prioridade)
+	// O atendente não fica esperando quando a estimativa já passa do limite
+	if prioridade == PrioridadeEnvioAtendente {
+		if espera := a.estimarEspera(sessao, pedido, posicao); espera > esperaMaxima {
+			return a.desistir(sessao, fila, pedido, espera)
+		}
+	}
+
+	timer := time.NewTimer(esperaMaxima)
+	defer timer.Stop()
+	select {
+	case <-pedido.liberado:
+		return nil
+	case <-timer.C:
+	}
+
+	a.mutex.Lock()
+	posicao = fila.posicao(pedido)
+	a.mutex.Unlock()
+	return a.desistir(sessao, fila, pedido, a.estimarEspera(sessao, pedido, posicao))
+}
+
+// esperaPrioridade tempo máximo que um envio da prioridade aguarda na fila
+func (a *AgendadorEnvios) esperaPrioridade(prioridade PrioridadeEnvio) time.Duration {
+	switch prioridade {
+	case PrioridadeEnvioAutomacao:
+		return envioEsperaMaximaAutomacao
+	case PrioridadeEnvioCampanha:
+		return envioEsperaMaximaCampanha
+	}
+	return a.esperaMaxima
+}
+
+// desistir tira o pedido da fila, conta o descarte e retorna o erro com a
+// posição; nil quando o pedido foi liberado nesse meio tempo
+func (a *AgendadorEnvios) desistir(sessao string, fila *filaEnvioSessao, pedido *pedidoEnvio, espera time.Duration) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	posicao := fila.posicao(pedido)
+	if !fila.remover(pedido) {
+		return nil
+	}
+	fila.descartadas[pedido.prioridade]++
+	log.Printf("[ENVIO] Sessão %s: mensagem (%s) para %s recusada na posição %d (espera estimada %v)", sessao, pedido.prioridade, pedido.chatID, posicao, espera)
+	return &ErroFilaEnvio{Posicao: posicao, Espera: espera}
+}
+
+// despachar libera os pedidos da sessão conforme os baldes têm fichas,
+// sempre pelo de maior prioridade, até a fila esvaziar
+func (a *AgendadorEnvios) despachar(sessao string, fila *filaEnvioSessao) {
+	for {
+		a.mutex.Lock()
+		candidatos := fila.candidatos()
+		if len(candidatos) == 0 {
+			fila.despachando = false
+			a.mutex.Unlock()
+			return
+		}
+		a.mutex.Unlock()
+
+		espera := time.Duration(0)
+		var liberado *pedidoEnvio
+		for _, pedido := range candidatos {
+			e := a.consumir(sessao, pedido.contatoNovo, true)
+			if e == 0 {
+				liberado = pedido
+				break
+			}
+			if espera == 0 || e < espera {
+				espera = e
+			}
+		}
+
+		if liberado == nil {
+			if espera > envioReavaliacaoMaxima {
+				espera = envioReavaliacaoMaxima
+			}
+			time.Sleep(espera)
+			continue
+		}
+
+		if liberado.contatoNovo {
+			a.marcarContatoConhecido(sessao, liberado.chatID)
+		}
+
+		a.mutex.Lock()
+		// Se o atendente desistiu enquanto a ficha era consumida, a ficha se perde
+		if fila.remover(liberado) {
+			fila.liberadas++
+			close(liberado.liberado)
+		}
+		a.mutex.Unlock()
+	}
+}
+
+// estimarEspera espera do balde mais atrasado somada ao intervalo médio dos
+// pedidos que estão na frente
+func (a *AgendadorEnvios) estimarEspera(sessao string, pedido *pedidoEnvio, posicao int) time.Duration {
+	espera := a.consumir(sessao, pedido.contatoNovo, false)
+	if posicao > 1 {
+		intervalo := time.Duration(0)
+		for _, limite := range a.limites {
+			if limite.intervalo() > intervalo {
+				intervalo = limite.intervalo()
+			}
+		}
+		espera += time.Duration(posicao-1) * intervalo
+	}
+	return espera
+}
+
+// consumir confere os baldes da sessão (e o de contatos novos, quando o chat
+// é novo). Retorna 0 quando há ficha em todos (consumidas se consumir) ou a
+// espera até a próxima ficha.
+func (a *AgendadorEnvios) consumir(sessao string, contatoNovo, consumir bool) time.Duration {
+	limites := a.limites
+	if contatoNovo && a.limiteContatosNovos.capacidade > 0 {
+		limites = append(append([]limiteEnvio{}, a.limites...), a.limiteContatosNovos)
+	}
+	if len(limites) == 0 {
+		return 0
+	}
+
+	agora := time.Now()
+	if a.redis != nil {
+		chaves := make([]string, len(limites))
+		args := []interface{}{agora.UnixMilli(), 0}
+		if consumir {
+			args[1] = 1
+		}
+		for i, limite := range limites {
+			chaves[i] = envioBaldePrefixo + sessao + ":" + limite.nome
+			args = append(args, limite.capacidade, limite.janela.Milliseconds())
+		}
+
+		espera, err := scriptBaldesEnvio.Run(context.Background(), a.redis, chaves, args...).Int64()
+		if err == nil {
+			return time.Duration(espera) * time.Millisecond
+		}
+		log.Printf("[ENVIO] Redis indisponível, usando limites locais: %v", err)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	espera := time.Duration(0)
+	fichas := make([]float64, len(limites))
+	for i, limite := range limites {
+		balde, ok := a.baldes[sessao+":"+limite.nome]
+		if !ok {
+			balde = &baldeLocal{fichas: float64(limite.capacidade), ts: agora}
+			a.baldes[sessao+":"+limite.nome] = balde
+		}
+		taxa := float64(limite.capacidade) / float64(limite.janela)
+		fichas[i] = math.Min(float64(limite.capacidade), balde.fichas+float64(agora.Sub(balde.ts))*taxa)
+		if fichas[i] < 1 {
+			if e := time.Duration(math.Ceil((1 - fichas[i]) / taxa)); e > espera {
+				espera = e
+			}
+		}
+	}
+	if espera > 0 || !consumir {
+		return espera
+	}
+	for i, limite := range limites {
+		balde := a.baldes[sessao+":"+limite.nome]
+		balde.fichas = fichas[i] - 1
+		balde.ts = agora
+	}
+	return 0
+}
+
+// contatoNovo indica se a mensagem inicia conversa com um chat individual que
+// nunca conversou com a sessão (conta no limite de contatos novos por hora)
+func (a *AgendadorEnvios) contatoNovo(sessao, chatID string) bool {
+	if a.limiteContatosNovos.capacidade == 0 || !strings.HasSuffix(chatID, "@c.us") {
+		return false
+	}
+	if a.contatoConhecido(sessao, chatID) {
+		return false
+	}
+
+	var existe bool
+	err := a.db.Raw(`SELECT EXISTS (
+		SELECT 1 FROM conversas c
+		JOIN sessoes_whatsapp s ON s.id = c.sessao_whatsapp_id
+		WHERE s.nome_sessao = ? AND c.id_conversa = ? AND c.deleted_at IS NULL
+	)`, sessao, chatID).Scan(&existe).Error
+	if err != nil {
+		log.Printf("[ENVIO] Erro ao verificar conversa de %s: %v", chatID, err)
+		return false
+	}
+	if existe {
+		a.marcarContatoConhecido(sessao, chatID)
+	}
+	return !existe
+}
+
+func (a *AgendadorEnvios) contatoConhecido(sessao, chatID string) bool {
+	chave := envioContatoPrefixo + sessao + ":" + chatID
+	if a.redis != nil {
+		if existe, err := a.redis.Exists(context.Background(), chave).Result(); err == nil {
+			return existe > 0
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	expiraEm, ok := a.contato[chave]
+	return ok && time.Now().Before(expiraEm)
+}
+
+func (a *AgendadorEnvios) marcarContatoConhecido(sessao, chatID string) {
+	chave := envioContatoPrefixo + sessao + ":" + chatID
+	if a.redis != nil {
+		if err := a.redis.Set(context.Background(), chave, "1", envioContatoConhecidoTTL).Err(); err == nil {
+			return
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	agora := time.Now()
+	for c, expiraEm := range a.contato {
+		if agora.After(expiraEm) {
+			delete(a.contato, c)
+		}
+	}
+	a.contato[chave] = agora.Add(envioContatoConhecidoTTL)
+}
+
+// marcarVisto indica se a conversa deve ser marcada como vista antes do
+// envio: uma vez por intervalo, não a cada ação de uma sequência
+func (a *AgendadorEnvios) marcarVisto(sessao, chatID string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	agora := time.Now()
+	chave := sessao + ":" + chatID
+	if ultimo, ok := a.vistos[chave]; ok && agora.Sub(ultimo) < envioIntervaloVisto {
+		return false
+	}
+	for c, ultimo := range a.vistos {
+		if agora.Sub(ultimo) >= envioIntervaloVisto {
+			delete(a.vistos, c)
+		}
+	}
+	a.vistos[chave] = agora
+	return true
+}
+
+// Situacao fila e limites da sessão para acompanhamento no painel
+func (a *AgendadorEnvios) Situacao(sessao string) SituacaoFilaEnvio {
+	situacao := SituacaoFilaEnvio{
+		Sessao:      sessao,
+		NaFila:      make(map[string]int),
+		Descartadas: make(map[string]int64),
+		Limites:     make(map[string]int),
+	}
+	for _, limite := range a.limites {
+		situacao.Limites[limite.nome] = limite.capacidade
+	}
+	if a.limiteContatosNovos.capacidade > 0 {
+		situacao.Limites[a.limiteContatosNovos.nome] = a.limiteContatosNovos.capacidade
+	}
+
+	a.mutex.Lock()
+	if fila, ok := a.filas[sessao]; ok {
+		for prioridade, pedidos := range fila.pedidos {
+			situacao.NaFila[PrioridadeEnvio(prioridade).String()] = len(pedidos)
+			situacao.Descartadas[PrioridadeEnvio(prioridade).String()] = fila.descartadas[prioridade]
+		}
+		situacao.Total = fila.total()
+		situacao.Liberadas = fila.liberadas
+	}
+	a.mutex.Unlock()
+
+	situacao.EsperaSegundos = a.consumir(sessao, false, false).Seconds()
+	return situacao
+}
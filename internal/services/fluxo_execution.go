@@ -14,6 +14,7 @@ type FluxoExecutionService struct {
 	DB              *gorm.DB
 	WhatsAppService *WhatsAppService
 	KanbanService   *KanbanService
+	auditoria       *AuditoriaService
 }
 
 // ExecutionContext carrega o contexto de execução do fluxo
@@ -42,6 +43,7 @@ func NewFluxoExecutionService(db *gorm.DB, whatsAppService *WhatsAppService, kan
 		DB:              db,
 		WhatsAppService: whatsAppService,
 		KanbanService:   kanbanService,
+		auditoria:       NewAuditoriaService(db),
 	}
 }
 
@@ -236,8 +238,16 @@ func (s *FluxoExecutionService) executeChatActionNode(context *ExecutionContext)
 	processedMessage := s.replaceVariables(message, context.Variables)
 
 	// Enviar mensagem via WhatsApp
-	sessionName := fmt.Sprintf("user_%s", context.UserID)
-	_, err := s.WhatsAppService.SendMessage(sessionName, *context.ChatID, processedMessage)
+	// Fluxos disparados por mensagem respondem pela sessão que a recebeu
+	sessaoGatilho, _ := context.Variables["sessao"].(string)
+	sessionName, err := s.WhatsAppService.NomeSessaoParaChat(context.UserID, *context.ChatID, sessaoGatilho)
+	if err != nil {
+		return &NodeExecutionResult{
+			Success: false,
+			Error:   stringPtr(fmt.Sprintf("Erro ao resolver sessão do WhatsApp: %v", err)),
+		}, nil
+	}
+	_, err = s.WhatsAppService.SendMessage(sessionName, *context.ChatID, processedMessage)
 	if err != nil {
 		return &NodeExecutionResult{
 			Success: false,
@@ -245,6 +255,13 @@ func (s *FluxoExecutionService) executeChatActionNode(context *ExecutionContext)
 		}, nil
 	}
 
+	ator := AtorAutomacao(models.AtorAuditoriaFluxo, context.FluxoID, context.UserID, "")
+	s.auditoria.Registrar(ator, models.AcaoAuditoriaEnviarMensagem, "mensagem", *context.ChatID, nil, map[string]interface{}{
+		"chatId":   *context.ChatID,
+		"nodeId":   context.CurrentNode.ID,
+		"mensagem": processedMessage,
+	})
+
 	nextNodeID, _ := s.findNextNodeID(context.FluxoID, context.CurrentNode.ID)
 	return &NodeExecutionResult{
 		Success:    true,
@@ -0,0 +1,543 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tappyone/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Mensagens por chamada ao WAHA (o WAHA limita a 100)
+	mensagensPorPaginaImportacao = 100
+
+	requisicoesPorMinutoImportacao       = 20
+	requisicoesPorMinutoMaximoImportacao = 120
+
+	// Tentativas de cada chamada ao WAHA antes de marcar a importação como falha
+	tentativasChamadaImportacao = 3
+)
+
+var (
+	ErrImportacaoEmAndamento  = errors.New("já existe uma importação em andamento para esta sessão")
+	ErrImportacaoNaoRetomavel = errors.New("apenas importações pausadas ou com falha podem ser retomadas")
+	ErrImportacaoNaoPausavel  = errors.New("apenas importações em andamento podem ser pausadas")
+	ErrSessaoNaoConectada     = errors.New("a sessão precisa estar conectada para importar o histórico")
+	errImportacaoInterrompida = errors.New("importação interrompida")
+)
+
+// Chats sem contato individual (grupos, canais e listas de transmissão)
+var tiposChatSemContatoWAHA = []string{"@g.us", "@newsletter", "@broadcast"}
+
+// OpcoesImportacao parâmetros informados ao iniciar a importação
+type OpcoesImportacao struct {
+	BaixarMidia          bool       `json:"baixarMidia"`
+	Desde                *time.Time `json:"desde"`
+	LimitePorChat        int        `json:"limitePorChat"`
+	RequisicoesPorMinuto int        `json:"requisicoesPorMinuto"`
+}
+
+// ChatWAHA chat listado pelo WAHA
+type ChatWAHA struct {
+	ID   string
+	Nome string
+}
+
+// ImportacaoHistoricoService importa o histórico de conversas das sessões a
+// partir do WAHA em background, no ritmo configurado, gravando o cursor a
+// cada página para poder retomar
+type ImportacaoHistoricoService struct {
+	db        *gorm.DB
+	whatsapp  *WhatsAppService
+	mensagens *MessageService
+	realtime  *RealtimeService
+	processar func(*EventoWAHA) error
+	mutex     sync.Mutex
+	execucoes map[string]chan struct{}
+}
+
+func NewImportacaoHistoricoService(db *gorm.DB, whatsapp *WhatsAppService, mensagens *MessageService, realtime *RealtimeService) *ImportacaoHistoricoService {
+	return &ImportacaoHistoricoService{
+		db:        db,
+		whatsapp:  whatsapp,
+		mensagens: mensagens,
+		realtime:  realtime,
+		execucoes: make(map[string]chan struct{}),
+	}
+}
+
+// DefinirProcessadorMidia define quem baixa e guarda a mídia das mensagens
+// importadas (o mesmo consumidor usado para as mensagens recebidas)
+func (s *ImportacaoHistoricoService) DefinirProcessadorMidia(processar func(*EventoWAHA) error) {
+	s.processar = processar
+}
+
+// Iniciar cria a importação da sessão e a executa em background
+func (s *ImportacaoHistoricoService) Iniciar(sessao *models.SessaoWhatsApp, usuarioID string, opcoes OpcoesImportacao) (*models.ImportacaoHistorico, error) {
+	if !sessao.Status.Conectada() {
+		return nil, ErrSessaoNaoConectada
+	}
+
+	var emAndamento int64
+	s.db.Model(&models.ImportacaoHistorico{}).
+		Where("sessao_whatsapp_id = ? AND status IN ?", sessao.ID,
+			[]models.StatusImportacao{models.StatusImportacaoPendente, models.StatusImportacaoEmAndamento}).
+		Count(&emAndamento)
+	if emAndamento > 0 {
+		return nil, ErrImportacaoEmAndamento
+	}
+
+	if opcoes.RequisicoesPorMinuto <= 0 {
+		opcoes.RequisicoesPorMinuto = requisicoesPorMinutoImportacao
+	}
+	if opcoes.RequisicoesPorMinuto > requisicoesPorMinutoMaximoImportacao {
+		opcoes.RequisicoesPorMinuto = requisicoesPorMinutoMaximoImportacao
+	}
+	if opcoes.LimitePorChat < 0 {
+		opcoes.LimitePorChat = 0
+	}
+
+	importacao := &models.ImportacaoHistorico{
+		SessaoWhatsAppID:     sessao.ID,
+		OrganizacaoID:        sessao.OrganizacaoID,
+		UsuarioID:            usuarioID,
+		Status:               models.StatusImportacaoPendente,
+		BaixarMidia:          opcoes.BaixarMidia,
+		Desde:                opcoes.Desde,
+		LimitePorChat:        opcoes.LimitePorChat,
+		RequisicoesPorMinuto: opcoes.RequisicoesPorMinuto,
+	}
+	if err := s.db.Create(importacao).Error; err != nil {
+		return nil, fmt.Errorf("erro ao criar importação: %w", err)
+	}
+
+	s.executar(importacao.ID)
+	return importacao, nil
+}
+
+// Pausar interrompe a importação; o cursor gravado permite retomá-la depois
+func (s *ImportacaoHistoricoService) Pausar(importacao *models.ImportacaoHistorico) error {
+	if importacao.Status != models.StatusImportacaoEmAndamento && importacao.Status != models.StatusImportacaoPendente {
+		return ErrImportacaoNaoPausavel
+	}
+
+	s.mutex.Lock()
+	stop, executando := s.execucoes[importacao.ID]
+	if executando {
+		close(stop)
+		delete(s.execucoes, importacao.ID)
+	}
+	s.mutex.Unlock()
+
+	if !executando {
+		// Execução perdida (reinício do servidor): apenas marca como pausada
+		return s.db.Model(importacao).Update("status", models.StatusImportacaoPausada).Error
+	}
+	return nil
+}
+
+// Retomar continua uma importação pausada ou com falha a partir do cursor
+func (s *ImportacaoHistoricoService) Retomar(importacao *models.ImportacaoHistorico) error {
+	if importacao.Status != models.StatusImportacaoPausada && importacao.Status != models.StatusImportacaoFalhou {
+		return ErrImportacaoNaoRetomavel
+	}
+
+	var emAndamento int64
+	s.db.Model(&models.ImportacaoHistorico{}).
+		Where("sessao_whatsapp_id = ? AND id <> ? AND status IN ?", importacao.SessaoWhatsAppID, importacao.ID,
+			[]models.StatusImportacao{models.StatusImportacaoPendente, models.StatusImportacaoEmAndamento}).
+		Count(&emAndamento)
+	if emAndamento > 0 {
+		return ErrImportacaoEmAndamento
+	}
+
+	err := s.db.Model(importacao).Updates(map[string]interface{}{
+		"status": models.StatusImportacaoPendente,
+		"erro":   nil,
+	}).Error
+	if err != nil {
+		return err
+	}
+	s.executar(importacao.ID)
+	return nil
+}
+
+// RetomarInterrompidas volta a executar as importações que estavam em
+// andamento quando o servidor parou
+func (s *ImportacaoHistoricoService) RetomarInterrompidas() {
+	var ids []string
+	err := s.db.Model(&models.ImportacaoHistorico{}).
+		Where("status IN ?", []models.StatusImportacao{models.StatusImportacaoPendente, models.StatusImportacaoEmAndamento}).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("[IMPORTACAO] Erro ao buscar importações interrompidas: %v", err)
+		return
+	}
+	for _, id := range ids {
+		log.Printf("[IMPORTACAO] Retomando importação %s", id)
+		s.executar(id)
+	}
+}
+
+func (s *ImportacaoHistoricoService) executar(id string) {
+	s.mutex.Lock()
+	if _, executando := s.execucoes[id]; executando {
+		s.mutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.execucoes[id] = stop
+	s.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			s.mutex.Lock()
+			if atual, ok := s.execucoes[id]; ok && atual == stop {
+				delete(s.execucoes, id)
+			}
+			s.mutex.Unlock()
+		}()
+		s.processarImportacao(id, stop)
+	}()
+}
+
+func (s *ImportacaoHistoricoService) processarImportacao(id string, stop chan struct{}) {
+	var importacao models.ImportacaoHistorico
+	if err := s.db.First(&importacao, "id = ?", id).Error; err != nil {
+		log.Printf("[IMPORTACAO] Erro ao carregar importação %s: %v", id, err)
+		return
+	}
+	var sessao models.SessaoWhatsApp
+	if err := s.db.First(&sessao, "id = ?", importacao.SessaoWhatsAppID).Error; err != nil {
+		s.finalizar(&importacao, models.StatusImportacaoFalhou, fmt.Errorf("sessão não encontrada: %w", err))
+		return
+	}
+
+	agora := time.Now()
+	importacao.Status = models.StatusImportacaoEmAndamento
+	if importacao.IniciadaEm == nil {
+		importacao.IniciadaEm = &agora
+	}
+	s.salvarProgresso(&importacao)
+	log.Printf("[IMPORTACAO] Importação %s da sessão %s iniciada", importacao.ID, sessao.NomeSessao)
+
+	err := s.importarChats(&importacao, &sessao, stop)
+	switch {
+	case errors.Is(err, errImportacaoInterrompida):
+		s.finalizar(&importacao, models.StatusImportacaoPausada, nil)
+	case err != nil:
+		s.finalizar(&importacao, models.StatusImportacaoFalhou, err)
+	default:
+		s.finalizar(&importacao, models.StatusImportacaoConcluida, nil)
+	}
+}
+
+func (s *ImportacaoHistoricoService) importarChats(importacao *models.ImportacaoHistorico, sessao *models.SessaoWhatsApp, stop chan struct{}) error {
+	intervalo := time.Minute / time.Duration(importacao.RequisicoesPorMinuto)
+
+	var chats []ChatWAHA
+	err := s.chamarWAHA(stop, intervalo, func() error {
+		var err error
+		chats, err = s.whatsapp.ListarChatsWAHA(sessao.NomeSessao)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	importacao.TotalChats = len(chats)
+	s.salvarProgresso(importacao)
+
+	for _, chat := range chats {
+		// Chats antes do cursor já foram concluídos
+		if importacao.ChatAtual != nil && chat.ID < *importacao.ChatAtual {
+			continue
+		}
+		if importacao.ChatAtual == nil || chat.ID != *importacao.ChatAtual {
+			chatID := chat.ID
+			importacao.ChatAtual = &chatID
+			importacao.OffsetMensagens = 0
+		}
+
+		if err := s.importarChat(importacao, sessao, chat, stop, intervalo); err != nil {
+			return err
+		}
+		importacao.ChatsConcluidos++
+		s.salvarProgresso(importacao)
+	}
+	return nil
+}
+
+func (s *ImportacaoHistoricoService) importarChat(importacao *models.ImportacaoHistorico, sessao *models.SessaoWhatsApp, chat ChatWAHA, stop chan struct{}, intervalo time.Duration) error {
+	if importacao.OffsetMensagens == 0 {
+		criado, err := s.garantirContato(sessao, chat)
+		if err != nil {
+			return fmt.Errorf("erro ao criar contato do chat %s: %w", chat.ID, err)
+		}
+		if criado {
+			importacao.ContatosCriados++
+		}
+	}
+
+	for {
+		limite := mensagensPorPaginaImportacao
+		if importacao.LimitePorChat > 0 {
+			restante := importacao.LimitePorChat - importacao.OffsetMensagens
+			if restante <= 0 {
+				return nil
+			}
+			if restante < limite {
+				limite = restante
+			}
+		}
+
+		var mensagens []MensagemWAHA
+		err := s.chamarWAHA(stop, intervalo, func() error {
+			var err error
+			mensagens, err = s.whatsapp.ListarMensagensWAHA(sessao.NomeSessao, chat.ID, limite, importacao.OffsetMensagens, importacao.BaixarMidia)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// O WAHA retorna da mais recente para a mais antiga
+		antigas := false
+		for i := range mensagens {
+			mensagem := &mensagens[i]
+			if importacao.Desde != nil && mensagem.Horario().Before(*importacao.Desde) {
+				antigas = true
+				continue
+			}
+
+			salva, err := s.mensagens.ImportarMensagemWAHA(sessao, mensagem)
+			if err != nil {
+				return err
+			}
+			if salva == nil {
+				continue
+			}
+			importacao.MensagensImportadas++
+
+			if importacao.BaixarMidia && s.midiaPendente(salva, mensagem) {
+				if err := s.baixarMidia(sessao, mensagem, stop, intervalo); err != nil {
+					if errors.Is(err, errImportacaoInterrompida) {
+						return err
+					}
+					log.Printf("[IMPORTACAO] Erro ao baixar mídia da mensagem %s: %v", mensagem.ID, err)
+				} else {
+					importacao.MidiasBaixadas++
+				}
+			}
+		}
+
+		importacao.OffsetMensagens += len(mensagens)
+		s.salvarProgresso(importacao)
+
+		if len(mensagens) < limite || antigas {
+			return nil
+		}
+	}
+}
+
+// midiaPendente mensagem com mídia ainda não guardada no armazenamento. A
+// mídia apagada pela retenção não é baixada de novo.
+func (s *ImportacaoHistoricoService) midiaPendente(salva *models.Mensagem, mensagem *MensagemWAHA) bool {
+	if s.processar == nil || !mensagem.HasMedia || mensagem.Media == nil || mensagem.Media.URL == "" {
+		return false
+	}
+	return salva.MidiaID == nil && salva.MidiaExpiradaEm == nil
+}
+
+func (s *ImportacaoHistoricoService) baixarMidia(sessao *models.SessaoWhatsApp, mensagem *MensagemWAHA, stop chan struct{}, intervalo time.Duration) error {
+	if !aguardarImportacao(stop, intervalo) {
+		return errImportacaoInterrompida
+	}
+	return s.processar(&EventoWAHA{
+		Tipo:           EventoWAHAMensagem,
+		Sessao:         sessao.NomeSessao,
+		Mensagem:       mensagem,
+		SessaoWhatsApp: sessao,
+		UsuarioID:      sessao.UsuarioID,
+		OrganizacaoID:  sessao.OrganizacaoID,
+	})
+}
+
+// garantirContato cria o contato do chat individual na organização quando
+// ainda não existe e o vincula à conversa já gravada
+func (s *ImportacaoHistoricoService) garantirContato(sessao *models.SessaoWhatsApp, chat ChatWAHA) (bool, error) {
+	if sessao.OrganizacaoID == "" {
+		return false, nil
+	}
+	for _, sufixo := range tiposChatSemContatoWAHA {
+		if strings.HasSuffix(chat.ID, sufixo) {
+			return false, nil
+		}
+	}
+
+	numero := strings.SplitN(chat.ID, "@", 2)[0]
+	criado := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var contato models.Contato
+		err := tx.Select("id").
+			Where("organizacao_id = ? AND (numero_telefone = ? OR contactid = ?)", sessao.OrganizacaoID, numero, chat.ID).
+			First(&contato).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			chatID := chat.ID
+			contato = models.Contato{
+				NumeroTelefone:   numero,
+				SessaoWhatsappID: sessao.ID,
+				OrganizacaoID:    sessao.OrganizacaoID,
+				ContactID:        &chatID,
+			}
+			if chat.Nome != "" {
+				nome := chat.Nome
+				contato.Nome = &nome
+			}
+			if err := tx.Create(&contato).Error; err != nil {
+				return err
+			}
+			criado = true
+		} else if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Conversa{}).
+			Where("id_conversa = ? AND sessao_whatsapp_id = ? AND contato_id IS NULL", chat.ID, sessao.ID).
+			Update("contato_id", contato.ID).Error
+	})
+	return criado, err
+}
+
+// chamarWAHA espera o intervalo do ritmo configurado e executa a chamada,
+// repetindo com espera crescente em caso de erro
+func (s *ImportacaoHistoricoService) chamarWAHA(stop chan struct{}, intervalo time.Duration, chamada func() error) error {
+	var err error
+	espera := intervalo
+	for tentativa := 1; tentativa <= tentativasChamadaImportacao; tentativa++ {
+		if !aguardarImportacao(stop, espera) {
+			return errImportacaoInterrompida
+		}
+		if err = chamada(); err == nil {
+			return nil
+		}
+		log.Printf("[IMPORTACAO] Erro na chamada ao WAHA (tentativa %d/%d): %v", tentativa, tentativasChamadaImportacao, err)
+		espera = intervalo * time.Duration(1<<tentativa) * 5
+	}
+	return err
+}
+
+// aguardarImportacao espera o intervalo; retorna false se a importação foi pausada
+func aguardarImportacao(stop chan struct{}, intervalo time.Duration) bool {
+	timer := time.NewTimer(intervalo)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+func (s *ImportacaoHistoricoService) salvarProgresso(importacao *models.ImportacaoHistorico) {
+	if err := s.db.Save(importacao).Error; err != nil {
+		log.Printf("[IMPORTACAO] Erro ao gravar progresso da importação %s: %v", importacao.ID, err)
+	}
+	s.publicarProgresso(importacao)
+}
+
+func (s *ImportacaoHistoricoService) finalizar(importacao *models.ImportacaoHistorico, status models.StatusImportacao, err error) {
+	importacao.Status = status
+	if err != nil {
+		mensagem := err.Error()
+		importacao.Erro = &mensagem
+		log.Printf("[IMPORTACAO] Importação %s falhou: %v", importacao.ID, err)
+	} else {
+		log.Printf("[IMPORTACAO] Importação %s %s: %d chats, %d mensagens", importacao.ID, strings.ToLower(string(status)),
+			importacao.ChatsConcluidos, importacao.MensagensImportadas)
+	}
+	if status == models.StatusImportacaoConcluida {
+		agora := time.Now()
+		importacao.FinalizadaEm = &agora
+	}
+	s.salvarProgresso(importacao)
+}
+
+// publicarProgresso envia o estado da importação ao websocket de quem a iniciou
+func (s *ImportacaoHistoricoService) publicarProgresso(importacao *models.ImportacaoHistorico) {
+	if s.realtime == nil || importacao.UsuarioID == "" {
+		return
+	}
+	percentual := 0.0
+	if importacao.TotalChats > 0 {
+		percentual = float64(importacao.ChatsConcluidos) * 100 / float64(importacao.TotalChats)
+	}
+	s.realtime.PublishToUser(importacao.UsuarioID, "backfill_progress", map[string]interface{}{
+		"importacao": importacao,
+		"percentual": percentual,
+	})
+}
+
+// ListarChatsWAHA chats da sessão no WAHA ordenados por id, ordem estável
+// usada pelo cursor da importação
+func (s *WhatsAppService) ListarChatsWAHA(sessionName string) ([]ChatWAHA, error) {
+	resultado, err := s.GetChats(sessionName)
+	if err != nil {
+		return nil, err
+	}
+	lista, ok := resultado.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resposta inesperada do WAHA ao listar chats")
+	}
+
+	chats := make([]ChatWAHA, 0, len(lista))
+	for _, item := range lista {
+		dados, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		chat := ChatWAHA{ID: chatIDWAHA(dados["id"])}
+		if chat.ID == "" || chat.ID == "status@broadcast" {
+			continue
+		}
+		chat.Nome, _ = dados["name"].(string)
+		chats = append(chats, chat)
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ID < chats[j].ID })
+	return chats, nil
+}
+
+// ListarMensagensWAHA página de mensagens do chat no WAHA, da mais recente
+// para a mais antiga, já no formato dos eventos de mensagem
+func (s *WhatsAppService) ListarMensagensWAHA(sessionName, chatID string, limit, offset int, baixarMidia bool) ([]MensagemWAHA, error) {
+	endpoint := fmt.Sprintf("/messages?chatId=%s&session=%s&limit=%d&offset=%d&downloadMedia=%t",
+		url.QueryEscape(chatID), url.QueryEscape(sessionName), limit, offset, baixarMidia)
+
+	resp, err := s.makeWAHARequest("GET", endpoint, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var mensagens []MensagemWAHA
+	if err := json.NewDecoder(resp.Body).Decode(&mensagens); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar mensagens do chat %s: %w", chatID, err)
+	}
+	return mensagens, nil
+}
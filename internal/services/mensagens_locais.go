@@ -0,0 +1,208 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+const (
+	limitePadraoMensagens = 50
+	limiteMaximoMensagens = 200
+
+	// Configuração de idioma da busca textual (stemming em português)
+	configuracaoBusca = "portuguese"
+)
+
+// ErrCursorInvalido cursor de paginação mal formado
+var ErrCursorInvalido = errors.New("cursor de paginação inválido")
+
+// PaginaMensagens página do histórico de um chat, da mais recente para a mais antiga
+type PaginaMensagens struct {
+	Mensagens     []models.Mensagem `json:"mensagens"`
+	ProximoCursor string            `json:"proximoCursor,omitempty"` // mensagens mais antigas que a última da página
+	TemMais       bool              `json:"temMais"`
+}
+
+// FiltroBuscaMensagens filtros da busca textual nas mensagens gravadas
+type FiltroBuscaMensagens struct {
+	Termo     string
+	ChatID    string
+	Sessao    string // id ou nome da sessão
+	Remetente string // "eu" para as enviadas, ou o número/JID de quem enviou
+	Tipo      string
+	TagID     string
+	Desde     *time.Time
+	Ate       *time.Time
+	Limit     int
+	Offset    int
+}
+
+// ResultadoBuscaMensagem mensagem encontrada com o trecho destacado
+type ResultadoBuscaMensagem struct {
+	ID               string              `json:"id"`
+	IDMensagem       string              `json:"idMensagem"`
+	ConversaID       string              `json:"conversaId"`
+	ChatID           string              `json:"chatId"`
+	NomeConversa     *string             `json:"nomeConversa"`
+	SessaoWhatsAppID string              `gorm:"column:sessao_whatsapp_id" json:"sessaoWhatsappId"`
+	NomeSessao       string              `json:"nomeSessao"`
+	DeMim            bool                `json:"deMim"`
+	Remetente        *string             `json:"remetente"`
+	Tipo             models.TipoMensagem `json:"tipo"`
+	Timestamp        time.Time           `json:"timestamp"`
+	Trecho           string              `json:"trecho"` // termos encontrados entre <mark></mark>
+	Relevancia       float64             `json:"relevancia"`
+}
+
+// ListarMensagensChat histórico do chat na sessão gravado no banco, paginado
+// por cursor (timestamp e id da última mensagem da página anterior)
+func (s *MessageService) ListarMensagensChat(nomeSessao, chatID, cursor string, limite int) (*PaginaMensagens, error) {
+	if limite <= 0 {
+		limite = limitePadraoMensagens
+	}
+	if limite > limiteMaximoMensagens {
+		limite = limiteMaximoMensagens
+	}
+
+	query := s.db.Model(&models.Mensagem{}).
+		Joins("JOIN conversas ON conversas.id = mensagens.conversa_id").
+		Joins("JOIN sessoes_whatsapp ON sessoes_whatsapp.id = conversas.sessao_whatsapp_id").
+		Where("conversas.id_conversa = ? AND sessoes_whatsapp.nome_sessao = ?", chatID, nomeSessao)
+
+	if cursor != "" {
+		horario, id, err := decodificarCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(mensagens.timestamp, mensagens.id) < (?, ?)", horario, id)
+	}
+
+	var mensagens []models.Mensagem
+	err := query.Preload("RespostaPara").Preload("Midia").
+		Order("mensagens.timestamp DESC, mensagens.id DESC").
+		Limit(limite + 1).
+		Find(&mensagens).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar mensagens do chat %s: %w", chatID, err)
+	}
+
+	pagina := &PaginaMensagens{Mensagens: mensagens}
+	if len(mensagens) > limite {
+		pagina.Mensagens = mensagens[:limite]
+		pagina.TemMais = true
+		ultima := pagina.Mensagens[limite-1]
+		pagina.ProximoCursor = codificarCursor(ultima.Timestamp, ultima.ID)
+	}
+	return pagina, nil
+}
+
+// BuscarMensagens busca textual (português) nas mensagens das sessões e
+// chats que o usuário pode acessar, da mais relevante para a menos relevante
+func (s *MessageService) BuscarMensagens(escopo *EscopoAtendimento, filtro FiltroBuscaMensagens) ([]ResultadoBuscaMensagem, int64, error) {
+	if strings.TrimSpace(filtro.Termo) == "" {
+		return nil, 0, fmt.Errorf("termo de busca não informado")
+	}
+	if filtro.Limit <= 0 {
+		filtro.Limit = limitePadraoMensagens
+	}
+	if filtro.Limit > limiteMaximoMensagens {
+		filtro.Limit = limiteMaximoMensagens
+	}
+	if filtro.Offset < 0 {
+		filtro.Offset = 0
+	}
+
+	consulta := "websearch_to_tsquery('" + configuracaoBusca + "', ?)"
+	query := s.db.Table("mensagens").
+		Joins("JOIN conversas ON conversas.id = mensagens.conversa_id").
+		Joins("JOIN sessoes_whatsapp ON sessoes_whatsapp.id = conversas.sessao_whatsapp_id").
+		Where("mensagens.busca @@ "+consulta, filtro.Termo).
+		Where("sessoes_whatsapp.organizacao_id = ?", escopo.OrganizacaoID).
+		Scopes(repositories.SessoesPermitidas(escopo.UsuarioID))
+
+	// Atendentes buscam apenas nos chats dos contatos das suas filas
+	if !escopo.Irrestrito {
+		condicao, args := escopo.CondicaoContatos("c")
+		query = query.Where("conversas.contato_id IN (SELECT c.id FROM contatos c WHERE "+condicao+")", args...)
+	}
+
+	if filtro.ChatID != "" {
+		query = query.Where("conversas.id_conversa = ?", filtro.ChatID)
+	}
+	if filtro.Sessao != "" {
+		query = query.Where("sessoes_whatsapp.id::text = ? OR sessoes_whatsapp.nome_sessao = ?", filtro.Sessao, filtro.Sessao)
+	}
+	switch filtro.Remetente {
+	case "":
+	case "eu":
+		query = query.Where("mensagens.de_mim = ?", true)
+	default:
+		remetente := filtro.Remetente
+		if !strings.Contains(remetente, "@") {
+			remetente += "@%"
+		}
+		query = query.Where("mensagens.remetente LIKE ?", remetente)
+	}
+	if filtro.Tipo != "" {
+		query = query.Where("mensagens.tipo = ?", filtro.Tipo)
+	}
+	if filtro.TagID != "" {
+		query = query.Where("conversas.contato_id IN (SELECT contato_id FROM contato_tags WHERE tag_id = ?)", filtro.TagID)
+	}
+	if filtro.Desde != nil {
+		query = query.Where("mensagens.timestamp >= ?", *filtro.Desde)
+	}
+	if filtro.Ate != nil {
+		query = query.Where("mensagens.timestamp <= ?", *filtro.Ate)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("erro ao contar mensagens: %w", err)
+	}
+
+	var resultados []ResultadoBuscaMensagem
+	err := query.Select(`mensagens.id, mensagens.id_mensagem, mensagens.conversa_id,
+			conversas.id_conversa AS chat_id, conversas.nome AS nome_conversa,
+			sessoes_whatsapp.id AS sessao_whatsapp_id, sessoes_whatsapp.nome_sessao,
+			mensagens.de_mim, mensagens.remetente, mensagens.tipo, mensagens.timestamp,
+			ts_headline('`+configuracaoBusca+`', concat_ws(' ', mensagens.conteudo, mensagens.legenda, mensagens.transcricao), `+consulta+`,
+				'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2') AS trecho,
+			ts_rank(mensagens.busca, `+consulta+`) AS relevancia`, filtro.Termo, filtro.Termo).
+		Order("relevancia DESC, mensagens.timestamp DESC").
+		Limit(filtro.Limit).
+		Offset(filtro.Offset).
+		Scan(&resultados).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("erro ao buscar mensagens: %w", err)
+	}
+	return resultados, total, nil
+}
+
+func codificarCursor(horario time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(horario.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodificarCursor(cursor string) (time.Time, string, error) {
+	dados, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrCursorInvalido
+	}
+	partes := strings.SplitN(string(dados), "|", 2)
+	if len(partes) != 2 || partes[1] == "" {
+		return time.Time{}, "", ErrCursorInvalido
+	}
+	horario, err := time.Parse(time.RFC3339Nano, partes[0])
+	if err != nil {
+		return time.Time{}, "", ErrCursorInvalido
+	}
+	return horario, partes[1], nil
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+
+	"github.com/gabriel-vasile/mimetype"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMidiaNaoEncontrada      = errors.New("mídia não encontrada")
+	ErrAssinaturaMidiaInvalida = errors.New("assinatura da URL de mídia inválida")
+	ErrURLMidiaExpirada        = errors.New("URL de mídia expirada")
+)
+
+// MidiaService guarda as mídias no MediaStorage com deduplicação por SHA-256
+// e gera as URLs assinadas pelas quais elas são servidas
+type MidiaService struct {
+	db            *gorm.DB
+	armazenamento MediaStorage
+	chave         []byte
+	baseURL       string
+	validade      time.Duration
+	processamento *ProcessamentoMidiaService
+	cotaPadrao    int64
+}
+
+func NewMidiaService(db *gorm.DB, armazenamento MediaStorage, cfg *config.Config) *MidiaService {
+	base := cfg.MediaSigningKey
+	if base == "" {
+		base = "midia:" + cfg.JWTSecret
+	}
+	chave := sha256.Sum256([]byte(base))
+
+	return &MidiaService{
+		db:            db,
+		armazenamento: armazenamento,
+		chave:         chave[:],
+		baseURL:       cfg.PublicBaseURL,
+		validade:      config.ParseDuration(cfg.MediaURLExpiresIn, time.Hour),
+		cotaPadrao:    cfg.MediaQuotaBytes,
+	}
+}
+
+// DefinirProcessamento liga a fila que gera miniaturas, conversões e
+// metadados das mídias novas
+func (s *MidiaService) DefinirProcessamento(processamento *ProcessamentoMidiaService) {
+	s.processamento = processamento
+}
+
+// Armazenar guarda o conteúdo na organização. O tipo é detectado pelos bytes
+// do arquivo; o nome original serve apenas para exibição e download. Uploads
+// que passariam da cota da organização retornam ErrCotaMidiaExcedida; mídias
+// recebidas pelo WhatsApp são sempre guardadas.
+func (s *MidiaService) Armazenar(organizacaoID, usuarioID, nomeOriginal string, dados []byte, origem models.OrigemMidia) (*models.Midia, error) {
+	if organizacaoID == "" {
+		return nil, fmt.Errorf("organização da mídia não informada")
+	}
+	if len(dados) == 0 {
+		return nil, fmt.Errorf("arquivo de mídia vazio")
+	}
+
+	soma := sha256.Sum256(dados)
+	hash := hex.EncodeToString(soma[:])
+
+	var existente models.Midia
+	err := s.db.Where("organizacao_id = ? AND sha256 = ?", organizacaoID, hash).First(&existente).Error
+	if err == nil {
+		s.registrarUso(&existente)
+		return &existente, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("erro ao buscar mídia: %w", err)
+	}
+
+	if origem == models.OrigemMidiaUpload {
+		if err := s.verificarCota(organizacaoID, int64(len(dados))); err != nil {
+			return nil, err
+		}
+	}
+
+	tipo := mimetype.Detect(dados)
+	chave := "midias/" + hash[:2] + "/" + hash + tipo.Extension()
+
+	// Outra organização pode já ter enviado o mesmo conteúdo
+	ctx := context.Background()
+	existe, err := s.armazenamento.Existe(ctx, chave)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar armazenamento de mídia: %w", err)
+	}
+	if !existe {
+		if err := s.armazenamento.Salvar(ctx, chave, dados, tipo.String()); err != nil {
+			return nil, fmt.Errorf("erro ao gravar mídia: %w", err)
+		}
+	}
+
+	midia := models.Midia{
+		OrganizacaoID: organizacaoID,
+		SHA256:        hash,
+		Chave:         chave,
+		Armazenamento: s.armazenamento.Nome(),
+		TipoMime:      tipo.String(),
+		Tamanho:       int64(len(dados)),
+		NomeOriginal:  nomeArquivoMidia(nomeOriginal, hash, tipo.Extension()),
+		Origem:        origem,
+		UltimoUsoEm:   time.Now(),
+	}
+	if usuarioID != "" {
+		midia.UsuarioID = &usuarioID
+	}
+
+	// Uploads simultâneos do mesmo arquivo: o segundo reaproveita o registro do primeiro
+	resultado := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&midia)
+	if resultado.Error != nil {
+		return nil, fmt.Errorf("erro ao registrar mídia: %w", resultado.Error)
+	}
+	if resultado.RowsAffected == 0 {
+		if err := s.db.Where("organizacao_id = ? AND sha256 = ?", organizacaoID, hash).First(&existente).Error; err != nil {
+			return nil, fmt.Errorf("erro ao buscar mídia: %w", err)
+		}
+		s.registrarUso(&existente)
+		return &existente, nil
+	}
+
+	if s.processamento != nil {
+		s.processamento.acordar()
+	}
+	return &midia, nil
+}
+
+// registrarUso adia a expiração por retenção da mídia reaproveitada
+func (s *MidiaService) registrarUso(midia *models.Midia) {
+	agora := time.Now()
+	if err := s.db.Model(midia).UpdateColumn("ultimo_uso_em", agora).Error; err != nil {
+		log.Printf("[MIDIA] Erro ao registrar uso da mídia %s: %v", midia.ID, err)
+		return
+	}
+	midia.UltimoUsoEm = agora
+}
+
+// Buscar mídia da organização; sem organização busca apenas pelo id (rota assinada)
+func (s *MidiaService) Buscar(organizacaoID, id string) (*models.Midia, error) {
+	query := s.db.Where("id = ?", id)
+	if organizacaoID != "" {
+		query = query.Where("organizacao_id = ?", organizacaoID)
+	}
+
+	var midia models.Midia
+	if err := query.First(&midia).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMidiaNaoEncontrada
+		}
+		return nil, fmt.Errorf("erro ao buscar mídia: %w", err)
+	}
+	return &midia, nil
+}
+
+// Abrir conteúdo original da mídia no armazenamento
+func (s *MidiaService) Abrir(midia *models.Midia) (io.ReadCloser, error) {
+	return s.abrirChave(midia.Chave)
+}
+
+// Ler conteúdo original da mídia
+func (s *MidiaService) Ler(midia *models.Midia) ([]byte, error) {
+	leitor, err := s.Abrir(midia)
+	if err != nil {
+		return nil, err
+	}
+	defer leitor.Close()
+	return io.ReadAll(leitor)
+}
+
+// AbrirVariante conteúdo da variante ("" é o original) com o tipo e o nome do arquivo
+func (s *MidiaService) AbrirVariante(midia *models.Midia, variante string) (io.ReadCloser, string, string, error) {
+	base := strings.TrimSuffix(midia.NomeOriginal, filepath.Ext(midia.NomeOriginal))
+	switch variante {
+	case "":
+		leitor, err := s.Abrir(midia)
+		return leitor, midia.TipoMime, midia.NomeOriginal, err
+	case models.VarianteMidiaMiniatura:
+		if midia.ChaveMiniatura == nil {
+			return nil, "", "", ErrMidiaNaoEncontrada
+		}
+		leitor, err := s.abrirChave(*midia.ChaveMiniatura)
+		return leitor, "image/jpeg", base + "-miniatura.jpg", err
+	case models.VarianteMidiaAudioPTT:
+		if midia.ChaveAudioPTT == nil {
+			return nil, "", "", ErrMidiaNaoEncontrada
+		}
+		leitor, err := s.abrirChave(*midia.ChaveAudioPTT)
+		return leitor, tipoAudioPTT, base + ".ogg", err
+	default:
+		return nil, "", "", ErrMidiaNaoEncontrada
+	}
+}
+
+// gravarDerivado guarda um objeto gerado a partir da mídia (miniatura, áudio convertido)
+func (s *MidiaService) gravarDerivado(chave string, dados []byte, tipoMime string) error {
+	return s.armazenamento.Salvar(context.Background(), chave, dados, tipoMime)
+}
+
+func (s *MidiaService) abrirChave(chave string) (io.ReadCloser, error) {
+	leitor, err := s.armazenamento.Abrir(context.Background(), chave)
+	if errors.Is(err, ErrObjetoNaoEncontrado) {
+		return nil, ErrMidiaNaoEncontrada
+	}
+	return leitor, err
+}
+
+// Remover apaga a mídia da organização e desvincula as mensagens que a usam.
+// O objeto só é removido do armazenamento quando nenhuma outra organização
+// tem o mesmo conteúdo.
+func (s *MidiaService) Remover(midia *models.Midia) error {
+	return s.remover(midia, false)
+}
+
+// Expirar remove a mídia pela política de retenção, marcando nas mensagens
+// que o arquivo expirou
+func (s *MidiaService) Expirar(midia *models.Midia) error {
+	return s.remover(midia, true)
+}
+
+func (s *MidiaService) remover(midia *models.Midia, expirada bool) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		campos := map[string]interface{}{"midia_id": nil, "url_midia": nil}
+		if expirada {
+			campos["midia_expirada_em"] = time.Now()
+		}
+		err := tx.Model(&models.Mensagem{}).
+			Where("midia_id = ?", midia.ID).
+			Updates(campos).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("midia_id = ?", midia.ID).Delete(&models.VinculoMidia{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(midia).Error
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao remover mídia: %w", err)
+	}
+
+	var restantes int64
+	if err := s.db.Model(&models.Midia{}).Where("chave = ?", midia.Chave).Count(&restantes).Error; err != nil {
+		return fmt.Errorf("erro ao verificar referências da mídia: %w", err)
+	}
+	if restantes == 0 {
+		chaves := []string{midia.Chave}
+		if midia.ChaveMiniatura != nil {
+			chaves = append(chaves, *midia.ChaveMiniatura)
+		}
+		if midia.ChaveAudioPTT != nil {
+			chaves = append(chaves, *midia.ChaveAudioPTT)
+		}
+		for _, chave := range chaves {
+			if err := s.armazenamento.Remover(context.Background(), chave); err != nil {
+				log.Printf("[MIDIA] Erro ao remover objeto %s do armazenamento: %v", chave, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CaminhoMidia referência estável gravada em mensagens.url_midia; a URL
+// assinada é gerada a cada leitura
+func CaminhoMidia(id string) string {
+	return "/api/media/" + id + "/conteudo"
+}
+
+// URLAssinada URL pública da mídia válida pelo tempo informado (0 usa o padrão)
+func (s *MidiaService) URLAssinada(id string, validade time.Duration) string {
+	return s.URLAssinadaVariante(id, "", validade)
+}
+
+// URLAssinadaVariante URL pública de uma variante gerada pelo processamento
+func (s *MidiaService) URLAssinadaVariante(id, variante string, validade time.Duration) string {
+	if validade <= 0 {
+		validade = s.validade
+	}
+	expira := strconv.FormatInt(time.Now().Add(validade).Unix(), 10)
+
+	query := url.Values{}
+	if variante != "" {
+		query.Set("variante", variante)
+	}
+	query.Set("expira", expira)
+	query.Set("assinatura", s.assinatura(id, variante, expira))
+	return s.baseURL + CaminhoMidia(id) + "?" + query.Encode()
+}
+
+// ValidarAssinatura confere a assinatura e a validade de uma URL gerada por URLAssinadaVariante
+func (s *MidiaService) ValidarAssinatura(id, variante, expira, assinatura string) error {
+	segundos, err := strconv.ParseInt(expira, 10, 64)
+	if err != nil || assinatura == "" {
+		return ErrAssinaturaMidiaInvalida
+	}
+	if !hmac.Equal([]byte(assinatura), []byte(s.assinatura(id, variante, expira))) {
+		return ErrAssinaturaMidiaInvalida
+	}
+	if time.Now().Unix() > segundos {
+		return ErrURLMidiaExpirada
+	}
+	return nil
+}
+
+// AssinarMidia preenche as URLs assinadas das variantes já geradas
+func (s *MidiaService) AssinarMidia(midia *models.Midia) {
+	if midia.ChaveMiniatura != nil {
+		midia.URLMiniatura = s.URLAssinadaVariante(midia.ID, models.VarianteMidiaMiniatura, 0)
+	}
+	if midia.ChaveAudioPTT != nil {
+		midia.URLAudioPTT = s.URLAssinadaVariante(midia.ID, models.VarianteMidiaAudioPTT, 0)
+	}
+}
+
+// AssinarMidias preenche as URLs assinadas das variantes de cada mídia
+func (s *MidiaService) AssinarMidias(midias []models.Midia) {
+	for i := range midias {
+		s.AssinarMidia(&midias[i])
+	}
+}
+
+// AssinarMensagens troca a referência das mídias armazenadas por URLs assinadas
+func (s *MidiaService) AssinarMensagens(mensagens []models.Mensagem) {
+	for i := range mensagens {
+		s.assinarMensagem(&mensagens[i])
+	}
+}
+
+func (s *MidiaService) assinarMensagem(mensagem *models.Mensagem) {
+	if mensagem.MidiaID != nil {
+		endereco := s.URLAssinada(*mensagem.MidiaID, 0)
+		mensagem.UrlMidia = &endereco
+	}
+	if mensagem.Midia != nil {
+		s.AssinarMidia(mensagem.Midia)
+	}
+	if mensagem.RespostaPara != nil {
+		s.assinarMensagem(mensagem.RespostaPara)
+	}
+}
+
+func (s *MidiaService) assinatura(id, variante, expira string) string {
+	mac := hmac.New(sha256.New, s.chave)
+	mac.Write([]byte(id + "|" + variante + "|" + expira))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// nomeArquivoMidia nome exibido no download; sem nome usa o hash com a extensão detectada
+func nomeArquivoMidia(nome, hash, extensao string) string {
+	nome = strings.TrimSpace(filepath.Base(strings.ReplaceAll(nome, "\\", "/")))
+	if nome == "" || nome == "." || nome == "/" {
+		return hash[:16] + extensao
+	}
+	return nome
+}
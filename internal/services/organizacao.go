@@ -0,0 +1,400 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrConviteInvalido     = errors.New("convite inválido ou expirado")
+	ErrEmailEmUso          = errors.New("email já está em uso")
+	ErrOrganizacaoInvalida = errors.New("organização não encontrada")
+)
+
+const conviteOrganizacaoTTL = 7 * 24 * time.Hour
+
+var slugInvalido = regexp.MustCompile(`[^a-z0-9]+`)
+
+// OrganizacaoService gerencia organizações e convites de entrada
+type OrganizacaoService struct {
+	db           *gorm.DB
+	config       *config.Config
+	emailService *EmailService
+	authService  *AuthService
+	organizacoes *repositories.OrganizacaoRepository
+}
+
+func NewOrganizacaoService(db *gorm.DB, cfg *config.Config, emailService *EmailService, authService *AuthService) *OrganizacaoService {
+	return &OrganizacaoService{
+		db:           db,
+		config:       cfg,
+		emailService: emailService,
+		authService:  authService,
+		organizacoes: repositories.NewOrganizacaoRepository(db),
+	}
+}
+
+// NovaOrganizacaoRequest dados para criar uma organização com seu primeiro administrador
+type NovaOrganizacaoRequest struct {
+	Nome      string `json:"nome" binding:"required"`
+	AdminNome string `json:"adminNome" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Senha     string `json:"senha" binding:"required"`
+}
+
+// AceitarConviteRequest dados do usuário que entra na organização pelo convite
+type AceitarConviteRequest struct {
+	Token    string  `json:"token" binding:"required"`
+	Nome     string  `json:"nome" binding:"required"`
+	Senha    string  `json:"senha" binding:"required"`
+	Telefone *string `json:"telefone"`
+}
+
+// Obter retorna a organização
+func (s *OrganizacaoService) Obter(organizacaoID string) (*models.Organizacao, error) {
+	organizacao, err := s.organizacoes.GetByID(organizacaoID)
+	if err != nil {
+		return nil, ErrOrganizacaoInvalida
+	}
+	return organizacao, nil
+}
+
+// Atualizar altera o nome da organização
+func (s *OrganizacaoService) Atualizar(organizacaoID, nome string) (*models.Organizacao, error) {
+	organizacao, err := s.Obter(organizacaoID)
+	if err != nil {
+		return nil, err
+	}
+
+	organizacao.Nome = strings.TrimSpace(nome)
+	if err := s.db.Model(organizacao).Update("nome", organizacao.Nome).Error; err != nil {
+		return nil, err
+	}
+	return organizacao, nil
+}
+
+// DefinirExigenciaDoisFatores liga ou desliga a exigência de dois fatores para
+// as contas ADMIN. Quem liga precisa estar com dois fatores ativo, para não
+// exigir dos outros o que não usa.
+func (s *OrganizacaoService) DefinirExigenciaDoisFatores(organizacaoID, userID string, exigir bool) (*models.Organizacao, error) {
+	organizacao, err := s.Obter(organizacaoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if exigir {
+		var usuario models.Usuario
+		if err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+			Select("id", "dois_fatores_ativo").
+			First(&usuario, "id = ?", userID).Error; err != nil {
+			return nil, err
+		}
+		if !usuario.DoisFatoresAtivo {
+			return nil, ErrDoisFatoresNaoAtivo
+		}
+	}
+
+	organizacao.ExigirDoisFatoresAdmin = exigir
+	if err := s.db.Model(organizacao).Update("exigir_dois_fatores_admin", exigir).Error; err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ORGANIZACAO] Exigência de dois fatores para administradores da organização %s: %v (por %s)", organizacaoID, exigir, userID)
+	return organizacao, nil
+}
+
+// RedefinirDoisFatoresUsuario remove o segundo fator do usuário e encerra suas
+// sessões; a organização do usuário deve ser validada por quem chama
+func (s *OrganizacaoService) RedefinirDoisFatoresUsuario(userID string) error {
+	if err := s.authService.RedefinirDoisFatores(userID); err != nil {
+		return err
+	}
+	return s.authService.LogoutTodasSessoes(userID)
+}
+
+// DesbloquearLoginUsuario remove o bloqueio por tentativas de login; a
+// organização do usuário deve ser validada por quem chama
+func (s *OrganizacaoService) DesbloquearLoginUsuario(userID string) error {
+	return s.authService.DesbloquearLogin(userID)
+}
+
+// Criar cria a organização e o usuário ADMIN inicial, já autenticado
+func (s *OrganizacaoService) Criar(req NovaOrganizacaoRequest, info ClientInfo) (*LoginResponse, error) {
+	if err := ValidarPoliticaSenha(req.Senha); err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Senha), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar hash da senha: %w", err)
+	}
+
+	var usuario models.Usuario
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := verificarEmailLivre(tx, req.Email); err != nil {
+			return err
+		}
+
+		slug, err := slugDisponivel(tx, req.Nome)
+		if err != nil {
+			return err
+		}
+
+		organizacao := models.Organizacao{
+			Nome:  strings.TrimSpace(req.Nome),
+			Slug:  slug,
+			Ativo: true,
+		}
+		if err := tx.Create(&organizacao).Error; err != nil {
+			return err
+		}
+
+		usuario = models.Usuario{
+			Nome:          strings.TrimSpace(req.AdminNome),
+			Email:         strings.ToLower(strings.TrimSpace(req.Email)),
+			Tipo:          models.TipoUsuarioAdmin,
+			Senha:         string(hash),
+			Ativo:         true,
+			OrganizacaoID: organizacao.ID,
+		}
+		return tx.Create(&usuario).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ORGANIZACAO] Organização %s criada por %s", usuario.OrganizacaoID, usuario.ID)
+	return s.authService.iniciarSessao(usuario, info)
+}
+
+// ListarConvites retorna os convites da organização, mais recentes primeiro
+func (s *OrganizacaoService) ListarConvites(organizacaoID string) ([]models.ConviteOrganizacao, error) {
+	var convites []models.ConviteOrganizacao
+	err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Preload("Papel").
+		Order("criado_em DESC").
+		Find(&convites).Error
+	return convites, err
+}
+
+// CriarConvite gera um convite de uso único e envia o link por email. Um novo
+// convite para o mesmo email substitui o anterior ainda pendente.
+func (s *OrganizacaoService) CriarConvite(organizacaoID, criadoPor, email string, tipo models.TipoUsuario, papelID *string) (*models.ConviteOrganizacao, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := verificarEmailLivre(s.db, email); err != nil {
+		return nil, err
+	}
+
+	organizacao, err := s.Obter(organizacaoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if papelID != nil && *papelID == "" {
+		papelID = nil
+	}
+	if papelID != nil {
+		var total int64
+		s.db.Model(&models.Papel{}).Scopes(repositories.PorOrganizacao(organizacaoID)).Where("id = ?", *papelID).Count(&total)
+		if total == 0 {
+			return nil, errors.New("papel não encontrado")
+		}
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, fmt.Errorf("erro ao gerar token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+
+	convite := models.ConviteOrganizacao{
+		OrganizacaoID: organizacaoID,
+		Email:         email,
+		Tipo:          tipo,
+		PapelID:       papelID,
+		TokenHash:     hashToken(token),
+		ExpiraEm:      time.Now().Add(conviteOrganizacaoTTL),
+		CriadoPor:     criadoPor,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ConviteOrganizacao{}).
+			Scopes(repositories.PorOrganizacao(organizacaoID)).
+			Where("email = ? AND aceito_em IS NULL AND revogado_em IS NULL", email).
+			Update("revogado_em", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&convite).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao salvar convite: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/convite?token=%s", strings.TrimRight(s.config.FrontendURL, "/"), url.QueryEscape(token))
+	corpo := fmt.Sprintf(`<p>Olá!</p>
+<p>Você foi convidado para participar da organização <strong>%s</strong> no TappyOne.</p>
+<p><a href="%s">Clique aqui para aceitar o convite</a>. O link expira em %d dias e só pode ser usado uma vez.</p>
+<p>Se você não esperava este convite, ignore este email.</p>`,
+		html.EscapeString(organizacao.Nome), html.EscapeString(link), int(conviteOrganizacaoTTL.Hours()/24))
+
+	if err := s.emailService.SendHTMLEmail(email, "Convite para "+organizacao.Nome+" - TappyOne", corpo); err != nil {
+		log.Printf("[ORGANIZACAO] Erro ao enviar convite %s: %v", convite.ID, err)
+		return &convite, err
+	}
+
+	return &convite, nil
+}
+
+// RevogarConvite invalida um convite pendente da organização
+func (s *OrganizacaoService) RevogarConvite(organizacaoID, conviteID string) error {
+	result := s.db.Model(&models.ConviteOrganizacao{}).
+		Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("id = ? AND aceito_em IS NULL AND revogado_em IS NULL", conviteID).
+		Update("revogado_em", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConviteInvalido
+	}
+	return nil
+}
+
+// ObterConvitePorToken retorna o convite pendente com a organização
+func (s *OrganizacaoService) ObterConvitePorToken(token string) (*models.ConviteOrganizacao, error) {
+	var convite models.ConviteOrganizacao
+	err := s.db.Preload("Organizacao").
+		Where("token_hash = ?", hashToken(token)).
+		First(&convite).Error
+	if err != nil || !convite.Pendente() || convite.Organizacao == nil || !convite.Organizacao.Ativo {
+		return nil, ErrConviteInvalido
+	}
+	return &convite, nil
+}
+
+// AceitarConvite cria o usuário na organização do convite e inicia a sessão
+func (s *OrganizacaoService) AceitarConvite(req AceitarConviteRequest, info ClientInfo) (*LoginResponse, error) {
+	if err := ValidarPoliticaSenha(req.Senha); err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Senha), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar hash da senha: %w", err)
+	}
+
+	var usuario models.Usuario
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var convite models.ConviteOrganizacao
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(req.Token)).
+			First(&convite).Error; err != nil || !convite.Pendente() {
+			return ErrConviteInvalido
+		}
+
+		var organizacao models.Organizacao
+		if err := tx.First(&organizacao, "id = ? AND ativo = ?", convite.OrganizacaoID, true).Error; err != nil {
+			return ErrConviteInvalido
+		}
+
+		if err := verificarEmailLivre(tx, convite.Email); err != nil {
+			return err
+		}
+
+		usuario = models.Usuario{
+			Nome:          strings.TrimSpace(req.Nome),
+			Email:         convite.Email,
+			Telefone:      req.Telefone,
+			Tipo:          convite.Tipo,
+			PapelID:       convite.PapelID,
+			Senha:         string(hash),
+			Ativo:         true,
+			OrganizacaoID: convite.OrganizacaoID,
+		}
+		if err := tx.Create(&usuario).Error; err != nil {
+			return err
+		}
+
+		agora := time.Now()
+		return tx.Model(&convite).Updates(map[string]interface{}{
+			"aceito_em":     agora,
+			"aceito_por_id": usuario.ID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ORGANIZACAO] Usuário %s entrou na organização %s por convite", usuario.ID, usuario.OrganizacaoID)
+	// Administradores convidados para organizações que exigem dois fatores
+	// recebem o desafio de cadastro em vez dos tokens
+	return s.authService.autenticar(usuario, info)
+}
+
+// verificarEmailLivre garante que o email ainda não pertence a nenhum usuário
+func verificarEmailLivre(tx *gorm.DB, email string) error {
+	var total int64
+	if err := tx.Model(&models.Usuario{}).Where("LOWER(email) = LOWER(?)", strings.TrimSpace(email)).Count(&total).Error; err != nil {
+		return err
+	}
+	if total > 0 {
+		return ErrEmailEmUso
+	}
+	return nil
+}
+
+// slugDisponivel gera o slug a partir do nome, com sufixo aleatório se já existir
+func slugDisponivel(tx *gorm.DB, nome string) (string, error) {
+	base := strings.Trim(slugInvalido.ReplaceAllString(strings.ToLower(removerAcentos(nome)), "-"), "-")
+	if base == "" {
+		base = "organizacao"
+	}
+
+	slug := base
+	for tentativa := 0; tentativa < 5; tentativa++ {
+		var total int64
+		if err := tx.Model(&models.Organizacao{}).Where("slug = ?", slug).Count(&total).Error; err != nil {
+			return "", err
+		}
+		if total == 0 {
+			return slug, nil
+		}
+
+		sufixo := make([]byte, 3)
+		if _, err := rand.Read(sufixo); err != nil {
+			return "", err
+		}
+		slug = base + "-" + hex.EncodeToString(sufixo)
+	}
+	return "", errors.New("não foi possível gerar um identificador para a organização")
+}
+
+var substituicoesAcentos = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+func removerAcentos(texto string) string {
+	return substituicoesAcentos.Replace(texto)
+}
@@ -0,0 +1,568 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	processamentoMidiaLote        = 10
+	processamentoMidiaReserva     = 10 * time.Minute // tempo em que a mídia fica reservada para o worker
+	processamentoMidiaTentativas  = 5
+	processamentoMidiaTimeout     = 2 * time.Minute // limite de cada execução do ffmpeg/ffprobe
+	miniaturaLadoMaximo           = 320
+	blurhashLadoMaximo            = 32
+	tipoAudioPTT                  = "audio/ogg; codecs=opus"
+	processamentoMidiaBitrateOpus = "32k"
+)
+
+// ErrFFmpegIndisponivel o servidor não tem ffmpeg para converter a mídia
+var ErrFFmpegIndisponivel = errors.New("ffmpeg não encontrado no servidor")
+
+var (
+	padraoPaginaPDF   = regexp.MustCompile(`/Type\s*/Page\b`)
+	padraoContagemPDF = regexp.MustCompile(`/Count\s+(\d+)`)
+)
+
+// ProcessamentoMidiaService fila que processa as mídias novas em background:
+// miniatura e blurhash de imagens e vídeos, conversão de áudio para
+// Opus/OGG (aceito pelo WhatsApp como mensagem de voz) e metadados (duração,
+// dimensões e páginas). A fila é a própria tabela midias, reservada com SKIP
+// LOCKED. Sem ffmpeg no servidor, imagens JPEG/PNG/GIF, duração de OGG e
+// páginas de PDF continuam sendo processadas; o restante é ignorado.
+type ProcessamentoMidiaService struct {
+	db      *gorm.DB
+	midias  *MidiaService
+	ffmpeg  string
+	ffprobe string
+	stop    chan struct{}
+	sinal   chan struct{}
+}
+
+func NewProcessamentoMidiaService(db *gorm.DB, midias *MidiaService, cfg *config.Config) *ProcessamentoMidiaService {
+	s := &ProcessamentoMidiaService{
+		db:     db,
+		midias: midias,
+		sinal:  make(chan struct{}, 1),
+	}
+
+	if caminho, err := exec.LookPath(cfg.FFmpegPath); err == nil {
+		s.ffmpeg = caminho
+	} else {
+		log.Printf("[MIDIA] ffmpeg não encontrado (%s): conversão de áudio e miniaturas de vídeo desativadas", cfg.FFmpegPath)
+	}
+	if caminho, err := exec.LookPath(cfg.FFprobePath); err == nil {
+		s.ffprobe = caminho
+	}
+	return s
+}
+
+// Iniciar processa a fila em background. Além do intervalo, a fila é
+// processada logo após cada mídia armazenada.
+func (s *ProcessamentoMidiaService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[MIDIA] Fila de processamento iniciada (intervalo: %s)", intervalo)
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.sinal:
+			case <-s.stop:
+				log.Printf("[MIDIA] Fila de processamento finalizada")
+				return
+			}
+			s.processarFila()
+		}
+	}()
+}
+
+// Parar interrompe o processamento da fila
+func (s *ProcessamentoMidiaService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *ProcessamentoMidiaService) acordar() {
+	select {
+	case s.sinal <- struct{}{}:
+	default:
+	}
+}
+
+// Reprocessar devolve a mídia para a fila (ex: após instalar o ffmpeg)
+func (s *ProcessamentoMidiaService) Reprocessar(midia *models.Midia) error {
+	err := s.db.Model(midia).Updates(map[string]interface{}{
+		"status_processamento":     models.StatusProcessamentoPendente,
+		"tentativas_processamento": 0,
+		"proximo_processamento_em": nil,
+		"erro_processamento":       nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("erro ao reenfileirar mídia: %w", err)
+	}
+	s.acordar()
+	return nil
+}
+
+// AudioPTT conteúdo da mídia pronto para envio como mensagem de voz. Converte
+// na hora quando a fila ainda não gerou a versão Opus/OGG.
+func (s *ProcessamentoMidiaService) AudioPTT(midia *models.Midia) ([]byte, error) {
+	if midia.ChaveAudioPTT != nil {
+		leitor, _, _, err := s.midias.AbrirVariante(midia, models.VarianteMidiaAudioPTT)
+		if err == nil {
+			defer leitor.Close()
+			var dados bytes.Buffer
+			if _, err := dados.ReadFrom(leitor); err == nil {
+				return dados.Bytes(), nil
+			}
+		}
+	}
+
+	dados, err := s.midias.Ler(midia)
+	if err != nil {
+		return nil, err
+	}
+	if ehOggOpus(dados) {
+		return dados, nil
+	}
+	if s.ffmpeg == "" {
+		return nil, ErrFFmpegIndisponivel
+	}
+
+	convertido, err := s.converterParaOpus(dados)
+	if err != nil {
+		return nil, err
+	}
+	chave := chaveDerivada(midia, "ptt.ogg")
+	if err := s.midias.gravarDerivado(chave, convertido, tipoAudioPTT); err != nil {
+		return nil, err
+	}
+	midia.ChaveAudioPTT = &chave
+	if err := s.db.Model(midia).Update("chave_audio_ptt", chave).Error; err != nil {
+		return nil, fmt.Errorf("erro ao registrar áudio convertido: %w", err)
+	}
+	return convertido, nil
+}
+
+// processarFila processa os lotes de mídias pendentes até esvaziar a fila
+func (s *ProcessamentoMidiaService) processarFila() {
+	for {
+		midias, err := s.reservarLote()
+		if err != nil {
+			log.Printf("[MIDIA] Erro ao buscar mídias pendentes: %v", err)
+			return
+		}
+		if len(midias) == 0 {
+			return
+		}
+
+		for i := range midias {
+			s.processarMidia(&midias[i])
+		}
+
+		if len(midias) < processamentoMidiaLote {
+			return
+		}
+	}
+}
+
+// reservarLote trava as próximas mídias pendentes e adia o próximo
+// processamento pelo tempo de reserva, para que outras instâncias não as
+// processem em paralelo
+func (s *ProcessamentoMidiaService) reservarLote() ([]models.Midia, error) {
+	var midias []models.Midia
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		agora := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status_processamento = ?", models.StatusProcessamentoPendente).
+			Where("proximo_processamento_em IS NULL OR proximo_processamento_em <= ?", agora).
+			Order("criado_em ASC").
+			Limit(processamentoMidiaLote).
+			Find(&midias).Error
+		if err != nil || len(midias) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(midias))
+		for i := range midias {
+			ids[i] = midias[i].ID
+		}
+		return tx.Model(&models.Midia{}).Where("id IN ?", ids).
+			Update("proximo_processamento_em", agora.Add(processamentoMidiaReserva)).Error
+	})
+	return midias, err
+}
+
+func (s *ProcessamentoMidiaService) processarMidia(midia *models.Midia) {
+	inicio := time.Now()
+	err := s.processar(midia)
+
+	agora := time.Now()
+	updates := map[string]interface{}{
+		"largura":          midia.Largura,
+		"altura":           midia.Altura,
+		"duracao_segundos": midia.DuracaoSegundos,
+		"paginas":          midia.Paginas,
+		"blurhash":         midia.Blurhash,
+		"chave_miniatura":  midia.ChaveMiniatura,
+		"chave_audio_ptt":  midia.ChaveAudioPTT,
+	}
+	if err == nil {
+		updates["status_processamento"] = models.StatusProcessamentoConcluido
+		updates["processada_em"] = agora
+		updates["proximo_processamento_em"] = nil
+		updates["erro_processamento"] = nil
+		log.Printf("[MIDIA] Mídia %s (%s) processada em %s", midia.ID, midia.TipoMime, time.Since(inicio).Round(time.Millisecond))
+	} else {
+		tentativas := midia.TentativasProcessamento + 1
+		mensagem := err.Error()
+		updates["tentativas_processamento"] = tentativas
+		updates["erro_processamento"] = mensagem
+		if tentativas >= processamentoMidiaTentativas {
+			updates["status_processamento"] = models.StatusProcessamentoFalhou
+			updates["proximo_processamento_em"] = nil
+		} else {
+			updates["proximo_processamento_em"] = agora.Add(time.Duration(tentativas*tentativas) * time.Minute)
+		}
+		log.Printf("[MIDIA] Erro ao processar mídia %s (tentativa %d): %v", midia.ID, tentativas, err)
+	}
+
+	if err := s.db.Model(&models.Midia{}).Where("id = ?", midia.ID).Updates(updates).Error; err != nil {
+		log.Printf("[MIDIA] Erro ao salvar processamento da mídia %s: %v", midia.ID, err)
+	}
+}
+
+func (s *ProcessamentoMidiaService) processar(midia *models.Midia) error {
+	dados, err := s.midias.Ler(midia)
+	if err != nil {
+		return fmt.Errorf("erro ao ler mídia: %w", err)
+	}
+
+	tipo := strings.SplitN(midia.TipoMime, ";", 2)[0]
+	switch {
+	case strings.HasPrefix(tipo, "image/"):
+		return s.processarImagem(midia, dados)
+	case strings.HasPrefix(tipo, "video/"):
+		return s.processarVideo(midia, dados)
+	case strings.HasPrefix(tipo, "audio/"):
+		return s.processarAudio(midia, dados)
+	case tipo == "application/pdf":
+		if paginas := contarPaginasPDF(dados); paginas > 0 {
+			midia.Paginas = &paginas
+		}
+	}
+	return nil
+}
+
+func (s *ProcessamentoMidiaService) processarImagem(midia *models.Midia, dados []byte) error {
+	imagem, _, err := image.Decode(bytes.NewReader(dados))
+	if err != nil {
+		// WebP, HEIC e outros formatos sem decodificador nativo passam pelo ffmpeg
+		if s.ffmpeg == "" {
+			return nil
+		}
+		quadro, err := s.executarFFmpeg(dados, "-frames:v", "1", "-f", "image2", "-c:v", "png")
+		if err != nil {
+			return err
+		}
+		if imagem, _, err = image.Decode(bytes.NewReader(quadro)); err != nil {
+			return fmt.Errorf("erro ao decodificar imagem: %w", err)
+		}
+	}
+
+	limites := imagem.Bounds()
+	largura, altura := limites.Dx(), limites.Dy()
+	midia.Largura = &largura
+	midia.Altura = &altura
+	return s.gerarMiniatura(midia, imagem)
+}
+
+func (s *ProcessamentoMidiaService) processarVideo(midia *models.Midia, dados []byte) error {
+	if s.ffmpeg == "" {
+		return nil
+	}
+	s.extrairMetadados(midia, dados)
+
+	// Primeiro quadro após 1s (ou o primeiro, em vídeos mais curtos)
+	quadro, err := s.executarFFmpeg(dados, "-ss", "1", "-frames:v", "1", "-f", "image2", "-c:v", "png")
+	if err != nil || len(quadro) == 0 {
+		quadro, err = s.executarFFmpeg(dados, "-frames:v", "1", "-f", "image2", "-c:v", "png")
+		if err != nil {
+			return err
+		}
+	}
+	imagem, _, err := image.Decode(bytes.NewReader(quadro))
+	if err != nil {
+		return fmt.Errorf("erro ao decodificar quadro do vídeo: %w", err)
+	}
+	if midia.Largura == nil {
+		limites := imagem.Bounds()
+		largura, altura := limites.Dx(), limites.Dy()
+		midia.Largura = &largura
+		midia.Altura = &altura
+	}
+	return s.gerarMiniatura(midia, imagem)
+}
+
+func (s *ProcessamentoMidiaService) processarAudio(midia *models.Midia, dados []byte) error {
+	if duracao, ok := duracaoOgg(dados); ok {
+		midia.DuracaoSegundos = &duracao
+	}
+	if s.ffmpeg == "" {
+		return nil
+	}
+	if midia.DuracaoSegundos == nil {
+		s.extrairMetadados(midia, dados)
+	}
+
+	// Áudio gravado no navegador (webm, mp4, wav...) é convertido para Opus/OGG
+	if ehOggOpus(dados) || midia.ChaveAudioPTT != nil {
+		return nil
+	}
+	convertido, err := s.converterParaOpus(dados)
+	if err != nil {
+		return err
+	}
+	chave := chaveDerivada(midia, "ptt.ogg")
+	if err := s.midias.gravarDerivado(chave, convertido, tipoAudioPTT); err != nil {
+		return fmt.Errorf("erro ao gravar áudio convertido: %w", err)
+	}
+	midia.ChaveAudioPTT = &chave
+	if midia.DuracaoSegundos == nil {
+		if duracao, ok := duracaoOgg(convertido); ok {
+			midia.DuracaoSegundos = &duracao
+		}
+	}
+	return nil
+}
+
+// gerarMiniatura grava o JPEG reduzido e calcula o blurhash
+func (s *ProcessamentoMidiaService) gerarMiniatura(midia *models.Midia, imagem image.Image) error {
+	miniatura := reduzirImagem(imagem, miniaturaLadoMaximo)
+
+	var saida bytes.Buffer
+	if err := jpeg.Encode(&saida, miniatura, &jpeg.Options{Quality: 75}); err != nil {
+		return fmt.Errorf("erro ao gerar miniatura: %w", err)
+	}
+	chave := chaveDerivada(midia, "miniatura.jpg")
+	if err := s.midias.gravarDerivado(chave, saida.Bytes(), "image/jpeg"); err != nil {
+		return fmt.Errorf("erro ao gravar miniatura: %w", err)
+	}
+	midia.ChaveMiniatura = &chave
+
+	hash := codificarBlurhash(reduzirImagem(miniatura, blurhashLadoMaximo), 4, 3)
+	midia.Blurhash = &hash
+	return nil
+}
+
+// extrairMetadados duração e dimensões pelo ffprobe; falhas são ignoradas
+func (s *ProcessamentoMidiaService) extrairMetadados(midia *models.Midia, dados []byte) {
+	if s.ffprobe == "" {
+		return
+	}
+
+	entrada, err := arquivoTemporario(dados)
+	if err != nil {
+		return
+	}
+	defer os.Remove(entrada)
+
+	ctx, cancelar := context.WithTimeout(context.Background(), processamentoMidiaTimeout)
+	defer cancelar()
+	saida, err := exec.CommandContext(ctx, s.ffprobe, "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", entrada).Output()
+	if err != nil {
+		log.Printf("[MIDIA] ffprobe falhou para a mídia %s: %v", midia.ID, err)
+		return
+	}
+
+	var resultado struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(saida, &resultado); err != nil {
+		return
+	}
+	if duracao, err := strconv.ParseFloat(resultado.Format.Duration, 64); err == nil && duracao > 0 {
+		midia.DuracaoSegundos = &duracao
+	}
+	for _, stream := range resultado.Streams {
+		if stream.CodecType == "video" && stream.Width > 0 {
+			largura, altura := stream.Width, stream.Height
+			midia.Largura = &largura
+			midia.Altura = &altura
+			break
+		}
+	}
+}
+
+func (s *ProcessamentoMidiaService) converterParaOpus(dados []byte) ([]byte, error) {
+	return s.executarFFmpeg(dados, "-vn", "-ac", "1", "-ar", "48000", "-c:a", "libopus",
+		"-b:a", processamentoMidiaBitrateOpus, "-application", "voip", "-f", "ogg")
+}
+
+// ConverterParaWAV áudio em WAV PCM 16 kHz mono, o formato lido pelo whisper.cpp
+func (s *ProcessamentoMidiaService) ConverterParaWAV(dados []byte) ([]byte, error) {
+	wav, err := s.executarFFmpeg(dados, "-vn", "-ac", "1", "-ar", "16000", "-c:a", "pcm_s16le", "-f", "wav")
+	if err != nil {
+		return nil, err
+	}
+	corrigirTamanhosWAV(wav)
+	return wav, nil
+}
+
+// corrigirTamanhosWAV preenche os tamanhos do cabeçalho, que o ffmpeg não
+// consegue voltar para gravar quando a saída é um pipe
+func corrigirTamanhosWAV(wav []byte) {
+	if len(wav) < 12 || string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		return
+	}
+	binary.LittleEndian.PutUint32(wav[4:8], uint32(len(wav)-8))
+	for posicao := 12; posicao+8 <= len(wav); {
+		tamanho := int(binary.LittleEndian.Uint32(wav[posicao+4 : posicao+8]))
+		if string(wav[posicao:posicao+4]) == "data" {
+			binary.LittleEndian.PutUint32(wav[posicao+4:posicao+8], uint32(len(wav)-posicao-8))
+			return
+		}
+		posicao += 8 + tamanho + tamanho%2
+	}
+}
+
+// executarFFmpeg roda o ffmpeg com a mídia como entrada e devolve a saída
+// (stdout). A entrada vai para um arquivo temporário porque vídeos MP4 podem
+// exigir leitura fora de ordem.
+func (s *ProcessamentoMidiaService) executarFFmpeg(dados []byte, argumentos ...string) ([]byte, error) {
+	if s.ffmpeg == "" {
+		return nil, ErrFFmpegIndisponivel
+	}
+
+	entrada, err := arquivoTemporario(dados)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(entrada)
+
+	ctx, cancelar := context.WithTimeout(context.Background(), processamentoMidiaTimeout)
+	defer cancelar()
+
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", entrada}, argumentos...)
+	args = append(args, "pipe:1")
+	cmd := exec.CommandContext(ctx, s.ffmpeg, args...)
+
+	var saida, erros bytes.Buffer
+	cmd.Stdout = &saida
+	cmd.Stderr = &erros
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg falhou: %v: %s", err, strings.TrimSpace(erros.String()))
+	}
+	return saida.Bytes(), nil
+}
+
+func arquivoTemporario(dados []byte) (string, error) {
+	arquivo, err := os.CreateTemp("", "midia-*")
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar arquivo temporário: %w", err)
+	}
+	defer arquivo.Close()
+	if _, err := arquivo.Write(dados); err != nil {
+		os.Remove(arquivo.Name())
+		return "", fmt.Errorf("erro ao gravar arquivo temporário: %w", err)
+	}
+	return arquivo.Name(), nil
+}
+
+// chaveDerivada chave de um objeto gerado a partir da mídia; segue o
+// endereçamento por conteúdo, então é compartilhada entre organizações
+func chaveDerivada(midia *models.Midia, sufixo string) string {
+	return strings.TrimSuffix(midia.Chave, path.Ext(midia.Chave)) + "." + sufixo
+}
+
+// ehOggOpus áudio já no formato aceito pelo WhatsApp como mensagem de voz
+func ehOggOpus(dados []byte) bool {
+	inicio := dados
+	if len(inicio) > 512 {
+		inicio = inicio[:512]
+	}
+	return bytes.HasPrefix(inicio, []byte("OggS")) && bytes.Contains(inicio, []byte("OpusHead"))
+}
+
+// duracaoOgg duração pela posição (granule) da última página do OGG, sem ffmpeg
+func duracaoOgg(dados []byte) (float64, bool) {
+	if !bytes.HasPrefix(dados, []byte("OggS")) {
+		return 0, false
+	}
+	ultima := bytes.LastIndex(dados, []byte("OggS"))
+	if ultima < 0 || len(dados) < ultima+14 {
+		return 0, false
+	}
+	posicao := binary.LittleEndian.Uint64(dados[ultima+6 : ultima+14])
+
+	cabecalho := dados
+	if len(cabecalho) > 512 {
+		cabecalho = cabecalho[:512]
+	}
+	taxa, descarte := 0.0, uint64(0)
+	if i := bytes.Index(cabecalho, []byte("OpusHead")); i >= 0 && len(cabecalho) >= i+12 {
+		// Opus sempre usa 48 kHz na posição; pre-skip são amostras descartadas no início
+		taxa = 48000
+		descarte = uint64(binary.LittleEndian.Uint16(cabecalho[i+10 : i+12]))
+	} else if i := bytes.Index(cabecalho, []byte("\x01vorbis")); i >= 0 && len(cabecalho) >= i+16 {
+		taxa = float64(binary.LittleEndian.Uint32(cabecalho[i+12 : i+16]))
+	}
+	if taxa == 0 || posicao <= descarte || posicao == ^uint64(0) {
+		return 0, false
+	}
+	return float64(posicao-descarte) / taxa, true
+}
+
+// contarPaginasPDF conta os objetos /Type /Page; em PDFs com object streams
+// comprimidos usa o maior /Count da árvore de páginas
+func contarPaginasPDF(dados []byte) int {
+	if paginas := len(padraoPaginaPDF.FindAllIndex(dados, -1)); paginas > 0 {
+		return paginas
+	}
+	maior := 0
+	for _, contagem := range padraoContagemPDF.FindAllSubmatch(dados, -1) {
+		if n, err := strconv.Atoi(string(contagem[1])); err == nil && n > maior {
+			maior = n
+		}
+	}
+	return maior
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitPrefix = "ratelimit:"
+
+// RateLimiter limita eventos por chave em janelas fixas. Usa Redis para valer
+// entre réplicas e cai para memória local quando o Redis não está disponível.
+type RateLimiter struct {
+	redis *redis.Client
+	mutex sync.Mutex
+	local map[string]*janelaRateLimit
+}
+
+type janelaRateLimit struct {
+	total    int
+	expiraEm time.Time
+}
+
+func NewRateLimiter(redis *redis.Client) *RateLimiter {
+	return &RateLimiter{
+		redis: redis,
+		local: make(map[string]*janelaRateLimit),
+	}
+}
+
+// Permitir registra um evento para a chave e informa se ainda está dentro do
+// limite da janela. Quando bloqueado, retorna quanto falta para a janela expirar.
+func (r *RateLimiter) Permitir(chave string, limite int, janela time.Duration) (bool, time.Duration) {
+	if r.redis != nil {
+		ctx := context.Background()
+		chaveRedis := rateLimitPrefix + chave
+
+		total, err := r.redis.Incr(ctx, chaveRedis).Result()
+		if err == nil {
+			if total == 1 {
+				r.redis.Expire(ctx, chaveRedis, janela)
+			}
+			if total <= int64(limite) {
+				return true, 0
+			}
+			ttl, _ := r.redis.TTL(ctx, chaveRedis).Result()
+			if ttl < 0 {
+				// Chave sem expiração (falha anterior no EXPIRE)
+				r.redis.Expire(ctx, chaveRedis, janela)
+				ttl = janela
+			}
+			return false, ttl
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	agora := time.Now()
+	atual, ok := r.local[chave]
+	if !ok || agora.After(atual.expiraEm) {
+		r.limparExpirados(agora)
+		atual = &janelaRateLimit{expiraEm: agora.Add(janela)}
+		r.local[chave] = atual
+	}
+	atual.total++
+	if atual.total <= limite {
+		return true, 0
+	}
+	return false, atual.expiraEm.Sub(agora)
+}
+
+// Resetar zera o contador da chave
+func (r *RateLimiter) Resetar(chave string) {
+	if r.redis != nil {
+		r.redis.Del(context.Background(), rateLimitPrefix+chave)
+	}
+
+	r.mutex.Lock()
+	delete(r.local, chave)
+	r.mutex.Unlock()
+}
+
+// limparExpirados deve ser chamado com o mutex adquirido
+func (r *RateLimiter) limparExpirados(agora time.Time) {
+	for chave, janela := range r.local {
+		if agora.After(janela.expiraEm) {
+			delete(r.local, chave)
+		}
+	}
+}
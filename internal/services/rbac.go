@@ -0,0 +1,457 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPermissaoNegada   = errors.New("permissão negada")
+	ErrPermissaoInvalida = errors.New("permissão inválida")
+)
+
+const (
+	// Permissões efetivas do usuário, relidas a cada requisição protegida
+	rbacUsuarioCachePrefix = "rbac:usuario:"
+	rbacUsuarioCacheTTL    = 30 * time.Second
+)
+
+// CatalogoPermissoes lista as ações válidas de cada recurso
+var CatalogoPermissoes = map[models.Recurso][]models.Acao{
+	models.RecursoOrganizacao:      {models.AcaoLer, models.AcaoEscrever},
+	models.RecursoUsuarios:         {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoPapeis:           {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoContatos:         {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir, models.AcaoLerTodos},
+	models.RecursoMensagens:        {models.AcaoLer, models.AcaoEnviar, models.AcaoExcluir},
+	models.RecursoSessoes:          {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoKanban:           {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAgendamentos:     {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoOrcamentos:       {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAssinaturas:      {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAnotacoes:        {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoFilas:            {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoTags:             {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAlertas:          {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoSLA:              {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoRespostasRapidas: {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoFluxos:           {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAgentes:          {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAtendimentos:     {models.AcaoLer, models.AcaoEscrever},
+	models.RecursoChavesAPI:        {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoAuditoria:        {models.AcaoLer},
+	models.RecursoWebhooks:         {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir},
+	models.RecursoCampanhas:        {models.AcaoLer, models.AcaoEscrever, models.AcaoExcluir, models.AcaoEnviar},
+}
+
+// permissoesAtendente base comum a todos os ATENDENTE_*
+var permissoesAtendente = models.ListaPermissoes{
+	"organizacao:read",
+	"usuarios:read",
+	"contatos:read", "contatos:write",
+	"mensagens:read", "mensagens:send",
+	"sessoes:read",
+	"kanban:read", "kanban:write",
+	"agendamentos:read", "agendamentos:write",
+	"anotacoes:read", "anotacoes:write", "anotacoes:delete",
+	"filas:read",
+	"tags:read",
+	"alertas:read",
+	"sla:read",
+	"respostas_rapidas:read",
+	"fluxos:read",
+	"agentes:read",
+	"atendimentos:read", "atendimentos:write",
+}
+
+func comPermissoes(base models.ListaPermissoes, extras ...models.Permissao) models.ListaPermissoes {
+	lista := make(models.ListaPermissoes, 0, len(base)+len(extras))
+	lista = append(lista, base...)
+	return append(lista, extras...)
+}
+
+// PermissoesPadrao concedidas a cada TipoUsuario sem papel personalizado
+var PermissoesPadrao = map[models.TipoUsuario]models.ListaPermissoes{
+	models.TipoUsuarioAdmin: {"*:*"},
+	models.TipoUsuarioAssinante: {
+		"organizacao:read", "usuarios:read",
+		"contatos:*", "mensagens:*", "sessoes:*",
+		"kanban:*", "agendamentos:*", "orcamentos:*", "assinaturas:read",
+		"anotacoes:*", "filas:read", "tags:*", "alertas:*", "sla:read",
+		"respostas_rapidas:*", "fluxos:*", "agentes:*", "atendimentos:*",
+		"campanhas:*",
+	},
+	models.TipoUsuarioAtendenteFinanceiro: comPermissoes(permissoesAtendente,
+		"orcamentos:read", "orcamentos:write", "assinaturas:read", "assinaturas:write"),
+	models.TipoUsuarioAtendenteComercial: comPermissoes(permissoesAtendente,
+		"orcamentos:read", "orcamentos:write", "tags:write"),
+	models.TipoUsuarioAtendenteVendas: comPermissoes(permissoesAtendente,
+		"orcamentos:read", "orcamentos:write", "tags:write"),
+	models.TipoUsuarioAtendenteJuridico: comPermissoes(permissoesAtendente,
+		"orcamentos:read", "assinaturas:read"),
+	models.TipoUsuarioAtendenteSuporte: comPermissoes(permissoesAtendente,
+		"tags:write"),
+	models.TipoUsuarioAfiliado: {
+		"contatos:read", "assinaturas:read", "atendimentos:read",
+	},
+}
+
+// RecursoPossuiAcao indica se a ação existe no catálogo do recurso
+func RecursoPossuiAcao(recurso models.Recurso, acao models.Acao) bool {
+	for _, a := range CatalogoPermissoes[recurso] {
+		if a == acao {
+			return true
+		}
+	}
+	return false
+}
+
+// TipoUsuarioValido indica se o tipo faz parte do enum conhecido
+func TipoUsuarioValido(tipo models.TipoUsuario) bool {
+	_, ok := PermissoesPadrao[tipo]
+	return ok
+}
+
+// ValidarPermissoes garante que cada item exista no catálogo (curingas aceitos)
+func ValidarPermissoes(lista models.ListaPermissoes) error {
+	for _, p := range lista {
+		recurso, acao, ok := p.Partes()
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrPermissaoInvalida, p)
+		}
+		if recurso == models.CuringaPermissao {
+			if acao != models.CuringaPermissao {
+				return fmt.Errorf("%w: %s", ErrPermissaoInvalida, p)
+			}
+			continue
+		}
+
+		if _, existe := CatalogoPermissoes[models.Recurso(recurso)]; !existe {
+			return fmt.Errorf("%w: %s", ErrPermissaoInvalida, p)
+		}
+		if acao == models.CuringaPermissao {
+			continue
+		}
+
+		if !RecursoPossuiAcao(models.Recurso(recurso), models.Acao(acao)) {
+			return fmt.Errorf("%w: %s", ErrPermissaoInvalida, p)
+		}
+	}
+	return nil
+}
+
+// perfilAcesso permissões efetivas do usuário (cacheadas no Redis)
+type perfilAcesso struct {
+	Tipo          models.TipoUsuario     `json:"tipo"`
+	PapelID       *string                `json:"papelId"`
+	OrganizacaoID string                 `json:"organizacaoId"`
+	Permissoes    models.ListaPermissoes `json:"permissoes"`
+}
+
+// PermissionService resolve permissões por TipoUsuario ou papel personalizado
+type PermissionService struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewPermissionService(db *gorm.DB, redis *redis.Client) *PermissionService {
+	return &PermissionService{
+		db:    db,
+		redis: redis,
+	}
+}
+
+// PermissoesUsuario retorna as permissões efetivas do usuário
+func (s *PermissionService) PermissoesUsuario(userID string) (models.ListaPermissoes, error) {
+	perfil, err := s.perfil(userID)
+	if err != nil {
+		return nil, err
+	}
+	return perfil.Permissoes, nil
+}
+
+// Possui indica se o usuário tem a permissão solicitada
+func (s *PermissionService) Possui(userID string, permissao models.Permissao) (bool, error) {
+	permissoes, err := s.PermissoesUsuario(userID)
+	if err != nil {
+		return false, err
+	}
+	return permissoes.Concede(permissao), nil
+}
+
+// PossuiTodas indica se o usuário tem todas as permissões solicitadas
+func (s *PermissionService) PossuiTodas(userID string, permissoes ...models.Permissao) (bool, error) {
+	efetivas, err := s.PermissoesUsuario(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range permissoes {
+		if !efetivas.Concede(p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *PermissionService) perfil(userID string) (*perfilAcesso, error) {
+	ctx := context.Background()
+	chave := rbacUsuarioCachePrefix + userID
+
+	if s.redis != nil {
+		if payload, err := s.redis.Get(ctx, chave).Bytes(); err == nil {
+			var perfil perfilAcesso
+			if json.Unmarshal(payload, &perfil) == nil {
+				return &perfil, nil
+			}
+		}
+	}
+
+	var usuario models.Usuario
+	if err := s.db.Select("id", "tipo", "papel_id", "organizacao_id").Preload("Papel").First(&usuario, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	perfil := &perfilAcesso{
+		Tipo:          usuario.Tipo,
+		PapelID:       usuario.PapelID,
+		OrganizacaoID: usuario.OrganizacaoID,
+		Permissoes:    PermissoesPadrao[usuario.Tipo],
+	}
+	// Papel de outra organização nunca é aplicado
+	if usuario.Papel != nil && usuario.Papel.OrganizacaoID == usuario.OrganizacaoID {
+		perfil.Permissoes = usuario.Papel.Permissoes
+	}
+
+	if s.redis != nil {
+		if payload, err := json.Marshal(perfil); err == nil {
+			s.redis.Set(ctx, chave, payload, rbacUsuarioCacheTTL)
+		}
+	}
+
+	return perfil, nil
+}
+
+// OrganizacaoUsuario retorna a organização do usuário
+func (s *PermissionService) OrganizacaoUsuario(userID string) (string, error) {
+	perfil, err := s.perfil(userID)
+	if err != nil {
+		return "", err
+	}
+	return perfil.OrganizacaoID, nil
+}
+
+// PertenceAOrganizacao verifica se o registro (quadro, fila, tag...) é da organização do usuário
+func (s *PermissionService) PertenceAOrganizacao(userID string, modelo interface{}, id string) bool {
+	organizacaoID, err := s.OrganizacaoUsuario(userID)
+	if err != nil {
+		return false
+	}
+
+	var total int64
+	if err := s.db.Model(modelo).Scopes(repositories.PorOrganizacao(organizacaoID)).Where("id = ?", id).Count(&total).Error; err != nil {
+		return false
+	}
+	return total > 0
+}
+
+// InvalidarUsuario força nova leitura das permissões (ex: troca de tipo ou papel)
+func (s *PermissionService) InvalidarUsuario(userID string) {
+	if s.redis != nil {
+		s.redis.Del(context.Background(), rbacUsuarioCachePrefix+userID)
+	}
+}
+
+// InvalidarPapel invalida o cache de todos os usuários com o papel
+func (s *PermissionService) InvalidarPapel(papelID string) {
+	if s.redis == nil {
+		return
+	}
+
+	var ids []string
+	if err := s.db.Model(&models.Usuario{}).Where("papel_id = ?", papelID).Pluck("id", &ids).Error; err != nil {
+		log.Printf("[RBAC] Erro ao buscar usuários do papel %s: %v", papelID, err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	chaves := make([]string, len(ids))
+	for i, id := range ids {
+		chaves[i] = rbacUsuarioCachePrefix + id
+	}
+	s.redis.Del(context.Background(), chaves...)
+}
+
+// EscopoAtendimento define quais contatos e conversas o usuário enxerga.
+// Sem contatos:read_all o acesso fica restrito às filas do atendente e aos
+// contatos atribuídos diretamente a ele.
+type EscopoAtendimento struct {
+	UsuarioID     string
+	OrganizacaoID string
+	Irrestrito    bool
+	FilaIDs       []string
+}
+
+// EscopoAtendimento carrega o escopo de contatos do usuário
+func (s *PermissionService) EscopoAtendimento(userID string) (*EscopoAtendimento, error) {
+	perfil, err := s.perfil(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	escopo := &EscopoAtendimento{
+		UsuarioID:     userID,
+		OrganizacaoID: perfil.OrganizacaoID,
+		Irrestrito:    perfil.Permissoes.Concede(models.NovaPermissao(models.RecursoContatos, models.AcaoLerTodos)),
+	}
+	if escopo.Irrestrito {
+		return escopo, nil
+	}
+
+	if err := s.db.Model(&models.FilaAtendente{}).
+		Joins("JOIN filas ON filas.id = fila_atendentes.fila_id AND filas.ativa = ? AND filas.organizacao_id = ?", true, perfil.OrganizacaoID).
+		Where("fila_atendentes.usuario_id = ?", userID).
+		Pluck("fila_atendentes.fila_id", &escopo.FilaIDs).Error; err != nil {
+		return nil, err
+	}
+
+	return escopo, nil
+}
+
+// CondicaoContatos retorna o filtro SQL sobre a tabela de contatos (alias informado),
+// sempre restrito à organização do usuário
+func (e *EscopoAtendimento) CondicaoContatos(alias string) (string, []interface{}) {
+	if e.Irrestrito {
+		return fmt.Sprintf("%s.organizacao_id = ?", alias), []interface{}{e.OrganizacaoID}
+	}
+
+	filaIDs := e.FilaIDs
+	if len(filaIDs) == 0 {
+		// Evita IN () vazio
+		filaIDs = []string{"00000000-0000-0000-0000-000000000000"}
+	}
+
+	return fmt.Sprintf("%[1]s.organizacao_id = ? AND (%[1]s.id IN (SELECT contato_id FROM fila_contatos WHERE ativo = true AND fila_id IN ?)"+
+			" OR %[1]s.id IN (SELECT contato_id FROM atendente_contatos WHERE ativo = true AND user_id = ?))", alias),
+		[]interface{}{e.OrganizacaoID, filaIDs, e.UsuarioID}
+}
+
+// ChatsPermitidos retorna os chatIds (contactid) visíveis para o escopo. No escopo
+// irrestrito inclui também os chats com conversa em sessões da organização.
+func (s *PermissionService) ChatsPermitidos(escopo *EscopoAtendimento) (map[string]bool, error) {
+	if escopo.OrganizacaoID == "" {
+		return map[string]bool{}, nil
+	}
+
+	condicao, args := escopo.CondicaoContatos("c")
+
+	var chatIDs []string
+	if err := s.db.Table("contatos c").
+		Where("c.contactid IS NOT NULL").
+		Where(condicao, args...).
+		Pluck("c.contactid", &chatIDs).Error; err != nil {
+		return nil, err
+	}
+
+	if escopo.Irrestrito {
+		var conversas []string
+		if err := s.conversasDaOrganizacao(escopo.OrganizacaoID).
+			Distinct().
+			Pluck("cv.id_conversa", &conversas).Error; err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, conversas...)
+	}
+
+	permitidos := make(map[string]bool, len(chatIDs))
+	for _, id := range chatIDs {
+		permitidos[id] = true
+	}
+	return permitidos, nil
+}
+
+// PodeAcessarChat verifica se o chat pertence ao escopo do usuário. Mesmo no
+// escopo irrestrito o contato ou a sessão da conversa precisa ser da organização.
+func (s *PermissionService) PodeAcessarChat(escopo *EscopoAtendimento, chatID string) (bool, error) {
+	if escopo.OrganizacaoID == "" {
+		return false, nil
+	}
+
+	if escopo.Irrestrito {
+		var total int64
+		if err := s.conversasDaOrganizacao(escopo.OrganizacaoID).
+			Where("cv.id_conversa = ?", chatID).
+			Count(&total).Error; err != nil {
+			return false, err
+		}
+		if total > 0 {
+			return true, nil
+		}
+	}
+
+	condicao, args := escopo.CondicaoContatos("c")
+
+	var total int64
+	if err := s.db.Table("contatos c").
+		Where("c.contactid = ?", chatID).
+		Where(condicao, args...).
+		Count(&total).Error; err != nil {
+		return false, err
+	}
+	return total > 0, nil
+}
+
+// FiltrarChats remove da lista do WAHA os chats fora do escopo do usuário
+func (s *PermissionService) FiltrarChats(escopo *EscopoAtendimento, chats interface{}) (interface{}, error) {
+	lista, ok := chats.([]interface{})
+	if !ok {
+		return chats, nil
+	}
+
+	permitidos, err := s.ChatsPermitidos(escopo)
+	if err != nil {
+		return nil, err
+	}
+
+	filtrados := make([]interface{}, 0, len(lista))
+	for _, item := range lista {
+		chat, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if permitidos[chatIDWAHA(chat["id"])] {
+			filtrados = append(filtrados, chat)
+		}
+	}
+	return filtrados, nil
+}
+
+// conversasDaOrganizacao conversas (alias cv) das sessões da organização
+func (s *PermissionService) conversasDaOrganizacao(organizacaoID string) *gorm.DB {
+	return s.db.Table("conversas cv").
+		Joins("JOIN sessoes_whatsapp sw ON sw.id = cv.sessao_whatsapp_id").
+		Where("sw.organizacao_id = ?", organizacaoID)
+}
+
+// chatIDWAHA extrai o id do chat, que pode vir como string ou {_serialized}
+func chatIDWAHA(valor interface{}) string {
+	switch v := valor.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if serialized, ok := v["_serialized"].(string); ok {
+			return serialized
+		}
+	}
+	return ""
+}
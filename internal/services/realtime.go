@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Canais Redis usados para distribuir eventos de websocket entre réplicas
+const (
+	realtimeChannelPrefix    = "ws:"
+	realtimeUserPrefix       = realtimeChannelPrefix + "user:"
+	realtimeTopicPrefix      = realtimeChannelPrefix + "topic:"
+	RealtimeBroadcastChannel = realtimeChannelPrefix + "broadcast"
+
+	// Chaves de sequência e histórico (não são canais pub/sub)
+	realtimeSeqKey       = "wsseq"
+	realtimeStreamPrefix = "wsstream:"
+
+	// Quantidade máxima de eventos mantidos por canal para retomada
+	RealtimeStreamMaxLen = 1000
+	// Streams de canais sem eventos por mais tempo que isso são descartados
+	// (canais de usuários removidos, tópicos de chats encerrados)
+	RealtimeStreamTTL = 24 * time.Hour
+
+	// Tickets de conexão websocket e registro de conexões ativas
+	realtimeTicketPrefix     = "wsticket:"
+	realtimeConnectionPrefix = "wsconns:"
+	RealtimeTicketTTL        = 30 * time.Second
+
+	// Conexões sem heartbeat por mais tempo que isso são consideradas encerradas
+	realtimeConnectionTTL = 2 * time.Minute
+)
+
+var ErrTicketInvalido = errors.New("ticket inválido ou expirado")
+
+// RealtimeTicket credencial de uso único para abrir uma conexão websocket
+type RealtimeTicket struct {
+	UserID         string    `json:"userId"`
+	TokenExpiraEm  time.Time `json:"tokenExpiraEm"`
+	ticketExpiraEm time.Time
+}
+
+// RealtimeMessage é o envelope JSON entregue aos clientes websocket
+type RealtimeMessage struct {
+	Seq       int64       `json:"seq,omitempty"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	UserID    string      `json:"user_id,omitempty"`
+	Topic     string      `json:"topic,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// RealtimeService publica eventos de websocket no Redis para que todas as
+// réplicas entreguem aos seus clientes locais. Sem Redis, a entrega é local.
+type RealtimeService struct {
+	redis         *redis.Client
+	mutex         sync.RWMutex
+	localDelivery func(channel string, payload []byte)
+	localSeq      int64
+	localTickets  map[string]RealtimeTicket
+}
+
+func NewRealtimeService(redis *redis.Client) *RealtimeService {
+	return &RealtimeService{
+		redis:        redis,
+		localTickets: make(map[string]RealtimeTicket),
+	}
+}
+
+// RealtimeUserChannel canal com os eventos de um usuário
+func RealtimeUserChannel(userID string) string {
+	return realtimeUserPrefix + userID
+}
+
+// RealtimeTopicChannel canal com os eventos de um tópico (chat, quadro, fila)
+func RealtimeTopicChannel(topic string) string {
+	return realtimeTopicPrefix + topic
+}
+
+// ParseRealtimeChannel identifica o destino de um canal: "user", "topic" ou "broadcast"
+func ParseRealtimeChannel(channel string) (kind, target string) {
+	switch {
+	case channel == RealtimeBroadcastChannel:
+		return "broadcast", ""
+	case strings.HasPrefix(channel, realtimeUserPrefix):
+		return "user", strings.TrimPrefix(channel, realtimeUserPrefix)
+	case strings.HasPrefix(channel, realtimeTopicPrefix):
+		return "topic", strings.TrimPrefix(channel, realtimeTopicPrefix)
+	}
+	return "", ""
+}
+
+// Tópicos suportados
+func TopicChat(chatID string) string     { return "chat:" + chatID }
+func TopicQuadro(quadroID string) string { return "board:" + quadroID }
+func TopicFila(filaID string) string     { return "queue:" + filaID }
+
+// SetLocalDelivery define como entregar eventos aos clientes deste processo
+func (s *RealtimeService) SetLocalDelivery(fn func(channel string, payload []byte)) {
+	s.mutex.Lock()
+	s.localDelivery = fn
+	s.mutex.Unlock()
+}
+
+// Distribuido indica se os eventos passam pelo Redis
+func (s *RealtimeService) Distribuido() bool {
+	return s.redis != nil
+}
+
+// Publish envia o payload para o canal. Com Redis, a entrega local acontece
+// pela própria assinatura; sem Redis (ou em falha), entrega direto.
+func (s *RealtimeService) Publish(channel string, payload []byte) error {
+	if s.redis != nil {
+		err := s.redis.Publish(context.Background(), channel, payload).Err()
+		if err == nil {
+			return nil
+		}
+		log.Printf("[REALTIME] Erro ao publicar no canal %s, entregando localmente: %v", channel, err)
+	}
+
+	s.deliverLocal(channel, payload)
+	return nil
+}
+
+// PublishMessage numera, guarda no histórico do canal e publica uma mensagem
+func (s *RealtimeService) PublishMessage(channel string, message RealtimeMessage) error {
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+	message.Seq = s.nextSeq()
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.appendToStream(channel, message.Seq, payload)
+	return s.Publish(channel, payload)
+}
+
+// nextSeq gera a sequência global de eventos (compartilhada entre réplicas via Redis)
+func (s *RealtimeService) nextSeq() int64 {
+	if s.redis != nil {
+		seq, err := s.redis.Incr(context.Background(), realtimeSeqKey).Result()
+		if err == nil {
+			return seq
+		}
+		log.Printf("[REALTIME] Erro ao gerar sequência no Redis: %v", err)
+	}
+	return atomic.AddInt64(&s.localSeq, 1)
+}
+
+// appendToStream guarda o evento no stream limitado do canal e renova o TTL
+// dele. O ID do stream é gerado pelo Redis porque réplicas podem gravar
+// sequências fora de ordem.
+func (s *RealtimeService) appendToStream(channel string, seq int64, payload []byte) {
+	if s.redis == nil {
+		return
+	}
+
+	stream := realtimeStreamPrefix + channel
+	_, err := s.redis.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: stream,
+			MaxLen: RealtimeStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"seq": seq, "payload": payload},
+		})
+		pipe.Expire(context.Background(), stream, RealtimeStreamTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("[REALTIME] Erro ao gravar evento %d no stream de %s: %v", seq, channel, err)
+	}
+}
+
+// Replay retorna os eventos dos canais com sequência maior que since, em ordem.
+// completo é false quando o histórico não cobre todo o intervalo (Redis
+// indisponível ou eventos já descartados) e o cliente deve recarregar o estado.
+func (s *RealtimeService) Replay(channels []string, since int64) (payloads [][]byte, completo bool, err error) {
+	if s.redis == nil {
+		return nil, false, nil
+	}
+
+	ctx := context.Background()
+	type evento struct {
+		seq     int64
+		payload []byte
+	}
+	var eventos []evento
+	completo = true
+
+	for _, channel := range channels {
+		stream := realtimeStreamPrefix + channel
+
+		entries, err := s.redis.XRange(ctx, stream, "-", "+").Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("erro ao ler stream %s: %w", stream, err)
+		}
+
+		// Stream cheio cujo evento mais antigo é posterior a since: houve descarte
+		if len(entries) >= RealtimeStreamMaxLen && streamEntrySeq(entries[0]) > since+1 {
+			completo = false
+		}
+
+		for _, entry := range entries {
+			seq := streamEntrySeq(entry)
+			if seq <= since {
+				continue
+			}
+			payload, _ := entry.Values["payload"].(string)
+			eventos = append(eventos, evento{seq: seq, payload: []byte(payload)})
+		}
+	}
+
+	sort.Slice(eventos, func(i, j int) bool { return eventos[i].seq < eventos[j].seq })
+	for _, e := range eventos {
+		payloads = append(payloads, e.payload)
+	}
+	return payloads, completo, nil
+}
+
+// UltimaSequencia retorna a sequência mais recente emitida
+func (s *RealtimeService) UltimaSequencia() int64 {
+	if s.redis != nil {
+		if valor, err := s.redis.Get(context.Background(), realtimeSeqKey).Int64(); err == nil {
+			return valor
+		}
+	}
+	return atomic.LoadInt64(&s.localSeq)
+}
+
+func streamEntrySeq(entry redis.XMessage) int64 {
+	valor, _ := entry.Values["seq"].(string)
+	seq, _ := strconv.ParseInt(valor, 10, 64)
+	return seq
+}
+
+// PublishToUser publica um evento para todas as conexões de um usuário
+func (s *RealtimeService) PublishToUser(userID, eventType string, data interface{}) error {
+	return s.PublishMessage(RealtimeUserChannel(userID), RealtimeMessage{
+		Type:   eventType,
+		Data:   data,
+		UserID: userID,
+	})
+}
+
+// PublishToTopic publica um evento para os assinantes de um tópico
+func (s *RealtimeService) PublishToTopic(topic, eventType string, data interface{}) error {
+	return s.PublishMessage(RealtimeTopicChannel(topic), RealtimeMessage{
+		Type:  eventType,
+		Data:  data,
+		Topic: topic,
+	})
+}
+
+// PublishToAll publica um evento para todos os clientes conectados
+func (s *RealtimeService) PublishToAll(eventType string, data interface{}) error {
+	return s.PublishMessage(RealtimeBroadcastChannel, RealtimeMessage{
+		Type: eventType,
+		Data: data,
+	})
+}
+
+// Subscribe assina os canais de websocket no Redis e repassa cada evento para
+// a entrega local. Bloqueia até o contexto ser cancelado.
+func (s *RealtimeService) Subscribe(ctx context.Context) {
+	if s.redis == nil {
+		log.Printf("[REALTIME] Redis indisponível, eventos de websocket ficam restritos a esta instância")
+		return
+	}
+
+	pubsub := s.redis.PSubscribe(ctx, realtimeChannelPrefix+"*")
+	defer pubsub.Close()
+
+	log.Printf("[REALTIME] Assinatura Redis ativa (%s*)", realtimeChannelPrefix)
+	channel := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-channel:
+			if !ok {
+				return
+			}
+			s.deliverLocal(msg.Channel, []byte(msg.Payload))
+		}
+	}
+}
+
+func (s *RealtimeService) deliverLocal(channel string, payload []byte) {
+	s.mutex.RLock()
+	deliver := s.localDelivery
+	s.mutex.RUnlock()
+
+	if deliver != nil {
+		deliver(channel, payload)
+	}
+}
+
+// CriarTicket gera um ticket de uso único, válido por RealtimeTicketTTL, para
+// autenticar a conexão websocket sem expor o JWT na URL
+func (s *RealtimeService) CriarTicket(userID string, tokenExpiraEm time.Time) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("erro ao gerar ticket: %w", err)
+	}
+	ticket := hex.EncodeToString(bytes)
+	dados := RealtimeTicket{UserID: userID, TokenExpiraEm: tokenExpiraEm}
+
+	if s.redis != nil {
+		payload, err := json.Marshal(dados)
+		if err != nil {
+			return "", err
+		}
+		if err := s.redis.Set(context.Background(), realtimeTicketPrefix+ticket, payload, RealtimeTicketTTL).Err(); err != nil {
+			return "", fmt.Errorf("erro ao salvar ticket: %w", err)
+		}
+		return ticket, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	agora := time.Now()
+	for chave, t := range s.localTickets {
+		if agora.After(t.ticketExpiraEm) {
+			delete(s.localTickets, chave)
+		}
+	}
+	dados.ticketExpiraEm = agora.Add(RealtimeTicketTTL)
+	s.localTickets[ticket] = dados
+	return ticket, nil
+}
+
+// ConsumirTicket valida e invalida o ticket
+func (s *RealtimeService) ConsumirTicket(ticket string) (*RealtimeTicket, error) {
+	if ticket == "" {
+		return nil, ErrTicketInvalido
+	}
+
+	if s.redis != nil {
+		payload, err := s.redis.GetDel(context.Background(), realtimeTicketPrefix+ticket).Bytes()
+		if err != nil {
+			return nil, ErrTicketInvalido
+		}
+		var dados RealtimeTicket
+		if err := json.Unmarshal(payload, &dados); err != nil {
+			return nil, ErrTicketInvalido
+		}
+		return &dados, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dados, ok := s.localTickets[ticket]
+	delete(s.localTickets, ticket)
+	if !ok || time.Now().After(dados.ticketExpiraEm) {
+		return nil, ErrTicketInvalido
+	}
+	return &dados, nil
+}
+
+// RegistrarConexao marca (ou renova) uma conexão ativa do usuário em todas as réplicas
+func (s *RealtimeService) RegistrarConexao(userID, clientID string) {
+	if s.redis == nil {
+		return
+	}
+
+	ctx := context.Background()
+	chave := realtimeConnectionPrefix + userID
+	s.redis.ZAdd(ctx, chave, redis.Z{Score: float64(time.Now().Unix()), Member: clientID})
+	s.redis.Expire(ctx, chave, realtimeConnectionTTL)
+}
+
+// RemoverConexao remove a conexão do registro
+func (s *RealtimeService) RemoverConexao(userID, clientID string) {
+	if s.redis == nil {
+		return
+	}
+	s.redis.ZRem(context.Background(), realtimeConnectionPrefix+userID, clientID)
+}
+
+// ContarConexoes retorna as conexões ativas do usuário em todas as réplicas.
+// ok é false quando o Redis não está disponível.
+func (s *RealtimeService) ContarConexoes(userID string) (total int64, ok bool) {
+	if s.redis == nil {
+		return 0, false
+	}
+
+	ctx := context.Background()
+	chave := realtimeConnectionPrefix + userID
+	limite := time.Now().Add(-realtimeConnectionTTL).Unix()
+
+	// Descartar conexões de réplicas que pararam sem remover o registro
+	s.redis.ZRemRangeByScore(ctx, chave, "-inf", strconv.FormatInt(limite, 10))
+
+	total, err := s.redis.ZCard(ctx, chave).Result()
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
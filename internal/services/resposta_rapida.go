@@ -30,15 +30,25 @@ func max(a, b int) int {
 type RespostaRapidaService struct {
 	repo            *repositories.RespostaRapidaRepository
 	whatsappService *WhatsAppService
+	auditoria       *AuditoriaService
 }
 
-func NewRespostaRapidaService(repo *repositories.RespostaRapidaRepository, whatsappService *WhatsAppService) *RespostaRapidaService {
+func NewRespostaRapidaService(repo *repositories.RespostaRapidaRepository, whatsappService *WhatsAppService, auditoria *AuditoriaService) *RespostaRapidaService {
 	return &RespostaRapidaService{
 		repo:            repo,
 		whatsappService: whatsappService,
+		auditoria:       auditoria,
 	}
 }
 
+// comWhatsApp cópia do serviço que envia as ações pelo WhatsAppService
+// informado (ex: com a prioridade de campanha na fila de envio)
+func (s *RespostaRapidaService) comWhatsApp(whatsapp *WhatsAppService) *RespostaRapidaService {
+	copia := *s
+	copia.whatsappService = whatsapp
+	return &copia
+}
+
 // ===== CATEGORIAS =====
 
 func (s *RespostaRapidaService) CreateCategoria(usuarioID uuid.UUID, nome, descricao, cor, icone string) (*models.CategoriaResposta, error) {
@@ -180,7 +190,7 @@ func (s *RespostaRapidaService) GetRespostasRapidasByUsuario(usuarioID uuid.UUID
 
 func (s *RespostaRapidaService) UpdateRespostaRapida(resposta *models.RespostaRapida, acoesData []interface{}) (*models.RespostaRapida, error) {
 	log.Printf("[SERVICE] UpdateRespostaRapida - Resposta ID: %s, Title: %s", resposta.ID, resposta.Titulo)
-	log.Printf("[SERVICE] Trigger condition: %s", resposta.TriggerCondicao)
+	log.Printf("[SERVICE] Trigger condition set: %t", resposta.TriggerCondicao != nil)
 	log.Printf("[SERVICE] Total acoes to create: %d", len(acoesData))
 	
 	// Atualizar a resposta
@@ -494,14 +504,14 @@ func (s *RespostaRapidaService) processarExecucao(execucaoID uuid.UUID) {
 		return
 	}
 
-	// Converter usuarioID para sessionName uma vez
-	sessionName := fmt.Sprintf("user_%s", execucao.UsuarioID.String())
-	
-	// 1. Marcar conversa como vista antes de começar
-	s.whatsappService.SendSeenAntiBlock(sessionName, execucao.ChatID)
-	log.Printf("Marcou chat como visto: %s", execucao.ChatID)
+	// Resolver a sessão do chat uma vez
+	sessionName, err := s.whatsappService.NomeSessaoParaChat(execucao.UsuarioID.String(), execucao.ChatID, "")
+	if err != nil {
+		log.Printf("Erro ao resolver sessão do chat %s: %v", execucao.ChatID, err)
+		return
+	}
 
-	// Executar ações
+	// Executar ações (visto e "digitando..." ficam a cargo da fila de envio)
 	for i, acao := range execucao.RespostaRapida.Acoes {
 		if !acao.Ativo {
 			continue
@@ -513,7 +523,7 @@ func (s *RespostaRapidaService) processarExecucao(execucaoID uuid.UUID) {
 			time.Sleep(time.Duration(acao.DelaySegundos) * time.Second)
 		}
 
-		err := s.executarAcao(&acao, execucao.ChatID, execucao.UsuarioID, sessionName)
+		_, err := s.executarAcao(&acao, execucao.ChatID, execucao.UsuarioID, sessionName)
 		if err != nil {
 			log.Printf("Erro ao executar ação %s: %v", acao.ID, err)
 			
@@ -528,6 +538,14 @@ func (s *RespostaRapidaService) processarExecucao(execucaoID uuid.UUID) {
 		} else {
 			execucao.AcoesExecutadas = i + 1
 			execucao.MensagensEnviadas++
+
+			ator := AtorAutomacao(models.AtorAuditoriaRespostaRapida, execucao.RespostaRapidaID.String(), execucao.UsuarioID.String(), "")
+			s.auditoria.Registrar(ator, models.AcaoAuditoriaEnviarMensagem, "mensagem", execucao.ChatID, nil, map[string]interface{}{
+				"chatId":     execucao.ChatID,
+				"execucaoId": execucao.ID,
+				"acaoId":     acao.ID,
+				"tipo":       acao.Tipo,
+			})
 		}
 	}
 
@@ -551,11 +569,13 @@ func (s *RespostaRapidaService) processarExecucao(execucaoID uuid.UUID) {
 	s.repo.UpdateRespostaRapida(&resposta)
 }
 
-// executarAcao executa uma ação específica com fluxo completo de typing
-func (s *RespostaRapidaService) executarAcao(acao *models.AcaoResposta, chatID string, usuarioID uuid.UUID, sessionName string) error {
+// executarAcao executa uma ação específica e retorna a resposta do WAHA da
+// mensagem enviada. O visto e o "digitando..." antes de cada envio são feitos
+// pela fila de envio da sessão (prioridade de automação).
+func (s *RespostaRapidaService) executarAcao(acao *models.AcaoResposta, chatID string, usuarioID uuid.UUID, sessionName string) (interface{}, error) {
 	conteudo, err := acao.GetConteudo()
 	if err != nil {
-		return fmt.Errorf("erro ao deserializar conteúdo da ação: %w", err)
+		return nil, fmt.Errorf("erro ao deserializar conteúdo da ação: %w", err)
 	}
 
 	log.Printf("Executando ação %s do tipo %s", acao.ID, acao.Tipo)
@@ -568,36 +588,21 @@ func (s *RespostaRapidaService) executarAcao(acao *models.AcaoResposta, chatID s
 		// Tentar primeiro "mensagem", depois "texto" (compatibilidade)
 		if mensagem, ok = conteudo["mensagem"].(string); !ok {
 			if mensagem, ok = conteudo["texto"].(string); !ok {
-				return fmt.Errorf("mensagem ou texto não encontrado no conteúdo da ação")
+				return nil, fmt.Errorf("mensagem ou texto não encontrado no conteúdo da ação")
 			}
 		}
 		
 		// Processar variáveis se necessário
 		mensagem = s.processarVariaveis(mensagem, chatID, usuarioID)
 		
-		// FLUXO ANTI-BLOQUEIO: Seguir boas práticas WAHA
-		// 1. Começar a digitar
-		s.whatsappService.StartTyping(sessionName, chatID)
-		log.Printf("Iniciou typing para texto: %s", mensagem[:min(50, len(mensagem))])
-		
-		// 2. Calcular delay baseado no tamanho da mensagem (50ms por char, min 1s, max 5s)
-		typingDelay := time.Duration(max(min(len(mensagem)*50, 5000), 1000)) * time.Millisecond
-		time.Sleep(typingDelay)
-		
-		// 3. Parar de digitar
-		s.whatsappService.StopTyping(sessionName, chatID)
-		log.Printf("Parou typing após %v", typingDelay)
-		
-		// 4. Enviar mensagem
-		_, err := s.whatsappService.SendMessage(sessionName, chatID, mensagem)
-		return err
+		return s.whatsappService.SendMessage(sessionName, chatID, mensagem)
 
 	case models.AcaoImagem:
 		// Tentar primeiro "url", depois "arquivo_url" (compatibilidade)
 		arquivoURL, ok := conteudo["url"].(string)
 		if !ok {
 			if arquivoURL, ok = conteudo["arquivo_url"].(string); !ok {
-				return fmt.Errorf("url ou arquivo_url não encontrado no conteúdo da ação")
+				return nil, fmt.Errorf("url ou arquivo_url não encontrado no conteúdo da ação")
 			}
 		}
 		
@@ -607,47 +612,25 @@ func (s *RespostaRapidaService) executarAcao(acao *models.AcaoResposta, chatID s
 			legenda, _ = conteudo["legenda"].(string)
 		}
 		
-		// FLUXO ANTI-BLOQUEIO para imagem
-		s.whatsappService.StartTyping(sessionName, chatID)
-		log.Printf("Iniciou typing para imagem: %s", arquivoURL)
-		
-		// Delay padrão de 2 segundos para imagem
-		time.Sleep(2 * time.Second)
-		
-		s.whatsappService.StopTyping(sessionName, chatID)
-		log.Printf("Parou typing, enviando imagem")
-		
-		_, err := s.whatsappService.SendImage(sessionName, chatID, arquivoURL, legenda)
-		return err
+		return s.whatsappService.SendImage(sessionName, chatID, arquivoURL, legenda)
 
 	case models.AcaoAudio:
 		// Para áudio, tentar primeiro "url", depois "arquivo_url"
 		arquivoURL, ok := conteudo["url"].(string)
 		if !ok {
 			if arquivoURL, ok = conteudo["arquivo_url"].(string); !ok {
-				return fmt.Errorf("url ou arquivo_url não encontrado para áudio")
+				return nil, fmt.Errorf("url ou arquivo_url não encontrado para áudio")
 			}
 		}
 		
-		// FLUXO ANTI-BLOQUEIO para áudio
-		s.whatsappService.StartTyping(sessionName, chatID)
-		log.Printf("Iniciou typing para áudio: %s", arquivoURL)
-		
-		// Delay padrão de 3 segundos para áudio (mais tempo para "gravar")
-		time.Sleep(3 * time.Second)
-		
-		s.whatsappService.StopTyping(sessionName, chatID)
-		log.Printf("Parou typing, enviando áudio")
-		
-		_, err := s.whatsappService.SendVoice(sessionName, chatID, arquivoURL)
-		return err
+		return s.whatsappService.SendVoice(sessionName, chatID, arquivoURL)
 
 	case models.AcaoVideo:
 		// Tentar primeiro "url", depois "arquivo_url" (compatibilidade)
 		arquivoURL, ok := conteudo["url"].(string)
 		if !ok {
 			if arquivoURL, ok = conteudo["arquivo_url"].(string); !ok {
-				return fmt.Errorf("url ou arquivo_url não encontrado no conteúdo da ação")
+				return nil, fmt.Errorf("url ou arquivo_url não encontrado no conteúdo da ação")
 			}
 		}
 		
@@ -657,25 +640,14 @@ func (s *RespostaRapidaService) executarAcao(acao *models.AcaoResposta, chatID s
 			legenda, _ = conteudo["legenda"].(string)
 		}
 		
-		// FLUXO ANTI-BLOQUEIO para vídeo
-		s.whatsappService.StartTyping(sessionName, chatID)
-		log.Printf("Iniciou typing para vídeo: %s", arquivoURL)
-		
-		// Delay padrão de 4 segundos para vídeo (mais tempo para "gravar")
-		time.Sleep(4 * time.Second)
-		
-		s.whatsappService.StopTyping(sessionName, chatID)
-		log.Printf("Parou typing, enviando vídeo")
-		
-		_, err := s.whatsappService.SendVideo(sessionName, chatID, arquivoURL, legenda)
-		return err
+		return s.whatsappService.SendVideo(sessionName, chatID, arquivoURL, legenda)
 
 	case models.AcaoArquivo:
 		// Tentar primeiro "url", depois "arquivo_url" (compatibilidade)
 		arquivoURL, ok := conteudo["url"].(string)
 		if !ok {
 			if arquivoURL, ok = conteudo["arquivo_url"].(string); !ok {
-				return fmt.Errorf("url ou arquivo_url não encontrado no conteúdo da ação")
+				return nil, fmt.Errorf("url ou arquivo_url não encontrado no conteúdo da ação")
 			}
 		}
 		
@@ -686,34 +658,23 @@ func (s *RespostaRapidaService) executarAcao(acao *models.AcaoResposta, chatID s
 		}
 		legenda, _ := conteudo["legenda"].(string)
 		
-		// FLUXO ANTI-BLOQUEIO para arquivo
-		s.whatsappService.StartTyping(sessionName, chatID)
-		log.Printf("Iniciou typing para arquivo: %s", filename)
-		
-		// Delay padrão de 2 segundos para arquivo
-		time.Sleep(2 * time.Second)
-		
-		s.whatsappService.StopTyping(sessionName, chatID)
-		log.Printf("Parou typing, enviando arquivo")
-		
-		_, err := s.whatsappService.SendFile(sessionName, chatID, arquivoURL, filename, legenda)
-		return err
+		return s.whatsappService.SendFile(sessionName, chatID, arquivoURL, filename, legenda)
 
 	case models.AcaoPix:
 		// TODO: Implementar geração de PIX
-		return fmt.Errorf("geração de PIX não implementada ainda")
+		return nil, fmt.Errorf("geração de PIX não implementada ainda")
 
 	case models.AcaoDelay:
 		segundos, ok := conteudo["segundos"].(float64)
 		if !ok {
-			return fmt.Errorf("segundos não especificados para delay")
+			return nil, fmt.Errorf("segundos não especificados para delay")
 		}
 		
 		time.Sleep(time.Duration(segundos) * time.Second)
-		return nil
+		return nil, nil
 
 	default:
-		return fmt.Errorf("tipo de ação não suportado: %s", acao.Tipo)
+		return nil, fmt.Errorf("tipo de ação não suportado: %s", acao.Tipo)
 	}
 }
 
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCategoriaMidiaInvalida     = errors.New("categoria de mídia inválida")
+	ErrRetencaoMidiaInvalida      = errors.New("a retenção deve ser de pelo menos 1 dia")
+	ErrEntidadeVinculoInvalida    = errors.New("entidade do vínculo deve ser orcamento ou contrato")
+	ErrEntidadeVinculoInexistente = errors.New("orçamento ou contrato não encontrado na organização")
+	ErrVinculoMidiaNaoEncontrado  = errors.New("vínculo da mídia não encontrado")
+)
+
+// Mídias removidas por vez na limpeza
+const loteRetencaoMidia = 200
+
+// RetencaoMidiaService aplica as políticas de retenção de mídia por
+// organização e mantém os vínculos que protegem mídias da limpeza
+type RetencaoMidiaService struct {
+	db        *gorm.DB
+	midias    *MidiaService
+	simulacao bool // limpeza agendada apenas em simulação
+	stop      chan struct{}
+}
+
+func NewRetencaoMidiaService(db *gorm.DB, midias *MidiaService, cfg *config.Config) *RetencaoMidiaService {
+	return &RetencaoMidiaService{
+		db:        db,
+		midias:    midias,
+		simulacao: cfg.MediaRetentionDryRun,
+	}
+}
+
+// Iniciar executa a limpeza das organizações com política ativa a cada intervalo
+func (s *RetencaoMidiaService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[RETENCAO_MIDIA] Limpeza agendada iniciada (intervalo: %s, simulação: %t)", intervalo, s.simulacao)
+		for {
+			select {
+			case <-ticker.C:
+				s.executarAgendada()
+			case <-s.stop:
+				log.Printf("[RETENCAO_MIDIA] Limpeza agendada finalizada")
+				return
+			}
+		}
+	}()
+}
+
+// Parar interrompe a limpeza agendada
+func (s *RetencaoMidiaService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *RetencaoMidiaService) executarAgendada() {
+	var organizacoes []string
+	err := s.db.Model(&models.PoliticaRetencaoMidia{}).
+		Where("ativa = ?", true).
+		Distinct().
+		Pluck("organizacao_id", &organizacoes).Error
+	if err != nil {
+		log.Printf("[RETENCAO_MIDIA] Erro ao listar organizações com retenção: %v", err)
+		return
+	}
+
+	for _, organizacaoID := range organizacoes {
+		execucao, err := s.Executar(organizacaoID, s.simulacao, true)
+		if err != nil {
+			log.Printf("[RETENCAO_MIDIA] Erro na limpeza da organização %s: %v", organizacaoID, err)
+			continue
+		}
+		if execucao.Midias > 0 {
+			log.Printf("[RETENCAO_MIDIA] Organização %s: %d mídias (%d bytes) expiradas (simulação: %t)",
+				organizacaoID, execucao.Midias, execucao.BytesLiberados, execucao.Simulacao)
+		}
+	}
+}
+
+// ListarPoliticas políticas de retenção da organização
+func (s *RetencaoMidiaService) ListarPoliticas(organizacaoID string) ([]models.PoliticaRetencaoMidia, error) {
+	politicas := []models.PoliticaRetencaoMidia{}
+	err := s.db.Where("organizacao_id = ?", organizacaoID).Order("categoria ASC").Find(&politicas).Error
+	return politicas, err
+}
+
+// PoliticaRetencaoMidiaRequest retenção de uma categoria
+type PoliticaRetencaoMidiaRequest struct {
+	Categoria    models.CategoriaMidia `json:"categoria" binding:"required"`
+	DiasRetencao int                   `json:"diasRetencao"`
+	Ativa        *bool                 `json:"ativa"`
+}
+
+// DefinirPoliticas substitui as políticas da organização; categorias fora da
+// lista deixam de expirar
+func (s *RetencaoMidiaService) DefinirPoliticas(organizacaoID string, req []PoliticaRetencaoMidiaRequest) ([]models.PoliticaRetencaoMidia, error) {
+	politicas := make([]models.PoliticaRetencaoMidia, 0, len(req))
+	categorias := make([]models.CategoriaMidia, 0, len(req))
+	for _, item := range req {
+		if !categoriaMidiaValida(item.Categoria) {
+			return nil, ErrCategoriaMidiaInvalida
+		}
+		if item.DiasRetencao < 1 {
+			return nil, ErrRetencaoMidiaInvalida
+		}
+		ativa := item.Ativa == nil || *item.Ativa
+		politicas = append(politicas, models.PoliticaRetencaoMidia{
+			OrganizacaoID: organizacaoID,
+			Categoria:     item.Categoria,
+			DiasRetencao:  item.DiasRetencao,
+			Ativa:         ativa,
+		})
+		categorias = append(categorias, item.Categoria)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		remover := tx.Where("organizacao_id = ?", organizacaoID)
+		if len(categorias) > 0 {
+			remover = remover.Where("categoria NOT IN ?", categorias)
+		}
+		if err := remover.Delete(&models.PoliticaRetencaoMidia{}).Error; err != nil {
+			return err
+		}
+
+		for i := range politicas {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "organizacao_id"}, {Name: "categoria"}},
+				DoUpdates: clause.AssignmentColumns([]string{"dias_retencao", "ativa", "atualizado_em"}),
+			}).Create(&politicas[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao salvar políticas de retenção: %w", err)
+	}
+	return s.ListarPoliticas(organizacaoID)
+}
+
+// Executar aplica as políticas ativas da organização. Em simulação apenas
+// soma o que seria removido. Mídias de mensagens favoritas e vinculadas a
+// orçamentos ou contratos são mantidas.
+func (s *RetencaoMidiaService) Executar(organizacaoID string, simulacao, agendada bool) (*models.ExecucaoRetencaoMidia, error) {
+	var politicas []models.PoliticaRetencaoMidia
+	if err := s.db.Where("organizacao_id = ? AND ativa = ?", organizacaoID, true).Find(&politicas).Error; err != nil {
+		return nil, fmt.Errorf("erro ao buscar políticas de retenção: %w", err)
+	}
+
+	execucao := &models.ExecucaoRetencaoMidia{
+		OrganizacaoID: organizacaoID,
+		Simulacao:     simulacao,
+		Agendada:      agendada,
+	}
+	if err := s.db.Create(execucao).Error; err != nil {
+		return nil, fmt.Errorf("erro ao registrar execução de retenção: %w", err)
+	}
+
+	detalhes := make([]UsoCategoriaMidia, 0, len(politicas))
+	var falha error
+	for _, politica := range politicas {
+		limite := time.Now().AddDate(0, 0, -politica.DiasRetencao)
+		total := UsoCategoriaMidia{Categoria: politica.Categoria}
+
+		if simulacao {
+			falha = s.expiradas(organizacaoID, politica.Categoria, limite).
+				Select("COUNT(*), COALESCE(SUM(midias.tamanho), 0)").
+				Row().Scan(&total.Midias, &total.Bytes)
+		} else {
+			falha = s.removerExpiradas(organizacaoID, politica.Categoria, limite, &total)
+		}
+
+		detalhes = append(detalhes, total)
+		execucao.Midias += total.Midias
+		execucao.BytesLiberados += total.Bytes
+		if falha != nil {
+			break
+		}
+	}
+
+	agora := time.Now()
+	execucao.FinalizadaEm = &agora
+	execucao.Detalhes, _ = json.Marshal(detalhes)
+	if falha != nil {
+		mensagem := falha.Error()
+		execucao.Erro = &mensagem
+	}
+	if err := s.db.Save(execucao).Error; err != nil {
+		log.Printf("[RETENCAO_MIDIA] Erro ao salvar execução %s: %v", execucao.ID, err)
+	}
+	if falha != nil {
+		return execucao, fmt.Errorf("erro ao aplicar retenção: %w", falha)
+	}
+	return execucao, nil
+}
+
+// removerExpiradas apaga em lotes as mídias expiradas da categoria
+func (s *RetencaoMidiaService) removerExpiradas(organizacaoID string, categoria models.CategoriaMidia, limite time.Time, total *UsoCategoriaMidia) error {
+	for {
+		var lote []models.Midia
+		err := s.expiradas(organizacaoID, categoria, limite).
+			Order("midias.ultimo_uso_em ASC").
+			Limit(loteRetencaoMidia).
+			Find(&lote).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range lote {
+			if err := s.midias.Expirar(&lote[i]); err != nil {
+				return err
+			}
+			total.Midias++
+			total.Bytes += lote[i].Tamanho
+		}
+		if len(lote) < loteRetencaoMidia {
+			return nil
+		}
+	}
+}
+
+// expiradas mídias da categoria sem uso desde o limite e sem proteção
+func (s *RetencaoMidiaService) expiradas(organizacaoID string, categoria models.CategoriaMidia, limite time.Time) *gorm.DB {
+	return s.db.Model(&models.Midia{}).
+		Where("midias.organizacao_id = ? AND midias.ultimo_uso_em < ?", organizacaoID, limite).
+		Where(sqlCategoriaMidia+" = ?", string(categoria)).
+		Where("NOT EXISTS (SELECT 1 FROM mensagens WHERE mensagens.midia_id = midias.id AND mensagens.favorita = ?)", true).
+		Where("NOT EXISTS (SELECT 1 FROM vinculos_midia WHERE vinculos_midia.midia_id = midias.id)")
+}
+
+// ListarExecucoes últimas limpezas da organização
+func (s *RetencaoMidiaService) ListarExecucoes(organizacaoID string, limite int) ([]models.ExecucaoRetencaoMidia, error) {
+	if limite <= 0 || limite > 100 {
+		limite = 20
+	}
+	execucoes := []models.ExecucaoRetencaoMidia{}
+	err := s.db.Where("organizacao_id = ?", organizacaoID).
+		Order("criado_em DESC").
+		Limit(limite).
+		Find(&execucoes).Error
+	return execucoes, err
+}
+
+// Vincular protege a mídia da retenção enquanto o orçamento ou contrato a usar
+func (s *RetencaoMidiaService) Vincular(midia *models.Midia, entidade, entidadeID, usuarioID string) (*models.VinculoMidia, error) {
+	existe, err := s.entidadeDaOrganizacao(midia.OrganizacaoID, entidade, entidadeID)
+	if err != nil {
+		return nil, err
+	}
+	if !existe {
+		return nil, ErrEntidadeVinculoInexistente
+	}
+
+	vinculo := models.VinculoMidia{
+		MidiaID:       midia.ID,
+		OrganizacaoID: midia.OrganizacaoID,
+		Entidade:      entidade,
+		EntidadeID:    entidadeID,
+	}
+	if usuarioID != "" {
+		vinculo.UsuarioID = &usuarioID
+	}
+
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&vinculo).Error; err != nil {
+		return nil, fmt.Errorf("erro ao vincular mídia: %w", err)
+	}
+	err = s.db.Where("midia_id = ? AND entidade = ? AND entidade_id = ?", midia.ID, entidade, entidadeID).First(&vinculo).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar vínculo da mídia: %w", err)
+	}
+	return &vinculo, nil
+}
+
+// ListarVinculos orçamentos e contratos que usam a mídia
+func (s *RetencaoMidiaService) ListarVinculos(midiaID string) ([]models.VinculoMidia, error) {
+	vinculos := []models.VinculoMidia{}
+	err := s.db.Where("midia_id = ?", midiaID).Order("criado_em ASC").Find(&vinculos).Error
+	return vinculos, err
+}
+
+// Desvincular remove o vínculo; a mídia volta a seguir a retenção
+func (s *RetencaoMidiaService) Desvincular(midiaID, vinculoID string) (*models.VinculoMidia, error) {
+	var vinculo models.VinculoMidia
+	if err := s.db.Where("id = ? AND midia_id = ?", vinculoID, midiaID).First(&vinculo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVinculoMidiaNaoEncontrado
+		}
+		return nil, err
+	}
+	if err := s.db.Delete(&vinculo).Error; err != nil {
+		return nil, err
+	}
+	return &vinculo, nil
+}
+
+// entidadeDaOrganizacao confere se o orçamento ou contrato pertence a um
+// usuário da organização
+func (s *RetencaoMidiaService) entidadeDaOrganizacao(organizacaoID, entidade, entidadeID string) (bool, error) {
+	var tabela string
+	switch entidade {
+	case models.EntidadeVinculoOrcamento:
+		tabela = "orcamentos"
+	case models.EntidadeVinculoContrato:
+		tabela = "contratos"
+		// A tabela de contratos só existe nas instalações que a criaram
+		if !s.db.Migrator().HasTable(tabela) {
+			return false, nil
+		}
+	default:
+		return false, ErrEntidadeVinculoInvalida
+	}
+	if _, err := uuid.Parse(entidadeID); err != nil {
+		return false, nil
+	}
+
+	var total int64
+	err := s.db.Table(tabela).
+		Joins("JOIN usuarios ON usuarios.id = "+tabela+".usuario_id").
+		Where(tabela+".id = ? AND usuarios.organizacao_id = ?", entidadeID, organizacaoID).
+		Count(&total).Error
+	if err != nil {
+		return false, fmt.Errorf("erro ao buscar %s: %w", entidade, err)
+	}
+	return total > 0, nil
+}
+
+func categoriaMidiaValida(categoria models.CategoriaMidia) bool {
+	for _, valida := range models.CategoriasMidia {
+		if categoria == valida {
+			return true
+		}
+	}
+	return false
+}
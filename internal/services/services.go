@@ -16,6 +16,7 @@ import (
 
 	"tappyone/internal/config"
 	"tappyone/internal/models"
+	"tappyone/internal/repositories"
 
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -67,6 +68,24 @@ func (s *UserService) GetByID(id string) (*models.Usuario, error) {
 	return &usuario, nil
 }
 
+// GetByIDNaOrganizacao busca o usuário apenas dentro da organização informada
+func (s *UserService) GetByIDNaOrganizacao(organizacaoID, id string) (*models.Usuario, error) {
+	var usuario models.Usuario
+	if err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).First(&usuario, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &usuario, nil
+}
+
+// GetPapelByID busca um papel personalizado da organização
+func (s *UserService) GetPapelByID(organizacaoID, id string) (*models.Papel, error) {
+	var papel models.Papel
+	if err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).First(&papel, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &papel, nil
+}
+
 func (s *UserService) Create(usuario *models.Usuario) error {
 	return s.db.Create(usuario).Error
 }
@@ -75,10 +94,11 @@ func (s *UserService) Update(usuario *models.Usuario) error {
 	return s.db.Save(usuario).Error
 }
 
-// ListUsers lista usuários com filtros
-func (s *UserService) ListUsers(currentUserID, tipo, status, search string) ([]models.Usuario, error) {
+// ListUsers lista usuários da organização com filtros
+func (s *UserService) ListUsers(organizacaoID, currentUserID, tipo, status, search string) ([]models.Usuario, error) {
 	var usuarios []models.Usuario
-	query := s.db.Where("id != ?", currentUserID) // Excluir usuário atual
+	query := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("id != ?", currentUserID) // Excluir usuário atual
 
 	// Filtrar por tipo se especificado
 	if tipo != "" && tipo != "todos" {
@@ -96,7 +116,7 @@ func (s *UserService) ListUsers(currentUserID, tipo, status, search string) ([]m
 
 	// Busca por nome ou email
 	if search != "" {
-		query = query.Where("nome ILIKE ? OR email ILIKE ?", "%"+search+"%", "%"+search+"%")
+		query = query.Where("(nome ILIKE ? OR email ILIKE ?)", "%"+search+"%", "%"+search+"%")
 	}
 
 	// Ordenar por nome
@@ -165,9 +185,14 @@ func (s *UserService) GetByEmail(email string) (*models.Usuario, error) {
 
 // WhatsAppService gerencia integração com WhatsApp
 type WhatsAppService struct {
-	db     *gorm.DB
-	config *config.Config
-	client *http.Client
+	db      *gorm.DB
+	config  *config.Config
+	client  *http.Client
+	sessoes *repositories.SessaoWhatsAppRepository
+
+	// Fila de envio por sessão; prioridade dos envios feitos por esta instância
+	agendador  *AgendadorEnvios
+	prioridade PrioridadeEnvio
 }
 
 func NewWhatsAppService(db *gorm.DB, config *config.Config) *WhatsAppService {
@@ -177,9 +202,47 @@ func NewWhatsAppService(db *gorm.DB, config *config.Config) *WhatsAppService {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		sessoes: repositories.NewSessaoWhatsAppRepository(db),
 	}
 }
 
+// DefinirAgendador liga a fila de envio por sessão (limites anti-banimento).
+// Deve ser chamado antes de ComPrioridade para que as cópias compartilhem a fila.
+func (s *WhatsAppService) DefinirAgendador(agendador *AgendadorEnvios) {
+	s.agendador = agendador
+}
+
+// ComPrioridade cópia do serviço cujos envios entram na fila da sessão com a
+// prioridade informada (automações e campanhas). O serviço original envia
+// como atendente.
+func (s *WhatsAppService) ComPrioridade(prioridade PrioridadeEnvio) *WhatsAppService {
+	copia := *s
+	copia.prioridade = prioridade
+	return &copia
+}
+
+// prepararEnvio aguarda a vez da mensagem na fila da sessão. Nas automações
+// repete o que um atendente faria: marca a conversa como vista e mostra
+// "digitando..." pelo tempo proporcional ao conteúdo.
+func (s *WhatsAppService) prepararEnvio(sessionName, chatID string, digitacao time.Duration) error {
+	if s.agendador != nil {
+		if err := s.agendador.Aguardar(sessionName, chatID, s.prioridade); err != nil {
+			return err
+		}
+	}
+	if s.prioridade == PrioridadeEnvioAtendente {
+		return nil
+	}
+
+	if s.agendador == nil || s.agendador.marcarVisto(sessionName, chatID) {
+		s.SendSeenAntiBlock(sessionName, chatID)
+	}
+	s.StartTyping(sessionName, chatID)
+	time.Sleep(digitacao)
+	s.StopTyping(sessionName, chatID)
+	return nil
+}
+
 func (s *WhatsAppService) GetDB() *gorm.DB {
 	return s.db
 }
@@ -474,6 +537,10 @@ func (s *WhatsAppService) SetPresence(sessionName, chatID, presence string) erro
 
 // SendVoiceMessage envia mensagem de voz via WAHA API usando base64
 func (s *WhatsAppService) SendVoiceMessage(sessionName, chatID string, audioFile []byte, filename string) error {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoAudio); err != nil {
+		return err
+	}
+
 	log.Printf("[WHATSAPP] POST /sendVoice - Sending voice message to chat: %s", chatID)
 
 	// Converter para base64
@@ -528,12 +595,16 @@ func (s *WhatsAppService) sendVoiceFallback(sessionName, chatID string) error {
 	fallbackMessage := "🎤 *Mensagem de Áudio*\n\n_Não foi possível reproduzir o áudio. Tente novamente._"
 
 	// Enviar como texto
-	_, err := s.SendMessage(sessionName, chatID, fallbackMessage)
+	_, err := s.enviarTexto(sessionName, chatID, fallbackMessage)
 	return err
 }
 
 // SendImageMessage envia imagem via WAHA API
 func (s *WhatsAppService) SendImageMessage(sessionName, chatID string, imageFile []byte, filename, caption string) error {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoImagem); err != nil {
+		return err
+	}
+
 	log.Printf("[WHATSAPP] POST /sendImage - Sending image to chat: %s", chatID)
 
 	// Codificar arquivo em base64
@@ -583,6 +654,10 @@ func (s *WhatsAppService) SendImageMessage(sessionName, chatID string, imageFile
 
 // SendFileMessage envia arquivo via WAHA API
 func (s *WhatsAppService) SendFileMessage(sessionName, chatID string, fileData []byte, filename, caption string) error {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoArquivo); err != nil {
+		return err
+	}
+
 	log.Printf("[WHATSAPP] POST /sendFile - Sending file to chat: %s", chatID)
 
 	// Codificar arquivo em base64
@@ -646,6 +721,10 @@ func (s *WhatsAppService) SendFileMessage(sessionName, chatID string, fileData [
 
 // SendVideoMessage envia vídeo via WAHA API
 func (s *WhatsAppService) SendVideoMessage(sessionName, chatID string, videoFile []byte, filename, caption string) error {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoVideo); err != nil {
+		return err
+	}
+
 	log.Printf("[WHATSAPP] POST /sendVideo - Sending video to chat: %s", chatID)
 
 	// Codificar arquivo em base64
@@ -844,6 +923,15 @@ func (s *WhatsAppService) GetChatMessages(sessionName, chatID string, limit int,
 }
 
 func (s *WhatsAppService) SendMessage(sessionName, chatID, text string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoTexto(text)); err != nil {
+		return nil, err
+	}
+	return s.enviarTexto(sessionName, chatID, text)
+}
+
+// enviarTexto envia o texto sem passar pela fila (fallbacks de um envio que já
+// teve a vez liberada)
+func (s *WhatsAppService) enviarTexto(sessionName, chatID, text string) (interface{}, error) {
 	// Endpoint correto da WAHA API: /sendText (sem /api/ pois já está na base URL)
 	endpoint := "/sendText"
 	body := map[string]string{
@@ -883,6 +971,10 @@ func (s *WhatsAppService) SendMessage(sessionName, chatID, text string) (interfa
 
 // SendReplyMessage envia mensagem como reply a outra mensagem
 func (s *WhatsAppService) SendReplyMessage(sessionName, chatID, text, replyToMessageID string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoTexto(text)); err != nil {
+		return nil, err
+	}
+
 	endpoint := "/sendText"
 	body := map[string]interface{}{
 		"session":  sessionName,
@@ -921,6 +1013,10 @@ func (s *WhatsAppService) SendReplyMessage(sessionName, chatID, text, replyToMes
 
 // SendMessageWithMentions envia mensagem com menções em grupos
 func (s *WhatsAppService) SendMessageWithMentions(sessionName, chatID, text string, mentions []string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoTexto(text)); err != nil {
+		return nil, err
+	}
+
 	endpoint := "/sendText"
 	body := map[string]interface{}{
 		"session":  sessionName,
@@ -959,6 +1055,10 @@ func (s *WhatsAppService) SendMessageWithMentions(sessionName, chatID, text stri
 
 // ForwardMessage encaminha mensagem para outro chat
 func (s *WhatsAppService) ForwardMessage(sessionName, toChatID, messageID string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, toChatID, digitacaoOutros); err != nil {
+		return nil, err
+	}
+
 	endpoint := "/forwardMessage"
 	body := map[string]interface{}{
 		"session":   sessionName,
@@ -1122,6 +1222,11 @@ func (s *WhatsAppService) StarMessage(sessionName, messageID string, star bool)
 		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(errorBody))
 	}
 
+	// Espelhar no histórico local: mídias de mensagens favoritas não expiram pela retenção
+	if err := s.db.Model(&models.Mensagem{}).Where("id_mensagem = ?", messageID).Update("favorita", star).Error; err != nil {
+		log.Printf("[WHATSAPP] StarMessage - Erro ao atualizar favorita da mensagem %s: %v", messageID, err)
+	}
+
 	// Ler o corpo da resposta
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -1181,6 +1286,10 @@ func (s *WhatsAppService) SendSeen(sessionName, chatID string, messageIDs []stri
 
 // SendContactVcard envia um contato via vCard, com fallback para texto
 func (s *WhatsAppService) SendContactVcard(sessionName, chatID, contactID, name string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoOutros); err != nil {
+		return nil, err
+	}
+
 	log.Printf("[WHATSAPP] SendContactVcard - sessionName: %s, chatID: %s, contactID: %s, name: %s", sessionName, chatID, contactID, name)
 
 	// Primeiro tenta o endpoint nativo /sendContact
@@ -1268,6 +1377,10 @@ func (s *WhatsAppService) SendContactVcard(sessionName, chatID, contactID, name
 
 // SendLocation envia uma localização, com fallback para texto se não suportado
 func (s *WhatsAppService) SendLocation(sessionName, chatID string, latitude, longitude float64, title, address string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoOutros); err != nil {
+		return nil, err
+	}
+
 	log.Printf("[WHATSAPP] SendLocation - sessionName: %s, chatID: %s, lat: %f, lng: %f, title: %s", sessionName, chatID, latitude, longitude, title)
 
 	// Primeiro tenta o endpoint nativo /sendLocation
@@ -1353,6 +1466,10 @@ func (s *WhatsAppService) SendLocation(sessionName, chatID string, latitude, lon
 
 // SendPoll envia uma enquete com fallback para sendText
 func (s *WhatsAppService) SendPoll(sessionName, chatID, name string, options []string, multipleAnswers bool) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoOutros); err != nil {
+		return nil, err
+	}
+
 	// Tentar primeiro com /sendPoll
 	endpoint := "/sendPoll"
 	body := map[string]interface{}{
@@ -1629,6 +1746,10 @@ func (s *WhatsAppService) SetTyping(sessionName, chatID, presence string) (inter
 
 // SendImage envia uma imagem
 func (s *WhatsAppService) SendImage(sessionName, chatID, imageURL, caption string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoImagem); err != nil {
+		return nil, err
+	}
+
 	endpoint := "/sendImage"
 	body := map[string]interface{}{
 		"session": sessionName,
@@ -1668,6 +1789,10 @@ func (s *WhatsAppService) SendImage(sessionName, chatID, imageURL, caption strin
 
 // SendFile envia um arquivo
 func (s *WhatsAppService) SendFile(sessionName, chatID, fileURL, filename, caption string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoArquivo); err != nil {
+		return nil, err
+	}
+
 	endpoint := "/sendFile"
 	body := map[string]interface{}{
 		"session": sessionName,
@@ -1708,6 +1833,10 @@ func (s *WhatsAppService) SendFile(sessionName, chatID, fileURL, filename, capti
 
 // SendVoice envia um áudio (método corrigido com configurações dos testes)
 func (s *WhatsAppService) SendVoice(sessionName, chatID, audioURL string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoAudio); err != nil {
+		return nil, err
+	}
+
 	log.Printf("[WHATSAPP] POST /sendVoice - Sending voice via URL to chat: %s", chatID)
 
 	payload := map[string]interface{}{
@@ -1748,6 +1877,10 @@ func (s *WhatsAppService) SendVoice(sessionName, chatID, audioURL string) (inter
 
 // SendVideo envia um vídeo com configurações dos testes funcionais
 func (s *WhatsAppService) SendVideo(sessionName, chatID, videoURL, caption string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoVideo); err != nil {
+		return nil, err
+	}
+
 	log.Printf("[WHATSAPP] POST /sendVideo - Sending video via URL to chat: %s", chatID)
 
 	payload := map[string]interface{}{
@@ -1785,7 +1918,7 @@ func (s *WhatsAppService) SendVideo(sessionName, chatID, videoURL, caption strin
 		fallbackMessage += "\n\n📎 Link: " + videoURL
 
 		// Enviar como texto
-		return s.SendMessage(sessionName, chatID, fallbackMessage)
+		return s.enviarTexto(sessionName, chatID, fallbackMessage)
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
@@ -1806,6 +1939,10 @@ func (s *WhatsAppService) SendVideo(sessionName, chatID, videoURL, caption strin
 
 // SendVoiceFile envia áudio diretamente como arquivo
 func (s *WhatsAppService) SendVoiceFile(sessionName, chatID, filePath string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoAudio); err != nil {
+		return nil, err
+	}
+
 	// Abrir o arquivo
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -2322,33 +2459,81 @@ func (s *MessageService) GetMessagesByChat(chatID string) ([]models.Mensagem, er
 // AIService gerencia integração com IA
 type AIService struct {
 	config *config.Config
+	client *http.Client
 }
 
 func NewAIService(config *config.Config) *AIService {
-	return &AIService{config: config}
+	return &AIService{
+		config: config,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
 }
 
-func (s *AIService) GenerateResponse(prompt string, context string) (string, error) {
-	// TODO: Implementar integração com DeepSeek API
-	return "Resposta automática da IA", nil
+// Configurado indica se há chave da DeepSeek configurada
+func (s *AIService) Configurado() bool {
+	return s.config.DeepSeekAPIKey != ""
 }
 
-// EmailService gerencia envio de emails
-type EmailService struct {
-	config *config.Config
-}
+// GenerateResponse gera uma resposta pela API de chat da DeepSeek, usando o
+// prompt como instrução de sistema e o contexto como mensagem do usuário
+func (s *AIService) GenerateResponse(prompt string, context string) (string, error) {
+	if !s.Configurado() {
+		return "", fmt.Errorf("DEEPSEEK_API_KEY não configurada")
+	}
 
-func NewEmailService(config *config.Config) *EmailService {
-	return &EmailService{config: config}
-}
+	body, err := json.Marshal(map[string]interface{}{
+		"model": "deepseek-chat",
+		"messages": []map[string]string{
+			{"role": "system", "content": prompt},
+			{"role": "user", "content": context},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
 
-func (s *EmailService) SendEmail(to, subject, body string) error {
-	// TODO: Implementar envio de email via SMTP
-	return nil
+	url := strings.TrimSuffix(s.config.DeepSeekAPIURL, "/") + "/chat/completions"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.config.DeepSeekAPIKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("erro ao chamar DeepSeek: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		erro, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("DeepSeek retornou status %d: %s", resp.StatusCode, string(erro))
+	}
+
+	var resultado struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&resultado); err != nil {
+		return "", fmt.Errorf("erro ao decodificar resposta da DeepSeek: %w", err)
+	}
+	if len(resultado.Choices) == 0 {
+		return "", fmt.Errorf("DeepSeek não retornou resposta")
+	}
+
+	return strings.TrimSpace(resultado.Choices[0].Message.Content), nil
 }
 
 // SendContact envia um contato via WAHA API
 func (s *WhatsAppService) SendContact(sessionName, chatID, contactId, contactName string) (interface{}, error) {
+	if err := s.prepararEnvio(sessionName, chatID, digitacaoOutros); err != nil {
+		return nil, err
+	}
+
 	endpoint := "/sendContactVcard"
 	body := map[string]interface{}{
 		"session":     sessionName,
@@ -2392,7 +2577,7 @@ func (s *WhatsAppService) sendContactAsText(sessionName, chatID, contactId, cont
 
 	text := fmt.Sprintf("📞 *Contato*\n\n*Nome:* %s\n*Telefone:* %s", contactName, contactId)
 
-	return s.SendMessage(sessionName, chatID, text)
+	return s.enviarTexto(sessionName, chatID, text)
 }
 
 // ArchiveChat arquiva um chat
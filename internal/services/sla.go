@@ -0,0 +1,580 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SLAService calcula prazos de atendimento e escalona violações de SLA
+type SLAService struct {
+	db           *gorm.DB
+	emailService *EmailService
+	stop         chan struct{}
+}
+
+// FiltroEventosSLA filtros para consulta do histórico de SLA
+type FiltroEventosSLA struct {
+	OrganizacaoID string
+	Estado        string
+	TipoPrazo     string
+	PoliticaSLAID string
+	AgenteID      string
+	FilaID        string
+	AtendimentoID string
+	Desde         *time.Time
+	Ate           *time.Time
+	Page          int
+	Limit         int
+}
+
+// ResumoSLA indicadores agregados de cumprimento de SLA
+type ResumoSLA struct {
+	TotalAtendimentos int64   `json:"totalAtendimentos"`
+	NoPrazo           int64   `json:"noPrazo"`
+	EmRisco           int64   `json:"emRisco"`
+	Violados          int64   `json:"violados"`
+	Cumpridos         int64   `json:"cumpridos"`
+	TaxaCumprimento   float64 `json:"taxaCumprimento"`
+}
+
+func NewSLAService(db *gorm.DB, emailService *EmailService) *SLAService {
+	return &SLAService{
+		db:           db,
+		emailService: emailService,
+	}
+}
+
+// Iniciar executa o avaliador de SLA em background no intervalo informado
+func (s *SLAService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[SLA] Avaliador iniciado (intervalo: %s)", intervalo)
+		for {
+			select {
+			case <-ticker.C:
+				_, err := executarComTrava(s.db, "sla:avaliador", func() error {
+					return s.avaliarAtendimentos(s.db)
+				})
+				if err != nil {
+					log.Printf("[SLA] Erro ao avaliar atendimentos: %v", err)
+				}
+			case <-s.stop:
+				log.Printf("[SLA] Avaliador finalizado")
+				return
+			}
+		}
+	}()
+}
+
+// Parar interrompe o avaliador em background
+func (s *SLAService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// ResolverPolitica encontra a política aplicável ao atendimento.
+// Políticas por fila e por tag do contato concorrem; vence a de maior prioridade
+// e, em empate, a de prazo de primeira resposta mais curto.
+func (s *SLAService) ResolverPolitica(atendimento *models.Atendimento) (*models.PoliticaSLA, error) {
+	s.preencherFila(atendimento)
+
+	// Apenas políticas da organização do contato concorrem
+	organizacaoDoContato := s.db.Model(&models.Contato{}).Select("organizacao_id").Where("id = ?", atendimento.ContatoID)
+	query := s.db.Where("ativo = ? AND organizacao_id = (?)", true, organizacaoDoContato)
+
+	tagsDoContato := s.db.Table("contato_tags").Select("tag_id").Where("contato_id = ?", atendimento.ContatoID)
+	if atendimento.FilaID != nil && *atendimento.FilaID != "" {
+		query = query.Where("fila_id = ? OR tag_id IN (?)", *atendimento.FilaID, tagsDoContato)
+	} else {
+		query = query.Where("tag_id IN (?)", tagsDoContato)
+	}
+
+	var politica models.PoliticaSLA
+	err := query.Order("prioridade DESC, primeira_resposta_minutos ASC").First(&politica).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("erro ao buscar política de SLA: %w", err)
+	}
+
+	return &politica, nil
+}
+
+// AplicarPolitica calcula e grava os prazos do atendimento a partir da política aplicável
+func (s *SLAService) AplicarPolitica(atendimento *models.Atendimento) (*models.PoliticaSLA, error) {
+	politica, err := s.ResolverPolitica(atendimento)
+	if err != nil || politica == nil {
+		return nil, err
+	}
+
+	inicio := atendimento.CriadoEm
+	prazoPrimeiraResposta := inicio.Add(time.Duration(politica.PrimeiraRespostaMinutos) * time.Minute)
+	prazoResolucao := inicio.Add(time.Duration(politica.ResolucaoMinutos) * time.Minute)
+
+	atendimento.PoliticaSLAID = &politica.ID
+	atendimento.PrazoPrimeiraResposta = &prazoPrimeiraResposta
+	atendimento.PrazoResolucao = &prazoResolucao
+	atendimento.EstadoSLA = models.EstadoSLANoPrazo
+
+	updates := map[string]interface{}{
+		"politica_sla_id":         politica.ID,
+		"prazo_primeira_resposta": prazoPrimeiraResposta,
+		"prazo_resolucao":         prazoResolucao,
+		"estado_sla":              models.EstadoSLANoPrazo,
+	}
+	if atendimento.FilaID != nil {
+		updates["fila_id"] = *atendimento.FilaID
+	}
+
+	err = s.db.Model(&models.Atendimento{}).Where("id = ?", atendimento.ID).Updates(updates).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gravar prazos de SLA: %w", err)
+	}
+
+	return politica, nil
+}
+
+// preencherFila usa a fila ativa do contato quando o atendimento foi aberto
+// sem fila, para que as políticas por fila também se apliquem
+func (s *SLAService) preencherFila(atendimento *models.Atendimento) {
+	if atendimento.FilaID != nil && *atendimento.FilaID != "" {
+		return
+	}
+
+	var filaContato models.FilaContato
+	err := s.db.Where("contato_id = ? AND ativo = ?", atendimento.ContatoID, true).
+		Order("criado_em DESC").
+		First(&filaContato).Error
+	if err == nil {
+		atendimento.FilaID = &filaContato.FilaID
+	}
+}
+
+// RegistrarPrimeiraResposta marca o momento da primeira resposta do atendimento
+func (s *SLAService) RegistrarPrimeiraResposta(atendimentoID string, em time.Time) error {
+	return s.db.Model(&models.Atendimento{}).
+		Where("id = ? AND primeira_resposta_em IS NULL", atendimentoID).
+		Update("primeira_resposta_em", em).Error
+}
+
+// AvaliarAtendimentos avalia os atendimentos em aberto da organização
+func (s *SLAService) AvaliarAtendimentos(organizacaoID string) error {
+	if organizacaoID == "" {
+		return repositories.ErrOrganizacaoNaoInformada
+	}
+	return s.avaliarAtendimentos(s.db.Where("contato_id IN (?)", contatosDaOrganizacao(s.db, organizacaoID)))
+}
+
+// avaliarAtendimentos percorre os atendimentos em aberto do escopo, calcula prazos pendentes,
+// emite avisos antes do vencimento e escalona violações
+func (s *SLAService) avaliarAtendimentos(escopo *gorm.DB) error {
+	agora := time.Now()
+
+	// Atendimentos encerrados após um dos prazos (sem primeira resposta, vale o
+	// encerramento) ficam violados; os demais encerrados são marcados como cumpridos
+	encerrados := func() *gorm.DB {
+		return escopo.Session(&gorm.Session{}).Model(&models.Atendimento{}).
+			Where("politica_sla_id IS NOT NULL AND status IN ?", []models.StatusAtendimento{models.StatusAtendimentoFinalizado, models.StatusAtendimentoCancelado}).
+			Where("estado_sla IN ?", []models.EstadoSLA{models.EstadoSLANoPrazo, models.EstadoSLAEmRisco})
+	}
+	err := encerrados().
+		Where("((prazo_resolucao IS NOT NULL AND finalizado_em > prazo_resolucao) OR "+
+			"(prazo_primeira_resposta IS NOT NULL AND COALESCE(primeira_resposta_em, finalizado_em) > prazo_primeira_resposta))").
+		Update("estado_sla", models.EstadoSLAViolado).Error
+	if err != nil {
+		// Sem marcar os violados, os cumpridos esperam a próxima avaliação para
+		// que um encerrado fora do prazo não seja dado como cumprido
+		log.Printf("[SLA] Erro ao marcar atendimentos encerrados fora do prazo: %v", err)
+	} else if err := encerrados().Update("estado_sla", models.EstadoSLACumprido).Error; err != nil {
+		log.Printf("[SLA] Erro ao marcar atendimentos encerrados no prazo: %v", err)
+	}
+
+	var atendimentos []models.Atendimento
+	err = escopo.Session(&gorm.Session{}).Where("status IN ?", []models.StatusAtendimento{models.StatusAtendimentoAguardando, models.StatusAtendimentoEmAndamento}).
+		Find(&atendimentos).Error
+	if err != nil {
+		return fmt.Errorf("erro ao buscar atendimentos em aberto: %w", err)
+	}
+
+	politicas := make(map[string]*models.PoliticaSLA)
+	for i := range atendimentos {
+		atendimento := &atendimentos[i]
+
+		var politica *models.PoliticaSLA
+		if atendimento.PoliticaSLAID == nil {
+			politica, err = s.AplicarPolitica(atendimento)
+			if err != nil {
+				log.Printf("[SLA] Erro ao aplicar política no atendimento %s: %v", atendimento.ID, err)
+				continue
+			}
+		} else if p, ok := politicas[*atendimento.PoliticaSLAID]; ok {
+			politica = p
+		} else {
+			var p models.PoliticaSLA
+			if err := s.db.First(&p, "id = ?", *atendimento.PoliticaSLAID).Error; err != nil {
+				log.Printf("[SLA] Política %s não encontrada: %v", *atendimento.PoliticaSLAID, err)
+				continue
+			}
+			politica = &p
+		}
+		if politica == nil {
+			continue
+		}
+		politicas[politica.ID] = politica
+
+		s.detectarPrimeiraResposta(atendimento)
+
+		if err := s.avaliarAtendimento(atendimento, politica, agora); err != nil {
+			log.Printf("[SLA] Erro ao avaliar atendimento %s: %v", atendimento.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// detectarPrimeiraResposta usa a primeira mensagem enviada na conversa após a abertura
+func (s *SLAService) detectarPrimeiraResposta(atendimento *models.Atendimento) {
+	if atendimento.PrimeiraRespostaEm != nil || atendimento.ConversaID == "" {
+		return
+	}
+
+	var mensagem models.Mensagem
+	err := s.db.Where("conversa_id = ? AND de_mim = ? AND timestamp >= ?", atendimento.ConversaID, true, atendimento.CriadoEm).
+		Order("timestamp ASC").
+		First(&mensagem).Error
+	if err != nil {
+		return
+	}
+
+	if err := s.RegistrarPrimeiraResposta(atendimento.ID, mensagem.Timestamp); err == nil {
+		atendimento.PrimeiraRespostaEm = &mensagem.Timestamp
+	}
+}
+
+func (s *SLAService) avaliarAtendimento(atendimento *models.Atendimento, politica *models.PoliticaSLA, agora time.Time) error {
+	estado := models.EstadoSLANoPrazo
+
+	if atendimento.PrimeiraRespostaEm == nil && atendimento.PrazoPrimeiraResposta != nil {
+		e, err := s.avaliarPrazo(atendimento, politica, models.TipoPrazoPrimeiraResposta, *atendimento.PrazoPrimeiraResposta, agora)
+		if err != nil {
+			return err
+		}
+		estado = piorEstadoSLA(estado, e)
+	}
+
+	if atendimento.PrazoResolucao != nil {
+		e, err := s.avaliarPrazo(atendimento, politica, models.TipoPrazoResolucao, *atendimento.PrazoResolucao, agora)
+		if err != nil {
+			return err
+		}
+		estado = piorEstadoSLA(estado, e)
+	}
+
+	// Uma violação já registrada não volta para "no prazo"
+	if atendimento.EstadoSLA == models.EstadoSLAViolado {
+		estado = models.EstadoSLAViolado
+	}
+
+	if estado != atendimento.EstadoSLA {
+		atendimento.EstadoSLA = estado
+		return s.db.Model(&models.Atendimento{}).Where("id = ?", atendimento.ID).Update("estado_sla", estado).Error
+	}
+	return nil
+}
+
+func (s *SLAService) avaliarPrazo(atendimento *models.Atendimento, politica *models.PoliticaSLA, tipo models.TipoPrazoSLA, prazo time.Time, agora time.Time) (models.EstadoSLA, error) {
+	if agora.After(prazo) {
+		registrado, err := s.registrarEvento(atendimento, politica, tipo, models.EstadoSLAViolado, prazo, agora)
+		if err != nil || registrado == nil {
+			return models.EstadoSLAViolado, err
+		}
+
+		acoes := s.escalonar(atendimento, politica, tipo)
+		if len(acoes) > 0 {
+			resumo := strings.Join(acoes, ",")
+			if err := s.db.Model(registrado).Update("acoes_executadas", resumo).Error; err != nil {
+				log.Printf("[SLA] Erro ao registrar ações do evento %s (%s): %v", registrado.ID, resumo, err)
+			}
+		}
+		return models.EstadoSLAViolado, nil
+	}
+
+	total := prazo.Sub(atendimento.CriadoEm)
+	decorrido := agora.Sub(atendimento.CriadoEm)
+	if total > 0 && decorrido*100 >= total*time.Duration(politica.AvisoPercentual) {
+		registrado, err := s.registrarEvento(atendimento, politica, tipo, models.EstadoSLAEmRisco, prazo, agora)
+		if err != nil {
+			return models.EstadoSLAEmRisco, err
+		}
+		if registrado != nil {
+			s.avisar(atendimento, politica, tipo, prazo)
+		}
+		return models.EstadoSLAEmRisco, nil
+	}
+
+	return models.EstadoSLANoPrazo, nil
+}
+
+// registrarEvento grava o evento apenas uma vez por atendimento, prazo e estado
+// (índice único idx_eventos_sla_atendimento_prazo_estado).
+// Retorna nil quando o evento já havia sido registrado.
+func (s *SLAService) registrarEvento(atendimento *models.Atendimento, politica *models.PoliticaSLA, tipo models.TipoPrazoSLA, estado models.EstadoSLA, prazo time.Time, agora time.Time) (*models.EventoSLA, error) {
+	evento := &models.EventoSLA{
+		OrganizacaoID: politica.OrganizacaoID,
+		AtendimentoID: atendimento.ID,
+		PoliticaSLAID: politica.ID,
+		TipoPrazo:     tipo,
+		Estado:        estado,
+		PrazoEm:       prazo,
+		DetectadoEm:   agora,
+		AgenteID:      atendimento.AgenteID,
+		FilaID:        atendimento.FilaID,
+	}
+	result := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "atendimento_id"}, {Name: "tipo_prazo"}, {Name: "estado"}},
+		DoNothing: true,
+	}).Create(evento)
+	if result.Error != nil {
+		return nil, fmt.Errorf("erro ao registrar evento de SLA: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	log.Printf("[SLA] Atendimento %s: %s %s (prazo %s)", atendimento.ID, tipo, estado, prazo.Format(time.RFC3339))
+	return evento, nil
+}
+
+// avisar notifica o agente responsável (ou o supervisor) que o prazo está próximo
+func (s *SLAService) avisar(atendimento *models.Atendimento, politica *models.PoliticaSLA, tipo models.TipoPrazoSLA, prazo time.Time) {
+	destinatario := atendimento.AgenteID
+	if destinatario == nil {
+		destinatario = politica.SupervisorID
+	}
+	if destinatario == nil {
+		return
+	}
+
+	titulo := fmt.Sprintf("SLA em risco: %s", atendimento.Titulo)
+	descricao := fmt.Sprintf("O prazo de %s do atendimento \"%s\" vence em %s.",
+		descricaoPrazoSLA(tipo), atendimento.Titulo, prazo.Format("02/01/2006 15:04"))
+
+	s.criarAlerta(*destinatario, titulo, descricao, models.PrioridadeAlertaAlta, "#f59e0b")
+}
+
+// escalona aplica as ações configuradas na política e retorna as ações executadas
+func (s *SLAService) escalonar(atendimento *models.Atendimento, politica *models.PoliticaSLA, tipo models.TipoPrazoSLA) []string {
+	var acoes []string
+	updates := map[string]interface{}{}
+
+	if politica.EscalonarReatribuir && politica.ReatribuirParaID != nil &&
+		(atendimento.AgenteID == nil || *atendimento.AgenteID != *politica.ReatribuirParaID) {
+		atendimento.AgenteID = politica.ReatribuirParaID
+		updates["agente_id"] = *politica.ReatribuirParaID
+		acoes = append(acoes, "reatribuido")
+	}
+
+	if politica.EscalonarAumentarPrioridade {
+		atendimento.Prioridade++
+		updates["prioridade"] = atendimento.Prioridade
+		acoes = append(acoes, "prioridade_aumentada")
+	}
+
+	agora := time.Now()
+	atendimento.SLAEscalonadoEm = &agora
+	updates["sla_escalonado_em"] = agora
+
+	if err := s.db.Model(&models.Atendimento{}).Where("id = ?", atendimento.ID).Updates(updates).Error; err != nil {
+		log.Printf("[SLA] Erro ao escalonar atendimento %s: %v", atendimento.ID, err)
+		return nil
+	}
+
+	if politica.EscalonarNotificar && politica.SupervisorID != nil {
+		titulo := fmt.Sprintf("SLA violado: %s", atendimento.Titulo)
+		descricao := fmt.Sprintf("O prazo de %s do atendimento \"%s\" (política %s) foi violado.",
+			descricaoPrazoSLA(tipo), atendimento.Titulo, politica.Nome)
+		if len(acoes) > 0 {
+			descricao += fmt.Sprintf(" Ações executadas: %s.", strings.Join(acoes, ", "))
+		}
+
+		s.criarAlerta(*politica.SupervisorID, titulo, descricao, models.PrioridadeAlertaCritica, "#ef4444")
+
+		var supervisor models.Usuario
+		if err := s.db.First(&supervisor, "id = ?", *politica.SupervisorID).Error; err == nil && s.emailService != nil {
+			if err := s.emailService.SendEmail(supervisor.Email, titulo, descricao); err != nil {
+				log.Printf("[SLA] Erro ao enviar email para supervisor %s: %v", supervisor.ID, err)
+			}
+		}
+		acoes = append(acoes, "supervisor_notificado")
+	}
+
+	return acoes
+}
+
+func (s *SLAService) criarAlerta(usuarioID, titulo, descricao string, prioridade models.PrioridadeAlerta, cor string) {
+	alerta := models.Alerta{
+		Titulo:     titulo,
+		Descricao:  descricao,
+		Tipo:       models.TipoAlertaPerformance,
+		Prioridade: prioridade,
+		Status:     models.StatusAlertaAtivo,
+		Cor:        cor,
+		Icone:      "clock",
+		Configuracoes: models.ConfiguracaoAlerta{
+			EmailNotificacao:     true,
+			DashboardNotificacao: true,
+			Frequencia:           models.FrequenciaAlertaImediata,
+		},
+		UserID: usuarioID,
+	}
+
+	if err := s.db.Create(&alerta).Error; err != nil {
+		log.Printf("[SLA] Erro ao criar alerta para usuário %s: %v", usuarioID, err)
+	}
+}
+
+// ListarEventos retorna o histórico de avisos e violações de SLA com paginação
+func (s *SLAService) ListarEventos(filtro FiltroEventosSLA) ([]models.EventoSLA, int64, error) {
+	query := s.db.Model(&models.EventoSLA{}).Scopes(repositories.PorOrganizacao(filtro.OrganizacaoID))
+
+	if filtro.Estado != "" {
+		query = query.Where("estado = ?", filtro.Estado)
+	}
+	if filtro.TipoPrazo != "" {
+		query = query.Where("tipo_prazo = ?", filtro.TipoPrazo)
+	}
+	if filtro.PoliticaSLAID != "" {
+		query = query.Where("politica_sla_id = ?", filtro.PoliticaSLAID)
+	}
+	if filtro.AgenteID != "" {
+		query = query.Where("agente_id = ?", filtro.AgenteID)
+	}
+	if filtro.FilaID != "" {
+		query = query.Where("fila_id = ?", filtro.FilaID)
+	}
+	if filtro.AtendimentoID != "" {
+		query = query.Where("atendimento_id = ?", filtro.AtendimentoID)
+	}
+	if filtro.Desde != nil {
+		query = query.Where("detectado_em >= ?", *filtro.Desde)
+	}
+	if filtro.Ate != nil {
+		query = query.Where("detectado_em <= ?", *filtro.Ate)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("erro ao contar eventos de SLA: %w", err)
+	}
+
+	if filtro.Page < 1 {
+		filtro.Page = 1
+	}
+	if filtro.Limit < 1 || filtro.Limit > 100 {
+		filtro.Limit = 20
+	}
+
+	var eventos []models.EventoSLA
+	err := query.Preload("Atendimento").Preload("PoliticaSLA").
+		Order("detectado_em DESC").
+		Offset((filtro.Page - 1) * filtro.Limit).
+		Limit(filtro.Limit).
+		Find(&eventos).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("erro ao buscar eventos de SLA: %w", err)
+	}
+
+	return eventos, total, nil
+}
+
+// ObterResumo agrega o estado de SLA dos atendimentos da organização criados no período
+func (s *SLAService) ObterResumo(organizacaoID string, desde, ate *time.Time) (*ResumoSLA, error) {
+	if organizacaoID == "" {
+		return nil, repositories.ErrOrganizacaoNaoInformada
+	}
+
+	var linhas []struct {
+		EstadoSLA models.EstadoSLA
+		Total     int64
+	}
+
+	query := s.db.Model(&models.Atendimento{}).
+		Select("estado_sla, COUNT(*) AS total").
+		Where("politica_sla_id IS NOT NULL AND contato_id IN (?)", contatosDaOrganizacao(s.db, organizacaoID))
+	if desde != nil {
+		query = query.Where("criado_em >= ?", *desde)
+	}
+	if ate != nil {
+		query = query.Where("criado_em <= ?", *ate)
+	}
+
+	if err := query.Group("estado_sla").Scan(&linhas).Error; err != nil {
+		return nil, fmt.Errorf("erro ao calcular resumo de SLA: %w", err)
+	}
+
+	resumo := &ResumoSLA{}
+	for _, linha := range linhas {
+		resumo.TotalAtendimentos += linha.Total
+		switch linha.EstadoSLA {
+		case models.EstadoSLANoPrazo:
+			resumo.NoPrazo = linha.Total
+		case models.EstadoSLAEmRisco:
+			resumo.EmRisco = linha.Total
+		case models.EstadoSLAViolado:
+			resumo.Violados = linha.Total
+		case models.EstadoSLACumprido:
+			resumo.Cumpridos = linha.Total
+		}
+	}
+
+	if resumo.TotalAtendimentos > 0 {
+		resumo.TaxaCumprimento = float64(resumo.TotalAtendimentos-resumo.Violados) / float64(resumo.TotalAtendimentos) * 100
+	}
+
+	return resumo, nil
+}
+
+// contatosDaOrganizacao subconsulta dos contatos da organização; o atendimento
+// pertence à organização do contato
+func contatosDaOrganizacao(db *gorm.DB, organizacaoID string) *gorm.DB {
+	return db.Model(&models.Contato{}).Select("id").Where("organizacao_id = ?", organizacaoID)
+}
+
+func piorEstadoSLA(a, b models.EstadoSLA) models.EstadoSLA {
+	peso := map[models.EstadoSLA]int{
+		models.EstadoSLANoPrazo:  0,
+		models.EstadoSLACumprido: 0,
+		models.EstadoSLAEmRisco:  1,
+		models.EstadoSLAViolado:  2,
+	}
+	if peso[b] > peso[a] {
+		return b
+	}
+	return a
+}
+
+func descricaoPrazoSLA(tipo models.TipoPrazoSLA) string {
+	if tipo == models.TipoPrazoPrimeiraResposta {
+		return "primeira resposta"
+	}
+	return "resolução"
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Intervalo entre reinícios automáticos: dobra a cada tentativa até o máximo
+	reinicioIntervaloInicial = 30 * time.Second
+	reinicioIntervaloMaximo  = 30 * time.Minute
+
+	// Tentativas sem sucesso até avisar os administradores
+	reinicioTentativasAlerta = 5
+
+	// Queda menos de janelaFlap depois de reconectar conta como flap
+	janelaFlap = 10 * time.Minute
+)
+
+// SupervisorSessoesService verifica periodicamente as sessões do WhatsApp no
+// WAHA, reinicia as que caíram e avisa os administradores quando é preciso
+// ler o QR code de novo
+type SupervisorSessoesService struct {
+	db           *gorm.DB
+	sessoes      *repositories.SessaoWhatsAppRepository
+	connection   *ConnectionService
+	emailService *EmailService
+	realtime     *RealtimeService
+	stop         chan struct{}
+}
+
+// SaudeSessao disponibilidade de uma sessão no período consultado
+type SaudeSessao struct {
+	SessaoID           string                        `json:"sessaoId"`
+	NomeSessao         string                        `json:"nomeSessao"`
+	Rotulo             *string                       `json:"rotulo"`
+	Status             models.StatusSessao           `json:"status"`
+	StatusWAHA         *string                       `json:"statusWaha"`
+	Desde              time.Time                     `json:"desde"`
+	Ate                time.Time                     `json:"ate"`
+	Uptime             float64                       `json:"uptime"` // percentual do período com a sessão conectada
+	SegundosConectada  int64                         `json:"segundosConectada"`
+	Quedas             int                           `json:"quedas"`
+	Flaps              int                           `json:"flaps"` // quedas logo após reconectar
+	Reinicios          int                           `json:"reinicios"`
+	TentativasReinicio int                           `json:"tentativasReinicio"`
+	ProximoReinicioEm  *time.Time                    `json:"proximoReinicioEm"`
+	UltimaQuedaEm      *time.Time                    `json:"ultimaQuedaEm"`
+	Eventos            []models.EventoSessaoWhatsApp `json:"eventos,omitempty"`
+}
+
+func NewSupervisorSessoesService(db *gorm.DB, connection *ConnectionService, emailService *EmailService, realtime *RealtimeService) *SupervisorSessoesService {
+	return &SupervisorSessoesService{
+		db:           db,
+		sessoes:      repositories.NewSessaoWhatsAppRepository(db),
+		connection:   connection,
+		emailService: emailService,
+		realtime:     realtime,
+	}
+}
+
+// Iniciar executa o supervisor em background no intervalo informado
+func (s *SupervisorSessoesService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[SUPERVISOR_WAHA] Supervisor de sessões iniciado (intervalo: %s)", intervalo)
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := executarComTrava(s.db, "supervisor:sessoes", s.VerificarSessoes); err != nil {
+					log.Printf("[SUPERVISOR_WAHA] Erro ao verificar sessões: %v", err)
+				}
+			case <-s.stop:
+				log.Printf("[SUPERVISOR_WAHA] Supervisor de sessões finalizado")
+				return
+			}
+		}
+	}()
+}
+
+// Parar interrompe o supervisor em background
+func (s *SupervisorSessoesService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// VerificarSessoes consulta no WAHA o status de todas as sessões ativas
+func (s *SupervisorSessoesService) VerificarSessoes() error {
+	var sessoes []models.SessaoWhatsApp
+	if err := s.db.Where("ativo = ?", true).Find(&sessoes).Error; err != nil {
+		return fmt.Errorf("erro ao buscar sessões: %w", err)
+	}
+
+	for i := range sessoes {
+		s.verificarSessao(&sessoes[i])
+	}
+	return nil
+}
+
+func (s *SupervisorSessoesService) verificarSessao(sessao *models.SessaoWhatsApp) {
+	statusWAHA, err := s.connection.checkWAHASessionStatus(sessao.NomeSessao)
+	if err != nil {
+		// WAHA fora do ar não diz nada sobre a sessão: mantém o último status
+		log.Printf("[SUPERVISOR_WAHA] Erro ao consultar sessão %s: %v", sessao.NomeSessao, err)
+		return
+	}
+
+	anterior := sessao.Status
+	novo := models.StatusSessaoDoWAHA(statusWAHA)
+	if err := s.sessoes.AtualizarStatus(sessao, novo, statusWAHA, models.OrigemEventoSessaoSupervisor); err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao atualizar status da sessão %s: %v", sessao.NomeSessao, err)
+		return
+	}
+	if anterior != novo {
+		log.Printf("[SUPERVISOR_WAHA] Sessão %s: %s -> %s (%s)", sessao.NomeSessao, anterior, novo, statusWAHA)
+	}
+
+	switch statusWAHA {
+	case "FAILED", "STOPPED":
+		if s.deveReiniciar(sessao, statusWAHA) {
+			s.reiniciar(sessao, statusWAHA)
+		}
+	case "SCAN_QR_CODE":
+		s.alertarReautenticacao(sessao, statusWAHA)
+	}
+}
+
+// deveReiniciar sessões com falha sempre são reiniciadas; paradas, só quando
+// caíram sozinhas (não foram desconectadas pelo usuário nem nunca conectaram)
+func (s *SupervisorSessoesService) deveReiniciar(sessao *models.SessaoWhatsApp, statusWAHA string) bool {
+	if statusWAHA == "FAILED" || sessao.TentativasReinicio > 0 {
+		return true
+	}
+	if sessao.ConectadoEm == nil {
+		return false
+	}
+
+	ultima, err := s.sessoes.UltimaMudancaDeStatus(sessao.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	}
+	if err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao buscar histórico da sessão %s: %v", sessao.NomeSessao, err)
+		return false
+	}
+	return ultima.Origem != models.OrigemEventoSessaoAPI
+}
+
+// reiniciar pede ao WAHA para subir a sessão de novo respeitando o backoff
+func (s *SupervisorSessoesService) reiniciar(sessao *models.SessaoWhatsApp, statusWAHA string) {
+	agora := time.Now()
+	if sessao.ProximoReinicioEm != nil && agora.Before(*sessao.ProximoReinicioEm) {
+		return
+	}
+
+	tentativas := sessao.TentativasReinicio + 1
+	detalhe := fmt.Sprintf("tentativa %d", tentativas)
+	if err := s.connection.restartWAHASession(sessao.NomeSessao, statusWAHA); err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao reiniciar sessão %s (tentativa %d): %v", sessao.NomeSessao, tentativas, err)
+		detalhe = fmt.Sprintf("%s: %v", detalhe, err)
+	} else {
+		log.Printf("[SUPERVISOR_WAHA] Sessão %s reiniciada (tentativa %d)", sessao.NomeSessao, tentativas)
+	}
+
+	if err := s.sessoes.RegistrarEvento(sessao, models.TipoEventoSessaoReinicio, models.OrigemEventoSessaoSupervisor, statusWAHA, detalhe); err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao registrar reinício da sessão %s: %v", sessao.NomeSessao, err)
+	}
+	if err := s.sessoes.AgendarReinicio(sessao, tentativas, agora.Add(intervaloReinicio(tentativas))); err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao agendar reinício da sessão %s: %v", sessao.NomeSessao, err)
+	}
+
+	if tentativas == reinicioTentativasAlerta {
+		titulo := fmt.Sprintf("Sessão do WhatsApp %s não se recupera", nomeExibicaoSessao(sessao))
+		descricao := fmt.Sprintf("A sessão %s continua %s após %d tentativas de reinício automático. O supervisor seguirá tentando a cada %s.",
+			nomeExibicaoSessao(sessao), statusWAHA, tentativas, reinicioIntervaloMaximo)
+		s.notificarAdministradores(sessao, titulo, descricao, models.PrioridadeAlertaCritica)
+	}
+}
+
+// intervaloReinicio backoff exponencial a partir de reinicioIntervaloInicial
+func intervaloReinicio(tentativas int) time.Duration {
+	intervalo := reinicioIntervaloInicial
+	for i := 1; i < tentativas; i++ {
+		intervalo *= 2
+		if intervalo >= reinicioIntervaloMaximo {
+			return reinicioIntervaloMaximo
+		}
+	}
+	return intervalo
+}
+
+// alertarReautenticacao avisa uma vez por queda que a sessão precisa do QR.
+// Sessões que nunca conectaram estão apenas aguardando o primeiro pareamento.
+func (s *SupervisorSessoesService) alertarReautenticacao(sessao *models.SessaoWhatsApp, statusWAHA string) {
+	if sessao.ConectadoEm == nil || sessao.ReautenticacaoAlertadaEm != nil {
+		return
+	}
+
+	// Só quem marcou a sessão envia o alerta (webhook e supervisor podem detectar juntos)
+	marcada, err := s.sessoes.MarcarReautenticacaoAlertada(sessao)
+	if err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao marcar alerta da sessão %s: %v", sessao.NomeSessao, err)
+		return
+	}
+	if !marcada {
+		return
+	}
+	if err := s.sessoes.RegistrarEvento(sessao, models.TipoEventoSessaoReautenticacao, models.OrigemEventoSessaoSupervisor, statusWAHA, ""); err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao registrar reautenticação da sessão %s: %v", sessao.NomeSessao, err)
+	}
+
+	titulo := fmt.Sprintf("Sessão do WhatsApp %s precisa ser reconectada", nomeExibicaoSessao(sessao))
+	descricao := fmt.Sprintf("A sessão %s foi desconectada do aparelho e aguarda a leitura de um novo QR code. Mensagens não serão enviadas nem recebidas até a reconexão.",
+		nomeExibicaoSessao(sessao))
+	s.notificarAdministradores(sessao, titulo, descricao, models.PrioridadeAlertaAlta)
+}
+
+// notificarAdministradores cria o alerta, envia email e publica no websocket
+// para os administradores da organização (ou o dono da sessão sem organização)
+func (s *SupervisorSessoesService) notificarAdministradores(sessao *models.SessaoWhatsApp, titulo, descricao string, prioridade models.PrioridadeAlerta) {
+	var administradores []models.Usuario
+	query := s.db.Where("ativo = ?", true)
+	if sessao.OrganizacaoID != "" {
+		query = query.Where("organizacao_id = ? AND tipo = ?", sessao.OrganizacaoID, models.TipoUsuarioAdmin)
+	} else {
+		query = query.Where("id = ?", sessao.UsuarioID)
+	}
+	if err := query.Find(&administradores).Error; err != nil {
+		log.Printf("[SUPERVISOR_WAHA] Erro ao buscar administradores da sessão %s: %v", sessao.NomeSessao, err)
+		return
+	}
+
+	for _, administrador := range administradores {
+		alerta := models.Alerta{
+			Titulo:     titulo,
+			Descricao:  descricao,
+			Tipo:       models.TipoAlertaIntegracao,
+			Prioridade: prioridade,
+			Status:     models.StatusAlertaAtivo,
+			Cor:        "#ef4444",
+			Icone:      "smartphone",
+			Configuracoes: models.ConfiguracaoAlerta{
+				EmailNotificacao:     true,
+				DashboardNotificacao: true,
+				Frequencia:           models.FrequenciaAlertaImediata,
+			},
+			UserID: administrador.ID,
+		}
+		if err := s.db.Create(&alerta).Error; err != nil {
+			log.Printf("[SUPERVISOR_WAHA] Erro ao criar alerta para usuário %s: %v", administrador.ID, err)
+		}
+
+		if s.emailService != nil && s.emailService.Configurado() {
+			if err := s.emailService.SendEmail(administrador.Email, titulo, descricao); err != nil {
+				log.Printf("[SUPERVISOR_WAHA] Erro ao enviar email para %s: %v", administrador.ID, err)
+			}
+		}
+
+		if s.realtime != nil {
+			s.realtime.PublishToUser(administrador.ID, "session_alert", map[string]interface{}{
+				"sessaoId":   sessao.ID,
+				"sessao":     sessao.NomeSessao,
+				"alertaId":   alerta.ID,
+				"titulo":     titulo,
+				"descricao":  descricao,
+				"prioridade": prioridade,
+			})
+		}
+	}
+}
+
+func nomeExibicaoSessao(sessao *models.SessaoWhatsApp) string {
+	if sessao.Rotulo != nil && *sessao.Rotulo != "" {
+		return *sessao.Rotulo
+	}
+	return sessao.NomeSessao
+}
+
+// Saude calcula uptime, quedas, flaps e reinícios da sessão desde o horário informado
+func (s *SupervisorSessoesService) Saude(sessao *models.SessaoWhatsApp, desde time.Time, comEventos bool) (*SaudeSessao, error) {
+	ate := time.Now()
+	if sessao.CriadoEm.After(desde) {
+		desde = sessao.CriadoEm
+	}
+
+	eventos, err := s.sessoes.EventosDesde(sessao.ID, desde)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar histórico da sessão: %w", err)
+	}
+	status, err := s.sessoes.StatusEm(sessao.ID, desde)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar histórico da sessão: %w", err)
+	}
+
+	// Sem histórico anterior ao período, vale o status de antes da primeira mudança
+	if status == "" {
+		status = sessao.Status
+		for _, evento := range eventos {
+			if evento.Tipo == models.TipoEventoSessaoStatus {
+				status = evento.StatusAnterior
+				break
+			}
+		}
+	}
+
+	saude := &SaudeSessao{
+		SessaoID:           sessao.ID,
+		NomeSessao:         sessao.NomeSessao,
+		Rotulo:             sessao.Rotulo,
+		Status:             sessao.Status,
+		StatusWAHA:         sessao.StatusWAHA,
+		Desde:              desde,
+		Ate:                ate,
+		TentativasReinicio: sessao.TentativasReinicio,
+		ProximoReinicioEm:  sessao.ProximoReinicioEm,
+	}
+
+	var conectada time.Duration
+	var conectouEm *time.Time
+	inicio := desde
+	for i := range eventos {
+		evento := &eventos[i]
+		switch evento.Tipo {
+		case models.TipoEventoSessaoReinicio:
+			saude.Reinicios++
+			continue
+		case models.TipoEventoSessaoStatus:
+		default:
+			continue
+		}
+
+		if status.Conectada() {
+			conectada += evento.Horario.Sub(inicio)
+		}
+		if !status.Conectada() && evento.StatusNovo.Conectada() {
+			conectouEm = &evento.Horario
+		}
+		if status.Conectada() && !evento.StatusNovo.Conectada() {
+			saude.Quedas++
+			saude.UltimaQuedaEm = &evento.Horario
+			if conectouEm != nil && evento.Horario.Sub(*conectouEm) < janelaFlap {
+				saude.Flaps++
+			}
+		}
+		status = evento.StatusNovo
+		inicio = evento.Horario
+	}
+	if status.Conectada() {
+		conectada += ate.Sub(inicio)
+	}
+
+	if periodo := ate.Sub(desde); periodo > 0 {
+		saude.Uptime = float64(conectada) * 100 / float64(periodo)
+	}
+	saude.SegundosConectada = int64(conectada.Seconds())
+	if comEventos {
+		saude.Eventos = eventos
+	}
+	return saude, nil
+}
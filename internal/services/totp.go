@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parâmetros TOTP (RFC 6238) compatíveis com Google Authenticator, Authy etc.
+const (
+	totpPeriodo       = 30 // segundos por passo
+	totpDigitos       = 6
+	totpJanela        = 1 // passos aceitos antes/depois do atual (tolerância de relógio)
+	totpTamanhoSecret = 20
+	totpEmissor       = "TappyOne"
+)
+
+var totpBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// gerarSegredoTOTP gera um segredo aleatório codificado em base32
+func gerarSegredoTOTP() (string, error) {
+	bytes := make([]byte, totpTamanhoSecret)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("erro ao gerar segredo TOTP: %w", err)
+	}
+	return totpBase32.EncodeToString(bytes), nil
+}
+
+// uriProvisionamentoTOTP monta a URI otpauth:// exibida como QR code no aplicativo autenticador
+func uriProvisionamentoTOTP(segredo, conta string) string {
+	rotulo := url.PathEscape(totpEmissor + ":" + conta)
+	params := url.Values{}
+	params.Set("secret", segredo)
+	params.Set("issuer", totpEmissor)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigitos))
+	params.Set("period", fmt.Sprintf("%d", totpPeriodo))
+	return "otpauth://totp/" + rotulo + "?" + params.Encode()
+}
+
+// passoTOTP retorna o contador de tempo do instante informado
+func passoTOTP(instante time.Time) int64 {
+	return instante.Unix() / totpPeriodo
+}
+
+// codigoTOTP calcula o código HOTP (RFC 4226) do passo informado
+func codigoTOTP(segredo string, passo int64) (string, error) {
+	chave, err := totpBase32.DecodeString(strings.ToUpper(strings.TrimSpace(segredo)))
+	if err != nil {
+		return "", fmt.Errorf("segredo TOTP inválido: %w", err)
+	}
+
+	var contador [8]byte
+	binary.BigEndian.PutUint64(contador[:], uint64(passo))
+
+	mac := hmac.New(sha1.New, chave)
+	mac.Write(contador[:])
+	sum := mac.Sum(nil)
+
+	deslocamento := sum[len(sum)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(sum[deslocamento:deslocamento+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigitos; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigitos, valor%modulo), nil
+}
+
+// validarCodigoTOTP verifica o código dentro da janela de tolerância e retorna
+// o passo correspondente. Passos até ultimoPasso (já usados) são rejeitados
+// para impedir a reutilização do mesmo código.
+func validarCodigoTOTP(segredo, codigo string, instante time.Time, ultimoPasso int64) (int64, bool) {
+	codigo = strings.TrimSpace(codigo)
+	if len(codigo) != totpDigitos {
+		return 0, false
+	}
+
+	atual := passoTOTP(instante)
+	for passo := atual - totpJanela; passo <= atual+totpJanela; passo++ {
+		if passo <= ultimoPasso {
+			continue
+		}
+		esperado, err := codigoTOTP(segredo, passo)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(esperado), []byte(codigo)) {
+			return passo, true
+		}
+	}
+	return 0, false
+}
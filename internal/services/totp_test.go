@@ -0,0 +1,82 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// Segredo dos vetores de teste das RFCs 4226 e 6238 (SHA1)
+var totpSegredoRFC = totpBase32.EncodeToString([]byte("12345678901234567890"))
+
+// RFC 4226, Apêndice D
+func TestCodigoTOTPVetoresHOTP(t *testing.T) {
+	esperados := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for passo, esperado := range esperados {
+		codigo, err := codigoTOTP(totpSegredoRFC, int64(passo))
+		if err != nil {
+			t.Fatalf("passo %d: %v", passo, err)
+		}
+		if codigo != esperado {
+			t.Errorf("passo %d: código %s, esperado %s", passo, codigo, esperado)
+		}
+	}
+}
+
+// RFC 6238, Apêndice B (SHA1). Os vetores têm 8 dígitos; com 6 dígitos o
+// código é o final deles.
+func TestCodigoTOTPVetoresRFC6238(t *testing.T) {
+	vetores := []struct {
+		unix     int64
+		esperado string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vetores {
+		codigo, err := codigoTOTP(totpSegredoRFC, passoTOTP(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("T=%d: %v", v.unix, err)
+		}
+		if esperado := v.esperado[len(v.esperado)-totpDigitos:]; codigo != esperado {
+			t.Errorf("T=%d: código %s, esperado %s", v.unix, codigo, esperado)
+		}
+	}
+}
+
+func TestValidarCodigoTOTP(t *testing.T) {
+	instante := time.Unix(1111111111, 0)
+	atual := passoTOTP(instante)
+	codigo, _ := codigoTOTP(totpSegredoRFC, atual)
+	anterior, _ := codigoTOTP(totpSegredoRFC, atual-1)
+	foraDaJanela, _ := codigoTOTP(totpSegredoRFC, atual-totpJanela-1)
+
+	passo, ok := validarCodigoTOTP(totpSegredoRFC, codigo, instante, 0)
+	if !ok || passo != atual {
+		t.Fatalf("código atual recusado: passo %d, ok %v", passo, ok)
+	}
+
+	// O mesmo código não vale de novo depois de usado
+	if _, ok := validarCodigoTOTP(totpSegredoRFC, codigo, instante, passo); ok {
+		t.Error("código reutilizado aceito")
+	}
+
+	// Código do passo anterior vale pela tolerância de relógio, mas não se um
+	// código mais novo já foi usado
+	if passo, ok := validarCodigoTOTP(totpSegredoRFC, anterior, instante, 0); !ok || passo != atual-1 {
+		t.Errorf("código do passo anterior recusado: passo %d, ok %v", passo, ok)
+	}
+	if _, ok := validarCodigoTOTP(totpSegredoRFC, anterior, instante, atual); ok {
+		t.Error("código anterior ao último usado aceito")
+	}
+
+	if _, ok := validarCodigoTOTP(totpSegredoRFC, foraDaJanela, instante, 0); ok {
+		t.Error("código fora da janela aceito")
+	}
+	if _, ok := validarCodigoTOTP(totpSegredoRFC, codigo[:totpDigitos-1], instante, 0); ok {
+		t.Error("código com menos dígitos aceito")
+	}
+}
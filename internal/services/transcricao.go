@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	transcricaoLote             = 5
+	transcricaoReserva          = 15 * time.Minute // tempo em que a mensagem fica reservada para o worker
+	transcricaoTentativas       = 5
+	transcricaoTimeout          = 5 * time.Minute // limite de cada chamada ao provedor
+	janelaTranscricaoAutomatica = 24 * time.Hour  // mensagens mais antigas (ex: importação) só por pedido manual
+)
+
+var (
+	ErrTranscricaoDesativada = errors.New("transcrição de áudio não configurada no servidor")
+	ErrMensagemSemAudio      = errors.New("mensagem sem áudio para transcrever")
+	ErrMensagemNaoEncontrada = errors.New("mensagem não encontrada")
+)
+
+// TranscricaoService fila que transcreve as mensagens de voz recebidas pelo
+// Transcriber configurado. A fila é a própria tabela mensagens
+// (status_transcricao), reservada com SKIP LOCKED.
+type TranscricaoService struct {
+	db            *gorm.DB
+	midias        *MidiaService
+	transcritor   Transcriber
+	realtime      *RealtimeService
+	duracaoMaxima float64
+	aoTranscrever func(*models.Mensagem)
+	stop          chan struct{}
+	sinal         chan struct{}
+}
+
+func NewTranscricaoService(db *gorm.DB, midias *MidiaService, transcritor Transcriber, realtime *RealtimeService, cfg *config.Config) *TranscricaoService {
+	return &TranscricaoService{
+		db:            db,
+		midias:        midias,
+		transcritor:   transcritor,
+		realtime:      realtime,
+		duracaoMaxima: float64(cfg.TranscriptionMaxSeconds),
+		sinal:         make(chan struct{}, 1),
+	}
+}
+
+// Configurado indica se o servidor tem um provedor de transcrição
+func (s *TranscricaoService) Configurado() bool {
+	return s.transcritor != nil
+}
+
+// Provedor nome do provedor configurado ("" quando desativado)
+func (s *TranscricaoService) Provedor() string {
+	if s.transcritor == nil {
+		return ""
+	}
+	return s.transcritor.Nome()
+}
+
+// AoTranscrever registra quem recebe cada mensagem transcrita (ex: agente de IA)
+func (s *TranscricaoService) AoTranscrever(fn func(*models.Mensagem)) {
+	s.aoTranscrever = fn
+}
+
+// Iniciar processa a fila em background. Além do intervalo, a fila é
+// processada logo após cada mensagem enfileirada.
+func (s *TranscricaoService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil || s.transcritor == nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[TRANSCRICAO] Fila de transcrição iniciada (provedor: %s, intervalo: %s)", s.transcritor.Nome(), intervalo)
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.sinal:
+			case <-s.stop:
+				log.Printf("[TRANSCRICAO] Fila de transcrição finalizada")
+				return
+			}
+			s.processarFila()
+		}
+	}()
+}
+
+// Parar interrompe o processamento da fila
+func (s *TranscricaoService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *TranscricaoService) acordar() {
+	select {
+	case s.sinal <- struct{}{}:
+	default:
+	}
+}
+
+// EnfileirarRecebida envia para transcrição a mensagem de voz recebida cuja
+// mídia acabou de ser guardada, se a organização ativou a transcrição.
+// Mensagens antigas (importação de histórico) ficam para o pedido manual.
+func (s *TranscricaoService) EnfileirarRecebida(organizacaoID, idMensagem string) error {
+	if s.transcritor == nil || organizacaoID == "" {
+		return nil
+	}
+
+	var organizacao models.Organizacao
+	err := s.db.Select("id", "transcricao_audio_ativa").Where("id = ?", organizacaoID).First(&organizacao).Error
+	if err != nil {
+		return fmt.Errorf("erro ao buscar organização %s: %w", organizacaoID, err)
+	}
+	if !organizacao.TranscricaoAudioAtiva {
+		return nil
+	}
+
+	resultado := s.db.Model(&models.Mensagem{}).
+		Where("id_mensagem = ? AND tipo = ? AND de_mim = ?", idMensagem, models.TipoMensagemAudio, false).
+		Where("midia_id IS NOT NULL AND status_transcricao IS NULL AND timestamp >= ?", time.Now().Add(-janelaTranscricaoAutomatica)).
+		Updates(map[string]interface{}{
+			"status_transcricao":     models.StatusTranscricaoPendente,
+			"tentativas_transcricao": 0,
+			"proxima_transcricao_em": nil,
+		})
+	if resultado.Error != nil {
+		return fmt.Errorf("erro ao enfileirar transcrição da mensagem %s: %w", idMensagem, resultado.Error)
+	}
+	if resultado.RowsAffected > 0 {
+		s.acordar()
+	}
+	return nil
+}
+
+// BuscarMensagem mensagem gravada do chat na sessão
+func (s *TranscricaoService) BuscarMensagem(nomeSessao, chatID, idMensagem string) (*models.Mensagem, error) {
+	var mensagem models.Mensagem
+	err := s.db.Joins("JOIN conversas ON conversas.id = mensagens.conversa_id").
+		Joins("JOIN sessoes_whatsapp ON sessoes_whatsapp.id = conversas.sessao_whatsapp_id").
+		Where("mensagens.id_mensagem = ? AND conversas.id_conversa = ? AND sessoes_whatsapp.nome_sessao = ?", idMensagem, chatID, nomeSessao).
+		First(&mensagem).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMensagemNaoEncontrada
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar mensagem: %w", err)
+	}
+	return &mensagem, nil
+}
+
+// Transcrever (re)envia a mensagem para a fila, independente da organização
+// ter a transcrição automática ativa
+func (s *TranscricaoService) Transcrever(mensagem *models.Mensagem) error {
+	if s.transcritor == nil {
+		return ErrTranscricaoDesativada
+	}
+	if mensagem.MidiaID == nil || mensagem.Tipo != models.TipoMensagemAudio {
+		return ErrMensagemSemAudio
+	}
+
+	err := s.db.Model(&models.Mensagem{}).Where("id = ?", mensagem.ID).Updates(map[string]interface{}{
+		"status_transcricao":     models.StatusTranscricaoPendente,
+		"tentativas_transcricao": 0,
+		"proxima_transcricao_em": nil,
+		"erro_transcricao":       nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("erro ao enfileirar transcrição: %w", err)
+	}
+	s.acordar()
+	return nil
+}
+
+// DefinirOrganizacao liga ou desliga a transcrição automática da organização.
+// Idioma vazio deixa o provedor detectar o idioma de cada áudio.
+func (s *TranscricaoService) DefinirOrganizacao(organizacaoID string, ativa bool, idioma string) (*models.Organizacao, error) {
+	if ativa && s.transcritor == nil {
+		return nil, ErrTranscricaoDesativada
+	}
+
+	var valorIdioma interface{}
+	if idioma = strings.ToLower(strings.TrimSpace(idioma)); idioma != "" {
+		valorIdioma = idioma
+	}
+	err := s.db.Model(&models.Organizacao{}).Where("id = ?", organizacaoID).Updates(map[string]interface{}{
+		"transcricao_audio_ativa": ativa,
+		"idioma_transcricao":      valorIdioma,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("erro ao salvar transcrição da organização: %w", err)
+	}
+
+	var organizacao models.Organizacao
+	if err := s.db.Where("id = ?", organizacaoID).First(&organizacao).Error; err != nil {
+		return nil, err
+	}
+	return &organizacao, nil
+}
+
+// processarFila processa os lotes de mensagens pendentes até esvaziar a fila
+func (s *TranscricaoService) processarFila() {
+	for {
+		mensagens, err := s.reservarLote()
+		if err != nil {
+			log.Printf("[TRANSCRICAO] Erro ao buscar mensagens pendentes: %v", err)
+			return
+		}
+		if len(mensagens) == 0 {
+			return
+		}
+
+		for i := range mensagens {
+			s.processarMensagem(&mensagens[i])
+		}
+
+		if len(mensagens) < transcricaoLote {
+			return
+		}
+	}
+}
+
+// reservarLote trava as próximas mensagens pendentes e adia a próxima
+// tentativa pelo tempo de reserva, para que outras instâncias não as
+// transcrevam em paralelo
+func (s *TranscricaoService) reservarLote() ([]models.Mensagem, error) {
+	var mensagens []models.Mensagem
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		agora := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status_transcricao = ?", models.StatusTranscricaoPendente).
+			Where("proxima_transcricao_em IS NULL OR proxima_transcricao_em <= ?", agora).
+			Order("timestamp DESC").
+			Limit(transcricaoLote).
+			Find(&mensagens).Error
+		if err != nil || len(mensagens) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(mensagens))
+		for i := range mensagens {
+			ids[i] = mensagens[i].ID
+		}
+		return tx.Model(&models.Mensagem{}).Where("id IN ?", ids).
+			Update("proxima_transcricao_em", agora.Add(transcricaoReserva)).Error
+	})
+	return mensagens, err
+}
+
+func (s *TranscricaoService) processarMensagem(mensagem *models.Mensagem) {
+	inicio := time.Now()
+	resultado, status, err := s.transcrever(mensagem)
+
+	agora := time.Now()
+	updates := map[string]interface{}{}
+	if err == nil {
+		updates["status_transcricao"] = status
+		updates["proxima_transcricao_em"] = nil
+		updates["erro_transcricao"] = nil
+		if resultado != nil {
+			updates["transcricao"] = resultado.Texto
+			updates["idioma_transcricao"] = resultado.Idioma
+			updates["transcrita_em"] = agora
+			mensagem.Transcricao = &resultado.Texto
+			mensagem.IdiomaTranscricao = &resultado.Idioma
+			mensagem.TranscritaEm = &agora
+		}
+		log.Printf("[TRANSCRICAO] Mensagem %s: %s em %s", mensagem.ID, status, time.Since(inicio).Round(time.Millisecond))
+	} else {
+		tentativas := mensagem.TentativasTranscricao + 1
+		erro := err.Error()
+		updates["tentativas_transcricao"] = tentativas
+		updates["erro_transcricao"] = erro
+		if tentativas >= transcricaoTentativas {
+			updates["status_transcricao"] = models.StatusTranscricaoFalhou
+			updates["proxima_transcricao_em"] = nil
+		} else {
+			updates["proxima_transcricao_em"] = agora.Add(time.Duration(tentativas*tentativas) * time.Minute)
+		}
+		log.Printf("[TRANSCRICAO] Erro ao transcrever mensagem %s (tentativa %d): %v", mensagem.ID, tentativas, err)
+	}
+
+	if err := s.db.Model(&models.Mensagem{}).Where("id = ?", mensagem.ID).Updates(updates).Error; err != nil {
+		log.Printf("[TRANSCRICAO] Erro ao salvar transcrição da mensagem %s: %v", mensagem.ID, err)
+		return
+	}
+
+	if status == models.StatusTranscricaoConcluida && resultado != nil {
+		s.publicar(mensagem)
+		if s.aoTranscrever != nil {
+			s.aoTranscrever(mensagem)
+		}
+	}
+}
+
+// transcrever lê o áudio da mensagem e chama o provedor. Áudios removidos,
+// longos demais ou sem fala terminam como IGNORADA.
+func (s *TranscricaoService) transcrever(mensagem *models.Mensagem) (*ResultadoTranscricao, models.StatusTranscricao, error) {
+	if mensagem.MidiaID == nil {
+		return nil, models.StatusTranscricaoIgnorada, nil
+	}
+	midia, err := s.midias.Buscar("", *mensagem.MidiaID)
+	if errors.Is(err, ErrMidiaNaoEncontrada) {
+		return nil, models.StatusTranscricaoIgnorada, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if s.duracaoMaxima > 0 && midia.DuracaoSegundos != nil && *midia.DuracaoSegundos > s.duracaoMaxima {
+		return nil, models.StatusTranscricaoIgnorada, nil
+	}
+
+	var organizacao models.Organizacao
+	if err := s.db.Select("id", "idioma_transcricao").Where("id = ?", midia.OrganizacaoID).First(&organizacao).Error; err != nil {
+		return nil, "", fmt.Errorf("erro ao buscar organização da mídia: %w", err)
+	}
+	idioma := ""
+	if organizacao.IdiomaTranscricao != nil {
+		idioma = *organizacao.IdiomaTranscricao
+	}
+
+	dados, err := s.midias.Ler(midia)
+	if err != nil {
+		return nil, "", fmt.Errorf("erro ao ler áudio: %w", err)
+	}
+
+	ctx, cancelar := context.WithTimeout(context.Background(), transcricaoTimeout)
+	defer cancelar()
+	resultado, err := s.transcritor.Transcrever(ctx, dados, midia.TipoMime, idioma)
+	if err != nil {
+		return nil, "", err
+	}
+	if resultado.Texto == "" {
+		return nil, models.StatusTranscricaoIgnorada, nil
+	}
+	return resultado, models.StatusTranscricaoConcluida, nil
+}
+
+// publicar avisa o dono da sessão pelo websocket para atualizar a mensagem na tela
+func (s *TranscricaoService) publicar(mensagem *models.Mensagem) {
+	if s.realtime == nil {
+		return
+	}
+
+	var destino struct {
+		ChatID    string
+		UsuarioID string
+	}
+	err := s.db.Table("conversas").
+		Select("conversas.id_conversa AS chat_id, sessoes_whatsapp.usuario_id").
+		Joins("JOIN sessoes_whatsapp ON sessoes_whatsapp.id = conversas.sessao_whatsapp_id").
+		Where("conversas.id = ?", mensagem.ConversaID).
+		Scan(&destino).Error
+	if err != nil || destino.UsuarioID == "" {
+		return
+	}
+
+	s.realtime.PublishToUser(destino.UsuarioID, "message_transcription", map[string]interface{}{
+		"id":                mensagem.IDMensagem,
+		"chatId":            destino.ChatID,
+		"transcricao":       mensagem.Transcricao,
+		"idiomaTranscricao": mensagem.IdiomaTranscricao,
+	})
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"strings"
+
+	"tappyone/internal/config"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ResultadoTranscricao texto reconhecido e idioma (ISO 639-1) detectado
+type ResultadoTranscricao struct {
+	Texto  string
+	Idioma string
+}
+
+// Transcriber converte a fala de um áudio em texto. Idioma vazio pede ao
+// provedor que detecte o idioma.
+type Transcriber interface {
+	Nome() string
+	Transcrever(ctx context.Context, audio []byte, tipoMime, idioma string) (*ResultadoTranscricao, error)
+}
+
+// NewTranscriber cria o provedor configurado em TRANSCRIPTION_PROVIDER; sem
+// provedor retorna nil (transcrição desativada). O whisper.cpp só lê WAV, então
+// recebe o conversor de áudio da fila de mídia.
+func NewTranscriber(cfg *config.Config, processamento *ProcessamentoMidiaService) (Transcriber, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.TranscriptionProvider)) {
+	case "":
+		return nil, nil
+	case "whisper-http", "openai":
+		return &WhisperHTTPTranscriber{
+			url:    cfg.WhisperAPIURL,
+			chave:  cfg.WhisperAPIKey,
+			modelo: cfg.WhisperModel,
+			client: &http.Client{Timeout: transcricaoTimeout},
+		}, nil
+	case "whisper-cpp", "whisper.cpp":
+		if cfg.WhisperCppModel == "" {
+			return nil, fmt.Errorf("WHISPER_CPP_MODEL não informado")
+		}
+		binario, err := exec.LookPath(cfg.WhisperCppPath)
+		if err != nil {
+			return nil, fmt.Errorf("whisper.cpp não encontrado (%s): %w", cfg.WhisperCppPath, err)
+		}
+		return &WhisperCppTranscriber{binario: binario, modelo: cfg.WhisperCppModel, processamento: processamento}, nil
+	default:
+		return nil, fmt.Errorf("provedor de transcrição desconhecido: %s", cfg.TranscriptionProvider)
+	}
+}
+
+// WhisperHTTPTranscriber usa a API /audio/transcriptions da OpenAI ou de um
+// servidor compatível (faster-whisper-server, LocalAI...)
+type WhisperHTTPTranscriber struct {
+	url    string
+	chave  string
+	modelo string
+	client *http.Client
+}
+
+func (t *WhisperHTTPTranscriber) Nome() string {
+	return "whisper-http"
+}
+
+func (t *WhisperHTTPTranscriber) Transcrever(ctx context.Context, audio []byte, tipoMime, idioma string) (*ResultadoTranscricao, error) {
+	// A API identifica o formato pela extensão do arquivo
+	extensao := ".ogg"
+	if tipo := mimetype.Lookup(strings.SplitN(tipoMime, ";", 2)[0]); tipo != nil && tipo.Extension() != "" {
+		extensao = tipo.Extension()
+	}
+
+	var corpo bytes.Buffer
+	formulario := multipart.NewWriter(&corpo)
+	cabecalho := make(textproto.MIMEHeader)
+	cabecalho.Set("Content-Disposition", `form-data; name="file"; filename="audio`+extensao+`"`)
+	cabecalho.Set("Content-Type", tipoMime)
+	arquivo, err := formulario.CreatePart(cabecalho)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := arquivo.Write(audio); err != nil {
+		return nil, err
+	}
+	formulario.WriteField("model", t.modelo)
+	formulario.WriteField("response_format", "verbose_json")
+	if idioma != "" {
+		formulario.WriteField("language", idioma)
+	}
+	if err := formulario.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url+"/audio/transcriptions", &corpo)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", formulario.FormDataContentType())
+	if t.chave != "" {
+		req.Header.Set("Authorization", "Bearer "+t.chave)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao chamar API de transcrição: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detalhe, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("API de transcrição retornou %d: %s", resp.StatusCode, strings.TrimSpace(string(detalhe)))
+	}
+
+	var resultado struct {
+		Text     string `json:"text"`
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&resultado); err != nil {
+		return nil, fmt.Errorf("resposta de transcrição inválida: %w", err)
+	}
+
+	return &ResultadoTranscricao{
+		Texto:  strings.TrimSpace(resultado.Text),
+		Idioma: codigoIdioma(resultado.Language, idioma),
+	}, nil
+}
+
+// WhisperCppTranscriber roda o whisper.cpp (whisper-cli) localmente. O áudio é
+// convertido para WAV 16 kHz mono com o ffmpeg antes da transcrição.
+type WhisperCppTranscriber struct {
+	binario       string
+	modelo        string
+	processamento *ProcessamentoMidiaService
+}
+
+func (t *WhisperCppTranscriber) Nome() string {
+	return "whisper-cpp"
+}
+
+func (t *WhisperCppTranscriber) Transcrever(ctx context.Context, audio []byte, tipoMime, idioma string) (*ResultadoTranscricao, error) {
+	wav, err := t.processamento.ConverterParaWAV(audio)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao converter áudio para WAV: %w", err)
+	}
+
+	entrada, err := arquivoTemporario(wav)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(entrada)
+
+	// -oj grava <saida>.json com o idioma detectado e os segmentos
+	saida := entrada + "-transcricao"
+	defer os.Remove(saida + ".json")
+
+	if idioma == "" {
+		idioma = "auto"
+	}
+	cmd := exec.CommandContext(ctx, t.binario, "-m", t.modelo, "-f", entrada, "-l", idioma, "-oj", "-of", saida, "-np", "-nt")
+	var erros bytes.Buffer
+	cmd.Stderr = &erros
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper.cpp falhou: %v: %s", err, strings.TrimSpace(erros.String()))
+	}
+
+	conteudo, err := os.ReadFile(saida + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler saída do whisper.cpp: %w", err)
+	}
+	var resultado struct {
+		Result struct {
+			Language string `json:"language"`
+		} `json:"result"`
+		Transcription []struct {
+			Text string `json:"text"`
+		} `json:"transcription"`
+	}
+	if err := json.Unmarshal(conteudo, &resultado); err != nil {
+		return nil, fmt.Errorf("saída do whisper.cpp inválida: %w", err)
+	}
+
+	trechos := make([]string, 0, len(resultado.Transcription))
+	for _, segmento := range resultado.Transcription {
+		if texto := strings.TrimSpace(segmento.Text); texto != "" {
+			trechos = append(trechos, texto)
+		}
+	}
+	if idioma == "auto" {
+		idioma = ""
+	}
+	return &ResultadoTranscricao{
+		Texto:  strings.Join(trechos, " "),
+		Idioma: codigoIdioma(resultado.Result.Language, idioma),
+	}, nil
+}
+
+// A API da OpenAI devolve o nome do idioma em inglês no verbose_json
+var codigosIdioma = map[string]string{
+	"portuguese": "pt", "english": "en", "spanish": "es", "french": "fr",
+	"german": "de", "italian": "it", "dutch": "nl", "russian": "ru",
+	"chinese": "zh", "japanese": "ja", "korean": "ko", "arabic": "ar",
+	"hindi": "hi", "turkish": "tr", "polish": "pl", "ukrainian": "uk",
+}
+
+// codigoIdioma normaliza o idioma detectado para ISO 639-1; sem detecção usa o
+// idioma pedido
+func codigoIdioma(detectado, pedido string) string {
+	detectado = strings.ToLower(strings.TrimSpace(detectado))
+	if codigo, ok := codigosIdioma[detectado]; ok {
+		return codigo
+	}
+	if detectado == "" {
+		return pedido
+	}
+	return detectado
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// executarComTrava executa fn apenas quando obtém a advisory lock do Postgres
+// de nome informado. Com várias réplicas do servidor, só uma executa cada
+// rodada dos avaliadores em background; as demais pulam a rodada. Retorna
+// false quando outra réplica já está executando.
+func executarComTrava(db *gorm.DB, nome string, fn func() error) (bool, error) {
+	executou := false
+	err := db.Connection(func(conn *gorm.DB) error {
+		var obtida bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(hashtext(?))", nome).Scan(&obtida).Error; err != nil {
+			return err
+		}
+		if !obtida {
+			return nil
+		}
+		// A trava é da conexão: a liberação precisa usar a mesma conexão
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", nome).Error; err != nil {
+				log.Printf("[TRAVA] Erro ao liberar trava %s: %v", nome, err)
+			}
+		}()
+
+		executou = true
+		return fn()
+	})
+	return executou, err
+}
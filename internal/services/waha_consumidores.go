@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tappyone/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Evento de gatilho de fluxo disparado por mensagem recebida
+const GatilhoFluxoMensagemRecebida = "mensagem_recebida"
+
+// SincronizarStatusSessao consumidor de session.status: atualiza o status e
+// os horários de conexão da sessão local
+func (s *WhatsAppService) SincronizarStatusSessao(evento *EventoWAHA) error {
+	if evento.StatusSessao == nil || evento.StatusSessao.Status == "" {
+		return fmt.Errorf("status não encontrado no evento session.status")
+	}
+	status := evento.StatusSessao.Status
+	log.Printf("[WHATSAPP] Sessão %s mudou para %s", evento.Sessao, status)
+
+	if evento.SessaoWhatsApp == nil {
+		return nil
+	}
+	if err := s.sessoes.AtualizarStatus(evento.SessaoWhatsApp, models.StatusSessaoDoWAHA(status), status, models.OrigemEventoSessaoWebhook); err != nil {
+		return fmt.Errorf("erro ao atualizar status da sessão: %w", err)
+	}
+	return nil
+}
+
+// ProcessarEventoWAHA consumidor de mensagens recebidas: dispara as respostas
+// rápidas do dono da sessão
+func (s *RespostaRapidaService) ProcessarEventoWAHA(evento *EventoWAHA) error {
+	mensagem := evento.Mensagem
+	if mensagem == nil || mensagem.FromMe || mensagem.TipoMensagem() != models.TipoMensagemTexto {
+		return nil
+	}
+	usuarioID, err := uuid.Parse(evento.UsuarioID)
+	if err != nil {
+		return nil
+	}
+
+	chatID := mensagem.ChatID()
+	return s.ProcessarMensagemRecebida(
+		usuarioID,
+		chatID,
+		mensagem.Body,
+		mensagem.NomeContato(),
+		strings.SplitN(chatID, "@", 2)[0],
+	)
+}
+
+// DispararPorMensagem consumidor de mensagens recebidas: executa os fluxos
+// ativos do usuário cujo gatilho é "mensagem_recebida" e, quando configurada,
+// cuja palavra-chave está presente no texto
+func (s *FluxoExecutionService) DispararPorMensagem(evento *EventoWAHA) error {
+	mensagem := evento.Mensagem
+	if mensagem == nil || mensagem.FromMe || evento.UsuarioID == "" {
+		return nil
+	}
+
+	var gatilhos []models.FluxoNo
+	err := s.DB.Joins("JOIN fluxos ON fluxos.id = fluxo_nos.fluxo_id").
+		Where("fluxo_nos.tipo = ? AND fluxos.ativo = ?", "trigger", true).
+		Where("fluxos.quadro_id IN (SELECT id FROM quadros WHERE usuario_id = ?)", evento.UsuarioID).
+		Where("fluxo_nos.configuracao->>'evento' = ?", GatilhoFluxoMensagemRecebida).
+		Find(&gatilhos).Error
+	if err != nil {
+		return fmt.Errorf("erro ao buscar fluxos com gatilho de mensagem: %w", err)
+	}
+
+	chatID := mensagem.ChatID()
+	texto := strings.ToLower(mensagem.Body)
+	for _, gatilho := range gatilhos {
+		if palavra, _ := gatilho.Configuracao["palavraChave"].(string); palavra != "" && !strings.Contains(texto, strings.ToLower(palavra)) {
+			continue
+		}
+
+		dados := map[string]interface{}{
+			"chat_id":      chatID,
+			"mensagem":     mensagem.Body,
+			"mensagem_id":  mensagem.ID,
+			"nome_contato": mensagem.NomeContato(),
+			"sessao":       evento.Sessao,
+		}
+		if contatoID := s.contatoDoChat(evento.OrganizacaoID, chatID); contatoID != "" {
+			dados["contato_id"] = contatoID
+		}
+
+		// Fluxos podem ter nós de espera, por isso não bloqueiam o worker
+		go func(fluxoID string) {
+			if err := s.ExecuteFluxo(fluxoID, evento.UsuarioID, dados); err != nil {
+				log.Printf("[FLUXO] Erro ao executar fluxo %s disparado por mensagem: %v", fluxoID, err)
+			}
+		}(gatilho.FluxoID)
+	}
+	return nil
+}
+
+func (s *FluxoExecutionService) contatoDoChat(organizacaoID, chatID string) string {
+	if organizacaoID == "" {
+		return ""
+	}
+	var contato models.Contato
+	err := s.DB.Select("id").
+		Where("organizacao_id = ? AND (numero_telefone = ? OR contactid = ?)", organizacaoID, strings.SplitN(chatID, "@", 2)[0], chatID).
+		First(&contato).Error
+	if err != nil {
+		return ""
+	}
+	return contato.ID
+}
+
+// PublicarEventoWAHA consumidor de mensagens recebidas: publica o evento
+// mensagem.recebida para os webhooks de saída da organização
+func (s *WebhookService) PublicarEventoWAHA(evento *EventoWAHA) error {
+	mensagem := evento.Mensagem
+	if mensagem == nil || mensagem.FromMe || evento.OrganizacaoID == "" {
+		return nil
+	}
+
+	dados := map[string]interface{}{
+		"sessao":     evento.Sessao,
+		"mensagemId": mensagem.ID,
+		"chatId":     mensagem.ChatID(),
+		"texto":      mensagem.Body,
+		"tipo":       mensagem.TipoMidia(),
+		"timestamp":  mensagem.Timestamp,
+		"temMidia":   mensagem.HasMedia,
+	}
+	if nome := mensagem.NomeContato(); nome != "" {
+		dados["nomeContato"] = nome
+	}
+	return s.enfileirar(evento.OrganizacaoID, models.EventoMensagemRecebida, dados)
+}
+
+// RepassarEventoWAHA consumidor que encaminha mensagens, acks, reações,
+// presença e mudanças de sessão para o websocket do dono da sessão, com os
+// mesmos tipos de evento usados pelo hub (new_message, message_status, presence)
+func (s *RealtimeService) RepassarEventoWAHA(evento *EventoWAHA) error {
+	if evento.UsuarioID == "" {
+		return nil
+	}
+
+	var tipo string
+	var dados interface{}
+	switch {
+	case evento.Mensagem != nil:
+		tipo, dados = "new_message", evento.Mensagem
+	case evento.Ack != nil:
+		tipo, dados = "message_status", map[string]interface{}{
+			"id":     evento.Ack.ID,
+			"ack":    evento.Ack.Ack,
+			"status": StatusMensagemDoAck(evento.Ack.Ack),
+		}
+	case evento.Presenca != nil:
+		tipo, dados = "presence", evento.Presenca
+	case evento.Reacao != nil:
+		tipo, dados = "message_reaction", evento.Reacao
+	case evento.Revogacao != nil:
+		tipo, dados = "message_revoked", evento.Revogacao
+	case evento.StatusSessao != nil:
+		tipo, dados = "session_status", map[string]string{"sessao": evento.Sessao, "status": evento.StatusSessao.Status}
+	default:
+		return nil
+	}
+	return s.PublishToUser(evento.UsuarioID, tipo, dados)
+}
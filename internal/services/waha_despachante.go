@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+// OrigemWebhookWAHA origem única dos eventos do WAHA. As rotas antigas
+// (/webhooks/whatsapp e /webhooks/resposta-rapida) recebem no mesmo fluxo,
+// assim um evento enviado para as duas é processado uma única vez.
+const OrigemWebhookWAHA = "waha"
+
+// ConsumidorWAHA trata um evento despachado. Um erro não interrompe os demais
+// consumidores, mas envia o evento para a tabela de falhas.
+type ConsumidorWAHA func(evento *EventoWAHA) error
+
+// ErroConsumidoresWAHA falha de um ou mais consumidores no despacho de um
+// evento. Guarda os nomes para que o reprocessamento chame apenas esses.
+type ErroConsumidoresWAHA struct {
+	Consumidores []string
+	Erro         error
+}
+
+func (e *ErroConsumidoresWAHA) Error() string {
+	return e.Erro.Error()
+}
+
+func (e *ErroConsumidoresWAHA) Unwrap() error {
+	return e.Erro
+}
+
+type assinaturaWAHA struct {
+	nome       string
+	tipos      map[string]bool
+	consumidor ConsumidorWAHA
+}
+
+// DespachanteWAHA decodifica os eventos do WAHA, identifica a sessão, o
+// usuário e a organização e entrega o evento aos consumidores assinantes
+type DespachanteWAHA struct {
+	db          *gorm.DB
+	sessoes     *repositories.SessaoWhatsAppRepository
+	mutex       sync.RWMutex
+	assinaturas []assinaturaWAHA
+}
+
+func NewDespachanteWAHA(db *gorm.DB) *DespachanteWAHA {
+	return &DespachanteWAHA{
+		db:      db,
+		sessoes: repositories.NewSessaoWhatsAppRepository(db),
+	}
+}
+
+// Assinar registra um consumidor para os tipos de evento informados (todos,
+// quando nenhum é informado). Consumidores são chamados na ordem de registro.
+func (d *DespachanteWAHA) Assinar(nome string, consumidor ConsumidorWAHA, tipos ...string) {
+	assinatura := assinaturaWAHA{nome: nome, consumidor: consumidor}
+	if len(tipos) > 0 {
+		assinatura.tipos = make(map[string]bool, len(tipos))
+		for _, tipo := range tipos {
+			assinatura.tipos[tipo] = true
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.assinaturas = append(d.assinaturas, assinatura)
+}
+
+// Processar decodifica e despacha o corpo bruto de um evento. Tem a
+// assinatura de ProcessadorWebhook para ser registrado na fila de ingestão.
+func (d *DespachanteWAHA) Processar(corpo []byte, consumidores []string) error {
+	evento, err := DecodificarEventoWAHA(corpo)
+	if err != nil {
+		return err
+	}
+	if err := d.resolverSessao(evento); err != nil {
+		return err
+	}
+	return d.DespacharPara(evento, consumidores)
+}
+
+// Despachar entrega o evento a todos os consumidores assinantes do seu tipo
+func (d *DespachanteWAHA) Despachar(evento *EventoWAHA) error {
+	return d.DespacharPara(evento, nil)
+}
+
+// DespacharPara entrega o evento apenas aos consumidores informados (todos os
+// assinantes, quando nenhum é informado). Falhas retornam *ErroConsumidoresWAHA.
+func (d *DespachanteWAHA) DespacharPara(evento *EventoWAHA, consumidores []string) error {
+	d.mutex.RLock()
+	assinaturas := make([]assinaturaWAHA, len(d.assinaturas))
+	copy(assinaturas, d.assinaturas)
+	d.mutex.RUnlock()
+
+	var selecionados map[string]bool
+	if len(consumidores) > 0 {
+		selecionados = make(map[string]bool, len(consumidores))
+		for _, nome := range consumidores {
+			selecionados[nome] = true
+		}
+	}
+
+	var falha ErroConsumidoresWAHA
+	var erros []error
+	for _, assinatura := range assinaturas {
+		if assinatura.tipos != nil && !assinatura.tipos[evento.Tipo] {
+			continue
+		}
+		if selecionados != nil && !selecionados[assinatura.nome] {
+			continue
+		}
+		if err := consumirWAHA(assinatura, evento); err != nil {
+			log.Printf("[WEBHOOK_WAHA] Consumidor %s falhou no evento %s da sessão %s: %v", assinatura.nome, evento.Tipo, evento.Sessao, err)
+			erros = append(erros, fmt.Errorf("%s: %w", assinatura.nome, err))
+			falha.Consumidores = append(falha.Consumidores, assinatura.nome)
+		}
+	}
+	if len(erros) == 0 {
+		return nil
+	}
+	falha.Erro = errors.Join(erros...)
+	return &falha
+}
+
+// consumirWAHA chama o consumidor convertendo panics em erro, para que um
+// consumidor com defeito não impeça os demais de receber o evento
+func consumirWAHA(assinatura assinaturaWAHA, evento *EventoWAHA) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[WEBHOOK_WAHA] Panic no consumidor %s: %v\n%s", assinatura.nome, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return assinatura.consumidor(evento)
+}
+
+// resolverSessao preenche a sessão, o usuário e a organização do evento. A
+// sessão é buscada pelo nome; sessões do WAHA no formato legado user_{uuid}
+// sem registro local são registradas com o mesmo nome para o usuário.
+func (d *DespachanteWAHA) resolverSessao(evento *EventoWAHA) error {
+	if evento.Sessao == "" {
+		return nil
+	}
+
+	sessao, err := d.sessoes.BuscarPorNome(evento.Sessao)
+	if err == nil {
+		evento.SessaoWhatsApp = sessao
+		evento.UsuarioID = sessao.UsuarioID
+		evento.OrganizacaoID = sessao.OrganizacaoID
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("erro ao buscar sessão %s: %w", evento.Sessao, err)
+	}
+
+	if !strings.HasPrefix(evento.Sessao, "user_") {
+		log.Printf("[WEBHOOK_WAHA] Sessão %s desconhecida, evento %s sem usuário", evento.Sessao, evento.Tipo)
+		return nil
+	}
+
+	var usuario models.Usuario
+	err = d.db.Select("id", "organizacao_id").
+		Where("id = ?", strings.TrimPrefix(evento.Sessao, "user_")).
+		First(&usuario).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("[WEBHOOK_WAHA] Usuário da sessão %s não encontrado", evento.Sessao)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao buscar usuário da sessão %s: %w", evento.Sessao, err)
+	}
+
+	evento.UsuarioID = usuario.ID
+	evento.OrganizacaoID = usuario.OrganizacaoID
+	if usuario.OrganizacaoID == "" {
+		return nil
+	}
+
+	legada, err := d.sessoes.SessaoLegada(usuario.OrganizacaoID, usuario.ID)
+	if err != nil {
+		return fmt.Errorf("erro ao registrar sessão %s: %w", evento.Sessao, err)
+	}
+	evento.SessaoWhatsApp = legada
+	return nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tappyone/internal/models"
+)
+
+// Tipos de evento enviados pelo WAHA
+const (
+	EventoWAHAMensagem         = "message"
+	EventoWAHAMensagemQualquer = "message.any" // inclui as enviadas pelo próprio número
+	EventoWAHAAck              = "message.ack"
+	EventoWAHAReacao           = "message.reaction"
+	EventoWAHARevogada         = "message.revoked"
+	EventoWAHAStatusSessao     = "session.status"
+	EventoWAHAPresenca         = "presence.update"
+
+	EventoWAHAGrupoEntrada       = "group.join"
+	EventoWAHAGrupoSaida         = "group.leave"
+	EventoWAHAGrupoV2Entrada     = "group.v2.join"
+	EventoWAHAGrupoV2Saida       = "group.v2.leave"
+	EventoWAHAGrupoV2Atualizacao = "group.v2.update"
+	EventoWAHAGrupoV2Membros     = "group.v2.participants"
+
+	EventoWAHAChamadaRecebida = "call.received"
+	EventoWAHAChamadaAceita   = "call.accepted"
+	EventoWAHAChamadaRecusada = "call.rejected"
+)
+
+// Valores de ack do WAHA
+const (
+	AckWAHAErro     = -1
+	AckWAHAPendente = 0
+	AckWAHAServidor = 1
+	AckWAHAEntregue = 2
+	AckWAHALido     = 3
+	AckWAHATocado   = 4
+)
+
+// ContaWAHA número conectado à sessão
+type ContaWAHA struct {
+	ID       string `json:"id"`
+	PushName string `json:"pushName"`
+}
+
+// MidiaWAHA mídia anexada a uma mensagem
+type MidiaWAHA struct {
+	URL      string `json:"url"`
+	Mimetype string `json:"mimetype"`
+	Filename string `json:"filename"`
+	Erro     string `json:"error"`
+}
+
+// MensagemWAHA mensagem dos eventos message, message.any e message.revoked
+type MensagemWAHA struct {
+	ID          string     `json:"id"`
+	Timestamp   int64      `json:"timestamp"`
+	From        string     `json:"from"`
+	FromMe      bool       `json:"fromMe"`
+	To          string     `json:"to"`
+	Participant string     `json:"participant"`
+	Body        string     `json:"body"`
+	Type        string     `json:"type"`
+	HasMedia    bool       `json:"hasMedia"`
+	Media       *MidiaWAHA `json:"media"`
+	Ack         int        `json:"ack"`
+	ReplyTo     *struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+	} `json:"replyTo"`
+	Dados map[string]interface{} `json:"_data"`
+}
+
+// ChatID conversa da mensagem: o destinatário quando enviada pelo próprio número
+func (m *MensagemWAHA) ChatID() string {
+	if m.FromMe {
+		return m.To
+	}
+	return m.From
+}
+
+// Remetente quem enviou a mensagem recebida: o participante nos grupos
+func (m *MensagemWAHA) Remetente() string {
+	if m.Participant != "" {
+		return m.Participant
+	}
+	return m.From
+}
+
+// NomeContato nome de exibição do remetente, quando informado pelo WhatsApp
+func (m *MensagemWAHA) NomeContato() string {
+	if nome, ok := m.Dados["notifyName"].(string); ok {
+		return nome
+	}
+	return ""
+}
+
+// TipoMidia tipo da mensagem, deduzido do mimetype quando o engine não informa
+func (m *MensagemWAHA) TipoMidia() string {
+	if m.Type != "" && m.Type != "chat" {
+		return m.Type
+	}
+	if m.Media == nil || m.Media.Mimetype == "" {
+		if m.HasMedia {
+			return "document"
+		}
+		return "text"
+	}
+	switch {
+	case strings.HasPrefix(m.Media.Mimetype, "image/"):
+		return "image"
+	case strings.HasPrefix(m.Media.Mimetype, "video/"):
+		return "video"
+	case strings.HasPrefix(m.Media.Mimetype, "audio/ogg"):
+		return "voice"
+	case strings.HasPrefix(m.Media.Mimetype, "audio/"):
+		return "audio"
+	default:
+		return "document"
+	}
+}
+
+// Horario instante da mensagem
+func (m *MensagemWAHA) Horario() time.Time {
+	if m.Timestamp <= 0 {
+		return time.Now()
+	}
+	return time.Unix(m.Timestamp, 0)
+}
+
+// TipoMensagem tipo equivalente no modelo local
+func (m *MensagemWAHA) TipoMensagem() models.TipoMensagem {
+	switch m.TipoMidia() {
+	case "image", "sticker":
+		return models.TipoMensagemImagem
+	case "video":
+		return models.TipoMensagemVideo
+	case "audio", "voice", "ptt":
+		return models.TipoMensagemAudio
+	case "document":
+		return models.TipoMensagemArquivo
+	case "location":
+		return models.TipoMensagemLocalizacao
+	case "vcard", "multi_vcard":
+		return models.TipoMensagemContato
+	case "poll_creation":
+		return models.TipoMensagemEnquete
+	default:
+		return models.TipoMensagemTexto
+	}
+}
+
+// AckWAHA confirmação de envio/entrega/leitura (message.ack)
+type AckWAHA struct {
+	ID          string `json:"id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Participant string `json:"participant"`
+	FromMe      bool   `json:"fromMe"`
+	Ack         int    `json:"ack"`
+	AckName     string `json:"ackName"`
+}
+
+// ReacaoWAHA reação a uma mensagem (message.reaction)
+type ReacaoWAHA struct {
+	ID          string `json:"id"`
+	From        string `json:"from"`
+	FromMe      bool   `json:"fromMe"`
+	To          string `json:"to"`
+	Participant string `json:"participant"`
+	Timestamp   int64  `json:"timestamp"`
+	Reaction    struct {
+		Text      string `json:"text"` // vazio quando a reação é removida
+		MessageID string `json:"messageId"`
+	} `json:"reaction"`
+}
+
+// RevogacaoWAHA mensagem apagada para todos (message.revoked)
+type RevogacaoWAHA struct {
+	RevokedMessageID string        `json:"revokedMessageId"`
+	After            *MensagemWAHA `json:"after"`
+	Before           *MensagemWAHA `json:"before"`
+}
+
+// StatusSessaoWAHA mudança de estado da sessão (session.status)
+type StatusSessaoWAHA struct {
+	Status string `json:"status"` // STARTING, SCAN_QR_CODE, WORKING, FAILED, STOPPED
+}
+
+// PresencaWAHA presença dos participantes de um chat (presence.update)
+type PresencaWAHA struct {
+	ID        string `json:"id"`
+	Presences []struct {
+		Participant       string `json:"participant"`
+		LastKnownPresence string `json:"lastKnownPresence"` // online, offline, typing, recording, paused
+		LastSeen          *int64 `json:"lastSeen"`
+	} `json:"presences"`
+}
+
+// GrupoWAHA eventos de grupo (group.* e group.v2.*)
+type GrupoWAHA struct {
+	ID           string   `json:"id"`
+	Tipo         string   `json:"type"` // join, leave, promote, demote (group.v2.participants)
+	Participants []string `json:"participants"`
+	Timestamp    int64    `json:"timestamp"`
+}
+
+// ChamadaWAHA chamada de voz ou vídeo (call.*)
+type ChamadaWAHA struct {
+	ID        string `json:"id"`
+	From      string `json:"from"`
+	Timestamp int64  `json:"timestamp"`
+	IsVideo   bool   `json:"isVideo"`
+	IsGroup   bool   `json:"isGroup"`
+}
+
+// EventoWAHA evento decodificado. Apenas o campo correspondente ao Tipo é
+// preenchido; tipos desconhecidos ficam só com o Payload bruto.
+type EventoWAHA struct {
+	ID        string          `json:"id"`
+	Tipo      string          `json:"event"`
+	Sessao    string          `json:"session"`
+	Timestamp int64           `json:"timestamp"`
+	Me        *ContaWAHA      `json:"me"`
+	Payload   json.RawMessage `json:"payload"`
+
+	Mensagem     *MensagemWAHA     `json:"-"`
+	Ack          *AckWAHA          `json:"-"`
+	Reacao       *ReacaoWAHA       `json:"-"`
+	Revogacao    *RevogacaoWAHA    `json:"-"`
+	StatusSessao *StatusSessaoWAHA `json:"-"`
+	Presenca     *PresencaWAHA     `json:"-"`
+	Grupo        *GrupoWAHA        `json:"-"`
+	Chamada      *ChamadaWAHA      `json:"-"`
+
+	// Preenchidos pelo despachante a partir do nome da sessão
+	SessaoWhatsApp *models.SessaoWhatsApp `json:"-"`
+	UsuarioID      string                 `json:"-"`
+	OrganizacaoID  string                 `json:"-"`
+}
+
+// DecodificarEventoWAHA converte o corpo recebido no evento tipado. Aceita o
+// formato atual do WAHA (payload) e o antigo (data).
+func DecodificarEventoWAHA(corpo []byte) (*EventoWAHA, error) {
+	var envelope struct {
+		EventoWAHA
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(corpo, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEventoWebhookInvalido, err)
+	}
+
+	evento := envelope.EventoWAHA
+	if evento.Tipo == "" {
+		return nil, fmt.Errorf("%w: evento sem tipo", ErrEventoWebhookInvalido)
+	}
+	if len(evento.Payload) == 0 || string(evento.Payload) == "null" {
+		evento.Payload = envelope.Data
+	}
+	if len(evento.Payload) == 0 {
+		return &evento, nil
+	}
+
+	var destino interface{}
+	switch {
+	case evento.Tipo == EventoWAHAMensagem || evento.Tipo == EventoWAHAMensagemQualquer:
+		evento.Mensagem = &MensagemWAHA{}
+		destino = evento.Mensagem
+	case evento.Tipo == EventoWAHAAck:
+		evento.Ack = &AckWAHA{}
+		destino = evento.Ack
+	case evento.Tipo == EventoWAHAReacao:
+		evento.Reacao = &ReacaoWAHA{}
+		destino = evento.Reacao
+	case evento.Tipo == EventoWAHARevogada:
+		evento.Revogacao = &RevogacaoWAHA{}
+		destino = evento.Revogacao
+	case evento.Tipo == EventoWAHAStatusSessao:
+		evento.StatusSessao = &StatusSessaoWAHA{}
+		destino = evento.StatusSessao
+	case evento.Tipo == EventoWAHAPresenca:
+		evento.Presenca = &PresencaWAHA{}
+		destino = evento.Presenca
+	case strings.HasPrefix(evento.Tipo, "group."):
+		evento.Grupo = decodificarGrupoWAHA(evento.Payload)
+		return &evento, nil
+	case strings.HasPrefix(evento.Tipo, "call."):
+		evento.Chamada = &ChamadaWAHA{}
+		destino = evento.Chamada
+	default:
+		return &evento, nil
+	}
+
+	if err := json.Unmarshal(evento.Payload, destino); err != nil {
+		return nil, fmt.Errorf("%w: payload de %s: %v", ErrEventoWebhookInvalido, evento.Tipo, err)
+	}
+	return &evento, nil
+}
+
+// decodificarGrupoWAHA normaliza os formatos de grupo: os eventos v2 trazem o
+// grupo aninhado e participantes como objetos, os antigos trazem apenas ids
+func decodificarGrupoWAHA(payload json.RawMessage) *GrupoWAHA {
+	var bruto struct {
+		ID     interface{} `json:"id"`
+		ChatID string      `json:"chatId"`
+		Group  *struct {
+			ID string `json:"id"`
+		} `json:"group"`
+		Type         string        `json:"type"`
+		Timestamp    int64         `json:"timestamp"`
+		Participants []interface{} `json:"participants"`
+		Recipients   []string      `json:"recipientIds"`
+	}
+	grupo := &GrupoWAHA{}
+	if err := json.Unmarshal(payload, &bruto); err != nil {
+		return grupo
+	}
+
+	grupo.Tipo = bruto.Type
+	grupo.Timestamp = bruto.Timestamp
+	switch {
+	case bruto.Group != nil:
+		grupo.ID = bruto.Group.ID
+	case bruto.ChatID != "":
+		grupo.ID = bruto.ChatID
+	default:
+		if id, ok := bruto.ID.(string); ok {
+			grupo.ID = id
+		}
+	}
+
+	for _, participante := range bruto.Participants {
+		switch p := participante.(type) {
+		case string:
+			grupo.Participants = append(grupo.Participants, p)
+		case map[string]interface{}:
+			if id, ok := p["id"].(string); ok {
+				grupo.Participants = append(grupo.Participants, id)
+			}
+		}
+	}
+	grupo.Participants = append(grupo.Participants, bruto.Recipients...)
+	return grupo
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"tappyone/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Status de mensagem que podem ser substituídos por cada status, para que um
+// ack atrasado não faça a mensagem voltar de LIDO para ENTREGUE
+var statusAnterioresMensagem = map[models.StatusMensagem][]models.StatusMensagem{
+	models.StatusMensagemEnviado:  {models.StatusMensagemPendente},
+	models.StatusMensagemEntregue: {models.StatusMensagemPendente, models.StatusMensagemEnviado},
+	models.StatusMensagemLido:     {models.StatusMensagemPendente, models.StatusMensagemEnviado, models.StatusMensagemEntregue},
+	models.StatusMensagemFalhou:   {models.StatusMensagemPendente},
+}
+
+// StatusMensagemDoAck converte o ack do WAHA no status local da mensagem
+func StatusMensagemDoAck(ack int) models.StatusMensagem {
+	switch {
+	case ack <= AckWAHAErro:
+		return models.StatusMensagemFalhou
+	case ack == AckWAHAPendente:
+		return models.StatusMensagemPendente
+	case ack == AckWAHAServidor:
+		return models.StatusMensagemEnviado
+	case ack == AckWAHAEntregue:
+		return models.StatusMensagemEntregue
+	default:
+		return models.StatusMensagemLido
+	}
+}
+
+// PersistirEventoWAHA consumidor que grava as mensagens recebidas e enviadas
+// e atualiza o status das enviadas a partir dos acks
+func (s *MessageService) PersistirEventoWAHA(evento *EventoWAHA) error {
+	if evento.SessaoWhatsApp == nil {
+		return nil
+	}
+
+	switch {
+	case evento.Mensagem != nil:
+		_, err := s.SalvarMensagemWAHA(evento.SessaoWhatsApp, evento.Mensagem)
+		return err
+	case evento.Ack != nil:
+		return s.AtualizarStatusMensagem(evento.Ack.ID, StatusMensagemDoAck(evento.Ack.Ack))
+	}
+	return nil
+}
+
+// SalvarMensagemWAHA grava a mensagem na conversa do chat, criando a conversa
+// quando necessário. É idempotente: mensagens já gravadas são retornadas sem
+// alteração, o que permite receber o mesmo evento por message e message.any.
+func (s *MessageService) SalvarMensagemWAHA(sessao *models.SessaoWhatsApp, mensagem *MensagemWAHA) (*models.Mensagem, error) {
+	return s.salvarMensagemWAHA(sessao, mensagem, false)
+}
+
+// ImportarMensagemWAHA igual a SalvarMensagemWAHA para mensagens antigas: não
+// conta como não lida nem desarquiva a conversa
+func (s *MessageService) ImportarMensagemWAHA(sessao *models.SessaoWhatsApp, mensagem *MensagemWAHA) (*models.Mensagem, error) {
+	return s.salvarMensagemWAHA(sessao, mensagem, true)
+}
+
+func (s *MessageService) salvarMensagemWAHA(sessao *models.SessaoWhatsApp, mensagem *MensagemWAHA, importada bool) (*models.Mensagem, error) {
+	chatID := mensagem.ChatID()
+	if mensagem.ID == "" || chatID == "" || chatID == "status@broadcast" {
+		return nil, nil
+	}
+
+	var salva models.Mensagem
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		conversa, err := s.conversaDoChat(tx, sessao, chatID, mensagem)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("id_mensagem = ? AND conversa_id = ?", mensagem.ID, conversa.ID).First(&salva).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		salva = models.Mensagem{
+			IDMensagem: mensagem.ID,
+			ConversaID: conversa.ID,
+			DeMim:      mensagem.FromMe,
+			Tipo:       mensagem.TipoMensagem(),
+			Status:     models.StatusMensagemEntregue,
+			Timestamp:  mensagem.Horario(),
+		}
+		if mensagem.FromMe {
+			salva.Status = StatusMensagemDoAck(mensagem.Ack)
+		} else if remetente := mensagem.Remetente(); remetente != "" {
+			salva.Remetente = &remetente
+		}
+		if mensagem.Body != "" {
+			corpo := mensagem.Body
+			if salva.Tipo == models.TipoMensagemTexto {
+				salva.Conteudo = &corpo
+			} else {
+				salva.Legenda = &corpo
+			}
+		}
+		if mensagem.Media != nil && mensagem.Media.URL != "" {
+			url := mensagem.Media.URL
+			salva.UrlMidia = &url
+		}
+		if mensagem.ReplyTo != nil && mensagem.ReplyTo.ID != "" {
+			var original models.Mensagem
+			if tx.Select("id").Where("id_mensagem = ? AND conversa_id = ?", mensagem.ReplyTo.ID, conversa.ID).First(&original).Error == nil {
+				salva.RespostaParaID = &original.ID
+			}
+		}
+		if err := tx.Create(&salva).Error; err != nil {
+			return err
+		}
+
+		resumo := resumoMensagem(mensagem)
+		updates := map[string]interface{}{
+			"ultima_mensagem":         resumo,
+			"horario_ultima_mensagem": salva.Timestamp,
+		}
+		if !importada {
+			updates["arquivada"] = false
+			if !mensagem.FromMe {
+				updates["mensagens_nao_lidas"] = gorm.Expr("mensagens_nao_lidas + 1")
+			}
+		}
+		return tx.Model(&models.Conversa{}).
+			Where("id = ? AND (horario_ultima_mensagem IS NULL OR horario_ultima_mensagem <= ?)", conversa.ID, salva.Timestamp).
+			Updates(updates).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao salvar mensagem %s: %w", mensagem.ID, err)
+	}
+	return &salva, nil
+}
+
+// conversaDoChat busca a conversa do chat na sessão, criando-a e vinculando o
+// contato da organização com o mesmo número quando ainda não existe
+func (s *MessageService) conversaDoChat(tx *gorm.DB, sessao *models.SessaoWhatsApp, chatID string, mensagem *MensagemWAHA) (*models.Conversa, error) {
+	var conversa models.Conversa
+	err := tx.Where("id_conversa = ? AND sessao_whatsapp_id = ?", chatID, sessao.ID).First(&conversa).Error
+	if err == nil {
+		return &conversa, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	conversa = models.Conversa{
+		IDConversa:       chatID,
+		EhGrupo:          strings.HasSuffix(chatID, "@g.us"),
+		SessaoWhatsappID: sessao.ID,
+	}
+	if nome := mensagem.NomeContato(); nome != "" && !mensagem.FromMe && !conversa.EhGrupo {
+		conversa.Nome = &nome
+	}
+	if !conversa.EhGrupo && sessao.OrganizacaoID != "" {
+		numero := strings.SplitN(chatID, "@", 2)[0]
+		var contato models.Contato
+		err := tx.Select("id").
+			Where("organizacao_id = ? AND (numero_telefone = ? OR contactid = ?)", sessao.OrganizacaoID, numero, chatID).
+			First(&contato).Error
+		if err == nil {
+			conversa.ContatoID = &contato.ID
+		}
+	}
+	if err := tx.Create(&conversa).Error; err != nil {
+		return nil, err
+	}
+	if conversa.ContatoID != nil && sessao.FilaPadraoID != nil {
+		if err := entrarFilaPadrao(tx, *conversa.ContatoID, *sessao.FilaPadraoID); err != nil {
+			return nil, err
+		}
+	}
+	return &conversa, nil
+}
+
+// entrarFilaPadrao coloca o contato na fila padrão da sessão quando ele ainda
+// não está em nenhuma fila
+func entrarFilaPadrao(tx *gorm.DB, contatoID, filaID string) error {
+	var total int64
+	if err := tx.Model(&models.FilaContato{}).Where("contato_id = ? AND ativo = ?", contatoID, true).Count(&total).Error; err != nil {
+		return err
+	}
+	if total > 0 {
+		return nil
+	}
+	return tx.Create(&models.FilaContato{FilaID: filaID, ContatoID: contatoID, Ativo: true}).Error
+}
+
+// AtualizarStatusMensagem aplica o novo status apenas se ele avança o atual
+func (s *MessageService) AtualizarStatusMensagem(idMensagem string, status models.StatusMensagem) error {
+	anteriores, ok := statusAnterioresMensagem[status]
+	if idMensagem == "" || !ok {
+		return nil
+	}
+	return s.db.Model(&models.Mensagem{}).
+		Where("id_mensagem = ? AND status IN ?", idMensagem, anteriores).
+		Update("status", status).Error
+}
+
+// AtualizarMidiaMensagem troca a URL temporária do WAHA pela URL da mídia salva
+func (s *MessageService) AtualizarMidiaMensagem(idMensagem, url string) error {
+	return s.db.Model(&models.Mensagem{}).
+		Where("id_mensagem = ?", idMensagem).
+		Update("url_midia", url).Error
+}
+
+// resumoMensagem texto exibido como última mensagem da conversa
+func resumoMensagem(mensagem *MensagemWAHA) string {
+	if mensagem.Body != "" {
+		return mensagem.Body
+	}
+	switch mensagem.TipoMensagem() {
+	case models.TipoMensagemImagem:
+		return "📷 Imagem"
+	case models.TipoMensagemVideo:
+		return "🎥 Vídeo"
+	case models.TipoMensagemAudio:
+		return "🎤 Áudio"
+	case models.TipoMensagemArquivo:
+		return "📄 Documento"
+	case models.TipoMensagemLocalizacao:
+		return "📍 Localização"
+	case models.TipoMensagemContato:
+		return "👤 Contato"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,790 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrWebhookURLInvalida    = errors.New("URL do webhook inválida: use http ou https")
+	ErrWebhookDestinoInterno = errors.New("URL do webhook inválida: destino em rede interna não é permitido")
+	ErrWebhookEventoInvalido = errors.New("evento de webhook inválido")
+	ErrWebhookInativo        = errors.New("webhook desativado")
+)
+
+const (
+	webhookSegredoPrefixo = "whsec_"
+
+	// Retry com backoff exponencial: 30s, 1min, 2min... limitado a 6h
+	webhookBackoffBase   = 30 * time.Second
+	webhookBackoffMaximo = 6 * time.Hour
+	webhookMaxTentativas = 8
+
+	// Tentativas com erro seguidas (entre todas as entregas) até desativar o webhook
+	webhookLimiteFalhas = 20
+
+	webhookTimeout         = 10 * time.Second
+	webhookLote            = 20
+	webhookConcorrencia    = 5
+	webhookReserva         = 2 * time.Minute // impede que outra instância pegue a mesma entrega
+	webhookTamanhoResposta = 256             // trecho da resposta do destino guardado na entrega
+)
+
+// redeCGNAT faixa 100.64.0.0/10, usada por provedores e redes internas de nuvem
+var redeCGNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// NovoWebhookRequest dados para cadastrar um webhook
+type NovoWebhookRequest struct {
+	Nome    string   `json:"nome" binding:"required"`
+	URL     string   `json:"url" binding:"required"`
+	Eventos []string `json:"eventos" binding:"required"`
+}
+
+// AtualizarWebhookRequest campos alteráveis de um webhook
+type AtualizarWebhookRequest struct {
+	Nome    *string  `json:"nome"`
+	URL     *string  `json:"url"`
+	Eventos []string `json:"eventos"`
+	Ativo   *bool    `json:"ativo"`
+}
+
+// FiltroEntregasWebhook filtros do log de entregas
+type FiltroEntregasWebhook struct {
+	WebhookID string
+	Status    string
+	Evento    string
+	Page      int
+	Limit     int
+}
+
+// eventoWebhook corpo enviado no POST ao destino
+type eventoWebhook struct {
+	ID            string      `json:"id"`
+	Evento        string      `json:"evento"`
+	OrganizacaoID string      `json:"organizacaoId"`
+	CriadoEm      time.Time   `json:"criadoEm"`
+	Dados         interface{} `json:"dados"`
+}
+
+// WebhookService publica eventos do CRM para os webhooks das organizações.
+// As entregas ficam em entregas_webhook, que funciona como fila persistente
+// processada em background com retry e backoff.
+type WebhookService struct {
+	db     *gorm.DB
+	client *http.Client
+	stop   chan struct{}
+	sinal  chan struct{}
+}
+
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		client: novoClienteWebhook(),
+		sinal:  make(chan struct{}, 1),
+	}
+}
+
+// Iniciar processa a fila de entregas em background. Além do intervalo, a
+// fila é processada logo após cada evento publicado.
+func (s *WebhookService) Iniciar(intervalo time.Duration) {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		log.Printf("[WEBHOOK] Fila de entregas iniciada (intervalo: %s)", intervalo)
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.sinal:
+			case <-s.stop:
+				log.Printf("[WEBHOOK] Fila de entregas finalizada")
+				return
+			}
+			s.processarFila()
+		}
+	}()
+}
+
+// Parar interrompe o processamento da fila
+func (s *WebhookService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Publicar enfileira o evento para os webhooks ativos da organização que o
+// assinam. Não bloqueia quem chama; erros são apenas registrados em log.
+func (s *WebhookService) Publicar(organizacaoID, evento string, dados interface{}) {
+	if s == nil || organizacaoID == "" {
+		return
+	}
+	go func() {
+		if err := s.enfileirar(organizacaoID, evento, dados); err != nil {
+			log.Printf("[WEBHOOK] Erro ao publicar evento %s da organização %s: %v", evento, organizacaoID, err)
+		}
+	}()
+}
+
+func (s *WebhookService) enfileirar(organizacaoID, evento string, dados interface{}) error {
+	var webhooks []models.Webhook
+	if err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("ativo = ?", true).Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	var destinos []models.Webhook
+	for _, webhook := range webhooks {
+		if webhook.Eventos.Inclui(evento) {
+			destinos = append(destinos, webhook)
+		}
+	}
+	if len(destinos) == 0 {
+		return nil
+	}
+
+	agora := time.Now()
+	eventoID := uuid.New().String()
+	payload, err := json.Marshal(eventoWebhook{
+		ID:            eventoID,
+		Evento:        evento,
+		OrganizacaoID: organizacaoID,
+		CriadoEm:      agora,
+		Dados:         dados,
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento: %w", err)
+	}
+
+	entregas := make([]models.EntregaWebhook, 0, len(destinos))
+	for _, webhook := range destinos {
+		entregas = append(entregas, models.EntregaWebhook{
+			WebhookID:          webhook.ID,
+			OrganizacaoID:      organizacaoID,
+			EventoID:           eventoID,
+			Evento:             evento,
+			Payload:            payload,
+			Status:             models.StatusEntregaPendente,
+			ProximaTentativaEm: &agora,
+		})
+	}
+	if err := s.db.Create(&entregas).Error; err != nil {
+		return fmt.Errorf("erro ao enfileirar entregas: %w", err)
+	}
+
+	s.acordar()
+	return nil
+}
+
+func (s *WebhookService) acordar() {
+	select {
+	case s.sinal <- struct{}{}:
+	default:
+	}
+}
+
+// Listar retorna os webhooks da organização
+func (s *WebhookService) Listar(organizacaoID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Order("criado_em DESC").
+		Find(&webhooks).Error
+	return webhooks, err
+}
+
+// Buscar retorna um webhook da organização
+func (s *WebhookService) Buscar(organizacaoID, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("id = ?", id).First(&webhook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Criar cadastra o webhook e retorna o segredo de assinatura, exibido uma única vez
+func (s *WebhookService) Criar(organizacaoID, usuarioID string, req NovoWebhookRequest) (*models.Webhook, string, error) {
+	destino, err := validarURLWebhook(req.URL)
+	if err != nil {
+		return nil, "", err
+	}
+	eventos, err := validarEventosWebhook(req.Eventos)
+	if err != nil {
+		return nil, "", err
+	}
+	segredo, err := gerarSegredoWebhook()
+	if err != nil {
+		return nil, "", err
+	}
+
+	webhook := &models.Webhook{
+		OrganizacaoID: organizacaoID,
+		Nome:          strings.TrimSpace(req.Nome),
+		URL:           destino,
+		Segredo:       segredo,
+		Eventos:       eventos,
+		Ativo:         true,
+	}
+	if usuarioID != "" {
+		webhook.CriadoPor = &usuarioID
+	}
+	if err := s.db.Create(webhook).Error; err != nil {
+		return nil, "", fmt.Errorf("erro ao salvar webhook: %w", err)
+	}
+
+	log.Printf("[WEBHOOK] Webhook %s criado na organização %s (%s)", webhook.ID, organizacaoID, webhook.URL)
+	return webhook, segredo, nil
+}
+
+// Atualizar altera o webhook. Reativar um webhook zera o contador de falhas.
+func (s *WebhookService) Atualizar(organizacaoID, id string, req AtualizarWebhookRequest) (*models.Webhook, error) {
+	webhook, err := s.Buscar(organizacaoID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Nome != nil {
+		updates["nome"] = strings.TrimSpace(*req.Nome)
+	}
+	if req.URL != nil {
+		destino, err := validarURLWebhook(*req.URL)
+		if err != nil {
+			return nil, err
+		}
+		updates["url"] = destino
+	}
+	if req.Eventos != nil {
+		eventos, err := validarEventosWebhook(req.Eventos)
+		if err != nil {
+			return nil, err
+		}
+		updates["eventos"] = eventos
+	}
+	if req.Ativo != nil {
+		updates["ativo"] = *req.Ativo
+		if *req.Ativo && !webhook.Ativo {
+			updates["falhas_consecutivas"] = 0
+			updates["desativado_em"] = nil
+			updates["motivo_desativacao"] = nil
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(webhook).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("erro ao atualizar webhook: %w", err)
+		}
+	}
+
+	return s.Buscar(organizacaoID, id)
+}
+
+// Excluir remove o webhook e cancela as entregas pendentes. O log de
+// entregas já realizadas é mantido.
+func (s *WebhookService) Excluir(organizacaoID, id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(repositories.PorOrganizacao(organizacaoID)).
+			Where("id = ?", id).Delete(&models.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&models.EntregaWebhook{}).
+			Where("webhook_id = ? AND status = ?", id, models.StatusEntregaPendente).
+			Updates(map[string]interface{}{
+				"status":               models.StatusEntregaCancelada,
+				"proxima_tentativa_em": nil,
+			}).Error
+	})
+}
+
+// RotacionarSegredo gera um novo segredo de assinatura, exibido uma única vez
+func (s *WebhookService) RotacionarSegredo(organizacaoID, id string) (string, error) {
+	webhook, err := s.Buscar(organizacaoID, id)
+	if err != nil {
+		return "", err
+	}
+	segredo, err := gerarSegredoWebhook()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Model(webhook).Update("segredo", segredo).Error; err != nil {
+		return "", fmt.Errorf("erro ao salvar segredo: %w", err)
+	}
+	return segredo, nil
+}
+
+// Testar envia um evento webhook.teste imediatamente e retorna o resultado da entrega
+func (s *WebhookService) Testar(organizacaoID, id string) (*models.EntregaWebhook, error) {
+	webhook, err := s.Buscar(organizacaoID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	agora := time.Now()
+	eventoID := uuid.New().String()
+	payload, err := json.Marshal(eventoWebhook{
+		ID:            eventoID,
+		Evento:        models.EventoWebhookTeste,
+		OrganizacaoID: organizacaoID,
+		CriadoEm:      agora,
+		Dados:         map[string]interface{}{"webhookId": webhook.ID, "mensagem": "Evento de teste do TappyOne"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reservada desde a criação: a entrega é feita aqui, não pela fila
+	reserva := agora.Add(webhookReserva)
+	entrega := &models.EntregaWebhook{
+		WebhookID:          webhook.ID,
+		OrganizacaoID:      organizacaoID,
+		EventoID:           eventoID,
+		Evento:             models.EventoWebhookTeste,
+		Payload:            payload,
+		Status:             models.StatusEntregaPendente,
+		ProximaTentativaEm: &reserva,
+	}
+	if err := s.db.Create(entrega).Error; err != nil {
+		return nil, fmt.Errorf("erro ao registrar entrega: %w", err)
+	}
+
+	// O teste não conta para a desativação automática nem é reenviado
+	s.enviar(webhook, entrega)
+	s.finalizarEntrega(entrega, 1)
+	return entrega, nil
+}
+
+// ListarEntregas retorna o log de entregas da organização
+func (s *WebhookService) ListarEntregas(organizacaoID string, filtro FiltroEntregasWebhook) ([]models.EntregaWebhook, int64, error) {
+	query := s.db.Model(&models.EntregaWebhook{}).Scopes(repositories.PorOrganizacao(organizacaoID))
+
+	if filtro.WebhookID != "" {
+		query = query.Where("webhook_id = ?", filtro.WebhookID)
+	}
+	if filtro.Status != "" {
+		query = query.Where("status = ?", filtro.Status)
+	}
+	if filtro.Evento != "" {
+		query = query.Where("evento = ?", filtro.Evento)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("erro ao contar entregas: %w", err)
+	}
+
+	if filtro.Page < 1 {
+		filtro.Page = 1
+	}
+	if filtro.Limit < 1 || filtro.Limit > 100 {
+		filtro.Limit = 20
+	}
+
+	var entregas []models.EntregaWebhook
+	err := query.Order("criado_em DESC").
+		Offset((filtro.Page - 1) * filtro.Limit).
+		Limit(filtro.Limit).
+		Find(&entregas).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("erro ao buscar entregas: %w", err)
+	}
+
+	return entregas, total, nil
+}
+
+// Reenviar cria uma nova entrega com o mesmo evento (mesmo EventoID, para que
+// o destino possa deduplicar) e a coloca no início da fila
+func (s *WebhookService) Reenviar(organizacaoID, entregaID string) (*models.EntregaWebhook, error) {
+	var original models.EntregaWebhook
+	if err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("id = ?", entregaID).First(&original).Error; err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.Buscar(organizacaoID, original.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+	if !webhook.Ativo {
+		return nil, ErrWebhookInativo
+	}
+
+	agora := time.Now()
+	entrega := &models.EntregaWebhook{
+		WebhookID:          original.WebhookID,
+		OrganizacaoID:      organizacaoID,
+		EventoID:           original.EventoID,
+		Evento:             original.Evento,
+		Payload:            original.Payload,
+		Status:             models.StatusEntregaPendente,
+		ProximaTentativaEm: &agora,
+		ReenvioDeID:        &original.ID,
+	}
+	if err := s.db.Create(entrega).Error; err != nil {
+		return nil, fmt.Errorf("erro ao reenviar entrega: %w", err)
+	}
+
+	s.acordar()
+	return entrega, nil
+}
+
+// processarFila entrega os lotes de entregas vencidas até esvaziar a fila
+func (s *WebhookService) processarFila() {
+	for {
+		entregas, err := s.reservarLote()
+		if err != nil {
+			log.Printf("[WEBHOOK] Erro ao buscar entregas pendentes: %v", err)
+			return
+		}
+		if len(entregas) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		vagas := make(chan struct{}, webhookConcorrencia)
+		for i := range entregas {
+			wg.Add(1)
+			vagas <- struct{}{}
+			go func(entrega *models.EntregaWebhook) {
+				defer wg.Done()
+				defer func() { <-vagas }()
+				s.processarEntrega(entrega)
+			}(&entregas[i])
+		}
+		wg.Wait()
+
+		if len(entregas) < webhookLote {
+			return
+		}
+	}
+}
+
+// reservarLote trava as próximas entregas vencidas e adia a próxima tentativa
+// pelo tempo de reserva, para que outras instâncias não as processem em paralelo
+func (s *WebhookService) reservarLote() ([]models.EntregaWebhook, error) {
+	var entregas []models.EntregaWebhook
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		agora := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND proxima_tentativa_em <= ?", models.StatusEntregaPendente, agora).
+			Order("proxima_tentativa_em ASC").
+			Limit(webhookLote).
+			Find(&entregas).Error
+		if err != nil || len(entregas) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(entregas))
+		for i := range entregas {
+			ids[i] = entregas[i].ID
+		}
+		return tx.Model(&models.EntregaWebhook{}).Where("id IN ?", ids).
+			Update("proxima_tentativa_em", agora.Add(webhookReserva)).Error
+	})
+	return entregas, err
+}
+
+func (s *WebhookService) processarEntrega(entrega *models.EntregaWebhook) {
+	var webhook models.Webhook
+	if err := s.db.Where("id = ?", entrega.WebhookID).First(&webhook).Error; err != nil || !webhook.Ativo {
+		motivo := "webhook excluído ou desativado"
+		s.db.Model(entrega).Updates(map[string]interface{}{
+			"status":               models.StatusEntregaCancelada,
+			"proxima_tentativa_em": nil,
+			"erro":                 motivo,
+		})
+		return
+	}
+
+	sucesso := s.enviar(&webhook, entrega)
+	s.finalizarEntrega(entrega, webhookMaxTentativas)
+
+	if entrega.Evento == models.EventoWebhookTeste {
+		return
+	}
+	if sucesso {
+		if webhook.FalhasConsecutivas > 0 {
+			s.db.Model(&webhook).Update("falhas_consecutivas", 0)
+		}
+		return
+	}
+	s.registrarFalha(&webhook)
+}
+
+// enviar faz o POST assinado e preenche o resultado da tentativa na entrega
+func (s *WebhookService) enviar(webhook *models.Webhook, entrega *models.EntregaWebhook) bool {
+	inicio := time.Now()
+	timestamp := strconv.FormatInt(inicio.Unix(), 10)
+
+	entrega.Tentativas++
+	entrega.UltimaTentativaEm = &inicio
+	entrega.StatusHTTP = nil
+	entrega.Resposta = nil
+	entrega.Erro = nil
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(entrega.Payload))
+	if err != nil {
+		erro := err.Error()
+		entrega.Erro = &erro
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TappyOne-Webhooks/1.0")
+	req.Header.Set("X-Tappy-Evento", entrega.Evento)
+	req.Header.Set("X-Tappy-Entrega", entrega.ID)
+	req.Header.Set("X-Tappy-Timestamp", timestamp)
+	req.Header.Set("X-Tappy-Assinatura", "sha256="+AssinarWebhook(webhook.Segredo, timestamp, entrega.Payload))
+
+	resp, err := s.client.Do(req)
+	entrega.DuracaoMs = time.Since(inicio).Milliseconds()
+	if err != nil {
+		erro := err.Error()
+		entrega.Erro = &erro
+		return false
+	}
+	defer resp.Body.Close()
+
+	// Guarda apenas o status e um trecho curto do corpo: o destino não controla
+	// o que fica armazenado nem o que é exibido no log de entregas
+	corpo, _ := io.ReadAll(io.LimitReader(resp.Body, webhookTamanhoResposta))
+	resposta := fmt.Sprintf("HTTP %d", resp.StatusCode)
+	if trecho := strings.TrimSpace(strings.ToValidUTF8(string(corpo), "")); trecho != "" {
+		resposta += ": " + trecho
+	}
+	statusHTTP := resp.StatusCode
+	entrega.StatusHTTP = &statusHTTP
+	entrega.Resposta = &resposta
+
+	if statusHTTP < 200 || statusHTTP >= 300 {
+		erro := fmt.Sprintf("destino respondeu HTTP %d", statusHTTP)
+		entrega.Erro = &erro
+		return false
+	}
+
+	agora := time.Now()
+	entrega.EntregueEm = &agora
+	return true
+}
+
+// finalizarEntrega grava o resultado da tentativa e agenda o próximo retry
+func (s *WebhookService) finalizarEntrega(entrega *models.EntregaWebhook, maxTentativas int) {
+	switch {
+	case entrega.EntregueEm != nil:
+		entrega.Status = models.StatusEntregaEntregue
+		entrega.ProximaTentativaEm = nil
+	case entrega.Tentativas >= maxTentativas:
+		entrega.Status = models.StatusEntregaFalhou
+		entrega.ProximaTentativaEm = nil
+	default:
+		proxima := time.Now().Add(backoffWebhook(entrega.Tentativas))
+		entrega.ProximaTentativaEm = &proxima
+	}
+
+	err := s.db.Model(entrega).Updates(map[string]interface{}{
+		"status":               entrega.Status,
+		"tentativas":           entrega.Tentativas,
+		"proxima_tentativa_em": entrega.ProximaTentativaEm,
+		"ultima_tentativa_em":  entrega.UltimaTentativaEm,
+		"entregue_em":          entrega.EntregueEm,
+		"status_http":          entrega.StatusHTTP,
+		"resposta":             entrega.Resposta,
+		"erro":                 entrega.Erro,
+		"duracao_ms":           entrega.DuracaoMs,
+	}).Error
+	if err != nil {
+		log.Printf("[WEBHOOK] Erro ao salvar resultado da entrega %s: %v", entrega.ID, err)
+	}
+}
+
+// registrarFalha incrementa as falhas seguidas e desativa o webhook ao atingir o limite
+func (s *WebhookService) registrarFalha(webhook *models.Webhook) {
+	var falhas int
+	err := s.db.Model(&models.Webhook{}).Where("id = ?", webhook.ID).
+		Update("falhas_consecutivas", gorm.Expr("falhas_consecutivas + 1")).Error
+	if err == nil {
+		err = s.db.Model(&models.Webhook{}).Where("id = ?", webhook.ID).
+			Select("falhas_consecutivas").Scan(&falhas).Error
+	}
+	if err != nil {
+		log.Printf("[WEBHOOK] Erro ao registrar falha do webhook %s: %v", webhook.ID, err)
+		return
+	}
+	if falhas < webhookLimiteFalhas {
+		return
+	}
+
+	motivo := fmt.Sprintf("desativado após %d tentativas de entrega com erro seguidas", falhas)
+	result := s.db.Model(&models.Webhook{}).Where("id = ? AND ativo = ?", webhook.ID, true).
+		Updates(map[string]interface{}{
+			"ativo":              false,
+			"desativado_em":      time.Now(),
+			"motivo_desativacao": motivo,
+		})
+	if result.Error == nil && result.RowsAffected > 0 {
+		log.Printf("[WEBHOOK] Webhook %s da organização %s %s", webhook.ID, webhook.OrganizacaoID, motivo)
+	}
+}
+
+// AssinarWebhook calcula o HMAC-SHA256 (hex) de "<timestamp>.<corpo>" com o
+// segredo do webhook. O destino valida recalculando com o header X-Tappy-Timestamp.
+func AssinarWebhook(segredo, timestamp string, corpo []byte) string {
+	mac := hmac.New(sha256.New, []byte(segredo))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(corpo)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func backoffWebhook(tentativas int) time.Duration {
+	espera := webhookBackoffBase
+	for i := 1; i < tentativas; i++ {
+		espera *= 2
+		if espera >= webhookBackoffMaximo {
+			return webhookBackoffMaximo
+		}
+	}
+	return espera
+}
+
+func gerarSegredoWebhook() (string, error) {
+	segredo := make([]byte, 32)
+	if _, err := rand.Read(segredo); err != nil {
+		return "", fmt.Errorf("erro ao gerar segredo: %w", err)
+	}
+	return webhookSegredoPrefixo + base64.RawURLEncoding.EncodeToString(segredo), nil
+}
+
+func validarURLWebhook(valor string) (string, error) {
+	valor = strings.TrimSpace(valor)
+	destino, err := url.Parse(valor)
+	if err != nil || destino.Host == "" || (destino.Scheme != "http" && destino.Scheme != "https") {
+		return "", ErrWebhookURLInvalida
+	}
+
+	// Nomes resolvidos são verificados de novo na conexão (novoClienteWebhook)
+	host := strings.ToLower(strings.TrimSuffix(destino.Hostname(), "."))
+	if hostInterno(host) {
+		return "", ErrWebhookDestinoInterno
+	}
+	if ip := net.ParseIP(host); ip != nil && enderecoInterno(ip) {
+		return "", ErrWebhookDestinoInterno
+	}
+	return valor, nil
+}
+
+// novoClienteWebhook cliente HTTP das entregas: recusa conexões a endereços
+// internos (validados após a resolução do DNS, na própria conexão), ignora
+// proxies do ambiente e não segue redirecionamentos
+func novoClienteWebhook() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, endereco string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(endereco)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || enderecoInterno(ip) {
+				return ErrWebhookDestinoInterno
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   webhookTimeout,
+			ResponseHeaderTimeout: webhookTimeout,
+			MaxIdleConnsPerHost:   webhookConcorrencia,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// hostInterno nomes que apontam para a própria máquina ou para a rede interna
+func hostInterno(host string) bool {
+	if host == "localhost" || host == "metadata.google.internal" {
+		return true
+	}
+	for _, sufixo := range []string{".localhost", ".internal", ".local", ".localdomain"} {
+		if strings.HasSuffix(host, sufixo) {
+			return true
+		}
+	}
+	return false
+}
+
+// enderecoInterno loopback, redes privadas (RFC 1918 e ULA), link-local
+// (inclui o metadata 169.254.169.254 das nuvens), CGNAT e endereços não roteáveis
+func enderecoInterno(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || redeCGNAT.Contains(ip) ||
+		(ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+func validarEventosWebhook(eventos []string) (models.ListaEventosWebhook, error) {
+	if len(eventos) == 0 {
+		return nil, errors.New("informe ao menos um evento")
+	}
+
+	lista := make(models.ListaEventosWebhook, 0, len(eventos))
+	vistos := map[string]bool{}
+	for _, evento := range eventos {
+		evento = strings.TrimSpace(evento)
+		if vistos[evento] {
+			continue
+		}
+		valido := evento == models.EventoWebhookTodos
+		for _, conhecido := range models.EventosWebhook {
+			if evento == conhecido {
+				valido = true
+				break
+			}
+		}
+		if !valido {
+			return nil, fmt.Errorf("%w: %s", ErrWebhookEventoInvalido, evento)
+		}
+		vistos[evento] = true
+		lista = append(lista, evento)
+	}
+	return lista, nil
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"tappyone/internal/config"
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEventoWebhookDuplicado = errors.New("evento já recebido")
+	ErrEventoWebhookInvalido  = errors.New("payload do webhook inválido")
+	ErrFilaWebhookCheia       = errors.New("fila de eventos cheia, tente novamente")
+)
+
+// Origens usadas antes do despachante único (OrigemWebhookWAHA); ainda
+// aparecem em eventos com falha gravados por versões anteriores
+const (
+	OrigemWebhookWhatsApp       = "whatsapp"
+	OrigemWebhookRespostaRapida = "resposta-rapida"
+)
+
+const webhookEntradaDedupePrefixo = "waha:evento:"
+
+// ProcessadorWebhook processa o corpo bruto de um evento recebido. Um erro
+// envia o evento para a tabela de falhas (dead-letter). Consumidores restringe
+// o processamento aos consumidores informados (no reprocessamento); vazio
+// processa todos.
+type ProcessadorWebhook func(corpo []byte, consumidores []string) error
+
+// FiltroFalhasWebhook filtros da listagem de eventos com falha
+type FiltroFalhasWebhook struct {
+	Origem string
+	Status string
+	Evento string
+	Page   int
+	Limit  int
+}
+
+// envelopeWAHA campos comuns a todos os eventos do WAHA
+type envelopeWAHA struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	Session   string                 `json:"session"`
+	Timestamp json.RawMessage        `json:"timestamp"`
+	Payload   map[string]interface{} `json:"payload"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// chaveDedupe identifica o evento para deduplicação. Mensagens usam o id da
+// mensagem (o WAHA pode reenviar a mesma mensagem com outro id de evento);
+// acks usam o id da mensagem e o valor do ack, para que entregue e lido não
+// se anulem; os demais eventos usam o id do evento ou o horário, já que o
+// mesmo objeto (ex.: presença de um chat) muda várias vezes.
+func (e envelopeWAHA) chaveDedupe() string {
+	dados := e.Payload
+	if dados == nil {
+		dados = e.Data
+	}
+	id, _ := dados["id"].(string)
+
+	switch {
+	case id != "" && (e.Event == "message" || e.Event == "message.any"):
+		return e.Event + ":" + e.Session + ":" + id
+	case id != "" && e.Event == "message.ack" && dados["ack"] != nil:
+		return e.Event + ":" + e.Session + ":" + id + ":" + fmt.Sprint(dados["ack"])
+	case e.ID != "":
+		return "evt:" + e.ID
+	case len(e.Timestamp) > 0 && string(e.Timestamp) != "null":
+		return e.Event + ":" + e.Session + ":" + id + ":" + strings.Trim(string(e.Timestamp), `"`)
+	}
+	return ""
+}
+
+type eventoWebhookRecebido struct {
+	origem   string
+	corpo    []byte
+	envelope envelopeWAHA
+}
+
+// IngestaoWebhookService recebe os webhooks do WAHA: deduplica, enfileira
+// para um número fixo de workers e guarda as falhas para reprocessamento
+type IngestaoWebhookService struct {
+	db    *gorm.DB
+	redis *redis.Client
+	ttl   time.Duration
+
+	fila    chan eventoWebhookRecebido
+	workers int
+	stop    chan struct{}
+
+	mutex         sync.RWMutex
+	processadores map[string]ProcessadorWebhook
+
+	// Deduplicação em memória quando o Redis não está disponível
+	mutexLocal sync.Mutex
+	vistos     map[string]time.Time
+}
+
+func NewIngestaoWebhookService(db *gorm.DB, redis *redis.Client, cfg *config.Config) *IngestaoWebhookService {
+	workers := cfg.WAHAWebhookWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	capacidade := cfg.WAHAWebhookQueueSize
+	if capacidade < 1 {
+		capacidade = 1000
+	}
+
+	return &IngestaoWebhookService{
+		db:            db,
+		redis:         redis,
+		ttl:           config.ParseDuration(cfg.WAHAWebhookDedupeTTL, 24*time.Hour),
+		fila:          make(chan eventoWebhookRecebido, capacidade),
+		workers:       workers,
+		processadores: make(map[string]ProcessadorWebhook),
+		vistos:        make(map[string]time.Time),
+	}
+}
+
+// RegistrarProcessador define quem processa os eventos recebidos pela origem
+func (s *IngestaoWebhookService) RegistrarProcessador(origem string, processador ProcessadorWebhook) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.processadores[origem] = processador
+}
+
+// Iniciar sobe os workers que consomem a fila de eventos
+func (s *IngestaoWebhookService) Iniciar() {
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	for i := 0; i < s.workers; i++ {
+		go func(stop chan struct{}) {
+			for {
+				select {
+				case evento := <-s.fila:
+					s.processar(evento)
+				case <-stop:
+					return
+				}
+			}
+		}(s.stop)
+	}
+	log.Printf("[WEBHOOK_WAHA] %d workers iniciados (fila: %d)", s.workers, cap(s.fila))
+}
+
+// Parar interrompe os workers; eventos ainda na fila são descartados e
+// serão reenviados pelo WAHA
+func (s *IngestaoWebhookService) Parar() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Receber valida, deduplica e enfileira o evento sem processá-lo. Retorna
+// ErrEventoWebhookDuplicado para eventos já recebidos e ErrFilaWebhookCheia
+// quando não há espaço na fila (o WAHA deve tentar de novo).
+func (s *IngestaoWebhookService) Receber(origem string, corpo []byte) error {
+	var envelope envelopeWAHA
+	if err := json.Unmarshal(corpo, &envelope); err != nil {
+		return ErrEventoWebhookInvalido
+	}
+
+	chave := envelope.chaveDedupe()
+	if chave != "" {
+		chave = webhookEntradaDedupePrefixo + origem + ":" + chave
+		if !s.marcarRecebido(chave) {
+			return ErrEventoWebhookDuplicado
+		}
+	}
+
+	select {
+	case s.fila <- eventoWebhookRecebido{origem: origem, corpo: corpo, envelope: envelope}:
+		return nil
+	default:
+		// Libera a chave para que o reenvio do WAHA seja aceito
+		if chave != "" {
+			s.desmarcarRecebido(chave)
+		}
+		log.Printf("[WEBHOOK_WAHA] Fila cheia, evento %s da sessão %s recusado", envelope.Event, envelope.Session)
+		return ErrFilaWebhookCheia
+	}
+}
+
+// marcarRecebido registra a chave e retorna false se ela já existia
+func (s *IngestaoWebhookService) marcarRecebido(chave string) bool {
+	if s.redis != nil {
+		novo, err := s.redis.SetNX(context.Background(), chave, 1, s.ttl).Result()
+		if err == nil {
+			return novo
+		}
+		log.Printf("[WEBHOOK_WAHA] Redis indisponível para deduplicação: %v", err)
+	}
+
+	agora := time.Now()
+	s.mutexLocal.Lock()
+	defer s.mutexLocal.Unlock()
+	for k, expira := range s.vistos {
+		if agora.After(expira) {
+			delete(s.vistos, k)
+		}
+	}
+	if _, existe := s.vistos[chave]; existe {
+		return false
+	}
+	s.vistos[chave] = agora.Add(s.ttl)
+	return true
+}
+
+func (s *IngestaoWebhookService) desmarcarRecebido(chave string) {
+	if s.redis != nil {
+		s.redis.Del(context.Background(), chave)
+	}
+	s.mutexLocal.Lock()
+	delete(s.vistos, chave)
+	s.mutexLocal.Unlock()
+}
+
+func (s *IngestaoWebhookService) processar(evento eventoWebhookRecebido) {
+	if err := s.executar(evento.origem, evento.corpo, nil); err != nil {
+		log.Printf("[WEBHOOK_WAHA] Erro ao processar evento %s da sessão %s: %v", evento.envelope.Event, evento.envelope.Session, err)
+		s.registrarFalha(evento, err)
+	}
+}
+
+// executar chama o processador da origem, convertendo panics em erro
+func (s *IngestaoWebhookService) executar(origem string, corpo []byte, consumidores []string) (err error) {
+	s.mutex.RLock()
+	processador := s.processadores[origem]
+	s.mutex.RUnlock()
+	if processador == nil {
+		return fmt.Errorf("nenhum processador registrado para %s", origem)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return processador(corpo, consumidores)
+}
+
+func (s *IngestaoWebhookService) registrarFalha(evento eventoWebhookRecebido, causa error) {
+	falha := models.EventoWebhookFalho{
+		Origem:        evento.origem,
+		Evento:        evento.envelope.Event,
+		Sessao:        evento.envelope.Session,
+		OrganizacaoID: s.organizacaoDaSessao(evento.envelope.Session),
+		Payload:       evento.corpo,
+		Erro:          causa.Error(),
+		Consumidores:  consumidoresComFalha(causa),
+		Tentativas:    1,
+		Status:        models.StatusFalhaWebhookPendente,
+	}
+	if evento.envelope.ID != "" {
+		falha.EventoID = &evento.envelope.ID
+	}
+	if err := s.db.Create(&falha).Error; err != nil {
+		log.Printf("[WEBHOOK_WAHA] Erro ao gravar evento com falha: %v", err)
+	}
+}
+
+// consumidoresComFalha nomes dos consumidores que falharam; nil quando a falha
+// ocorreu antes do despacho (ex.: payload inválido), caso em que todos rodam de novo
+func consumidoresComFalha(causa error) models.ListaConsumidoresWAHA {
+	var falha *ErroConsumidoresWAHA
+	if errors.As(causa, &falha) {
+		return falha.Consumidores
+	}
+	return nil
+}
+
+// organizacaoDaSessao resolve a organização pela sessão cadastrada ou, para
+// sessões legadas no formato user_{uuid} ainda sem registro, pelo usuário
+func (s *IngestaoWebhookService) organizacaoDaSessao(sessao string) *string {
+	var cadastrada models.SessaoWhatsApp
+	if s.db.Select("organizacao_id").Where("nome_sessao = ?", sessao).First(&cadastrada).Error == nil && cadastrada.OrganizacaoID != "" {
+		return &cadastrada.OrganizacaoID
+	}
+	if !strings.HasPrefix(sessao, "user_") {
+		return nil
+	}
+	var usuario models.Usuario
+	err := s.db.Select("organizacao_id").Where("id = ?", strings.TrimPrefix(sessao, "user_")).First(&usuario).Error
+	if err != nil || usuario.OrganizacaoID == "" {
+		return nil
+	}
+	return &usuario.OrganizacaoID
+}
+
+// ListarFalhas retorna os eventos com falha da organização
+func (s *IngestaoWebhookService) ListarFalhas(organizacaoID string, filtro FiltroFalhasWebhook) ([]models.EventoWebhookFalho, int64, error) {
+	query := s.db.Model(&models.EventoWebhookFalho{}).Scopes(repositories.PorOrganizacao(organizacaoID))
+
+	if filtro.Origem != "" {
+		query = query.Where("origem = ?", filtro.Origem)
+	}
+	if filtro.Status != "" {
+		query = query.Where("status = ?", filtro.Status)
+	}
+	if filtro.Evento != "" {
+		query = query.Where("evento = ?", filtro.Evento)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("erro ao contar eventos com falha: %w", err)
+	}
+
+	if filtro.Page < 1 {
+		filtro.Page = 1
+	}
+	if filtro.Limit < 1 || filtro.Limit > 100 {
+		filtro.Limit = 20
+	}
+
+	var falhas []models.EventoWebhookFalho
+	err := query.Order("criado_em DESC").
+		Offset((filtro.Page - 1) * filtro.Limit).
+		Limit(filtro.Limit).
+		Find(&falhas).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("erro ao buscar eventos com falha: %w", err)
+	}
+
+	return falhas, total, nil
+}
+
+// Reprocessar executa novamente o evento com falha, de forma síncrona. Em caso
+// de novo erro o evento continua pendente e o erro é retornado.
+func (s *IngestaoWebhookService) Reprocessar(organizacaoID, id, usuarioID string) (*models.EventoWebhookFalho, error) {
+	var falha models.EventoWebhookFalho
+	if err := s.db.Scopes(repositories.PorOrganizacao(organizacaoID)).
+		Where("id = ? AND status = ?", id, models.StatusFalhaWebhookPendente).
+		First(&falha).Error; err != nil {
+		return nil, err
+	}
+
+	// Apenas os consumidores que falharam são executados de novo; os demais
+	// já processaram o evento
+	falha.Tentativas++
+	causa := s.executar(falha.Origem, falha.Payload, falha.Consumidores)
+
+	updates := map[string]interface{}{"tentativas": falha.Tentativas}
+	if causa != nil {
+		falha.Erro = causa.Error()
+		updates["erro"] = falha.Erro
+		if consumidores := consumidoresComFalha(causa); consumidores != nil {
+			falha.Consumidores = consumidores
+			updates["consumidores"] = falha.Consumidores
+		}
+	} else {
+		agora := time.Now()
+		falha.Status = models.StatusFalhaWebhookReprocessado
+		falha.ReprocessadoEm = &agora
+		falha.ReprocessadoPor = &usuarioID
+		updates["status"] = falha.Status
+		updates["reprocessado_em"] = agora
+		updates["reprocessado_por"] = usuarioID
+	}
+	if err := s.db.Model(&falha).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	return &falha, causa
+}
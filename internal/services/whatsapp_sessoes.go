@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"tappyone/internal/models"
+	"tappyone/internal/repositories"
+
+	"gorm.io/gorm"
+)
+
+// ErrSessaoNaoPermitida sessão solicitada inexistente ou não liberada ao usuário
+var ErrSessaoNaoPermitida = errors.New("sessão do WhatsApp não encontrada ou não permitida ao usuário")
+
+// SessaoParaChat resolve a sessão usada pelo usuário para falar com o chat.
+// Ordem: a sessão solicitada (id ou nome), a sessão da conversa mais recente
+// do chat, a sessão padrão do usuário e, por fim, a sessão legada user_{uuid}.
+func (s *WhatsAppService) SessaoParaChat(usuarioID, chatID, solicitada string) (*models.SessaoWhatsApp, error) {
+	var usuario models.Usuario
+	if err := s.db.Select("id", "organizacao_id").Where("id = ?", usuarioID).First(&usuario).Error; err != nil {
+		return nil, fmt.Errorf("erro ao buscar usuário %s: %w", usuarioID, err)
+	}
+	if usuario.OrganizacaoID == "" {
+		// Usuários sem organização continuam na sessão individual
+		return &models.SessaoWhatsApp{NomeSessao: repositories.NomeSessaoLegada(usuarioID), UsuarioID: usuarioID}, nil
+	}
+
+	if solicitada != "" {
+		sessao, err := s.sessoes.BuscarPermitida(usuario.OrganizacaoID, usuarioID, solicitada)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessaoNaoPermitida
+		}
+		return sessao, err
+	}
+
+	if chatID != "" {
+		sessao, err := s.sessoes.DaConversa(usuario.OrganizacaoID, usuarioID, chatID)
+		if err == nil {
+			return sessao, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("erro ao buscar sessão da conversa %s: %w", chatID, err)
+		}
+	}
+
+	sessao, err := s.sessoes.PadraoDoUsuario(usuario.OrganizacaoID, usuarioID)
+	if err == nil {
+		return sessao, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("erro ao buscar sessão padrão: %w", err)
+	}
+	return s.sessoes.SessaoLegada(usuario.OrganizacaoID, usuarioID)
+}
+
+// NomeSessaoParaChat igual a SessaoParaChat, retornando o nome da sessão no WAHA
+func (s *WhatsAppService) NomeSessaoParaChat(usuarioID, chatID, solicitada string) (string, error) {
+	sessao, err := s.SessaoParaChat(usuarioID, chatID, solicitada)
+	if err != nil {
+		return "", err
+	}
+	return sessao.NomeSessao, nil
+}
+
+// SessoesPermitidas sessões da organização que o usuário pode usar
+func (s *WhatsAppService) SessoesPermitidas(organizacaoID, usuarioID string) ([]models.SessaoWhatsApp, error) {
+	return s.sessoes.ListarPermitidas(organizacaoID, usuarioID)
+}
+
+// ChatDaMensagem extrai o chat do id serializado de uma mensagem do WAHA
+// ({fromMe}_{chatId}_{id}); retorna vazio para ids em outro formato
+func ChatDaMensagem(messageID string) string {
+	partes := strings.SplitN(messageID, "_", 3)
+	if len(partes) != 3 || (partes[0] != "true" && partes[0] != "false") {
+		return ""
+	}
+	return partes[1]
+}
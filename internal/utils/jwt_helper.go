@@ -10,6 +10,11 @@ import (
 
 // ValidateJWTFromHeader valida JWT do header Authorization e retorna userID
 func ValidateJWTFromHeader(c *gin.Context, authService *services.AuthService) (string, error) {
+	// Rotas protegidas já passaram pelo AuthMiddleware (JWT ou chave de API)
+	if userID := c.GetString("user_id"); userID != "" {
+		return userID, nil
+	}
+
 	// Extrair token do header Authorization
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
@@ -22,12 +27,12 @@ func ValidateJWTFromHeader(c *gin.Context, authService *services.AuthService) (s
 	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
 		token = authHeader[7:]
 	} else {
-		log.Printf("Invalid authorization format: %s", authHeader)
+		log.Printf("Invalid authorization format")
 		return "", errors.New("invalid authorization format")
 	}
 
 	// Validar token
-	claims, err := authService.ValidateToken(token)
+	claims, err := authService.ValidateAccessToken(token)
 	if err != nil {
 		log.Printf("Token validation error: %v", err)
 		return "", err
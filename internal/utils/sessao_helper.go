@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"tappyone/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CabecalhoSessaoWhatsApp permite escolher a sessão de envio sem query string
+const CabecalhoSessaoWhatsApp = "X-Sessao-WhatsApp"
+
+// SessaoWhatsAppDoChat resolve o nome da sessão do WAHA usada pelo usuário
+// para o chat: a informada em ?sessao= ou no cabeçalho X-Sessao-WhatsApp,
+// senão a sessão da conversa do chat ou a sessão padrão do usuário. Em caso
+// de erro responde a requisição e retorna false.
+func SessaoWhatsAppDoChat(c *gin.Context, whatsappService *services.WhatsAppService, userID interface{}, chatID string) (string, bool) {
+	solicitada := c.Query("sessao")
+	if solicitada == "" {
+		solicitada = c.GetHeader(CabecalhoSessaoWhatsApp)
+	}
+
+	sessionName, err := whatsappService.NomeSessaoParaChat(fmt.Sprint(userID), chatID, solicitada)
+	if errors.Is(err, services.ErrSessaoNaoPermitida) {
+		c.JSON(403, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if err != nil {
+		log.Printf("[WHATSAPP] Erro ao resolver sessão do chat %s: %v", chatID, err)
+		c.JSON(500, gin.H{"error": "Erro ao resolver sessão do WhatsApp"})
+		return "", false
+	}
+	return sessionName, true
+}
+
+// FilaEnvioCheia responde 429 com a posição na fila quando o envio foi
+// recusado pelos limites de envio da sessão. Retorna false para os demais erros.
+func FilaEnvioCheia(c *gin.Context, err error) bool {
+	var fila *services.ErroFilaEnvio
+	if !errors.As(err, &fila) {
+		return false
+	}
+	segundos := int(math.Ceil(fila.Espera.Seconds()))
+	c.Header("Retry-After", fmt.Sprintf("%d", segundos))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":          err.Error(),
+		"posicao":        fila.Posicao,
+		"esperaSegundos": segundos,
+	})
+	return true
+}
@@ -0,0 +1,6 @@
+-- 009_add_organizacoes.sql
+-- Filas passam a pertencer a uma organização (as demais tabelas são
+-- ajustadas pelo AutoMigrate, que também preenche a organização padrão)
+
+ALTER TABLE filas ADD COLUMN IF NOT EXISTS organizacao_id UUID;
+CREATE INDEX IF NOT EXISTS idx_filas_organizacao_id ON filas(organizacao_id);
@@ -0,0 +1,14 @@
+-- 010_registros_auditoria_imutavel.sql
+-- Log de auditoria somente inserção: bloqueia UPDATE e DELETE em registros_auditoria
+-- (a tabela é criada pelo AutoMigrate; o mesmo SQL é aplicado em database.Migrate)
+
+CREATE OR REPLACE FUNCTION impedir_alteracao_auditoria() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'registros de auditoria são imutáveis';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS registros_auditoria_imutavel ON registros_auditoria;
+CREATE TRIGGER registros_auditoria_imutavel
+    BEFORE UPDATE OR DELETE ON registros_auditoria
+    FOR EACH ROW EXECUTE FUNCTION impedir_alteracao_auditoria();
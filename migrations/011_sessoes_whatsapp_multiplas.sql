@@ -0,0 +1,64 @@
+-- 011_sessoes_whatsapp_multiplas.sql
+-- Várias sessões do WhatsApp por organização: sessoes_whatsapp passa a ser a
+-- única fonte do estado das sessões e as conexões do WhatsApp em
+-- user_connections são migradas para ela
+-- (o mesmo SQL é aplicado em database.Migrate, após o AutoMigrate)
+
+ALTER TABLE sessoes_whatsapp
+    ADD COLUMN IF NOT EXISTS rotulo TEXT,
+    ADD COLUMN IF NOT EXISTS cor TEXT,
+    ADD COLUMN IF NOT EXISTS fila_padrao_id UUID,
+    ADD COLUMN IF NOT EXISTS padrao BOOLEAN DEFAULT false,
+    ADD COLUMN IF NOT EXISTS status_waha TEXT,
+    ADD COLUMN IF NOT EXISTS conectado_em TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS desconectado_em TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS ultima_sincronizacao TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS sessao_whatsapp_usuarios (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sessao_whatsapp_id UUID NOT NULL REFERENCES sessoes_whatsapp(id) ON DELETE CASCADE,
+    usuario_id UUID NOT NULL REFERENCES usuarios(id) ON DELETE CASCADE,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessao_whatsapp_usuario ON sessao_whatsapp_usuarios(sessao_whatsapp_id, usuario_id);
+
+-- Apenas uma sessão padrão por organização
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessoes_whatsapp_padrao ON sessoes_whatsapp(organizacao_id) WHERE padrao;
+
+BEGIN;
+
+-- Sessões default_ criadas automaticamente passam a usar o nome do WAHA
+UPDATE sessoes_whatsapp s SET nome_sessao = 'user_' || s.usuario_id
+WHERE s.nome_sessao = 'default_' || replace(s.usuario_id::text, '-', '')
+  AND NOT EXISTS (SELECT 1 FROM sessoes_whatsapp o WHERE o.nome_sessao = 'user_' || s.usuario_id);
+
+INSERT INTO sessoes_whatsapp (id, nome_sessao, status, ativo, usuario_id, organizacao_id, criado_em, atualizado_em)
+SELECT gen_random_uuid(), COALESCE(NULLIF(uc.session_name, ''), 'user_' || uc.user_id), 'DESCONECTADO', true,
+       uc.user_id, u.organizacao_id, uc.created_at, NOW()
+FROM user_connections uc
+JOIN usuarios u ON u.id = uc.user_id
+WHERE uc.platform = 'whatsapp' AND u.organizacao_id IS NOT NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM sessoes_whatsapp s
+      WHERE s.nome_sessao = COALESCE(NULLIF(uc.session_name, ''), 'user_' || uc.user_id)
+  )
+ON CONFLICT DO NOTHING;
+
+UPDATE sessoes_whatsapp s SET
+    status = CASE uc.status
+        WHEN 'connected' THEN 'CONECTADO'
+        WHEN 'connecting' THEN 'CONECTANDO'
+        WHEN 'error' THEN 'FALHOU'
+        ELSE 'DESCONECTADO'
+    END,
+    status_waha = uc.session_data->>'waha_status',
+    conectado_em = uc.connected_at,
+    desconectado_em = uc.disconnected_at,
+    ultima_sincronizacao = uc.last_sync_at
+FROM user_connections uc
+WHERE uc.platform = 'whatsapp'
+  AND s.nome_sessao = COALESCE(NULLIF(uc.session_name, ''), 'user_' || uc.user_id);
+
+DELETE FROM user_connections WHERE platform = 'whatsapp';
+
+COMMIT;
@@ -0,0 +1,25 @@
+-- 012_supervisor_sessoes_whatsapp.sql
+-- Supervisor das sessões do WhatsApp: estado dos reinícios automáticos e
+-- histórico de disponibilidade usado no cálculo de uptime e quedas
+
+ALTER TABLE sessoes_whatsapp
+    ADD COLUMN IF NOT EXISTS tentativas_reinicio INTEGER DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS proximo_reinicio_em TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS reautenticacao_alertada_em TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS eventos_sessao_whatsapp (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sessao_whatsapp_id UUID NOT NULL REFERENCES sessoes_whatsapp(id) ON DELETE CASCADE,
+    organizacao_id UUID,
+    tipo TEXT NOT NULL,             -- STATUS, REINICIO, REAUTENTICACAO
+    origem TEXT NOT NULL,           -- SUPERVISOR, WEBHOOK, API
+    status_anterior TEXT,
+    status_novo TEXT,
+    status_waha TEXT,
+    detalhe TEXT,
+    horario TIMESTAMP WITH TIME ZONE NOT NULL,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_eventos_sessao_whatsapp_horario ON eventos_sessao_whatsapp(sessao_whatsapp_id, horario);
+CREATE INDEX IF NOT EXISTS idx_eventos_sessao_whatsapp_organizacao_id ON eventos_sessao_whatsapp(organizacao_id);
@@ -0,0 +1,13 @@
+-- 013_busca_mensagens.sql
+-- Histórico de mensagens servido pelo banco: remetente das mensagens
+-- recebidas, busca textual em português e índice da paginação por cursor
+-- (o mesmo SQL é aplicado em database.Migrate, após o AutoMigrate)
+
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS remetente TEXT;
+CREATE INDEX IF NOT EXISTS idx_mensagens_remetente ON mensagens(remetente);
+
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS busca tsvector
+    GENERATED ALWAYS AS (to_tsvector('portuguese', coalesce(conteudo, '') || ' ' || coalesce(legenda, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_mensagens_busca ON mensagens USING GIN (busca);
+
+CREATE INDEX IF NOT EXISTS idx_mensagens_conversa_timestamp ON mensagens (conversa_id, timestamp DESC, id DESC);
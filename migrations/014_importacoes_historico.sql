@@ -0,0 +1,34 @@
+-- 014_importacoes_historico.sql
+-- Importação do histórico de conversas das sessões a partir do WAHA, com
+-- cursor (chat_atual, offset_mensagens) para retomar após interrupções
+
+CREATE TABLE IF NOT EXISTS importacoes_historico (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sessao_whatsapp_id UUID NOT NULL REFERENCES sessoes_whatsapp(id) ON DELETE CASCADE,
+    organizacao_id UUID,
+    usuario_id UUID NOT NULL,
+    status TEXT NOT NULL DEFAULT 'PENDENTE',  -- PENDENTE, EM_ANDAMENTO, PAUSADA, CONCLUIDA, FALHOU
+
+    baixar_midia BOOLEAN DEFAULT false,
+    desde TIMESTAMP WITH TIME ZONE,
+    limite_por_chat INTEGER DEFAULT 0,
+    requisicoes_por_minuto INTEGER DEFAULT 20,
+
+    chat_atual TEXT,
+    offset_mensagens INTEGER DEFAULT 0,
+
+    total_chats INTEGER DEFAULT 0,
+    chats_concluidos INTEGER DEFAULT 0,
+    mensagens_importadas INTEGER DEFAULT 0,
+    contatos_criados INTEGER DEFAULT 0,
+    midias_baixadas INTEGER DEFAULT 0,
+
+    erro TEXT,
+    iniciada_em TIMESTAMP WITH TIME ZONE,
+    finalizada_em TIMESTAMP WITH TIME ZONE,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_importacoes_historico_sessao_whatsapp_id ON importacoes_historico(sessao_whatsapp_id);
+CREATE INDEX IF NOT EXISTS idx_importacoes_historico_organizacao_id ON importacoes_historico(organizacao_id);
+CREATE INDEX IF NOT EXISTS idx_importacoes_historico_status ON importacoes_historico(status);
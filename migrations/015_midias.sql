@@ -0,0 +1,25 @@
+-- 015_midias.sql
+-- Mídias guardadas no armazenamento configurado (disco local ou S3), endereçadas
+-- pelo SHA-256 do conteúdo e servidas apenas por URL assinada
+
+CREATE TABLE IF NOT EXISTS midias (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organizacao_id UUID NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    chave TEXT NOT NULL,            -- chave do objeto no armazenamento
+    armazenamento TEXT NOT NULL,    -- local ou s3
+    tipo_mime TEXT NOT NULL,        -- detectado pelo conteúdo
+    tamanho BIGINT NOT NULL,
+    nome_original TEXT,
+    origem TEXT NOT NULL DEFAULT 'UPLOAD',  -- UPLOAD, WHATSAPP
+    usuario_id UUID,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Um registro por conteúdo em cada organização
+CREATE UNIQUE INDEX IF NOT EXISTS idx_midias_organizacao_sha256 ON midias(organizacao_id, sha256);
+CREATE INDEX IF NOT EXISTS idx_midias_sha256 ON midias(sha256);
+
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS midia_id UUID;
+CREATE INDEX IF NOT EXISTS idx_mensagens_midia_id ON mensagens(midia_id);
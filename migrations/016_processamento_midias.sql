@@ -0,0 +1,23 @@
+-- 016_processamento_midias.sql
+-- Fila de processamento das mídias (miniatura, blurhash, conversão de áudio
+-- para Opus/OGG e metadados). A própria tabela midias é a fila: o worker
+-- reserva as pendentes com SKIP LOCKED.
+
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS status_processamento TEXT NOT NULL DEFAULT 'PENDENTE';  -- PENDENTE, CONCLUIDO, FALHOU
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS tentativas_processamento INTEGER DEFAULT 0;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS proximo_processamento_em TIMESTAMP WITH TIME ZONE;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS erro_processamento TEXT;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS processada_em TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS largura INTEGER;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS altura INTEGER;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS duracao_segundos DOUBLE PRECISION;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS paginas INTEGER;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS blurhash TEXT;
+
+-- Objetos derivados no armazenamento
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS chave_miniatura TEXT;
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS chave_audio_ptt TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_midias_status_processamento ON midias(status_processamento);
+CREATE INDEX IF NOT EXISTS idx_midias_proximo_processamento_em ON midias(proximo_processamento_em);
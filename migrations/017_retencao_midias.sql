@@ -0,0 +1,57 @@
+-- 017_retencao_midias.sql
+-- Retenção de mídia por categoria, vínculos que protegem mídias de orçamentos
+-- e contratos, histórico das limpezas e cota de armazenamento por organização
+
+-- A retenção conta a partir do último uso (reenvio do mesmo conteúdo renova)
+ALTER TABLE midias ADD COLUMN IF NOT EXISTS ultimo_uso_em TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+UPDATE midias SET ultimo_uso_em = criado_em WHERE criado_em IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_midias_ultimo_uso_em ON midias(ultimo_uso_em);
+
+-- Mensagens cuja mídia foi apagada pela retenção
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS midia_expirada_em TIMESTAMP WITH TIME ZONE;
+
+-- Cota em bytes definida pelo operador (nula usa MEDIA_QUOTA_MB, zero é ilimitada)
+ALTER TABLE organizacoes ADD COLUMN IF NOT EXISTS cota_midia_bytes BIGINT;
+
+CREATE TABLE IF NOT EXISTS politicas_retencao_midia (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organizacao_id UUID NOT NULL,
+    categoria TEXT NOT NULL,        -- IMAGEM, VIDEO, AUDIO, DOCUMENTO
+    dias_retencao INTEGER NOT NULL,
+    ativa BOOLEAN DEFAULT TRUE,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_politicas_retencao_midia_organizacao_categoria ON politicas_retencao_midia(organizacao_id, categoria);
+
+CREATE TABLE IF NOT EXISTS vinculos_midia (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    midia_id UUID NOT NULL,
+    organizacao_id UUID NOT NULL,
+    entidade TEXT NOT NULL,         -- orcamento, contrato
+    entidade_id UUID NOT NULL,
+    usuario_id UUID,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vinculos_midia_entidade ON vinculos_midia(midia_id, entidade, entidade_id);
+CREATE INDEX IF NOT EXISTS idx_vinculos_midia_organizacao_id ON vinculos_midia(organizacao_id);
+CREATE INDEX IF NOT EXISTS idx_vinculos_midia_entidade_id ON vinculos_midia(entidade_id);
+
+CREATE TABLE IF NOT EXISTS execucoes_retencao_midia (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organizacao_id UUID NOT NULL,
+    simulacao BOOLEAN NOT NULL,
+    agendada BOOLEAN NOT NULL DEFAULT FALSE,
+    midias BIGINT NOT NULL DEFAULT 0,
+    bytes_liberados BIGINT NOT NULL DEFAULT 0,
+    detalhes JSONB,                 -- totais por categoria
+    erro TEXT,
+    finalizada_em TIMESTAMP WITH TIME ZONE,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_execucoes_retencao_midia_organizacao_id ON execucoes_retencao_midia(organizacao_id);
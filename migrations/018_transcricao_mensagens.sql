@@ -0,0 +1,25 @@
+-- 018_transcricao_mensagens.sql
+-- Transcrição das mensagens de voz recebidas. A própria tabela mensagens é a
+-- fila (status_transcricao) e a transcrição passa a fazer parte da busca
+-- textual (o mesmo SQL é aplicado em database.Migrate, após o AutoMigrate)
+
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS transcricao TEXT;
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS idioma_transcricao TEXT;            -- ISO 639-1 detectado (ex: pt)
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS status_transcricao TEXT;            -- PENDENTE, CONCLUIDA, FALHOU, IGNORADA
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS tentativas_transcricao INTEGER DEFAULT 0;
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS proxima_transcricao_em TIMESTAMP WITH TIME ZONE;
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS erro_transcricao TEXT;
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS transcrita_em TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_mensagens_status_transcricao ON mensagens(status_transcricao);
+
+-- Transcrição automática por organização (sem idioma, o provedor detecta)
+ALTER TABLE organizacoes ADD COLUMN IF NOT EXISTS transcricao_audio_ativa BOOLEAN DEFAULT FALSE;
+ALTER TABLE organizacoes ADD COLUMN IF NOT EXISTS idioma_transcricao TEXT;
+
+-- A expressão de uma coluna gerada não pode ser alterada: recria a busca
+-- (e o índice GIN) incluindo a transcrição
+ALTER TABLE mensagens DROP COLUMN IF EXISTS busca;
+ALTER TABLE mensagens ADD COLUMN busca tsvector
+    GENERATED ALWAYS AS (to_tsvector('portuguese',
+        coalesce(conteudo, '') || ' ' || coalesce(legenda, '') || ' ' || coalesce(transcricao, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_mensagens_busca ON mensagens USING GIN (busca);
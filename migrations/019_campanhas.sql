@@ -0,0 +1,65 @@
+-- 019_campanhas.sql
+-- Campanhas de disparo em massa com destinatários fixados no início do envio
+-- e lista de descadastro (respostas SAIR/STOP)
+
+CREATE TABLE IF NOT EXISTS campanhas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organizacao_id UUID NOT NULL,
+    usuario_id UUID NOT NULL,
+    sessao_whatsapp_id UUID NOT NULL,
+    nome TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'RASCUNHO',  -- RASCUNHO, AGENDADA, EM_ANDAMENTO, PAUSADA, CONCLUIDA, CANCELADA
+    mensagem TEXT,
+    resposta_rapida_id UUID,
+    segmento JSONB NOT NULL DEFAULT '{}',     -- tags, filas, colunas do Kanban e filtros
+    agendada_para TIMESTAMP WITH TIME ZONE,
+    mensagens_por_minuto INTEGER DEFAULT 10,
+    intervalo_minimo_segundos INTEGER DEFAULT 8,
+    intervalo_maximo_segundos INTEGER DEFAULT 20,
+    total_destinatarios INTEGER DEFAULT 0,
+    erro TEXT,
+    iniciada_em TIMESTAMP WITH TIME ZONE,
+    finalizada_em TIMESTAMP WITH TIME ZONE,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_campanhas_organizacao_id ON campanhas(organizacao_id);
+CREATE INDEX IF NOT EXISTS idx_campanhas_sessao_whatsapp_id ON campanhas(sessao_whatsapp_id);
+CREATE INDEX IF NOT EXISTS idx_campanhas_status ON campanhas(status);
+
+CREATE TABLE IF NOT EXISTS destinatarios_campanha (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    campanha_id UUID NOT NULL,
+    contato_id UUID,
+    chat_id TEXT NOT NULL,
+    nome TEXT,
+    status TEXT NOT NULL DEFAULT 'PENDENTE',  -- PENDENTE, ENVIANDO, ENVIADO, ENTREGUE, LIDO, RESPONDIDO, FALHOU, SUPRIMIDO, CANCELADO
+    id_mensagem TEXT,                         -- última mensagem enviada, acompanhada pelos acks
+    erro TEXT,
+    enviado_em TIMESTAMP WITH TIME ZONE,
+    entregue_em TIMESTAMP WITH TIME ZONE,
+    lido_em TIMESTAMP WITH TIME ZONE,
+    respondido_em TIMESTAMP WITH TIME ZONE,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_destinatarios_campanha_chat ON destinatarios_campanha(campanha_id, chat_id);
+CREATE INDEX IF NOT EXISTS idx_destinatarios_campanha_chat_id ON destinatarios_campanha(chat_id);
+CREATE INDEX IF NOT EXISTS idx_destinatarios_campanha_status ON destinatarios_campanha(status);
+CREATE INDEX IF NOT EXISTS idx_destinatarios_campanha_id_mensagem ON destinatarios_campanha(id_mensagem);
+
+CREATE TABLE IF NOT EXISTS descadastros (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organizacao_id UUID NOT NULL,
+    numero_telefone TEXT NOT NULL,
+    origem TEXT NOT NULL,                     -- palavra_chave, manual
+    palavra TEXT,
+    campanha_id UUID,
+    usuario_id UUID,
+    criado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    atualizado_em TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_descadastros_organizacao_numero ON descadastros(organizacao_id, numero_telefone);
@@ -0,0 +1,21 @@
+-- 020_sla_organizacao.sql
+-- Políticas e eventos de SLA passam a pertencer a uma organização.
+-- Eventos herdam a organização da política; políticas sem organização
+-- definida recebem a organização padrão no backfill do AutoMigrate
+
+ALTER TABLE politicas_sla ADD COLUMN IF NOT EXISTS organizacao_id UUID;
+CREATE INDEX IF NOT EXISTS idx_politicas_sla_organizacao_id ON politicas_sla(organizacao_id);
+
+ALTER TABLE eventos_sla ADD COLUMN IF NOT EXISTS organizacao_id UUID;
+CREATE INDEX IF NOT EXISTS idx_eventos_sla_organizacao_id ON eventos_sla(organizacao_id);
+
+-- Políticas criadas antes da coluna assumem a organização do criador
+UPDATE politicas_sla p
+   SET organizacao_id = u.organizacao_id
+  FROM usuarios u
+ WHERE p.organizacao_id IS NULL AND p.criado_por = u.id::text;
+
+UPDATE eventos_sla e
+   SET organizacao_id = p.organizacao_id
+  FROM politicas_sla p
+ WHERE e.organizacao_id IS NULL AND e.politica_sla_id = p.id::text;
@@ -0,0 +1,9 @@
+-- 021_eventos_sla_unicos.sql
+-- Um único evento de SLA por atendimento, prazo e estado: avaliações
+-- simultâneas não duplicam avisos nem escalonamentos
+
+DELETE FROM eventos_sla e USING eventos_sla o
+WHERE e.atendimento_id = o.atendimento_id AND e.tipo_prazo = o.tipo_prazo AND e.estado = o.estado
+  AND (e.detectado_em, e.id) > (o.detectado_em, o.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_eventos_sla_atendimento_prazo_estado ON eventos_sla(atendimento_id, tipo_prazo, estado);